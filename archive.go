@@ -0,0 +1,553 @@
+package git
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/gitattributes"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/utils/ioutil"
+)
+
+// ArchiveFormat is the format of an archive created by Repository.Archive.
+type ArchiveFormat string
+
+const (
+	// ArchiveTar is an uncompressed tar archive.
+	ArchiveTar ArchiveFormat = "tar"
+	// ArchiveTarGzip is a tar archive compressed with gzip.
+	ArchiveTarGzip ArchiveFormat = "tar.gz"
+	// ArchiveZip is a zip archive.
+	ArchiveZip ArchiveFormat = "zip"
+)
+
+var (
+	// ErrUnsupportedArchiveFormat is returned by Archive when the format is
+	// not one of the known archive formats.
+	ErrUnsupportedArchiveFormat = errors.New("unsupported archive format")
+)
+
+const (
+	exportIgnoreAttr  = "export-ignore"
+	exportSubstAttr   = "export-subst"
+	gitattributesFile = ".gitattributes"
+)
+
+// Archive writes to w an archive of the given tree-ish in the given format,
+// the same as `git archive`. If the tree-ish resolves to a commit, its
+// committer date is used as modification time of the entries and its hash
+// is stored in the archive comment. The files with the export-ignore
+// attribute are not included, and the $Format:...$ placeholders of the files
+// with the export-subst attribute are expanded, according to the
+// .gitattributes files of the archived tree.
+func (r *Repository) Archive(treeish plumbing.Revision, format ArchiveFormat, w io.Writer, o *ArchiveOptions) error {
+	if o == nil {
+		o = &ArchiveOptions{}
+	}
+
+	if err := o.Validate(); err != nil {
+		return err
+	}
+
+	commit, tree, err := r.resolveTreeish(treeish)
+	if err != nil {
+		return err
+	}
+
+	mtime := time.Now()
+	if commit != nil {
+		mtime = commit.Committer.When
+	}
+
+	a, err := newArchiver(format, w)
+	if err != nil {
+		return err
+	}
+
+	if commit != nil {
+		if err := a.comment(commit.Hash.String()); err != nil {
+			return err
+		}
+	}
+
+	aw := &archiveWalker{
+		archiver: a,
+		commit:   commit,
+		mtime:    mtime,
+		o:        o,
+		written:  make(map[string]bool),
+	}
+
+	if err := aw.walk(tree, nil, nil); err != nil {
+		return err
+	}
+
+	return a.close()
+}
+
+// resolveTreeish returns the tree of the given revision and the commit it
+// belongs to, nil if the revision is a tree hash.
+func (r *Repository) resolveTreeish(rev plumbing.Revision) (*object.Commit, *object.Tree, error) {
+	if plumbing.IsHash(string(rev)) {
+		obj, err := r.Object(plumbing.AnyObject, plumbing.NewHash(string(rev)))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if t, ok := obj.(*object.Tag); ok {
+			if obj, err = t.Object(); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		switch o := obj.(type) {
+		case *object.Tree:
+			return nil, o, nil
+		case *object.Commit:
+			t, err := o.Tree()
+			return o, t, err
+		default:
+			return nil, nil, plumbing.ErrInvalidType
+		}
+	}
+
+	h, err := r.ResolveRevision(rev)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c, err := r.CommitObject(*h)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	t, err := c.Tree()
+	return c, t, err
+}
+
+type archiveWalker struct {
+	archiver
+	commit  *object.Commit
+	mtime   time.Time
+	o       *ArchiveOptions
+	written map[string]bool
+}
+
+func (w *archiveWalker) walk(t *object.Tree, dir []string, attrs []gitattributes.MatchAttribute) error {
+	attrs, err := w.readAttributes(t, dir, attrs)
+	if err != nil {
+		return err
+	}
+
+	m := gitattributes.NewMatcher(attrs)
+	for _, e := range t.Entries {
+		p := append(append([]string{}, dir...), e.Name)
+		results, _ := m.Match(p, []string{exportIgnoreAttr, exportSubstAttr})
+		if a, ok := results[exportIgnoreAttr]; ok && a.IsSet() {
+			continue
+		}
+
+		name := strings.Join(p, "/")
+		switch e.Mode {
+		case filemode.Dir:
+			sub, err := t.Tree(e.Name)
+			if err != nil {
+				return err
+			}
+
+			if err := w.walk(sub, p, attrs); err != nil {
+				return err
+			}
+		case filemode.Submodule:
+			if w.matchPathSpecs(name) {
+				if err := w.writeDirs(name + "/"); err != nil {
+					return err
+				}
+			}
+		default:
+			if !w.matchPathSpecs(name) {
+				continue
+			}
+
+			a, ok := results[exportSubstAttr]
+			if err := w.writeEntry(t, e, name, ok && a.IsSet()); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (w *archiveWalker) readAttributes(t *object.Tree, dir []string, attrs []gitattributes.MatchAttribute) ([]gitattributes.MatchAttribute, error) {
+	f, err := t.File(gitattributesFile)
+	if err == object.ErrFileNotFound {
+		return attrs, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := f.Reader()
+	if err != nil {
+		return nil, err
+	}
+
+	defer r.Close()
+	read, err := gitattributes.ReadAttributes(r, dir, len(dir) == 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(append([]gitattributes.MatchAttribute{}, attrs...), read...), nil
+}
+
+func (w *archiveWalker) matchPathSpecs(name string) bool {
+	if len(w.o.PathSpecs) == 0 {
+		return true
+	}
+
+	for _, ps := range w.o.PathSpecs {
+		if ps.MatchString(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (w *archiveWalker) writeEntry(t *object.Tree, e object.TreeEntry, name string, subst bool) error {
+	f, err := t.TreeEntryFile(&e)
+	if err != nil {
+		return err
+	}
+
+	content, err := readBlob(f)
+	if err != nil {
+		return err
+	}
+
+	if subst && w.commit != nil && e.Mode != filemode.Symlink {
+		content = expandFormat(content, w.commit)
+	}
+
+	if err := w.writeDirs(name); err != nil {
+		return err
+	}
+
+	return w.file(w.o.Prefix+name, e.Mode, content, w.mtime)
+}
+
+// writeDirs writes the entries of the parent directories of name, including
+// the prefix, not written yet.
+func (w *archiveWalker) writeDirs(name string) error {
+	full := w.o.Prefix + name
+	for i := 0; i < len(full); i++ {
+		if full[i] != '/' {
+			continue
+		}
+
+		if err := w.writeDir(full[:i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *archiveWalker) writeDir(dir string) error {
+	if w.written[dir] {
+		return nil
+	}
+
+	w.written[dir] = true
+	return w.dir(dir+"/", w.mtime)
+}
+
+func readBlob(f *object.File) (content []byte, err error) {
+	r, err := f.Reader()
+	if err != nil {
+		return nil, err
+	}
+
+	defer ioutil.CheckClose(r, &err)
+
+	buf := bytes.NewBuffer(make([]byte, 0, f.Size))
+	if _, err = buf.ReadFrom(r); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// archiver writes the entries of an archive.
+type archiver interface {
+	comment(string) error
+	dir(name string, mtime time.Time) error
+	file(name string, mode filemode.FileMode, content []byte, mtime time.Time) error
+	close() error
+}
+
+func newArchiver(format ArchiveFormat, w io.Writer) (archiver, error) {
+	switch format {
+	case ArchiveTar:
+		return &tarArchiver{w: tar.NewWriter(w)}, nil
+	case ArchiveTarGzip:
+		gz := gzip.NewWriter(w)
+		return &tarArchiver{w: tar.NewWriter(gz), gz: gz}, nil
+	case ArchiveZip:
+		return &zipArchiver{w: zip.NewWriter(w)}, nil
+	default:
+		return nil, ErrUnsupportedArchiveFormat
+	}
+}
+
+type tarArchiver struct {
+	w  *tar.Writer
+	gz *gzip.Writer
+}
+
+// comment writes the pax global header carrying the commit id, the same
+// `git get-tar-commit-id` reads.
+func (a *tarArchiver) comment(c string) error {
+	return a.w.WriteHeader(&tar.Header{
+		Typeflag:   tar.TypeXGlobalHeader,
+		Name:       "pax_global_header",
+		PAXRecords: map[string]string{"comment": c},
+	})
+}
+
+func (a *tarArchiver) dir(name string, mtime time.Time) error {
+	return a.w.WriteHeader(a.header(tar.TypeDir, name, 0775, mtime))
+}
+
+func (a *tarArchiver) file(name string, mode filemode.FileMode, content []byte, mtime time.Time) error {
+	if mode == filemode.Symlink {
+		h := a.header(tar.TypeSymlink, name, 0777, mtime)
+		h.Linkname = string(content)
+		return a.w.WriteHeader(h)
+	}
+
+	perm := int64(0664)
+	if mode == filemode.Executable {
+		perm = 0775
+	}
+
+	h := a.header(tar.TypeReg, name, perm, mtime)
+	h.Size = int64(len(content))
+	if err := a.w.WriteHeader(h); err != nil {
+		return err
+	}
+
+	_, err := a.w.Write(content)
+	return err
+}
+
+func (a *tarArchiver) header(typ byte, name string, mode int64, mtime time.Time) *tar.Header {
+	return &tar.Header{
+		Typeflag: typ,
+		Name:     name,
+		Mode:     mode,
+		ModTime:  mtime,
+		Uname:    "root",
+		Gname:    "root",
+	}
+}
+
+func (a *tarArchiver) close() error {
+	if err := a.w.Close(); err != nil {
+		return err
+	}
+
+	if a.gz != nil {
+		return a.gz.Close()
+	}
+
+	return nil
+}
+
+type zipArchiver struct {
+	w *zip.Writer
+}
+
+func (a *zipArchiver) comment(c string) error {
+	return a.w.SetComment(c)
+}
+
+func (a *zipArchiver) dir(name string, mtime time.Time) error {
+	_, err := a.w.CreateHeader(a.header(name, os.ModeDir|0755, mtime, zip.Store))
+	return err
+}
+
+func (a *zipArchiver) file(name string, mode filemode.FileMode, content []byte, mtime time.Time) error {
+	perm, method := os.FileMode(0644), zip.Deflate
+	switch mode {
+	case filemode.Executable:
+		perm = 0755
+	case filemode.Symlink:
+		perm, method = os.ModeSymlink|0777, zip.Store
+	}
+
+	f, err := a.w.CreateHeader(a.header(name, perm, mtime, method))
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(content)
+	return err
+}
+
+func (a *zipArchiver) header(name string, mode os.FileMode, mtime time.Time, method uint16) *zip.FileHeader {
+	h := &zip.FileHeader{Name: name, Method: method, Modified: mtime}
+	h.SetMode(mode)
+	return h
+}
+
+func (a *zipArchiver) close() error {
+	return a.w.Close()
+}
+
+// expandFormat replaces the $Format:...$ placeholders of content with the
+// information of the commit c, as described by the pretty formats of
+// `git log`. Only the most common placeholders are supported, the others are
+// kept verbatim.
+func expandFormat(content []byte, c *object.Commit) []byte {
+	const start, end = "$Format:", "$"
+
+	var buf bytes.Buffer
+	for {
+		i := bytes.Index(content, []byte(start))
+		if i < 0 {
+			break
+		}
+
+		j := bytes.Index(content[i+len(start):], []byte(end))
+		if j < 0 {
+			break
+		}
+
+		buf.Write(content[:i])
+		format := content[i+len(start) : i+len(start)+j]
+		if bytes.IndexByte(format, '\n') >= 0 {
+			buf.Write(content[i : i+len(start)+j+len(end)])
+		} else {
+			buf.WriteString(formatCommit(string(format), c))
+		}
+
+		content = content[i+len(start)+j+len(end):]
+	}
+
+	buf.Write(content)
+	return buf.Bytes()
+}
+
+const (
+	formatDefaultDate = "Mon Jan 2 15:04:05 2006 -0700"
+	formatISODate     = "2006-01-02 15:04:05 -0700"
+)
+
+func formatCommit(format string, c *object.Commit) string {
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 == len(format) {
+			b.WriteByte(format[i])
+			continue
+		}
+
+		v, n := formatPlaceholder(format[i+1:], c)
+		if n == 0 {
+			b.WriteByte(format[i])
+			continue
+		}
+
+		b.WriteString(v)
+		i += n
+	}
+
+	return b.String()
+}
+
+// formatPlaceholder returns the expansion of the placeholder at the start of
+// p and its length, zero if it is unknown.
+func formatPlaceholder(p string, c *object.Commit) (string, int) {
+	switch p[0] {
+	case '%':
+		return "%", 1
+	case 'n':
+		return "\n", 1
+	case 'H':
+		return c.Hash.String(), 1
+	case 'h':
+		return c.Hash.String()[:7], 1
+	case 'T':
+		return c.TreeHash.String(), 1
+	case 't':
+		return c.TreeHash.String()[:7], 1
+	case 'P', 'p':
+		parents := make([]string, len(c.ParentHashes))
+		for i, h := range c.ParentHashes {
+			parents[i] = h.String()
+			if p[0] == 'p' {
+				parents[i] = parents[i][:7]
+			}
+		}
+
+		return strings.Join(parents, " "), 1
+	case 's':
+		return strings.SplitN(c.Message, "\n", 2)[0], 1
+	case 'b':
+		parts := strings.SplitN(c.Message, "\n\n", 2)
+		if len(parts) < 2 {
+			return "", 1
+		}
+
+		return parts[1], 1
+	case 'B':
+		return c.Message, 1
+	case 'a', 'c':
+		if len(p) < 2 {
+			return "", 0
+		}
+
+		sig := c.Author
+		if p[0] == 'c' {
+			sig = c.Committer
+		}
+
+		if v, ok := formatSignature(p[1], sig); ok {
+			return v, 2
+		}
+	}
+
+	return "", 0
+}
+
+func formatSignature(field byte, s object.Signature) (string, bool) {
+	switch field {
+	case 'n':
+		return s.Name, true
+	case 'e':
+		return s.Email, true
+	case 'd':
+		return s.When.Format(formatDefaultDate), true
+	case 't':
+		return strconv.FormatInt(s.When.Unix(), 10), true
+	case 'i':
+		return s.When.Format(formatISODate), true
+	case 'I':
+		return s.When.Format(time.RFC3339), true
+	default:
+		return "", false
+	}
+}
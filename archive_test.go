@@ -0,0 +1,180 @@
+package git
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-billy.v4/util"
+	"gopkg.in/src-d/go-git-fixtures.v3"
+)
+
+type ArchiveSuite struct {
+	BaseSuite
+}
+
+var _ = Suite(&ArchiveSuite{})
+
+func (s *ArchiveSuite) TestArchiveTar(c *C) {
+	r := s.NewRepository(fixtures.Basic().One())
+
+	buf := bytes.NewBuffer(nil)
+	err := r.Archive("master", ArchiveTar, buf, &ArchiveOptions{Prefix: "basic/"})
+	c.Assert(err, IsNil)
+
+	commit, err := r.CommitObject(plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	c.Assert(err, IsNil)
+
+	tr := tar.NewReader(buf)
+	h, err := tr.Next()
+	c.Assert(err, IsNil)
+	c.Assert(h.Typeflag, Equals, byte(tar.TypeXGlobalHeader))
+	c.Assert(h.PAXRecords["comment"], Equals, commit.Hash.String())
+
+	entries := make(map[string]*tar.Header)
+	var names []string
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+
+		c.Assert(err, IsNil)
+		c.Assert(h.ModTime.Unix(), Equals, commit.Committer.When.Unix())
+		entries[h.Name] = h
+		names = append(names, h.Name)
+	}
+
+	c.Assert(names[0], Equals, "basic/")
+	c.Assert(entries, HasLen, 14)
+	c.Assert(entries["basic/go/"].Typeflag, Equals, byte(tar.TypeDir))
+	c.Assert(entries["basic/go/example.go"].Typeflag, Equals, byte(tar.TypeReg))
+	c.Assert(entries["basic/go/example.go"].Mode, Equals, int64(0664))
+	c.Assert(entries["basic/go/example.go"].Size, Equals, int64(2780))
+}
+
+func (s *ArchiveSuite) TestArchiveTarGzipPathSpecs(c *C) {
+	r := s.NewRepository(fixtures.Basic().One())
+
+	buf := bytes.NewBuffer(nil)
+	err := r.Archive("6ecf0ef2c2dffb796033e5a02219af86ec6584e5", ArchiveTarGzip, buf, &ArchiveOptions{
+		PathSpecs: []*regexp.Regexp{regexp.MustCompile("^json/")},
+	})
+	c.Assert(err, IsNil)
+
+	gz, err := gzip.NewReader(buf)
+	c.Assert(err, IsNil)
+
+	var names []string
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+
+		c.Assert(err, IsNil)
+		names = append(names, h.Name)
+	}
+
+	c.Assert(names, DeepEquals, []string{
+		"pax_global_header", "json/", "json/long.json", "json/short.json",
+	})
+}
+
+func (s *ArchiveSuite) TestArchiveTree(c *C) {
+	r := s.NewRepository(fixtures.Basic().One())
+
+	buf := bytes.NewBuffer(nil)
+	err := r.Archive("a8d315b2b1c615d43042c3a62402b8a54288cf5c", ArchiveTar, buf, nil)
+	c.Assert(err, IsNil)
+
+	h, err := tar.NewReader(buf).Next()
+	c.Assert(err, IsNil)
+	c.Assert(h.Typeflag, Not(Equals), byte(tar.TypeXGlobalHeader))
+}
+
+func (s *ArchiveSuite) TestArchiveUnsupportedFormat(c *C) {
+	r := s.NewRepository(fixtures.Basic().One())
+
+	err := r.Archive("master", "rar", ioutil.Discard, nil)
+	c.Assert(err, Equals, ErrUnsupportedArchiveFormat)
+
+	err = r.Archive("master", ArchiveTar, ioutil.Discard, &ArchiveOptions{Prefix: "/foo"})
+	c.Assert(err, Equals, ErrInvalidArchivePrefix)
+}
+
+func (s *ArchiveSuite) TestArchiveZipAttributes(c *C) {
+	fs := memfs.New()
+	r, err := Init(memory.NewStorage(), fs)
+	c.Assert(err, IsNil)
+
+	files := map[string]string{
+		".gitattributes":      "secret export-ignore\nversion.txt export-subst\n",
+		"secret":              "password",
+		"version.txt":         "$Format:%H by %an$ ($Format:%s$)\n",
+		"docs/.gitattributes": "*.tmp export-ignore\n",
+		"docs/README":         "$Format:%H$\n",
+		"docs/draft.tmp":      "draft",
+	}
+
+	for name, content := range files {
+		c.Assert(util.WriteFile(fs, name, []byte(content), 0644), IsNil)
+	}
+
+	c.Assert(util.WriteFile(fs, "run.sh", []byte("#!/bin/sh\n"), 0755), IsNil)
+	c.Assert(fs.Symlink("run.sh", "link"), IsNil)
+
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+	c.Assert(w.AddGlob("*"), IsNil)
+
+	sig := &object.Signature{Name: "foo", Email: "foo@foo.foo", When: time.Unix(1500000000, 0)}
+	h, err := w.Commit("subject\n\nbody\n", &CommitOptions{Author: sig, Committer: sig})
+	c.Assert(err, IsNil)
+
+	buf := bytes.NewBuffer(nil)
+	err = r.Archive("HEAD", ArchiveZip, buf, &ArchiveOptions{Prefix: "v1/"})
+	c.Assert(err, IsNil)
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	c.Assert(err, IsNil)
+	c.Assert(zr.Comment, Equals, h.String())
+
+	entries := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		entries[f.Name] = f
+	}
+
+	c.Assert(entries, HasLen, 8)
+	c.Assert(entries["v1/secret"], IsNil)
+	c.Assert(entries["v1/docs/draft.tmp"], IsNil)
+	c.Assert(entries["v1/docs/"].Mode().IsDir(), Equals, true)
+	c.Assert(entries["v1/run.sh"].Mode().Perm(), Equals, os.FileMode(0755))
+	c.Assert(entries["v1/link"].Mode()&os.ModeSymlink, Equals, os.ModeSymlink)
+	c.Assert(readZipFile(c, entries["v1/link"]), Equals, "run.sh")
+	c.Assert(readZipFile(c, entries["v1/version.txt"]), Equals, h.String()+" by foo (subject)\n")
+	c.Assert(readZipFile(c, entries["v1/docs/README"]), Equals, "$Format:%H$\n")
+}
+
+func readZipFile(c *C, f *zip.File) string {
+	r, err := f.Open()
+	c.Assert(err, IsNil)
+	defer r.Close()
+
+	content, err := ioutil.ReadAll(r)
+	c.Assert(err, IsNil)
+	return string(content)
+}
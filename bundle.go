@@ -0,0 +1,234 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/bundle"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/revlist"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+var (
+	// ErrEmptyBundle is returned by CreateBundle when no object or reference
+	// would be included in the bundle.
+	ErrEmptyBundle = errors.New("refusing to create empty bundle")
+)
+
+// MissingPrerequisitesError is returned by VerifyBundle when the repository
+// lacks some of the commits required by the bundle.
+type MissingPrerequisitesError struct {
+	Prerequisites []bundle.Prerequisite
+}
+
+func (e *MissingPrerequisitesError) Error() string {
+	hashes := make([]string, len(e.Prerequisites))
+	for i, p := range e.Prerequisites {
+		hashes[i] = p.Hash.String()
+	}
+
+	return fmt.Sprintf("repository lacks the prerequisite commits: %s",
+		strings.Join(hashes, ", "))
+}
+
+// CreateBundle writes to w a bundle containing the given references and all
+// the objects reachable from them, excluding the objects reachable from
+// excludes, the same as `git bundle create <file> <refs> ^<excludes>`. The
+// commits on the boundary of the excluded history are recorded as
+// prerequisites. If no reference is given, all the references of the
+// repository, including HEAD, are bundled.
+func (r *Repository) CreateBundle(w io.Writer, refs []plumbing.ReferenceName, excludes []plumbing.Hash) error {
+	b := bundle.New()
+	if err := r.addBundleReferences(b, refs); err != nil {
+		return err
+	}
+
+	if len(b.References) == 0 {
+		return ErrEmptyBundle
+	}
+
+	var wants []plumbing.Hash
+	for _, ref := range b.References {
+		wants = append(wants, ref.Hash())
+	}
+
+	objs, err := revlist.Objects(r.Storer, wants, excludes)
+	if err != nil {
+		return err
+	}
+
+	if len(objs) == 0 {
+		return ErrEmptyBundle
+	}
+
+	b.Prerequisites, err = r.bundlePrerequisites(wants, excludes)
+	if err != nil {
+		return err
+	}
+
+	if err := bundle.NewEncoder(w).Encode(b); err != nil {
+		return err
+	}
+
+	cfg, err := r.Storer.Config()
+	if err != nil {
+		return err
+	}
+
+	_, err = packfile.NewEncoder(w, r.Storer, false).Encode(objs, cfg.Pack.Window)
+	return err
+}
+
+func (r *Repository) addBundleReferences(b *bundle.Bundle, names []plumbing.ReferenceName) error {
+	if len(names) == 0 {
+		iter, err := r.Storer.IterReferences()
+		if err != nil {
+			return err
+		}
+
+		names = append(names, plumbing.HEAD)
+		err = iter.ForEach(func(ref *plumbing.Reference) error {
+			if ref.Name() != plumbing.HEAD {
+				names = append(names, ref.Name())
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, name := range names {
+		ref, err := storer.ResolveReference(r.Storer, name)
+		if err == plumbing.ErrReferenceNotFound && len(names) > 1 && name == plumbing.HEAD {
+			// an unborn HEAD is not bundled when bundling everything
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		b.References = append(b.References, plumbing.NewHashReference(name, ref.Hash()))
+	}
+
+	return nil
+}
+
+// bundlePrerequisites returns the commits reachable from excludes that are
+// parents of commits reachable from wants but not from excludes.
+func (r *Repository) bundlePrerequisites(wants, excludes []plumbing.Hash) ([]bundle.Prerequisite, error) {
+	if len(excludes) == 0 {
+		return nil, nil
+	}
+
+	excluded := make(map[plumbing.Hash]bool)
+	for _, h := range excludes {
+		c, err := r.bundleCommit(h)
+		if err != nil {
+			return nil, err
+		}
+
+		if c == nil {
+			continue
+		}
+
+		err = object.NewCommitPreorderIter(c, excluded, nil).ForEach(func(c *object.Commit) error {
+			excluded[c.Hash] = true
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var result []bundle.Prerequisite
+	added := make(map[plumbing.Hash]bool)
+	for _, h := range wants {
+		c, err := r.bundleCommit(h)
+		if err != nil {
+			return nil, err
+		}
+
+		if c == nil || excluded[c.Hash] {
+			continue
+		}
+
+		err = object.NewCommitPreorderIter(c, excluded, nil).ForEach(func(c *object.Commit) error {
+			for _, p := range c.ParentHashes {
+				if !excluded[p] || added[p] {
+					continue
+				}
+
+				parent, err := r.CommitObject(p)
+				if err != nil {
+					return err
+				}
+
+				added[p] = true
+				result = append(result, bundle.Prerequisite{
+					Hash:    p,
+					Comment: strings.SplitN(parent.Message, "\n", 2)[0],
+				})
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// bundleCommit returns the commit pointed by h, peeling tags. Returns a nil
+// commit if h doesn't point to a commit.
+func (r *Repository) bundleCommit(h plumbing.Hash) (*object.Commit, error) {
+	h, err := r.resolveToCommitHash(h)
+	if err == ErrUnableToResolveCommit {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return r.CommitObject(h)
+}
+
+// VerifyBundle reads a bundle from rd and checks that it is well formed and
+// that the repository contains all its prerequisites, the same as `git bundle
+// verify`. If some prerequisite is missing a *MissingPrerequisitesError is
+// returned.
+func (r *Repository) VerifyBundle(rd io.Reader) error {
+	b := bundle.New()
+	if err := bundle.NewDecoder(rd).Decode(b); err != nil {
+		return err
+	}
+
+	var missing []bundle.Prerequisite
+	for _, p := range b.Prerequisites {
+		_, err := r.CommitObject(p.Hash)
+		if err == plumbing.ErrObjectNotFound {
+			missing = append(missing, p)
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(missing) != 0 {
+		return &MissingPrerequisitesError{Prerequisites: missing}
+	}
+
+	return nil
+}
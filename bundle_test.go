@@ -0,0 +1,220 @@
+package git
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/bundle"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git-fixtures.v3"
+)
+
+type BundleSuite struct {
+	BaseSuite
+}
+
+var _ = Suite(&BundleSuite{})
+
+func (s *BundleSuite) TestCreateBundle(c *C) {
+	r := s.NewRepository(fixtures.Basic().One())
+
+	buf := bytes.NewBuffer(nil)
+	err := r.CreateBundle(buf, []plumbing.ReferenceName{plumbing.Master}, nil)
+	c.Assert(err, IsNil)
+
+	b := bundle.New()
+	err = bundle.NewDecoder(buf).Decode(b)
+	c.Assert(err, IsNil)
+	c.Assert(b.Version, Equals, bundle.V2)
+	c.Assert(b.Prerequisites, HasLen, 0)
+	c.Assert(b.References, HasLen, 1)
+	c.Assert(b.References[0].Name(), Equals, plumbing.Master)
+	c.Assert(b.References[0].Hash().String(), Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+
+	pack, err := ioutil.ReadAll(b.Packfile)
+	c.Assert(err, IsNil)
+	c.Assert(string(pack[:4]), Equals, "PACK")
+}
+
+func (s *BundleSuite) TestCreateBundleAll(c *C) {
+	r := s.NewRepository(fixtures.Basic().One())
+
+	buf := bytes.NewBuffer(nil)
+	err := r.CreateBundle(buf, nil, nil)
+	c.Assert(err, IsNil)
+
+	b := bundle.New()
+	err = bundle.NewDecoder(buf).Decode(b)
+	c.Assert(err, IsNil)
+
+	head, err := b.Reference(plumbing.HEAD)
+	c.Assert(err, IsNil)
+	c.Assert(head.Hash().String(), Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+
+	_, err = b.Reference("refs/remotes/origin/branch")
+	c.Assert(err, IsNil)
+}
+
+func (s *BundleSuite) TestCreateBundleEmpty(c *C) {
+	r := s.NewRepository(fixtures.Basic().One())
+
+	master, err := r.Reference(plumbing.Master, true)
+	c.Assert(err, IsNil)
+
+	err = r.CreateBundle(ioutil.Discard,
+		[]plumbing.ReferenceName{plumbing.Master},
+		[]plumbing.Hash{master.Hash()},
+	)
+	c.Assert(err, Equals, ErrEmptyBundle)
+}
+
+func (s *BundleSuite) TestCreateBundleWithPrerequisites(c *C) {
+	r := s.NewRepository(fixtures.Basic().One())
+
+	base, err := r.ResolveRevision("master~2")
+	c.Assert(err, IsNil)
+
+	buf := bytes.NewBuffer(nil)
+	err = r.CreateBundle(buf, []plumbing.ReferenceName{plumbing.Master}, []plumbing.Hash{*base})
+	c.Assert(err, IsNil)
+
+	b := bundle.New()
+	err = bundle.NewDecoder(bytes.NewReader(buf.Bytes())).Decode(b)
+	c.Assert(err, IsNil)
+	c.Assert(b.Prerequisites, HasLen, 1)
+	c.Assert(b.Prerequisites[0].Hash, Equals, *base)
+	c.Assert(b.Prerequisites[0].Comment, Not(Equals), "")
+
+	err = r.VerifyBundle(bytes.NewReader(buf.Bytes()))
+	c.Assert(err, IsNil)
+
+	empty, err := Init(memory.NewStorage(), nil)
+	c.Assert(err, IsNil)
+
+	err = empty.VerifyBundle(bytes.NewReader(buf.Bytes()))
+	c.Assert(err, FitsTypeOf, &MissingPrerequisitesError{})
+	c.Assert(err.(*MissingPrerequisitesError).Prerequisites, DeepEquals, b.Prerequisites)
+}
+
+func (s *BundleSuite) TestCloneAndFetchFromBundle(c *C) {
+	r := s.NewRepository(fixtures.Basic().One())
+
+	dir, err := ioutil.TempDir("", "bundle")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	base, err := r.ResolveRevision("master~2")
+	c.Assert(err, IsNil)
+
+	branch := plumbing.ReferenceName("refs/heads/base")
+	err = r.Storer.SetReference(plumbing.NewHashReference(branch, *base))
+	c.Assert(err, IsNil)
+	err = r.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, branch))
+	c.Assert(err, IsNil)
+
+	path := filepath.Join(dir, "repo.bundle")
+	s.writeBundle(c, r, path, plumbing.HEAD, branch)
+
+	clone, err := Clone(memory.NewStorage(), nil, &CloneOptions{URL: path})
+	c.Assert(err, IsNil)
+
+	head, err := clone.Head()
+	c.Assert(err, IsNil)
+	c.Assert(head.Name(), Equals, branch)
+	c.Assert(head.Hash(), Equals, *base)
+
+	s.writeBundle(c, r, path, plumbing.Master)
+
+	err = clone.Fetch(&FetchOptions{
+		RefSpecs: []config.RefSpec{"refs/heads/master:refs/heads/master"},
+	})
+	c.Assert(err, IsNil)
+
+	ref, err := clone.Reference(plumbing.Master, true)
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash().String(), Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+
+	_, err = clone.CommitObject(ref.Hash())
+	c.Assert(err, IsNil)
+
+	err = clone.Push(&PushOptions{})
+	c.Assert(err, NotNil)
+}
+
+func (s *BundleSuite) TestFetchFromBundleMissingPrerequisites(c *C) {
+	r := s.NewRepository(fixtures.Basic().One())
+
+	dir, err := ioutil.TempDir("", "bundle")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	base, err := r.ResolveRevision("master~2")
+	c.Assert(err, IsNil)
+
+	path := filepath.Join(dir, "repo.bundle")
+	f, err := os.Create(path)
+	c.Assert(err, IsNil)
+	err = r.CreateBundle(f, []plumbing.ReferenceName{plumbing.Master}, []plumbing.Hash{*base})
+	c.Assert(f.Close(), IsNil)
+	c.Assert(err, IsNil)
+
+	empty, err := Init(memory.NewStorage(), nil)
+	c.Assert(err, IsNil)
+	_, err = empty.CreateRemote(&config.RemoteConfig{
+		Name: DefaultRemoteName,
+		URLs: []string{path},
+	})
+	c.Assert(err, IsNil)
+
+	err = empty.Fetch(&FetchOptions{})
+	c.Assert(err, FitsTypeOf, &MissingPrerequisitesError{})
+	c.Assert(err.(*MissingPrerequisitesError).Prerequisites, HasLen, 1)
+	c.Assert(err.(*MissingPrerequisitesError).Prerequisites[0].Hash, Equals, *base)
+
+	_, err = empty.Reference("refs/remotes/origin/master", false)
+	c.Assert(err, Equals, plumbing.ErrReferenceNotFound)
+
+	branch := plumbing.ReferenceName("refs/heads/base")
+	err = r.Storer.SetReference(plumbing.NewHashReference(branch, *base))
+	c.Assert(err, IsNil)
+
+	basePath := filepath.Join(dir, "base.bundle")
+	s.writeBundle(c, r, basePath, branch)
+
+	clone, err := Clone(memory.NewStorage(), nil, &CloneOptions{
+		URL:           basePath,
+		ReferenceName: branch,
+	})
+	c.Assert(err, IsNil)
+
+	_, err = clone.CreateRemote(&config.RemoteConfig{
+		Name: "incremental",
+		URLs: []string{path},
+	})
+	c.Assert(err, IsNil)
+
+	err = clone.Fetch(&FetchOptions{
+		RemoteName: "incremental",
+		RefSpecs:   []config.RefSpec{"refs/heads/master:refs/heads/master"},
+	})
+	c.Assert(err, IsNil)
+
+	ref, err := clone.Reference(plumbing.Master, false)
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash().String(), Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+}
+
+func (s *BundleSuite) writeBundle(c *C, r *Repository, path string, refs ...plumbing.ReferenceName) {
+	f, err := os.Create(path)
+	c.Assert(err, IsNil)
+	defer f.Close()
+
+	err = r.CreateBundle(f, refs, nil)
+	c.Assert(err, IsNil)
+}
@@ -0,0 +1,259 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	stdioutil "io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/src-d/go-billy.v4"
+	giturl "gopkg.in/src-d/go-git.v4/internal/url"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/revlist"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+	"gopkg.in/src-d/go-git.v4/utils/ioutil"
+)
+
+// ErrAlternatesNotSupported is returned when cloning with a reference
+// repository into a storage without support for alternates.
+var ErrAlternatesNotSupported = errors.New("storage does not support alternates")
+
+// addReferenceAlternate borrows the objects of the local repository at the
+// given path, adding its objects directory to the alternates of the storage.
+func (r *Repository) addReferenceAlternate(path string) error {
+	sto, ok := r.Storer.(*filesystem.Storage)
+	if !ok {
+		return ErrAlternatesNotSupported
+	}
+
+	dot, _, err := dotGitToOSFilesystems(path, false)
+	if err != nil {
+		return err
+	}
+
+	objects := filepath.Join(dot.Root(), "objects")
+	if _, err := os.Stat(objects); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("reference repository %q does not exist", path)
+		}
+
+		return err
+	}
+
+	return sto.AddAlternate(objects)
+}
+
+// dissociate copies into a new packfile the objects reachable from the
+// references borrowed from the alternates, and removes the alternates.
+func (r *Repository) dissociate() error {
+	sto, ok := r.Storer.(*filesystem.Storage)
+	if !ok {
+		return ErrAlternatesNotSupported
+	}
+
+	iter, err := r.Storer.IterReferences()
+	if err != nil {
+		return err
+	}
+
+	var tips []plumbing.Hash
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference {
+			tips = append(tips, ref.Hash())
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	objects, err := revlist.Objects(r.Storer, tips, nil)
+	if err != nil {
+		return err
+	}
+
+	var borrowed []plumbing.Hash
+	for _, h := range objects {
+		err := sto.HasEncodedObject(h)
+		if err == plumbing.ErrObjectNotFound {
+			borrowed = append(borrowed, h)
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(borrowed) != 0 {
+		if err := r.writePackfile(borrowed); err != nil {
+			return err
+		}
+	}
+
+	return sto.RemoveAlternates()
+}
+
+func (r *Repository) writePackfile(objects []plumbing.Hash) (err error) {
+	pw, ok := r.Storer.(storer.PackfileWriter)
+	if !ok {
+		return ErrPackedObjectsNotSupported
+	}
+
+	cfg, err := r.Storer.Config()
+	if err != nil {
+		return err
+	}
+
+	w, err := pw.PackfileWriter()
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(w, &err)
+	_, err = packfile.NewEncoder(w, r.Storer, false).Encode(objects, cfg.Pack.Window)
+	return err
+}
+
+// copyLocalObjects hardlinks, or copies if it's not possible or hardlinks
+// are disabled, the objects of the local repository being cloned into the
+// storage, so the fetch of the clone doesn't need to transfer them. It does
+// nothing if the URL isn't a local path or the options require the pack
+// protocol. It's only used by PlainClone, where the storage is in the OS
+// filesystem.
+func (r *Repository) copyLocalObjects(ctx context.Context, o *CloneOptions) error {
+	if o.NoLocal || o.Depth != 0 || o.Reference != "" || !giturl.IsLocalEndpoint(o.URL) {
+		return nil
+	}
+
+	sto, ok := r.Storer.(*filesystem.Storage)
+	if !ok {
+		return nil
+	}
+
+	src, _, err := dotGitToOSFilesystems(o.URL, false)
+	if err != nil {
+		return err
+	}
+
+	if _, err := src.Stat("objects"); err != nil {
+		// let the fetch report the missing repository
+		return nil
+	}
+
+	err = copyObjectsDir(ctx, src, sto, src.Join("objects"), !o.NoHardlinks)
+	if err != nil {
+		return fmt.Errorf("copying local objects: %s", err)
+	}
+
+	return nil
+}
+
+// copyObjectsDir copies recursively the files of the objects directory. From
+// objects/info only the alternates are copied, with their relative paths
+// made absolute.
+func copyObjectsDir(ctx context.Context, src billy.Filesystem, dst *filesystem.Storage, dir string, hardlink bool) error {
+	files, err := src.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, fi := range files {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		path := src.Join(dir, fi.Name())
+		switch {
+		case path == src.Join("objects", "info"):
+			if err := copyAlternates(src, dst); err != nil {
+				return err
+			}
+		case fi.IsDir():
+			if err := copyObjectsDir(ctx, src, dst, path, hardlink); err != nil {
+				return err
+			}
+		default:
+			if err := copyObjectFile(src, dst.Filesystem(), path, hardlink); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func copyObjectFile(src, dst billy.Filesystem, path string, hardlink bool) (err error) {
+	if hardlink {
+		target := filepath.Join(dst.Root(), path)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+
+		if err := os.Link(filepath.Join(src.Root(), path), target); err == nil {
+			return nil
+		}
+	}
+
+	from, err := src.Open(path)
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(from, &err)
+
+	to, err := dst.Create(path)
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(to, &err)
+
+	_, err = io.Copy(to, from)
+	return err
+}
+
+func copyAlternates(src billy.Filesystem, dst *filesystem.Storage) (err error) {
+	path := src.Join("objects", "info", "alternates")
+	f, err := src.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(f, &err)
+
+	content, err := stdioutil.ReadAll(f)
+	if err != nil {
+		return err
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		if line == "" {
+			continue
+		}
+
+		if !filepath.IsAbs(line) {
+			line = filepath.Join(src.Root(), "objects", line)
+		}
+
+		if err := dst.AddAlternate(line); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,432 @@
+package git
+
+import (
+	"errors"
+	"io"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/commitgraph"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	graph "gopkg.in/src-d/go-git.v4/plumbing/object/commitgraph"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+// maxGeneration is the biggest generation number that can be stored in a
+// commit-graph, the commits with a bigger one are stored with it.
+const maxGeneration = 0x3FFFFFFF
+
+var (
+	ErrCommitGraphNotSupported = errors.New("commit-graph not supported by the storage")
+	ErrCommitGraphShallow      = errors.New("commit-graph not supported in shallow repositories")
+)
+
+// CommitGraphOptions describes how the commit-graph is written.
+type CommitGraphOptions struct {
+	// Append keeps the commits of the existing commit-graph, even if they
+	// aren't reachable from the references anymore.
+	Append bool
+	// Split writes the commits missing in the commit-graph as a new layer of
+	// a split commit-graph chain, instead of rewriting the whole commit-graph.
+	// The commits of the existing chain are kept.
+	Split bool
+	// ChangedPaths computes the changed-path Bloom filters of the commits,
+	// used by Log to skip the commits that didn't change the FileName. The
+	// filters of the existing commit-graph are reused.
+	ChangedPaths bool
+}
+
+// Validate validates the fields and sets the default values.
+func (o *CommitGraphOptions) Validate() error { return nil }
+
+// WriteCommitGraph writes the commit-graph of the repository, with the commits
+// reachable from its references, used to speed up the walks of the history
+// such as Log, Commit.MergeBase or Commit.IsAncestor. The storage must
+// implement storer.CommitGraphStorer.
+func (r *Repository) WriteCommitGraph(o *CommitGraphOptions) error {
+	if err := o.Validate(); err != nil {
+		return err
+	}
+
+	s, ok := r.Storer.(storer.CommitGraphStorer)
+	if !ok {
+		return ErrCommitGraphNotSupported
+	}
+
+	shallows, err := r.Storer.Shallow()
+	if err != nil {
+		return err
+	}
+
+	if len(shallows) != 0 {
+		return ErrCommitGraphShallow
+	}
+
+	commits := make(map[plumbing.Hash]*commitgraph.CommitData)
+	if o.Append || o.Split {
+		if err := addCommitGraphCommits(s, commits); err != nil {
+			return err
+		}
+	}
+
+	if err := r.addReachableCommits(commits); err != nil {
+		return err
+	}
+
+	if o.ChangedPaths {
+		if err := r.addBloomFilters(s, commits); err != nil {
+			return err
+		}
+	}
+
+	idx := commitgraph.NewMemoryIndex()
+	generations, corrected := commitGenerations(commits)
+	for h, data := range commits {
+		data.Generation = generations[h]
+		data.GenerationV2 = corrected[h]
+		idx.Add(h, data)
+	}
+
+	if o.Split {
+		return s.AddCommitGraphLayer(idx)
+	}
+
+	return s.SetCommitGraph(idx)
+}
+
+// addCommitGraphCommits adds the commits of the existing commit-graph, if any.
+func addCommitGraphCommits(s storer.CommitGraphStorer, commits map[plumbing.Hash]*commitgraph.CommitData) error {
+	graph, err := s.CommitGraph()
+	if graph == nil || err != nil {
+		return err
+	}
+
+	for i, h := range graph.Hashes() {
+		data, err := graph.GetCommitDataByIndex(i)
+		if err != nil {
+			return err
+		}
+
+		commits[h] = &commitgraph.CommitData{
+			TreeHash:     data.TreeHash,
+			ParentHashes: data.ParentHashes,
+			When:         data.When,
+			BloomFilter:  data.BloomFilter,
+		}
+	}
+
+	return nil
+}
+
+// addReachableCommits adds the commits reachable from the references, the
+// commits already added are considered along with their history.
+func (r *Repository) addReachableCommits(commits map[plumbing.Hash]*commitgraph.CommitData) error {
+	refs, err := r.Storer.IterReferences()
+	if err != nil {
+		return err
+	}
+
+	var pending []plumbing.Hash
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference {
+			return nil
+		}
+
+		obj, err := object.GetObject(r.Storer, ref.Hash())
+		for err == nil {
+			tag, ok := obj.(*object.Tag)
+			if !ok {
+				break
+			}
+
+			obj, err = tag.Object()
+		}
+
+		if err == plumbing.ErrObjectNotFound {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if c, ok := obj.(*object.Commit); ok {
+			pending = append(pending, c.Hash)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for len(pending) > 0 {
+		h := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if _, ok := commits[h]; ok {
+			continue
+		}
+
+		c, err := object.GetCommit(r.Storer, h)
+		if err != nil {
+			return err
+		}
+
+		commits[h] = &commitgraph.CommitData{
+			TreeHash:     c.TreeHash,
+			ParentHashes: c.ParentHashes,
+			When:         c.Committer.When,
+		}
+
+		pending = append(pending, c.ParentHashes...)
+	}
+
+	return nil
+}
+
+// addBloomFilters sets the changed-path Bloom filters of the commits without
+// one, taken from the existing commit-graph or computed diffing their trees.
+func (r *Repository) addBloomFilters(s storer.CommitGraphStorer, commits map[plumbing.Hash]*commitgraph.CommitData) error {
+	graph, err := s.CommitGraph()
+	if err != nil {
+		return err
+	}
+
+	for h, data := range commits {
+		if data.BloomFilter != nil {
+			continue
+		}
+
+		if graph != nil {
+			if i, err := graph.GetIndexByHash(h); err == nil {
+				existing, err := graph.GetCommitDataByIndex(i)
+				if err != nil {
+					return err
+				}
+
+				if existing.BloomFilter != nil {
+					data.BloomFilter = existing.BloomFilter
+					continue
+				}
+			}
+		}
+
+		paths, err := r.changedPaths(h)
+		if err != nil {
+			return err
+		}
+
+		data.BloomFilter = commitgraph.NewBloomFilter(paths)
+	}
+
+	return nil
+}
+
+// changedPaths returns the paths changed by a commit from its first parent,
+// or all its paths if it's a root commit.
+func (r *Repository) changedPaths(h plumbing.Hash) ([]string, error) {
+	c, err := r.CommitObject(h)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	var parentTree *object.Tree
+	if len(c.ParentHashes) != 0 {
+		parent, err := r.CommitObject(c.ParentHashes[0])
+		if err != nil {
+			return nil, err
+		}
+
+		if parentTree, err = parent.Tree(); err != nil {
+			return nil, err
+		}
+	}
+
+	changes, err := object.DiffTree(parentTree, tree)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, change := range changes {
+		if change.From.Name != "" {
+			paths = append(paths, change.From.Name)
+		}
+
+		if change.To.Name != "" && change.To.Name != change.From.Name {
+			paths = append(paths, change.To.Name)
+		}
+	}
+
+	return paths, nil
+}
+
+// commitGenerations returns the generation numbers of the commits, one for
+// the root commits and one more than the biggest of the parents for the
+// others, along with their corrected commit dates, the biggest of their
+// commit date and one more than the corrected commit dates of the parents.
+func commitGenerations(commits map[plumbing.Hash]*commitgraph.CommitData) (
+	map[plumbing.Hash]int, map[plumbing.Hash]uint64) {
+
+	generations := make(map[plumbing.Hash]int, len(commits))
+	corrected := make(map[plumbing.Hash]uint64, len(commits))
+	for h := range commits {
+		stack := []plumbing.Hash{h}
+		for len(stack) > 0 {
+			top := stack[len(stack)-1]
+			if _, ok := generations[top]; ok {
+				stack = stack[:len(stack)-1]
+				continue
+			}
+
+			generation := 1
+			var date uint64 = 1
+			if when := commits[top].When.Unix(); when > 0 {
+				date = uint64(when)
+			}
+
+			complete := true
+			for _, p := range commits[top].ParentHashes {
+				if _, ok := commits[p]; !ok {
+					continue
+				}
+
+				g, ok := generations[p]
+				if !ok {
+					complete = false
+					stack = append(stack, p)
+					continue
+				}
+
+				if g+1 > generation {
+					generation = g + 1
+				}
+
+				if corrected[p]+1 > date {
+					date = corrected[p] + 1
+				}
+			}
+
+			if !complete {
+				continue
+			}
+
+			if generation > maxGeneration {
+				generation = maxGeneration
+			}
+
+			generations[top] = generation
+			corrected[top] = date
+			stack = stack[:len(stack)-1]
+		}
+	}
+
+	return generations, corrected
+}
+
+// commitNodeIterFunc returns a function walking the history in the given
+// order over commit nodes, using the commit-graph if the repository has one.
+// It returns nil if the order has no such walk, or if it's
+// LogOrderCommitterTime and the repository has no commit-graph.
+func (r *Repository) commitNodeIterFunc(order LogOrder) (func(*object.Commit) object.CommitIter, error) {
+	var newIter func(graph.CommitNode) graph.CommitNodeIter
+	switch order {
+	case LogOrderCommitterTime:
+		newIter = func(node graph.CommitNode) graph.CommitNodeIter {
+			return graph.NewCommitNodeIterCTime(node, nil, nil)
+		}
+	case LogOrderTopo:
+		newIter = func(node graph.CommitNode) graph.CommitNodeIter {
+			return graph.NewCommitNodeIterTopoOrder(node, nil, nil)
+		}
+	default:
+		return nil, nil
+	}
+
+	nodes, err := r.commitGraphNodeIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	if nodes == nil {
+		if order == LogOrderCommitterTime {
+			return nil, nil
+		}
+
+		nodes = graph.NewObjectCommitNodeIndex(r.Storer)
+	}
+
+	return func(c *object.Commit) object.CommitIter {
+		node, err := nodes.Get(c.Hash)
+		if err != nil {
+			return &commitNodeIter{err: err}
+		}
+
+		return &commitNodeIter{iter: newIter(node)}
+	}, nil
+}
+
+// commitGraphNodeIndex returns the commit nodes of the commit-graph of the
+// repository, nil if it has no commit-graph.
+func (r *Repository) commitGraphNodeIndex() (graph.CommitNodeIndex, error) {
+	s, ok := r.Storer.(storer.CommitGraphStorer)
+	if !ok {
+		return nil, nil
+	}
+
+	idx, err := s.CommitGraph()
+	if idx == nil || err != nil {
+		return nil, err
+	}
+
+	return graph.NewGraphCommitNodeIndex(idx, r.Storer), nil
+}
+
+// commitNodeIter is an object.CommitIter over the commits of a
+// graph.CommitNodeIter.
+type commitNodeIter struct {
+	iter graph.CommitNodeIter
+	err  error
+}
+
+func (i *commitNodeIter) Next() (*object.Commit, error) {
+	if i.err != nil {
+		return nil, i.err
+	}
+
+	node, err := i.iter.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	return node.Commit()
+}
+
+func (i *commitNodeIter) ForEach(cb func(*object.Commit) error) error {
+	for {
+		c, err := i.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err := cb(c); err == storer.ErrStop {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+func (i *commitNodeIter) Close() {
+	if i.iter != nil {
+		i.iter.Close()
+	}
+}
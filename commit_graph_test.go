@@ -0,0 +1,308 @@
+package git
+
+import (
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/commitgraph"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-git-fixtures.v3"
+)
+
+type CommitGraphSuite struct {
+	BaseSuite
+}
+
+var _ = Suite(&CommitGraphSuite{})
+
+func (s *CommitGraphSuite) commitGraph(c *C, r *Repository) commitgraph.Index {
+	graph, err := r.Storer.(storer.CommitGraphStorer).CommitGraph()
+	c.Assert(err, IsNil)
+	return graph
+}
+
+func (s *CommitGraphSuite) generation(c *C, graph commitgraph.Index, h string) int {
+	i, err := graph.GetIndexByHash(plumbing.NewHash(h))
+	c.Assert(err, IsNil)
+
+	data, err := graph.GetCommitDataByIndex(i)
+	c.Assert(err, IsNil)
+	return data.Generation
+}
+
+func (s *CommitGraphSuite) log(c *C, r *Repository) []plumbing.Hash {
+	iter, err := r.Log(&LogOptions{All: true, Order: LogOrderCommitterTime})
+	c.Assert(err, IsNil)
+
+	var hashes []plumbing.Hash
+	c.Assert(iter.ForEach(func(commit *object.Commit) error {
+		hashes = append(hashes, commit.Hash)
+		return nil
+	}), IsNil)
+
+	return hashes
+}
+
+// commit stores a new commit with the given parent and returns its hash.
+func (s *CommitGraphSuite) commit(c *C, r *Repository, parent plumbing.Hash) plumbing.Hash {
+	p, err := r.CommitObject(parent)
+	c.Assert(err, IsNil)
+
+	sig := object.Signature{Name: "foo", Email: "foo@foo.foo", When: time.Now()}
+	commit := &object.Commit{
+		Author:       sig,
+		Committer:    sig,
+		Message:      "foo\n",
+		TreeHash:     p.TreeHash,
+		ParentHashes: []plumbing.Hash{parent},
+	}
+
+	obj := r.Storer.NewEncodedObject()
+	c.Assert(commit.Encode(obj), IsNil)
+	h, err := r.Storer.SetEncodedObject(obj)
+	c.Assert(err, IsNil)
+	return h
+}
+
+func (s *CommitGraphSuite) TestWriteCommitGraph(c *C) {
+	r := s.NewRepository(fixtures.Basic().One())
+	c.Assert(s.commitGraph(c, r), IsNil)
+	expected := s.log(c, r)
+
+	c.Assert(r.WriteCommitGraph(&CommitGraphOptions{}), IsNil)
+
+	graph := s.commitGraph(c, r)
+	c.Assert(graph, NotNil)
+	c.Assert(graph.Hashes(), HasLen, 9)
+	c.Assert(s.generation(c, graph, "b029517f6300c2da0f4b651b8642506cd6aaf45d"), Equals, 1)
+	c.Assert(s.generation(c, graph, "1669dce138d9b841a518c64b10914d88f5e488ea"), Equals, 4)
+	c.Assert(s.generation(c, graph, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5"), Equals, 7)
+
+	c.Assert(s.log(c, r), DeepEquals, expected)
+}
+
+func (s *CommitGraphSuite) TestWriteCommitGraphAppend(c *C) {
+	r := s.NewRepository(fixtures.Basic().One())
+	c.Assert(r.WriteCommitGraph(&CommitGraphOptions{}), IsNil)
+
+	c.Assert(r.Storer.RemoveReference("refs/heads/branch"), IsNil)
+	c.Assert(r.Storer.RemoveReference("refs/remotes/origin/branch"), IsNil)
+
+	c.Assert(r.WriteCommitGraph(&CommitGraphOptions{Append: true}), IsNil)
+	c.Assert(s.commitGraph(c, r).Hashes(), HasLen, 9)
+
+	c.Assert(r.WriteCommitGraph(&CommitGraphOptions{}), IsNil)
+	c.Assert(s.commitGraph(c, r).Hashes(), HasLen, 8)
+}
+
+func (s *CommitGraphSuite) TestWriteCommitGraphSplit(c *C) {
+	r := s.NewRepository(fixtures.Basic().One())
+	c.Assert(r.WriteCommitGraph(&CommitGraphOptions{Split: true}), IsNil)
+
+	master := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	h := s.commit(c, r, master)
+	c.Assert(r.Storer.SetReference(plumbing.NewHashReference("refs/heads/foo", h)), IsNil)
+
+	c.Assert(r.WriteCommitGraph(&CommitGraphOptions{Split: true}), IsNil)
+
+	fs := r.Storer.(interface{ Filesystem() billy.Filesystem }).Filesystem()
+	files, err := fs.ReadDir("objects/info/commit-graphs")
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 3)
+
+	graph := s.commitGraph(c, r)
+	c.Assert(graph.Hashes(), HasLen, 10)
+	c.Assert(s.generation(c, graph, h.String()), Equals, 8)
+
+	commit, err := r.CommitObject(h)
+	c.Assert(err, IsNil)
+	c.Assert(s.log(c, r)[0], Equals, h)
+
+	base, err := r.CommitObject(plumbing.NewHash("b8e471f58bcbca63b07bda20e428190409c2db47"))
+	c.Assert(err, IsNil)
+	ok, err := base.IsAncestor(commit)
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, true)
+}
+
+func (s *CommitGraphSuite) TestMergeBaseWithCommitGraph(c *C) {
+	r := s.NewRepository(fixtures.Basic().One())
+	c.Assert(r.WriteCommitGraph(&CommitGraphOptions{}), IsNil)
+
+	master, err := r.CommitObject(plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	c.Assert(err, IsNil)
+	branch, err := r.CommitObject(plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881"))
+	c.Assert(err, IsNil)
+	root, err := r.CommitObject(plumbing.NewHash("b029517f6300c2da0f4b651b8642506cd6aaf45d"))
+	c.Assert(err, IsNil)
+
+	ok, err := master.IsAncestor(branch)
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, false)
+
+	ok, err = root.IsAncestor(branch)
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, true)
+
+	ok, err = master.IsAncestor(master)
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, true)
+
+	bases, err := master.MergeBase(branch)
+	c.Assert(err, IsNil)
+	c.Assert(bases, HasLen, 1)
+	c.Assert(bases[0].Hash.String(), Equals, "918c48b83bd081e863dbe1b80f8998f058cd8294")
+
+	bases, err = root.MergeBase(master)
+	c.Assert(err, IsNil)
+	c.Assert(bases, HasLen, 1)
+	c.Assert(bases[0].Hash, Equals, root.Hash)
+
+	independents, err := object.Independents([]*object.Commit{root, master, branch})
+	c.Assert(err, IsNil)
+	c.Assert(independents, HasLen, 2)
+}
+
+func (s *CommitGraphSuite) logFile(c *C, r *Repository, order LogOrder, fileName string) []plumbing.Hash {
+	iter, err := r.Log(&LogOptions{Order: order, FileName: &fileName})
+	c.Assert(err, IsNil)
+
+	var hashes []plumbing.Hash
+	c.Assert(iter.ForEach(func(commit *object.Commit) error {
+		hashes = append(hashes, commit.Hash)
+		return nil
+	}), IsNil)
+
+	return hashes
+}
+
+func (s *CommitGraphSuite) TestWriteCommitGraphChangedPaths(c *C) {
+	r := s.NewRepository(fixtures.Basic().One())
+
+	files := []string{"go/example.go", "CHANGELOG", "vendor/foo.go", "LICENSE"}
+	orders := []LogOrder{LogOrderDefault, LogOrderCommitterTime}
+	expected := make(map[LogOrder]map[string][]plumbing.Hash)
+	for _, order := range orders {
+		expected[order] = make(map[string][]plumbing.Hash)
+		for _, file := range files {
+			expected[order][file] = s.logFile(c, r, order, file)
+		}
+	}
+
+	c.Assert(r.WriteCommitGraph(&CommitGraphOptions{ChangedPaths: true}), IsNil)
+
+	graph := s.commitGraph(c, r)
+	i, err := graph.GetIndexByHash(plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294"))
+	c.Assert(err, IsNil)
+	data, err := graph.GetCommitDataByIndex(i)
+	c.Assert(err, IsNil)
+	c.Assert(data.BloomFilter, NotNil)
+	c.Assert(data.BloomFilter.Contains("go/example.go"), Equals, true)
+	c.Assert(data.BloomFilter.Contains("LICENSE"), Equals, false)
+
+	for _, order := range orders {
+		for _, file := range files {
+			c.Assert(s.logFile(c, r, order, file), DeepEquals, expected[order][file], Commentf("file: %s", file))
+		}
+	}
+
+	// the filters are kept when the commit-graph is rewritten
+	c.Assert(r.WriteCommitGraph(&CommitGraphOptions{Split: true}), IsNil)
+	data, err = s.commitGraph(c, r).GetCommitDataByIndex(i)
+	c.Assert(err, IsNil)
+	c.Assert(data.BloomFilter, NotNil)
+}
+
+func (s *CommitGraphSuite) TestWriteCommitGraphGenerationV2(c *C) {
+	r := s.NewRepository(fixtures.Basic().One())
+	c.Assert(r.WriteCommitGraph(&CommitGraphOptions{}), IsNil)
+
+	graph := s.commitGraph(c, r)
+	for i, h := range graph.Hashes() {
+		data, err := graph.GetCommitDataByIndex(i)
+		c.Assert(err, IsNil)
+		c.Assert(data.GenerationV2 >= uint64(data.When.Unix()), Equals, true, Commentf("commit: %s", h))
+
+		for _, p := range data.ParentIndexes {
+			parent, err := graph.GetCommitDataByIndex(p)
+			c.Assert(err, IsNil)
+			c.Assert(data.GenerationV2 > parent.GenerationV2, Equals, true, Commentf("commit: %s", h))
+		}
+	}
+}
+
+func (s *CommitGraphSuite) topoLog(c *C, r *Repository) []plumbing.Hash {
+	iter, err := r.Log(&LogOptions{Order: LogOrderTopo})
+	c.Assert(err, IsNil)
+
+	var hashes []plumbing.Hash
+	c.Assert(iter.ForEach(func(commit *object.Commit) error {
+		hashes = append(hashes, commit.Hash)
+		return nil
+	}), IsNil)
+
+	return hashes
+}
+
+func (s *CommitGraphSuite) TestLogTopoOrder(c *C) {
+	r := s.NewRepository(fixtures.Basic().One())
+	expected := s.topoLog(c, r)
+	c.Assert(expected, HasLen, 8)
+
+	// no parent is shown before its children
+	shown := make(map[plumbing.Hash]bool)
+	for _, h := range expected {
+		commit, err := r.CommitObject(h)
+		c.Assert(err, IsNil)
+		for _, p := range commit.ParentHashes {
+			c.Assert(shown[p], Equals, false, Commentf("commit: %s", h))
+		}
+
+		shown[h] = true
+	}
+
+	c.Assert(r.WriteCommitGraph(&CommitGraphOptions{}), IsNil)
+	c.Assert(s.topoLog(c, r), DeepEquals, expected)
+}
+
+func (s *CommitGraphSuite) TestBranchTrackingStatusWithCommitGraph(c *C) {
+	r := s.NewRepository(fixtures.Basic().One())
+	c.Assert(r.WriteCommitGraph(&CommitGraphOptions{}), IsNil)
+
+	cfg, err := r.Config()
+	c.Assert(err, IsNil)
+	cfg.Branches["branch"] = &config.Branch{
+		Name:   "branch",
+		Remote: ".",
+		Merge:  plumbing.Master,
+	}
+	c.Assert(r.Storer.SetConfig(cfg), IsNil)
+
+	status, err := r.BranchTrackingStatus("branch")
+	c.Assert(err, IsNil)
+	c.Assert(status.Ahead, Equals, 1)
+	c.Assert(status.Behind, Equals, 1)
+
+	// the commits missing in the commit-graph are walked too
+	h := s.commit(c, r, plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881"))
+	c.Assert(r.Storer.SetReference(plumbing.NewHashReference("refs/heads/branch", h)), IsNil)
+
+	status, err = r.BranchTrackingStatus("branch")
+	c.Assert(err, IsNil)
+	c.Assert(status.Ahead, Equals, 2)
+	c.Assert(status.Behind, Equals, 1)
+}
+
+func (s *CommitGraphSuite) TestWriteCommitGraphNotSupported(c *C) {
+	r, err := Init(memory.NewStorage(), nil)
+	c.Assert(err, IsNil)
+
+	err = r.WriteCommitGraph(&CommitGraphOptions{})
+	c.Assert(err, Equals, ErrCommitGraphNotSupported)
+}
@@ -1,6 +1,7 @@
 package git
 
 import (
+	"os"
 	"testing"
 
 	"gopkg.in/src-d/go-git.v4/plumbing"
@@ -24,20 +25,60 @@ type BaseSuite struct {
 	Repository *Repository
 
 	backupProtocol transport.Transport
+	backupEnv      map[string]*string
 	cache          map[string]*Repository
 }
 
+// isolatedEnv are the environment variables cleared while the suites run, so
+// the tests don't depend on the system and global config, neither on the
+// identity of the user.
+var isolatedEnv = []string{
+	"HOME", "XDG_CONFIG_HOME", "GIT_CONFIG_GLOBAL", "GIT_CONFIG_SYSTEM",
+	"GIT_CONFIG_NOSYSTEM", "GIT_AUTHOR_NAME", "GIT_AUTHOR_EMAIL",
+	"GIT_AUTHOR_DATE", "GIT_COMMITTER_NAME", "GIT_COMMITTER_EMAIL",
+	"GIT_COMMITTER_DATE", "EMAIL",
+}
+
 func (s *BaseSuite) SetUpSuite(c *C) {
 	s.Suite.SetUpSuite(c)
+	s.isolateEnv(c)
 	s.buildBasicRepository(c)
 
 	s.cache = make(map[string]*Repository)
 }
 
 func (s *BaseSuite) TearDownSuite(c *C) {
+	s.restoreEnv()
 	s.Suite.TearDownSuite(c)
 }
 
+func (s *BaseSuite) isolateEnv(c *C) {
+	s.backupEnv = make(map[string]*string)
+	for _, key := range isolatedEnv {
+		if v, ok := os.LookupEnv(key); ok {
+			s.backupEnv[key] = &v
+		} else {
+			s.backupEnv[key] = nil
+		}
+
+		os.Unsetenv(key)
+	}
+
+	os.Setenv("HOME", c.MkDir())
+	os.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+}
+
+func (s *BaseSuite) restoreEnv() {
+	for key, v := range s.backupEnv {
+		if v == nil {
+			os.Unsetenv(key)
+			continue
+		}
+
+		os.Setenv(key, *v)
+	}
+}
+
 func (s *BaseSuite) buildBasicRepository(c *C) {
 	f := fixtures.Basic().One()
 	s.Repository = s.NewRepository(f)
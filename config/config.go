@@ -19,6 +19,26 @@ const (
 	DefaultPushRefSpec = "refs/heads/*:refs/heads/*"
 )
 
+// PushDefault is the push.default mode, deciding the refspecs pushed when
+// none is given.
+type PushDefault string
+
+const (
+	// PushDefaultNothing refuses to push without refspecs.
+	PushDefaultNothing PushDefault = "nothing"
+	// PushDefaultCurrent pushes the current branch to a branch with the same
+	// name.
+	PushDefaultCurrent PushDefault = "current"
+	// PushDefaultUpstream pushes the current branch to its upstream branch.
+	PushDefaultUpstream PushDefault = "upstream"
+	// PushDefaultSimple pushes the current branch to its upstream branch,
+	// refusing if the upstream has a different name. When pushing to a
+	// remote that isn't the upstream remote it works like PushDefaultCurrent.
+	PushDefaultSimple PushDefault = "simple"
+	// PushDefaultMatching pushes all the branches.
+	PushDefaultMatching PushDefault = "matching"
+)
+
 // ConfigStorer generic storage of Config object
 type ConfigStorer interface {
 	Config() (*Config, error)
@@ -51,6 +71,98 @@ type Config struct {
 		// compression.  The default is 10.  A value of 0 turns off
 		// delta compression entirely.
 		Window uint
+		// Depth is the maximum length of the delta chains, including the
+		// ones reused from the existing packfiles. The default is 50.
+		Depth uint
+	}
+
+	GC struct {
+		// Auto is the number of loose objects above which the repository
+		// needs a garbage collection, as reported by Repository.NeedsGC.
+		// The default is 6700. A value of 0 or less turns off the automatic
+		// garbage collection.
+		Auto int
+		// AutoPackLimit is the number of packfiles, not counting the kept
+		// ones, above which the repository needs a garbage collection. The
+		// default is 50. A value of 0 or less turns off this check.
+		AutoPackLimit int
+		// PruneExpire is how old the unreachable objects must be to be
+		// pruned, as an approxidate such as "2.weeks.ago", the default.
+		// The value "now" prunes all of them, and "never" none.
+		PruneExpire string
+		// ReflogExpire is how old the reflog entries must be to be removed.
+		// The default is "90.days.ago".
+		ReflogExpire string
+		// ReflogExpireUnreachable is how old the reflog entries not
+		// reachable from the current value of the reference must be to be
+		// removed. The default is "30.days.ago".
+		ReflogExpireUnreachable string
+		// CruftPacks if true, the unreachable objects not old enough to be
+		// pruned are kept in a cruft packfile, recording the modification
+		// time of each object, instead of as loose objects. The default is
+		// true.
+		CruftPacks bool
+	}
+
+	User struct {
+		// Name is the default name of the author, committer and tagger.
+		Name string
+		// Email is the default email of the author, committer and tagger.
+		Email string
+		// SigningKey is the key used to sign commits and tags.
+		SigningKey string
+	}
+
+	Author struct {
+		// Name overrides User.Name for the author.
+		Name string
+		// Email overrides User.Email for the author.
+		Email string
+	}
+
+	Committer struct {
+		// Name overrides User.Name for the committer and tagger.
+		Name string
+		// Email overrides User.Email for the committer and tagger.
+		Email string
+	}
+
+	Commit struct {
+		// GPGSign if true the commits should be signed.
+		GPGSign bool
+	}
+
+	Tag struct {
+		// GPGSign if true the annotated tags should be signed.
+		GPGSign bool
+	}
+
+	Push struct {
+		// Default is the push.default mode, deciding what is pushed when no
+		// refspec is given. An empty value keeps the go-git default of
+		// pushing all the branches.
+		Default PushDefault
+		// FollowTags if true, the annotated tags reachable from the pushed
+		// commits are pushed too.
+		FollowTags bool
+	}
+
+	Fetch struct {
+		// Prune if true, the fetches remove the remote-tracking references
+		// that no longer exist on the remote.
+		Prune bool
+		// PruneTags if true, the pruning fetches also remove the local tags
+		// that no longer exist on the remote.
+		PruneTags bool
+		// BundleURI is the URI of a bundle downloaded before fetching, to
+		// get most of the objects from it instead of from the remote.
+		BundleURI string
+	}
+
+	I18n struct {
+		// CommitEncoding is the encoding of the commit messages, an empty
+		// value means UTF-8.
+		CommitEncoding string
 	}
 
 	// Remotes list of repository remotes, the key of the map is the name
@@ -62,6 +174,9 @@ type Config struct {
 	// Branches list of branches, the key is the branch name and should
 	// equal Branch.Name
 	Branches map[string]*Branch
+	// URLs list of url rewriting rules, the key is the new beginning of the
+	// URLs and should equal URL.Name
+	URLs map[string]*URL
 	// Raw contains the raw information of a config file. The main goal is
 	// preserve the parsed information from the original format, to avoid
 	// dropping unsupported fields.
@@ -74,10 +189,13 @@ func NewConfig() *Config {
 		Remotes:    make(map[string]*RemoteConfig),
 		Submodules: make(map[string]*Submodule),
 		Branches:   make(map[string]*Branch),
+		URLs:       make(map[string]*URL),
 		Raw:        format.New(),
 	}
 
 	config.Pack.Window = DefaultPackWindow
+	config.Pack.Depth = DefaultPackDepth
+	config.setGCDefaults()
 
 	return config
 }
@@ -104,27 +222,85 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	for name, u := range c.URLs {
+		if u.Name != name {
+			return ErrInvalid
+		}
+
+		if err := u.Validate(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
 const (
-	remoteSection    = "remote"
-	submoduleSection = "submodule"
-	branchSection    = "branch"
-	coreSection      = "core"
-	packSection      = "pack"
-	fetchKey         = "fetch"
-	urlKey           = "url"
-	bareKey          = "bare"
-	worktreeKey      = "worktree"
-	commentCharKey   = "commentChar"
-	windowKey        = "window"
-	mergeKey         = "merge"
-	rebaseKey        = "rebase"
+	remoteSection     = "remote"
+	submoduleSection  = "submodule"
+	branchSection     = "branch"
+	urlSection        = "url"
+	coreSection       = "core"
+	packSection       = "pack"
+	gcSection         = "gc"
+	userSection       = "user"
+	authorSection     = "author"
+	committerSection  = "committer"
+	commitSection     = "commit"
+	tagSection        = "tag"
+	i18nSection       = "i18n"
+	pushSection       = "push"
+	fetchSection      = "fetch"
+	fetchKey          = "fetch"
+	urlKey            = "url"
+	bareKey           = "bare"
+	worktreeKey       = "worktree"
+	commentCharKey    = "commentChar"
+	windowKey         = "window"
+	depthKey          = "depth"
+	autoKey           = "auto"
+	autoPackLimitKey  = "autoPackLimit"
+	pruneExpireKey    = "pruneExpire"
+	reflogExpireKey   = "reflogExpire"
+	reflogUnreachKey  = "reflogExpireUnreachable"
+	cruftPacksKey     = "cruftPacks"
+	mergeKey          = "merge"
+	rebaseKey         = "rebase"
+	nameKey           = "name"
+	emailKey          = "email"
+	signingKeyKey     = "signingKey"
+	gpgSignKey        = "gpgSign"
+	commitEncodingKey = "commitEncoding"
+	defaultKey        = "default"
+	insteadOfKey      = "insteadOf"
+	pushInsteadOfKey  = "pushInsteadOf"
+	followTagsKey     = "followTags"
+	pruneKey          = "prune"
+	pruneTagsKey      = "pruneTags"
+	mirrorKey         = "mirror"
+	bundleURIKey      = "bundleURI"
 
 	// DefaultPackWindow holds the number of previous objects used to
 	// generate deltas. The value 10 is the same used by git command.
 	DefaultPackWindow = uint(10)
+	// DefaultPackDepth holds the maximum length of the delta chains. The
+	// value 50 is the same used by git command.
+	DefaultPackDepth = uint(50)
+
+	// DefaultGCAuto holds the number of loose objects above which a
+	// garbage collection is needed, the same used by git command.
+	DefaultGCAuto = 6700
+	// DefaultGCAutoPackLimit holds the number of packfiles above which a
+	// garbage collection is needed, the same used by git command.
+	DefaultGCAutoPackLimit = 50
+	// DefaultGCPruneExpire is the default age of the pruned objects.
+	DefaultGCPruneExpire = "2.weeks.ago"
+	// DefaultGCReflogExpire is the default age of the removed reflog
+	// entries.
+	DefaultGCReflogExpire = "90.days.ago"
+	// DefaultGCReflogExpireUnreachable is the default age of the removed
+	// reflog entries not reachable from the reference.
+	DefaultGCReflogExpireUnreachable = "30.days.ago"
 )
 
 // Unmarshal parses a git-config file and stores it.
@@ -138,15 +314,20 @@ func (c *Config) Unmarshal(b []byte) error {
 	}
 
 	c.unmarshalCore()
+	c.unmarshalUser()
 	if err := c.unmarshalPack(); err != nil {
 		return err
 	}
+	if err := c.unmarshalGC(); err != nil {
+		return err
+	}
 	unmarshalSubmodules(c.Raw, c.Submodules)
 
 	if err := c.unmarshalBranches(); err != nil {
 		return err
 	}
 
+	c.unmarshalURLs()
 	return c.unmarshalRemotes()
 }
 
@@ -160,6 +341,30 @@ func (c *Config) unmarshalCore() {
 	c.Core.CommentChar = s.Options.Get(commentCharKey)
 }
 
+func (c *Config) unmarshalUser() {
+	s := c.Raw.Section(userSection)
+	c.User.Name = s.Options.Get(nameKey)
+	c.User.Email = s.Options.Get(emailKey)
+	c.User.SigningKey = s.Options.Get(signingKeyKey)
+
+	s = c.Raw.Section(authorSection)
+	c.Author.Name = s.Options.Get(nameKey)
+	c.Author.Email = s.Options.Get(emailKey)
+
+	s = c.Raw.Section(committerSection)
+	c.Committer.Name = s.Options.Get(nameKey)
+	c.Committer.Email = s.Options.Get(emailKey)
+
+	c.Commit.GPGSign, _ = boolOption(c.Raw.Section(commitSection).Options, gpgSignKey)
+	c.Tag.GPGSign, _ = boolOption(c.Raw.Section(tagSection).Options, gpgSignKey)
+	c.I18n.CommitEncoding = c.Raw.Section(i18nSection).Options.Get(commitEncodingKey)
+	c.Push.Default = PushDefault(c.Raw.Section(pushSection).Options.Get(defaultKey))
+	c.Push.FollowTags, _ = boolOption(c.Raw.Section(pushSection).Options, followTagsKey)
+	c.Fetch.Prune, _ = boolOption(c.Raw.Section(fetchSection).Options, pruneKey)
+	c.Fetch.PruneTags, _ = boolOption(c.Raw.Section(fetchSection).Options, pruneTagsKey)
+	c.Fetch.BundleURI = c.Raw.Section(fetchSection).Options.Get(bundleURIKey)
+}
+
 func (c *Config) unmarshalPack() error {
 	s := c.Raw.Section(packSection)
 	window := s.Options.Get(windowKey)
@@ -172,6 +377,65 @@ func (c *Config) unmarshalPack() error {
 		}
 		c.Pack.Window = uint(winUint)
 	}
+
+	depth := s.Options.Get(depthKey)
+	if depth == "" {
+		c.Pack.Depth = DefaultPackDepth
+	} else {
+		depthUint, err := strconv.ParseUint(depth, 10, 32)
+		if err != nil {
+			return err
+		}
+		c.Pack.Depth = uint(depthUint)
+	}
+	return nil
+}
+
+func (c *Config) setGCDefaults() {
+	c.GC.Auto = DefaultGCAuto
+	c.GC.AutoPackLimit = DefaultGCAutoPackLimit
+	c.GC.PruneExpire = DefaultGCPruneExpire
+	c.GC.ReflogExpire = DefaultGCReflogExpire
+	c.GC.ReflogExpireUnreachable = DefaultGCReflogExpireUnreachable
+	c.GC.CruftPacks = true
+}
+
+func (c *Config) unmarshalGC() error {
+	c.setGCDefaults()
+
+	s := c.Raw.Section(gcSection)
+	if v := s.Options.Get(autoKey); v != "" {
+		auto, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		c.GC.Auto = auto
+	}
+
+	if v := s.Options.Get(autoPackLimitKey); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		c.GC.AutoPackLimit = limit
+	}
+
+	if v := s.Options.Get(pruneExpireKey); v != "" {
+		c.GC.PruneExpire = v
+	}
+
+	if v := s.Options.Get(reflogExpireKey); v != "" {
+		c.GC.ReflogExpire = v
+	}
+
+	if v := s.Options.Get(reflogUnreachKey); v != "" {
+		c.GC.ReflogExpireUnreachable = v
+	}
+
+	if v, ok := boolOption(s.Options, cruftPacksKey); ok {
+		c.GC.CruftPacks = v
+	}
+
 	return nil
 }
 
@@ -217,13 +481,30 @@ func (c *Config) unmarshalBranches() error {
 	return nil
 }
 
+func (c *Config) unmarshalURLs() {
+	s := c.Raw.Section(urlSection)
+	for _, sub := range s.Subsections {
+		u := &URL{}
+		u.unmarshal(sub)
+
+		if u.Validate() != nil {
+			continue
+		}
+
+		c.URLs[u.Name] = u
+	}
+}
+
 // Marshal returns Config encoded as a git-config file.
 func (c *Config) Marshal() ([]byte, error) {
 	c.marshalCore()
+	c.marshalUser()
 	c.marshalPack()
+	c.marshalGC()
 	c.marshalRemotes()
 	c.marshalSubmodules()
 	c.marshalBranches()
+	c.marshalURLs()
 
 	buf := bytes.NewBuffer(nil)
 	if err := format.NewEncoder(buf).Encode(c.Raw); err != nil {
@@ -242,11 +523,78 @@ func (c *Config) marshalCore() {
 	}
 }
 
+func (c *Config) marshalUser() {
+	setOptionIfNotEmpty(c.Raw, userSection, nameKey, c.User.Name)
+	setOptionIfNotEmpty(c.Raw, userSection, emailKey, c.User.Email)
+	setOptionIfNotEmpty(c.Raw, userSection, signingKeyKey, c.User.SigningKey)
+	setOptionIfNotEmpty(c.Raw, authorSection, nameKey, c.Author.Name)
+	setOptionIfNotEmpty(c.Raw, authorSection, emailKey, c.Author.Email)
+	setOptionIfNotEmpty(c.Raw, committerSection, nameKey, c.Committer.Name)
+	setOptionIfNotEmpty(c.Raw, committerSection, emailKey, c.Committer.Email)
+	setOptionIfNotEmpty(c.Raw, i18nSection, commitEncodingKey, c.I18n.CommitEncoding)
+	setOptionIfNotEmpty(c.Raw, pushSection, defaultKey, string(c.Push.Default))
+	setBoolOption(c.Raw, commitSection, gpgSignKey, c.Commit.GPGSign)
+	setBoolOption(c.Raw, tagSection, gpgSignKey, c.Tag.GPGSign)
+	setBoolOption(c.Raw, pushSection, followTagsKey, c.Push.FollowTags)
+	setBoolOption(c.Raw, fetchSection, pruneKey, c.Fetch.Prune)
+	setBoolOption(c.Raw, fetchSection, pruneTagsKey, c.Fetch.PruneTags)
+	setOptionIfNotEmpty(c.Raw, fetchSection, bundleURIKey, c.Fetch.BundleURI)
+}
+
+func setOptionIfNotEmpty(raw *format.Config, section, key, value string) {
+	if value != "" {
+		raw.Section(section).SetOption(key, value)
+	}
+}
+
+// boolOption returns the value of a boolean option and if it's set at all,
+// since a key without value means true.
+func boolOption(opts format.Options, key string) (value, ok bool) {
+	values := opts.GetAll(key)
+	if len(values) == 0 {
+		return false, false
+	}
+
+	return IsTrue(values[len(values)-1]), true
+}
+
+// setBoolOption sets a boolean option, the false value is only written to
+// override an existing option, since it's the default.
+func setBoolOption(raw *format.Config, section, key string, value bool) {
+	if !value && len(raw.Section(section).Options.GetAll(key)) == 0 {
+		return
+	}
+
+	raw.Section(section).SetOption(key, strconv.FormatBool(value))
+}
+
 func (c *Config) marshalPack() {
 	s := c.Raw.Section(packSection)
 	if c.Pack.Window != DefaultPackWindow {
 		s.SetOption(windowKey, fmt.Sprintf("%d", c.Pack.Window))
 	}
+	if c.Pack.Depth != DefaultPackDepth {
+		s.SetOption(depthKey, fmt.Sprintf("%d", c.Pack.Depth))
+	}
+}
+
+func (c *Config) marshalGC() {
+	s := c.Raw.Section(gcSection)
+	// the defaults are only written to override an existing option
+	set := func(key, value, def string) {
+		if value == "" || value == def && len(s.Options.GetAll(key)) == 0 {
+			return
+		}
+
+		s.SetOption(key, value)
+	}
+
+	set(autoKey, strconv.Itoa(c.GC.Auto), strconv.Itoa(DefaultGCAuto))
+	set(autoPackLimitKey, strconv.Itoa(c.GC.AutoPackLimit), strconv.Itoa(DefaultGCAutoPackLimit))
+	set(pruneExpireKey, c.GC.PruneExpire, DefaultGCPruneExpire)
+	set(reflogExpireKey, c.GC.ReflogExpire, DefaultGCReflogExpire)
+	set(reflogUnreachKey, c.GC.ReflogExpireUnreachable, DefaultGCReflogExpireUnreachable)
+	set(cruftPacksKey, strconv.FormatBool(c.GC.CruftPacks), strconv.FormatBool(true))
 }
 
 func (c *Config) marshalRemotes() {
@@ -318,6 +666,33 @@ func (c *Config) marshalBranches() {
 	s.Subsections = newSubsections
 }
 
+func (c *Config) marshalURLs() {
+	s := c.Raw.Section(urlSection)
+	newSubsections := make(format.Subsections, 0, len(c.URLs))
+	added := make(map[string]bool)
+	for _, subsection := range s.Subsections {
+		if u, ok := c.URLs[subsection.Name]; ok {
+			newSubsections = append(newSubsections, u.marshal())
+			added[subsection.Name] = true
+		}
+	}
+
+	names := make([]string, 0, len(c.URLs))
+	for name := range c.URLs {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !added[name] {
+			newSubsections = append(newSubsections, c.URLs[name].marshal())
+		}
+	}
+
+	s.Subsections = newSubsections
+}
+
 // RemoteConfig contains the configuration for a given remote repository.
 type RemoteConfig struct {
 	// Name of the remote
@@ -327,6 +702,10 @@ type RemoteConfig struct {
 	URLs []string
 	// Fetch the default set of "refspec" for fetch operation
 	Fetch []RefSpec
+	// Mirror if true, the pushes to the remote without refspecs mirror all
+	// the local references, removing the remote references that don't
+	// exist locally.
+	Mirror bool
 
 	// raw representation of the subsection, filled by marshal or unmarshal are
 	// called
@@ -373,6 +752,8 @@ func (c *RemoteConfig) unmarshal(s *format.Subsection) error {
 	c.URLs = append([]string(nil), c.raw.Options.GetAll(urlKey)...)
 	c.Fetch = fetch
 
+	c.Mirror = isMirror(c.raw.Options)
+
 	return nil
 }
 
@@ -399,9 +780,46 @@ func (c *RemoteConfig) marshal() *format.Subsection {
 		c.raw.SetOption(fetchKey, values...)
 	}
 
+	// the value is kept if it already means mirror, e.g. "push"
+	if c.Mirror && !isMirror(c.raw.Options) {
+		c.raw.SetOption(mirrorKey, "true")
+	} else if !c.Mirror && isMirror(c.raw.Options) {
+		c.raw.RemoveOption(mirrorKey)
+	}
+
 	return c.raw
 }
 
+// isMirror returns if remote.<name>.mirror is set to true or to "push", the
+// value written by "git remote add --mirror=push".
+func isMirror(opts format.Options) bool {
+	v, ok := boolOption(opts, mirrorKey)
+	return ok && (v || opts.Get(mirrorKey) == "push")
+}
+
+// FetchPrune returns if the fetches from the remote with the given name
+// prune the remote-tracking references and the tags, as configured in
+// remote.<name>.prune and remote.<name>.pruneTags, or in fetch.prune and
+// fetch.pruneTags when the remote doesn't set them.
+func (c *Config) FetchPrune(remote string) (prune, pruneTags bool) {
+	prune, pruneTags = c.Fetch.Prune, c.Fetch.PruneTags
+
+	r, ok := c.Remotes[remote]
+	if !ok || r.raw == nil {
+		return
+	}
+
+	if v, ok := boolOption(r.raw.Options, pruneKey); ok {
+		prune = v
+	}
+
+	if v, ok := boolOption(r.raw.Options, pruneTagsKey); ok {
+		pruneTags = v
+	}
+
+	return
+}
+
 func (c *RemoteConfig) IsFirstURLLocal() bool {
 	return url.IsLocalEndpoint(c.URLs[0])
 }
@@ -43,6 +43,7 @@ func (s *ConfigSuite) TestUnmarshal(c *C) {
 	c.Assert(cfg.Core.Worktree, Equals, "foo")
 	c.Assert(cfg.Core.CommentChar, Equals, "bar")
 	c.Assert(cfg.Pack.Window, Equals, uint(20))
+	c.Assert(cfg.Pack.Depth, Equals, DefaultPackDepth)
 	c.Assert(cfg.Remotes, HasLen, 3)
 	c.Assert(cfg.Remotes["origin"].Name, Equals, "origin")
 	c.Assert(cfg.Remotes["origin"].URLs, DeepEquals, []string{"git@github.com:mcuadros/go-git.git"})
@@ -66,6 +67,7 @@ func (s *ConfigSuite) TestMarshal(c *C) {
 	worktree = bar
 [pack]
 	window = 20
+	depth = 10
 [remote "alt"]
 	url = git@github.com:mcuadros/go-git.git
 	url = git@github.com:src-d/go-git.git
@@ -86,6 +88,7 @@ func (s *ConfigSuite) TestMarshal(c *C) {
 	cfg.Core.IsBare = true
 	cfg.Core.Worktree = "bar"
 	cfg.Pack.Window = 20
+	cfg.Pack.Depth = 10
 	cfg.Remotes["origin"] = &RemoteConfig{
 		Name: "origin",
 		URLs: []string{"git@github.com:mcuadros/go-git.git"},
@@ -146,6 +149,199 @@ func (s *ConfigSuite) TestUnmarshalMarshal(c *C) {
 	c.Assert(string(output), DeepEquals, string(input))
 }
 
+func (s *ConfigSuite) TestUnmarshalMarshalUser(c *C) {
+	input := []byte(`[user]
+	name = John Doe
+	email = john@example.com
+	signingKey = 0A46826A
+[committer]
+	email = ci@example.com
+[commit]
+	gpgSign = true
+[tag]
+	gpgsign = false
+[i18n]
+	commitEncoding = ISO-8859-1
+`)
+
+	cfg := NewConfig()
+	err := cfg.Unmarshal(input)
+	c.Assert(err, IsNil)
+
+	c.Assert(cfg.User.Name, Equals, "John Doe")
+	c.Assert(cfg.User.Email, Equals, "john@example.com")
+	c.Assert(cfg.User.SigningKey, Equals, "0A46826A")
+	c.Assert(cfg.Author.Email, Equals, "")
+	c.Assert(cfg.Committer.Email, Equals, "ci@example.com")
+	c.Assert(cfg.Commit.GPGSign, Equals, true)
+	c.Assert(cfg.Tag.GPGSign, Equals, false)
+	c.Assert(cfg.I18n.CommitEncoding, Equals, "ISO-8859-1")
+
+	cfg.Author.Name = "Jane Doe"
+	cfg.Commit.GPGSign = false
+
+	output, err := cfg.Marshal()
+	c.Assert(err, IsNil)
+	c.Assert(string(output), Equals, `[user]
+	name = John Doe
+	email = john@example.com
+	signingKey = 0A46826A
+[committer]
+	email = ci@example.com
+[commit]
+	gpgSign = false
+[tag]
+	gpgsign = false
+[i18n]
+	commitEncoding = ISO-8859-1
+[core]
+	bare = false
+[author]
+	name = Jane Doe
+`)
+}
+
+func (s *ConfigSuite) TestFetchPruneAndMirror(c *C) {
+	input := []byte(`[fetch]
+	prune = true
+	pruneTags = true
+	bundleURI = https://example.com/basic.bundle
+[push]
+	followTags = true
+[remote "origin"]
+	url = https://github.com/git-fixtures/basic.git
+	prune = false
+[remote "backup"]
+	url = /srv/backup.git
+	mirror = push
+`)
+
+	cfg := NewConfig()
+	c.Assert(cfg.Unmarshal(input), IsNil)
+	c.Assert(cfg.Push.FollowTags, Equals, true)
+	c.Assert(cfg.Fetch.BundleURI, Equals, "https://example.com/basic.bundle")
+	c.Assert(cfg.Remotes["origin"].Mirror, Equals, false)
+	c.Assert(cfg.Remotes["backup"].Mirror, Equals, true)
+
+	prune, pruneTags := cfg.FetchPrune("origin")
+	c.Assert(prune, Equals, false)
+	c.Assert(pruneTags, Equals, true)
+
+	prune, pruneTags = cfg.FetchPrune("backup")
+	c.Assert(prune, Equals, true)
+	c.Assert(pruneTags, Equals, true)
+
+	cfg.Fetch.PruneTags = false
+	cfg.Remotes["backup"].Mirror = false
+	cfg.Remotes["origin"].Mirror = true
+
+	output, err := cfg.Marshal()
+	c.Assert(err, IsNil)
+	c.Assert(string(output), Equals, `[fetch]
+	prune = true
+	bundleURI = https://example.com/basic.bundle
+	pruneTags = false
+[push]
+	followTags = true
+[remote "origin"]
+	url = https://github.com/git-fixtures/basic.git
+	prune = false
+	mirror = true
+[remote "backup"]
+	url = /srv/backup.git
+[core]
+	bare = false
+`)
+}
+
+func (s *ConfigSuite) TestMarshalMirrorPush(c *C) {
+	input := []byte(`[remote "backup"]
+	url = /srv/backup.git
+	mirror = push
+`)
+
+	cfg := NewConfig()
+	c.Assert(cfg.Unmarshal(input), IsNil)
+	c.Assert(cfg.Remotes["backup"].Mirror, Equals, true)
+
+	output, err := cfg.Marshal()
+	c.Assert(err, IsNil)
+	c.Assert(string(output), Equals, `[remote "backup"]
+	url = /srv/backup.git
+	mirror = push
+[core]
+	bare = false
+`)
+}
+
+func (s *ConfigSuite) TestValuelessBooleans(c *C) {
+	input := []byte(`[commit]
+	gpgSign
+[fetch]
+	prune
+[gc]
+	cruftPacks = off
+[remote "origin"]
+	url = https://github.com/git-fixtures/basic.git
+	mirror
+	pruneTags
+`)
+
+	cfg := NewConfig()
+	c.Assert(cfg.Unmarshal(input), IsNil)
+	c.Assert(cfg.Commit.GPGSign, Equals, true)
+	c.Assert(cfg.Tag.GPGSign, Equals, false)
+	c.Assert(cfg.Fetch.Prune, Equals, true)
+	c.Assert(cfg.Fetch.PruneTags, Equals, false)
+	c.Assert(cfg.GC.CruftPacks, Equals, false)
+	c.Assert(cfg.Remotes["origin"].Mirror, Equals, true)
+
+	prune, pruneTags := cfg.FetchPrune("origin")
+	c.Assert(prune, Equals, true)
+	c.Assert(pruneTags, Equals, true)
+}
+
+func (s *ConfigSuite) TestIsTrue(c *C) {
+	for _, v := range []string{"", "1", "true", "TRUE", "yes", "On"} {
+		c.Assert(IsTrue(v), Equals, true, Commentf("%q", v))
+	}
+
+	for _, v := range []string{"0", "false", "no", "off", "2", "push"} {
+		c.Assert(IsTrue(v), Equals, false, Commentf("%q", v))
+	}
+}
+
+func (s *ConfigSuite) TestGC(c *C) {
+	input := []byte(`[gc]
+	auto = 0
+	pruneExpire = now
+	cruftPacks = false
+`)
+
+	cfg := NewConfig()
+	c.Assert(cfg.Unmarshal(input), IsNil)
+	c.Assert(cfg.GC.Auto, Equals, 0)
+	c.Assert(cfg.GC.AutoPackLimit, Equals, DefaultGCAutoPackLimit)
+	c.Assert(cfg.GC.PruneExpire, Equals, "now")
+	c.Assert(cfg.GC.ReflogExpire, Equals, DefaultGCReflogExpire)
+	c.Assert(cfg.GC.ReflogExpireUnreachable, Equals, DefaultGCReflogExpireUnreachable)
+	c.Assert(cfg.GC.CruftPacks, Equals, false)
+
+	cfg.GC.Auto = DefaultGCAuto
+	cfg.GC.ReflogExpire = "never"
+
+	output, err := cfg.Marshal()
+	c.Assert(err, IsNil)
+	c.Assert(string(output), Equals, `[gc]
+	pruneExpire = now
+	cruftPacks = false
+	auto = 6700
+	reflogExpire = never
+[core]
+	bare = false
+`)
+}
+
 func (s *ConfigSuite) TestValidateConfig(c *C) {
 	config := &Config{
 		Remotes: map[string]*RemoteConfig{
@@ -249,4 +445,8 @@ func (s *ConfigSuite) TestRemoteConfigDefaultValues(c *C) {
 	c.Assert(config.Submodules, HasLen, 0)
 	c.Assert(config.Raw, NotNil)
 	c.Assert(config.Pack.Window, Equals, DefaultPackWindow)
+	c.Assert(config.Pack.Depth, Equals, DefaultPackDepth)
+	c.Assert(config.GC.Auto, Equals, DefaultGCAuto)
+	c.Assert(config.GC.PruneExpire, Equals, DefaultGCPruneExpire)
+	c.Assert(config.GC.CruftPacks, Equals, true)
 }
@@ -0,0 +1,162 @@
+package config
+
+import (
+	"bytes"
+	"strings"
+
+	format "gopkg.in/src-d/go-git.v4/plumbing/format/config"
+)
+
+// Scope is the scope of a config file, the scopes with higher value take
+// precedence over the lower ones.
+type Scope int
+
+const (
+	// SystemScope is the scope of the system wide config, usually
+	// /etc/gitconfig.
+	SystemScope Scope = iota
+	// GlobalScope is the scope of the user config, $XDG_CONFIG_HOME/git/config
+	// and ~/.gitconfig.
+	GlobalScope
+	// LocalScope is the scope of the repository config, $GIT_DIR/config.
+	LocalScope
+	// WorktreeScope is the scope of the worktree specific config,
+	// $GIT_DIR/config.worktree, only read if extensions.worktreeConfig is set.
+	WorktreeScope
+)
+
+func (s Scope) String() string {
+	switch s {
+	case SystemScope:
+		return "system"
+	case GlobalScope:
+		return "global"
+	case LocalScope:
+		return "local"
+	case WorktreeScope:
+		return "worktree"
+	default:
+		return "unknown"
+	}
+}
+
+// Origin describes where a config value was read from.
+type Origin struct {
+	// Scope of the config file containing the value.
+	Scope Scope
+	// Path of the file containing the value, it is the included file for
+	// the values read through an include. It may be empty if the config
+	// wasn't read from a file.
+	Path string
+}
+
+// Value is a single config value along with its origin.
+type Value struct {
+	Section    string
+	Subsection string
+	Key        string
+	Value      string
+	Origin     Origin
+}
+
+// Layered is the config resulting of reading the config files of several
+// scopes, keeping the values in the order they were read and where they
+// come from, the same way `git config --show-origin --list` does.
+type Layered struct {
+	// Values contains all the values read, in ascending order of precedence.
+	// The values with an empty Key record the declaration of a section or
+	// subsection.
+	Values []*Value
+}
+
+// NewLayered returns a new empty Layered config.
+func NewLayered() *Layered {
+	return &Layered{}
+}
+
+// Add appends a value to the config.
+func (l *Layered) Add(v *Value) {
+	l.Values = append(l.Values, v)
+}
+
+// Get returns the value with the highest precedence for the given key, or nil
+// if the key is not set in any scope. Section and key names are case
+// insensitive, the subsection names are case sensitive.
+func (l *Layered) Get(section, subsection, key string) *Value {
+	for i := len(l.Values) - 1; i >= 0; i-- {
+		if l.Values[i].is(section, subsection, key) {
+			return l.Values[i]
+		}
+	}
+
+	return nil
+}
+
+// GetAll returns all the values for the given key, in ascending order of
+// precedence.
+func (l *Layered) GetAll(section, subsection, key string) []*Value {
+	var values []*Value
+	for _, v := range l.Values {
+		if v.is(section, subsection, key) {
+			values = append(values, v)
+		}
+	}
+
+	return values
+}
+
+// Scoped returns a Layered config containing only the values of the given
+// scope.
+func (l *Layered) Scoped(scope Scope) *Layered {
+	scoped := NewLayered()
+	for _, v := range l.Values {
+		if v.Origin.Scope == scope {
+			scoped.Add(v)
+		}
+	}
+
+	return scoped
+}
+
+// Raw returns the values merged into a single format.Config, the options of
+// the scopes with higher precedence are appended after the lower ones, so
+// the single-valued options resolve to the value with highest precedence.
+func (l *Layered) Raw() *format.Config {
+	raw := format.New()
+	for _, v := range l.Values {
+		if v.Key == "" {
+			if v.Subsection == "" {
+				raw.Section(v.Section)
+			} else {
+				raw.Section(v.Section).Subsection(v.Subsection)
+			}
+
+			continue
+		}
+
+		raw.AddOption(v.Section, v.Subsection, v.Key, v.Value)
+	}
+
+	return raw
+}
+
+// Config returns the merged values parsed as a Config.
+func (l *Layered) Config() (*Config, error) {
+	buf := bytes.NewBuffer(nil)
+	if err := format.NewEncoder(buf).Encode(l.Raw()); err != nil {
+		return nil, err
+	}
+
+	cfg := NewConfig()
+	if err := cfg.Unmarshal(buf.Bytes()); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func (v *Value) is(section, subsection, key string) bool {
+	return strings.EqualFold(v.Section, section) &&
+		v.Subsection == subsection &&
+		strings.EqualFold(v.Key, key)
+}
@@ -0,0 +1,319 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/src-d/gcfg"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/osfs"
+)
+
+const (
+	includeSection   = "include"
+	includeIfSection = "includeIf"
+
+	gitdirCondition      = "gitdir:"
+	gitdirFoldCondition  = "gitdir/i:"
+	onbranchCondition    = "onbranch:"
+	systemConfigFile     = "/etc/gitconfig"
+	globalConfigFile     = ".gitconfig"
+	xdgConfigFile        = "git/config"
+	maxIncludeDepth      = 10
+	envConfigNoSystem    = "GIT_CONFIG_NOSYSTEM"
+	envConfigSystem      = "GIT_CONFIG_SYSTEM"
+	envConfigGlobal      = "GIT_CONFIG_GLOBAL"
+	envXDGConfigHome     = "XDG_CONFIG_HOME"
+	envHome              = "HOME"
+	defaultXDGConfigHome = ".config"
+)
+
+var (
+	// ErrIncludeDepthExceeded is returned when the includes are nested
+	// deeper than the limit, usually because of an include cycle.
+	ErrIncludeDepthExceeded = errors.New("config: exceeded maximum include depth")
+)
+
+// Loader reads the config files of the system and global scopes, following
+// their includes.
+type Loader struct {
+	// FS is the filesystem used to read the config files, all the paths are
+	// absolute, so it should be rooted at "/".
+	FS billy.Filesystem
+	// Getenv returns the value of an environment variable, it is used to
+	// find the config files through HOME, XDG_CONFIG_HOME, GIT_CONFIG_GLOBAL,
+	// GIT_CONFIG_SYSTEM and GIT_CONFIG_NOSYSTEM.
+	Getenv func(key string) string
+}
+
+// NewLoader returns a new Loader reading the files from fs and using the
+// environment of the process.
+func NewLoader(fs billy.Filesystem) *Loader {
+	return &Loader{FS: fs, Getenv: os.Getenv}
+}
+
+// NewDefaultLoader returns the Loader used by default, reading the config
+// files from the OS filesystem and the paths from the process environment.
+func NewDefaultLoader() *Loader {
+	return NewLoader(osfs.New("/"))
+}
+
+// IncludeContext contains the information of the repository used to
+// evaluate the conditions of the includeIf sections.
+type IncludeContext struct {
+	// GitDir is the absolute path of the git directory, used by the gitdir
+	// conditions.
+	GitDir string
+	// Branch is the short name of the checked out branch, used by the
+	// onbranch conditions.
+	Branch string
+}
+
+// Paths returns the paths of the config files of the given scope, in
+// ascending order of precedence. Only the system and global scopes are
+// resolved, since the other ones depend on the repository.
+func (l *Loader) Paths(scope Scope) []string {
+	switch scope {
+	case SystemScope:
+		if v := l.Getenv(envConfigNoSystem); v != "" && IsTrue(v) {
+			return nil
+		}
+
+		if p := l.Getenv(envConfigSystem); p != "" {
+			return []string{p}
+		}
+
+		return []string{systemConfigFile}
+	case GlobalScope:
+		if p := l.Getenv(envConfigGlobal); p != "" {
+			return []string{p}
+		}
+
+		home := l.Getenv(envHome)
+		xdg := l.Getenv(envXDGConfigHome)
+		if xdg == "" && home != "" {
+			xdg = path.Join(home, defaultXDGConfigHome)
+		}
+
+		var paths []string
+		if xdg != "" {
+			paths = append(paths, path.Join(xdg, xdgConfigFile))
+		}
+
+		if home != "" {
+			paths = append(paths, path.Join(home, globalConfigFile))
+		}
+
+		return paths
+	default:
+		return nil
+	}
+}
+
+// Load reads the config files of the given scope into a new Layered config.
+// The missing files are ignored.
+func (l *Loader) Load(scope Scope, ctx *IncludeContext) (*Layered, error) {
+	cfg := NewLayered()
+	for _, p := range l.Paths(scope) {
+		if err := l.LoadFile(cfg, scope, p, ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	return cfg, nil
+}
+
+// LoadFile reads the config file at the given path into cfg, the file is
+// ignored if it doesn't exist.
+func (l *Loader) LoadFile(cfg *Layered, scope Scope, path string, ctx *IncludeContext) error {
+	return l.loadFile(cfg, scope, path, ctx, 0)
+}
+
+// Decode reads a config file from r into cfg, following its includes. The
+// path is recorded as origin of the values and used to resolve the relative
+// include paths.
+func (l *Loader) Decode(cfg *Layered, scope Scope, path string, r io.Reader, ctx *IncludeContext) error {
+	return l.decode(cfg, scope, path, r, ctx, 0)
+}
+
+func (l *Loader) loadFile(cfg *Layered, scope Scope, path string, ctx *IncludeContext, depth int) error {
+	f, err := l.FS.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+	return l.decode(cfg, scope, path, f, ctx, depth)
+}
+
+func (l *Loader) decode(cfg *Layered, scope Scope, file string, r io.Reader, ctx *IncludeContext, depth int) error {
+	if depth > maxIncludeDepth {
+		return ErrIncludeDepthExceeded
+	}
+
+	// the whole file is read first, since the includes are read in the
+	// middle of the parsing
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	origin := Origin{Scope: scope, Path: file}
+	cb := func(s string, ss string, k string, v string, bv bool) error {
+		cfg.Add(&Value{Section: s, Subsection: ss, Key: k, Value: v, Origin: origin})
+		if k == "" || !strings.EqualFold(k, pathKey) || v == "" {
+			return nil
+		}
+
+		include := strings.EqualFold(s, includeSection) && ss == ""
+		if strings.EqualFold(s, includeIfSection) {
+			include = l.matchCondition(ss, file, ctx)
+		}
+
+		if !include {
+			return nil
+		}
+
+		return l.loadFile(cfg, scope, l.includePath(v, file), ctx, depth+1)
+	}
+
+	return gcfg.ReadWithCallback(bytes.NewReader(b), cb)
+}
+
+// includePath resolves the path of an included file, relative to the
+// directory of the including file.
+func (l *Loader) includePath(p, file string) string {
+	p = l.expandHome(p)
+	if path.IsAbs(p) || file == "" {
+		return p
+	}
+
+	return path.Join(path.Dir(file), p)
+}
+
+func (l *Loader) expandHome(p string) string {
+	if !strings.HasPrefix(p, "~/") {
+		return p
+	}
+
+	home := l.Getenv(envHome)
+	if home == "" {
+		return p
+	}
+
+	return strings.TrimSuffix(home, "/") + p[1:]
+}
+
+// matchCondition evaluates the condition of an includeIf section, the
+// unknown conditions are always false.
+func (l *Loader) matchCondition(cond, file string, ctx *IncludeContext) bool {
+	if ctx == nil {
+		return false
+	}
+
+	switch {
+	case strings.HasPrefix(cond, gitdirCondition):
+		return l.matchGitDir(cond[len(gitdirCondition):], file, ctx.GitDir, false)
+	case strings.HasPrefix(cond, gitdirFoldCondition):
+		return l.matchGitDir(cond[len(gitdirFoldCondition):], file, ctx.GitDir, true)
+	case strings.HasPrefix(cond, onbranchCondition):
+		if ctx.Branch == "" {
+			return false
+		}
+
+		pattern := cond[len(onbranchCondition):]
+		if strings.HasSuffix(pattern, "/") {
+			pattern += "**"
+		}
+
+		return matchGlob(pattern, ctx.Branch, false)
+	default:
+		return false
+	}
+}
+
+func (l *Loader) matchGitDir(pattern, file, gitdir string, fold bool) bool {
+	if gitdir == "" {
+		return false
+	}
+
+	pattern = l.expandHome(pattern)
+	if strings.HasPrefix(pattern, "./") {
+		if file == "" {
+			return false
+		}
+
+		dir := strings.HasSuffix(pattern, "/")
+		pattern = path.Join(path.Dir(file), pattern[2:])
+		if dir {
+			pattern += "/"
+		}
+	}
+
+	if !path.IsAbs(pattern) {
+		pattern = "**/" + pattern
+	}
+
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "**"
+	}
+
+	return matchGlob(pattern, strings.TrimSuffix(gitdir, "/"), fold)
+}
+
+// matchGlob matches name against a wildmatch pattern, where "*" and "?" don't
+// match "/", and "**" matches any number of directories.
+func matchGlob(pattern, name string, fold bool) bool {
+	var expr strings.Builder
+	expr.WriteString("^")
+	if fold {
+		expr.WriteString("(?i)")
+	}
+
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			expr.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case c == '*':
+			expr.WriteString("[^/]*")
+		case c == '?':
+			expr.WriteString("[^/]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	expr.WriteString("$")
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return false
+	}
+
+	return re.MatchString(name)
+}
+
+// IsTrue returns if the given config value means true, as git reads boolean
+// options: "true", "yes", "on" and "1" in any case, and an empty value, which
+// is what a key without "= value" holds.
+func IsTrue(v string) bool {
+	switch strings.ToLower(v) {
+	case "", "1", "true", "yes", "on":
+		return true
+	default:
+		return false
+	}
+}
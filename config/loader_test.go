@@ -0,0 +1,211 @@
+package config
+
+import (
+	"bytes"
+	"strings"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-billy.v4/util"
+)
+
+type LoaderSuite struct {
+	fs     billy.Filesystem
+	env    map[string]string
+	loader *Loader
+}
+
+var _ = Suite(&LoaderSuite{})
+
+func (s *LoaderSuite) SetUpTest(c *C) {
+	s.fs = memfs.New()
+	s.env = map[string]string{"HOME": "/home/user"}
+	s.loader = NewLoader(s.fs)
+	s.loader.Getenv = func(key string) string { return s.env[key] }
+}
+
+func (s *LoaderSuite) writeFile(c *C, path, content string) {
+	err := util.WriteFile(s.fs, path, []byte(content), 0644)
+	c.Assert(err, IsNil)
+}
+
+func (s *LoaderSuite) TestPaths(c *C) {
+	c.Assert(s.loader.Paths(SystemScope), DeepEquals, []string{"/etc/gitconfig"})
+	c.Assert(s.loader.Paths(GlobalScope), DeepEquals, []string{
+		"/home/user/.config/git/config",
+		"/home/user/.gitconfig",
+	})
+	c.Assert(s.loader.Paths(LocalScope), HasLen, 0)
+
+	s.env["XDG_CONFIG_HOME"] = "/xdg"
+	s.env["GIT_CONFIG_SYSTEM"] = "/opt/gitconfig"
+	c.Assert(s.loader.Paths(SystemScope), DeepEquals, []string{"/opt/gitconfig"})
+	c.Assert(s.loader.Paths(GlobalScope), DeepEquals, []string{
+		"/xdg/git/config",
+		"/home/user/.gitconfig",
+	})
+
+	s.env["GIT_CONFIG_NOSYSTEM"] = "1"
+	s.env["GIT_CONFIG_GLOBAL"] = "/tmp/global"
+	c.Assert(s.loader.Paths(SystemScope), HasLen, 0)
+	c.Assert(s.loader.Paths(GlobalScope), DeepEquals, []string{"/tmp/global"})
+}
+
+func (s *LoaderSuite) TestLoad(c *C) {
+	s.writeFile(c, "/home/user/.config/git/config", "[user]\n\tname = xdg\n")
+	s.writeFile(c, "/home/user/.gitconfig", "[user]\n\tname = home\n\temail = home@example.com\n")
+
+	cfg, err := s.loader.Load(GlobalScope, nil)
+	c.Assert(err, IsNil)
+
+	name := cfg.Get("user", "", "name")
+	c.Assert(name.Value, Equals, "home")
+	c.Assert(name.Origin, Equals, Origin{Scope: GlobalScope, Path: "/home/user/.gitconfig"})
+
+	names := cfg.GetAll("User", "", "Name")
+	c.Assert(names, HasLen, 2)
+	c.Assert(names[0].Value, Equals, "xdg")
+	c.Assert(names[0].Origin.Path, Equals, "/home/user/.config/git/config")
+
+	c.Assert(cfg.Get("user", "", "signingkey"), IsNil)
+
+	cfg, err = s.loader.Load(SystemScope, nil)
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Values, HasLen, 0)
+}
+
+func (s *LoaderSuite) TestInclude(c *C) {
+	s.writeFile(c, "/home/user/.gitconfig", strings.Join([]string{
+		"[user]",
+		"\tname = before",
+		"[include]",
+		"\tpath = git/extra",
+		"\tpath = ~/absent",
+		"[core]",
+		"\teditor = vim",
+	}, "\n"))
+	s.writeFile(c, "/home/user/git/extra", "[user]\n\tname = included\n[core]\n\teditor = emacs\n")
+
+	cfg, err := s.loader.Load(GlobalScope, nil)
+	c.Assert(err, IsNil)
+
+	name := cfg.Get("user", "", "name")
+	c.Assert(name.Value, Equals, "included")
+	c.Assert(name.Origin, Equals, Origin{Scope: GlobalScope, Path: "/home/user/git/extra"})
+
+	editor := cfg.Get("core", "", "editor")
+	c.Assert(editor.Value, Equals, "vim")
+	c.Assert(editor.Origin.Path, Equals, "/home/user/.gitconfig")
+}
+
+func (s *LoaderSuite) TestIncludeCycle(c *C) {
+	s.writeFile(c, "/home/user/.gitconfig", "[include]\n\tpath = .gitconfig\n")
+
+	_, err := s.loader.Load(GlobalScope, nil)
+	c.Assert(err, Equals, ErrIncludeDepthExceeded)
+}
+
+func (s *LoaderSuite) TestIncludeIfGitDir(c *C) {
+	s.writeFile(c, "/home/user/.gitconfig", strings.Join([]string{
+		`[includeIf "gitdir:~/work/"]`,
+		"\tpath = work",
+		`[includeIf "gitdir:oss/*/.git"]`,
+		"\tpath = oss",
+		`[includeIf "gitdir/i:/SRC/"]`,
+		"\tpath = src",
+		`[includeIf "gitdir:./dotfiles/"]`,
+		"\tpath = dotfiles",
+	}, "\n"))
+	s.writeFile(c, "/home/user/work", "[user]\n\temail = work@example.com\n")
+	s.writeFile(c, "/home/user/oss", "[user]\n\temail = oss@example.com\n")
+	s.writeFile(c, "/home/user/src", "[user]\n\temail = src@example.com\n")
+	s.writeFile(c, "/home/user/dotfiles", "[user]\n\temail = dotfiles@example.com\n")
+
+	for gitdir, email := range map[string]string{
+		"/home/user/work/project/.git":   "work@example.com",
+		"/home/user/oss/go-git/.git":     "oss@example.com",
+		"/src/go-git/.git":               "src@example.com",
+		"/home/user/dotfiles/.git":       "dotfiles@example.com",
+		"/home/user/oss/go-git/sub/.git": "",
+		"/home/user/other/.git":          "",
+	} {
+		cfg, err := s.loader.Load(GlobalScope, &IncludeContext{GitDir: gitdir})
+		c.Assert(err, IsNil)
+
+		v := cfg.Get("user", "", "email")
+		if email == "" {
+			c.Assert(v, IsNil, Commentf("gitdir %s", gitdir))
+			continue
+		}
+
+		c.Assert(v, NotNil, Commentf("gitdir %s", gitdir))
+		c.Assert(v.Value, Equals, email)
+	}
+
+	cfg, err := s.loader.Load(GlobalScope, nil)
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Get("user", "", "email"), IsNil)
+}
+
+func (s *LoaderSuite) TestIncludeIfOnBranch(c *C) {
+	s.writeFile(c, "/home/user/.gitconfig", strings.Join([]string{
+		`[includeIf "onbranch:feature/"]`,
+		"\tpath = feature",
+		`[includeIf "onbranch:master"]`,
+		"\tpath = master",
+		`[includeIf "hasconfig:remote.*.url:https://example.com/**"]`,
+		"\tpath = unknown",
+	}, "\n"))
+	s.writeFile(c, "/home/user/feature", "[pull]\n\trebase = true\n")
+	s.writeFile(c, "/home/user/master", "[pull]\n\trebase = false\n")
+	s.writeFile(c, "/home/user/unknown", "[pull]\n\trebase = merges\n")
+
+	cfg, err := s.loader.Load(GlobalScope, &IncludeContext{Branch: "feature/foo/bar"})
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Get("pull", "", "rebase").Value, Equals, "true")
+
+	cfg, err = s.loader.Load(GlobalScope, &IncludeContext{Branch: "master"})
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Get("pull", "", "rebase").Value, Equals, "false")
+
+	cfg, err = s.loader.Load(GlobalScope, &IncludeContext{Branch: "develop"})
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Get("pull", "", "rebase"), IsNil)
+}
+
+func (s *LoaderSuite) TestLayeredConfig(c *C) {
+	s.writeFile(c, "/etc/gitconfig", "[core]\n\tautocrlf = input\n[remote \"origin\"]\n\turl = system\n")
+	s.writeFile(c, "/home/user/.gitconfig", "[core]\n\tautocrlf = false\n")
+
+	layered := NewLayered()
+	for _, scope := range []Scope{SystemScope, GlobalScope} {
+		cfg, err := s.loader.Load(scope, nil)
+		c.Assert(err, IsNil)
+		layered.Values = append(layered.Values, cfg.Values...)
+	}
+
+	local := "[remote \"origin\"]\n\turl = https://github.com/src-d/go-git.git\n"
+	err := s.loader.Decode(layered, LocalScope, "/repo/.git/config", bytes.NewBufferString(local), nil)
+	c.Assert(err, IsNil)
+
+	c.Assert(layered.Get("core", "", "autocrlf").Origin.Scope, Equals, GlobalScope)
+	c.Assert(layered.Scoped(SystemScope).Get("core", "", "autocrlf").Value, Equals, "input")
+
+	raw := layered.Raw()
+	c.Assert(raw.Section("core").Options.Get("autocrlf"), Equals, "false")
+
+	cfg, err := layered.Config()
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Remotes["origin"].URLs, DeepEquals, []string{
+		"system",
+		"https://github.com/src-d/go-git.git",
+	})
+}
+
+func (s *LoaderSuite) TestScopeString(c *C) {
+	c.Assert(SystemScope.String(), Equals, "system")
+	c.Assert(GlobalScope.String(), Equals, "global")
+	c.Assert(LocalScope.String(), Equals, "local")
+	c.Assert(WorktreeScope.String(), Equals, "worktree")
+}
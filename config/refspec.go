@@ -127,11 +127,18 @@ func (s RefSpec) Dst(n plumbing.ReferenceName) plumbing.ReferenceName {
 	return plumbing.ReferenceName(dst[0:wd] + match + dst[wd+1:])
 }
 
+// Reverse returns a RefSpec with the source and destination swapped, keeping
+// the force flag.
 func (s RefSpec) Reverse() RefSpec {
 	spec := string(s)
+	var force string
+	if s.IsForceUpdate() {
+		force, spec = refSpecForce, spec[1:]
+	}
+
 	separator := strings.Index(spec, refSpecSeparator)
 
-	return RefSpec(spec[separator+1:] + refSpecSeparator + spec[:separator])
+	return RefSpec(force + spec[separator+1:] + refSpecSeparator + spec[:separator])
 }
 
 func (s RefSpec) String() string {
@@ -174,6 +174,12 @@ func (s *RefSpecSuite) TestRefSpecReverse(c *C) {
 		spec.Reverse(), Equals,
 		RefSpec("refs/remotes/origin/*:refs/heads/*"),
 	)
+
+	spec = RefSpec("+refs/heads/*:refs/remotes/origin/*")
+	c.Assert(
+		spec.Reverse(), Equals,
+		RefSpec("+refs/remotes/origin/*:refs/heads/*"),
+	)
 }
 
 func (s *RefSpecSuite) TestMatchAny(c *C) {
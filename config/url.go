@@ -0,0 +1,120 @@
+package config
+
+import (
+	"errors"
+	"strings"
+
+	format "gopkg.in/src-d/go-git.v4/plumbing/format/config"
+)
+
+var (
+	errURLEmptyName      = errors.New("url config: empty name")
+	errURLEmptyInsteadOf = errors.New("url config: empty insteadOf and pushInsteadOf")
+)
+
+// URL contains the URL rewriting rules of a url.<base> section. Any URL
+// starting with one of the InsteadOfs prefixes is rewritten replacing the
+// prefix with the Name, and the same for the PushInsteadOfs prefixes only
+// when the URL is used to push.
+type URL struct {
+	// Name is the new beginning of the rewritten URLs.
+	Name string
+	// InsteadOfs are the prefixes replaced by Name.
+	InsteadOfs []string
+	// PushInsteadOfs are the prefixes replaced by Name, only for push.
+	PushInsteadOfs []string
+
+	raw *format.Subsection
+}
+
+// Validate validates fields of url
+func (u *URL) Validate() error {
+	if u.Name == "" {
+		return errURLEmptyName
+	}
+
+	if len(u.InsteadOfs) == 0 && len(u.PushInsteadOfs) == 0 {
+		return errURLEmptyInsteadOf
+	}
+
+	return nil
+}
+
+func (u *URL) marshal() *format.Subsection {
+	if u.raw == nil {
+		u.raw = &format.Subsection{}
+	}
+
+	u.raw.Name = u.Name
+
+	if len(u.InsteadOfs) == 0 {
+		u.raw.RemoveOption(insteadOfKey)
+	} else {
+		u.raw.SetOption(insteadOfKey, u.InsteadOfs...)
+	}
+
+	if len(u.PushInsteadOfs) == 0 {
+		u.raw.RemoveOption(pushInsteadOfKey)
+	} else {
+		u.raw.SetOption(pushInsteadOfKey, u.PushInsteadOfs...)
+	}
+
+	return u.raw
+}
+
+func (u *URL) unmarshal(s *format.Subsection) {
+	u.raw = s
+
+	u.Name = s.Name
+	u.InsteadOfs = s.Options.GetAll(insteadOfKey)
+	u.PushInsteadOfs = s.Options.GetAll(pushInsteadOfKey)
+}
+
+// RewriteURL returns the URL rewritten with the url.<base>.insteadOf rules,
+// the rule with the longest matching prefix is applied. The URL is returned
+// unchanged if no rule matches.
+func (c *Config) RewriteURL(url string) string {
+	if rewritten, ok := c.rewriteURL(url, false); ok {
+		return rewritten
+	}
+
+	return url
+}
+
+// RewritePushURL returns the URL to push to, rewritten with the
+// url.<base>.pushInsteadOf rules, or with the url.<base>.insteadOf rules if
+// no pushInsteadOf rule matches.
+func (c *Config) RewritePushURL(url string) string {
+	if rewritten, ok := c.rewriteURL(url, true); ok {
+		return rewritten
+	}
+
+	return c.RewriteURL(url)
+}
+
+func (c *Config) rewriteURL(url string, push bool) (string, bool) {
+	var base, prefix string
+	for _, u := range c.URLs {
+		prefixes := u.InsteadOfs
+		if push {
+			prefixes = u.PushInsteadOfs
+		}
+
+		for _, p := range prefixes {
+			if p == "" || !strings.HasPrefix(url, p) || len(p) < len(prefix) {
+				continue
+			}
+
+			// ties are resolved by name, to not depend on the map order
+			if len(p) > len(prefix) || u.Name < base {
+				base, prefix = u.Name, p
+			}
+		}
+	}
+
+	if prefix == "" {
+		return "", false
+	}
+
+	return base + url[len(prefix):], true
+}
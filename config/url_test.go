@@ -0,0 +1,87 @@
+package config
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+type URLSuite struct{}
+
+var _ = Suite(&URLSuite{})
+
+func (b *URLSuite) TestValidate(c *C) {
+	u := &URL{Name: "https://mirror.example.com/", InsteadOfs: []string{"https://github.com/"}}
+	c.Assert(u.Validate(), IsNil)
+
+	u = &URL{InsteadOfs: []string{"https://github.com/"}}
+	c.Assert(u.Validate(), Equals, errURLEmptyName)
+
+	u = &URL{Name: "https://mirror.example.com/"}
+	c.Assert(u.Validate(), Equals, errURLEmptyInsteadOf)
+}
+
+func (b *URLSuite) TestUnmarshalMarshal(c *C) {
+	input := []byte(`[url "https://mirror.example.com/"]
+	insteadOf = https://github.com/
+	insteadOf = git@github.com:
+[url "ssh://git@example.com/"]
+	pushInsteadOf = https://example.com/
+`)
+
+	cfg := NewConfig()
+	c.Assert(cfg.Unmarshal(input), IsNil)
+	c.Assert(cfg.URLs, HasLen, 2)
+	c.Assert(cfg.URLs["https://mirror.example.com/"].InsteadOfs, DeepEquals, []string{
+		"https://github.com/",
+		"git@github.com:",
+	})
+	c.Assert(cfg.URLs["ssh://git@example.com/"].PushInsteadOfs, DeepEquals, []string{
+		"https://example.com/",
+	})
+
+	cfg.URLs["https://mirror.example.com/"].InsteadOfs = []string{"https://github.com/"}
+	cfg.URLs["file:///srv/"] = &URL{Name: "file:///srv/", InsteadOfs: []string{"local:"}}
+
+	output, err := cfg.Marshal()
+	c.Assert(err, IsNil)
+	c.Assert(string(output), Equals, `[url "https://mirror.example.com/"]
+	insteadOf = https://github.com/
+[url "ssh://git@example.com/"]
+	pushInsteadOf = https://example.com/
+[url "file:///srv/"]
+	insteadOf = local:
+[core]
+	bare = false
+`)
+}
+
+func (b *URLSuite) TestRewriteURL(c *C) {
+	cfg := NewConfig()
+	cfg.URLs["https://mirror.example.com/"] = &URL{
+		Name:       "https://mirror.example.com/",
+		InsteadOfs: []string{"https://github.com/"},
+	}
+	cfg.URLs["https://internal.example.com/src-d/"] = &URL{
+		Name:       "https://internal.example.com/src-d/",
+		InsteadOfs: []string{"https://github.com/src-d/"},
+	}
+	cfg.URLs["ssh://git@github.com/"] = &URL{
+		Name:           "ssh://git@github.com/",
+		PushInsteadOfs: []string{"https://github.com/"},
+	}
+
+	c.Assert(cfg.RewriteURL("https://github.com/git-fixtures/basic.git"), Equals,
+		"https://mirror.example.com/git-fixtures/basic.git")
+	c.Assert(cfg.RewriteURL("https://github.com/src-d/go-git.git"), Equals,
+		"https://internal.example.com/src-d/go-git.git")
+	c.Assert(cfg.RewriteURL("https://example.com/foo.git"), Equals,
+		"https://example.com/foo.git")
+
+	c.Assert(cfg.RewritePushURL("https://github.com/src-d/go-git.git"), Equals,
+		"ssh://git@github.com/src-d/go-git.git")
+	c.Assert(cfg.RewritePushURL("git@example.com:foo.git"), Equals,
+		"git@example.com:foo.git")
+
+	delete(cfg.URLs, "ssh://git@github.com/")
+	c.Assert(cfg.RewritePushURL("https://github.com/src-d/go-git.git"), Equals,
+		"https://internal.example.com/src-d/go-git.git")
+}
@@ -0,0 +1,152 @@
+package git
+
+import (
+	"context"
+	"io"
+	stdhttp "net/http"
+	"net/url"
+	"os"
+
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/bundle"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+)
+
+// fetchBundleURI downloads the bundle of the FetchOptions or the
+// fetch.bundleURI config option, if any, and stores its objects. The tips of
+// the bundle become haves of the resume, so the fetch from the remote only
+// transfers the objects missing in the bundle.
+//
+// Only the bundles set by the client are used. The bundle-uri command and the
+// packfile-uris section, advertised by the server, are part of the protocol
+// v2, which isn't implemented by the transports yet.
+func (r *Remote) fetchBundleURI(ctx context.Context, cfg *config.Config, o *FetchOptions, fr *fetchResume) error {
+	uri := o.BundleURI
+	if uri == "" {
+		uri = cfg.Fetch.BundleURI
+	}
+
+	if uri == "" {
+		return nil
+	}
+
+	return retry(ctx, o.Retry, func() error {
+		rc, err := openBundleURI(ctx, cfg, uri)
+		if err != nil {
+			return err
+		}
+
+		defer rc.Close()
+
+		refs, err := r.unbundle(rc)
+		if err != nil {
+			return err
+		}
+
+		for _, ref := range refs {
+			fr.haves = append(fr.haves, ref.Hash())
+		}
+
+		return nil
+	})
+}
+
+// unbundle stores the objects of the bundle read from rd and returns its
+// references.
+func (r *Remote) unbundle(rd io.Reader) ([]*plumbing.Reference, error) {
+	b := bundle.New()
+	if err := bundle.NewDecoder(rd).Decode(b); err != nil {
+		return nil, err
+	}
+
+	if err := checkPrerequisites(r.s, b.Prerequisites, nil); err != nil {
+		return nil, err
+	}
+
+	if err := packfile.UpdateObjectStorage(r.s, b.Packfile); err != nil {
+		return nil, err
+	}
+
+	return b.References, nil
+}
+
+// prerequisitesSession is implemented by the upload-pack sessions that can't
+// negotiate their packfile, such as the bundle ones, and require the fetching
+// repository to have some commits.
+type prerequisitesSession interface {
+	Prerequisites() []bundle.Prerequisite
+}
+
+// checkPrerequisites returns a *MissingPrerequisitesError if some of the
+// prerequisites is neither in haves nor in the storer.
+func checkPrerequisites(s storer.EncodedObjectStorer, prerequisites []bundle.Prerequisite,
+	haves []plumbing.Hash) error {
+
+	has := make(map[plumbing.Hash]bool, len(haves))
+	for _, h := range haves {
+		has[h] = true
+	}
+
+	var missing []bundle.Prerequisite
+	for _, p := range prerequisites {
+		if has[p.Hash] {
+			continue
+		}
+
+		ok, err := objectExists(s, p.Hash)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			missing = append(missing, p)
+		}
+	}
+
+	if len(missing) != 0 {
+		return &MissingPrerequisitesError{Prerequisites: missing}
+	}
+
+	return nil
+}
+
+// openBundleURI opens the bundle at the given URI, an HTTP URL, downloaded
+// with the http.* options of the config, or a local path.
+func openBundleURI(ctx context.Context, cfg *config.Config, uri string) (io.ReadCloser, error) {
+	u, err := url.Parse(uri)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		if err == nil && u.Scheme == "file" {
+			uri = u.Path
+		}
+
+		return os.Open(uri)
+	}
+
+	c := stdhttp.DefaultClient
+	if cfg.Raw != nil {
+		c, err = http.NewConfig(cfg.Raw, u).Client(nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := stdhttp.NewRequest(stdhttp.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := http.NewErr(res); err != nil {
+		_ = res.Body.Close()
+		return nil, err
+	}
+
+	return res.Body, nil
+}
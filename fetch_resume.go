@@ -0,0 +1,275 @@
+package git
+
+import (
+	"context"
+	"io"
+	stdioutil "io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+// retry calls f until it succeeds, it fails with a non transient error or the
+// retries are exhausted, waiting between the calls with an exponential
+// backoff.
+func retry(ctx context.Context, o RetryOptions, f func() error) error {
+	backoff := o.InitialBackoff
+	for i := 0; ; i++ {
+		err := f()
+		if err == nil || i >= o.MaxRetries || !isTransientError(err) {
+			return err
+		}
+
+		t := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+
+		backoff *= 2
+		if backoff > o.MaxBackoff {
+			backoff = o.MaxBackoff
+		}
+	}
+}
+
+// isTransientError returns true if the error may not happen again retrying
+// the operation: network errors, connections closed in the middle of a
+// transfer and server errors.
+func isTransientError(err error) bool {
+	switch err {
+	case io.EOF, io.ErrUnexpectedEOF:
+		return true
+	case context.Canceled, context.DeadlineExceeded:
+		return false
+	}
+
+	switch e := err.(type) {
+	case *plumbing.UnexpectedError:
+		return isTransientError(e.Err)
+	case *url.Error:
+		return isTransientError(e.Err)
+	case net.Error:
+		return true
+	case interface{ StatusCode() int }:
+		code := e.StatusCode()
+		return code >= 500 || code == 408 || code == 429
+	}
+
+	return false
+}
+
+// fetchResume keeps track of the objects stored by the interrupted transfers
+// of a fetch and by the bundles, so the retries only fetch the missing ones.
+type fetchResume struct {
+	// haves are commits whose objects are all stored, announced to the
+	// remote as haves.
+	haves []plumbing.Hash
+	// received are the objects stored by the interrupted transfers.
+	received map[plumbing.Hash]bool
+	// complete caches if the received objects have all the objects they
+	// reference stored.
+	complete map[plumbing.Hash]bool
+	// shallow are the shallow commits, whose parents aren't required.
+	shallow map[plumbing.Hash]bool
+}
+
+func newFetchResume() *fetchResume {
+	return &fetchResume{
+		received: make(map[plumbing.Hash]bool),
+		complete: make(map[plumbing.Hash]bool),
+	}
+}
+
+// recover stores the objects of a truncated packfile, the received commits
+// whose history is complete become haves.
+func (fr *fetchResume) recover(s storage.Storer, pack io.Reader) error {
+	hashes, err := packfile.RecoverObjects(s, pack)
+	if err != nil {
+		return err
+	}
+
+	for _, h := range hashes {
+		fr.received[h] = true
+	}
+
+	// the objects missing before may have been received now
+	fr.complete = make(map[plumbing.Hash]bool)
+
+	shallows, err := s.Shallow()
+	if err != nil {
+		return err
+	}
+
+	fr.shallow = make(map[plumbing.Hash]bool)
+	for _, h := range shallows {
+		fr.shallow[h] = true
+	}
+
+	var commits []*object.Commit
+	for _, h := range hashes {
+		c, err := object.GetCommit(s, h)
+		if err != nil {
+			continue
+		}
+
+		ok, err := fr.isComplete(s, h)
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			commits = append(commits, c)
+		}
+	}
+
+	// the parents are implied by their children
+	parents := make(map[plumbing.Hash]bool)
+	for _, c := range commits {
+		for _, p := range c.ParentHashes {
+			parents[p] = true
+		}
+	}
+
+	for _, c := range commits {
+		if !parents[c.Hash] {
+			fr.haves = append(fr.haves, c.Hash)
+		}
+	}
+
+	return nil
+}
+
+// isComplete returns true if all the objects reachable from h are stored. The
+// objects not received by the interrupted transfers are considered complete
+// if they are stored, as any other object present before the fetch.
+func (fr *fetchResume) isComplete(s storage.Storer, h plumbing.Hash) (bool, error) {
+	if complete, ok := fr.complete[h]; ok {
+		return complete, nil
+	}
+
+	if !fr.received[h] {
+		return objectExists(s, h)
+	}
+
+	obj, err := object.GetObject(s, h)
+	if err != nil {
+		return false, err
+	}
+
+	var refs []plumbing.Hash
+	switch o := obj.(type) {
+	case *object.Commit:
+		refs = append(refs, o.TreeHash)
+		if !fr.shallow[h] {
+			refs = append(refs, o.ParentHashes...)
+		}
+	case *object.Tree:
+		for _, e := range o.Entries {
+			if e.Mode != filemode.Submodule {
+				refs = append(refs, e.Hash)
+			}
+		}
+	case *object.Tag:
+		refs = append(refs, o.Target)
+	}
+
+	complete := true
+	for _, ref := range refs {
+		ok, err := fr.isComplete(s, ref)
+		if err != nil {
+			return false, err
+		}
+
+		if !ok {
+			complete = false
+			break
+		}
+	}
+
+	fr.complete[h] = complete
+	return complete, nil
+}
+
+// incomplete returns the hashes of the references whose objects were
+// partially received, so they must be fetched even if they are stored.
+func (fr *fetchResume) incomplete(s storage.Storer, refs memory.ReferenceStorage) ([]plumbing.Hash, error) {
+	var result []plumbing.Hash
+	for _, h := range refsToHashes(refs) {
+		if !fr.received[h] {
+			continue
+		}
+
+		ok, err := fr.isComplete(s, h)
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			result = append(result, h)
+		}
+	}
+
+	return result, nil
+}
+
+// addHaves returns the given haves along with the ones of the resume.
+func (fr *fetchResume) addHaves(haves []plumbing.Hash) []plumbing.Hash {
+	seen := make(map[plumbing.Hash]bool)
+	for _, h := range haves {
+		seen[h] = true
+	}
+
+	for _, h := range fr.haves {
+		if !seen[h] {
+			seen[h] = true
+			haves = append(haves, h)
+		}
+	}
+
+	return haves
+}
+
+// packSpool keeps a copy of a packfile being received in a temporary file,
+// to recover its objects if the transfer is interrupted.
+type packSpool struct {
+	*os.File
+}
+
+func newPackSpool() (*packSpool, error) {
+	f, err := stdioutil.TempFile("", "go-git-fetch-pack-")
+	if err != nil {
+		return nil, err
+	}
+
+	return &packSpool{f}, nil
+}
+
+// recover stores the objects received, see fetchResume.recover.
+func (p *packSpool) recover(s storage.Storer, fr *fetchResume) error {
+	if _, err := p.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	return fr.recover(s, p.File)
+}
+
+// Close closes and removes the temporary file.
+func (p *packSpool) Close() error {
+	err := p.File.Close()
+	if rerr := os.Remove(p.Name()); err == nil {
+		err = rerr
+	}
+
+	return err
+}
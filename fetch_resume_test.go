@@ -0,0 +1,265 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+	"gopkg.in/src-d/go-git.v4/plumbing/revlist"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/client"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/server"
+	"gopkg.in/src-d/go-git.v4/storage"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	fixtures "gopkg.in/src-d/go-git-fixtures.v3"
+)
+
+const flakyURL = "flaky:///basic.git"
+
+// flakyTransport serves the basic fixture, truncating the packfiles of the
+// first uploads.
+type flakyTransport struct {
+	transport.Transport
+	// cuts are the lengths of the packfiles sent by the first uploads, the
+	// following ones are complete.
+	cuts []func(n int) int
+	// requests are the upload requests received.
+	requests []*packp.UploadPackRequest
+	// sessions is the number of sessions opened.
+	sessions int
+}
+
+func newFlakyTransport(c *C, cuts ...func(n int) int) *flakyTransport {
+	ep, err := transport.NewEndpoint(flakyURL)
+	c.Assert(err, IsNil)
+
+	sto := filesystem.NewStorage(fixtures.Basic().One().DotGit(), cache.NewObjectLRUDefault())
+	t := &flakyTransport{
+		Transport: server.NewClient(server.MapLoader{ep.String(): sto}),
+		cuts:      cuts,
+	}
+
+	client.InstallProtocol("flaky", t)
+	return t
+}
+
+func (t *flakyTransport) NewUploadPackSession(ep *transport.Endpoint, auth transport.AuthMethod) (
+	transport.UploadPackSession, error) {
+
+	s, err := t.Transport.NewUploadPackSession(ep, auth)
+	if err != nil {
+		return nil, err
+	}
+
+	t.sessions++
+	return &flakySession{UploadPackSession: s, t: t}, nil
+}
+
+type flakySession struct {
+	transport.UploadPackSession
+	t *flakyTransport
+}
+
+func (s *flakySession) UploadPack(ctx context.Context, req *packp.UploadPackRequest) (
+	*packp.UploadPackResponse, error) {
+
+	s.t.requests = append(s.t.requests, req)
+	res, err := s.UploadPackSession.UploadPack(ctx, req)
+	if err != nil || len(s.t.cuts) == 0 {
+		return res, err
+	}
+
+	cut := s.t.cuts[0]
+	s.t.cuts = s.t.cuts[1:]
+
+	pack, err := ioutil.ReadAll(res)
+	if err != nil {
+		return nil, err
+	}
+
+	r := io.MultiReader(
+		bytes.NewReader(pack[:cut(len(pack))]),
+		&errorReader{&net.OpError{Op: "read", Net: "tcp", Err: io.ErrUnexpectedEOF}},
+	)
+
+	return packp.NewUploadPackResponseWithPackfile(req, ioutil.NopCloser(r)), nil
+}
+
+type errorReader struct {
+	err error
+}
+
+func (r *errorReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+type FetchResumeSuite struct {
+	BaseSuite
+}
+
+var _ = Suite(&FetchResumeSuite{})
+
+func (s *FetchResumeSuite) TearDownTest(c *C) {
+	client.InstallProtocol("flaky", nil)
+}
+
+func (s *FetchResumeSuite) fetch(c *C, sto storage.Storer, o *FetchOptions) error {
+	r := NewRemote(sto, &config.RemoteConfig{
+		Name: DefaultRemoteName,
+		URLs: []string{flakyURL},
+	})
+
+	o.RefSpecs = []config.RefSpec{"+refs/heads/*:refs/remotes/origin/*"}
+	o.Retry.InitialBackoff = time.Millisecond
+	return r.Fetch(o)
+}
+
+func (s *FetchResumeSuite) assertComplete(c *C, sto storage.Storer) {
+	for _, name := range []string{"master", "branch"} {
+		ref, err := sto.Reference(plumbing.NewRemoteReferenceName(DefaultRemoteName, name))
+		c.Assert(err, IsNil)
+
+		_, err = revlist.Objects(sto, []plumbing.Hash{ref.Hash()}, nil)
+		c.Assert(err, IsNil)
+	}
+}
+
+func half(n int) int { return n / 2 }
+
+func (s *FetchResumeSuite) TestFetchNoRetry(c *C) {
+	newFlakyTransport(c, half)
+
+	err := s.fetch(c, memory.NewStorage(), &FetchOptions{})
+	c.Assert(err, NotNil)
+}
+
+func (s *FetchResumeSuite) TestFetchRetry(c *C) {
+	t := newFlakyTransport(c, half, half)
+
+	sto := memory.NewStorage()
+	err := s.fetch(c, sto, &FetchOptions{Retry: RetryOptions{MaxRetries: 2}})
+	c.Assert(err, IsNil)
+	c.Assert(t.sessions, Equals, 3)
+	c.Assert(t.requests, HasLen, 3)
+	s.assertComplete(c, sto)
+}
+
+func (s *FetchResumeSuite) TestFetchRetryExhausted(c *C) {
+	t := newFlakyTransport(c, half, half)
+
+	err := s.fetch(c, memory.NewStorage(), &FetchOptions{Retry: RetryOptions{MaxRetries: 1}})
+	c.Assert(err, NotNil)
+	c.Assert(t.requests, HasLen, 2)
+}
+
+func (s *FetchResumeSuite) TestFetchRetryResume(c *C) {
+	// all the objects are received, only the checksum is missing
+	t := newFlakyTransport(c, func(n int) int { return n - 20 })
+
+	sto := filesystem.NewStorage(osfs.New(c.MkDir()), cache.NewObjectLRUDefault())
+	err := s.fetch(c, sto, &FetchOptions{Retry: RetryOptions{MaxRetries: 1}})
+	c.Assert(err, IsNil)
+	c.Assert(t.sessions, Equals, 2)
+	c.Assert(t.requests, HasLen, 1)
+	s.assertComplete(c, sto)
+}
+
+func (s *FetchResumeSuite) TestRecover(c *C) {
+	src := filesystem.NewStorage(fixtures.Basic().One().DotGit(), cache.NewObjectLRUDefault())
+	master := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	branch := plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881")
+
+	// the history of master is complete, but the tree of branch is missing
+	objs, err := revlist.Objects(src, []plumbing.Hash{master}, nil)
+	c.Assert(err, IsNil)
+	objs = append(objs, branch)
+
+	pack := bytes.NewBuffer(nil)
+	_, err = packfile.NewEncoder(pack, src, false).Encode(objs, 10)
+	c.Assert(err, IsNil)
+
+	sto := memory.NewStorage()
+	fr := newFetchResume()
+	c.Assert(fr.recover(sto, pack), IsNil)
+	c.Assert(fr.haves, DeepEquals, []plumbing.Hash{master})
+
+	refs := memory.ReferenceStorage{}
+	c.Assert(refs.SetReference(plumbing.NewHashReference("refs/heads/master", master)), IsNil)
+	c.Assert(refs.SetReference(plumbing.NewHashReference("refs/heads/branch", branch)), IsNil)
+
+	incomplete, err := fr.incomplete(sto, refs)
+	c.Assert(err, IsNil)
+	c.Assert(incomplete, DeepEquals, []plumbing.Hash{branch})
+}
+
+func (s *FetchResumeSuite) TestFetchBundleURI(c *C) {
+	t := newFlakyTransport(c)
+
+	bundle := filepath.Join(c.MkDir(), "basic.bundle")
+	f, err := os.Create(bundle)
+	c.Assert(err, IsNil)
+
+	r := s.NewRepositoryWithEmptyWorktree(fixtures.Basic().One())
+	c.Assert(r.CreateBundle(f, []plumbing.ReferenceName{"refs/heads/master"}, nil), IsNil)
+	c.Assert(f.Close(), IsNil)
+
+	sto := memory.NewStorage()
+	err = s.fetch(c, sto, &FetchOptions{BundleURI: bundle})
+	c.Assert(err, IsNil)
+	c.Assert(t.requests, HasLen, 1)
+	c.Assert(t.requests[0].Haves, DeepEquals, []plumbing.Hash{
+		plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+	})
+	s.assertComplete(c, sto)
+}
+
+func (s *FetchResumeSuite) TestFetchBundleURINotFound(c *C) {
+	t := newFlakyTransport(c)
+
+	progress := bytes.NewBuffer(nil)
+	sto := memory.NewStorage()
+	err := s.fetch(c, sto, &FetchOptions{
+		BundleURI: filepath.Join(c.MkDir(), "missing.bundle"),
+		Progress:  progress,
+	})
+	c.Assert(err, IsNil)
+	c.Assert(t.requests, HasLen, 1)
+	c.Assert(progress.String(), Matches, "warning: failed to fetch the bundle: .*\n")
+	s.assertComplete(c, sto)
+}
+
+func (s *FetchResumeSuite) TestIsTransientError(c *C) {
+	c.Assert(isTransientError(io.ErrUnexpectedEOF), Equals, true)
+	c.Assert(isTransientError(&net.OpError{Op: "dial", Err: io.EOF}), Equals, true)
+	c.Assert(isTransientError(plumbing.NewUnexpectedError(io.EOF)), Equals, true)
+	c.Assert(isTransientError(transport.ErrAuthenticationRequired), Equals, false)
+	c.Assert(isTransientError(transport.ErrRepositoryNotFound), Equals, false)
+	c.Assert(isTransientError(context.Canceled), Equals, false)
+}
+
+func (s *FetchResumeSuite) TestRetryContext(c *C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var calls int
+	err := retry(ctx, RetryOptions{MaxRetries: 3, InitialBackoff: time.Hour}, func() error {
+		calls++
+		return io.ErrUnexpectedEOF
+	})
+	c.Assert(err, Equals, context.Canceled)
+	c.Assert(calls, Equals, 1)
+}
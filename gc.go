@@ -0,0 +1,703 @@
+package git
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/reflog"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+// ErrInvalidExpireDate is returned when a gc expiry config option isn't a
+// valid date.
+var ErrInvalidExpireDate = errors.New("invalid expire date")
+
+// GCOptions describes how a garbage collection is performed.
+type GCOptions struct {
+	// Auto if true, the garbage collection is only performed if the
+	// repository needs one, as reported by NeedsGC.
+	Auto bool
+	// PruneExpire if set to non-zero value, the unreachable objects older
+	// than it are pruned. Otherwise the gc.pruneExpire config option is used.
+	PruneExpire time.Time
+	// ReflogExpire if set to non-zero value, the reflog entries older than
+	// it are removed. Otherwise the gc.reflogExpire config option is used.
+	ReflogExpire time.Time
+	// ReflogExpireUnreachable if set to non-zero value, the reflog entries
+	// older than it, and not reachable from the current value of their
+	// reference, are removed. Otherwise the gc.reflogExpireUnreachable
+	// config option is used.
+	ReflogExpireUnreachable time.Time
+}
+
+// GC performs a garbage collection of the repository, as git gc does: packs
+// the references, expires the reflogs, repacks all the reachable objects,
+// loose and packed, into one pack reusing the existing deltas, removes the
+// redundant packs and prunes the unreachable loose objects older than the
+// prune expiry. The packs marked to be kept, with a .keep file, are left
+// untouched.
+//
+// The objects reachable from the reflogs and the index are kept too. The
+// unreachable objects not older than the prune expiry, and the ones they
+// refer to, are written into a cruft pack recording the modification time of
+// each of them, so they are pruned by a later GC once they expire, or packed
+// along with the reachable objects if they become reachable again. If the
+// gc.cruftPacks config option is false, or the storage doesn't support cruft
+// packs, the ones of the removed packs are written as loose objects instead.
+func (r *Repository) GC(o *GCOptions) error {
+	if o == nil {
+		o = &GCOptions{}
+	}
+
+	if o.Auto {
+		needs, err := r.NeedsGC()
+		if err != nil || !needs {
+			return err
+		}
+	}
+
+	los, ok := r.Storer.(storer.LooseObjectStorer)
+	if !ok {
+		return ErrLooseObjectsNotSupported
+	}
+
+	pos, ok := r.Storer.(storer.PackedObjectStorer)
+	if !ok {
+		return ErrPackedObjectsNotSupported
+	}
+
+	pis, ok := r.Storer.(storer.ObjectPackInfoStorer)
+	if !ok {
+		return ErrPackedObjectsNotSupported
+	}
+
+	cfg, err := r.Storer.Config()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	pruneExpire, err := gcExpireDate(o.PruneExpire, cfg.GC.PruneExpire, now)
+	if err != nil {
+		return err
+	}
+
+	reflogExpire, err := gcExpireDate(o.ReflogExpire, cfg.GC.ReflogExpire, now)
+	if err != nil {
+		return err
+	}
+
+	reflogExpireUnreachable, err := gcExpireDate(o.ReflogExpireUnreachable, cfg.GC.ReflogExpireUnreachable, now)
+	if err != nil {
+		return err
+	}
+
+	if err := r.Storer.PackRefs(); err != nil {
+		return err
+	}
+
+	if err := r.expireReflogs(reflogExpire, reflogExpireUnreachable); err != nil {
+		return err
+	}
+
+	ow := newObjectWalker(r.Storer)
+	if err := r.walkGCRoots(ow); err != nil {
+		return err
+	}
+
+	hs, err := pos.ObjectPacks()
+	if err != nil {
+		return err
+	}
+
+	var packs []plumbing.Hash
+	kept := make(map[plumbing.Hash]struct{})
+	for _, h := range hs {
+		isKept, err := pis.ObjectPackKept(h)
+		if err != nil {
+			return err
+		}
+
+		if !isKept {
+			packs = append(packs, h)
+			continue
+		}
+
+		objs, err := pis.ObjectPackHashes(h)
+		if err != nil {
+			return err
+		}
+
+		for _, oh := range objs {
+			kept[oh] = struct{}{}
+		}
+	}
+
+	nh, err := r.packObjects(ow, kept, &RepackConfig{})
+	if err != nil {
+		return err
+	}
+
+	if cps, ok := r.Storer.(storer.CruftPackStorer); ok && cfg.GC.CruftPacks {
+		err = r.writeCruftPack(los, pos, pis, cps, packs, nh, ow, kept, pruneExpire)
+	} else {
+		err = r.unpackUnreachable(los, pos, pis, packs, nh, ow, kept, pruneExpire)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return r.updateMultiPackIndex(&RepackConfig{})
+}
+
+// NeedsGC returns whether the repository needs a garbage collection, as git
+// gc --auto does, because it has more loose objects than the gc.auto config
+// option or more packs, not counting the kept and cruft ones, than
+// gc.autoPackLimit.
+// It's meant to be checked after operations creating objects, such as
+// fetches, see FetchOptions.AutoGC.
+func (r *Repository) NeedsGC() (bool, error) {
+	cfg, err := r.Storer.Config()
+	if err != nil {
+		return false, err
+	}
+
+	if cfg.GC.Auto <= 0 {
+		return false, nil
+	}
+
+	// A storage not supporting GC never needs one.
+	los, ok := r.Storer.(storer.LooseObjectStorer)
+	if !ok {
+		return false, nil
+	}
+
+	pos, ok := r.Storer.(storer.PackedObjectStorer)
+	if !ok {
+		return false, nil
+	}
+
+	pis, ok := r.Storer.(storer.ObjectPackInfoStorer)
+	if !ok {
+		return false, nil
+	}
+
+	var loose int
+	err = los.ForEachObjectHash(func(plumbing.Hash) error {
+		loose++
+		if loose > cfg.GC.Auto {
+			return storer.ErrStop
+		}
+
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if loose > cfg.GC.Auto {
+		return true, nil
+	}
+
+	if cfg.GC.AutoPackLimit <= 0 {
+		return false, nil
+	}
+
+	hs, err := pos.ObjectPacks()
+	if err != nil {
+		return false, err
+	}
+
+	cps, _ := r.Storer.(storer.CruftPackStorer)
+
+	var packs int
+	for _, h := range hs {
+		isKept, err := pis.ObjectPackKept(h)
+		if err != nil {
+			return false, err
+		}
+
+		isCruft, err := isCruftPack(cps, h)
+		if err != nil {
+			return false, err
+		}
+
+		if !isKept && !isCruft {
+			packs++
+		}
+	}
+
+	return packs > cfg.GC.AutoPackLimit, nil
+}
+
+// walkGCRoots walks the objects reachable from the references, the reflogs
+// and the index.
+func (r *Repository) walkGCRoots(ow *objectWalker) error {
+	if err := ow.walkAllRefs(); err != nil {
+		return err
+	}
+
+	if rs, ok := r.Storer.(storer.ReflogStorer); ok {
+		names, err := rs.ReflogReferences()
+		if err != nil {
+			return err
+		}
+
+		for _, name := range names {
+			entries, err := rs.Reflog(name)
+			if err != nil {
+				return err
+			}
+
+			for _, e := range entries {
+				if err := r.walkGCRoot(ow, e.Old); err != nil {
+					return err
+				}
+
+				if err := r.walkGCRoot(ow, e.New); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	for _, e := range idx.Entries {
+		if e.Mode == filemode.Submodule {
+			continue
+		}
+
+		if err := r.walkGCRoot(ow, e.Hash); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// walkGCRoot walks the objects reachable from h, if it exists, since the
+// reflogs and the index may refer to missing objects.
+func (r *Repository) walkGCRoot(ow *objectWalker, h plumbing.Hash) error {
+	if h.IsZero() || ow.isSeen(h) || r.Storer.HasEncodedObject(h) != nil {
+		return nil
+	}
+
+	return ow.walkObjectTree(h)
+}
+
+// unpackUnreachable writes as loose objects the unreachable objects of the
+// given packs not older than the prune expiry, so they aren't lost when the
+// packs are removed, and prunes the unreachable loose objects older than it.
+func (r *Repository) unpackUnreachable(los storer.LooseObjectStorer, pos storer.PackedObjectStorer,
+	pis storer.ObjectPackInfoStorer, packs []plumbing.Hash, nh plumbing.Hash,
+	ow *objectWalker, kept map[plumbing.Hash]struct{}, pruneExpire time.Time) error {
+	for _, h := range packs {
+		if h == nh {
+			continue
+		}
+
+		times, err := r.objectPackTimes(pis, h)
+		if err != nil {
+			return err
+		}
+
+		for oh, t := range times {
+			if _, ok := kept[oh]; ok || ow.isSeen(oh) {
+				continue
+			}
+
+			if !pruneExpire.IsZero() && t.Before(pruneExpire) {
+				continue
+			}
+
+			obj, err := r.Storer.EncodedObject(plumbing.AnyObject, oh)
+			if err != nil {
+				return err
+			}
+
+			if _, err := r.Storer.SetEncodedObject(obj); err != nil {
+				return err
+			}
+		}
+
+		if err := pos.DeleteOldObjectPackAndIndex(h, time.Time{}); err != nil {
+			return err
+		}
+	}
+
+	if pruneExpire.IsZero() {
+		return nil
+	}
+
+	return los.ForEachObjectHash(func(h plumbing.Hash) error {
+		if ow.isSeen(h) {
+			return nil
+		}
+
+		// Errors here are non-fatal, as in Prune.
+		t, err := los.LooseObjectTime(h)
+		if err != nil || !t.Before(pruneExpire) {
+			return nil
+		}
+
+		return los.DeleteLooseObject(h)
+	})
+}
+
+// writeCruftPack writes into a cruft pack the unreachable objects, loose or
+// of the given packs, not older than the prune expiry, along with the
+// unreachable objects they refer to, and removes the packs and the unreachable
+// loose objects. The modification time of each object is the one of its loose
+// object or pack, or the one recorded by its cruft pack, the newest if it's
+// in several of them.
+func (r *Repository) writeCruftPack(los storer.LooseObjectStorer, pos storer.PackedObjectStorer,
+	pis storer.ObjectPackInfoStorer, cps storer.CruftPackStorer, packs []plumbing.Hash, nh plumbing.Hash,
+	ow *objectWalker, kept map[plumbing.Hash]struct{}, pruneExpire time.Time) error {
+	unreachable := make(map[plumbing.Hash]time.Time)
+	add := func(h plumbing.Hash, t time.Time) {
+		if _, ok := kept[h]; ok || ow.isSeen(h) {
+			return
+		}
+
+		if prev, ok := unreachable[h]; !ok || t.After(prev) {
+			unreachable[h] = t
+		}
+	}
+
+	for _, h := range packs {
+		if h == nh {
+			continue
+		}
+
+		times, err := r.objectPackTimes(pis, h)
+		if err != nil {
+			return err
+		}
+
+		for oh, t := range times {
+			add(oh, t)
+		}
+	}
+
+	loose := make(map[plumbing.Hash]time.Time)
+	err := los.ForEachObjectHash(func(h plumbing.Hash) error {
+		if ow.isSeen(h) {
+			return nil
+		}
+
+		// Errors here are non-fatal, as in Prune.
+		t, err := los.LooseObjectTime(h)
+		if err != nil {
+			return nil
+		}
+
+		loose[h] = t
+		add(h, t)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	cruft, err := r.cruftObjects(unreachable, pruneExpire)
+	if err != nil {
+		return err
+	}
+
+	var ch plumbing.Hash
+	if len(cruft) != 0 {
+		objs := make([]plumbing.Hash, 0, len(cruft))
+		for h := range cruft {
+			objs = append(objs, h)
+		}
+
+		if ch, err = r.encodeObjectPack(objs, &RepackConfig{}); err != nil {
+			return err
+		}
+
+		if err := cps.SetObjectPackMTimes(ch, cruft); err != nil {
+			return err
+		}
+	}
+
+	for _, h := range packs {
+		if h == nh || h == ch {
+			continue
+		}
+
+		if err := pos.DeleteOldObjectPackAndIndex(h, time.Time{}); err != nil {
+			return err
+		}
+	}
+
+	for h, t := range loose {
+		if _, ok := cruft[h]; !ok && (pruneExpire.IsZero() || !t.Before(pruneExpire)) {
+			continue
+		}
+
+		if err := los.DeleteLooseObject(h); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// cruftObjects returns the unreachable objects to keep in a cruft pack, with
+// their modification times: the ones not older than the prune expiry, and the
+// older ones referred by them, so none is missing if they become reachable
+// again.
+func (r *Repository) cruftObjects(unreachable map[plumbing.Hash]time.Time, pruneExpire time.Time) (map[plumbing.Hash]time.Time, error) {
+	cruft := make(map[plumbing.Hash]time.Time)
+	var pending []plumbing.Hash
+	for h, t := range unreachable {
+		if pruneExpire.IsZero() || !t.Before(pruneExpire) {
+			cruft[h] = t
+			pending = append(pending, h)
+		}
+	}
+
+	for len(pending) != 0 {
+		h := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		refs, err := r.objectReferences(h)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ref := range refs {
+			t, ok := unreachable[ref]
+			if !ok {
+				continue
+			}
+
+			if _, ok := cruft[ref]; ok {
+				continue
+			}
+
+			cruft[ref] = t
+			pending = append(pending, ref)
+		}
+	}
+
+	return cruft, nil
+}
+
+// objectReferences returns the hashes of the objects referred by the given
+// one: the tree and parents of a commit, the entries of a tree but the
+// submodules, and the target of a tag.
+func (r *Repository) objectReferences(h plumbing.Hash) ([]plumbing.Hash, error) {
+	obj, err := object.GetObject(r.Storer, h)
+	if err != nil {
+		return nil, err
+	}
+
+	switch obj := obj.(type) {
+	case *object.Commit:
+		return append([]plumbing.Hash{obj.TreeHash}, obj.ParentHashes...), nil
+	case *object.Tree:
+		refs := make([]plumbing.Hash, 0, len(obj.Entries))
+		for _, e := range obj.Entries {
+			if e.Mode != filemode.Submodule {
+				refs = append(refs, e.Hash)
+			}
+		}
+
+		return refs, nil
+	case *object.Tag:
+		return []plumbing.Hash{obj.Target}, nil
+	}
+
+	return nil, nil
+}
+
+// isCruftPack returns whether the given pack is a cruft pack, false if the
+// storage doesn't support them.
+func isCruftPack(cps storer.CruftPackStorer, pack plumbing.Hash) (bool, error) {
+	if cps == nil {
+		return false, nil
+	}
+
+	times, err := cps.ObjectPackMTimes(pack)
+	return times != nil, err
+}
+
+// objectPackTimes returns the modification times of the objects of the given
+// pack, the ones recorded if it's a cruft pack, or the time of the pack.
+func (r *Repository) objectPackTimes(pis storer.ObjectPackInfoStorer, pack plumbing.Hash) (map[plumbing.Hash]time.Time, error) {
+	if cps, ok := r.Storer.(storer.CruftPackStorer); ok {
+		times, err := cps.ObjectPackMTimes(pack)
+		if err != nil || times != nil {
+			return times, err
+		}
+	}
+
+	t, err := pis.ObjectPackTime(pack)
+	if err != nil {
+		return nil, err
+	}
+
+	hs, err := pis.ObjectPackHashes(pack)
+	if err != nil {
+		return nil, err
+	}
+
+	times := make(map[plumbing.Hash]time.Time, len(hs))
+	for _, h := range hs {
+		times[h] = t
+	}
+
+	return times, nil
+}
+
+// expireReflogs removes the reflog entries older than expire, or than
+// unreachable if they aren't reachable from the current value of their
+// reference. A zero time expires nothing.
+func (r *Repository) expireReflogs(expire, unreachable time.Time) error {
+	rs, ok := r.Storer.(storer.ReflogStorer)
+	if !ok {
+		return nil
+	}
+
+	names, err := rs.ReflogReferences()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		entries, err := rs.Reflog(name)
+		if err != nil {
+			return err
+		}
+
+		var tip *object.Commit
+		ref, err := storer.ResolveReference(r.Storer, name)
+		if err == nil {
+			tip, _ = object.GetCommit(r.Storer, ref.Hash())
+		} else if err != plumbing.ErrReferenceNotFound {
+			return err
+		}
+
+		var keep []*reflog.Entry
+		for _, e := range entries {
+			expired, err := r.isReflogEntryExpired(e, tip, expire, unreachable)
+			if err != nil {
+				return err
+			}
+
+			if !expired {
+				keep = append(keep, e)
+			}
+		}
+
+		if len(keep) == len(entries) {
+			continue
+		}
+
+		if err := rs.SetReflog(name, keep); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *Repository) isReflogEntryExpired(e *reflog.Entry, tip *object.Commit, expire, unreachable time.Time) (bool, error) {
+	if !expire.IsZero() && e.When.Before(expire) {
+		return true, nil
+	}
+
+	if unreachable.IsZero() || !e.When.Before(unreachable) {
+		return false, nil
+	}
+
+	if tip == nil {
+		return true, nil
+	}
+
+	if e.New == tip.Hash {
+		return false, nil
+	}
+
+	// Missing objects, or not commits, are unreachable.
+	c, err := object.GetCommit(r.Storer, e.New)
+	if err != nil {
+		return true, nil
+	}
+
+	reachable, err := c.IsAncestor(tip)
+	return !reachable, err
+}
+
+// gcExpireDate returns the given date, or the one of the config option if
+// it's zero. The zero time is returned for never.
+func gcExpireDate(date time.Time, option string, now time.Time) (time.Time, error) {
+	if !date.IsZero() {
+		return date, nil
+	}
+
+	return parseExpireDate(option, now)
+}
+
+var expireDateUnits = map[string]time.Duration{
+	"second": time.Second,
+	"minute": time.Minute,
+	"hour":   time.Hour,
+	"day":    24 * time.Hour,
+	"week":   7 * 24 * time.Hour,
+	"month":  30 * 24 * time.Hour,
+	"year":   365 * 24 * time.Hour,
+}
+
+// parseExpireDate parses the dates of the expiry config options: "now",
+// "never", relative dates such as "2.weeks.ago" or "3 days ago", and
+// absolute dates such as "2006-01-02". The zero time is returned for never.
+func parseExpireDate(v string, now time.Time) (time.Time, error) {
+	v = strings.TrimSpace(v)
+	switch strings.ToLower(v) {
+	case "never", "false":
+		return time.Time{}, nil
+	case "now", "all":
+		return now, nil
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, v, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	fields := strings.FieldsFunc(strings.ToLower(v), func(r rune) bool {
+		return r == '.' || r == ' '
+	})
+	if len(fields) == 3 && fields[2] == "ago" {
+		fields = fields[:2]
+	}
+
+	if len(fields) != 2 {
+		return time.Time{}, ErrInvalidExpireDate
+	}
+
+	n, err := strconv.Atoi(fields[0])
+	if err != nil || n < 0 {
+		return time.Time{}, ErrInvalidExpireDate
+	}
+
+	unit, ok := expireDateUnits[strings.TrimSuffix(fields[1], "s")]
+	if !ok {
+		return time.Time{}, ErrInvalidExpireDate
+	}
+
+	return now.Add(-time.Duration(n) * unit), nil
+}
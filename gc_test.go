@@ -0,0 +1,391 @@
+package git
+
+import (
+	"os"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/reflog"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-billy.v4/util"
+	"gopkg.in/src-d/go-git-fixtures.v3"
+)
+
+type GCSuite struct {
+	BaseSuite
+}
+
+var _ = Suite(&GCSuite{})
+
+func (s *GCSuite) looseObjects(c *C, r *Repository) []plumbing.Hash {
+	var hs []plumbing.Hash
+	err := r.Storer.(storer.LooseObjectStorer).ForEachObjectHash(func(h plumbing.Hash) error {
+		hs = append(hs, h)
+		return nil
+	})
+	c.Assert(err, IsNil)
+	return hs
+}
+
+func (s *GCSuite) objectPacks(c *C, r *Repository) []plumbing.Hash {
+	packs, err := r.Storer.(storer.PackedObjectStorer).ObjectPacks()
+	c.Assert(err, IsNil)
+	return packs
+}
+
+func (s *GCSuite) storeBlob(c *C, r *Repository, content string) plumbing.Hash {
+	obj := r.Storer.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	w, err := obj.Writer()
+	c.Assert(err, IsNil)
+	_, err = w.Write([]byte(content))
+	c.Assert(err, IsNil)
+	c.Assert(w.Close(), IsNil)
+
+	h, err := r.Storer.SetEncodedObject(obj)
+	c.Assert(err, IsNil)
+	return h
+}
+
+func (s *GCSuite) TestGC(c *C) {
+	r := s.NewRepository(fixtures.ByTag("unpacked").One())
+	c.Assert(s.objectPacks(c, r), HasLen, 2)
+	c.Assert(len(s.looseObjects(c, r)) > 0, Equals, true)
+
+	unreachable := s.storeBlob(c, r, "unreachable")
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+
+	err = r.GC(&GCOptions{PruneExpire: time.Now().Add(time.Hour)})
+	c.Assert(err, IsNil)
+
+	c.Assert(s.looseObjects(c, r), HasLen, 0)
+	c.Assert(s.objectPacks(c, r), HasLen, 1)
+
+	fs := r.Storer.(*filesystem.Storage).Filesystem()
+	_, err = fs.Stat(fs.Join("refs", "heads", "master"))
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	_, err = r.BlobObject(unreachable)
+	c.Assert(err, Equals, plumbing.ErrObjectNotFound)
+
+	commit, err := r.CommitObject(head.Hash())
+	c.Assert(err, IsNil)
+	files, err := commit.Files()
+	c.Assert(err, IsNil)
+	c.Assert(files.ForEach(func(*object.File) error { return nil }), IsNil)
+}
+
+func (s *GCSuite) setCruftPacks(c *C, r *Repository, cruft bool) {
+	cfg, err := r.Storer.Config()
+	c.Assert(err, IsNil)
+	cfg.GC.CruftPacks = cruft
+	c.Assert(r.Storer.SetConfig(cfg), IsNil)
+}
+
+func (s *GCSuite) cruftPacks(c *C, r *Repository) map[plumbing.Hash]map[plumbing.Hash]time.Time {
+	packs := make(map[plumbing.Hash]map[plumbing.Hash]time.Time)
+	for _, h := range s.objectPacks(c, r) {
+		times, err := r.Storer.(storer.CruftPackStorer).ObjectPackMTimes(h)
+		c.Assert(err, IsNil)
+		if times != nil {
+			packs[h] = times
+		}
+	}
+
+	return packs
+}
+
+func (s *GCSuite) TestGCUnpacksRecentUnreachable(c *C) {
+	r := s.NewRepository(fixtures.Basic().One())
+	s.setCruftPacks(c, r, false)
+	packs := s.objectPacks(c, r)
+	c.Assert(packs, HasLen, 1)
+
+	c.Assert(r.Storer.RemoveReference("refs/heads/branch"), IsNil)
+	c.Assert(r.Storer.RemoveReference("refs/remotes/origin/branch"), IsNil)
+	branch := plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881")
+
+	// the pack of the fixture is just copied, so it's recent
+	c.Assert(r.GC(nil), IsNil)
+	c.Assert(s.objectPacks(c, r), Not(DeepEquals), packs)
+
+	_, err := r.CommitObject(branch)
+	c.Assert(err, IsNil)
+	c.Assert(len(s.looseObjects(c, r)) > 0, Equals, true)
+
+	c.Assert(r.GC(&GCOptions{PruneExpire: time.Now().Add(time.Hour)}), IsNil)
+	c.Assert(s.looseObjects(c, r), HasLen, 0)
+
+	_, err = r.CommitObject(branch)
+	c.Assert(err, Equals, plumbing.ErrObjectNotFound)
+}
+
+func (s *GCSuite) TestGCCruftPack(c *C) {
+	r := s.NewRepository(fixtures.Basic().One())
+	c.Assert(r.Storer.RemoveReference("refs/heads/branch"), IsNil)
+	c.Assert(r.Storer.RemoveReference("refs/remotes/origin/branch"), IsNil)
+	branch := plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881")
+	unreachable := s.storeBlob(c, r, "unreachable")
+
+	// the pack of the fixture is just copied, so it's recent
+	c.Assert(r.GC(nil), IsNil)
+	c.Assert(s.objectPacks(c, r), HasLen, 2)
+	c.Assert(s.looseObjects(c, r), HasLen, 0)
+
+	cruft := s.cruftPacks(c, r)
+	c.Assert(cruft, HasLen, 1)
+	for _, times := range cruft {
+		c.Assert(times[branch].IsZero(), Equals, false)
+		c.Assert(times[unreachable].IsZero(), Equals, false)
+
+		head, err := r.Head()
+		c.Assert(err, IsNil)
+		_, ok := times[head.Hash()]
+		c.Assert(ok, Equals, false)
+	}
+
+	_, err := r.CommitObject(branch)
+	c.Assert(err, IsNil)
+	_, err = r.BlobObject(unreachable)
+	c.Assert(err, IsNil)
+
+	c.Assert(r.GC(&GCOptions{PruneExpire: time.Now().Add(time.Hour)}), IsNil)
+	c.Assert(s.objectPacks(c, r), HasLen, 1)
+	c.Assert(s.cruftPacks(c, r), HasLen, 0)
+
+	_, err = r.CommitObject(branch)
+	c.Assert(err, Equals, plumbing.ErrObjectNotFound)
+	_, err = r.BlobObject(unreachable)
+	c.Assert(err, Equals, plumbing.ErrObjectNotFound)
+}
+
+func (s *GCSuite) TestGCCruftPackResurrect(c *C) {
+	r := s.NewRepository(fixtures.Basic().One())
+	c.Assert(r.Storer.RemoveReference("refs/heads/branch"), IsNil)
+	c.Assert(r.Storer.RemoveReference("refs/remotes/origin/branch"), IsNil)
+	branch := plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881")
+
+	c.Assert(r.GC(nil), IsNil)
+	c.Assert(s.cruftPacks(c, r), HasLen, 1)
+
+	ref := plumbing.NewHashReference("refs/heads/branch", branch)
+	c.Assert(r.Storer.SetReference(ref), IsNil)
+
+	c.Assert(r.GC(&GCOptions{PruneExpire: time.Now().Add(time.Hour)}), IsNil)
+	c.Assert(s.objectPacks(c, r), HasLen, 1)
+	c.Assert(s.cruftPacks(c, r), HasLen, 0)
+
+	commit, err := r.CommitObject(branch)
+	c.Assert(err, IsNil)
+	files, err := commit.Files()
+	c.Assert(err, IsNil)
+	c.Assert(files.ForEach(func(*object.File) error { return nil }), IsNil)
+}
+
+func (s *GCSuite) TestGCCruftPackExpire(c *C) {
+	r := s.NewRepository(fixtures.Basic().One())
+	c.Assert(r.Storer.RemoveReference("refs/heads/branch"), IsNil)
+	c.Assert(r.Storer.RemoveReference("refs/remotes/origin/branch"), IsNil)
+	branch := plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881")
+
+	c.Assert(r.GC(nil), IsNil)
+	cruft := s.cruftPacks(c, r)
+	c.Assert(cruft, HasLen, 1)
+
+	// make all the cruft objects older than the default prune expiry, but
+	// the commit of the branch, which refers to the older ones
+	old := time.Unix(time.Now().Add(-30*24*time.Hour).Unix(), 0)
+	recent := time.Unix(time.Now().Add(-24*time.Hour).Unix(), 0)
+	var count int
+	for h, times := range cruft {
+		count = len(times)
+		for oh := range times {
+			times[oh] = old
+		}
+
+		times[branch] = recent
+		c.Assert(r.Storer.(storer.CruftPackStorer).SetObjectPackMTimes(h, times), IsNil)
+	}
+
+	expired := s.storeBlob(c, r, "expired")
+	fs := r.Storer.(*filesystem.Storage).Filesystem()
+	path := fs.Join("objects", expired.String()[:2], expired.String()[2:])
+	c.Assert(os.Chtimes(fs.Join(fs.Root(), path), old, old), IsNil)
+
+	c.Assert(r.GC(nil), IsNil)
+	c.Assert(s.looseObjects(c, r), HasLen, 0)
+	_, err := r.BlobObject(expired)
+	c.Assert(err, Equals, plumbing.ErrObjectNotFound)
+
+	cruft = s.cruftPacks(c, r)
+	c.Assert(cruft, HasLen, 1)
+	for _, times := range cruft {
+		// the commit parents are reachable, so only the objects of its
+		// tree are kept
+		c.Assert(len(times) > 1 && len(times) <= count, Equals, true)
+		c.Assert(times[branch].Equal(recent), Equals, true)
+		for oh, t := range times {
+			if oh != branch {
+				c.Assert(t.Equal(old), Equals, true)
+			}
+		}
+	}
+
+	commit, err := r.CommitObject(branch)
+	c.Assert(err, IsNil)
+	files, err := commit.Files()
+	c.Assert(err, IsNil)
+	c.Assert(files.ForEach(func(*object.File) error { return nil }), IsNil)
+}
+
+func (s *GCSuite) TestGCKeepsKeptPacks(c *C) {
+	r := s.NewRepository(fixtures.Basic().One())
+	packs := s.objectPacks(c, r)
+	c.Assert(packs, HasLen, 1)
+
+	fs := r.Storer.(*filesystem.Storage).Filesystem()
+	keep := fs.Join("objects", "pack", "pack-"+packs[0].String()+".keep")
+	c.Assert(util.WriteFile(fs, keep, nil, 0644), IsNil)
+
+	blob := s.storeBlob(c, r, "foo")
+	c.Assert(r.Storer.SetReference(plumbing.NewHashReference("refs/tags/foo", blob)), IsNil)
+
+	c.Assert(r.GC(nil), IsNil)
+
+	after := s.objectPacks(c, r)
+	c.Assert(after, HasLen, 2)
+	c.Assert(s.looseObjects(c, r), HasLen, 0)
+
+	hs, err := r.Storer.(storer.ObjectPackInfoStorer).ObjectPackHashes(after[0])
+	if after[0] == packs[0] {
+		hs, err = r.Storer.(storer.ObjectPackInfoStorer).ObjectPackHashes(after[1])
+	}
+	c.Assert(err, IsNil)
+	c.Assert(hs, DeepEquals, []plumbing.Hash{blob})
+}
+
+func (s *GCSuite) TestGCExpireReflogs(c *C) {
+	r := s.NewRepository(fixtures.Basic().One())
+	rs := r.Storer.(storer.ReflogStorer)
+
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+	unreachable := plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881")
+	now := time.Now()
+
+	fs := r.Storer.(*filesystem.Storage).Filesystem()
+	c.Assert(util.WriteFile(fs, fs.Join("logs", "HEAD"), nil, 0644), IsNil)
+	c.Assert(rs.SetReflog(plumbing.HEAD, []*reflog.Entry{
+		{New: unreachable, When: now.AddDate(-1, 0, 0), Message: "expired"},
+		{Old: unreachable, New: head.Hash(), When: now.AddDate(0, -2, 0), Message: "reachable"},
+		{Old: head.Hash(), New: unreachable, When: now.AddDate(0, -2, 0), Message: "unreachable"},
+		{Old: unreachable, New: head.Hash(), When: now, Message: "recent"},
+	}), IsNil)
+
+	c.Assert(r.GC(nil), IsNil)
+
+	entries, err := rs.Reflog(plumbing.HEAD)
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 2)
+	c.Assert(entries[0].Message, Equals, "reachable")
+	c.Assert(entries[1].Message, Equals, "recent")
+}
+
+func (s *GCSuite) TestGCKeepsReflogObjects(c *C) {
+	r := s.NewRepository(fixtures.Basic().One())
+	rs := r.Storer.(storer.ReflogStorer)
+
+	blob := s.storeBlob(c, r, "foo")
+	fs := r.Storer.(*filesystem.Storage).Filesystem()
+	c.Assert(util.WriteFile(fs, fs.Join("logs", "refs", "heads", "master"), nil, 0644), IsNil)
+	c.Assert(rs.SetReflog("refs/heads/master", []*reflog.Entry{
+		{New: blob, When: time.Now()},
+	}), IsNil)
+
+	c.Assert(r.GC(&GCOptions{PruneExpire: time.Now().Add(time.Hour)}), IsNil)
+	c.Assert(s.looseObjects(c, r), HasLen, 0)
+
+	_, err := r.BlobObject(blob)
+	c.Assert(err, IsNil)
+}
+
+func (s *GCSuite) TestGCNotSupported(c *C) {
+	r, err := Init(memory.NewStorage(), nil)
+	c.Assert(err, IsNil)
+	c.Assert(r.GC(nil), Equals, ErrPackedObjectsNotSupported)
+
+	needs, err := r.NeedsGC()
+	c.Assert(err, IsNil)
+	c.Assert(needs, Equals, false)
+}
+
+func (s *GCSuite) TestNeedsGC(c *C) {
+	r := s.NewRepository(fixtures.ByTag("unpacked").One())
+
+	needs, err := r.NeedsGC()
+	c.Assert(err, IsNil)
+	c.Assert(needs, Equals, false)
+
+	cfg, err := r.Config()
+	c.Assert(err, IsNil)
+	cfg.GC.Auto = 1
+	c.Assert(r.Storer.SetConfig(cfg), IsNil)
+
+	needs, err = r.NeedsGC()
+	c.Assert(err, IsNil)
+	c.Assert(needs, Equals, true)
+
+	c.Assert(r.GC(&GCOptions{Auto: true}), IsNil)
+	c.Assert(s.looseObjects(c, r), HasLen, 0)
+
+	needs, err = r.NeedsGC()
+	c.Assert(err, IsNil)
+	c.Assert(needs, Equals, false)
+
+	cfg.GC.AutoPackLimit = 1
+	c.Assert(r.Storer.SetConfig(cfg), IsNil)
+	s.storeBlob(c, r, "foo")
+	c.Assert(r.RepackObjects(&RepackConfig{}), IsNil)
+
+	needs, err = r.NeedsGC()
+	c.Assert(err, IsNil)
+	c.Assert(needs, Equals, false)
+
+	// the cruft packs aren't counted
+	s.storeBlob(c, r, "bar")
+	c.Assert(r.GC(nil), IsNil)
+	c.Assert(s.objectPacks(c, r), HasLen, 2)
+	c.Assert(s.cruftPacks(c, r), HasLen, 1)
+
+	needs, err = r.NeedsGC()
+	c.Assert(err, IsNil)
+	c.Assert(needs, Equals, false)
+}
+
+func (s *GCSuite) TestParseExpireDate(c *C) {
+	now := time.Date(2020, 1, 15, 12, 0, 0, 0, time.UTC)
+	for v, expected := range map[string]time.Time{
+		"now":         now,
+		"never":       {},
+		"2.weeks.ago": now.AddDate(0, 0, -14),
+		"90.days.ago": now.AddDate(0, 0, -90),
+		"1 hour ago":  now.Add(-time.Hour),
+		"3.months":    now.AddDate(0, 0, -90),
+		"2019-12-01":  time.Date(2019, 12, 1, 0, 0, 0, 0, time.Local),
+	} {
+		t, err := parseExpireDate(v, now)
+		c.Assert(err, IsNil, Commentf(v))
+		c.Assert(t.Equal(expected), Equals, true, Commentf(v))
+	}
+
+	for _, v := range []string{"foo", "2.fortnights.ago", "-1.days.ago"} {
+		_, err := parseExpireDate(v, now)
+		c.Assert(err, Equals, ErrInvalidExpireDate, Commentf(v))
+	}
+}
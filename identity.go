@@ -0,0 +1,107 @@
+package git
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// identity is the kind of identity of a signature, the tagger uses the
+// committer identity.
+type identity int
+
+const (
+	authorIdentity identity = iota
+	committerIdentity
+)
+
+// envPrefix returns the prefix of the environment variables overriding the
+// identity.
+func (i identity) envPrefix() string {
+	if i == authorIdentity {
+		return "GIT_AUTHOR_"
+	}
+
+	return "GIT_COMMITTER_"
+}
+
+// defaultSignature returns the signature for the given identity, built from
+// the GIT_AUTHOR_* or GIT_COMMITTER_* environment variables, the author or
+// committer sections of the config, and the user section of the config, in
+// that order of precedence, as git does. It returns nil if the name or the
+// email can't be found.
+func (r *Repository) defaultSignature(i identity) (*object.Signature, error) {
+	cfg, err := r.ConfigScoped(config.SystemScope)
+	if err != nil {
+		return nil, err
+	}
+
+	getenv := r.loader.Getenv
+
+	name, email := cfg.Author.Name, cfg.Author.Email
+	if i == committerIdentity {
+		name, email = cfg.Committer.Name, cfg.Committer.Email
+	}
+
+	name = firstNonEmpty(getenv(i.envPrefix()+"NAME"), name, cfg.User.Name)
+	email = firstNonEmpty(getenv(i.envPrefix()+"EMAIL"), email, cfg.User.Email, getenv("EMAIL"))
+	if name == "" || email == "" {
+		return nil, nil
+	}
+
+	when := time.Now()
+	if date := getenv(i.envPrefix() + "DATE"); date != "" {
+		if when, err = parseIdentityDate(date); err != nil {
+			return nil, fmt.Errorf("invalid %sDATE: %s", i.envPrefix(), err)
+		}
+	}
+
+	return &object.Signature{Name: name, Email: email, When: when}, nil
+}
+
+var identityDateLayouts = []string{
+	time.RFC3339,
+	time.RFC1123Z,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02T15:04:05-0700",
+}
+
+// parseIdentityDate parses a date in the git internal format, "<unix>
+// <offset>" optionally prefixed by "@", or in the RFC 2822 and ISO 8601
+// formats.
+func parseIdentityDate(date string) (time.Time, error) {
+	fields := strings.Fields(strings.TrimPrefix(date, "@"))
+	if len(fields) == 2 {
+		if secs, err := strconv.ParseInt(fields[0], 10, 64); err == nil {
+			offset, err := time.Parse("-0700", fields[1])
+			if err != nil {
+				return time.Time{}, err
+			}
+
+			return time.Unix(secs, 0).In(offset.Location()), nil
+		}
+	}
+
+	for _, layout := range identityDateLayouts {
+		if t, err := time.Parse(layout, date); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unknown date format %q", date)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
@@ -5,8 +5,9 @@ import (
 )
 
 var (
-	isSchemeRegExp   = regexp.MustCompile(`^[^:]+://`)
-	scpLikeUrlRegExp = regexp.MustCompile(`^(?:(?P<user>[^@]+)@)?(?P<host>[^:\s]+):(?:(?P<port>[0-9]{1,5})(?:\/|:))?(?P<path>[^\\].*\/[^\\].*)$`)
+	isSchemeRegExp     = regexp.MustCompile(`^[^:]+://`)
+	scpLikeUrlRegExp   = regexp.MustCompile(`^(?:(?P<user>[^@]+)@)?(?P<host>[^:\s]+):(?:(?P<port>[0-9]{1,5})(?:\/|:))?(?P<path>[^\\].*\/[^\\].*)$`)
+	remoteHelperRegExp = regexp.MustCompile(`^(?P<transport>[A-Za-z0-9][A-Za-z0-9+.-]*)::(?P<address>.+)$`)
 )
 
 // MatchesScheme returns true if the given string matches a URL-like
@@ -28,10 +29,24 @@ func FindScpLikeComponents(url string) (user, host, port, path string) {
 	return m[1], m[2], m[3], m[4]
 }
 
+// MatchesRemoteHelper returns true if the given string matches the
+// <transport>::<address> format, used to run the remote helper of the given
+// transport with the address.
+func MatchesRemoteHelper(url string) bool {
+	return remoteHelperRegExp.MatchString(url)
+}
+
+// FindRemoteHelperComponents returns the transport and address of the given
+// <transport>::<address> URL.
+func FindRemoteHelperComponents(url string) (transport, address string) {
+	m := remoteHelperRegExp.FindStringSubmatch(url)
+	return m[1], m[2]
+}
+
 // IsLocalEndpoint returns true if the given URL string specifies a
 // local file endpoint.  For example, on a Linux machine,
 // `/home/user/src/go-git` would match as a local endpoint, but
 // `https://github.com/src-d/go-git` would not.
 func IsLocalEndpoint(url string) bool {
-	return !MatchesScheme(url) && !MatchesScpLike(url)
+	return !MatchesScheme(url) && !MatchesScpLike(url) && !MatchesRemoteHelper(url)
 }
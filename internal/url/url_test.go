@@ -58,3 +58,13 @@ func (s *URLSuite) TestFindScpLikeComponents(c *C) {
 	c.Check(port, Equals, "22")
 	c.Check(path, Equals, "007/bond")
 }
+
+func (s *URLSuite) TestRemoteHelper(c *C) {
+	c.Assert(MatchesRemoteHelper("s3::bucket/repo"), Equals, true)
+	c.Assert(MatchesRemoteHelper("git@github.com:james/bond"), Equals, false)
+	c.Assert(IsLocalEndpoint("s3::bucket/repo"), Equals, false)
+
+	transport, address := FindRemoteHelperComponents("ext::ssh -p 22 host %S repo")
+	c.Assert(transport, Equals, "ext")
+	c.Assert(address, Equals, "ssh -p 22 host %S repo")
+}
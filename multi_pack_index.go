@@ -0,0 +1,35 @@
+package git
+
+import (
+	"errors"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+var ErrMultiPackIndexNotSupported = errors.New("multi-pack-index not supported by the storage")
+
+// WriteMultiPackIndex writes the multi-pack-index of the repository, indexing
+// the objects of all its packfiles so they're looked up at once instead of in
+// each packfile index. It's meant to be called after the packfiles change,
+// such as after a Fetch. The storage must implement
+// storer.MultiPackIndexStorer.
+func (r *Repository) WriteMultiPackIndex() error {
+	s, ok := r.Storer.(storer.MultiPackIndexStorer)
+	if !ok {
+		return ErrMultiPackIndexNotSupported
+	}
+
+	return s.WriteMultiPackIndex()
+}
+
+// VerifyMultiPackIndex checks that the multi-pack-index of the repository, if
+// any, matches its packfiles. The storage must implement
+// storer.MultiPackIndexStorer.
+func (r *Repository) VerifyMultiPackIndex() error {
+	s, ok := r.Storer.(storer.MultiPackIndexStorer)
+	if !ok {
+		return ErrMultiPackIndexNotSupported
+	}
+
+	return s.VerifyMultiPackIndex()
+}
@@ -0,0 +1,66 @@
+package git
+
+import (
+	"gopkg.in/src-d/go-git.v4/plumbing/format/midx"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git-fixtures.v3"
+)
+
+type MultiPackIndexSuite struct {
+	BaseSuite
+}
+
+var _ = Suite(&MultiPackIndexSuite{})
+
+func (s *MultiPackIndexSuite) multiPackIndex(c *C, r *Repository) midx.Index {
+	idx, err := r.Storer.(storer.MultiPackIndexStorer).MultiPackIndex()
+	c.Assert(err, IsNil)
+	return idx
+}
+
+func (s *MultiPackIndexSuite) TestWriteMultiPackIndex(c *C) {
+	r := s.NewRepository(fixtures.ByTag(".git").ByTag("multi-packfile").One())
+	c.Assert(s.multiPackIndex(c, r), IsNil)
+
+	c.Assert(r.WriteMultiPackIndex(), IsNil)
+	c.Assert(r.VerifyMultiPackIndex(), IsNil)
+
+	packs, err := r.Storer.(storer.PackedObjectStorer).ObjectPacks()
+	c.Assert(err, IsNil)
+
+	idx := s.multiPackIndex(c, r)
+	c.Assert(idx, NotNil)
+	c.Assert(idx.PackNames(), HasLen, len(packs))
+
+	iter, err := r.CommitObjects()
+	c.Assert(err, IsNil)
+	c.Assert(iter.ForEach(func(*object.Commit) error { return nil }), IsNil)
+}
+
+func (s *MultiPackIndexSuite) TestWriteMultiPackIndexNotSupported(c *C) {
+	r, err := Init(memory.NewStorage(), nil)
+	c.Assert(err, IsNil)
+
+	c.Assert(r.WriteMultiPackIndex(), Equals, ErrMultiPackIndexNotSupported)
+	c.Assert(r.VerifyMultiPackIndex(), Equals, ErrMultiPackIndexNotSupported)
+}
+
+func (s *MultiPackIndexSuite) TestRepackObjectsWriteMultiPackIndex(c *C) {
+	r := s.NewRepository(fixtures.ByTag("unpacked").One())
+	c.Assert(r.WriteMultiPackIndex(), IsNil)
+	c.Assert(s.multiPackIndex(c, r).PackNames(), Not(HasLen), 1)
+
+	c.Assert(r.RepackObjects(&RepackConfig{WriteMultiPackIndex: true}), IsNil)
+	c.Assert(r.VerifyMultiPackIndex(), IsNil)
+
+	idx := s.multiPackIndex(c, r)
+	c.Assert(idx, NotNil)
+	c.Assert(idx.PackNames(), HasLen, 1)
+
+	c.Assert(r.RepackObjects(&RepackConfig{}), IsNil)
+	c.Assert(s.multiPackIndex(c, r), IsNil)
+}
@@ -30,6 +30,24 @@ const (
 
 var (
 	ErrMissingURL = errors.New("URL field is required")
+	// ErrConflictingDepthOptions is returned when more than one of Depth,
+	// ShallowSince, ShallowExclude, Deepen and Unshallow are given.
+	ErrConflictingDepthOptions = errors.New("depth, shallow-since, shallow-exclude, deepen and unshallow are mutually exclusive")
+	// ErrInvalidRetryOptions is returned when the retry options have negative
+	// values.
+	ErrInvalidRetryOptions = errors.New("retries and backoffs can't be negative")
+	// ErrConflictingPruneOptions is returned when both Prune and NoPrune are
+	// given.
+	ErrConflictingPruneOptions = errors.New("prune and no-prune are mutually exclusive")
+)
+
+const (
+	// DefaultInitialBackoff is the time waited before the first retry of a
+	// failed transport operation.
+	DefaultInitialBackoff = time.Second
+	// DefaultMaxBackoff is the maximum time waited between the retries of a
+	// failed transport operation.
+	DefaultMaxBackoff = 30 * time.Second
 )
 
 // CloneOptions describes how a clone should be performed.
@@ -59,6 +77,37 @@ type CloneOptions struct {
 	// Tags describe how the tags will be fetched from the remote repository,
 	// by default is AllTags.
 	Tags TagMode
+	// Mirror if true, all the references of the remote are fetched into the
+	// same local references, and the remote is configured as a mirror, so
+	// the pushes without refspecs mirror the local references. Mirror clones
+	// must be bare.
+	Mirror bool
+	// Reference is the path of a local repository whose objects are borrowed
+	// through objects/info/alternates, so only the objects missing in it are
+	// fetched. The storage must be a filesystem one.
+	Reference string
+	// Dissociate if true, along with Reference, the objects borrowed from the
+	// reference repository are copied once cloned and the alternates are
+	// removed, so the clone doesn't depend on the reference repository.
+	Dissociate bool
+	// NoLocal if true, PlainClone transfers the objects of a repository at a
+	// local path with the pack protocol, instead of hardlinking or copying
+	// its object files.
+	NoLocal bool
+	// NoHardlinks if true, PlainClone copies the object files of a
+	// repository at a local path instead of hardlinking them.
+	NoHardlinks bool
+	// Retry describes how the transfer is retried when it fails with a
+	// transient error, by default it isn't.
+	Retry RetryOptions
+	// BundleURI is the URI of a bundle, local or HTTP, downloaded before
+	// fetching from the remote, so only the objects missing in it are
+	// fetched from the remote.
+	BundleURI string
+	// ConfigLoader if set, is the Loader used by the cloned repository to
+	// read the system and global config files and the environment, instead
+	// of config.NewDefaultLoader.
+	ConfigLoader *config.Loader
 }
 
 // Validate validates the fields and sets the default values.
@@ -79,7 +128,7 @@ func (o *CloneOptions) Validate() error {
 		o.Tags = AllTags
 	}
 
-	return nil
+	return o.Retry.Validate()
 }
 
 // PullOptions describes how a pull should be performed.
@@ -104,6 +153,9 @@ type PullOptions struct {
 	// Force allows the pull to update a local branch even when the remote
 	// branch does not descend from it.
 	Force bool
+	// Retry describes how the fetch is retried when it fails with a
+	// transient error, by default it isn't.
+	Retry RetryOptions
 }
 
 // Validate validates the fields and sets the default values.
@@ -116,7 +168,7 @@ func (o *PullOptions) Validate() error {
 		o.ReferenceName = plumbing.HEAD
 	}
 
-	return nil
+	return o.Retry.Validate()
 }
 
 type TagMode int
@@ -154,6 +206,43 @@ type FetchOptions struct {
 	// Force allows the fetch to update a local branch even when the remote
 	// branch does not descend from it.
 	Force bool
+	// Prune if true, the local references matching the destination of the
+	// refspecs that no longer exist on the remote are removed. It's enabled
+	// too by the remote.<name>.prune and fetch.prune config options.
+	Prune bool
+	// NoPrune if true, nothing is pruned even if enabled by the config
+	// options, as `git fetch --no-prune` does.
+	NoPrune bool
+	// PruneTags if true, along with Prune, the local tags that no longer
+	// exist on the remote are removed too. It's enabled too by the
+	// remote.<name>.pruneTags and fetch.pruneTags config options.
+	PruneTags bool
+	// ShallowSince limits fetching to the commits newer than the given time.
+	ShallowSince time.Time
+	// ShallowExclude limits fetching to the commits not reachable from the
+	// given remote branch or tag.
+	ShallowExclude string
+	// Deepen deepens the history of a shallow repository by the given number
+	// of commits from the current shallow boundary, instead of from the tip
+	// of each remote branch history as Depth does.
+	Deepen int
+	// Unshallow if true, converts a shallow repository into a complete one,
+	// fetching all the missing history.
+	Unshallow bool
+	// Retry describes how the fetch is retried when it fails with a transient
+	// error, by default it isn't.
+	Retry RetryOptions
+	// BundleURI is the URI of a bundle, local or HTTP, downloaded before
+	// fetching from the remote, so only the objects missing in it are
+	// fetched from the remote. If empty, the fetch.bundleURI config option is
+	// used. A bundle that can't be downloaded or applied is ignored. The
+	// bundles advertised by the server aren't used, since they require the
+	// protocol v2.
+	BundleURI string
+	// AutoGC if true, a garbage collection is performed after fetching if
+	// the repository needs one, as git gc --auto does, see Repository.NeedsGC.
+	// It is only honored by the fetches of a Repository, not of a Remote.
+	AutoGC bool
 }
 
 // Validate validates the fields and sets the default values.
@@ -162,6 +251,23 @@ func (o *FetchOptions) Validate() error {
 		o.RemoteName = DefaultRemoteName
 	}
 
+	var depths int
+	for _, set := range []bool{
+		o.Depth != 0, !o.ShallowSince.IsZero(), o.ShallowExclude != "", o.Deepen != 0, o.Unshallow,
+	} {
+		if set {
+			depths++
+		}
+	}
+
+	if depths > 1 {
+		return ErrConflictingDepthOptions
+	}
+
+	if o.Prune && o.NoPrune {
+		return ErrConflictingPruneOptions
+	}
+
 	if o.Tags == InvalidTagMode {
 		o.Tags = TagFollowing
 	}
@@ -172,6 +278,43 @@ func (o *FetchOptions) Validate() error {
 		}
 	}
 
+	return o.Retry.Validate()
+}
+
+// RetryOptions describes how the transport operations are retried when they
+// fail with a transient error, such as a dropped connection or a server
+// error. The objects received before the failure are kept, so the retries
+// don't start from zero.
+type RetryOptions struct {
+	// MaxRetries is the maximum number of retries, if 0 the operations aren't
+	// retried.
+	MaxRetries int
+	// InitialBackoff is the time waited before the first retry, doubled after
+	// each one. Defaults to DefaultInitialBackoff.
+	InitialBackoff time.Duration
+	// MaxBackoff is the maximum time waited between retries. Defaults to
+	// DefaultMaxBackoff.
+	MaxBackoff time.Duration
+}
+
+// Validate validates the fields and sets the default values.
+func (o *RetryOptions) Validate() error {
+	if o.MaxRetries < 0 || o.InitialBackoff < 0 || o.MaxBackoff < 0 {
+		return ErrInvalidRetryOptions
+	}
+
+	if o.InitialBackoff == 0 {
+		o.InitialBackoff = DefaultInitialBackoff
+	}
+
+	if o.MaxBackoff == 0 {
+		o.MaxBackoff = DefaultMaxBackoff
+	}
+
+	if o.MaxBackoff < o.InitialBackoff {
+		o.MaxBackoff = o.InitialBackoff
+	}
+
 	return nil
 }
 
@@ -181,6 +324,9 @@ type PushOptions struct {
 	RemoteName string
 	// RefSpecs specify what destination ref to update with what source
 	// object. A refspec with empty src can be used to delete a reference.
+	// If empty and the remote is a mirror, all the references are mirrored.
+	// Otherwise Repository.Push decides the refspecs from the push.default
+	// config, all the branches are pushed if it isn't set.
 	RefSpecs []config.RefSpec
 	// Auth credentials, if required, to use with the remote repository.
 	Auth transport.AuthMethod
@@ -190,6 +336,37 @@ type PushOptions struct {
 	// Prune specify that remote refs that match given RefSpecs and that do
 	// not exist locally will be removed.
 	Prune bool
+	// FollowTags if true, the annotated tags missing on the remote that
+	// point to commits reachable from the pushed references are pushed too.
+	// It's enabled too by the push.followTags config option.
+	FollowTags bool
+	// ForceWithLease allows to update the remote references even if the
+	// update isn't a fast-forward, as long as their current value is the
+	// expected one, protecting from overwriting work pushed by others since
+	// the last fetch. The references whose value differ aren't updated and a
+	// StaleLeaseError is returned.
+	ForceWithLease []ForceWithLease
+	// SetUpstream if true, the pushed local branches are configured to track
+	// the remote branches they were pushed to, writing branch.<name>.remote
+	// and branch.<name>.merge. It only applies to Repository.Push.
+	SetUpstream bool
+}
+
+// ForceWithLease is the lease of a remote reference for a push, like the
+// --force-with-lease=<refname>:<expect> option of git push.
+type ForceWithLease struct {
+	// RefName is the name of the remote reference. If empty, the lease
+	// applies to all the pushed references without a lease of their own.
+	RefName plumbing.ReferenceName
+	// Hash is the value the remote reference is expected to have. If zero,
+	// the value of the remote-tracking reference is expected, and if there
+	// is no remote-tracking reference, the remote reference is expected not
+	// to exist.
+	Hash plumbing.Hash
+	// ExpectAbsent if true, the remote reference is expected not to exist,
+	// like --force-with-lease=<refname>: does, whatever the remote-tracking
+	// reference is. Hash is ignored.
+	ExpectAbsent bool
 }
 
 // Validate validates the fields and sets the default values.
@@ -327,6 +504,7 @@ const (
 	LogOrderDFSPost
 	LogOrderBSF
 	LogOrderCommitterTime
+	LogOrderTopo
 )
 
 // LogOptions describes how a log action should be performed.
@@ -339,6 +517,8 @@ type LogOptions struct {
 	// The default traversal algorithm is Depth-first search
 	// set Order=LogOrderCommitterTime for ordering by committer time (more compatible with `git log`)
 	// set Order=LogOrderBSF for Breadth-first search
+	// set Order=LogOrderTopo for topological order, no parent is shown before
+	// all its children (like `git log --topo-order`)
 	Order LogOrder
 
 	// Show only those commits in which the specified file was inserted/updated.
@@ -368,10 +548,15 @@ type CommitOptions struct {
 	// All automatically stage files that have been modified and deleted, but
 	// new files you have not told Git about are not affected.
 	All bool
-	// Author is the author's signature of the commit.
+	// Author is the author's signature of the commit. If Author is nil the
+	// identity is read from the GIT_AUTHOR_NAME, GIT_AUTHOR_EMAIL and
+	// GIT_AUTHOR_DATE environment variables, and from the author and user
+	// sections of the config.
 	Author *object.Signature
 	// Committer is the committer's signature of the commit. If Committer is
-	// nil the Author signature is used.
+	// nil the Author signature is used, unless Author is nil too, then the
+	// identity is read from the GIT_COMMITTER_* environment variables and the
+	// committer and user sections of the config.
 	Committer *object.Signature
 	// Parents are the parents commits for the new commit, by default when
 	// len(Parents) is zero, the hash of HEAD reference is used.
@@ -384,6 +569,12 @@ type CommitOptions struct {
 
 // Validate validates the fields and sets the default values.
 func (o *CommitOptions) Validate(r *Repository) error {
+	if o.Author == nil {
+		if err := o.loadConfigAuthorAndCommitter(r); err != nil {
+			return err
+		}
+	}
+
 	if o.Author == nil {
 		return ErrMissingAuthor
 	}
@@ -406,6 +597,21 @@ func (o *CommitOptions) Validate(r *Repository) error {
 	return nil
 }
 
+func (o *CommitOptions) loadConfigAuthorAndCommitter(r *Repository) error {
+	author, err := r.defaultSignature(authorIdentity)
+	if err != nil {
+		return err
+	}
+
+	o.Author = author
+	if o.Committer != nil || author == nil {
+		return nil
+	}
+
+	o.Committer, err = r.defaultSignature(committerIdentity)
+	return err
+}
+
 var (
 	ErrMissingName    = errors.New("name field is required")
 	ErrMissingTagger  = errors.New("tagger field is required")
@@ -414,7 +620,9 @@ var (
 
 // CreateTagOptions describes how a tag object should be created.
 type CreateTagOptions struct {
-	// Tagger defines the signature of the tag creator.
+	// Tagger defines the signature of the tag creator. If Tagger is nil the
+	// committer identity is used, read from the GIT_COMMITTER_* environment
+	// variables and the committer and user sections of the config.
 	Tagger *object.Signature
 	// Message defines the annotation of the tag. It is canonicalized during
 	// validation into the format expected by git - no leading whitespace and
@@ -427,6 +635,15 @@ type CreateTagOptions struct {
 
 // Validate validates the fields and sets the default values.
 func (o *CreateTagOptions) Validate(r *Repository, hash plumbing.Hash) error {
+	if o.Tagger == nil {
+		tagger, err := r.defaultSignature(committerIdentity)
+		if err != nil {
+			return err
+		}
+
+		o.Tagger = tagger
+	}
+
 	if o.Tagger == nil {
 		return ErrMissingTagger
 	}
@@ -489,6 +706,29 @@ func (o *GrepOptions) Validate(w *Worktree) error {
 	return nil
 }
 
+var (
+	ErrInvalidArchivePrefix = errors.New("archive prefix must be a relative path")
+)
+
+// ArchiveOptions describes how an archive should be created.
+type ArchiveOptions struct {
+	// Prefix is prepended to the path of every entry of the archive, it
+	// should end with a slash to place the entries into a directory.
+	Prefix string
+	// PathSpecs are compiled Regexp objects of pathspec, if given only the
+	// matching files are archived.
+	PathSpecs []*regexp.Regexp
+}
+
+// Validate validates the fields and sets the default values.
+func (o *ArchiveOptions) Validate() error {
+	if strings.HasPrefix(o.Prefix, "/") {
+		return ErrInvalidArchivePrefix
+	}
+
+	return nil
+}
+
 // PlainOpenOptions describes how opening a plain repository should be
 // performed.
 type PlainOpenOptions struct {
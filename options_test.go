@@ -2,6 +2,9 @@ package git
 
 import (
 	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	fixtures "gopkg.in/src-d/go-git-fixtures.v3"
+	"gopkg.in/src-d/go-git.v4/config"
 	"gopkg.in/src-d/go-git.v4/plumbing/object"
 )
 
@@ -33,3 +36,66 @@ func (s *OptionsSuite) TestCommitOptionsCommitter(c *C) {
 
 	c.Assert(o.Committer, Equals, o.Author)
 }
+
+func (s *OptionsSuite) TestCommitOptionsFromConfig(c *C) {
+	r := s.NewRepository(fixtures.Basic().One())
+	cfg, err := r.Config()
+	c.Assert(err, IsNil)
+	cfg.User.Name = "John Doe"
+	cfg.User.Email = "john@example.com"
+	cfg.Committer.Email = "ci@example.com"
+	c.Assert(r.Storer.SetConfig(cfg), IsNil)
+
+	o := CommitOptions{}
+	err = o.Validate(r)
+	c.Assert(err, IsNil)
+	c.Assert(o.Author.Name, Equals, "John Doe")
+	c.Assert(o.Author.Email, Equals, "john@example.com")
+	c.Assert(o.Author.When.IsZero(), Equals, false)
+	c.Assert(o.Committer.Name, Equals, "John Doe")
+	c.Assert(o.Committer.Email, Equals, "ci@example.com")
+}
+
+func (s *OptionsSuite) TestCommitOptionsFromEnv(c *C) {
+	env := map[string]string{
+		"GIT_AUTHOR_NAME":     "Jane Doe",
+		"GIT_AUTHOR_DATE":     "@1136214245 +0100",
+		"GIT_COMMITTER_NAME":  "Bot",
+		"GIT_COMMITTER_EMAIL": "bot@example.com",
+		"GIT_COMMITTER_DATE":  "2006-01-02T15:04:05Z",
+		"EMAIL":               "jane@example.com",
+	}
+
+	loader := config.NewLoader(memfs.New())
+	loader.Getenv = func(key string) string { return env[key] }
+
+	defer s.Repository.SetConfigLoader(s.Repository.ConfigLoader())
+	s.Repository.SetConfigLoader(loader)
+
+	o := CommitOptions{}
+	err := o.Validate(s.Repository)
+	c.Assert(err, IsNil)
+	c.Assert(o.Author.Name, Equals, "Jane Doe")
+	c.Assert(o.Author.Email, Equals, "jane@example.com")
+	c.Assert(o.Author.When.Unix(), Equals, int64(1136214245))
+	_, offset := o.Author.When.Zone()
+	c.Assert(offset, Equals, 3600)
+	c.Assert(o.Committer.Name, Equals, "Bot")
+	c.Assert(o.Committer.Email, Equals, "bot@example.com")
+	c.Assert(o.Committer.When.Unix(), Equals, int64(1136214245))
+
+	env["GIT_AUTHOR_DATE"] = "yesterday"
+	o = CommitOptions{}
+	c.Assert(o.Validate(s.Repository), ErrorMatches, "invalid GIT_AUTHOR_DATE: .*")
+}
+
+func (s *OptionsSuite) TestFetchOptionsConflictingDepths(c *C) {
+	o := FetchOptions{Depth: 1}
+	c.Assert(o.Validate(), IsNil)
+
+	o = FetchOptions{Depth: 1, Unshallow: true}
+	c.Assert(o.Validate(), Equals, ErrConflictingDepthOptions)
+
+	o = FetchOptions{Deepen: 1, ShallowExclude: "refs/heads/master"}
+	c.Assert(o.Validate(), Equals, ErrConflictingDepthOptions)
+}
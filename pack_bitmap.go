@@ -0,0 +1,61 @@
+package git
+
+import (
+	"errors"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/revlist"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+var (
+	ErrPackBitmapNotSupported = errors.New("reachability bitmaps not supported by the storage")
+	ErrPackBitmapShallow      = errors.New("reachability bitmaps not supported in shallow repositories")
+)
+
+// writePackBitmap writes the reachability bitmaps of the given packfile,
+// storing all the objects reachable from the references.
+func (r *Repository) writePackBitmap(pack plumbing.Hash) error {
+	s, ok := r.Storer.(storer.PackBitmapStorer)
+	if !ok {
+		return ErrPackBitmapNotSupported
+	}
+
+	shallows, err := r.Storer.Shallow()
+	if err != nil {
+		return err
+	}
+
+	if len(shallows) != 0 {
+		return ErrPackBitmapShallow
+	}
+
+	idx, err := s.NewPackBitmap(pack)
+	if err != nil {
+		return err
+	}
+
+	iter, err := r.Storer.IterReferences()
+	if err != nil {
+		return err
+	}
+
+	var tips []plumbing.Hash
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference {
+			tips = append(tips, ref.Hash())
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if err := revlist.BuildBitmaps(r.Storer, idx, tips); err != nil {
+		return err
+	}
+
+	return s.SetPackBitmap(idx)
+}
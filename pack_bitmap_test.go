@@ -0,0 +1,79 @@
+package git
+
+import (
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/bitmap"
+	"gopkg.in/src-d/go-git.v4/plumbing/revlist"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git-fixtures.v3"
+)
+
+type PackBitmapSuite struct {
+	BaseSuite
+}
+
+var _ = Suite(&PackBitmapSuite{})
+
+func (s *PackBitmapSuite) packBitmap(c *C, r *Repository) *bitmap.Index {
+	idx, err := r.Storer.(storer.PackBitmapStorer).PackBitmap()
+	c.Assert(err, IsNil)
+	return idx
+}
+
+func (s *PackBitmapSuite) TestRepackObjectsWriteBitmaps(c *C) {
+	r := s.NewRepository(fixtures.ByTag("unpacked").One())
+	c.Assert(s.packBitmap(c, r), IsNil)
+
+	c.Assert(r.RepackObjects(&RepackConfig{WriteBitmaps: true}), IsNil)
+
+	idx := s.packBitmap(c, r)
+	c.Assert(idx, NotNil)
+
+	packs, err := r.Storer.(storer.PackedObjectStorer).ObjectPacks()
+	c.Assert(err, IsNil)
+	c.Assert(packs, DeepEquals, []plumbing.Hash{idx.Packfile()})
+
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+	c.Assert(idx.Bitmap(head.Hash()), NotNil)
+
+	objs, err := revlist.Objects(r.Storer, []plumbing.Hash{head.Hash()}, nil)
+	c.Assert(err, IsNil)
+	c.Assert(objs, HasLen, idx.Bitmap(head.Hash()).Count())
+}
+
+func (s *PackBitmapSuite) TestIsAncestorWithBitmaps(c *C) {
+	r := s.NewRepository(fixtures.Basic().One())
+	c.Assert(r.RepackObjects(&RepackConfig{WriteBitmaps: true}), IsNil)
+	c.Assert(s.packBitmap(c, r), NotNil)
+
+	first, err := r.CommitObject(plumbing.NewHash("b029517f6300c2da0f4b651b8642506cd6aaf45d"))
+	c.Assert(err, IsNil)
+	branch, err := r.CommitObject(plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881"))
+	c.Assert(err, IsNil)
+	master, err := r.CommitObject(plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	c.Assert(err, IsNil)
+
+	ok, err := first.IsAncestor(master)
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, true)
+
+	ok, err = master.IsAncestor(first)
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, false)
+
+	ok, err = branch.IsAncestor(master)
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, false)
+}
+
+func (s *PackBitmapSuite) TestRepackObjectsWriteBitmapsNotSupported(c *C) {
+	r, err := Init(memory.NewStorage(), nil)
+	c.Assert(err, IsNil)
+
+	err = r.RepackObjects(&RepackConfig{WriteBitmaps: true})
+	c.Assert(err, NotNil)
+}
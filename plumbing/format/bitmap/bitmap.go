@@ -0,0 +1,177 @@
+package bitmap
+
+import (
+	"io"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/idxfile"
+)
+
+// typeBitmaps are the object types with a type bitmap, in file order.
+var typeBitmaps = []plumbing.ObjectType{
+	plumbing.CommitObject,
+	plumbing.TreeObject,
+	plumbing.BlobObject,
+	plumbing.TagObject,
+}
+
+// Index is the reachability bitmaps of a packfile, the bitmaps of some of its
+// commits and the bitmaps of the types of its objects.
+type Index struct {
+	pack plumbing.Hash
+	// objects are the objects of the packfile sorted by offset, the
+	// positions of the bits of the bitmaps.
+	objects   []plumbing.Hash
+	positions map[plumbing.Hash]int
+	// sorted are the positions of the objects sorted by hash, as in the idx
+	// file.
+	sorted []int
+
+	types   map[plumbing.ObjectType]*Bitmap
+	bitmaps map[plumbing.Hash]*Bitmap
+	commits []plumbing.Hash
+}
+
+// NewIndex returns an Index without bitmaps of the packfile with the given
+// checksum and idx file.
+func NewIndex(pack plumbing.Hash, idx idxfile.Index) (*Index, error) {
+	i := &Index{
+		pack:      pack,
+		positions: make(map[plumbing.Hash]int),
+		types:     make(map[plumbing.ObjectType]*Bitmap),
+		bitmaps:   make(map[plumbing.Hash]*Bitmap),
+	}
+
+	for _, t := range typeBitmaps {
+		i.types[t] = NewBitmap()
+	}
+
+	err := forEachEntry(idx.EntriesByOffset, func(e *idxfile.Entry) {
+		i.positions[e.Hash] = len(i.objects)
+		i.objects = append(i.objects, e.Hash)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = forEachEntry(idx.Entries, func(e *idxfile.Entry) {
+		i.sorted = append(i.sorted, i.positions[e.Hash])
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return i, nil
+}
+
+func forEachEntry(entries func() (idxfile.EntryIter, error), f func(*idxfile.Entry)) error {
+	iter, err := entries()
+	if err != nil {
+		return err
+	}
+
+	defer iter.Close()
+	for {
+		e, err := iter.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		f(e)
+	}
+}
+
+// Packfile returns the checksum of the packfile of the bitmaps.
+func (i *Index) Packfile() plumbing.Hash {
+	return i.pack
+}
+
+// Count returns the number of objects of the packfile.
+func (i *Index) Count() int {
+	return len(i.objects)
+}
+
+// Position returns the position of the object with the given hash in the
+// bitmaps, false if it isn't in the packfile.
+func (i *Index) Position(h plumbing.Hash) (int, bool) {
+	pos, ok := i.positions[h]
+	return pos, ok
+}
+
+// Hash returns the hash of the object at the given position.
+func (i *Index) Hash(pos int) plumbing.Hash {
+	return i.objects[pos]
+}
+
+// Objects returns the hashes of the objects in the given bitmap, in packfile
+// order.
+func (i *Index) Objects(b *Bitmap) []plumbing.Hash {
+	var hashes []plumbing.Hash
+	b.ForEach(func(pos int) {
+		if pos < len(i.objects) {
+			hashes = append(hashes, i.objects[pos])
+		}
+	})
+
+	return hashes
+}
+
+// SetType sets the type of the object at the given position.
+func (i *Index) SetType(pos int, t plumbing.ObjectType) {
+	if b, ok := i.types[t]; ok {
+		b.Set(pos)
+	}
+}
+
+// Type returns the type of the object at the given position,
+// plumbing.InvalidObject if it's unknown.
+func (i *Index) Type(pos int) plumbing.ObjectType {
+	for _, t := range typeBitmaps {
+		if i.types[t].Get(pos) {
+			return t
+		}
+	}
+
+	return plumbing.InvalidObject
+}
+
+// TypeBitmap returns the bitmap of the objects of the given type.
+func (i *Index) TypeBitmap(t plumbing.ObjectType) *Bitmap {
+	if b, ok := i.types[t]; ok {
+		return b
+	}
+
+	return NewBitmap()
+}
+
+// Add sets the bitmap of the objects reachable from the given commit. It
+// returns plumbing.ErrObjectNotFound if the commit isn't in the packfile.
+func (i *Index) Add(commit plumbing.Hash, b *Bitmap) error {
+	if _, ok := i.positions[commit]; !ok {
+		return plumbing.ErrObjectNotFound
+	}
+
+	if _, ok := i.bitmaps[commit]; !ok {
+		i.commits = append(i.commits, commit)
+	}
+
+	i.bitmaps[commit] = b
+	return nil
+}
+
+// Bitmap returns the bitmap of the objects reachable from the given commit,
+// nil if it has no bitmap.
+func (i *Index) Bitmap(commit plumbing.Hash) *Bitmap {
+	return i.bitmaps[commit]
+}
+
+// Commits returns the commits with a bitmap.
+func (i *Index) Commits() []plumbing.Hash {
+	return i.commits
+}
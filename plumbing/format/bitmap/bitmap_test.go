@@ -0,0 +1,141 @@
+package bitmap_test
+
+import (
+	"bytes"
+	"testing"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/bitmap"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/idxfile"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git-fixtures.v3"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type BitmapSuite struct {
+	fixtures.Suite
+}
+
+var _ = Suite(&BitmapSuite{})
+
+func (s *BitmapSuite) newIndex(c *C) *bitmap.Index {
+	f := fixtures.Basic().One()
+	idx := new(idxfile.MemoryIndex)
+	c.Assert(idxfile.NewDecoder(f.Idx()).Decode(idx), IsNil)
+
+	bidx, err := bitmap.NewIndex(f.PackfileHash, idx)
+	c.Assert(err, IsNil)
+	return bidx
+}
+
+func (s *BitmapSuite) TestBitmap(c *C) {
+	a := bitmap.NewBitmap()
+	a.Set(1)
+	a.Set(100)
+
+	b := bitmap.NewBitmap()
+	b.Set(100)
+	b.Set(200)
+
+	or := a.Clone()
+	or.Or(b)
+	c.Assert(or.Count(), Equals, 3)
+
+	and := a.Clone()
+	and.And(b)
+	c.Assert(and.Count(), Equals, 1)
+	c.Assert(and.Get(100), Equals, true)
+
+	andNot := a.Clone()
+	andNot.AndNot(b)
+	c.Assert(andNot.Count(), Equals, 1)
+	c.Assert(andNot.Get(1), Equals, true)
+
+	xor := a.Clone()
+	xor.Xor(b)
+	var positions []int
+	xor.ForEach(func(i int) { positions = append(positions, i) })
+	c.Assert(positions, DeepEquals, []int{1, 200})
+
+	c.Assert(a.Equal(b), Equals, false)
+	c.Assert(and.Equal(b), Equals, false)
+	xor.Xor(b)
+	c.Assert(xor.Equal(a), Equals, true)
+}
+
+func (s *BitmapSuite) TestIndex(c *C) {
+	idx := s.newIndex(c)
+	c.Assert(idx.Count(), Equals, 31)
+
+	h := plumbing.NewHash("1669dce138d9b841a518c64b10914d88f5e488ea")
+	pos, ok := idx.Position(h)
+	c.Assert(ok, Equals, true)
+	c.Assert(idx.Hash(pos), Equals, h)
+	c.Assert(idx.Type(pos), Equals, plumbing.InvalidObject)
+
+	idx.SetType(pos, plumbing.CommitObject)
+	c.Assert(idx.Type(pos), Equals, plumbing.CommitObject)
+	c.Assert(idx.TypeBitmap(plumbing.CommitObject).Count(), Equals, 1)
+
+	_, ok = idx.Position(plumbing.ZeroHash)
+	c.Assert(ok, Equals, false)
+	c.Assert(idx.Add(plumbing.ZeroHash, bitmap.NewBitmap()), Equals, plumbing.ErrObjectNotFound)
+}
+
+func (s *BitmapSuite) TestEncodeDecode(c *C) {
+	idx := s.newIndex(c)
+	types := []plumbing.ObjectType{
+		plumbing.CommitObject, plumbing.TreeObject,
+		plumbing.BlobObject, plumbing.TagObject,
+	}
+
+	all := bitmap.NewBitmap()
+	for pos := 0; pos < idx.Count(); pos++ {
+		idx.SetType(pos, types[pos%len(types)])
+		all.Set(pos)
+
+		// each commit reaches the objects before it
+		if pos%len(types) == 0 {
+			c.Assert(idx.Add(idx.Hash(pos), all.Clone()), IsNil)
+		}
+	}
+
+	var buf bytes.Buffer
+	c.Assert(bitmap.NewEncoder(&buf).Encode(idx), IsNil)
+
+	decoded := s.newIndex(c)
+	c.Assert(bitmap.NewDecoder(&buf).Decode(decoded), IsNil)
+
+	c.Assert(decoded.Commits(), DeepEquals, idx.Commits())
+	for _, commit := range idx.Commits() {
+		c.Assert(decoded.Bitmap(commit).Equal(idx.Bitmap(commit)), Equals, true)
+		pos, _ := idx.Position(commit)
+		c.Assert(decoded.Objects(decoded.Bitmap(commit)), HasLen, pos+1)
+	}
+
+	for _, t := range types {
+		c.Assert(decoded.TypeBitmap(t).Equal(idx.TypeBitmap(t)), Equals, true)
+	}
+}
+
+func (s *BitmapSuite) TestDecodeMismatch(c *C) {
+	idx := s.newIndex(c)
+
+	var buf bytes.Buffer
+	c.Assert(bitmap.NewEncoder(&buf).Encode(idx), IsNil)
+	data := buf.Bytes()
+
+	other, err := bitmap.NewIndex(plumbing.ZeroHash, new(idxfile.MemoryIndex))
+	c.Assert(err, IsNil)
+	c.Assert(bitmap.NewDecoder(bytes.NewReader(data)).Decode(other), Equals, bitmap.ErrPackfileMismatch)
+
+	data[len(data)-1]++
+	err = bitmap.NewDecoder(bytes.NewReader(data)).Decode(s.newIndex(c))
+	c.Assert(err, Equals, bitmap.ErrMalformedBitmapFile)
+
+	data[5] = 2
+	err = bitmap.NewDecoder(bytes.NewReader(data)).Decode(s.newIndex(c))
+	c.Assert(err, Equals, bitmap.ErrUnsupportedVersion)
+}
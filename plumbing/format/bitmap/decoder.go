@@ -0,0 +1,194 @@
+package bitmap
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"hash"
+	"io"
+	"io/ioutil"
+
+	"gopkg.in/src-d/go-git.v4/utils/binary"
+)
+
+var (
+	// ErrUnsupportedVersion is returned by Decode when the bitmap file
+	// version is not supported.
+	ErrUnsupportedVersion = errors.New("Unsupported version")
+	// ErrUnsupportedFlags is returned by Decode when the bitmap file
+	// doesn't have the BITMAP_OPT_FULL_DAG flag.
+	ErrUnsupportedFlags = errors.New("Unsupported bitmap flags")
+	// ErrMalformedBitmapFile is returned by Decode when the bitmap file is
+	// corrupted.
+	ErrMalformedBitmapFile = errors.New("Malformed bitmap file")
+	// ErrPackfileMismatch is returned by Decode when the bitmap file is of
+	// another packfile.
+	ErrPackfileMismatch = errors.New("Bitmap file doesn't match the packfile")
+)
+
+const (
+	// VersionSupported is the only bitmap file version supported.
+	VersionSupported = 1
+
+	flagFullDAG     = 0x1
+	flagHashCache   = 0x4
+	flagLookupTable = 0x10
+
+	// maxXOROffset is the biggest distance git reads between an entry and
+	// its XOR base.
+	maxXOROffset = 160
+	// lookupTableEntrySize is the size of the entries of the lookup table,
+	// a commit position, an entry offset and a XOR base position.
+	lookupTableEntrySize = 4 + 8 + 4
+)
+
+var bitmapHeader = []byte{'B', 'I', 'T', 'M'}
+
+// Decoder reads and decodes bitmap files from an input stream.
+type Decoder struct {
+	r    *bufio.Reader
+	hash hash.Hash
+	tee  io.Reader
+}
+
+// NewDecoder builds a new bitmap stream decoder, that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	br := bufio.NewReader(r)
+	h := sha1.New()
+	return &Decoder{r: br, hash: h, tee: io.TeeReader(br, h)}
+}
+
+// Decode reads from the stream and decodes the bitmaps into idx, an Index
+// of the packfile of the bitmaps.
+func (d *Decoder) Decode(idx *Index) error {
+	flags, count, err := d.readHeader(idx)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range typeBitmaps {
+		b, err := readEWAH(d.tee)
+		if err != nil {
+			return err
+		}
+
+		idx.types[t] = b
+	}
+
+	if err := d.readBitmaps(idx, count); err != nil {
+		return err
+	}
+
+	if flags&flagHashCache != 0 {
+		if err := d.skip(int64(idx.Count()) * 4); err != nil {
+			return err
+		}
+	}
+
+	if flags&flagLookupTable != 0 {
+		if err := d.skip(int64(count) * lookupTableEntrySize); err != nil {
+			return err
+		}
+	}
+
+	return d.readChecksum()
+}
+
+func (d *Decoder) readHeader(idx *Index) (flags uint16, count uint32, err error) {
+	h := make([]byte, 4)
+	if _, err := io.ReadFull(d.tee, h); err != nil {
+		return 0, 0, err
+	}
+
+	if !bytes.Equal(h, bitmapHeader) {
+		return 0, 0, ErrMalformedBitmapFile
+	}
+
+	v, err := binary.ReadUint16(d.tee)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if v != VersionSupported {
+		return 0, 0, ErrUnsupportedVersion
+	}
+
+	if flags, err = binary.ReadUint16(d.tee); err != nil {
+		return 0, 0, err
+	}
+
+	if flags&flagFullDAG == 0 {
+		return 0, 0, ErrUnsupportedFlags
+	}
+
+	if count, err = binary.ReadUint32(d.tee); err != nil {
+		return 0, 0, err
+	}
+
+	pack, err := binary.ReadHash(d.tee)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if pack != idx.pack {
+		return 0, 0, ErrPackfileMismatch
+	}
+
+	return flags, count, nil
+}
+
+func (d *Decoder) readBitmaps(idx *Index, count uint32) error {
+	entries := make([]*Bitmap, 0, count)
+	for i := 0; i < int(count); i++ {
+		pos, err := binary.ReadUint32(d.tee)
+		if err != nil {
+			return err
+		}
+
+		var xorAndFlags [2]byte
+		if _, err := io.ReadFull(d.tee, xorAndFlags[:]); err != nil {
+			return err
+		}
+
+		b, err := readEWAH(d.tee)
+		if err != nil {
+			return err
+		}
+
+		xor := int(xorAndFlags[0])
+		if int(pos) >= len(idx.sorted) || xor > i || xor > maxXOROffset {
+			return ErrMalformedBitmapFile
+		}
+
+		if xor > 0 {
+			b.Xor(entries[i-xor])
+		}
+
+		entries = append(entries, b)
+		commit := idx.objects[idx.sorted[pos]]
+		if err := idx.Add(commit, b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *Decoder) skip(n int64) error {
+	_, err := io.CopyN(ioutil.Discard, d.tee, n)
+	return err
+}
+
+func (d *Decoder) readChecksum() error {
+	checksum, err := binary.ReadHash(d.r)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(d.hash.Sum(nil), checksum[:]) {
+		return ErrMalformedBitmapFile
+	}
+
+	return nil
+}
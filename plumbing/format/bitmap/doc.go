@@ -0,0 +1,79 @@
+// Package bitmap implements encoding and decoding of the reachability bitmaps
+// of packfiles, the pack-*.bitmap files.
+//
+// A reachability bitmap is a set of objects of a packfile, each bit being the
+// object at that position in the packfile, sorted by offset. The bitmap of a
+// commit has set the objects reachable from it, so the objects to send to a
+// client, or to count, are computed without walking the history.
+//
+// The bitmaps are stored compressed with EWAH, Enhanced Word-Aligned Hybrid:
+//
+//   4-byte number of bits of the bitmap.
+//
+//   4-byte number of 8-byte words of the compressed bitmap.
+//
+//   The 8-byte words, made of run-length words followed by literal words.
+//   The run-length words have the running bit in the least significant bit,
+//   followed by 32 bits with the number of words filled with the running
+//   bit, and 31 bits with the number of literal words that follow. The bits
+//   of the bitmap are the bits of the uncompressed words, from the least
+//   significant one.
+//
+//   4-byte position of the last run-length word.
+//
+// The bitmap file has the following format, all the numbers are in network
+// byte order:
+//
+// HEADER:
+//
+//   4-byte signature:
+//       The signature is: {'B', 'I', 'T', 'M'}
+//
+//   2-byte version number:
+//       Git only writes or recognizes version 1.
+//
+//   2-byte flags:
+//       0x1: BITMAP_OPT_FULL_DAG, the packfile is closed under
+//            reachability, required.
+//       0x4: BITMAP_OPT_HASH_CACHE, the file has the name-hash cache.
+//       0x10: BITMAP_OPT_LOOKUP_TABLE, the file has a lookup table.
+//
+//   4-byte number of commit bitmaps.
+//
+//   20-byte checksum of the packfile.
+//
+// TYPE BITMAPS:
+//
+//   The EWAH bitmaps of the commits, trees, blobs and tags of the
+//   packfile.
+//
+// COMMIT BITMAPS:
+//
+//   For each commit bitmap:
+//
+//   4-byte position of the commit in the idx file, sorted by hash.
+//
+//   1-byte XOR offset, if not zero the bitmap is stored XORed with the one
+//   of the commit that number of entries before.
+//
+//   1-byte flags.
+//
+//   The EWAH bitmap of the objects reachable from the commit.
+//
+// NAME-HASH CACHE (optional):
+//
+//   A 4-byte hash of the path of each object, in idx file order.
+//
+// LOOKUP TABLE (optional):
+//
+//   For each commit bitmap, sorted by commit, the 4-byte position of the
+//   commit in the idx file, the 8-byte offset of the entry and the 4-byte
+//   position of its XOR base entry.
+//
+// TRAILER:
+//
+//   20-byte checksum of all of the above.
+//
+// Source:
+// https://github.com/git/git/blob/master/Documentation/technical/bitmap-format.txt
+package bitmap
@@ -0,0 +1,94 @@
+package bitmap
+
+import (
+	"crypto/sha1"
+	"hash"
+	"io"
+
+	"gopkg.in/src-d/go-git.v4/utils/binary"
+)
+
+// Encoder writes bitmap files to an output stream.
+type Encoder struct {
+	io.Writer
+	hash hash.Hash
+}
+
+// NewEncoder returns a new stream encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	h := sha1.New()
+	mw := io.MultiWriter(w, h)
+	return &Encoder{mw, h}
+}
+
+// Encode writes the bitmaps of idx into the bitmap file. The bitmaps are
+// written without XOR compression nor name-hash cache.
+func (e *Encoder) Encode(idx *Index) error {
+	if err := e.encodeHeader(idx); err != nil {
+		return err
+	}
+
+	for _, t := range typeBitmaps {
+		if err := writeEWAH(e, idx.types[t], idx.Count()); err != nil {
+			return err
+		}
+	}
+
+	if err := e.encodeBitmaps(idx); err != nil {
+		return err
+	}
+
+	return e.encodeChecksum()
+}
+
+func (e *Encoder) encodeHeader(idx *Index) error {
+	if _, err := e.Write(bitmapHeader); err != nil {
+		return err
+	}
+
+	if err := binary.WriteUint16(e, VersionSupported); err != nil {
+		return err
+	}
+
+	if err := binary.WriteUint16(e, flagFullDAG); err != nil {
+		return err
+	}
+
+	if err := binary.WriteUint32(e, uint32(len(idx.commits))); err != nil {
+		return err
+	}
+
+	_, err := e.Write(idx.pack[:])
+	return err
+}
+
+func (e *Encoder) encodeBitmaps(idx *Index) error {
+	// positions of the objects in the idx file
+	sorted := make([]int, len(idx.sorted))
+	for i, pos := range idx.sorted {
+		sorted[pos] = i
+	}
+
+	for _, commit := range idx.commits {
+		pos := sorted[idx.positions[commit]]
+		if err := binary.WriteUint32(e, uint32(pos)); err != nil {
+			return err
+		}
+
+		// XOR offset and flags
+		if _, err := e.Write([]byte{0, 0}); err != nil {
+			return err
+		}
+
+		if err := writeEWAH(e, idx.bitmaps[commit], idx.Count()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *Encoder) encodeChecksum() error {
+	_, err := e.Write(e.hash.Sum(nil))
+	return err
+}
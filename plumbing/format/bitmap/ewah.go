@@ -0,0 +1,264 @@
+package bitmap
+
+import (
+	"io"
+	"math/bits"
+
+	"gopkg.in/src-d/go-git.v4/utils/binary"
+)
+
+const (
+	wordBits = 64
+
+	runningBits       = 32
+	literalBits       = wordBits - 1 - runningBits
+	maxRunningLength  = 1<<runningBits - 1
+	maxLiteralLength  = 1<<literalBits - 1
+	maxEWAHWordsCount = 1 << 31
+)
+
+// Bitmap is a set of positions of objects of a packfile, uncompressed in
+// memory.
+type Bitmap struct {
+	words []uint64
+}
+
+// NewBitmap returns an empty Bitmap.
+func NewBitmap() *Bitmap {
+	return &Bitmap{}
+}
+
+// Set adds the position i to the bitmap.
+func (b *Bitmap) Set(i int) {
+	w := i / wordBits
+	if w >= len(b.words) {
+		words := make([]uint64, w+1)
+		copy(words, b.words)
+		b.words = words
+	}
+
+	b.words[w] |= 1 << uint(i%wordBits)
+}
+
+// Get returns whether the position i is in the bitmap.
+func (b *Bitmap) Get(i int) bool {
+	w := i / wordBits
+	return w < len(b.words) && b.words[w]&(1<<uint(i%wordBits)) != 0
+}
+
+// Or adds the positions of o to the bitmap.
+func (b *Bitmap) Or(o *Bitmap) {
+	if len(o.words) > len(b.words) {
+		words := make([]uint64, len(o.words))
+		copy(words, b.words)
+		b.words = words
+	}
+
+	for i, w := range o.words {
+		b.words[i] |= w
+	}
+}
+
+// And removes the positions not in o from the bitmap.
+func (b *Bitmap) And(o *Bitmap) {
+	for i := range b.words {
+		if i < len(o.words) {
+			b.words[i] &= o.words[i]
+		} else {
+			b.words[i] = 0
+		}
+	}
+}
+
+// AndNot removes the positions of o from the bitmap.
+func (b *Bitmap) AndNot(o *Bitmap) {
+	for i := range b.words {
+		if i >= len(o.words) {
+			break
+		}
+
+		b.words[i] &^= o.words[i]
+	}
+}
+
+// Xor toggles the positions of o in the bitmap.
+func (b *Bitmap) Xor(o *Bitmap) {
+	if len(o.words) > len(b.words) {
+		words := make([]uint64, len(o.words))
+		copy(words, b.words)
+		b.words = words
+	}
+
+	for i, w := range o.words {
+		b.words[i] ^= w
+	}
+}
+
+// Count returns the number of positions in the bitmap.
+func (b *Bitmap) Count() int {
+	var n int
+	for _, w := range b.words {
+		n += bits.OnesCount64(w)
+	}
+
+	return n
+}
+
+// ForEach calls f with each position in the bitmap, in increasing order.
+func (b *Bitmap) ForEach(f func(i int)) {
+	for i, w := range b.words {
+		for w != 0 {
+			bit := bits.TrailingZeros64(w)
+			f(i*wordBits + bit)
+			w &^= 1 << uint(bit)
+		}
+	}
+}
+
+// Clone returns a copy of the bitmap.
+func (b *Bitmap) Clone() *Bitmap {
+	words := make([]uint64, len(b.words))
+	copy(words, b.words)
+	return &Bitmap{words: words}
+}
+
+// Equal returns whether the bitmap has the same positions as o.
+func (b *Bitmap) Equal(o *Bitmap) bool {
+	long, short := b.words, o.words
+	if len(long) < len(short) {
+		long, short = short, long
+	}
+
+	for i, w := range long {
+		if i < len(short) {
+			if w != short[i] {
+				return false
+			}
+		} else if w != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// readEWAH reads a bitmap compressed with EWAH.
+func readEWAH(r io.Reader) (*Bitmap, error) {
+	size, err := binary.ReadUint32(r)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := binary.ReadUint32(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if count >= maxEWAHWordsCount {
+		return nil, ErrMalformedBitmapFile
+	}
+
+	nwords := (int(size) + wordBits - 1) / wordBits
+	b := &Bitmap{words: make([]uint64, 0, nwords)}
+	for read := uint32(0); read < count; {
+		rlw, err := binary.ReadUint64(r)
+		if err != nil {
+			return nil, err
+		}
+
+		read++
+		var fill uint64
+		if rlw&1 != 0 {
+			fill = ^uint64(0)
+		}
+
+		running := int(rlw >> 1 & maxRunningLength)
+		literals := uint32(rlw >> (1 + runningBits))
+		if running > nwords-len(b.words) || literals > count-read {
+			return nil, ErrMalformedBitmapFile
+		}
+
+		for i := 0; i < running; i++ {
+			b.words = append(b.words, fill)
+		}
+
+		for i := uint32(0); i < literals; i++ {
+			w, err := binary.ReadUint64(r)
+			if err != nil {
+				return nil, err
+			}
+
+			b.words = append(b.words, w)
+		}
+
+		read += literals
+	}
+
+	if len(b.words) > nwords {
+		return nil, ErrMalformedBitmapFile
+	}
+
+	// the position of the last run-length word
+	if _, err := binary.ReadUint32(r); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// writeEWAH writes the first size bits of the bitmap compressed with EWAH.
+func writeEWAH(w io.Writer, b *Bitmap, size int) error {
+	nwords := (size + wordBits - 1) / wordBits
+	word := func(i int) uint64 {
+		if i < len(b.words) {
+			return b.words[i]
+		}
+
+		return 0
+	}
+
+	var out []uint64
+	var lastRLW int
+	for i := 0; i < nwords || len(out) == 0; {
+		var rlw uint64
+		if i < nwords && word(i) == ^uint64(0) {
+			rlw = 1
+		}
+
+		var running uint64
+		for i < nwords && running < maxRunningLength &&
+			(word(i) == 0 && rlw == 0 || word(i) == ^uint64(0) && rlw == 1) {
+			running++
+			i++
+		}
+
+		start := i
+		for i < nwords && i-start < maxLiteralLength &&
+			word(i) != 0 && word(i) != ^uint64(0) {
+			i++
+		}
+
+		lastRLW = len(out)
+		rlw |= running<<1 | uint64(i-start)<<(1+runningBits)
+		out = append(out, rlw)
+		for j := start; j < i; j++ {
+			out = append(out, word(j))
+		}
+	}
+
+	if err := binary.WriteUint32(w, uint32(size)); err != nil {
+		return err
+	}
+
+	if err := binary.WriteUint32(w, uint32(len(out))); err != nil {
+		return err
+	}
+
+	for _, word := range out {
+		if err := binary.WriteUint64(w, word); err != nil {
+			return err
+		}
+	}
+
+	return binary.WriteUint32(w, uint32(lastRLW))
+}
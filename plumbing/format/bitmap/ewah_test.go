@@ -0,0 +1,66 @@
+package bitmap
+
+import (
+	"bytes"
+
+	. "gopkg.in/check.v1"
+)
+
+type EWAHSuite struct{}
+
+var _ = Suite(&EWAHSuite{})
+
+func (s *EWAHSuite) testRoundTrip(c *C, b *Bitmap, size int) {
+	var buf bytes.Buffer
+	c.Assert(writeEWAH(&buf, b, size), IsNil)
+
+	decoded, err := readEWAH(&buf)
+	c.Assert(err, IsNil)
+	c.Assert(decoded.Equal(b), Equals, true)
+	c.Assert(buf.Len(), Equals, 0)
+}
+
+func (s *EWAHSuite) TestRoundTrip(c *C) {
+	s.testRoundTrip(c, NewBitmap(), 0)
+	s.testRoundTrip(c, NewBitmap(), 1000)
+
+	sparse := NewBitmap()
+	for _, i := range []int{0, 63, 64, 1000, 5000, 5001} {
+		sparse.Set(i)
+	}
+
+	s.testRoundTrip(c, sparse, 6000)
+
+	full := NewBitmap()
+	for i := 0; i < 64*10; i++ {
+		full.Set(i)
+	}
+
+	full.Set(64*20 + 3)
+	s.testRoundTrip(c, full, 64*21)
+}
+
+func (s *EWAHSuite) TestCompression(c *C) {
+	b := NewBitmap()
+	b.Set(64 * 1000)
+
+	var buf bytes.Buffer
+	c.Assert(writeEWAH(&buf, b, 64*1000+1), IsNil)
+
+	// sizes, a run-length word with a literal word and the last run-length
+	// word position
+	c.Assert(buf.Len(), Equals, 4+4+8+8+4)
+}
+
+func (s *EWAHSuite) TestMalformed(c *C) {
+	var buf bytes.Buffer
+	b := NewBitmap()
+	b.Set(200)
+	c.Assert(writeEWAH(&buf, b, 201), IsNil)
+
+	// fewer bits than the ones compressed
+	data := buf.Bytes()
+	data[3] = 64
+	_, err := readEWAH(bytes.NewReader(data))
+	c.Assert(err, Equals, ErrMalformedBitmapFile)
+}
@@ -0,0 +1,103 @@
+package bundle
+
+import (
+	"errors"
+	"io"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+const (
+	// V2 is the version 2 of the bundle format, it doesn't support
+	// capabilities.
+	V2 = 2
+	// V3 is the version 3 of the bundle format, which adds capabilities.
+	V3 = 3
+
+	// ObjectFormatCapability is the capability declaring the hash algorithm
+	// used by the objects of the bundle.
+	ObjectFormatCapability = "object-format"
+	// FilterCapability is the capability declaring the bundle packfile is
+	// filtered with the given object filter.
+	FilterCapability = "filter"
+)
+
+var (
+	// ErrUnsupportedVersion is returned when the bundle version is unknown.
+	ErrUnsupportedVersion = errors.New("bundle: unsupported version")
+	// ErrMalformedBundle is returned when the bundle header is corrupted.
+	ErrMalformedBundle = errors.New("bundle: malformed header")
+	// ErrCapabilitiesNotAllowed is returned when encoding a bundle with
+	// capabilities and a version that doesn't support them.
+	ErrCapabilitiesNotAllowed = errors.New("bundle: capabilities require version 3")
+	// ErrUnsupportedCapability is returned when a bundle declares a
+	// capability that can't be handled.
+	ErrUnsupportedCapability = errors.New("bundle: unsupported capability")
+)
+
+// Prerequisite is a commit that must exist in the repository unbundling the
+// bundle.
+type Prerequisite struct {
+	// Hash of the commit.
+	Hash plumbing.Hash
+	// Comment is a free-form text, usually the subject of the commit.
+	Comment string
+}
+
+// Bundle represents a git bundle.
+type Bundle struct {
+	// Version of the bundle, V2 or V3.
+	Version int
+	// Capabilities of the bundle, only allowed on V3 bundles. A capability
+	// without value is stored with an empty string.
+	Capabilities map[string]string
+	// Prerequisites the repository must have to unbundle this bundle.
+	Prerequisites []Prerequisite
+	// References contained by the bundle, only hash references are allowed.
+	References []*plumbing.Reference
+	// Packfile is the packfile content of the bundle. When decoding it reads
+	// from the remaining of the input stream, when encoding, if not nil, it
+	// is copied after the header.
+	Packfile io.Reader
+}
+
+// New returns a new empty V2 bundle.
+func New() *Bundle {
+	return &Bundle{
+		Version:      V2,
+		Capabilities: make(map[string]string),
+	}
+}
+
+// Reference returns the reference with the given name or
+// plumbing.ErrReferenceNotFound.
+func (b *Bundle) Reference(n plumbing.ReferenceName) (*plumbing.Reference, error) {
+	for _, r := range b.References {
+		if r.Name() == n {
+			return r, nil
+		}
+	}
+
+	return nil, plumbing.ErrReferenceNotFound
+}
+
+// Heads returns the references of the bundle matching any of the given
+// names, or all of them if no name is given, in the bundle order. It is the
+// equivalent of `git bundle list-heads`.
+func (b *Bundle) Heads(names ...plumbing.ReferenceName) []*plumbing.Reference {
+	if len(names) == 0 {
+		return b.References
+	}
+
+	var refs []*plumbing.Reference
+	for _, r := range b.References {
+		for _, n := range names {
+			if r.Name() == n {
+				refs = append(refs, r)
+				break
+			}
+		}
+	}
+
+	return refs
+}
@@ -0,0 +1,163 @@
+package bundle
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type BundleSuite struct{}
+
+var _ = Suite(&BundleSuite{})
+
+const v2Bundle = "# v2 git bundle\n" +
+	"-a5b8b09e2f8fcb0bb99d3ccb0958157b40890d69 vendor stuff\n" +
+	"6ecf0ef2c2dffb796033e5a02219af86ec6584e5 refs/heads/master\n" +
+	"6ecf0ef2c2dffb796033e5a02219af86ec6584e5 HEAD\n" +
+	"\n" +
+	"PACK"
+
+func (s *BundleSuite) TestDecode(c *C) {
+	b := New()
+	err := NewDecoder(bytes.NewBufferString(v2Bundle)).Decode(b)
+	c.Assert(err, IsNil)
+
+	c.Assert(b.Version, Equals, V2)
+	c.Assert(b.Capabilities, HasLen, 0)
+	c.Assert(b.Prerequisites, DeepEquals, []Prerequisite{{
+		Hash:    plumbing.NewHash("a5b8b09e2f8fcb0bb99d3ccb0958157b40890d69"),
+		Comment: "vendor stuff",
+	}})
+
+	c.Assert(b.References, HasLen, 2)
+	c.Assert(b.References[0].Name(), Equals, plumbing.Master)
+	c.Assert(b.References[1].Name(), Equals, plumbing.HEAD)
+	c.Assert(b.References[1].Hash().String(), Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+
+	pack, err := ioutil.ReadAll(b.Packfile)
+	c.Assert(err, IsNil)
+	c.Assert(string(pack), Equals, "PACK")
+}
+
+func (s *BundleSuite) TestDecodeV3(c *C) {
+	input := "# v3 git bundle\n" +
+		"@object-format=sha1\n" +
+		"@filter=blob:none\n" +
+		"6ecf0ef2c2dffb796033e5a02219af86ec6584e5 refs/heads/master\n" +
+		"\n"
+
+	b := New()
+	err := NewDecoder(bytes.NewBufferString(input)).Decode(b)
+	c.Assert(err, IsNil)
+	c.Assert(b.Version, Equals, V3)
+	c.Assert(b.Capabilities, DeepEquals, map[string]string{
+		ObjectFormatCapability: "sha1",
+		FilterCapability:       "blob:none",
+	})
+	c.Assert(b.References, HasLen, 1)
+}
+
+func (s *BundleSuite) TestDecodeErrors(c *C) {
+	for input, expected := range map[string]error{
+		"":                                    ErrMalformedBundle,
+		"foo\n":                               ErrMalformedBundle,
+		"# v4 git bundle\n\n":                 ErrUnsupportedVersion,
+		"# v2 git bundle\n@object-format\n\n": ErrCapabilitiesNotAllowed,
+		"# v3 git bundle\n@object-format=sha256\n\n":                         ErrUnsupportedCapability,
+		"# v2 git bundle\n-foo\n\n":                                          ErrMalformedBundle,
+		"# v2 git bundle\nfoo refs/heads/master\n\n":                         ErrMalformedBundle,
+		"# v2 git bundle\n6ECF0EF2C2DFFB796033E5A02219AF86EC6584E5 HEAD\n\n": ErrMalformedBundle,
+		"# v2 git bundle\n6ecf0ef2c2dffb796033e5a02219af86ec6584e5\n\n":      ErrMalformedBundle,
+		"# v2 git bundle\n6ecf0ef2c2dffb796033e5a02219af86ec6584e5 HEAD\n":   ErrMalformedBundle,
+	} {
+		err := NewDecoder(bytes.NewBufferString(input)).Decode(New())
+		c.Assert(err, Equals, expected, Commentf("input: %q", input))
+	}
+}
+
+func (s *BundleSuite) TestEncode(c *C) {
+	b := New()
+	b.Prerequisites = []Prerequisite{{
+		Hash:    plumbing.NewHash("a5b8b09e2f8fcb0bb99d3ccb0958157b40890d69"),
+		Comment: "vendor stuff",
+	}}
+	b.References = []*plumbing.Reference{
+		plumbing.NewHashReference(plumbing.Master, plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")),
+		plumbing.NewHashReference(plumbing.HEAD, plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")),
+	}
+	b.Packfile = bytes.NewBufferString("PACK")
+
+	buf := bytes.NewBuffer(nil)
+	err := NewEncoder(buf).Encode(b)
+	c.Assert(err, IsNil)
+	c.Assert(buf.String(), Equals, v2Bundle)
+}
+
+func (s *BundleSuite) TestEncodeV3(c *C) {
+	b := New()
+	b.Version = V3
+	b.Capabilities[ObjectFormatCapability] = "sha1"
+	b.Capabilities["foo"] = ""
+	b.Prerequisites = []Prerequisite{{
+		Hash: plumbing.NewHash("a5b8b09e2f8fcb0bb99d3ccb0958157b40890d69"),
+	}}
+
+	buf := bytes.NewBuffer(nil)
+	err := NewEncoder(buf).Encode(b)
+	c.Assert(err, IsNil)
+	c.Assert(buf.String(), Equals, "# v3 git bundle\n"+
+		"@foo\n"+
+		"@object-format=sha1\n"+
+		"-a5b8b09e2f8fcb0bb99d3ccb0958157b40890d69\n"+
+		"\n")
+
+	decoded := New()
+	err = NewDecoder(buf).Decode(decoded)
+	c.Assert(err, IsNil)
+	c.Assert(decoded.Capabilities, DeepEquals, b.Capabilities)
+	c.Assert(decoded.Prerequisites, DeepEquals, b.Prerequisites)
+}
+
+func (s *BundleSuite) TestEncodeErrors(c *C) {
+	b := New()
+	b.Capabilities[ObjectFormatCapability] = "sha1"
+	err := NewEncoder(ioutil.Discard).Encode(b)
+	c.Assert(err, Equals, ErrCapabilitiesNotAllowed)
+
+	b = New()
+	b.Version = 1
+	err = NewEncoder(ioutil.Discard).Encode(b)
+	c.Assert(err, Equals, ErrUnsupportedVersion)
+
+	b = New()
+	b.References = []*plumbing.Reference{
+		plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.Master),
+	}
+	err = NewEncoder(ioutil.Discard).Encode(b)
+	c.Assert(err, Equals, plumbing.ErrInvalidType)
+}
+
+func (s *BundleSuite) TestHeads(c *C) {
+	b := New()
+	err := NewDecoder(bytes.NewBufferString(v2Bundle)).Decode(b)
+	c.Assert(err, IsNil)
+
+	c.Assert(b.Heads(), HasLen, 2)
+
+	heads := b.Heads(plumbing.HEAD, "refs/heads/foo")
+	c.Assert(heads, HasLen, 1)
+	c.Assert(heads[0].Name(), Equals, plumbing.HEAD)
+
+	ref, err := b.Reference(plumbing.Master)
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash().String(), Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+
+	_, err = b.Reference("refs/heads/foo")
+	c.Assert(err, Equals, plumbing.ErrReferenceNotFound)
+}
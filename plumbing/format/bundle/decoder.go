@@ -0,0 +1,144 @@
+package bundle
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+var (
+	v2Signature = []byte("# v2 git bundle\n")
+	v3Signature = []byte("# v3 git bundle\n")
+)
+
+// Decoder reads and decodes bundles from an input stream.
+type Decoder struct {
+	r *bufio.Reader
+}
+
+// NewDecoder returns a new decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{bufio.NewReader(r)}
+}
+
+// Decode reads the bundle header into b, after it b.Packfile reads the
+// packfile from the remaining of the input stream.
+func (d *Decoder) Decode(b *Bundle) error {
+	if err := d.decodeSignature(b); err != nil {
+		return err
+	}
+
+	if b.Capabilities == nil {
+		b.Capabilities = make(map[string]string)
+	}
+
+	for {
+		line, err := d.r.ReadBytes('\n')
+		if err != nil {
+			if err == io.EOF {
+				return ErrMalformedBundle
+			}
+
+			return err
+		}
+
+		line = bytes.TrimSuffix(line, []byte{'\n'})
+		if len(line) == 0 {
+			break
+		}
+
+		switch line[0] {
+		case '@':
+			err = d.decodeCapability(b, string(line[1:]))
+		case '-':
+			err = d.decodePrerequisite(b, string(line[1:]))
+		default:
+			err = d.decodeReference(b, string(line))
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	b.Packfile = d.r
+	return nil
+}
+
+func (d *Decoder) decodeSignature(b *Bundle) error {
+	sig, err := d.r.ReadBytes('\n')
+	if err != nil {
+		if err == io.EOF {
+			return ErrMalformedBundle
+		}
+
+		return err
+	}
+
+	switch {
+	case bytes.Equal(sig, v2Signature):
+		b.Version = V2
+	case bytes.Equal(sig, v3Signature):
+		b.Version = V3
+	case bytes.HasPrefix(sig, []byte("# v")):
+		return ErrUnsupportedVersion
+	default:
+		return ErrMalformedBundle
+	}
+
+	return nil
+}
+
+func (d *Decoder) decodeCapability(b *Bundle, line string) error {
+	if b.Version < V3 {
+		return ErrCapabilitiesNotAllowed
+	}
+
+	var key, value string
+	if i := strings.IndexByte(line, '='); i >= 0 {
+		key, value = line[:i], line[i+1:]
+	} else {
+		key = line
+	}
+
+	if key == ObjectFormatCapability && value != "sha1" {
+		return ErrUnsupportedCapability
+	}
+
+	b.Capabilities[key] = value
+	return nil
+}
+
+func (d *Decoder) decodePrerequisite(b *Bundle, line string) error {
+	hash, comment := line, ""
+	if i := strings.IndexByte(line, ' '); i >= 0 {
+		hash, comment = line[:i], line[i+1:]
+	}
+
+	if !plumbing.IsHash(hash) {
+		return ErrMalformedBundle
+	}
+
+	b.Prerequisites = append(b.Prerequisites, Prerequisite{
+		Hash:    plumbing.NewHash(hash),
+		Comment: comment,
+	})
+
+	return nil
+}
+
+func (d *Decoder) decodeReference(b *Bundle, line string) error {
+	i := strings.IndexByte(line, ' ')
+	if i < 0 || !plumbing.IsHash(line[:i]) || i+1 == len(line) {
+		return ErrMalformedBundle
+	}
+
+	b.References = append(b.References, plumbing.NewHashReference(
+		plumbing.ReferenceName(line[i+1:]), plumbing.NewHash(line[:i]),
+	))
+
+	return nil
+}
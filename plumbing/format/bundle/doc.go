@@ -0,0 +1,22 @@
+// Package bundle implements encoding and decoding of git bundle files.
+//
+// A bundle is a header describing references and prerequisites followed by a
+// packfile, it is used to transfer repositories without a network connection.
+// See https://git-scm.com/docs/gitformat-bundle for the full specification.
+//
+//	bundle    = signature *capability *prerequisite *reference LF pack
+//	signature = v2-signature / v3-signature
+//	v2-signature = "# v2 git bundle" LF
+//	v3-signature = "# v3 git bundle" LF
+//
+//	capability   = "@" key ["=" value] LF
+//	prerequisite = "-" obj-id SP comment LF
+//	comment      = *CHAR
+//	reference    = obj-id SP refname LF
+//
+//	pack         = ... ; packfile
+//
+// Capabilities are only allowed in version 3 bundles. A prerequisite is a
+// commit the receiving repository must already have, the packfile is allowed
+// to contain deltas against the objects reachable from it.
+package bundle
@@ -0,0 +1,104 @@
+package bundle
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// Encoder writes bundles to an output stream.
+type Encoder struct {
+	w io.Writer
+}
+
+// NewEncoder returns a new encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w}
+}
+
+// Encode writes the bundle header of b and, if not nil, copies b.Packfile
+// after it.
+func (e *Encoder) Encode(b *Bundle) error {
+	if err := e.encodeSignature(b); err != nil {
+		return err
+	}
+
+	if err := e.encodeCapabilities(b); err != nil {
+		return err
+	}
+
+	for _, p := range b.Prerequisites {
+		line := "-" + p.Hash.String()
+		if p.Comment != "" {
+			line += " " + p.Comment
+		}
+
+		if _, err := fmt.Fprintln(e.w, line); err != nil {
+			return err
+		}
+	}
+
+	for _, r := range b.References {
+		if r.Type() != plumbing.HashReference {
+			return plumbing.ErrInvalidType
+		}
+
+		if _, err := fmt.Fprintf(e.w, "%s %s\n", r.Hash(), r.Name()); err != nil {
+			return err
+		}
+	}
+
+	if _, err := e.w.Write([]byte{'\n'}); err != nil {
+		return err
+	}
+
+	if b.Packfile == nil {
+		return nil
+	}
+
+	_, err := io.Copy(e.w, b.Packfile)
+	return err
+}
+
+func (e *Encoder) encodeSignature(b *Bundle) error {
+	var sig []byte
+	switch b.Version {
+	case V2:
+		if len(b.Capabilities) != 0 {
+			return ErrCapabilitiesNotAllowed
+		}
+
+		sig = v2Signature
+	case V3:
+		sig = v3Signature
+	default:
+		return ErrUnsupportedVersion
+	}
+
+	_, err := e.w.Write(sig)
+	return err
+}
+
+func (e *Encoder) encodeCapabilities(b *Bundle) error {
+	keys := make([]string, 0, len(b.Capabilities))
+	for k := range b.Capabilities {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		line := "@" + k
+		if v := b.Capabilities[k]; v != "" {
+			line += "=" + v
+		}
+
+		if _, err := fmt.Fprintln(e.w, line); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,174 @@
+package commitgraph
+
+import (
+	"math/bits"
+	"strings"
+)
+
+const (
+	// BloomHashVersion is the version of the hash function of the
+	// changed-path Bloom filters, the murmur3 variant of git.
+	BloomHashVersion = 1
+	// BloomNumHashes is the number of hashes of a path set in the filters.
+	BloomNumHashes = 7
+	// BloomBitsPerEntry is the number of bits of the filters per path.
+	BloomBitsPerEntry = 10
+	// BloomMaxChangedPaths is the maximum number of paths of a filter, the
+	// commits changing more paths have a filter that contains any path.
+	BloomMaxChangedPaths = 512
+
+	bloomSeed0 = 0x293ae76f
+	bloomSeed1 = 0x7e646e2c
+)
+
+// BloomFilter is the changed-path Bloom filter of a commit, with the paths
+// changed from its first parent, or all the paths of a root commit, along
+// with their leading directories. It tells if a path definitely wasn't
+// changed by the commit.
+type BloomFilter struct {
+	data      []byte
+	numHashes int
+}
+
+// NewBloomFilter returns a filter with the given changed paths and their
+// leading directories.
+func NewBloomFilter(paths []string) *BloomFilter {
+	keys := make(map[string]bool)
+	for _, path := range paths {
+		for _, key := range bloomKeys(path) {
+			keys[key] = true
+		}
+	}
+
+	f := &BloomFilter{numHashes: BloomNumHashes}
+	switch {
+	case len(keys) > BloomMaxChangedPaths:
+		f.data = []byte{0xff}
+		return f
+	case len(keys) == 0:
+		f.data = []byte{0}
+		return f
+	}
+
+	f.data = make([]byte, (len(keys)*BloomBitsPerEntry+7)/8)
+	for key := range keys {
+		f.add(key)
+	}
+
+	return f
+}
+
+// Contains returns false if the path, a file or a directory, definitely
+// wasn't changed by the commit. A true value means it may have been changed.
+func (f *BloomFilter) Contains(path string) bool {
+	for _, key := range bloomKeys(path) {
+		if !f.contains(key) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Bytes returns the content of the filter as stored in a commit-graph.
+func (f *BloomFilter) Bytes() []byte {
+	return f.data
+}
+
+func (f *BloomFilter) add(key string) {
+	f.forEachBit(key, func(i int, mask byte) bool {
+		f.data[i] |= mask
+		return true
+	})
+}
+
+func (f *BloomFilter) contains(key string) bool {
+	return f.forEachBit(key, func(i int, mask byte) bool {
+		return f.data[i]&mask != 0
+	})
+}
+
+// forEachBit calls fn with the position of the bits of the key, stopping
+// when fn returns false. It returns false if fn did.
+func (f *BloomFilter) forEachBit(key string, fn func(i int, mask byte) bool) bool {
+	bitCount := uint32(len(f.data)) * 8
+	if bitCount == 0 {
+		return true
+	}
+
+	h0 := murmur3(bloomSeed0, key)
+	h1 := murmur3(bloomSeed1, key)
+	for i := 0; i < f.numHashes; i++ {
+		pos := (h0 + uint32(i)*h1) % bitCount
+		if !fn(int(pos/8), byte(1)<<(pos%8)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// bloomKeys returns the path, without trailing slashes, along with its
+// leading directories.
+func bloomKeys(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+
+	keys := []string{path}
+	for i := strings.LastIndexByte(path, '/'); i > 0; i = strings.LastIndexByte(path[:i], '/') {
+		keys = append(keys, path[:i])
+	}
+
+	return keys
+}
+
+// murmur3 is the 32-bit murmur3 hash as computed by git for the version 1 of
+// the filters, which sign-extends every byte of the data.
+func murmur3(seed uint32, data string) uint32 {
+	const (
+		c1 = 0xcc9e2d51
+		c2 = 0x1b873593
+	)
+
+	h := seed
+	n := len(data) / 4
+	for i := 0; i < n; i++ {
+		k := uint32(int8(data[4*i])) | uint32(int8(data[4*i+1]))<<8 |
+			uint32(int8(data[4*i+2]))<<16 | uint32(int8(data[4*i+3]))<<24
+
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+
+		h ^= k
+		h = bits.RotateLeft32(h, 13)
+		h = h*5 + 0xe6546b64
+	}
+
+	tail := data[4*n:]
+	var k uint32
+	switch len(tail) {
+	case 3:
+		k ^= uint32(int8(tail[2])) << 16
+		fallthrough
+	case 2:
+		k ^= uint32(int8(tail[1])) << 8
+		fallthrough
+	case 1:
+		k ^= uint32(int8(tail[0]))
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+	}
+
+	h ^= uint32(len(data))
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
@@ -18,8 +18,15 @@ type CommitData struct {
 	// Generation number is the pre-computed generation in the commit graph
 	// or zero if not available
 	Generation int
+	// GenerationV2 is the corrected commit date of the commit, the maximum
+	// of its commit date and one more than the corrected commit dates of its
+	// parents, or zero if not available
+	GenerationV2 uint64
 	// When is the timestamp of the commit.
 	When time.Time
+	// BloomFilter is the changed-path Bloom filter of the commit, or nil if
+	// not available.
+	BloomFilter *BloomFilter
 }
 
 // Index represents a representation of commit graph that allows indexed
@@ -1,6 +1,9 @@
 package commitgraph_test
 
 import (
+	"bytes"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path"
@@ -27,6 +30,15 @@ func testDecodeHelper(c *C, path string) {
 	index, err := commitgraph.OpenFileIndex(reader)
 	c.Assert(err, IsNil)
 
+	testIndexHelper(c, index)
+
+	// Check all hashes
+	hashes := index.Hashes()
+	c.Assert(hashes[0].String(), Equals, "03d2c021ff68954cf3ef0a36825e194a4b98f981")
+	c.Assert(hashes[10].String(), Equals, "e713b52d7e13807e87a002e812041f248db3f643")
+}
+
+func testIndexHelper(c *C, index commitgraph.Index) {
 	// Root commit
 	nodeIndex, err := index.GetIndexByHash(plumbing.NewHash("347c91919944a68e9413581a1bc15519550a3afe"))
 	c.Assert(err, IsNil)
@@ -65,11 +77,7 @@ func testDecodeHelper(c *C, path string) {
 	c.Assert(commitData.ParentHashes[1].String(), Equals, "bb13916df33ed23004c3ce9ed3b8487528e655c1")
 	c.Assert(commitData.ParentHashes[2].String(), Equals, "a45273fe2d63300e1962a9e26a6b15c276cd7082")
 
-	// Check all hashes
-	hashes := index.Hashes()
-	c.Assert(len(hashes), Equals, 11)
-	c.Assert(hashes[0].String(), Equals, "03d2c021ff68954cf3ef0a36825e194a4b98f981")
-	c.Assert(hashes[10].String(), Equals, "e713b52d7e13807e87a002e812041f248db3f643")
+	c.Assert(index.Hashes(), HasLen, 11)
 }
 
 func (s *CommitgraphSuite) TestDecode(c *C) {
@@ -130,3 +138,220 @@ func (s *CommitgraphSuite) TestReencodeInMemory(c *C) {
 		testDecodeHelper(c, tmpName)
 	})
 }
+
+func (s *CommitgraphSuite) TestBloomFilter(c *C) {
+	filter := commitgraph.NewBloomFilter([]string{"foo/bar/baz.go", "qux"})
+	c.Assert(filter.Bytes(), HasLen, 5)
+	for _, path := range []string{"foo/bar/baz.go", "foo/bar", "foo", "qux", "foo/bar/"} {
+		c.Assert(filter.Contains(path), Equals, true, Commentf("path: %s", path))
+	}
+
+	for _, path := range []string{"foo/bar/qux.go", "bar", "foo/qux"} {
+		c.Assert(filter.Contains(path), Equals, false, Commentf("path: %s", path))
+	}
+
+	empty := commitgraph.NewBloomFilter(nil)
+	c.Assert(empty.Bytes(), DeepEquals, []byte{0})
+	c.Assert(empty.Contains("foo"), Equals, false)
+
+	var paths []string
+	for i := 0; i <= commitgraph.BloomMaxChangedPaths; i++ {
+		paths = append(paths, fmt.Sprintf("file-%d", i))
+	}
+
+	large := commitgraph.NewBloomFilter(paths)
+	c.Assert(large.Bytes(), DeepEquals, []byte{0xff})
+	c.Assert(large.Contains("foo"), Equals, true)
+}
+
+func (s *CommitgraphSuite) TestBloomFilterHighBitPaths(c *C) {
+	// filter written by git 2.39 with "commit-graph write --changed-paths"
+	// for a root commit adding these two files
+	expected := []byte{0x99, 0x21, 0x82, 0xfe, 0xaf}
+
+	filter := commitgraph.NewBloomFilter([]string{"\xc3\xa9\xc3\xa8dir/\xc3\xa9t\xc3\xa9.txt", "foo/bar.go"})
+	c.Assert(filter.Bytes(), DeepEquals, expected)
+}
+
+func (s *CommitgraphSuite) TestReencodeBloomFilters(c *C) {
+	fixtures.ByTag("commit-graph").Test(c, func(f *fixtures.Fixture) {
+		dotgit := f.DotGit()
+
+		reader, err := os.Open(path.Join(dotgit.Root(), "objects", "info", "commit-graph"))
+		c.Assert(err, IsNil)
+		defer reader.Close()
+		index, err := commitgraph.OpenFileIndex(reader)
+		c.Assert(err, IsNil)
+
+		memoryIndex := commitgraph.NewMemoryIndex()
+		for i, hash := range index.Hashes() {
+			commitData, err := index.GetCommitDataByIndex(i)
+			c.Assert(err, IsNil)
+			c.Assert(commitData.BloomFilter, IsNil)
+
+			// the root commit filter isn't computed
+			if len(commitData.ParentHashes) != 0 {
+				commitData.BloomFilter = commitgraph.NewBloomFilter([]string{hash.String()})
+			}
+
+			memoryIndex.Add(hash, commitData)
+		}
+
+		buf := bytes.NewBuffer(nil)
+		c.Assert(commitgraph.NewEncoder(buf).Encode(memoryIndex), IsNil)
+
+		decoded, err := commitgraph.OpenFileIndex(bytes.NewReader(buf.Bytes()))
+		c.Assert(err, IsNil)
+		testIndexHelper(c, decoded)
+
+		for i, hash := range decoded.Hashes() {
+			commitData, err := decoded.GetCommitDataByIndex(i)
+			c.Assert(err, IsNil)
+			if len(commitData.ParentHashes) == 0 {
+				c.Assert(commitData.BloomFilter, IsNil)
+				continue
+			}
+
+			c.Assert(commitData.BloomFilter, NotNil)
+			c.Assert(commitData.BloomFilter.Contains(hash.String()), Equals, true)
+		}
+	})
+}
+
+func (s *CommitgraphSuite) TestReencodeGenerationV2(c *C) {
+	fixtures.ByTag("commit-graph").Test(c, func(f *fixtures.Fixture) {
+		dotgit := f.DotGit()
+
+		reader, err := os.Open(path.Join(dotgit.Root(), "objects", "info", "commit-graph"))
+		c.Assert(err, IsNil)
+		defer reader.Close()
+		index, err := commitgraph.OpenFileIndex(reader)
+		c.Assert(err, IsNil)
+
+		// the offsets of the root commits overflow
+		expected := make(map[plumbing.Hash]uint64)
+		memoryIndex := commitgraph.NewMemoryIndex()
+		for i, hash := range index.Hashes() {
+			commitData, err := index.GetCommitDataByIndex(i)
+			c.Assert(err, IsNil)
+			c.Assert(commitData.GenerationV2, Equals, uint64(0))
+
+			offset := uint64(commitData.Generation)
+			if len(commitData.ParentHashes) == 0 {
+				offset = 1 << 32
+			}
+
+			commitData.GenerationV2 = uint64(commitData.When.Unix()) + offset
+			expected[hash] = commitData.GenerationV2
+			memoryIndex.Add(hash, commitData)
+		}
+
+		buf := bytes.NewBuffer(nil)
+		c.Assert(commitgraph.NewEncoder(buf).Encode(memoryIndex), IsNil)
+
+		decoded, err := commitgraph.OpenFileIndex(bytes.NewReader(buf.Bytes()))
+		c.Assert(err, IsNil)
+		testIndexHelper(c, decoded)
+
+		for i, hash := range decoded.Hashes() {
+			commitData, err := decoded.GetCommitDataByIndex(i)
+			c.Assert(err, IsNil)
+			c.Assert(commitData.GenerationV2, Equals, expected[hash])
+		}
+	})
+}
+
+func (s *CommitgraphSuite) TestEncodeLayer(c *C) {
+	fixtures.ByTag("commit-graph").Test(c, func(f *fixtures.Fixture) {
+		dotgit := f.DotGit()
+
+		reader, err := os.Open(path.Join(dotgit.Root(), "objects", "info", "commit-graph"))
+		c.Assert(err, IsNil)
+		defer reader.Close()
+		index, err := commitgraph.OpenFileIndex(reader)
+		c.Assert(err, IsNil)
+
+		// the base layer has the commits of the lower generations, which
+		// include all their parents
+		baseIndex := commitgraph.NewMemoryIndex()
+		for i, hash := range index.Hashes() {
+			commitData, err := index.GetCommitDataByIndex(i)
+			c.Assert(err, IsNil)
+			if commitData.Generation <= 3 {
+				baseIndex.Add(hash, commitData)
+			}
+		}
+
+		base := bytes.NewBuffer(nil)
+		c.Assert(commitgraph.NewEncoder(base).Encode(baseIndex), IsNil)
+		baseHash := plumbing.NewHash(fmt.Sprintf("%x", base.Bytes()[base.Len()-20:]))
+
+		readers := []io.ReaderAt{bytes.NewReader(base.Bytes())}
+		baseChain, err := commitgraph.OpenChainIndex(readers)
+		c.Assert(err, IsNil)
+
+		top := bytes.NewBuffer(nil)
+		err = commitgraph.NewEncoder(top).EncodeLayer(index, baseChain, []plumbing.Hash{baseHash})
+		c.Assert(err, IsNil)
+
+		// a layer can't be open as a commit-graph file
+		_, err = commitgraph.OpenFileIndex(bytes.NewReader(top.Bytes()))
+		c.Assert(err, Equals, commitgraph.ErrMalformedCommitGraphFile)
+
+		chain, err := commitgraph.OpenChainIndex(append(readers, bytes.NewReader(top.Bytes())))
+		c.Assert(err, IsNil)
+		c.Assert(len(chain.Hashes()), Equals, 11)
+
+		testIndexHelper(c, chain)
+	})
+}
+
+func (s *CommitgraphSuite) TestChainGenerationV2MissingInLayer(c *C) {
+	fixtures.ByTag("commit-graph").Test(c, func(f *fixtures.Fixture) {
+		dotgit := f.DotGit()
+
+		reader, err := os.Open(path.Join(dotgit.Root(), "objects", "info", "commit-graph"))
+		c.Assert(err, IsNil)
+		defer reader.Close()
+		index, err := commitgraph.OpenFileIndex(reader)
+		c.Assert(err, IsNil)
+
+		// the base layer has the corrected commit dates, the top one doesn't
+		baseIndex := commitgraph.NewMemoryIndex()
+		for i, hash := range index.Hashes() {
+			commitData, err := index.GetCommitDataByIndex(i)
+			c.Assert(err, IsNil)
+			if commitData.Generation <= 3 {
+				commitData.GenerationV2 = uint64(commitData.When.Unix()) + uint64(commitData.Generation)
+				baseIndex.Add(hash, commitData)
+			}
+		}
+
+		base := bytes.NewBuffer(nil)
+		c.Assert(commitgraph.NewEncoder(base).Encode(baseIndex), IsNil)
+		baseHash := plumbing.NewHash(fmt.Sprintf("%x", base.Bytes()[base.Len()-20:]))
+
+		readers := []io.ReaderAt{bytes.NewReader(base.Bytes())}
+		baseChain, err := commitgraph.OpenChainIndex(readers)
+		c.Assert(err, IsNil)
+
+		for i := range baseChain.Hashes() {
+			commitData, err := baseChain.GetCommitDataByIndex(i)
+			c.Assert(err, IsNil)
+			c.Assert(commitData.GenerationV2, Not(Equals), uint64(0))
+		}
+
+		top := bytes.NewBuffer(nil)
+		err = commitgraph.NewEncoder(top).EncodeLayer(index, baseChain, []plumbing.Hash{baseHash})
+		c.Assert(err, IsNil)
+
+		chain, err := commitgraph.OpenChainIndex(append(readers, bytes.NewReader(top.Bytes())))
+		c.Assert(err, IsNil)
+
+		for i := range chain.Hashes() {
+			commitData, err := chain.GetCommitDataByIndex(i)
+			c.Assert(err, IsNil)
+			c.Assert(commitData.GenerationV2, Equals, uint64(0))
+		}
+	})
+}
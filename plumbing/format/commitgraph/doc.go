@@ -46,8 +46,9 @@
 //
 //   1-byte number (C) of "chunks"
 //
-//   1-byte (reserved for later use)
-//      Current clients should ignore this value.
+//   1-byte number (B) of base commit-graphs
+//      Non-zero for the layers of a split commit-graph chain, whose base
+//      layers are listed in the Base Graphs List chunk.
 //
 // CHUNK LOOKUP:
 //
@@ -86,6 +87,27 @@
 //       2 bits of the lowest byte, storing the 33rd and 34th bit of the
 //       commit time.
 //
+//   Generation Data (ID: {'G', 'D', 'A', '2' }) (N * 4 bytes) [Optional]
+//     * This list of 4-byte values store corrected commit date offsets for the
+//       commits, arranged in the same order as commit data chunk.
+//     * If the corrected commit date offset cannot be stored within 31 bits,
+//       the value has its most-significant bit on and the other bits store
+//       the position of corrected commit date into the Generation Data Overflow
+//       chunk.
+//     * The corrected commit date of a commit is the maximum of its commit
+//       date and one more than the corrected commit dates of its parents.
+//     * Generation Data chunk is present only when commit-graph file is written
+//       by compatible versions of Git and in case of split commit-graph chains,
+//       the topmost layer also has Generation Data chunk.
+//
+//   Generation Data Overflow (ID: {'G', 'D', 'O', '2' }) [Optional]
+//     * This list of 8-byte values stores the corrected commit date offsets
+//       for commits with corrected commit date offsets that cannot be
+//       stored within 31 bits.
+//     * Generation Data Overflow chunk is present only when Generation Data
+//       chunk is present and at least one corrected commit date offset cannot
+//       be stored within 31 bits.
+//
 //   Extra Edge List (ID: {'E', 'D', 'G', 'E'}) [Optional]
 //       This list of 4-byte values store the second through nth parents for
 //       all octopus merges. The second parent value in the commit data stores
@@ -94,6 +116,34 @@
 //       positions for the parents until reaching a value with the most-significant
 //       bit on. The other bits correspond to the position of the last parent.
 //
+//   Bloom Filter Index (ID: {'B', 'I', 'D', 'X'}) (N * 4 bytes) [Optional]
+//     * The ith entry, BIDX[i], stores the number of bytes in all Bloom filters
+//       from commit 0 to commit i (inclusive) in lexicographic order. The Bloom
+//       filter for the i-th commit spans from BIDX[i-1] to BIDX[i] (plus header
+//       length), where BIDX[-1] is 0.
+//     * The BIDX chunk is ignored if the BDAT chunk is not present.
+//
+//   Bloom Filter Data (ID: {'B', 'D', 'A', 'T'}) [Optional]
+//     * It starts with header consisting of three unsigned 32-bit integers:
+//       - Version of the hash algorithm being used. Only version 1 is
+//         supported, the 32-bit version of the murmur3 hash.
+//       - The number of times a path is hashed and hence the number of bit
+//         positions that cumulatively determine whether a file is present in
+//         the commit.
+//       - The minimum number of bits 'b' per entry in the Bloom filter. If the
+//         filter contains 'n' entries, then the filter size is the minimum
+//         number of bytes that contain n*b bits.
+//     * The rest of the chunk is the concatenation of all the computed Bloom
+//       filters for the commits in lexicographic order. A filter of length
+//       zero is considered not computed.
+//     * The BDAT chunk is present if and only if BIDX is present.
+//
+//   Base Graphs List (ID: {'B', 'A', 'S', 'E'}) [Optional]
+//       This list of H-byte hashes describe a set of B commit-graph files that
+//       form a commit-graph chain. The graph position for the ith commit in
+//       this file's OID Lookup chunk is equal to i plus the number of commits
+//       in all base graphs. If B is non-zero, this chunk must exist.
+//
 // TRAILER:
 //
 // 	H-byte HASH-checksum of all of the above.
@@ -24,20 +24,74 @@ func NewEncoder(w io.Writer) *Encoder {
 
 // Encode writes an index into the commit-graph file
 func (e *Encoder) Encode(idx Index) error {
-	// Get all the hashes in the input index
-	hashes := idx.Hashes()
+	return e.EncodeLayer(idx, nil, nil)
+}
+
+// EncodeLayer writes the commits of idx missing in base as a layer of a split
+// commit-graph chain, on top of the layers of base, whose checksums are given
+// in baseGraphs from the base layer to the top one. The parents of the
+// commits must be in idx or in base. A nil base encodes a complete
+// commit-graph file, as Encode does.
+func (e *Encoder) EncodeLayer(idx Index, base Index, baseGraphs []plumbing.Hash) error {
+	// Get the hashes of the input index, not in the base layers
+	var hashes []plumbing.Hash
+	for _, hash := range idx.Hashes() {
+		if base != nil {
+			if _, err := base.GetIndexByHash(hash); err == nil {
+				continue
+			}
+		}
+
+		hashes = append(hashes, hash)
+	}
+
+	var baseCount int
+	if base != nil {
+		baseCount = len(base.Hashes())
+	}
 
 	// Sort the inout and prepare helper structures we'll need for encoding
-	hashToIndex, fanout, extraEdgesCount := e.prepare(idx, hashes)
+	hashToIndex, fanout, extraEdgesCount, bloomFilters, err := e.prepare(idx, hashes, base, baseCount)
+	if err != nil {
+		return err
+	}
+
+	generationOffsets, generationOverflows, err := e.prepareGenerationData(idx, hashes)
+	if err != nil {
+		return err
+	}
+
+	var bloomDataSize uint32
+	for _, filter := range bloomFilters {
+		if filter != nil {
+			bloomDataSize += uint32(len(filter.data))
+		}
+	}
 
 	chunkSignatures := [][]byte{oidFanoutSignature, oidLookupSignature, commitDataSignature}
 	chunkSizes := []uint64{4 * 256, uint64(len(hashes)) * 20, uint64(len(hashes)) * 36}
+	if generationOffsets != nil {
+		chunkSignatures = append(chunkSignatures, generationDataSignature)
+		chunkSizes = append(chunkSizes, uint64(len(hashes))*4)
+	}
+	if len(generationOverflows) > 0 {
+		chunkSignatures = append(chunkSignatures, generationDataOverflowSignature)
+		chunkSizes = append(chunkSizes, uint64(len(generationOverflows))*8)
+	}
 	if extraEdgesCount > 0 {
 		chunkSignatures = append(chunkSignatures, extraEdgeListSignature)
 		chunkSizes = append(chunkSizes, uint64(extraEdgesCount)*4)
 	}
+	if bloomFilters != nil {
+		chunkSignatures = append(chunkSignatures, bloomIndexSignature, bloomDataSignature)
+		chunkSizes = append(chunkSizes, uint64(len(hashes))*4, 12+uint64(bloomDataSize))
+	}
+	if len(baseGraphs) > 0 {
+		chunkSignatures = append(chunkSignatures, baseGraphsSignature)
+		chunkSizes = append(chunkSizes, uint64(len(baseGraphs))*20)
+	}
 
-	if err := e.encodeFileHeader(len(chunkSignatures)); err != nil {
+	if err := e.encodeFileHeader(len(chunkSignatures), len(baseGraphs)); err != nil {
 		return err
 	}
 	if err := e.encodeChunkHeaders(chunkSignatures, chunkSizes); err != nil {
@@ -49,24 +103,35 @@ func (e *Encoder) Encode(idx Index) error {
 	if err := e.encodeOidLookup(hashes); err != nil {
 		return err
 	}
-	if extraEdges, err := e.encodeCommitData(hashes, hashToIndex, idx); err == nil {
-		if err = e.encodeExtraEdges(extraEdges); err != nil {
+	extraEdges, err := e.encodeCommitData(hashes, hashToIndex, idx)
+	if err != nil {
+		return err
+	}
+	if err := e.encodeGenerationData(generationOffsets, generationOverflows); err != nil {
+		return err
+	}
+	if err := e.encodeExtraEdges(extraEdges); err != nil {
+		return err
+	}
+	if bloomFilters != nil {
+		if err := e.encodeBloomFilters(bloomFilters); err != nil {
 			return err
 		}
-	} else {
+	}
+	if err := e.encodeOidLookup(baseGraphs); err != nil {
 		return err
 	}
 
 	return e.encodeChecksum()
 }
 
-func (e *Encoder) prepare(idx Index, hashes []plumbing.Hash) (hashToIndex map[plumbing.Hash]uint32, fanout []uint32, extraEdgesCount uint32) {
+func (e *Encoder) prepare(idx Index, hashes []plumbing.Hash, base Index, baseCount int) (hashToIndex map[plumbing.Hash]uint32, fanout []uint32, extraEdgesCount uint32, bloomFilters []*BloomFilter, err error) {
 	// Sort the hashes and build our index
 	plumbing.HashesSort(hashes)
 	hashToIndex = make(map[plumbing.Hash]uint32)
 	fanout = make([]uint32, 256)
 	for i, hash := range hashes {
-		hashToIndex[hash] = uint32(i)
+		hashToIndex[hash] = uint32(baseCount + i)
 		fanout[hash[0]]++
 	}
 
@@ -75,21 +140,91 @@ func (e *Encoder) prepare(idx Index, hashes []plumbing.Hash) (hashToIndex map[pl
 		fanout[i] += fanout[i-1]
 	}
 
-	// Find out if we will need extra edge table
-	for i := 0; i < len(hashes); i++ {
-		v, _ := idx.GetCommitDataByIndex(i)
+	// Find out if we will need extra edge table, the indexes of the parents
+	// in the base layers and the Bloom filters, if any commit has one
+	hasBloomFilters := false
+	bloomFilters = make([]*BloomFilter, len(hashes))
+	for j, hash := range hashes {
+		i, err := idx.GetIndexByHash(hash)
+		if err != nil {
+			return nil, nil, 0, nil, err
+		}
+
+		v, err := idx.GetCommitDataByIndex(i)
+		if err != nil {
+			return nil, nil, 0, nil, err
+		}
+
+		// the filters of a commit-graph share the number of hashes, the ones
+		// with another one are left as not computed
+		if v.BloomFilter != nil && v.BloomFilter.numHashes == BloomNumHashes {
+			bloomFilters[j] = v.BloomFilter
+			hasBloomFilters = true
+		}
+
 		if len(v.ParentHashes) > 2 {
 			extraEdgesCount += uint32(len(v.ParentHashes) - 1)
-			break
+		}
+
+		for _, parent := range v.ParentHashes {
+			if _, ok := hashToIndex[parent]; ok || base == nil {
+				continue
+			}
+
+			i, err := base.GetIndexByHash(parent)
+			if err != nil {
+				return nil, nil, 0, nil, err
+			}
+
+			hashToIndex[parent] = uint32(i)
 		}
 	}
 
+	if !hasBloomFilters {
+		bloomFilters = nil
+	}
+
 	return
 }
 
-func (e *Encoder) encodeFileHeader(chunkCount int) (err error) {
+// prepareGenerationData returns the offsets of the corrected commit dates from
+// the commit dates of the given commits and the offsets too large to be
+// stored in the Generation Data chunk. The offsets are nil if any commit
+// lacks its corrected commit date.
+func (e *Encoder) prepareGenerationData(idx Index, hashes []plumbing.Hash) (offsets []uint32, overflows []uint64, err error) {
+	offsets = make([]uint32, len(hashes))
+	for j, hash := range hashes {
+		i, err := idx.GetIndexByHash(hash)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		v, err := idx.GetCommitDataByIndex(i)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		when := uint64(v.When.Unix())
+		if v.GenerationV2 == 0 || v.GenerationV2 < when {
+			return nil, nil, nil
+		}
+
+		offset := v.GenerationV2 - when
+		if offset > generationOffsetMax {
+			offsets[j] = generationOffsetOverflow | uint32(len(overflows))
+			overflows = append(overflows, offset)
+			continue
+		}
+
+		offsets[j] = uint32(offset)
+	}
+
+	return
+}
+
+func (e *Encoder) encodeFileHeader(chunkCount int, baseGraphCount int) (err error) {
 	if _, err = e.Write(commitFileSignature); err == nil {
-		_, err = e.Write([]byte{1, 1, byte(chunkCount), 0})
+		_, err = e.Write([]byte{1, 1, byte(chunkCount), byte(baseGraphCount)})
 	}
 	return
 }
@@ -182,6 +317,48 @@ func (e *Encoder) encodeExtraEdges(extraEdges []uint32) (err error) {
 	return
 }
 
+func (e *Encoder) encodeGenerationData(offsets []uint32, overflows []uint64) (err error) {
+	for _, offset := range offsets {
+		if err = binary.WriteUint32(e, offset); err != nil {
+			return
+		}
+	}
+	for _, offset := range overflows {
+		if err = binary.WriteUint64(e, offset); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (e *Encoder) encodeBloomFilters(bloomFilters []*BloomFilter) (err error) {
+	var offset uint32
+	for _, filter := range bloomFilters {
+		if filter != nil {
+			offset += uint32(len(filter.data))
+		}
+		if err = binary.WriteUint32(e, offset); err != nil {
+			return
+		}
+	}
+
+	for _, v := range []uint32{BloomHashVersion, BloomNumHashes, BloomBitsPerEntry} {
+		if err = binary.WriteUint32(e, v); err != nil {
+			return
+		}
+	}
+
+	for _, filter := range bloomFilters {
+		if filter == nil {
+			continue
+		}
+		if _, err = e.Write(filter.data); err != nil {
+			return
+		}
+	}
+	return
+}
+
 func (e *Encoder) encodeChecksum() error {
 	_, err := e.Write(e.hash.Sum(nil)[:20])
 	return err
@@ -23,32 +23,100 @@ var (
 	// graph file is corrupted.
 	ErrMalformedCommitGraphFile = errors.New("Malformed commit graph file")
 
-	commitFileSignature    = []byte{'C', 'G', 'P', 'H'}
-	oidFanoutSignature     = []byte{'O', 'I', 'D', 'F'}
-	oidLookupSignature     = []byte{'O', 'I', 'D', 'L'}
-	commitDataSignature    = []byte{'C', 'D', 'A', 'T'}
-	extraEdgeListSignature = []byte{'E', 'D', 'G', 'E'}
-	lastSignature          = []byte{0, 0, 0, 0}
+	commitFileSignature             = []byte{'C', 'G', 'P', 'H'}
+	oidFanoutSignature              = []byte{'O', 'I', 'D', 'F'}
+	oidLookupSignature              = []byte{'O', 'I', 'D', 'L'}
+	commitDataSignature             = []byte{'C', 'D', 'A', 'T'}
+	generationDataSignature         = []byte{'G', 'D', 'A', '2'}
+	generationDataOverflowSignature = []byte{'G', 'D', 'O', '2'}
+	extraEdgeListSignature          = []byte{'E', 'D', 'G', 'E'}
+	baseGraphsSignature             = []byte{'B', 'A', 'S', 'E'}
+	bloomIndexSignature             = []byte{'B', 'I', 'D', 'X'}
+	bloomDataSignature              = []byte{'B', 'D', 'A', 'T'}
+	lastSignature                   = []byte{0, 0, 0, 0}
 
 	parentNone        = uint32(0x70000000)
 	parentOctopusUsed = uint32(0x80000000)
 	parentOctopusMask = uint32(0x7fffffff)
 	parentLast        = uint32(0x80000000)
+
+	generationOffsetOverflow = uint32(0x80000000)
+	generationOffsetMax      = uint64(0x7fffffff)
 )
 
 type fileIndex struct {
-	reader              io.ReaderAt
-	fanout              [256]int
-	oidFanoutOffset     int64
-	oidLookupOffset     int64
-	commitDataOffset    int64
-	extraEdgeListOffset int64
+	reader                       io.ReaderAt
+	base                         *fileIndex
+	baseCount                    int
+	baseGraphCount               int
+	fanout                       [256]int
+	oidFanoutOffset              int64
+	oidLookupOffset              int64
+	commitDataOffset             int64
+	extraEdgeListOffset          int64
+	generationDataOffset         int64
+	generationDataOverflowOffset int64
+	hasGenerationV2              bool
+	bloomIndexOffset             int64
+	bloomDataOffset              int64
+	bloomNumHashes               int
 }
 
 // OpenFileIndex opens a serialized commit graph file in the format described at
 // https://github.com/git/git/blob/master/Documentation/technical/commit-graph-format.txt
 func OpenFileIndex(reader io.ReaderAt) (Index, error) {
-	fi := &fileIndex{reader: reader}
+	fi, err := openFileIndex(reader, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if fi.baseGraphCount != 0 {
+		return nil, ErrMalformedCommitGraphFile
+	}
+
+	return fi, nil
+}
+
+// OpenChainIndex opens the layers of a split commit graph chain, given in
+// order from the base layer to the top one. The indexes of the commits are
+// global to the chain, the ones of a layer follow the ones of the layers
+// below it.
+func OpenChainIndex(readers []io.ReaderAt) (Index, error) {
+	if len(readers) == 0 {
+		return nil, ErrMalformedCommitGraphFile
+	}
+
+	var fi *fileIndex
+	for i, reader := range readers {
+		var err error
+		if fi, err = openFileIndex(reader, fi); err != nil {
+			return nil, err
+		}
+
+		if fi.baseGraphCount != i {
+			return nil, ErrMalformedCommitGraphFile
+		}
+	}
+
+	// the corrected commit dates are only used if all the layers have them,
+	// otherwise the generations of the layers couldn't be compared
+	hasGenerationV2 := true
+	for l := fi; l != nil; l = l.base {
+		hasGenerationV2 = hasGenerationV2 && l.hasGenerationV2
+	}
+
+	for l := fi; l != nil; l = l.base {
+		l.hasGenerationV2 = hasGenerationV2
+	}
+
+	return fi, nil
+}
+
+func openFileIndex(reader io.ReaderAt, base *fileIndex) (*fileIndex, error) {
+	fi := &fileIndex{reader: reader, base: base}
+	if base != nil {
+		fi.baseCount = base.baseCount + base.count()
+	}
 
 	if err := fi.verifyFileHeader(); err != nil {
 		return nil, err
@@ -59,10 +127,19 @@ func OpenFileIndex(reader io.ReaderAt) (Index, error) {
 	if err := fi.readFanout(); err != nil {
 		return nil, err
 	}
+	if err := fi.readBloomDataHeader(); err != nil {
+		return nil, err
+	}
 
+	fi.hasGenerationV2 = fi.generationDataOffset > 0
 	return fi, nil
 }
 
+// count returns the number of commits of the layer.
+func (fi *fileIndex) count() int {
+	return fi.fanout[0xff]
+}
+
 func (fi *fileIndex) verifyFileHeader() error {
 	// Verify file signature
 	var signature = make([]byte, 4)
@@ -85,6 +162,7 @@ func (fi *fileIndex) verifyFileHeader() error {
 		return ErrUnsupportedHash
 	}
 
+	fi.baseGraphCount = int(header[3])
 	return nil
 }
 
@@ -106,8 +184,18 @@ func (fi *fileIndex) readChunkHeaders() error {
 			fi.oidLookupOffset = int64(chunkOffset)
 		} else if bytes.Equal(chunkID, commitDataSignature) {
 			fi.commitDataOffset = int64(chunkOffset)
+		} else if bytes.Equal(chunkID, generationDataSignature) {
+			fi.generationDataOffset = int64(chunkOffset)
+		} else if bytes.Equal(chunkID, generationDataOverflowSignature) {
+			fi.generationDataOverflowOffset = int64(chunkOffset)
 		} else if bytes.Equal(chunkID, extraEdgeListSignature) {
 			fi.extraEdgeListOffset = int64(chunkOffset)
+		} else if bytes.Equal(chunkID, bloomIndexSignature) {
+			fi.bloomIndexOffset = int64(chunkOffset)
+		} else if bytes.Equal(chunkID, bloomDataSignature) {
+			fi.bloomDataOffset = int64(chunkOffset)
+		} else if bytes.Equal(chunkID, baseGraphsSignature) {
+			// the base graphs are given by the chain file
 		} else if bytes.Equal(chunkID, lastSignature) {
 			break
 		}
@@ -135,6 +223,32 @@ func (fi *fileIndex) readFanout() error {
 	return nil
 }
 
+// readBloomDataHeader reads the settings of the changed-path Bloom filters,
+// the filters are ignored if they aren't supported.
+func (fi *fileIndex) readBloomDataHeader() error {
+	if fi.bloomIndexOffset <= 0 || fi.bloomDataOffset <= 0 {
+		return nil
+	}
+
+	header := io.NewSectionReader(fi.reader, fi.bloomDataOffset, 12)
+	version, err := binary.ReadUint32(header)
+	if err != nil {
+		return err
+	}
+	numHashes, err := binary.ReadUint32(header)
+	if err != nil {
+		return err
+	}
+
+	if version != BloomHashVersion || numHashes == 0 {
+		fi.bloomIndexOffset, fi.bloomDataOffset = 0, 0
+		return nil
+	}
+
+	fi.bloomNumHashes = int(numHashes)
+	return nil
+}
+
 func (fi *fileIndex) GetIndexByHash(h plumbing.Hash) (int, error) {
 	var oid plumbing.Hash
 
@@ -156,17 +270,26 @@ func (fi *fileIndex) GetIndexByHash(h plumbing.Hash) (int, error) {
 		if cmp < 0 {
 			high = mid
 		} else if cmp == 0 {
-			return mid, nil
+			return fi.baseCount + mid, nil
 		} else {
 			low = mid + 1
 		}
 	}
 
+	if fi.base != nil {
+		return fi.base.GetIndexByHash(h)
+	}
+
 	return 0, plumbing.ErrObjectNotFound
 }
 
 func (fi *fileIndex) GetCommitDataByIndex(idx int) (*CommitData, error) {
-	if idx >= fi.fanout[0xff] {
+	if idx < fi.baseCount {
+		return fi.base.GetCommitDataByIndex(idx)
+	}
+
+	idx -= fi.baseCount
+	if idx < 0 || idx >= fi.count() {
 		return nil, plumbing.ErrObjectNotFound
 	}
 
@@ -220,25 +343,111 @@ func (fi *fileIndex) GetCommitDataByIndex(idx int) (*CommitData, error) {
 		return nil, err
 	}
 
+	bloomFilter, err := fi.getBloomFilter(idx)
+	if err != nil {
+		return nil, err
+	}
+
+	commitTime := genAndTime & 0x3FFFFFFFF
+	generationV2, err := fi.getGenerationV2(idx, commitTime)
+	if err != nil {
+		return nil, err
+	}
+
 	return &CommitData{
 		TreeHash:      treeHash,
 		ParentIndexes: parentIndexes,
 		ParentHashes:  parentHashes,
 		Generation:    int(genAndTime >> 34),
-		When:          time.Unix(int64(genAndTime&0x3FFFFFFFF), 0),
+		GenerationV2:  generationV2,
+		When:          time.Unix(int64(commitTime), 0),
+		BloomFilter:   bloomFilter,
 	}, nil
 }
 
+// getGenerationV2 returns the corrected commit date of the commit with the
+// given index in the layer and commit time, zero if not available.
+func (fi *fileIndex) getGenerationV2(idx int, commitTime uint64) (uint64, error) {
+	if !fi.hasGenerationV2 {
+		return 0, nil
+	}
+
+	buf := make([]byte, 8)
+	if _, err := fi.reader.ReadAt(buf[:4], fi.generationDataOffset+4*int64(idx)); err != nil {
+		return 0, err
+	}
+
+	offset := encbin.BigEndian.Uint32(buf)
+	if offset&generationOffsetOverflow == 0 {
+		return commitTime + uint64(offset), nil
+	}
+
+	if fi.generationDataOverflowOffset <= 0 {
+		return 0, ErrMalformedCommitGraphFile
+	}
+
+	pos := int64(offset ^ generationOffsetOverflow)
+	if _, err := fi.reader.ReadAt(buf, fi.generationDataOverflowOffset+8*pos); err != nil {
+		return 0, err
+	}
+
+	return commitTime + encbin.BigEndian.Uint64(buf), nil
+}
+
+// getBloomFilter returns the changed-path Bloom filter of the commit with the
+// given index in the layer, nil if not available.
+func (fi *fileIndex) getBloomFilter(idx int) (*BloomFilter, error) {
+	if fi.bloomIndexOffset <= 0 {
+		return nil, nil
+	}
+
+	var start, end uint32
+	buf := make([]byte, 8)
+	if idx == 0 {
+		if _, err := fi.reader.ReadAt(buf[4:], fi.bloomIndexOffset); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err := fi.reader.ReadAt(buf, fi.bloomIndexOffset+4*int64(idx-1)); err != nil {
+			return nil, err
+		}
+
+		start = encbin.BigEndian.Uint32(buf)
+	}
+
+	end = encbin.BigEndian.Uint32(buf[4:])
+	if end < start {
+		return nil, ErrMalformedCommitGraphFile
+	}
+
+	// the filters of length zero weren't computed
+	if end == start {
+		return nil, nil
+	}
+
+	data := make([]byte, end-start)
+	if _, err := fi.reader.ReadAt(data, fi.bloomDataOffset+12+int64(start)); err != nil {
+		return nil, err
+	}
+
+	return &BloomFilter{data: data, numHashes: fi.bloomNumHashes}, nil
+}
+
 func (fi *fileIndex) getHashesFromIndexes(indexes []int) ([]plumbing.Hash, error) {
 	hashes := make([]plumbing.Hash, len(indexes))
 
 	for i, idx := range indexes {
-		if idx >= fi.fanout[0xff] {
+		layer := fi
+		for layer != nil && idx < layer.baseCount {
+			layer = layer.base
+		}
+
+		if layer == nil || idx-layer.baseCount >= layer.count() {
 			return nil, ErrMalformedCommitGraphFile
 		}
 
-		offset := fi.oidLookupOffset + int64(idx)*20
-		if _, err := fi.reader.ReadAt(hashes[i][:], offset); err != nil {
+		offset := layer.oidLookupOffset + int64(idx-layer.baseCount)*20
+		if _, err := layer.reader.ReadAt(hashes[i][:], offset); err != nil {
 			return nil, err
 		}
 	}
@@ -248,12 +457,19 @@ func (fi *fileIndex) getHashesFromIndexes(indexes []int) ([]plumbing.Hash, error
 
 // Hashes returns all the hashes that are available in the index
 func (fi *fileIndex) Hashes() []plumbing.Hash {
-	hashes := make([]plumbing.Hash, fi.fanout[0xff])
-	for i := 0; i < fi.fanout[0xff]; i++ {
+	var hashes []plumbing.Hash
+	if fi.base != nil {
+		if hashes = fi.base.Hashes(); hashes == nil {
+			return nil
+		}
+	}
+
+	layer := make([]plumbing.Hash, fi.count())
+	for i := 0; i < fi.count(); i++ {
 		offset := fi.oidLookupOffset + int64(i)*20
-		if n, err := fi.reader.ReadAt(hashes[i][:], offset); err != nil || n < 20 {
+		if n, err := fi.reader.ReadAt(layer[i][:], offset); err != nil || n < 20 {
 			return nil
 		}
 	}
-	return hashes
+	return append(hashes, layer...)
 }
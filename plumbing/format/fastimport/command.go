@@ -0,0 +1,154 @@
+package fastimport
+
+import (
+	"errors"
+	"strconv"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+var (
+	// ErrMalformedStream is returned when the stream can't be parsed.
+	ErrMalformedStream = errors.New("fastimport: malformed stream")
+	// ErrUnsupportedCommand is returned when the stream contains a valid
+	// command that is not supported.
+	ErrUnsupportedCommand = errors.New("fastimport: unsupported command")
+)
+
+// InlineData is the dataref used by FileModify to declare the content of the
+// file is given inline in the Data field.
+const InlineData = "inline"
+
+// Mark is an identifier assigned to an object in the stream, it can be used to
+// refer to the object in later commands. The zero value means no mark.
+type Mark uint64
+
+// String returns the mark as used in a dataref or commit-ish, ":<idnum>".
+func (m Mark) String() string {
+	return ":" + strconv.FormatUint(uint64(m), 10)
+}
+
+// Command is any of the commands of a fast-import stream: *Blob, *Commit,
+// *Tag, *Reset, *Feature, *Progress, *Checkpoint or *Done.
+type Command interface {
+	command()
+}
+
+// Blob writes file content.
+type Blob struct {
+	Mark Mark
+	// OriginalOID is the hash of the object in the source repository, if
+	// known. It is informative only.
+	OriginalOID string
+	Data        []byte
+}
+
+// Commit creates or updates a branch with a new commit.
+type Commit struct {
+	// Ref is the reference updated by the commit.
+	Ref         plumbing.ReferenceName
+	Mark        Mark
+	OriginalOID string
+	// Author of the commit, if nil the committer is used.
+	Author    *object.Signature
+	Committer object.Signature
+	// Encoding of the message, if not UTF-8.
+	Encoding string
+	Message  string
+	// From is the commit-ish of the first parent, if empty the current
+	// commit of Ref is used.
+	From string
+	// Merge are the commit-ish of the additional parents.
+	Merge []string
+	// Files are the changes applied to the tree of the first parent.
+	Files []FileCommand
+}
+
+// Tag creates an annotated tag.
+type Tag struct {
+	// Name of the tag, without the refs/tags/ prefix.
+	Name        string
+	Mark        Mark
+	From        string
+	OriginalOID string
+	Tagger      *object.Signature
+	Message     string
+}
+
+// Reset creates or updates a reference, if From is empty the reference is
+// reset, so the next commit of it has no parents.
+type Reset struct {
+	Ref  plumbing.ReferenceName
+	From string
+}
+
+// Feature declares a feature the stream requires, like "done" or
+// "export-marks=<path>".
+type Feature struct {
+	Name  string
+	Value string
+}
+
+// Progress is a message the importer should echo.
+type Progress struct {
+	Message string
+}
+
+// Checkpoint requests the importer to flush its state.
+type Checkpoint struct{}
+
+// Done marks the end of the stream.
+type Done struct{}
+
+func (*Blob) command()       {}
+func (*Commit) command()     {}
+func (*Tag) command()        {}
+func (*Reset) command()      {}
+func (*Feature) command()    {}
+func (*Progress) command()   {}
+func (*Checkpoint) command() {}
+func (*Done) command()       {}
+
+// FileCommand is any of the file changes of a commit: *FileModify,
+// *FileDelete, *FileCopy, *FileRename or *FileDeleteAll.
+type FileCommand interface {
+	fileCommand()
+}
+
+// FileModify adds or changes a file.
+type FileModify struct {
+	Mode filemode.FileMode
+	// DataRef is a mark or hash of the content, or InlineData.
+	DataRef string
+	// Data is the content of the file when DataRef is InlineData.
+	Data []byte
+	Path string
+}
+
+// FileDelete removes a file or a directory recursively.
+type FileDelete struct {
+	Path string
+}
+
+// FileCopy copies a file or a directory recursively.
+type FileCopy struct {
+	Source string
+	Dest   string
+}
+
+// FileRename renames a file or a directory.
+type FileRename struct {
+	Source string
+	Dest   string
+}
+
+// FileDeleteAll removes all the files, so the tree is built from scratch.
+type FileDeleteAll struct{}
+
+func (*FileModify) fileCommand()    {}
+func (*FileDelete) fileCommand()    {}
+func (*FileCopy) fileCommand()      {}
+func (*FileRename) fileCommand()    {}
+func (*FileDeleteAll) fileCommand() {}
@@ -0,0 +1,525 @@
+package fastimport
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// Decoder reads commands from a fast-import stream.
+type Decoder struct {
+	r    *bufio.Reader
+	next *string
+}
+
+// NewDecoder returns a new decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r)}
+}
+
+// Decode reads the next command of the stream, io.EOF is returned when the
+// stream has no more commands.
+func (d *Decoder) Decode() (Command, error) {
+	line, err := d.nextCommandLine()
+	if err != nil {
+		return nil, err
+	}
+
+	name, arg := splitCommand(line)
+	switch name {
+	case "blob":
+		return d.decodeBlob()
+	case "commit":
+		return d.decodeCommit(arg)
+	case "tag":
+		return d.decodeTag(arg)
+	case "reset":
+		return d.decodeReset(arg)
+	case "feature", "option":
+		return decodeFeature(arg), nil
+	case "progress":
+		return &Progress{Message: arg}, nil
+	case "checkpoint":
+		return &Checkpoint{}, nil
+	case "done":
+		return &Done{}, nil
+	case "alias", "ls", "cat-blob", "get-mark":
+		return nil, ErrUnsupportedCommand
+	default:
+		return nil, ErrMalformedStream
+	}
+}
+
+func (d *Decoder) decodeBlob() (*Blob, error) {
+	b := &Blob{}
+
+	var err error
+	if b.Mark, err = d.optionalMark(); err != nil {
+		return nil, err
+	}
+
+	if b.OriginalOID, err = d.optionalValue("original-oid"); err != nil {
+		return nil, err
+	}
+
+	if b.Data, err = d.data(); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func (d *Decoder) decodeCommit(ref string) (*Commit, error) {
+	if ref == "" {
+		return nil, ErrMalformedStream
+	}
+
+	c := &Commit{Ref: plumbing.ReferenceName(ref)}
+
+	var err error
+	if c.Mark, err = d.optionalMark(); err != nil {
+		return nil, err
+	}
+
+	if c.OriginalOID, err = d.optionalValue("original-oid"); err != nil {
+		return nil, err
+	}
+
+	author, err := d.optionalValue("author")
+	if err != nil {
+		return nil, err
+	}
+
+	if author != "" {
+		c.Author = decodeSignature(author)
+	}
+
+	committer, err := d.optionalValue("committer")
+	if err != nil {
+		return nil, err
+	}
+
+	if committer == "" {
+		return nil, ErrMalformedStream
+	}
+
+	c.Committer = *decodeSignature(committer)
+
+	if c.Encoding, err = d.optionalValue("encoding"); err != nil {
+		return nil, err
+	}
+
+	msg, err := d.data()
+	if err != nil {
+		return nil, err
+	}
+
+	c.Message = string(msg)
+
+	if c.From, err = d.optionalValue("from"); err != nil {
+		return nil, err
+	}
+
+	for {
+		m, err := d.optionalValue("merge")
+		if err != nil {
+			return nil, err
+		}
+
+		if m == "" {
+			break
+		}
+
+		c.Merge = append(c.Merge, m)
+	}
+
+	for {
+		f, err := d.fileCommand()
+		if err != nil {
+			return nil, err
+		}
+
+		if f == nil {
+			break
+		}
+
+		c.Files = append(c.Files, f)
+	}
+
+	return c, nil
+}
+
+func (d *Decoder) fileCommand() (FileCommand, error) {
+	line, err := d.readLine()
+	if err == io.EOF {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if line == "deleteall" {
+		return &FileDeleteAll{}, nil
+	}
+
+	if len(line) < 2 || line[1] != ' ' {
+		d.unreadLine(line)
+		return nil, nil
+	}
+
+	arg := line[2:]
+	switch line[0] {
+	case 'M':
+		return d.fileModify(arg)
+	case 'D':
+		p, err := unquotePath(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		return &FileDelete{Path: p}, nil
+	case 'C', 'R':
+		src, dst, err := splitSourceDest(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		if line[0] == 'C' {
+			return &FileCopy{Source: src, Dest: dst}, nil
+		}
+
+		return &FileRename{Source: src, Dest: dst}, nil
+	case 'N':
+		return nil, ErrUnsupportedCommand
+	default:
+		d.unreadLine(line)
+		return nil, nil
+	}
+}
+
+func (d *Decoder) fileModify(arg string) (*FileModify, error) {
+	fields := strings.SplitN(arg, " ", 3)
+	if len(fields) != 3 {
+		return nil, ErrMalformedStream
+	}
+
+	mode, err := parseMode(fields[0])
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := unquotePath(fields[2])
+	if err != nil {
+		return nil, err
+	}
+
+	f := &FileModify{Mode: mode, DataRef: fields[1], Path: p}
+	if f.DataRef == InlineData {
+		if f.Data, err = d.data(); err != nil {
+			return nil, err
+		}
+	}
+
+	return f, nil
+}
+
+func (d *Decoder) decodeTag(name string) (*Tag, error) {
+	if name == "" {
+		return nil, ErrMalformedStream
+	}
+
+	t := &Tag{Name: name}
+
+	var err error
+	if t.Mark, err = d.optionalMark(); err != nil {
+		return nil, err
+	}
+
+	if t.From, err = d.optionalValue("from"); err != nil {
+		return nil, err
+	}
+
+	if t.From == "" {
+		return nil, ErrMalformedStream
+	}
+
+	if t.OriginalOID, err = d.optionalValue("original-oid"); err != nil {
+		return nil, err
+	}
+
+	tagger, err := d.optionalValue("tagger")
+	if err != nil {
+		return nil, err
+	}
+
+	if tagger != "" {
+		t.Tagger = decodeSignature(tagger)
+	}
+
+	msg, err := d.data()
+	if err != nil {
+		return nil, err
+	}
+
+	t.Message = string(msg)
+	return t, nil
+}
+
+func (d *Decoder) decodeReset(ref string) (*Reset, error) {
+	if ref == "" {
+		return nil, ErrMalformedStream
+	}
+
+	from, err := d.optionalValue("from")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Reset{Ref: plumbing.ReferenceName(ref), From: from}, nil
+}
+
+func decodeFeature(arg string) *Feature {
+	f := &Feature{Name: arg}
+	if i := strings.IndexByte(arg, '='); i >= 0 {
+		f.Name, f.Value = arg[:i], arg[i+1:]
+	}
+
+	return f
+}
+
+func (d *Decoder) optionalMark() (Mark, error) {
+	v, err := d.optionalValue("mark")
+	if err != nil || v == "" {
+		return 0, err
+	}
+
+	if !strings.HasPrefix(v, ":") {
+		return 0, ErrMalformedStream
+	}
+
+	n, err := strconv.ParseUint(v[1:], 10, 64)
+	if err != nil || n == 0 {
+		return 0, ErrMalformedStream
+	}
+
+	return Mark(n), nil
+}
+
+// optionalValue returns the argument of the next line if it is the given
+// command, otherwise the line is left unread and an empty string returned.
+func (d *Decoder) optionalValue(name string) (string, error) {
+	line, err := d.readLine()
+	if err == io.EOF {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	cmd, arg := splitCommand(line)
+	if cmd != name {
+		d.unreadLine(line)
+		return "", nil
+	}
+
+	return arg, nil
+}
+
+func (d *Decoder) data() ([]byte, error) {
+	line, err := d.readLine()
+	if err != nil {
+		if err == io.EOF {
+			return nil, ErrMalformedStream
+		}
+
+		return nil, err
+	}
+
+	cmd, arg := splitCommand(line)
+	if cmd != "data" {
+		return nil, ErrMalformedStream
+	}
+
+	if strings.HasPrefix(arg, "<<") {
+		return d.delimitedData(arg[2:])
+	}
+
+	n, err := strconv.ParseUint(arg, 10, 64)
+	if err != nil {
+		return nil, ErrMalformedStream
+	}
+
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(d.r, buf); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrMalformedStream
+		}
+
+		return nil, err
+	}
+
+	// the LF after the data is optional
+	if b, err := d.r.Peek(1); err == nil && b[0] == '\n' {
+		_, _ = d.r.ReadByte()
+	}
+
+	return buf, nil
+}
+
+func (d *Decoder) delimitedData(delim string) ([]byte, error) {
+	if delim == "" {
+		return nil, ErrMalformedStream
+	}
+
+	var buf bytes.Buffer
+	for {
+		line, err := d.r.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				return nil, ErrMalformedStream
+			}
+
+			return nil, err
+		}
+
+		if line == delim+"\n" {
+			return buf.Bytes(), nil
+		}
+
+		buf.WriteString(line)
+	}
+}
+
+// nextCommandLine returns the next line skipping blank lines and comments.
+func (d *Decoder) nextCommandLine() (string, error) {
+	for {
+		line, err := d.readLine()
+		if err != nil {
+			return "", err
+		}
+
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		return line, nil
+	}
+}
+
+func (d *Decoder) readLine() (string, error) {
+	if d.next != nil {
+		line := *d.next
+		d.next = nil
+		return line, nil
+	}
+
+	line, err := d.r.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(line, "\n"), nil
+}
+
+func (d *Decoder) unreadLine(line string) {
+	d.next = &line
+}
+
+func splitCommand(line string) (cmd, arg string) {
+	if i := strings.IndexByte(line, ' '); i >= 0 {
+		return line[:i], line[i+1:]
+	}
+
+	return line, ""
+}
+
+func decodeSignature(s string) *object.Signature {
+	sig := &object.Signature{}
+	sig.Decode([]byte(s))
+	return sig
+}
+
+func parseMode(s string) (filemode.FileMode, error) {
+	switch s {
+	case "644":
+		return filemode.Regular, nil
+	case "755":
+		return filemode.Executable, nil
+	}
+
+	m, err := filemode.New(s)
+	if err != nil {
+		return filemode.Empty, ErrMalformedStream
+	}
+
+	if m.IsMalformed() {
+		return filemode.Empty, ErrMalformedStream
+	}
+
+	return m, nil
+}
+
+func unquotePath(p string) (string, error) {
+	if !strings.HasPrefix(p, "\"") {
+		return p, nil
+	}
+
+	s, err := strconv.Unquote(p)
+	if err != nil {
+		return "", ErrMalformedStream
+	}
+
+	return s, nil
+}
+
+func splitSourceDest(arg string) (src, dst string, err error) {
+	if strings.HasPrefix(arg, "\"") {
+		end := closingQuote(arg)
+		if end < 0 || end+1 >= len(arg) || arg[end+1] != ' ' {
+			return "", "", ErrMalformedStream
+		}
+
+		if src, err = unquotePath(arg[:end+1]); err != nil {
+			return "", "", err
+		}
+
+		arg = arg[end+2:]
+	} else {
+		i := strings.IndexByte(arg, ' ')
+		if i < 0 {
+			return "", "", ErrMalformedStream
+		}
+
+		src, arg = arg[:i], arg[i+1:]
+	}
+
+	dst, err = unquotePath(arg)
+	return src, dst, err
+}
+
+// closingQuote returns the position of the quote closing the quoted string
+// starting at s[0], or -1 if not found.
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+
+	return -1
+}
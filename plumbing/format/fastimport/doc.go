@@ -0,0 +1,44 @@
+// Package fastimport implements reading and writing of the git fast-import
+// stream format, used to export and import the history of repositories, see
+// https://git-scm.com/docs/git-fast-import for the full specification.
+//
+// The stream is a sequence of commands, the supported ones are:
+//
+//	blob
+//	mark :<idnum>
+//	data <count>
+//	<raw>
+//
+//	commit <ref>
+//	mark :<idnum>
+//	author <name> <<email>> <when>
+//	committer <name> <<email>> <when>
+//	data <count>
+//	<message>
+//	from <commit-ish>
+//	merge <commit-ish>
+//	M <mode> <dataref> <path>
+//	D <path>
+//	C <source> <dest>
+//	R <source> <dest>
+//	deleteall
+//
+//	tag <name>
+//	mark :<idnum>
+//	from <commit-ish>
+//	tagger <name> <<email>> <when>
+//	data <count>
+//	<message>
+//
+//	reset <ref>
+//	from <commit-ish>
+//
+//	done
+//
+// Objects are referred by marks (":<idnum>"), by hash or by reference name.
+// The Encoder and Decoder types read and write commands, the Exporter walks
+// the history of a repository writing it as a stream, and the Importer
+// applies a stream to any storer. The marks assigned while exporting or
+// importing can be persisted with Marks, so a later run can continue an
+// incremental export or import.
+package fastimport
@@ -0,0 +1,292 @@
+package fastimport
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// Encoder writes commands to a fast-import stream.
+type Encoder struct {
+	w *bufio.Writer
+}
+
+// NewEncoder returns a new encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{bufio.NewWriter(w)}
+}
+
+// Encode writes the given command into the stream.
+func (e *Encoder) Encode(cmd Command) error {
+	var err error
+	switch c := cmd.(type) {
+	case *Blob:
+		err = e.encodeBlob(c)
+	case *Commit:
+		err = e.encodeCommit(c)
+	case *Tag:
+		err = e.encodeTag(c)
+	case *Reset:
+		err = e.encodeReset(c)
+	case *Feature:
+		err = e.encodeFeature(c)
+	case *Progress:
+		err = e.line("progress %s", c.Message)
+	case *Checkpoint:
+		err = e.line("checkpoint")
+	case *Done:
+		err = e.line("done")
+	default:
+		err = ErrUnsupportedCommand
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return e.w.Flush()
+}
+
+func (e *Encoder) encodeBlob(b *Blob) error {
+	if err := e.line("blob"); err != nil {
+		return err
+	}
+
+	if err := e.mark(b.Mark); err != nil {
+		return err
+	}
+
+	if err := e.originalOID(b.OriginalOID); err != nil {
+		return err
+	}
+
+	return e.data(b.Data)
+}
+
+func (e *Encoder) encodeCommit(c *Commit) error {
+	if err := e.line("commit %s", c.Ref); err != nil {
+		return err
+	}
+
+	if err := e.mark(c.Mark); err != nil {
+		return err
+	}
+
+	if err := e.originalOID(c.OriginalOID); err != nil {
+		return err
+	}
+
+	if c.Author != nil {
+		if err := e.signature("author", c.Author); err != nil {
+			return err
+		}
+	}
+
+	if err := e.signature("committer", &c.Committer); err != nil {
+		return err
+	}
+
+	if c.Encoding != "" {
+		if err := e.line("encoding %s", c.Encoding); err != nil {
+			return err
+		}
+	}
+
+	if err := e.data([]byte(c.Message)); err != nil {
+		return err
+	}
+
+	if c.From != "" {
+		if err := e.line("from %s", c.From); err != nil {
+			return err
+		}
+	}
+
+	for _, m := range c.Merge {
+		if err := e.line("merge %s", m); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range c.Files {
+		if err := e.encodeFileCommand(f); err != nil {
+			return err
+		}
+	}
+
+	return e.line("")
+}
+
+func (e *Encoder) encodeFileCommand(f FileCommand) error {
+	switch c := f.(type) {
+	case *FileModify:
+		if err := e.line("M %o %s %s", uint32(c.Mode), c.DataRef, quotePath(c.Path)); err != nil {
+			return err
+		}
+
+		if c.DataRef == InlineData {
+			return e.data(c.Data)
+		}
+
+		return nil
+	case *FileDelete:
+		return e.line("D %s", quotePath(c.Path))
+	case *FileCopy:
+		return e.line("C %s %s", quoteSourcePath(c.Source), quotePath(c.Dest))
+	case *FileRename:
+		return e.line("R %s %s", quoteSourcePath(c.Source), quotePath(c.Dest))
+	case *FileDeleteAll:
+		return e.line("deleteall")
+	default:
+		return ErrUnsupportedCommand
+	}
+}
+
+func (e *Encoder) encodeTag(t *Tag) error {
+	if err := e.line("tag %s", t.Name); err != nil {
+		return err
+	}
+
+	if err := e.mark(t.Mark); err != nil {
+		return err
+	}
+
+	if err := e.line("from %s", t.From); err != nil {
+		return err
+	}
+
+	if err := e.originalOID(t.OriginalOID); err != nil {
+		return err
+	}
+
+	if t.Tagger != nil {
+		if err := e.signature("tagger", t.Tagger); err != nil {
+			return err
+		}
+	}
+
+	if err := e.data([]byte(t.Message)); err != nil {
+		return err
+	}
+
+	return e.line("")
+}
+
+func (e *Encoder) encodeReset(r *Reset) error {
+	if err := e.line("reset %s", r.Ref); err != nil {
+		return err
+	}
+
+	if r.From != "" {
+		if err := e.line("from %s", r.From); err != nil {
+			return err
+		}
+	}
+
+	return e.line("")
+}
+
+func (e *Encoder) encodeFeature(f *Feature) error {
+	if f.Value == "" {
+		return e.line("feature %s", f.Name)
+	}
+
+	return e.line("feature %s=%s", f.Name, f.Value)
+}
+
+func (e *Encoder) mark(m Mark) error {
+	if m == 0 {
+		return nil
+	}
+
+	return e.line("mark %s", m)
+}
+
+func (e *Encoder) originalOID(oid string) error {
+	if oid == "" {
+		return nil
+	}
+
+	return e.line("original-oid %s", oid)
+}
+
+func (e *Encoder) signature(kind string, s *object.Signature) error {
+	if _, err := e.w.WriteString(kind + " "); err != nil {
+		return err
+	}
+
+	if err := s.Encode(e.w); err != nil {
+		return err
+	}
+
+	return e.line("")
+}
+
+func (e *Encoder) data(b []byte) error {
+	if err := e.line("data %d", len(b)); err != nil {
+		return err
+	}
+
+	if _, err := e.w.Write(b); err != nil {
+		return err
+	}
+
+	return e.line("")
+}
+
+func (e *Encoder) line(format string, a ...interface{}) error {
+	if _, err := fmt.Fprintf(e.w, format, a...); err != nil {
+		return err
+	}
+
+	return e.w.WriteByte('\n')
+}
+
+// quotePath quotes a path using the C-style quoting understood by
+// fast-import, only if needed.
+func quotePath(p string) string {
+	if !strings.ContainsAny(p, "\"\\\n") && !strings.HasPrefix(p, "\"") {
+		return p
+	}
+
+	return quote(p)
+}
+
+// quoteSourcePath quotes the source path of a copy or rename, which is
+// delimited by a space.
+func quoteSourcePath(p string) string {
+	if strings.ContainsRune(p, ' ') {
+		return quote(p)
+	}
+
+	return quotePath(p)
+}
+
+func quote(p string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(p); i++ {
+		switch c := p[i]; c {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if c < 0x20 || c == 0x7f {
+				fmt.Fprintf(&b, `\%03o`, c)
+				continue
+			}
+
+			b.WriteByte(c)
+		}
+	}
+
+	b.WriteByte('"')
+	return b.String()
+}
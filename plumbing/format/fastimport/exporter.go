@@ -0,0 +1,392 @@
+package fastimport
+
+import (
+	"io"
+	"sort"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/utils/merkletrie"
+	"gopkg.in/src-d/go-git.v4/utils/ioutil"
+)
+
+// Exporter writes the history of references as a fast-import stream, like
+// `git fast-export` does. Objects already present in the marks table are not
+// exported again, so a marks table saved after an export can be used to
+// resume from it.
+//
+// The PGP signatures of commits and tags are not exported.
+type Exporter struct {
+	s        storer.EncodedObjectStorer
+	e        *Encoder
+	marks    *Marks
+	excluded map[plumbing.Hash]bool
+}
+
+// NewExporter returns a new exporter writing to w the objects from s. If m is
+// nil a new marks table is used.
+func NewExporter(w io.Writer, s storer.EncodedObjectStorer, m *Marks) *Exporter {
+	if m == nil {
+		m = NewMarks()
+	}
+
+	return &Exporter{
+		s:        s,
+		e:        NewEncoder(w),
+		marks:    m,
+		excluded: make(map[plumbing.Hash]bool),
+	}
+}
+
+// Marks returns the marks table used by the exporter.
+func (e *Exporter) Marks() *Marks {
+	return e.marks
+}
+
+// Exclude declares commits already present in the destination of the stream,
+// neither they nor their ancestors are exported, and they are referred by
+// hash. The commits must be available in the storer, since the changes of
+// their children are computed from them.
+func (e *Exporter) Exclude(commits ...plumbing.Hash) {
+	for _, h := range commits {
+		e.excluded[h] = true
+	}
+}
+
+// Export writes the commits reachable from the given references and not yet
+// exported, followed by the commands required to update the references.
+// Symbolic references are ignored.
+func (e *Exporter) Export(refs ...*plumbing.Reference) error {
+	for _, ref := range refs {
+		if ref.Type() != plumbing.HashReference {
+			continue
+		}
+
+		if err := e.exportReference(ref); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *Exporter) exportReference(ref *plumbing.Reference) error {
+	obj, err := object.GetObject(e.s, ref.Hash())
+	if err != nil {
+		return err
+	}
+
+	var tag *object.Tag
+	if t, ok := obj.(*object.Tag); ok {
+		tag = t
+		if obj, err = t.Object(); err != nil {
+			return err
+		}
+	}
+
+	c, ok := obj.(*object.Commit)
+	if !ok {
+		return plumbing.ErrInvalidType
+	}
+
+	if tag != nil && e.isMarked(tag.Hash) {
+		return nil
+	}
+
+	commits, err := e.pendingCommits(c)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range commits {
+		if err := e.exportCommit(ref.Name(), c); err != nil {
+			return err
+		}
+	}
+
+	if tag != nil {
+		return e.exportTag(ref.Name(), tag)
+	}
+
+	if len(commits) != 0 {
+		return nil
+	}
+
+	return e.e.Encode(&Reset{Ref: ref.Name(), From: e.commitish(c.Hash)})
+}
+
+// pendingCommits returns the commits reachable from tip not yet exported,
+// sorted so parents come before their children.
+func (e *Exporter) pendingCommits(tip *object.Commit) ([]*object.Commit, error) {
+	pending := make(map[plumbing.Hash]*object.Commit)
+	seen := e.marks.marked()
+	for h := range e.excluded {
+		seen[h] = true
+	}
+
+	iter := object.NewCommitPreorderIter(tip, seen, nil)
+	err := iter.ForEach(func(c *object.Commit) error {
+		pending[c.Hash] = c
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	var sorted []*object.Commit
+	if _, ok := pending[tip.Hash]; !ok {
+		return sorted, nil
+	}
+
+	// The commits are sorted with a post-order walk, using an explicit
+	// stack instead of recursion, since the histories may be very long.
+	type frame struct {
+		commit *object.Commit
+		parent int
+	}
+
+	visited := map[plumbing.Hash]bool{tip.Hash: true}
+	stack := []*frame{{commit: tip}}
+	for len(stack) != 0 {
+		f := stack[len(stack)-1]
+		if f.parent == len(f.commit.ParentHashes) {
+			sorted = append(sorted, f.commit)
+			stack = stack[:len(stack)-1]
+			continue
+		}
+
+		h := f.commit.ParentHashes[f.parent]
+		f.parent++
+		if p, ok := pending[h]; ok && !visited[h] {
+			visited[h] = true
+			stack = append(stack, &frame{commit: p})
+		}
+	}
+
+	return sorted, nil
+}
+
+func (e *Exporter) exportCommit(ref plumbing.ReferenceName, c *object.Commit) error {
+	files, err := e.exportChanges(c)
+	if err != nil {
+		return err
+	}
+
+	if c.NumParents() == 0 {
+		if err := e.e.Encode(&Reset{Ref: ref}); err != nil {
+			return err
+		}
+	}
+
+	author := c.Author
+	cmd := &Commit{
+		Ref:       ref,
+		Mark:      e.marks.Next(),
+		Author:    &author,
+		Committer: c.Committer,
+		Message:   c.Message,
+		Encoding:  c.Encoding,
+		Files:     files,
+	}
+
+	for i, h := range c.ParentHashes {
+		if i == 0 {
+			cmd.From = e.commitish(h)
+			continue
+		}
+
+		cmd.Merge = append(cmd.Merge, e.commitish(h))
+	}
+
+	if err := e.e.Encode(cmd); err != nil {
+		return err
+	}
+
+	e.marks.Set(cmd.Mark, c.Hash)
+	return nil
+}
+
+// exportChanges writes the blobs changed by the commit from its first parent
+// and returns the file commands to apply them. The trees are compared with
+// object.DiffTree, so the unchanged subtrees aren't walked.
+func (e *Exporter) exportChanges(c *object.Commit) ([]FileCommand, error) {
+	to, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	var from *object.Tree
+	if c.NumParents() > 0 {
+		p, err := c.Parent(0)
+		if err != nil {
+			return nil, err
+		}
+
+		if from, err = p.Tree(); err != nil {
+			return nil, err
+		}
+	}
+
+	changes, err := object.DiffTree(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var deleted []string
+	var modified []object.ChangeEntry
+	for _, ch := range changes {
+		action, err := ch.Action()
+		if err != nil {
+			return nil, err
+		}
+
+		switch action {
+		case merkletrie.Delete:
+			deleted = append(deleted, ch.From.Name)
+		default:
+			modified = append(modified, ch.To)
+		}
+	}
+
+	sort.Strings(deleted)
+	sort.Slice(modified, func(i, j int) bool {
+		return modified[i].Name < modified[j].Name
+	})
+
+	var files []FileCommand
+	for _, name := range deleted {
+		files = append(files, &FileDelete{Path: name})
+	}
+
+	for _, entry := range modified {
+		ref, err := e.exportEntry(entry.TreeEntry)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, &FileModify{Mode: entry.TreeEntry.Mode, DataRef: ref, Path: entry.Name})
+	}
+
+	return files, nil
+}
+
+// exportEntry writes the blob of the entry if needed and returns its dataref.
+func (e *Exporter) exportEntry(entry object.TreeEntry) (string, error) {
+	if entry.Mode == filemode.Submodule {
+		return entry.Hash.String(), nil
+	}
+
+	if mark, ok := e.marks.Mark(entry.Hash); ok {
+		return mark.String(), nil
+	}
+
+	data, err := e.blobData(entry.Hash)
+	if err != nil {
+		return "", err
+	}
+
+	b := &Blob{Mark: e.marks.Next(), Data: data}
+	if err := e.e.Encode(b); err != nil {
+		return "", err
+	}
+
+	e.marks.Set(b.Mark, entry.Hash)
+	return b.Mark.String(), nil
+}
+
+func (e *Exporter) blobData(h plumbing.Hash) (data []byte, err error) {
+	obj, err := e.s.EncodedObject(plumbing.BlobObject, h)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := obj.Reader()
+	if err != nil {
+		return nil, err
+	}
+
+	defer ioutil.CheckClose(r, &err)
+	return readAll(r, obj.Size())
+}
+
+func (e *Exporter) exportTag(ref plumbing.ReferenceName, t *object.Tag) error {
+	if t.TargetType != plumbing.CommitObject {
+		return plumbing.ErrInvalidType
+	}
+
+	tagger := t.Tagger
+	cmd := &Tag{
+		Name:    strings.TrimPrefix(ref.String(), "refs/tags/"),
+		Mark:    e.marks.Next(),
+		From:    e.commitish(t.Target),
+		Tagger:  &tagger,
+		Message: t.Message,
+	}
+
+	if err := e.e.Encode(cmd); err != nil {
+		return err
+	}
+
+	e.marks.Set(cmd.Mark, t.Hash)
+	return nil
+}
+
+func (e *Exporter) isMarked(h plumbing.Hash) bool {
+	_, ok := e.marks.Mark(h)
+	return ok
+}
+
+// commitish returns the mark of the given object or its hash if not marked.
+func (e *Exporter) commitish(h plumbing.Hash) string {
+	if mark, ok := e.marks.Mark(h); ok {
+		return mark.String()
+	}
+
+	return h.String()
+}
+
+// flattenCommit returns all the non-tree entries of the tree of c by path.
+func flattenCommit(c *object.Commit) (map[string]object.TreeEntry, error) {
+	t, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	return flattenTree(t)
+}
+
+func flattenTree(t *object.Tree) (map[string]object.TreeEntry, error) {
+	entries := make(map[string]object.TreeEntry)
+	w := object.NewTreeWalker(t, true, nil)
+	defer w.Close()
+
+	for {
+		name, entry, err := w.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if entry.Mode == filemode.Dir {
+			continue
+		}
+
+		entries[name] = entry
+	}
+}
+
+func readAll(r io.Reader, size int64) ([]byte, error) {
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
@@ -0,0 +1,400 @@
+package fastimport
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git-fixtures.v3"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type FastImportSuite struct {
+	fixtures.Suite
+}
+
+var _ = Suite(&FastImportSuite{})
+
+func (s *FastImportSuite) TestEncodeDecode(c *C) {
+	sig := decodeSignature("Foo <foo@example.com> 1257894000 +0100")
+	commands := []Command{
+		&Feature{Name: "done"},
+		&Blob{Mark: 1, Data: []byte("foo\n")},
+		&Reset{Ref: "refs/heads/master"},
+		&Commit{
+			Ref:       "refs/heads/master",
+			Mark:      2,
+			Author:    sig,
+			Committer: *sig,
+			Message:   "first\n",
+			Files: []FileCommand{
+				&FileModify{Mode: filemode.Regular, DataRef: ":1", Path: "foo"},
+				&FileModify{Mode: filemode.Executable, DataRef: InlineData, Data: []byte("bar"), Path: "with \"quotes\""},
+				&FileModify{Mode: filemode.Symlink, DataRef: ":1", Path: "link"},
+			},
+		},
+		&Commit{
+			Ref:       "refs/heads/master",
+			Mark:      3,
+			Committer: *sig,
+			Message:   "second\n",
+			From:      ":2",
+			Merge:     []string{"6ecf0ef2c2dffb796033e5a02219af86ec6584e5"},
+			Files: []FileCommand{
+				&FileDelete{Path: "foo"},
+				&FileCopy{Source: "with space", Dest: "qux"},
+				&FileRename{Source: "link", Dest: "new\nline"},
+				&FileDeleteAll{},
+			},
+		},
+		&Tag{Name: "v1.0", Mark: 4, From: ":3", Tagger: sig, Message: "tag\n"},
+		&Reset{Ref: "refs/heads/other", From: ":3"},
+		&Progress{Message: "halfway"},
+		&Checkpoint{},
+		&Done{},
+	}
+
+	buf := bytes.NewBuffer(nil)
+	e := NewEncoder(buf)
+	for _, cmd := range commands {
+		c.Assert(e.Encode(cmd), IsNil)
+	}
+
+	d := NewDecoder(buf)
+	for _, expected := range commands {
+		cmd, err := d.Decode()
+		c.Assert(err, IsNil)
+		c.Assert(cmd, DeepEquals, expected)
+	}
+
+	_, err := d.Decode()
+	c.Assert(err, Equals, io.EOF)
+}
+
+func (s *FastImportSuite) TestDecode(c *C) {
+	stream := "# comment\n" +
+		"commit refs/heads/master\n" +
+		"committer Foo <foo@example.com> 1257894000 +0100\n" +
+		"data <<EOF\n" +
+		"message\n" +
+		"EOF\n" +
+		"M 644 inline \"a\\tb\"\n" +
+		"data 3\n" +
+		"foo" +
+		"C \"a\\tb\" c\n" +
+		"\n" +
+		"done\n"
+
+	d := NewDecoder(strings.NewReader(stream))
+	cmd, err := d.Decode()
+	c.Assert(err, IsNil)
+
+	commit, ok := cmd.(*Commit)
+	c.Assert(ok, Equals, true)
+	c.Assert(commit.Ref, Equals, plumbing.ReferenceName("refs/heads/master"))
+	c.Assert(commit.Author, IsNil)
+	c.Assert(commit.Committer.Email, Equals, "foo@example.com")
+	c.Assert(commit.Message, Equals, "message\n")
+	c.Assert(commit.Files, DeepEquals, []FileCommand{
+		&FileModify{Mode: filemode.Regular, DataRef: InlineData, Data: []byte("foo"), Path: "a\tb"},
+		&FileCopy{Source: "a\tb", Dest: "c"},
+	})
+
+	cmd, err = d.Decode()
+	c.Assert(err, IsNil)
+	c.Assert(cmd, DeepEquals, &Done{})
+}
+
+func (s *FastImportSuite) TestDecodeMalformed(c *C) {
+	for _, stream := range []string{
+		"foo\n",
+		"blob\ndata 10\nfoo\n",
+		"commit refs/heads/master\ndata 0\n",
+		"blob\nmark 1\ndata 0\n",
+		"tag v1.0\ndata 0\n",
+	} {
+		_, err := NewDecoder(strings.NewReader(stream)).Decode()
+		c.Assert(err, Equals, ErrMalformedStream, Commentf("stream: %q", stream))
+	}
+
+	_, err := NewDecoder(strings.NewReader("cat-blob :1\n")).Decode()
+	c.Assert(err, Equals, ErrUnsupportedCommand)
+}
+
+func (s *FastImportSuite) TestMarks(c *C) {
+	m := NewMarks()
+	m.Set(2, plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	m.Set(1, plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294"))
+	c.Assert(m.Next(), Equals, Mark(3))
+
+	buf := bytes.NewBuffer(nil)
+	c.Assert(m.Encode(buf), IsNil)
+	c.Assert(buf.String(), Equals, ""+
+		":1 918c48b83bd081e863dbe1b80f8998f058cd8294\n"+
+		":2 6ecf0ef2c2dffb796033e5a02219af86ec6584e5\n")
+
+	decoded := NewMarks()
+	c.Assert(decoded.Decode(buf), IsNil)
+	c.Assert(decoded.Len(), Equals, 2)
+
+	h, ok := decoded.Hash(2)
+	c.Assert(ok, Equals, true)
+	c.Assert(h.String(), Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+
+	mark, ok := decoded.Mark(plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294"))
+	c.Assert(ok, Equals, true)
+	c.Assert(mark, Equals, Mark(1))
+	c.Assert(decoded.Next(), Equals, Mark(3))
+
+	c.Assert(decoded.Decode(strings.NewReader("1 foo\n")), NotNil)
+}
+
+func (s *FastImportSuite) TestExportImport(c *C) {
+	src := filesystem.NewStorage(fixtures.Basic().One().DotGit(), cache.NewObjectLRUDefault())
+	master, err := src.Reference(plumbing.Master)
+	c.Assert(err, IsNil)
+	branch, err := src.Reference("refs/heads/branch")
+	c.Assert(err, IsNil)
+
+	buf := bytes.NewBuffer(nil)
+	c.Assert(NewExporter(buf, src, nil).Export(master, branch), IsNil)
+
+	dst := memory.NewStorage()
+	c.Assert(NewImporter(dst, dst, nil).Import(buf), IsNil)
+
+	for _, ref := range []*plumbing.Reference{master, branch} {
+		imported, err := dst.Reference(ref.Name())
+		c.Assert(err, IsNil)
+		c.Assert(imported.Hash(), Equals, ref.Hash())
+	}
+
+	commit, err := object.GetCommit(dst, master.Hash())
+	c.Assert(err, IsNil)
+	files, err := flattenCommit(commit)
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 9)
+}
+
+func (s *FastImportSuite) TestIncrementalExportImport(c *C) {
+	src := filesystem.NewStorage(fixtures.Basic().One().DotGit(), cache.NewObjectLRUDefault())
+	master, err := src.Reference(plumbing.Master)
+	c.Assert(err, IsNil)
+	branch, err := src.Reference("refs/heads/branch")
+	c.Assert(err, IsNil)
+
+	exportMarks := NewMarks()
+	first := bytes.NewBuffer(nil)
+	c.Assert(NewExporter(first, src, exportMarks).Export(branch), IsNil)
+	exported := exportMarks.Len()
+
+	second := bytes.NewBuffer(nil)
+	c.Assert(NewExporter(second, src, exportMarks).Export(master, branch), IsNil)
+	c.Assert(exportMarks.Len() > exported, Equals, true)
+	c.Assert(strings.Count(second.String(), "\ncommit "), Equals, 1)
+	c.Assert(strings.HasSuffix(second.String(), "reset refs/heads/branch\nfrom :"+
+		mustMark(c, exportMarks, branch.Hash())+"\n\n"), Equals, true)
+
+	dst := memory.NewStorage()
+	importMarks := NewMarks()
+	c.Assert(NewImporter(dst, dst, importMarks).Import(first), IsNil)
+
+	saved := bytes.NewBuffer(nil)
+	c.Assert(importMarks.Encode(saved), IsNil)
+	resumed := NewMarks()
+	c.Assert(resumed.Decode(saved), IsNil)
+	c.Assert(NewImporter(dst, dst, resumed).Import(second), IsNil)
+
+	for _, ref := range []*plumbing.Reference{master, branch} {
+		imported, err := dst.Reference(ref.Name())
+		c.Assert(err, IsNil)
+		c.Assert(imported.Hash(), Equals, ref.Hash())
+	}
+}
+
+func (s *FastImportSuite) TestExportExclude(c *C) {
+	src := filesystem.NewStorage(fixtures.Basic().One().DotGit(), cache.NewObjectLRUDefault())
+	master, err := src.Reference(plumbing.Master)
+	c.Assert(err, IsNil)
+
+	parent := plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294")
+	buf := bytes.NewBuffer(nil)
+	e := NewExporter(buf, src, nil)
+	e.Exclude(parent)
+	c.Assert(e.Export(master), IsNil)
+
+	c.Assert(strings.Count(buf.String(), "\ncommit "), Equals, 1)
+	c.Assert(strings.Contains(buf.String(), "\nfrom "+parent.String()+"\n"), Equals, true)
+}
+
+func (s *FastImportSuite) TestExportImportChangesAndEncoding(c *C) {
+	src := memory.NewStorage()
+	foo := writeBlob(c, src, "foo\n")
+	bar := writeBlob(c, src, "bar\n")
+
+	dir := writeObject(c, src, &object.Tree{Entries: []object.TreeEntry{
+		{Name: "a", Mode: filemode.Regular, Hash: foo},
+		{Name: "b", Mode: filemode.Regular, Hash: foo},
+	}})
+	changed := writeObject(c, src, &object.Tree{Entries: []object.TreeEntry{
+		{Name: "a", Mode: filemode.Regular, Hash: foo},
+		{Name: "b", Mode: filemode.Regular, Hash: bar},
+	}})
+	unchanged := writeObject(c, src, &object.Tree{Entries: []object.TreeEntry{
+		{Name: "c", Mode: filemode.Regular, Hash: foo},
+	}})
+
+	sig := decodeSignature("Foo <foo@example.com> 1257894000 +0100")
+	root := writeObject(c, src, &object.Commit{
+		Author:    *sig,
+		Committer: *sig,
+		Message:   "caf\xe9\n",
+		Encoding:  "ISO-8859-1",
+		TreeHash: writeObject(c, src, &object.Tree{Entries: []object.TreeEntry{
+			{Name: "dir", Mode: filemode.Dir, Hash: dir},
+			{Name: "other", Mode: filemode.Dir, Hash: unchanged},
+			{Name: "x", Mode: filemode.Regular, Hash: foo},
+		}}),
+	})
+	tip := writeObject(c, src, &object.Commit{
+		Author:    *sig,
+		Committer: *sig,
+		Message:   "second\n",
+		TreeHash: writeObject(c, src, &object.Tree{Entries: []object.TreeEntry{
+			{Name: "dir", Mode: filemode.Dir, Hash: changed},
+			{Name: "other", Mode: filemode.Dir, Hash: unchanged},
+		}}),
+		ParentHashes: []plumbing.Hash{root},
+	})
+
+	buf := bytes.NewBuffer(nil)
+	ref := plumbing.NewHashReference(plumbing.Master, tip)
+	c.Assert(NewExporter(buf, src, nil).Export(ref), IsNil)
+
+	stream := buf.String()
+	c.Assert(strings.Count(stream, "\nencoding ISO-8859-1\n"), Equals, 1)
+	second := stream[strings.LastIndex(stream, "\ncommit "):]
+	c.Assert(strings.Contains(second, "\nfrom :2\nD x\nM 100644 :3 dir/b\n"), Equals, true, Commentf("%s", second))
+
+	dst := memory.NewStorage()
+	c.Assert(NewImporter(dst, dst, nil).Import(buf), IsNil)
+
+	imported, err := dst.Reference(plumbing.Master)
+	c.Assert(err, IsNil)
+	c.Assert(imported.Hash(), Equals, tip)
+
+	commit, err := object.GetCommit(dst, root)
+	c.Assert(err, IsNil)
+	c.Assert(commit.Encoding, Equals, "ISO-8859-1")
+}
+
+func (s *FastImportSuite) TestPendingCommitsLongHistory(c *C) {
+	sto := memory.NewStorage()
+	tree := sto.NewEncodedObject()
+	c.Assert((&object.Tree{}).Encode(tree), IsNil)
+	treeHash, err := sto.SetEncodedObject(tree)
+	c.Assert(err, IsNil)
+
+	sig := decodeSignature("Foo <foo@example.com> 1257894000 +0100")
+	var parents []plumbing.Hash
+	var tip *object.Commit
+	for i := 0; i < 10000; i++ {
+		commit := &object.Commit{
+			Author:       *sig,
+			Committer:    *sig,
+			Message:      "commit\n",
+			TreeHash:     treeHash,
+			ParentHashes: parents,
+		}
+
+		obj := sto.NewEncodedObject()
+		c.Assert(commit.Encode(obj), IsNil)
+		h, err := sto.SetEncodedObject(obj)
+		c.Assert(err, IsNil)
+
+		tip, err = object.GetCommit(sto, h)
+		c.Assert(err, IsNil)
+		parents = []plumbing.Hash{h}
+	}
+
+	commits, err := NewExporter(bytes.NewBuffer(nil), sto, nil).pendingCommits(tip)
+	c.Assert(err, IsNil)
+	c.Assert(commits, HasLen, 10000)
+	c.Assert(commits[0].NumParents(), Equals, 0)
+	for i := 1; i < len(commits); i++ {
+		c.Assert(commits[i].ParentHashes, DeepEquals, []plumbing.Hash{commits[i-1].Hash})
+	}
+
+	c.Assert(commits[len(commits)-1].Hash, Equals, tip.Hash)
+}
+
+func (s *FastImportSuite) TestImportFileCommands(c *C) {
+	stream := "blob\nmark :1\ndata 4\nfoo\n" +
+		"commit refs/heads/master\nmark :2\n" +
+		"committer Foo <foo@example.com> 1257894000 +0100\ndata 6\nfirst\n" +
+		"M 100644 :1 a/b/c\nM 100755 :1 d\n\n" +
+		"commit refs/heads/master\nmark :3\n" +
+		"committer Foo <foo@example.com> 1257894000 +0100\ndata 7\nsecond\n" +
+		"R a e\nC d a\nD e/b/c\nM 120000 inline f\ndata 1\nd\n\n"
+
+	dst := memory.NewStorage()
+	i := NewImporter(dst, dst, nil)
+	c.Assert(i.Import(strings.NewReader(stream)), IsNil)
+
+	ref, err := dst.Reference(plumbing.Master)
+	c.Assert(err, IsNil)
+	h, ok := i.Marks().Hash(3)
+	c.Assert(ok, Equals, true)
+	c.Assert(ref.Hash(), Equals, h)
+
+	commit, err := object.GetCommit(dst, h)
+	c.Assert(err, IsNil)
+	c.Assert(commit.NumParents(), Equals, 1)
+	c.Assert(commit.Author.Email, Equals, "foo@example.com")
+
+	files, err := flattenCommit(commit)
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 3)
+	c.Assert(files["a"].Mode, Equals, filemode.Executable)
+	c.Assert(files["d"].Mode, Equals, filemode.Executable)
+	c.Assert(files["f"].Mode, Equals, filemode.Symlink)
+}
+
+func writeBlob(c *C, sto *memory.Storage, content string) plumbing.Hash {
+	obj := sto.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	w, err := obj.Writer()
+	c.Assert(err, IsNil)
+	_, err = io.WriteString(w, content)
+	c.Assert(err, IsNil)
+	c.Assert(w.Close(), IsNil)
+
+	h, err := sto.SetEncodedObject(obj)
+	c.Assert(err, IsNil)
+	return h
+}
+
+func writeObject(c *C, sto *memory.Storage, o interface {
+	Encode(plumbing.EncodedObject) error
+}) plumbing.Hash {
+	obj := sto.NewEncodedObject()
+	c.Assert(o.Encode(obj), IsNil)
+	h, err := sto.SetEncodedObject(obj)
+	c.Assert(err, IsNil)
+	return h
+}
+
+func mustMark(c *C, m *Marks, h plumbing.Hash) string {
+	mark, ok := m.Mark(h)
+	c.Assert(ok, Equals, true)
+	return mark.String()[1:]
+}
@@ -0,0 +1,516 @@
+package fastimport
+
+import (
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+// Importer reads a fast-import stream writing its objects into an object
+// storer and updating the references, like `git fast-import` does. The marks
+// assigned by the stream are recorded in the marks table, so it can be saved
+// and used by a later import.
+//
+// References are updated forcibly at checkpoints and at the end of the
+// stream.
+type Importer struct {
+	s     storer.EncodedObjectStorer
+	r     storer.ReferenceStorer
+	marks *Marks
+	refs  map[plumbing.ReferenceName]plumbing.Hash
+}
+
+// NewImporter returns a new importer writing the objects into s and the
+// references into r. If m is nil a new marks table is used.
+func NewImporter(s storer.EncodedObjectStorer, r storer.ReferenceStorer, m *Marks) *Importer {
+	if m == nil {
+		m = NewMarks()
+	}
+
+	return &Importer{
+		s:     s,
+		r:     r,
+		marks: m,
+		refs:  make(map[plumbing.ReferenceName]plumbing.Hash),
+	}
+}
+
+// Marks returns the marks table used by the importer.
+func (i *Importer) Marks() *Marks {
+	return i.marks
+}
+
+// Import reads and applies all the commands from r, until the end of the
+// stream or a done command.
+func (i *Importer) Import(r io.Reader) error {
+	d := NewDecoder(r)
+	for {
+		cmd, err := d.Decode()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if _, ok := cmd.(*Done); ok {
+			break
+		}
+
+		if err := i.Apply(cmd); err != nil {
+			return err
+		}
+	}
+
+	return i.updateReferences()
+}
+
+// Apply applies a single command. The references are only updated by
+// checkpoint commands, use Import to process a full stream.
+func (i *Importer) Apply(cmd Command) error {
+	switch c := cmd.(type) {
+	case *Blob:
+		return i.importBlob(c)
+	case *Commit:
+		return i.importCommit(c)
+	case *Tag:
+		return i.importTag(c)
+	case *Reset:
+		return i.importReset(c)
+	case *Feature:
+		return checkFeature(c)
+	case *Checkpoint:
+		return i.updateReferences()
+	case *Progress, *Done:
+		return nil
+	default:
+		return ErrUnsupportedCommand
+	}
+}
+
+func checkFeature(f *Feature) error {
+	switch f.Name {
+	case "date-format":
+		if f.Value != "raw" {
+			return ErrUnsupportedCommand
+		}
+	case "cat-blob", "ls", "get-mark", "notes":
+		return ErrUnsupportedCommand
+	}
+
+	return nil
+}
+
+func (i *Importer) importBlob(b *Blob) error {
+	h, err := i.writeBlob(b.Data)
+	if err != nil {
+		return err
+	}
+
+	if b.Mark != 0 {
+		i.marks.Set(b.Mark, h)
+	}
+
+	return nil
+}
+
+func (i *Importer) importCommit(c *Commit) error {
+	var parents []plumbing.Hash
+	if c.From != "" {
+		h, err := i.resolve(c.From)
+		if err != nil {
+			return err
+		}
+
+		if !h.IsZero() {
+			parents = append(parents, h)
+		}
+	} else {
+		h, err := i.reference(c.Ref)
+		if err != nil {
+			return err
+		}
+
+		if !h.IsZero() {
+			parents = append(parents, h)
+		}
+	}
+
+	for _, m := range c.Merge {
+		h, err := i.resolve(m)
+		if err != nil {
+			return err
+		}
+
+		parents = append(parents, h)
+	}
+
+	files := make(map[string]object.TreeEntry)
+	if len(parents) != 0 {
+		parent, err := object.GetCommit(i.s, parents[0])
+		if err != nil {
+			return err
+		}
+
+		if files, err = flattenCommit(parent); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range c.Files {
+		if err := i.applyFile(files, f); err != nil {
+			return err
+		}
+	}
+
+	tree, err := i.writeTree(files)
+	if err != nil {
+		return err
+	}
+
+	commit := &object.Commit{
+		Author:       c.Committer,
+		Committer:    c.Committer,
+		Message:      c.Message,
+		Encoding:     c.Encoding,
+		TreeHash:     tree,
+		ParentHashes: parents,
+	}
+
+	if c.Author != nil {
+		commit.Author = *c.Author
+	}
+
+	h, err := i.writeObject(commit)
+	if err != nil {
+		return err
+	}
+
+	if c.Mark != 0 {
+		i.marks.Set(c.Mark, h)
+	}
+
+	i.refs[c.Ref] = h
+	return nil
+}
+
+func (i *Importer) applyFile(files map[string]object.TreeEntry, f FileCommand) error {
+	switch c := f.(type) {
+	case *FileModify:
+		return i.modifyFile(files, c)
+	case *FileDelete:
+		deletePath(files, c.Path)
+	case *FileCopy:
+		copyPath(files, c.Source, c.Dest)
+	case *FileRename:
+		copyPath(files, c.Source, c.Dest)
+		deletePath(files, c.Source)
+	case *FileDeleteAll:
+		for name := range files {
+			delete(files, name)
+		}
+	default:
+		return ErrUnsupportedCommand
+	}
+
+	return nil
+}
+
+func (i *Importer) modifyFile(files map[string]object.TreeEntry, f *FileModify) error {
+	var h plumbing.Hash
+	var err error
+	if f.DataRef == InlineData {
+		h, err = i.writeBlob(f.Data)
+	} else {
+		h, err = i.resolve(f.DataRef)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	deletePath(files, f.Path)
+	for dir := path.Dir(f.Path); dir != "."; dir = path.Dir(dir) {
+		delete(files, dir)
+	}
+
+	if f.Mode != filemode.Dir {
+		files[f.Path] = object.TreeEntry{Name: path.Base(f.Path), Mode: f.Mode, Hash: h}
+		return nil
+	}
+
+	t, err := object.GetTree(i.s, h)
+	if err != nil {
+		return err
+	}
+
+	entries, err := flattenTree(t)
+	if err != nil {
+		return err
+	}
+
+	for name, e := range entries {
+		files[path.Join(f.Path, name)] = e
+	}
+
+	return nil
+}
+
+func (i *Importer) importTag(t *Tag) error {
+	target, err := i.resolve(t.From)
+	if err != nil {
+		return err
+	}
+
+	obj, err := i.s.EncodedObject(plumbing.AnyObject, target)
+	if err != nil {
+		return err
+	}
+
+	tag := &object.Tag{
+		Name:       t.Name,
+		Message:    t.Message,
+		TargetType: obj.Type(),
+		Target:     target,
+	}
+
+	if t.Tagger != nil {
+		tag.Tagger = *t.Tagger
+	}
+
+	h, err := i.writeObject(tag)
+	if err != nil {
+		return err
+	}
+
+	if t.Mark != 0 {
+		i.marks.Set(t.Mark, h)
+	}
+
+	i.refs[plumbing.ReferenceName("refs/tags/"+t.Name)] = h
+	return nil
+}
+
+func (i *Importer) importReset(r *Reset) error {
+	if r.From == "" {
+		i.refs[r.Ref] = plumbing.ZeroHash
+		return nil
+	}
+
+	h, err := i.resolve(r.From)
+	if err != nil {
+		return err
+	}
+
+	i.refs[r.Ref] = h
+	return nil
+}
+
+// updateReferences writes the references modified since the last update.
+func (i *Importer) updateReferences() error {
+	names := make([]string, 0, len(i.refs))
+	for name := range i.refs {
+		names = append(names, name.String())
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		n := plumbing.ReferenceName(name)
+		h := i.refs[n]
+		if h.IsZero() {
+			continue
+		}
+
+		if err := i.r.SetReference(plumbing.NewHashReference(n, h)); err != nil {
+			return err
+		}
+
+		delete(i.refs, n)
+	}
+
+	return nil
+}
+
+// resolve returns the object referenced by a mark, a hash or a reference.
+func (i *Importer) resolve(ref string) (plumbing.Hash, error) {
+	if strings.HasPrefix(ref, ":") {
+		n, err := strconv.ParseUint(ref[1:], 10, 64)
+		if err != nil {
+			return plumbing.ZeroHash, ErrMalformedStream
+		}
+
+		h, ok := i.marks.Hash(Mark(n))
+		if !ok {
+			return plumbing.ZeroHash, plumbing.ErrObjectNotFound
+		}
+
+		return h, nil
+	}
+
+	if plumbing.IsHash(ref) {
+		return plumbing.NewHash(ref), nil
+	}
+
+	h, err := i.reference(plumbing.ReferenceName(ref))
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if h.IsZero() {
+		return plumbing.ZeroHash, plumbing.ErrReferenceNotFound
+	}
+
+	return h, nil
+}
+
+// reference returns the current value of a reference, a zero hash is
+// returned if the reference doesn't exist or has been reset.
+func (i *Importer) reference(name plumbing.ReferenceName) (plumbing.Hash, error) {
+	if h, ok := i.refs[name]; ok {
+		return h, nil
+	}
+
+	ref, err := storer.ResolveReference(i.r, name)
+	if err == plumbing.ErrReferenceNotFound {
+		return plumbing.ZeroHash, nil
+	}
+
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return ref.Hash(), nil
+}
+
+func (i *Importer) writeBlob(data []byte) (plumbing.Hash, error) {
+	obj := i.s.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	obj.SetSize(int64(len(data)))
+
+	w, err := obj.Writer()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if _, err := w.Write(data); err != nil {
+		_ = w.Close()
+		return plumbing.ZeroHash, err
+	}
+
+	if err := w.Close(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return i.s.SetEncodedObject(obj)
+}
+
+// writeTree writes the trees holding the given files and returns the hash of
+// the root tree.
+func (i *Importer) writeTree(files map[string]object.TreeEntry) (plumbing.Hash, error) {
+	trees := map[string]*object.Tree{"": {}}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		dir := ""
+		parts := strings.Split(name, "/")
+		for _, part := range parts[:len(parts)-1] {
+			sub := path.Join(dir, part)
+			if _, ok := trees[sub]; !ok {
+				trees[sub] = &object.Tree{}
+				trees[dir].Entries = append(trees[dir].Entries, object.TreeEntry{
+					Name: part, Mode: filemode.Dir,
+				})
+			}
+
+			dir = sub
+		}
+
+		e := files[name]
+		e.Name = parts[len(parts)-1]
+		trees[dir].Entries = append(trees[dir].Entries, e)
+	}
+
+	return i.writeTreeRecursive("", trees)
+}
+
+func (i *Importer) writeTreeRecursive(dir string, trees map[string]*object.Tree) (plumbing.Hash, error) {
+	t := trees[dir]
+	for j, e := range t.Entries {
+		if e.Mode != filemode.Dir {
+			continue
+		}
+
+		h, err := i.writeTreeRecursive(path.Join(dir, e.Name), trees)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		t.Entries[j].Hash = h
+	}
+
+	sort.Sort(sortableEntries(t.Entries))
+	return i.writeObject(t)
+}
+
+func (i *Importer) writeObject(o object.Object) (plumbing.Hash, error) {
+	obj := i.s.NewEncodedObject()
+	if err := o.Encode(obj); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return i.s.SetEncodedObject(obj)
+}
+
+// deletePath removes the file or the directory with the given path.
+func deletePath(files map[string]object.TreeEntry, p string) {
+	p = strings.Trim(p, "/")
+	delete(files, p)
+	for name := range files {
+		if strings.HasPrefix(name, p+"/") || p == "" {
+			delete(files, name)
+		}
+	}
+}
+
+// copyPath copies the file or the directory src to dst.
+func copyPath(files map[string]object.TreeEntry, src, dst string) {
+	src, dst = strings.Trim(src, "/"), strings.Trim(dst, "/")
+	copied := make(map[string]object.TreeEntry)
+	for name, e := range files {
+		switch {
+		case name == src:
+			copied[dst] = e
+		case strings.HasPrefix(name, src+"/"):
+			copied[dst+name[len(src):]] = e
+		}
+	}
+
+	deletePath(files, dst)
+	for name, e := range copied {
+		files[name] = e
+	}
+}
+
+type sortableEntries []object.TreeEntry
+
+func (sortableEntries) sortName(te object.TreeEntry) string {
+	if te.Mode == filemode.Dir {
+		return te.Name + "/"
+	}
+	return te.Name
+}
+func (se sortableEntries) Len() int               { return len(se) }
+func (se sortableEntries) Less(i int, j int) bool { return se.sortName(se[i]) < se.sortName(se[j]) }
+func (se sortableEntries) Swap(i int, j int)      { se[i], se[j] = se[j], se[i] }
@@ -0,0 +1,124 @@
+package fastimport
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// Marks is the table of marks assigned to objects, it can be read and written
+// in the marks file format used by `--import-marks` and `--export-marks`:
+//
+//	:<idnum> <hash>
+type Marks struct {
+	hashes map[Mark]plumbing.Hash
+	marks  map[plumbing.Hash]Mark
+	last   Mark
+}
+
+// NewMarks returns a new empty marks table.
+func NewMarks() *Marks {
+	return &Marks{
+		hashes: make(map[Mark]plumbing.Hash),
+		marks:  make(map[plumbing.Hash]Mark),
+	}
+}
+
+// Set assigns the mark m to the object h.
+func (m *Marks) Set(mark Mark, h plumbing.Hash) {
+	if old, ok := m.hashes[mark]; ok && m.marks[old] == mark {
+		delete(m.marks, old)
+	}
+
+	m.hashes[mark] = h
+	m.marks[h] = mark
+	if mark > m.last {
+		m.last = mark
+	}
+}
+
+// Hash returns the object with the given mark.
+func (m *Marks) Hash(mark Mark) (plumbing.Hash, bool) {
+	h, ok := m.hashes[mark]
+	return h, ok
+}
+
+// Mark returns the mark of the given object.
+func (m *Marks) Mark(h plumbing.Hash) (Mark, bool) {
+	mark, ok := m.marks[h]
+	return mark, ok
+}
+
+// Next returns a new unused mark.
+func (m *Marks) Next() Mark {
+	m.last++
+	return m.last
+}
+
+// Len returns the number of marks in the table.
+func (m *Marks) Len() int {
+	return len(m.hashes)
+}
+
+// marked returns the set of objects with a mark.
+func (m *Marks) marked() map[plumbing.Hash]bool {
+	set := make(map[plumbing.Hash]bool, len(m.marks))
+	for h := range m.marks {
+		set[h] = true
+	}
+
+	return set
+}
+
+// Decode reads a marks file from r, adding its marks to the table.
+func (m *Marks) Decode(r io.Reader) error {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 || !strings.HasPrefix(fields[0], ":") {
+			return fmt.Errorf("fastimport: malformed marks line %q", line)
+		}
+
+		n, err := strconv.ParseUint(fields[0][1:], 10, 64)
+		if err != nil || n == 0 {
+			return fmt.Errorf("fastimport: malformed marks line %q", line)
+		}
+
+		if !plumbing.IsHash(fields[1]) {
+			return fmt.Errorf("fastimport: malformed marks line %q", line)
+		}
+
+		m.Set(Mark(n), plumbing.NewHash(fields[1]))
+	}
+
+	return s.Err()
+}
+
+// Encode writes the table into w in the marks file format, sorted by mark.
+func (m *Marks) Encode(w io.Writer) error {
+	marks := make([]Mark, 0, len(m.hashes))
+	for mark := range m.hashes {
+		marks = append(marks, mark)
+	}
+
+	sort.Slice(marks, func(i, j int) bool { return marks[i] < marks[j] })
+
+	bw := bufio.NewWriter(w)
+	for _, mark := range marks {
+		if _, err := fmt.Fprintf(bw, "%s %s\n", mark, m.hashes[mark]); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
@@ -0,0 +1,195 @@
+package midx
+
+import (
+	"crypto/sha1"
+	"hash"
+	"io"
+
+	"gopkg.in/src-d/go-git.v4/utils/binary"
+)
+
+// chunkAlignment is the alignment of the chunks, the packfile names are
+// padded to it.
+const chunkAlignment = 4
+
+// Encoder writes multi-pack-index structs to an output stream.
+type Encoder struct {
+	io.Writer
+	hash hash.Hash
+}
+
+// NewEncoder returns a new stream encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	h := sha1.New()
+	mw := io.MultiWriter(w, h)
+	return &Encoder{mw, h}
+}
+
+// Encode writes an index into the multi-pack-index file.
+func (e *Encoder) Encode(idx Index) error {
+	entries := make([]*Entry, idx.Count())
+	fanout := make([]uint32, 256)
+	for i := range entries {
+		entry, err := idx.EntryAt(i)
+		if err != nil {
+			return err
+		}
+
+		entries[i] = entry
+		fanout[entry.Hash[0]]++
+	}
+
+	// Convert the fanout to cumulative values
+	for i := 1; i <= 0xff; i++ {
+		fanout[i] += fanout[i-1]
+	}
+
+	// As git does, the large offsets are only used if any offset doesn't
+	// fit in 32 bits, then the offsets of 31 bits or more are stored there.
+	var largeOffsets []uint64
+	for _, entry := range entries {
+		if entry.Offset > 0xffffffff {
+			largeOffsets = []uint64{}
+			break
+		}
+	}
+
+	if largeOffsets != nil {
+		for _, entry := range entries {
+			if entry.Offset > 0x7fffffff {
+				largeOffsets = append(largeOffsets, uint64(entry.Offset))
+			}
+		}
+	}
+
+	var packNamesSize int
+	for _, name := range idx.PackNames() {
+		packNamesSize += len(name) + 1
+	}
+
+	packNamesPadding := (chunkAlignment - packNamesSize%chunkAlignment) % chunkAlignment
+
+	chunkSignatures := [][]byte{packNamesSignature, oidFanoutSignature, oidLookupSignature, objectOffsetSignature}
+	chunkSizes := []uint64{
+		uint64(packNamesSize + packNamesPadding),
+		4 * 256,
+		uint64(len(entries)) * 20,
+		uint64(len(entries)) * 8,
+	}
+	if len(largeOffsets) > 0 {
+		chunkSignatures = append(chunkSignatures, largeOffsetSignature)
+		chunkSizes = append(chunkSizes, uint64(len(largeOffsets))*8)
+	}
+
+	if err := e.encodeFileHeader(len(chunkSignatures), len(idx.PackNames())); err != nil {
+		return err
+	}
+	if err := e.encodeChunkHeaders(chunkSignatures, chunkSizes); err != nil {
+		return err
+	}
+	if err := e.encodePackNames(idx.PackNames(), packNamesPadding); err != nil {
+		return err
+	}
+	if err := e.encodeFanout(fanout); err != nil {
+		return err
+	}
+	if err := e.encodeOidLookup(entries); err != nil {
+		return err
+	}
+	if err := e.encodeObjectOffsets(entries, largeOffsets != nil); err != nil {
+		return err
+	}
+	if err := e.encodeLargeOffsets(largeOffsets); err != nil {
+		return err
+	}
+
+	return e.encodeChecksum()
+}
+
+func (e *Encoder) encodeFileHeader(chunkCount int, packCount int) (err error) {
+	if _, err = e.Write(midxFileSignature); err == nil {
+		if _, err = e.Write([]byte{1, 1, byte(chunkCount), 0}); err == nil {
+			err = binary.WriteUint32(e, uint32(packCount))
+		}
+	}
+	return
+}
+
+func (e *Encoder) encodeChunkHeaders(chunkSignatures [][]byte, chunkSizes []uint64) (err error) {
+	// 12 bytes of file header, 12 bytes for each chunk header and 12 byte for terminator
+	offset := uint64(12 + len(chunkSignatures)*12 + 12)
+	for i, signature := range chunkSignatures {
+		if _, err = e.Write(signature); err == nil {
+			err = binary.WriteUint64(e, offset)
+		}
+		if err != nil {
+			return
+		}
+		offset += chunkSizes[i]
+	}
+	if _, err = e.Write(lastSignature); err == nil {
+		err = binary.WriteUint64(e, offset)
+	}
+	return
+}
+
+func (e *Encoder) encodePackNames(packNames []string, padding int) (err error) {
+	for _, name := range packNames {
+		if _, err = e.Write(append([]byte(name), 0)); err != nil {
+			return
+		}
+	}
+	_, err = e.Write(make([]byte, padding))
+	return
+}
+
+func (e *Encoder) encodeFanout(fanout []uint32) (err error) {
+	for i := 0; i <= 0xff; i++ {
+		if err = binary.WriteUint32(e, fanout[i]); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (e *Encoder) encodeOidLookup(entries []*Entry) (err error) {
+	for _, entry := range entries {
+		if _, err = e.Write(entry.Hash[:]); err != nil {
+			return err
+		}
+	}
+	return
+}
+
+func (e *Encoder) encodeObjectOffsets(entries []*Entry, largeOffsets bool) (err error) {
+	var large uint32
+	for _, entry := range entries {
+		offset := uint32(entry.Offset)
+		if largeOffsets && entry.Offset > 0x7fffffff {
+			offset = largeOffsetNeeded | large
+			large++
+		}
+
+		if err = binary.WriteUint32(e, uint32(entry.PackID)); err == nil {
+			err = binary.WriteUint32(e, offset)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (e *Encoder) encodeLargeOffsets(largeOffsets []uint64) (err error) {
+	for _, offset := range largeOffsets {
+		if err = binary.WriteUint64(e, offset); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (e *Encoder) encodeChecksum() error {
+	_, err := e.Write(e.hash.Sum(nil)[:20])
+	return err
+}
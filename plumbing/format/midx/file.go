@@ -0,0 +1,266 @@
+package midx
+
+import (
+	"bytes"
+	encbin "encoding/binary"
+	"errors"
+	"io"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/utils/binary"
+)
+
+var (
+	// ErrUnsupportedVersion is returned by OpenFileIndex when the
+	// multi-pack-index file version is not supported.
+	ErrUnsupportedVersion = errors.New("Unsupported version")
+	// ErrUnsupportedHash is returned by OpenFileIndex when the
+	// multi-pack-index hash function is not supported. Currently only SHA-1
+	// is defined and supported.
+	ErrUnsupportedHash = errors.New("Unsupported hash algorithm")
+	// ErrMalformedMultiPackIndex is returned by OpenFileIndex when the
+	// multi-pack-index file is corrupted.
+	ErrMalformedMultiPackIndex = errors.New("Malformed multi-pack-index file")
+
+	midxFileSignature     = []byte{'M', 'I', 'D', 'X'}
+	packNamesSignature    = []byte{'P', 'N', 'A', 'M'}
+	oidFanoutSignature    = []byte{'O', 'I', 'D', 'F'}
+	oidLookupSignature    = []byte{'O', 'I', 'D', 'L'}
+	objectOffsetSignature = []byte{'O', 'O', 'F', 'F'}
+	largeOffsetSignature  = []byte{'L', 'O', 'F', 'F'}
+	lastSignature         = []byte{0, 0, 0, 0}
+
+	largeOffsetNeeded = uint32(0x80000000)
+)
+
+type fileIndex struct {
+	reader            io.ReaderAt
+	packNames         []string
+	fanout            [256]int
+	packNamesOffset   int64
+	packNamesSize     int64
+	oidFanoutOffset   int64
+	oidLookupOffset   int64
+	objectOffset      int64
+	largeOffsetOffset int64
+}
+
+// OpenFileIndex opens a serialized multi-pack-index file in the format
+// described at
+// https://github.com/git/git/blob/master/Documentation/technical/multi-pack-index.txt
+func OpenFileIndex(reader io.ReaderAt) (Index, error) {
+	fi := &fileIndex{reader: reader}
+
+	packCount, chunkCount, err := fi.verifyFileHeader()
+	if err != nil {
+		return nil, err
+	}
+	if err := fi.readChunkHeaders(chunkCount); err != nil {
+		return nil, err
+	}
+	if err := fi.readFanout(); err != nil {
+		return nil, err
+	}
+	if err := fi.readPackNames(packCount); err != nil {
+		return nil, err
+	}
+
+	return fi, nil
+}
+
+func (fi *fileIndex) verifyFileHeader() (packCount int, chunkCount int, err error) {
+	// Verify file signature
+	var signature = make([]byte, 4)
+	if _, err := fi.reader.ReadAt(signature, 0); err != nil {
+		return 0, 0, err
+	}
+	if !bytes.Equal(signature, midxFileSignature) {
+		return 0, 0, ErrMalformedMultiPackIndex
+	}
+
+	// Read and verify the file header
+	var header = make([]byte, 8)
+	if _, err := fi.reader.ReadAt(header, 4); err != nil {
+		return 0, 0, err
+	}
+	if header[0] != 1 {
+		return 0, 0, ErrUnsupportedVersion
+	}
+	if header[1] != 1 {
+		return 0, 0, ErrUnsupportedHash
+	}
+	if header[3] != 0 {
+		return 0, 0, ErrMalformedMultiPackIndex
+	}
+
+	return int(encbin.BigEndian.Uint32(header[4:])), int(header[2]), nil
+}
+
+func (fi *fileIndex) readChunkHeaders(chunkCount int) error {
+	var chunkID = make([]byte, 4)
+	var previous []byte
+	var previousOffset int64
+	for i := 0; i <= chunkCount; i++ {
+		chunkHeader := io.NewSectionReader(fi.reader, 12+(int64(i)*12), 12)
+		if _, err := io.ReadAtLeast(chunkHeader, chunkID, 4); err != nil {
+			return err
+		}
+		chunkOffset, err := binary.ReadUint64(chunkHeader)
+		if err != nil {
+			return err
+		}
+
+		// the size of the pack names chunk is given by the next chunk
+		if bytes.Equal(previous, packNamesSignature) {
+			fi.packNamesSize = int64(chunkOffset) - previousOffset
+		}
+
+		previous = append(previous[:0], chunkID...)
+		previousOffset = int64(chunkOffset)
+
+		if bytes.Equal(chunkID, packNamesSignature) {
+			fi.packNamesOffset = int64(chunkOffset)
+		} else if bytes.Equal(chunkID, oidFanoutSignature) {
+			fi.oidFanoutOffset = int64(chunkOffset)
+		} else if bytes.Equal(chunkID, oidLookupSignature) {
+			fi.oidLookupOffset = int64(chunkOffset)
+		} else if bytes.Equal(chunkID, objectOffsetSignature) {
+			fi.objectOffset = int64(chunkOffset)
+		} else if bytes.Equal(chunkID, largeOffsetSignature) {
+			fi.largeOffsetOffset = int64(chunkOffset)
+		} else if bytes.Equal(chunkID, lastSignature) {
+			break
+		}
+	}
+
+	if fi.packNamesOffset <= 0 || fi.oidFanoutOffset <= 0 ||
+		fi.oidLookupOffset <= 0 || fi.objectOffset <= 0 || fi.packNamesSize < 0 {
+		return ErrMalformedMultiPackIndex
+	}
+
+	return nil
+}
+
+func (fi *fileIndex) readFanout() error {
+	fanoutReader := io.NewSectionReader(fi.reader, fi.oidFanoutOffset, 256*4)
+	for i := 0; i < 256; i++ {
+		fanoutValue, err := binary.ReadUint32(fanoutReader)
+		if err != nil {
+			return err
+		}
+		if fanoutValue > 0x7fffffff || (i > 0 && int(fanoutValue) < fi.fanout[i-1]) {
+			return ErrMalformedMultiPackIndex
+		}
+		fi.fanout[i] = int(fanoutValue)
+	}
+	return nil
+}
+
+func (fi *fileIndex) readPackNames(packCount int) error {
+	data := make([]byte, fi.packNamesSize)
+	if _, err := fi.reader.ReadAt(data, fi.packNamesOffset); err != nil {
+		return err
+	}
+
+	for i := 0; i < packCount; i++ {
+		end := bytes.IndexByte(data, 0)
+		if end <= 0 {
+			return ErrMalformedMultiPackIndex
+		}
+
+		name := string(data[:end])
+		if i > 0 && name <= fi.packNames[i-1] {
+			return ErrMalformedMultiPackIndex
+		}
+
+		fi.packNames = append(fi.packNames, name)
+		data = data[end+1:]
+	}
+
+	return nil
+}
+
+// PackNames returns the names of the idx files of the packfiles.
+func (fi *fileIndex) PackNames() []string {
+	return fi.packNames
+}
+
+// Count returns the number of objects in the index.
+func (fi *fileIndex) Count() int {
+	return fi.fanout[0xff]
+}
+
+// FindOffset returns the pack ID of the packfile storing the object with the
+// given hash and its offset in it.
+func (fi *fileIndex) FindOffset(h plumbing.Hash) (int, int64, error) {
+	var oid plumbing.Hash
+
+	// Find the hash in the oid lookup table
+	var low int
+	if h[0] != 0 {
+		low = fi.fanout[h[0]-1]
+	}
+	high := fi.fanout[h[0]]
+	for low < high {
+		mid := (low + high) >> 1
+		offset := fi.oidLookupOffset + int64(mid)*20
+		if _, err := fi.reader.ReadAt(oid[:], offset); err != nil {
+			return 0, 0, err
+		}
+		cmp := bytes.Compare(h[:], oid[:])
+		if cmp < 0 {
+			high = mid
+		} else if cmp == 0 {
+			return fi.objectLocation(mid)
+		} else {
+			low = mid + 1
+		}
+	}
+
+	return 0, 0, plumbing.ErrObjectNotFound
+}
+
+// EntryAt returns the ith object of the index, sorted by hash.
+func (fi *fileIndex) EntryAt(i int) (*Entry, error) {
+	if i < 0 || i >= fi.Count() {
+		return nil, plumbing.ErrObjectNotFound
+	}
+
+	e := &Entry{}
+	if _, err := fi.reader.ReadAt(e.Hash[:], fi.oidLookupOffset+int64(i)*20); err != nil {
+		return nil, err
+	}
+
+	var err error
+	e.PackID, e.Offset, err = fi.objectLocation(i)
+	if err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// objectLocation returns the pack ID and the offset of the ith object.
+func (fi *fileIndex) objectLocation(i int) (int, int64, error) {
+	buf := make([]byte, 8)
+	if _, err := fi.reader.ReadAt(buf, fi.objectOffset+int64(i)*8); err != nil {
+		return 0, 0, err
+	}
+
+	packID := int(encbin.BigEndian.Uint32(buf))
+	offset := encbin.BigEndian.Uint32(buf[4:])
+	if packID >= len(fi.packNames) {
+		return 0, 0, ErrMalformedMultiPackIndex
+	}
+
+	if fi.largeOffsetOffset <= 0 || offset&largeOffsetNeeded == 0 {
+		return packID, int64(offset), nil
+	}
+
+	pos := int64(offset ^ largeOffsetNeeded)
+	if _, err := fi.reader.ReadAt(buf, fi.largeOffsetOffset+pos*8); err != nil {
+		return 0, 0, err
+	}
+
+	return packID, int64(encbin.BigEndian.Uint64(buf)), nil
+}
@@ -0,0 +1,90 @@
+package midx
+
+import (
+	"bytes"
+	"sort"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// MemoryIndex provides a way to build the multi-pack-index in memory for
+// later encoding to file.
+type MemoryIndex struct {
+	packNames []string
+	entries   []Entry
+	indexMap  map[plumbing.Hash]int
+	sorted    bool
+}
+
+// NewMemoryIndex creates an in-memory multi-pack-index of the packfiles with
+// the given idx file names, that must be sorted.
+func NewMemoryIndex(packNames []string) *MemoryIndex {
+	return &MemoryIndex{
+		packNames: packNames,
+		indexMap:  make(map[plumbing.Hash]int),
+		sorted:    true,
+	}
+}
+
+// PackNames returns the names of the idx files of the packfiles.
+func (mi *MemoryIndex) PackNames() []string {
+	return mi.packNames
+}
+
+// FindOffset returns the pack ID of the packfile storing the object with the
+// given hash and its offset in it.
+func (mi *MemoryIndex) FindOffset(h plumbing.Hash) (int, int64, error) {
+	i, ok := mi.indexMap[h]
+	if !ok {
+		return 0, 0, plumbing.ErrObjectNotFound
+	}
+
+	e := mi.entries[i]
+	return e.PackID, e.Offset, nil
+}
+
+// Count returns the number of objects in the index.
+func (mi *MemoryIndex) Count() int {
+	return len(mi.entries)
+}
+
+// EntryAt returns the ith object of the index, sorted by hash.
+func (mi *MemoryIndex) EntryAt(i int) (*Entry, error) {
+	if i < 0 || i >= len(mi.entries) {
+		return nil, plumbing.ErrObjectNotFound
+	}
+
+	mi.sort()
+	e := mi.entries[i]
+	return &e, nil
+}
+
+// Add adds an object stored in the packfile with the given pack ID to the
+// index. The location of an object already in the index is replaced.
+func (mi *MemoryIndex) Add(h plumbing.Hash, packID int, offset int64) {
+	if i, ok := mi.indexMap[h]; ok {
+		mi.entries[i] = Entry{Hash: h, PackID: packID, Offset: offset}
+		return
+	}
+
+	mi.indexMap[h] = len(mi.entries)
+	mi.entries = append(mi.entries, Entry{Hash: h, PackID: packID, Offset: offset})
+	mi.sorted = false
+}
+
+// sort sorts the entries by hash, the positions in indexMap are updated.
+func (mi *MemoryIndex) sort() {
+	if mi.sorted {
+		return
+	}
+
+	sort.Slice(mi.entries, func(i, j int) bool {
+		return bytes.Compare(mi.entries[i].Hash[:], mi.entries[j].Hash[:]) < 0
+	})
+
+	for i, e := range mi.entries {
+		mi.indexMap[e.Hash] = i
+	}
+
+	mi.sorted = true
+}
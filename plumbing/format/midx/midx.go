@@ -0,0 +1,32 @@
+package midx
+
+import (
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// Entry is the location of an object of a multi-pack-index.
+type Entry struct {
+	// Hash is the hash of the object.
+	Hash plumbing.Hash
+	// PackID is the position in PackNames of the packfile storing the
+	// object.
+	PackID int
+	// Offset is the offset of the object in the packfile.
+	Offset int64
+}
+
+// Index represents a multi-pack-index, an index of the objects stored in
+// several packfiles.
+type Index interface {
+	// PackNames returns the names of the idx files of the packfiles, in
+	// lexicographic order. The position of a name is the pack ID of the
+	// packfile.
+	PackNames() []string
+	// FindOffset returns the pack ID of the packfile storing the object with
+	// the given hash and its offset in it.
+	FindOffset(h plumbing.Hash) (packID int, offset int64, err error)
+	// Count returns the number of objects in the index.
+	Count() int
+	// EntryAt returns the ith object of the index, sorted by hash.
+	EntryAt(i int) (*Entry, error)
+}
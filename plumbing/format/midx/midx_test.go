@@ -0,0 +1,118 @@
+package midx_test
+
+import (
+	"bytes"
+	"testing"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/midx"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type MidxSuite struct{}
+
+var _ = Suite(&MidxSuite{})
+
+var packNames = []string{
+	"pack-1111111111111111111111111111111111111111.idx",
+	"pack-2222222222222222222222222222222222222222.idx",
+	"pack-333333333333333333333333333333333333333a.idx",
+}
+
+func (s *MidxSuite) encode(c *C, idx midx.Index) midx.Index {
+	var buf bytes.Buffer
+	err := midx.NewEncoder(&buf).Encode(idx)
+	c.Assert(err, IsNil)
+
+	file, err := midx.OpenFileIndex(bytes.NewReader(buf.Bytes()))
+	c.Assert(err, IsNil)
+	return file
+}
+
+func (s *MidxSuite) testIndex(c *C, idx midx.Index, expected []midx.Entry) {
+	c.Assert(idx.PackNames(), DeepEquals, packNames)
+	c.Assert(idx.Count(), Equals, len(expected))
+
+	var prev plumbing.Hash
+	for i := 0; i < idx.Count(); i++ {
+		e, err := idx.EntryAt(i)
+		c.Assert(err, IsNil)
+		if i > 0 {
+			c.Assert(bytes.Compare(prev[:], e.Hash[:]) < 0, Equals, true)
+		}
+
+		prev = e.Hash
+	}
+
+	for _, e := range expected {
+		packID, offset, err := idx.FindOffset(e.Hash)
+		c.Assert(err, IsNil)
+		c.Assert(packID, Equals, e.PackID)
+		c.Assert(offset, Equals, e.Offset)
+	}
+
+	_, _, err := idx.FindOffset(plumbing.NewHash("ffffffffffffffffffffffffffffffffffffffff"))
+	c.Assert(err, Equals, plumbing.ErrObjectNotFound)
+}
+
+func (s *MidxSuite) TestEncodeDecode(c *C) {
+	var expected []midx.Entry
+	idx := midx.NewMemoryIndex(packNames)
+	for i := 0; i < 100; i++ {
+		e := midx.Entry{
+			Hash:   plumbing.ComputeHash(plumbing.BlobObject, []byte{byte(i)}),
+			PackID: i % len(packNames),
+			Offset: int64(12 + i*100),
+		}
+
+		idx.Add(e.Hash, e.PackID, e.Offset)
+		expected = append(expected, e)
+	}
+
+	s.testIndex(c, idx, expected)
+	s.testIndex(c, s.encode(c, idx), expected)
+}
+
+func (s *MidxSuite) TestEncodeDecodeLargeOffsets(c *C) {
+	offsets := []int64{12, 0x7fffffff, 0x80000000, 0xffffffff, 0x100000000, 0x7fffffffffff}
+
+	var expected []midx.Entry
+	idx := midx.NewMemoryIndex(packNames)
+	for i, offset := range offsets {
+		e := midx.Entry{
+			Hash:   plumbing.ComputeHash(plumbing.BlobObject, []byte{byte(i)}),
+			PackID: i % len(packNames),
+			Offset: offset,
+		}
+
+		idx.Add(e.Hash, e.PackID, e.Offset)
+		expected = append(expected, e)
+	}
+
+	s.testIndex(c, s.encode(c, idx), expected)
+}
+
+func (s *MidxSuite) TestAddReplaces(c *C) {
+	h := plumbing.ComputeHash(plumbing.BlobObject, []byte("foo"))
+	idx := midx.NewMemoryIndex(packNames)
+	idx.Add(h, 0, 12)
+	idx.Add(h, 2, 42)
+
+	s.testIndex(c, s.encode(c, idx), []midx.Entry{{Hash: h, PackID: 2, Offset: 42}})
+}
+
+func (s *MidxSuite) TestDecodeMalformed(c *C) {
+	_, err := midx.OpenFileIndex(bytes.NewReader([]byte("MIDZ\x01\x01\x00\x00\x00\x00\x00\x00")))
+	c.Assert(err, Equals, midx.ErrMalformedMultiPackIndex)
+
+	var buf bytes.Buffer
+	err = midx.NewEncoder(&buf).Encode(midx.NewMemoryIndex(packNames))
+	c.Assert(err, IsNil)
+
+	b := buf.Bytes()
+	b[4] = 2
+	_, err = midx.OpenFileIndex(bytes.NewReader(b))
+	c.Assert(err, Equals, midx.ErrUnsupportedVersion)
+}
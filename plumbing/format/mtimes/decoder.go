@@ -0,0 +1,123 @@
+package mtimes
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"hash"
+	"io"
+
+	"gopkg.in/src-d/go-git.v4/utils/binary"
+)
+
+var (
+	// ErrUnsupportedVersion is returned by Decode when the mtimes file
+	// version is not supported.
+	ErrUnsupportedVersion = errors.New("Unsupported version")
+	// ErrUnsupportedHash is returned by Decode when the mtimes file hash
+	// function is not supported. Only SHA-1 is supported.
+	ErrUnsupportedHash = errors.New("Unsupported hash algorithm")
+	// ErrMalformedMTimesFile is returned by Decode when the mtimes file is
+	// corrupted.
+	ErrMalformedMTimesFile = errors.New("Malformed mtimes file")
+	// ErrPackfileMismatch is returned by Decode when the mtimes file is of
+	// another packfile.
+	ErrPackfileMismatch = errors.New("Mtimes file doesn't match the packfile")
+)
+
+const (
+	// VersionSupported is the only mtimes file version supported.
+	VersionSupported = 1
+
+	hashSHA1 = 1
+)
+
+var mtimesHeader = []byte{'M', 'T', 'M', 'E'}
+
+// Decoder reads and decodes mtimes files from an input stream.
+type Decoder struct {
+	r    *bufio.Reader
+	hash hash.Hash
+	tee  io.Reader
+}
+
+// NewDecoder builds a new mtimes stream decoder, that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	br := bufio.NewReader(r)
+	h := sha1.New()
+	return &Decoder{r: br, hash: h, tee: io.TeeReader(br, h)}
+}
+
+// Decode reads from the stream and decodes the modification times into m,
+// which must have the checksum of the packfile and as many times as objects
+// has the packfile, such as the one returned by New.
+func (d *Decoder) Decode(m *MTimes) error {
+	if err := d.readHeader(); err != nil {
+		return err
+	}
+
+	for i := range m.Times {
+		t, err := binary.ReadUint32(d.tee)
+		if err != nil {
+			return err
+		}
+
+		m.Times[i] = t
+	}
+
+	pack, err := binary.ReadHash(d.tee)
+	if err != nil {
+		return err
+	}
+
+	if pack != m.Packfile {
+		return ErrPackfileMismatch
+	}
+
+	return d.readChecksum()
+}
+
+func (d *Decoder) readHeader() error {
+	h := make([]byte, 4)
+	if _, err := io.ReadFull(d.tee, h); err != nil {
+		return err
+	}
+
+	if !bytes.Equal(h, mtimesHeader) {
+		return ErrMalformedMTimesFile
+	}
+
+	v, err := binary.ReadUint32(d.tee)
+	if err != nil {
+		return err
+	}
+
+	if v != VersionSupported {
+		return ErrUnsupportedVersion
+	}
+
+	id, err := binary.ReadUint32(d.tee)
+	if err != nil {
+		return err
+	}
+
+	if id != hashSHA1 {
+		return ErrUnsupportedHash
+	}
+
+	return nil
+}
+
+func (d *Decoder) readChecksum() error {
+	checksum, err := binary.ReadHash(d.r)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(d.hash.Sum(nil), checksum[:]) {
+		return ErrMalformedMTimesFile
+	}
+
+	return nil
+}
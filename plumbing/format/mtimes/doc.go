@@ -0,0 +1,35 @@
+// Package mtimes implements encoding and decoding of the modification times
+// of the objects of cruft packfiles, the pack-*.mtimes files.
+//
+// A cruft packfile holds unreachable objects, not old enough to be pruned.
+// Since they are all in the same packfile, the modification time of each
+// object, used to expire them by age, is recorded in the mtimes file.
+//
+// The mtimes file has the following format, all the numbers are in network
+// byte order:
+//
+// HEADER:
+//
+//   4-byte signature:
+//       The signature is: {'M', 'T', 'M', 'E'}
+//
+//   4-byte version number:
+//       Git only writes or recognizes version 1.
+//
+//   4-byte hash function identifier:
+//       1 for SHA-1, the only one supported.
+//
+// MTIMES:
+//
+//   A 4-byte modification time of each object, in seconds since the epoch,
+//   in the order of the idx file, sorted by hash.
+//
+// TRAILER:
+//
+//   20-byte checksum of the packfile.
+//
+//   20-byte checksum of all of the above.
+//
+// Source:
+// https://github.com/git/git/blob/master/Documentation/technical/pack-format.txt
+package mtimes
@@ -0,0 +1,50 @@
+package mtimes
+
+import (
+	"crypto/sha1"
+	"hash"
+	"io"
+
+	"gopkg.in/src-d/go-git.v4/utils/binary"
+)
+
+// Encoder writes mtimes files to an output stream.
+type Encoder struct {
+	io.Writer
+	hash hash.Hash
+}
+
+// NewEncoder returns a new stream encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	h := sha1.New()
+	mw := io.MultiWriter(w, h)
+	return &Encoder{mw, h}
+}
+
+// Encode writes the modification times of m into the mtimes file.
+func (e *Encoder) Encode(m *MTimes) error {
+	if _, err := e.Write(mtimesHeader); err != nil {
+		return err
+	}
+
+	if err := binary.WriteUint32(e, VersionSupported); err != nil {
+		return err
+	}
+
+	if err := binary.WriteUint32(e, hashSHA1); err != nil {
+		return err
+	}
+
+	for _, t := range m.Times {
+		if err := binary.WriteUint32(e, t); err != nil {
+			return err
+		}
+	}
+
+	if _, err := e.Write(m.Packfile[:]); err != nil {
+		return err
+	}
+
+	_, err := e.Write(e.hash.Sum(nil))
+	return err
+}
@@ -0,0 +1,42 @@
+package mtimes
+
+import (
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// MTimes holds the modification times of the objects of a cruft packfile.
+type MTimes struct {
+	// Packfile is the checksum of the packfile.
+	Packfile plumbing.Hash
+	// Times holds the modification time of each object, in seconds since
+	// the epoch, in the order of the idx file, sorted by hash.
+	Times []uint32
+}
+
+// New returns the MTimes of the given packfile, with count objects, all of
+// them with the zero modification time.
+func New(pack plumbing.Hash, count int) *MTimes {
+	return &MTimes{Packfile: pack, Times: make([]uint32, count)}
+}
+
+// Time returns the modification time of the object at position i of the idx
+// file.
+func (m *MTimes) Time(i int) time.Time {
+	return time.Unix(int64(m.Times[i]), 0)
+}
+
+// SetTime sets the modification time of the object at position i of the idx
+// file. The times are stored with a precision of seconds, and the ones out of
+// range are clamped.
+func (m *MTimes) SetTime(i int, t time.Time) {
+	switch sec := t.Unix(); {
+	case sec < 0:
+		m.Times[i] = 0
+	case sec > int64(^uint32(0)):
+		m.Times[i] = ^uint32(0)
+	default:
+		m.Times[i] = uint32(sec)
+	}
+}
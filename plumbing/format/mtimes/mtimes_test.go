@@ -0,0 +1,79 @@
+package mtimes_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/mtimes"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type MTimesSuite struct{}
+
+var _ = Suite(&MTimesSuite{})
+
+var pack = plumbing.NewHash("a3fed42da1e8189a077c0e6846c040dcf73fc9dd")
+
+func (s *MTimesSuite) encode(c *C, m *mtimes.MTimes) []byte {
+	buf := bytes.NewBuffer(nil)
+	c.Assert(mtimes.NewEncoder(buf).Encode(m), IsNil)
+	return buf.Bytes()
+}
+
+func (s *MTimesSuite) TestEncodeDecode(c *C) {
+	m := mtimes.New(pack, 3)
+	m.SetTime(0, time.Unix(1600000000, 0))
+	m.SetTime(1, time.Unix(1500000000, 500))
+	m.SetTime(2, time.Unix(-1, 0))
+
+	data := s.encode(c, m)
+	c.Assert(data, HasLen, 12+3*4+2*20)
+	c.Assert(data[:12], DeepEquals, []byte{
+		'M', 'T', 'M', 'E', 0, 0, 0, 1, 0, 0, 0, 1,
+	})
+
+	decoded := mtimes.New(pack, 3)
+	c.Assert(mtimes.NewDecoder(bytes.NewReader(data)).Decode(decoded), IsNil)
+	c.Assert(decoded, DeepEquals, m)
+	c.Assert(decoded.Time(0), Equals, time.Unix(1600000000, 0))
+	c.Assert(decoded.Time(1), Equals, time.Unix(1500000000, 0))
+	c.Assert(decoded.Time(2), Equals, time.Unix(0, 0))
+}
+
+func (s *MTimesSuite) TestDecodePackfileMismatch(c *C) {
+	data := s.encode(c, mtimes.New(pack, 1))
+
+	m := mtimes.New(plumbing.ZeroHash, 1)
+	err := mtimes.NewDecoder(bytes.NewReader(data)).Decode(m)
+	c.Assert(err, Equals, mtimes.ErrPackfileMismatch)
+}
+
+func (s *MTimesSuite) TestDecodeMalformed(c *C) {
+	data := s.encode(c, mtimes.New(pack, 1))
+	data[13]++
+
+	err := mtimes.NewDecoder(bytes.NewReader(data)).Decode(mtimes.New(pack, 1))
+	c.Assert(err, Equals, mtimes.ErrMalformedMTimesFile)
+
+	data = s.encode(c, mtimes.New(pack, 1))
+	data[0] = 'X'
+	err = mtimes.NewDecoder(bytes.NewReader(data)).Decode(mtimes.New(pack, 1))
+	c.Assert(err, Equals, mtimes.ErrMalformedMTimesFile)
+}
+
+func (s *MTimesSuite) TestDecodeUnsupported(c *C) {
+	data := s.encode(c, mtimes.New(pack, 0))
+	data[7] = 2
+	err := mtimes.NewDecoder(bytes.NewReader(data)).Decode(mtimes.New(pack, 0))
+	c.Assert(err, Equals, mtimes.ErrUnsupportedVersion)
+
+	data = s.encode(c, mtimes.New(pack, 0))
+	data[11] = 2
+	err = mtimes.NewDecoder(bytes.NewReader(data)).Decode(mtimes.New(pack, 0))
+	c.Assert(err, Equals, mtimes.ErrUnsupportedHash)
+}
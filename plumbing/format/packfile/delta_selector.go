@@ -22,10 +22,13 @@ var applyDelta = map[plumbing.ObjectType]bool{
 
 type deltaSelector struct {
 	storer storer.EncodedObjectStorer
+	// maxDepth is the maximum length of the delta chains, including the
+	// reused ones.
+	maxDepth int64
 }
 
 func newDeltaSelector(s storer.EncodedObjectStorer) *deltaSelector {
-	return &deltaSelector{s}
+	return &deltaSelector{s, maxDepth}
 }
 
 // ObjectsToPack creates a list of ObjectToPack from the hashes
@@ -81,6 +84,10 @@ func (dw *deltaSelector) ObjectsToPack(
 		return nil, err
 	}
 
+	if err := dw.breakLongChains(otp); err != nil {
+		return nil, err
+	}
+
 	return otp, nil
 }
 
@@ -139,8 +146,9 @@ func (dw *deltaSelector) fixAndBreakChains(objectsToPack []*ObjectToPack) error
 		m[otp.Hash()] = otp
 	}
 
+	visiting := make(map[*ObjectToPack]bool)
 	for _, otp := range objectsToPack {
-		if err := dw.fixAndBreakChainsOne(m, otp); err != nil {
+		if err := dw.fixAndBreakChainsOne(m, visiting, otp); err != nil {
 			return err
 		}
 	}
@@ -148,7 +156,11 @@ func (dw *deltaSelector) fixAndBreakChains(objectsToPack []*ObjectToPack) error
 	return nil
 }
 
-func (dw *deltaSelector) fixAndBreakChainsOne(objectsToPack map[plumbing.Hash]*ObjectToPack, otp *ObjectToPack) error {
+func (dw *deltaSelector) fixAndBreakChainsOne(
+	objectsToPack map[plumbing.Hash]*ObjectToPack,
+	visiting map[*ObjectToPack]bool,
+	otp *ObjectToPack,
+) error {
 	if !otp.Object.Type().IsDelta() {
 		return nil
 	}
@@ -174,14 +186,73 @@ func (dw *deltaSelector) fixAndBreakChainsOne(objectsToPack map[plumbing.Hash]*O
 		return dw.undeltify(otp)
 	}
 
-	if err := dw.fixAndBreakChainsOne(objectsToPack, base); err != nil {
+	// The same object may be stored in several packfiles as a delta of
+	// different bases, so the reused deltas can form a cycle, which is
+	// broken here.
+	if visiting[base] {
+		return dw.undeltify(otp)
+	}
+
+	visiting[otp] = true
+	err := dw.fixAndBreakChainsOne(objectsToPack, visiting, base)
+	delete(visiting, otp)
+	if err != nil {
 		return err
 	}
 
+	if int64(base.Depth) >= dw.maxDepth {
+		// The delta chain would be too long.
+		return dw.undeltify(otp)
+	}
+
 	otp.SetDelta(base, otp.Object)
 	return nil
 }
 
+// breakLongChains undeltifies the objects whose delta chain exceeds maxDepth.
+// The walk may deltify an object which is already the base of a reused delta,
+// making the chains built on top of it longer than their recorded depth.
+func (dw *deltaSelector) breakLongChains(objectsToPack []*ObjectToPack) error {
+	depths := make(map[*ObjectToPack]int, len(objectsToPack))
+	for _, otp := range objectsToPack {
+		if _, err := dw.breakLongChainsOne(depths, otp); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (dw *deltaSelector) breakLongChainsOne(depths map[*ObjectToPack]int, otp *ObjectToPack) (int, error) {
+	if d, ok := depths[otp]; ok {
+		return d, nil
+	}
+
+	if !otp.IsDelta() {
+		depths[otp] = 0
+		return 0, nil
+	}
+
+	d, err := dw.breakLongChainsOne(depths, otp.Base)
+	if err != nil {
+		return 0, err
+	}
+
+	d++
+	if int64(d) > dw.maxDepth {
+		if err := dw.restoreOriginal(otp); err != nil {
+			return 0, err
+		}
+
+		otp.BackToOriginal()
+		d = 0
+	}
+
+	otp.Depth = d
+	depths[otp] = d
+	return d, nil
+}
+
 func (dw *deltaSelector) restoreOriginal(otp *ObjectToPack) error {
 	if otp.Original != nil {
 		return nil
@@ -321,6 +392,11 @@ func (dw *deltaSelector) tryToDeltify(indexMap map[plumbing.Hash]*deltaIndex, ba
 
 func (dw *deltaSelector) deltaSizeLimit(targetSize int64, baseDepth int,
 	targetDepth int, targetDelta bool) int64 {
+	maxDepth := dw.maxDepth
+	if maxDepth <= 0 {
+		return 0
+	}
+
 	if !targetDelta {
 		// Any delta should be no more than 50% of the original size
 		// (for text files deflate of whole form should shrink 50%).
@@ -234,3 +234,74 @@ func (s *DeltaSelectorSuite) TestMaxDepth(c *C) {
 	dsl := s.ds.deltaSizeLimit(0, 0, int(maxDepth), true)
 	c.Assert(dsl, Equals, int64(0))
 }
+
+func (s *DeltaSelectorSuite) TestMaxDepthLimit(c *C) {
+	s.ds.maxDepth = 1
+	hashes := []plumbing.Hash{
+		s.hashes["o1"],
+		s.hashes["o2"],
+		s.hashes["o3"],
+	}
+	otp, err := s.ds.ObjectsToPack(hashes, 10)
+	c.Assert(err, IsNil)
+	c.Assert(len(otp), Equals, 3)
+	c.Assert(otp[1].IsDelta(), Equals, true)
+	for _, o := range otp {
+		c.Assert(o.Depth <= 1, Equals, true)
+		if o.IsDelta() {
+			c.Assert(o.Base.IsDelta(), Equals, false)
+		}
+	}
+
+	s.ds.maxDepth = 0
+	c.Assert(s.ds.deltaSizeLimit(100, 0, 0, false), Equals, int64(0))
+	otp, err = s.ds.ObjectsToPack(hashes, 10)
+	c.Assert(err, IsNil)
+	for _, o := range otp {
+		c.Assert(o.IsDelta(), Equals, false)
+	}
+}
+
+type testDeltaObject struct {
+	plumbing.EncodedObject
+	hash plumbing.Hash
+	base plumbing.Hash
+	size int64
+}
+
+func (o *testDeltaObject) Hash() plumbing.Hash     { return o.hash }
+func (o *testDeltaObject) BaseHash() plumbing.Hash { return o.base }
+func (o *testDeltaObject) ActualHash() plumbing.Hash {
+	return o.hash
+}
+func (o *testDeltaObject) ActualSize() int64 { return o.size }
+
+func (s *DeltaSelectorSuite) TestFixAndBreakChainsCycle(c *C) {
+	ids := []string{"o1", "o2", "o3"}
+	var otp []*ObjectToPack
+	for i, id := range ids {
+		base := s.hashes[ids[(i+1)%len(ids)]]
+		o := &testDeltaObject{
+			EncodedObject: newObject(plumbing.OFSDeltaObject, []byte("delta")),
+			hash:          s.hashes[id],
+			base:          base,
+			size:          s.store.Objects[s.hashes[id]].Size(),
+		}
+
+		otp = append(otp, newObjectToPack(o))
+		otp[i].CleanOriginal()
+	}
+
+	err := s.ds.fixAndBreakChains(otp)
+	c.Assert(err, IsNil)
+
+	var full int
+	for _, o := range otp {
+		if !o.IsDelta() {
+			full++
+			c.Assert(o.Object, Equals, s.store.Objects[o.Hash()])
+		}
+	}
+
+	c.Assert(full, Equals, 1)
+}
@@ -22,6 +22,17 @@ type Encoder struct {
 	useRefDeltas bool
 }
 
+// CompressedObject is an EncodedObject stored in a packfile, its compressed
+// content is copied as is when it's encoded into a new packfile, as long as
+// it's written with the same representation, as a delta of the same base or
+// as a whole object.
+type CompressedObject interface {
+	plumbing.EncodedObject
+	// CompressedContent returns the zlib compressed content of the object, as
+	// stored in its packfile: the delta for a deltified object.
+	CompressedContent() ([]byte, error)
+}
+
 // NewEncoder creates a new packfile encoder using a specific Writer and
 // EncodedObjectStorer. By default deltas used to generate the packfile will be
 // OFSDeltaObject. To use Reference deltas, set useRefDeltas to true.
@@ -41,6 +52,15 @@ func NewEncoder(w io.Writer, s storer.EncodedObjectStorer, useRefDeltas bool) *E
 	}
 }
 
+// NewEncoderWithMaxDepth creates a new packfile encoder as NewEncoder does,
+// limiting the length of the delta chains to maxDepth, 50 by default. The
+// reused deltas exceeding it are undeltified.
+func NewEncoderWithMaxDepth(w io.Writer, s storer.EncodedObjectStorer, useRefDeltas bool, maxDepth uint) *Encoder {
+	e := NewEncoder(w, s, useRefDeltas)
+	e.selector.maxDepth = int64(maxDepth)
+	return e
+}
+
 // Encode creates a packfile containing all the objects referenced in
 // hashes and writes it to the writer in the Encoder.  `packWindow`
 // specifies the size of the sliding window used to compare objects
@@ -118,6 +138,16 @@ func (e *Encoder) entry(o *ObjectToPack) error {
 		}
 	}
 
+	if co, ok := o.Object.(CompressedObject); ok && o.Object.Type().IsDelta() == o.IsDelta() {
+		data, err := co.CompressedContent()
+		if err != nil {
+			return err
+		}
+
+		_, err = e.w.Write(data)
+		return err
+	}
+
 	e.zw.Reset(e.w)
 	or, err := o.Object.Reader()
 	if err != nil {
@@ -133,3 +133,48 @@ func (s *EncoderAdvancedSuite) testEncodeDecode(
 		}
 	}
 }
+
+func (s *EncoderAdvancedSuite) TestEncodeMaxDepth(c *C) {
+	if testing.Short() {
+		c.Skip("skipping test in short mode.")
+	}
+
+	f := fixtures.ByURL("https://github.com/src-d/go-git.git").
+		ByTag("packfile").ByTag(".git").One()
+	storage := filesystem.NewStorage(f.DotGit(), cache.NewObjectLRUDefault())
+
+	objIter, err := storage.IterEncodedObjects(plumbing.AnyObject)
+	c.Assert(err, IsNil)
+
+	var hashes []plumbing.Hash
+	err = objIter.ForEach(func(o plumbing.EncodedObject) error {
+		hashes = append(hashes, o.Hash())
+		return nil
+	})
+	c.Assert(err, IsNil)
+
+	buf := bytes.NewBuffer(nil)
+	enc := NewEncoderWithMaxDepth(buf, storage, false, 1)
+	_, err = enc.Encode(hashes, 10)
+	c.Assert(err, IsNil)
+
+	scanner := NewScanner(bytes.NewReader(buf.Bytes()))
+	_, objects, err := scanner.Header()
+	c.Assert(err, IsNil)
+	c.Assert(int(objects), Equals, len(hashes))
+
+	deltas := 0
+	isDelta := make(map[int64]bool, objects)
+	for i := uint32(0); i < objects; i++ {
+		h, err := scanner.NextObjectHeader()
+		c.Assert(err, IsNil)
+
+		isDelta[h.Offset] = h.Type.IsDelta()
+		if h.Type == plumbing.OFSDeltaObject {
+			deltas++
+			c.Assert(isDelta[h.OffsetReference], Equals, false)
+		}
+	}
+
+	c.Assert(deltas > 0, Equals, true)
+}
@@ -120,6 +120,38 @@ func (s *EncoderSuite) TestDecodeEncodeWithCycleOFS(c *C) {
 	s.deltaOverDeltaCyclicTest(c)
 }
 
+type compressedObject struct {
+	plumbing.EncodedObject
+	data []byte
+}
+
+func (o *compressedObject) CompressedContent() ([]byte, error) {
+	return o.data, nil
+}
+
+func (s *EncoderSuite) TestEncodeReusesCompressedContent(c *C) {
+	obj := newObject(plumbing.BlobObject, []byte("foo"))
+	_, err := s.enc.encode([]*ObjectToPack{newObjectToPack(obj)})
+	c.Assert(err, IsNil)
+	expected := append([]byte(nil), s.buf.Bytes()...)
+
+	p, cleanup := packfileFromReader(c, s.buf)
+	defer cleanup()
+
+	offset, err := p.FindOffset(obj.Hash())
+	c.Assert(err, IsNil)
+	data, err := p.CompressedContentAt(offset)
+	c.Assert(err, IsNil)
+
+	c.Assert(len(data) > 0, Equals, true)
+
+	s.buf.Reset()
+	enc := NewEncoder(s.buf, s.store, false)
+	_, err = enc.encode([]*ObjectToPack{newObjectToPack(&compressedObject{obj, data})})
+	c.Assert(err, IsNil)
+	c.Assert(s.buf.Bytes(), DeepEquals, expected)
+}
+
 func (s *EncoderSuite) simpleDeltaTest(c *C) {
 	srcObject := newObject(plumbing.BlobObject, []byte("0"))
 	targetObject := newObject(plumbing.BlobObject, []byte("01"))
@@ -3,6 +3,7 @@ package packfile
 import (
 	"bytes"
 	"io"
+	stdioutil "io/ioutil"
 	"os"
 
 	billy "gopkg.in/src-d/go-billy.v4"
@@ -265,6 +266,36 @@ func (p *Packfile) getNextObject(h *ObjectHeader, hash plumbing.Hash) (plumbing.
 	), nil
 }
 
+// CompressedContentAt returns the zlib compressed content of the object at
+// the given offset, as stored in the packfile: the delta for a deltified
+// object. The content is inflated once to find its end and check it.
+func (p *Packfile) CompressedContentAt(offset int64) ([]byte, error) {
+	if _, err := p.s.SeekObjectHeader(offset); err != nil {
+		return nil, err
+	}
+
+	start, err := p.s.r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, _, err := p.s.NextObject(stdioutil.Discard); err != nil {
+		return nil, err
+	}
+
+	end, err := p.s.SeekFromStart(start)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, end-start)
+	if _, err := io.ReadFull(p.s.r, data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
 func (p *Packfile) getObjectContent(offset int64) (io.ReadCloser, error) {
 	h, err := p.objectHeaderAtOffset(offset)
 	if err != nil {
@@ -0,0 +1,104 @@
+package packfile
+
+import (
+	"bytes"
+	"io"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+// RecoverObjects stores in s the objects completely received of a truncated
+// packfile, such as the one left by an interrupted transfer. The reading stops
+// at the first object that can't be read. The deltas are resolved against the
+// objects of the packfile or the ones already in the storage, the deltas
+// whose base isn't available are skipped. It returns the hashes of the stored
+// objects, in packfile order.
+func RecoverObjects(s storer.EncodedObjectStorer, packfile io.Reader) ([]plumbing.Hash, error) {
+	scanner := NewScanner(packfile)
+	_, count, err := scanner.Header()
+	if err != nil {
+		// nothing was received
+		return nil, nil
+	}
+
+	var stored []plumbing.Hash
+	offsets := make(map[int64]plumbing.Hash)
+	buf := bytes.NewBuffer(nil)
+	for i := uint32(0); i < count; i++ {
+		h, err := scanner.NextObjectHeader()
+		if err != nil {
+			break
+		}
+
+		buf.Reset()
+		if _, _, err := scanner.NextObject(buf); err != nil {
+			break
+		}
+
+		obj, err := recoverObject(s, h, buf.Bytes(), offsets)
+		if err == plumbing.ErrObjectNotFound {
+			continue
+		}
+
+		if err != nil {
+			return stored, err
+		}
+
+		hash, err := s.SetEncodedObject(obj)
+		if err != nil {
+			return stored, err
+		}
+
+		offsets[h.Offset] = hash
+		stored = append(stored, hash)
+	}
+
+	return stored, nil
+}
+
+// recoverObject returns the object with the given header and content,
+// resolving it if it's a delta. plumbing.ErrObjectNotFound is returned if the
+// base of the delta isn't available.
+func recoverObject(
+	s storer.EncodedObjectStorer,
+	h *ObjectHeader,
+	content []byte,
+	offsets map[int64]plumbing.Hash,
+) (plumbing.EncodedObject, error) {
+	obj := s.NewEncodedObject()
+	if !h.Type.IsDelta() {
+		obj.SetType(h.Type)
+		obj.SetSize(int64(len(content)))
+		w, err := obj.Writer()
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := w.Write(content); err != nil {
+			return nil, err
+		}
+
+		return obj, w.Close()
+	}
+
+	ref := h.Reference
+	if h.Type == plumbing.OFSDeltaObject {
+		var ok bool
+		if ref, ok = offsets[h.OffsetReference]; !ok {
+			return nil, plumbing.ErrObjectNotFound
+		}
+	}
+
+	base, err := s.EncodedObject(plumbing.AnyObject, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	obj.SetType(base.Type())
+	if err := ApplyDelta(obj, base, content); err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
@@ -0,0 +1,55 @@
+package packfile_test
+
+import (
+	"bytes"
+	"io/ioutil"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git-fixtures.v3"
+)
+
+type RecoverSuite struct {
+	fixtures.Suite
+}
+
+var _ = Suite(&RecoverSuite{})
+
+func (s *RecoverSuite) packfile(c *C) []byte {
+	pack, err := ioutil.ReadAll(fixtures.Basic().One().Packfile())
+	c.Assert(err, IsNil)
+	return pack
+}
+
+func (s *RecoverSuite) TestRecoverObjects(c *C) {
+	sto := memory.NewStorage()
+	hashes, err := packfile.RecoverObjects(sto, bytes.NewReader(s.packfile(c)))
+	c.Assert(err, IsNil)
+	c.Assert(hashes, HasLen, 31)
+
+	for _, h := range hashes {
+		obj, err := sto.EncodedObject(plumbing.AnyObject, h)
+		c.Assert(err, IsNil)
+		c.Assert(obj.Hash(), Equals, h)
+	}
+}
+
+func (s *RecoverSuite) TestRecoverObjectsTruncated(c *C) {
+	sto := memory.NewStorage()
+	// the packfile is cut in the middle of the 13th object
+	hashes, err := packfile.RecoverObjects(sto, bytes.NewReader(s.packfile(c)[:2400]))
+	c.Assert(err, IsNil)
+	c.Assert(hashes, HasLen, 12)
+	c.Assert(hashes[0].String(), Equals, "e8d3ffab552895c19b9fcf7aa264d277cde33881")
+	c.Assert(hashes[11].String(), Equals, "c192bd6a24ea1ab01d78686e417c8bdc7c3d197f")
+	c.Assert(sto.Objects, HasLen, 12)
+}
+
+func (s *RecoverSuite) TestRecoverObjectsEmpty(c *C) {
+	hashes, err := packfile.RecoverObjects(memory.NewStorage(), bytes.NewReader([]byte("PACK")))
+	c.Assert(err, IsNil)
+	c.Assert(hashes, HasLen, 0)
+}
@@ -0,0 +1,97 @@
+package reflog
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// ErrMalformedEntry is returned when a line of the reflog can't be decoded.
+var ErrMalformedEntry = errors.New("malformed reflog entry")
+
+// Decoder reads and decodes reflog entries from an input stream.
+type Decoder struct {
+	r *bufio.Reader
+}
+
+// NewDecoder returns a new decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{bufio.NewReader(r)}
+}
+
+// Decode reads all the entries of the reflog, oldest first.
+func (d *Decoder) Decode() ([]*Entry, error) {
+	var entries []*Entry
+	for {
+		line, err := d.r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		line = bytes.TrimSuffix(line, []byte{'\n'})
+		if len(line) != 0 {
+			e, derr := decodeEntry(line)
+			if derr != nil {
+				return nil, derr
+			}
+
+			entries = append(entries, e)
+		}
+
+		if err == io.EOF {
+			return entries, nil
+		}
+	}
+}
+
+func decodeEntry(line []byte) (*Entry, error) {
+	const hashesLen = 2*40 + 2
+	if len(line) < hashesLen || line[40] != ' ' || line[81] != ' ' {
+		return nil, ErrMalformedEntry
+	}
+
+	e := &Entry{
+		Old: plumbing.NewHash(string(line[:40])),
+		New: plumbing.NewHash(string(line[41:81])),
+	}
+
+	ident := line[hashesLen:]
+	if tab := bytes.IndexByte(ident, '\t'); tab != -1 {
+		e.Message = string(ident[tab+1:])
+		ident = ident[:tab]
+	}
+
+	open := bytes.LastIndexByte(ident, '<')
+	close := bytes.LastIndexByte(ident, '>')
+	if open == -1 || close < open {
+		return nil, ErrMalformedEntry
+	}
+
+	e.Name = string(bytes.TrimSpace(ident[:open]))
+	e.Email = string(ident[open+1 : close])
+
+	when := bytes.Fields(ident[close+1:])
+	if len(when) != 2 {
+		return nil, ErrMalformedEntry
+	}
+
+	ts, err := strconv.ParseInt(string(when[0]), 10, 64)
+	if err != nil {
+		return nil, ErrMalformedEntry
+	}
+
+	// A dummy year is needed, parsing only the timezone makes Location
+	// return time.Local in some cases.
+	tz, err := time.Parse("2006 -0700", "1970 "+string(when[1]))
+	if err != nil {
+		return nil, ErrMalformedEntry
+	}
+
+	e.When = time.Unix(ts, 0).In(tz.Location())
+	return e, nil
+}
@@ -0,0 +1,12 @@
+// Package reflog implements encoding and decoding of reflog files.
+//
+// The reflog of a reference records the history of its values, each update
+// appending a line to the file logs/<reference name>, such as logs/HEAD or
+// logs/refs/heads/master, with the following format:
+//
+//   <old hash> SP <new hash> SP <name> SP '<' <email> '>' SP <timestamp> SP <timezone> [TAB <message>] LF
+//
+// The old hash is all zeros when the reference is created, and the new hash is
+// all zeros when it is deleted. The timestamp is in seconds since the epoch and
+// the timezone is an offset such as +0100.
+package reflog
@@ -0,0 +1,51 @@
+package reflog
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// Encoder writes reflog entries to an output stream.
+type Encoder struct {
+	w *bufio.Writer
+}
+
+// NewEncoder returns a new encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{bufio.NewWriter(w)}
+}
+
+// Encode writes the given entries, oldest first.
+func (e *Encoder) Encode(entries []*Entry) error {
+	for _, entry := range entries {
+		if err := e.encodeEntry(entry); err != nil {
+			return err
+		}
+	}
+
+	return e.w.Flush()
+}
+
+func (e *Encoder) encodeEntry(entry *Entry) error {
+	ts := entry.When.Unix()
+	if ts < 0 {
+		ts = 0
+	}
+
+	_, err := fmt.Fprintf(e.w, "%s %s %s <%s> %d %s",
+		entry.Old, entry.New, entry.Name, entry.Email,
+		ts, entry.When.Format("-0700"),
+	)
+	if err != nil {
+		return err
+	}
+
+	if entry.Message != "" {
+		if _, err := fmt.Fprintf(e.w, "\t%s", entry.Message); err != nil {
+			return err
+		}
+	}
+
+	return e.w.WriteByte('\n')
+}
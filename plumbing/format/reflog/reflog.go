@@ -0,0 +1,23 @@
+package reflog
+
+import (
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// Entry is an update of a reference, a line of its reflog.
+type Entry struct {
+	// Old is the value of the reference before the update.
+	Old plumbing.Hash
+	// New is the value of the reference after the update.
+	New plumbing.Hash
+	// Name is the name of the committer of the update.
+	Name string
+	// Email is the email of the committer of the update.
+	Email string
+	// When is the time of the update.
+	When time.Time
+	// Message describes the update, such as "commit: add foo".
+	Message string
+}
@@ -0,0 +1,56 @@
+package reflog
+
+import (
+	"bytes"
+	"testing"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type ReflogSuite struct{}
+
+var _ = Suite(&ReflogSuite{})
+
+const fixture = "0000000000000000000000000000000000000000 6ecf0ef2c2dffb796033e5a02219af86ec6584e5 Máximo Cuadros <mcuadros@gmail.com> 1427802494 +0200\tclone: from https://github.com/git-fixtures/basic.git\n" +
+	"6ecf0ef2c2dffb796033e5a02219af86ec6584e5 918c48b83bd081e863dbe1b80f8998f058cd8294 John Doe <john@doe.com> 1427802434 -0700\n"
+
+func (s *ReflogSuite) TestDecode(c *C) {
+	entries, err := NewDecoder(bytes.NewBufferString(fixture)).Decode()
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 2)
+
+	c.Assert(entries[0].Old, Equals, plumbing.ZeroHash)
+	c.Assert(entries[0].New, Equals, plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	c.Assert(entries[0].Name, Equals, "Máximo Cuadros")
+	c.Assert(entries[0].Email, Equals, "mcuadros@gmail.com")
+	c.Assert(entries[0].When.Unix(), Equals, int64(1427802494))
+	c.Assert(entries[0].When.Format("-0700"), Equals, "+0200")
+	c.Assert(entries[0].Message, Equals, "clone: from https://github.com/git-fixtures/basic.git")
+
+	c.Assert(entries[1].Old, Equals, entries[0].New)
+	c.Assert(entries[1].Name, Equals, "John Doe")
+	c.Assert(entries[1].When.Format("-0700"), Equals, "-0700")
+	c.Assert(entries[1].Message, Equals, "")
+}
+
+func (s *ReflogSuite) TestDecodeMalformed(c *C) {
+	_, err := NewDecoder(bytes.NewBufferString("foo bar\n")).Decode()
+	c.Assert(err, Equals, ErrMalformedEntry)
+
+	_, err = NewDecoder(bytes.NewBufferString(fixture[:120] + "\n")).Decode()
+	c.Assert(err, Equals, ErrMalformedEntry)
+}
+
+func (s *ReflogSuite) TestEncode(c *C) {
+	entries, err := NewDecoder(bytes.NewBufferString(fixture)).Decode()
+	c.Assert(err, IsNil)
+
+	buf := bytes.NewBuffer(nil)
+	err = NewEncoder(buf).Encode(entries)
+	c.Assert(err, IsNil)
+	c.Assert(buf.String(), Equals, fixture)
+}
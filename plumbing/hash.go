@@ -32,6 +32,22 @@ func NewHash(s string) Hash {
 	return h
 }
 
+// IsHash returns true if the given string is a valid hexadecimal hash
+// representation, in lowercase as git writes them.
+func IsHash(s string) bool {
+	if len(s) != 40 {
+		return false
+	}
+
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+
+	return true
+}
+
 func (h Hash) IsZero() bool {
 	var empty Hash
 	return h == empty
@@ -0,0 +1,97 @@
+package object
+
+import (
+	"github.com/emirpasic/gods/trees/binaryheap"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+const (
+	aheadFlag = 1 << iota
+	behindFlag
+	staleFlag = aheadFlag | behindFlag
+)
+
+// AheadBehind returns the number of commits reachable from the actual commit
+// but not from the passed one, and the number of commits reachable from the
+// passed commit but not from the actual one, like
+// `git rev-list --left-right --count actual...other` does.
+//
+// The history is walked in commit date order from both commits, painting
+// the commits with the side they are reachable from, until only commits
+// reachable from both sides remain to be walked.
+func (c *Commit) AheadBehind(other *Commit) (ahead, behind int, err error) {
+	w := &paintWalker{
+		flags:  make(map[plumbing.Hash]int),
+		queued: make(map[plumbing.Hash]int),
+		heap: binaryheap.NewWith(func(a, b interface{}) int {
+			if a.(*Commit).Committer.When.Before(b.(*Commit).Committer.When) {
+				return 1
+			}
+			return -1
+		}),
+	}
+
+	w.paint(c, aheadFlag)
+	w.paint(other, behindFlag)
+
+	for w.pending > 0 {
+		v, _ := w.heap.Pop()
+		commit := v.(*Commit)
+
+		flag := w.flags[commit.Hash]
+		w.queued[commit.Hash]--
+		if flag != staleFlag {
+			w.pending--
+		}
+
+		err = commit.Parents().ForEach(func(p *Commit) error {
+			w.paint(p, flag)
+			return nil
+		})
+
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	for _, flag := range w.flags {
+		switch flag {
+		case aheadFlag:
+			ahead++
+		case behindFlag:
+			behind++
+		}
+	}
+
+	return ahead, behind, nil
+}
+
+// paintWalker keeps the state of the walk of AheadBehind, pending is the
+// number of queued commits not reachable from both sides.
+type paintWalker struct {
+	flags   map[plumbing.Hash]int
+	queued  map[plumbing.Hash]int
+	heap    *binaryheap.Heap
+	pending int
+}
+
+// paint adds the flag to the commit, queueing it to be walked if its flags
+// have changed.
+func (w *paintWalker) paint(c *Commit, flag int) {
+	old := w.flags[c.Hash]
+	if old|flag == old {
+		return
+	}
+
+	w.flags[c.Hash] = old | flag
+	if old|flag == staleFlag {
+		// the queued entries of the commit are stale now
+		w.pending -= w.queued[c.Hash]
+	} else {
+		w.pending++
+	}
+
+	w.queued[c.Hash]++
+	w.heap.Push(c)
+}
@@ -0,0 +1,29 @@
+package object
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+func (s *mergeBaseSuite) TestAheadBehind(c *C) {
+	for _, t := range []struct {
+		actual, other string
+		ahead, behind int
+	}{
+		{"master", "dev", 5, 0},
+		{"dev", "master", 0, 5},
+		{"feature", "master", 1, 5},
+		{"A", "B", 1, 5},
+		{"A", "A", 0, 0},
+		{"C", "D", 2, 2},
+		{"M", "N", 3, 3},
+		{"Q", "N", 19, 0},
+	} {
+		commits, err := s.commitsFromRevs(c, []string{t.actual, t.other})
+		c.Assert(err, IsNil)
+
+		ahead, behind, err := commits[0].AheadBehind(commits[1])
+		c.Assert(err, IsNil)
+		c.Assert(ahead, Equals, t.ahead, Commentf("%s...%s", t.actual, t.other))
+		c.Assert(behind, Equals, t.behind, Commentf("%s...%s", t.actual, t.other))
+	}
+}
@@ -17,9 +17,10 @@ import (
 )
 
 const (
-	beginpgp  string = "-----BEGIN PGP SIGNATURE-----"
-	endpgp    string = "-----END PGP SIGNATURE-----"
-	headerpgp string = "gpgsig"
+	beginpgp       string = "-----BEGIN PGP SIGNATURE-----"
+	endpgp         string = "-----END PGP SIGNATURE-----"
+	headerpgp      string = "gpgsig"
+	headerencoding string = "encoding"
 )
 
 // Hash represents the hash of an object
@@ -42,6 +43,8 @@ type Commit struct {
 	PGPSignature string
 	// Message is the commit message, contains arbitrary text.
 	Message string
+	// Encoding is the encoding of the message, empty if it's UTF-8.
+	Encoding string
 	// TreeHash is the hash of the root tree of the commit.
 	TreeHash plumbing.Hash
 	// ParentHashes are the hashes of the parent commits of the commit.
@@ -216,6 +219,8 @@ func (c *Commit) Decode(o plumbing.EncodedObject) (err error) {
 				c.Author.Decode(data)
 			case "committer":
 				c.Committer.Decode(data)
+			case headerencoding:
+				c.Encoding = string(data)
 			case headerpgp:
 				c.PGPSignature += string(data) + "\n"
 				pgpsig = true
@@ -275,6 +280,12 @@ func (b *Commit) encode(o plumbing.EncodedObject, includeSig bool) (err error) {
 		return err
 	}
 
+	if b.Encoding != "" {
+		if _, err = fmt.Fprintf(w, "\n%s %s", headerencoding, b.Encoding); err != nil {
+			return err
+		}
+	}
+
 	if b.PGPSignature != "" && includeSig {
 		if _, err = fmt.Fprint(w, "\n"+headerpgp+" "); err != nil {
 			return err
@@ -211,6 +211,14 @@ func (s *SuiteCommit) TestCommitEncodeDecodeIdempotent(c *C) {
 				plumbing.NewHash("f000000000000000000000000000000000000007"),
 			},
 		},
+		{
+			Author:       Signature{Name: "Foo", Email: "foo@example.local", When: ts},
+			Committer:    Signature{Name: "Bar", Email: "bar@example.local", When: ts},
+			Message:      "Message in \xe9ncoding\n",
+			Encoding:     "ISO-8859-1",
+			TreeHash:     plumbing.NewHash("f000000000000000000000000000000000000008"),
+			ParentHashes: []plumbing.Hash{plumbing.NewHash("f000000000000000000000000000000000000009")},
+		},
 	}
 	for _, commit := range commits {
 		obj := &plumbing.MemoryObject{}
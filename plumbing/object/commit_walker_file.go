@@ -4,6 +4,7 @@ import (
 	"io"
 
 	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/commitgraph"
 
 	"gopkg.in/src-d/go-git.v4/plumbing/storer"
 )
@@ -13,6 +14,12 @@ type commitFileIter struct {
 	sourceIter    CommitIter
 	currentCommit *Commit
 	checkParent   bool
+
+	// graph is the commit-graph of the storer of the commits, if any, whose
+	// changed-path Bloom filters avoid diffing the trees of the commits that
+	// didn't change the file.
+	graph       commitgraph.Index
+	graphLoaded bool
 }
 
 // NewCommitFileIterFromIter returns a commit iterator which performs diffTree between
@@ -20,6 +27,8 @@ type commitFileIter struct {
 // to find the commits that explain how the files that match the path came to be.
 // If checkParent is true then the function double checks if potential parent (next commit in a path)
 // is one of the parents in the tree (it's used by `git log --all`).
+// If the storer of the commits has a commit-graph with changed-path Bloom filters, the trees of the
+// commits whose filter tells that the file wasn't changed from their first parent aren't diffed.
 func NewCommitFileIterFromIter(fileName string, commitIter CommitIter, checkParent bool) CommitIter {
 	iterator := new(commitFileIter)
 	iterator.sourceIter = commitIter
@@ -57,29 +66,11 @@ func (c *commitFileIter) getNextFileCommit() (*Commit, error) {
 			parentCommit = nil
 		}
 
-		// Fetch the trees of the current and parent commits
-		currentTree, currTreeErr := c.currentCommit.Tree()
-		if currTreeErr != nil {
-			return nil, currTreeErr
-		}
-
-		var parentTree *Tree
-		if parentCommit != nil {
-			var parentTreeErr error
-			parentTree, parentTreeErr = parentCommit.Tree()
-			if parentTreeErr != nil {
-				return nil, parentTreeErr
-			}
-		}
-
-		// Find diff between current and parent trees
-		changes, diffErr := DiffTree(currentTree, parentTree)
-		if diffErr != nil {
-			return nil, diffErr
+		found, err := c.isFileChanged(parentCommit)
+		if err != nil {
+			return nil, err
 		}
 
-		found := c.hasFileChange(changes, parentCommit)
-
 		// Storing the current-commit in-case a change is found, and
 		// Updating the current-commit for the next-iteration
 		prevCommit := c.currentCommit
@@ -96,6 +87,67 @@ func (c *commitFileIter) getNextFileCommit() (*Commit, error) {
 	}
 }
 
+// isFileChanged returns true if the file was changed between the parent
+// commit and the current one.
+func (c *commitFileIter) isFileChanged(parentCommit *Commit) (bool, error) {
+	if c.isFilteredOut(parentCommit) {
+		return false, nil
+	}
+
+	// Fetch the trees of the current and parent commits
+	currentTree, currTreeErr := c.currentCommit.Tree()
+	if currTreeErr != nil {
+		return false, currTreeErr
+	}
+
+	var parentTree *Tree
+	if parentCommit != nil {
+		var parentTreeErr error
+		parentTree, parentTreeErr = parentCommit.Tree()
+		if parentTreeErr != nil {
+			return false, parentTreeErr
+		}
+	}
+
+	// Find diff between current and parent trees
+	changes, diffErr := DiffTree(currentTree, parentTree)
+	if diffErr != nil {
+		return false, diffErr
+	}
+
+	return c.hasFileChange(changes, parentCommit), nil
+}
+
+// isFilteredOut returns true if the changed-path Bloom filter of the current
+// commit tells that the file definitely wasn't changed from the parent
+// commit, which must be its first parent, as the filters are computed.
+func (c *commitFileIter) isFilteredOut(parentCommit *Commit) bool {
+	parents := c.currentCommit.ParentHashes
+	if parentCommit == nil && len(parents) != 0 {
+		return false
+	}
+
+	if parentCommit != nil && (len(parents) == 0 || parents[0] != parentCommit.Hash) {
+		return false
+	}
+
+	if !c.graphLoaded {
+		c.graph = commitGraph(c.currentCommit.s)
+		c.graphLoaded = true
+	}
+
+	if c.graph == nil {
+		return false
+	}
+
+	data := commitGraphData(c.graph, c.currentCommit.Hash)
+	if data == nil || data.BloomFilter == nil {
+		return false
+	}
+
+	return !data.BloomFilter.Contains(c.fileName)
+}
+
 func (c *commitFileIter) hasFileChange(changes Changes, parent *Commit) bool {
 	for _, change := range changes {
 		if change.name() != c.fileName {
@@ -33,6 +33,17 @@ type CommitNode interface {
 	Commit() (*object.Commit, error)
 }
 
+// GenerationV2CommitNode is a CommitNode knowing its corrected commit date,
+// which is used instead of the generation when available.
+type GenerationV2CommitNode interface {
+	CommitNode
+	// GenerationV2 returns the corrected commit date of the commit for
+	// reachability analysis, or zero if not available. Like Generation,
+	// objects with newer corrected commit date are not reachable from
+	// objects of older one.
+	GenerationV2() uint64
+}
+
 // CommitNodeIndex is generic interface encapsulating an index of CommitNode objects
 type CommitNodeIndex interface {
 	// Get returns a commit node from a commit hash
@@ -0,0 +1,27 @@
+package commitgraph
+
+// AheadBehind returns the number of commits reachable from the actual commit
+// but not from the passed one, and the number of commits reachable from the
+// passed commit but not from the actual one, like
+// `git rev-list --left-right --count actual...other` does.
+//
+// The history is walked by generation from both commits, painting the
+// commits with the side they are reachable from, until only commits
+// reachable from both sides remain to be walked.
+func AheadBehind(c, other CommitNode) (ahead, behind int, err error) {
+	w, err := paintDownToCommon(c, other)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, flags := range w.flags {
+		switch flags & (parent1Flag | parent2Flag) {
+		case parent1Flag:
+			ahead++
+		case parent2Flag:
+			behind++
+		}
+	}
+
+	return ahead, behind, nil
+}
@@ -118,6 +118,12 @@ func (c *graphCommitNode) Generation() uint64 {
 	return uint64(c.commitData.Generation)
 }
 
+func (c *graphCommitNode) GenerationV2() uint64 {
+	// The corrected commit dates are only available if all the layers of
+	// the commit-graph have them.
+	return c.commitData.GenerationV2
+}
+
 func (c *graphCommitNode) Commit() (*object.Commit, error) {
 	return object.GetCommit(c.gci.s, c.hash)
 }
@@ -0,0 +1,288 @@
+package commitgraph
+
+import (
+	"sort"
+
+	"github.com/emirpasic/gods/trees/binaryheap"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+const (
+	parent1Flag = 1 << iota
+	parent2Flag
+	staleFlag
+	resultFlag
+)
+
+// generation returns the generation used to cut the walks of the node, its
+// corrected commit date if available or else its generation number. The
+// commits of a lower generation can't reach the ones of a higher one.
+func generation(c CommitNode) uint64 {
+	if n, ok := c.(GenerationV2CommitNode); ok {
+		if g := n.GenerationV2(); g != 0 {
+			return g
+		}
+	}
+
+	return c.Generation()
+}
+
+// newGenerationHeap returns a heap of CommitNode sorted by generation and
+// then by commit time, newest first. Popping a commit from it, all its
+// descendants in the heap have already been popped.
+func newGenerationHeap() *binaryheap.Heap {
+	return binaryheap.NewWith(func(a, b interface{}) int {
+		ga, gb := generation(a.(CommitNode)), generation(b.(CommitNode))
+		if ga != gb {
+			if ga < gb {
+				return 1
+			}
+			return -1
+		}
+
+		if a.(CommitNode).CommitTime().Before(b.(CommitNode).CommitTime()) {
+			return 1
+		}
+		return -1
+	})
+}
+
+// paintWalker paints the commits with the side of the walk they are
+// reachable from, walking them by generation. pending is the number of
+// queued commits that aren't stale.
+type paintWalker struct {
+	flags   map[plumbing.Hash]int
+	queued  map[plumbing.Hash]bool
+	heap    *binaryheap.Heap
+	pending int
+	// results are the common ancestors found, marked with resultFlag.
+	results []CommitNode
+}
+
+func newPaintWalker() *paintWalker {
+	return &paintWalker{
+		flags:  make(map[plumbing.Hash]int),
+		queued: make(map[plumbing.Hash]bool),
+		heap:   newGenerationHeap(),
+	}
+}
+
+// paint adds the flags to the commit, queueing it to be walked if its flags
+// have changed.
+func (w *paintWalker) paint(c CommitNode, flags int) {
+	old := w.flags[c.ID()]
+	if old|flags == old {
+		return
+	}
+
+	w.flags[c.ID()] = old | flags
+	if w.queued[c.ID()] {
+		if old&staleFlag == 0 && flags&staleFlag != 0 {
+			w.pending--
+		}
+
+		return
+	}
+
+	w.queued[c.ID()] = true
+	if (old|flags)&staleFlag == 0 {
+		w.pending++
+	}
+
+	w.heap.Push(c)
+}
+
+// pop returns the next commit to walk.
+func (w *paintWalker) pop() CommitNode {
+	v, _ := w.heap.Pop()
+	c := v.(CommitNode)
+
+	delete(w.queued, c.ID())
+	if w.flags[c.ID()]&staleFlag == 0 {
+		w.pending--
+	}
+
+	return c
+}
+
+// paintDownToCommon walks the history of one and two, painting the commits
+// reachable from one with parent1Flag and the ones reachable from two with
+// parent2Flag, until only stale commits, reachable from a common ancestor,
+// remain to be walked. The common ancestors found are marked with
+// resultFlag.
+func paintDownToCommon(one, two CommitNode) (*paintWalker, error) {
+	w := newPaintWalker()
+	w.paint(one, parent1Flag)
+	w.paint(two, parent2Flag)
+
+	for w.pending > 0 {
+		c := w.pop()
+		flags := w.flags[c.ID()] & (parent1Flag | parent2Flag | staleFlag)
+		if flags == parent1Flag|parent2Flag {
+			w.flags[c.ID()] |= resultFlag
+			w.results = append(w.results, c)
+			flags |= staleFlag
+		}
+
+		err := c.ParentNodes().ForEach(func(p CommitNode) error {
+			w.paint(p, flags)
+			return nil
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return w, nil
+}
+
+// MergeBase mimics the behavior of `git merge-base actual other`, returning the
+// best common ancestors between the actual and the passed one. The best common
+// ancestors can not be reached from other common ancestors.
+//
+// The history is walked by generation, so it stops as soon as the common
+// ancestors are found.
+func MergeBase(c, other CommitNode) ([]CommitNode, error) {
+	if c.ID() == other.ID() {
+		return []CommitNode{c}, nil
+	}
+
+	w, err := paintDownToCommon(c, other)
+	if err != nil {
+		return nil, err
+	}
+
+	// the common ancestors reachable from other ones are stale
+	var result []CommitNode
+	for _, node := range w.results {
+		if w.flags[node.ID()]&staleFlag == 0 {
+			result = append(result, node)
+		}
+	}
+
+	return Independents(result)
+}
+
+// IsAncestor returns true if the actual commit is ancestor of the passed one,
+// mimicking the behavior of `git merge-base --is-ancestor actual other`. The
+// ancestors of other of a generation lower than the one of the actual commit
+// aren't walked, as they can't reach it.
+func IsAncestor(c, other CommitNode) (bool, error) {
+	limit := generation(c)
+	seen := map[plumbing.Hash]bool{other.ID(): true}
+	stack := []CommitNode{other}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if node.ID() == c.ID() {
+			return true, nil
+		}
+
+		if generation(node) < limit {
+			continue
+		}
+
+		err := node.ParentNodes().ForEach(func(p CommitNode) error {
+			if !seen[p.ID()] && generation(p) >= limit {
+				seen[p.ID()] = true
+				stack = append(stack, p)
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return false, nil
+}
+
+// Independents returns a subset of the passed commits, that are not reachable
+// from the others, sorted by commit time, newest first. It mimics the behavior
+// of `git merge-base --independent commit...`. The ancestors of a generation
+// lower than the minimum of the commits aren't walked, as they can't reach
+// any of them.
+func Independents(commits []CommitNode) ([]CommitNode, error) {
+	candidates := make(map[plumbing.Hash]bool, len(commits))
+	var unique []CommitNode
+	var minGeneration uint64
+	for _, c := range commits {
+		if candidates[c.ID()] {
+			continue
+		}
+
+		candidates[c.ID()] = true
+		unique = append(unique, c)
+		if g := generation(c); len(unique) == 1 || g < minGeneration {
+			minGeneration = g
+		}
+	}
+
+	if len(unique) < 2 {
+		return unique, nil
+	}
+
+	// the walks share the cut, so the commits seen by a walk, along with
+	// their ancestors, don't have to be walked again
+	redundant := make(map[plumbing.Hash]bool)
+	seen := make(map[plumbing.Hash]bool)
+	sorted := sortByGenerationDesc(unique)
+	for _, from := range sorted {
+		if redundant[from.ID()] {
+			continue
+		}
+
+		stack := []CommitNode{from}
+		for len(stack) > 0 {
+			node := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+
+			err := node.ParentNodes().ForEach(func(p CommitNode) error {
+				if seen[p.ID()] || generation(p) < minGeneration {
+					return nil
+				}
+
+				seen[p.ID()] = true
+				if candidates[p.ID()] {
+					redundant[p.ID()] = true
+				}
+
+				stack = append(stack, p)
+				return nil
+			})
+
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var result []CommitNode
+	for _, c := range unique {
+		if !redundant[c.ID()] {
+			result = append(result, c)
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].CommitTime().After(result[j].CommitTime())
+	})
+
+	return result, nil
+}
+
+// sortByGenerationDesc returns the passed commits sorted by generation, the
+// highest first, so the walks from them reach the lower ones.
+func sortByGenerationDesc(commits []CommitNode) []CommitNode {
+	sorted := make([]CommitNode, len(commits))
+	copy(sorted, commits)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return generation(sorted[i]) > generation(sorted[j])
+	})
+
+	return sorted
+}
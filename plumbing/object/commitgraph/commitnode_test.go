@@ -96,6 +96,144 @@ func testCommitAndTree(c *C, nodeIndex CommitNodeIndex) {
 	c.Assert(tree.ID().String(), Equals, merge3commit.TreeHash.String())
 }
 
+func testTopoOrder(c *C, nodeIndex CommitNodeIndex) {
+	head, err := nodeIndex.Get(plumbing.NewHash("b9d69064b190e7aedccf84731ca1d917871f8a1c"))
+	c.Assert(err, IsNil)
+
+	iter := NewCommitNodeIterTopoOrder(
+		head,
+		nil,
+		[]plumbing.Hash{plumbing.NewHash("e713b52d7e13807e87a002e812041f248db3f643")},
+	)
+
+	var commits []string
+	iter.ForEach(func(c CommitNode) error {
+		commits = append(commits, c.ID().String())
+		return nil
+	})
+
+	c.Assert(commits, DeepEquals, []string{
+		"b9d69064b190e7aedccf84731ca1d917871f8a1c",
+		"6f6c5d2be7852c782be1dd13e36496dd7ad39560",
+		"a45273fe2d63300e1962a9e26a6b15c276cd7082",
+		"c0edf780dd0da6a65a7a49a86032fcf8a0c2d467",
+		"bb13916df33ed23004c3ce9ed3b8487528e655c1",
+		"03d2c021ff68954cf3ef0a36825e194a4b98f981",
+		"347c91919944a68e9413581a1bc15519550a3afe",
+		"ce275064ad67d51e99f026084e20827901a8361c",
+	})
+}
+
+func nodes(c *C, nodeIndex CommitNodeIndex, hashes ...string) []CommitNode {
+	var result []CommitNode
+	for _, h := range hashes {
+		node, err := nodeIndex.Get(plumbing.NewHash(h))
+		c.Assert(err, IsNil)
+		result = append(result, node)
+	}
+
+	return result
+}
+
+func ids(commits []CommitNode) []string {
+	var result []string
+	for _, c := range commits {
+		result = append(result, c.ID().String())
+	}
+
+	return result
+}
+
+func testMergeBase(c *C, nodeIndex CommitNodeIndex) {
+	for _, t := range []struct {
+		commits  []string
+		expected []string
+	}{{
+		[]string{"b9d69064b190e7aedccf84731ca1d917871f8a1c", "d2dc5ac04916e156018db4482c40c39b894090e9"},
+		[]string{"c0edf780dd0da6a65a7a49a86032fcf8a0c2d467", "03d2c021ff68954cf3ef0a36825e194a4b98f981"},
+	}, {
+		[]string{"b29328491a0682c259bcce28741eac71f3499f7d", "b9d69064b190e7aedccf84731ca1d917871f8a1c"},
+		[]string{"03d2c021ff68954cf3ef0a36825e194a4b98f981", "e713b52d7e13807e87a002e812041f248db3f643"},
+	}, {
+		[]string{"a45273fe2d63300e1962a9e26a6b15c276cd7082", "bb13916df33ed23004c3ce9ed3b8487528e655c1"},
+		[]string{"347c91919944a68e9413581a1bc15519550a3afe"},
+	}, {
+		[]string{"03d2c021ff68954cf3ef0a36825e194a4b98f981", "d2dc5ac04916e156018db4482c40c39b894090e9"},
+		[]string{"03d2c021ff68954cf3ef0a36825e194a4b98f981"},
+	}} {
+		commits := nodes(c, nodeIndex, t.commits...)
+		bases, err := MergeBase(commits[0], commits[1])
+		c.Assert(err, IsNil)
+		c.Assert(ids(bases), DeepEquals, t.expected)
+
+		bases, err = MergeBase(commits[1], commits[0])
+		c.Assert(err, IsNil)
+		c.Assert(ids(bases), DeepEquals, t.expected)
+	}
+}
+
+func testIsAncestor(c *C, nodeIndex CommitNodeIndex) {
+	commits := nodes(c, nodeIndex,
+		"e713b52d7e13807e87a002e812041f248db3f643",
+		"b9d69064b190e7aedccf84731ca1d917871f8a1c",
+		"d2dc5ac04916e156018db4482c40c39b894090e9",
+	)
+
+	for _, t := range []struct {
+		c, other int
+		expected bool
+	}{{0, 1, true}, {1, 0, false}, {0, 2, false}, {1, 1, true}} {
+		ok, err := IsAncestor(commits[t.c], commits[t.other])
+		c.Assert(err, IsNil)
+		c.Assert(ok, Equals, t.expected)
+	}
+}
+
+func testIndependents(c *C, nodeIndex CommitNodeIndex) {
+	commits := nodes(c, nodeIndex,
+		"03d2c021ff68954cf3ef0a36825e194a4b98f981",
+		"b9d69064b190e7aedccf84731ca1d917871f8a1c",
+		"c0edf780dd0da6a65a7a49a86032fcf8a0c2d467",
+		"d2dc5ac04916e156018db4482c40c39b894090e9",
+		"b29328491a0682c259bcce28741eac71f3499f7d",
+		"b9d69064b190e7aedccf84731ca1d917871f8a1c",
+	)
+
+	independents, err := Independents(commits)
+	c.Assert(err, IsNil)
+	c.Assert(ids(independents), DeepEquals, []string{
+		"b9d69064b190e7aedccf84731ca1d917871f8a1c",
+		"d2dc5ac04916e156018db4482c40c39b894090e9",
+		"b29328491a0682c259bcce28741eac71f3499f7d",
+	})
+}
+
+func testAheadBehind(c *C, nodeIndex CommitNodeIndex) {
+	for _, t := range []struct {
+		commits       []string
+		ahead, behind int
+	}{
+		{[]string{"b9d69064b190e7aedccf84731ca1d917871f8a1c", "d2dc5ac04916e156018db4482c40c39b894090e9"}, 6, 1},
+		{[]string{"b29328491a0682c259bcce28741eac71f3499f7d", "d2dc5ac04916e156018db4482c40c39b894090e9"}, 2, 2},
+		{[]string{"b29328491a0682c259bcce28741eac71f3499f7d", "b9d69064b190e7aedccf84731ca1d917871f8a1c"}, 1, 6},
+		{[]string{"03d2c021ff68954cf3ef0a36825e194a4b98f981", "b9d69064b190e7aedccf84731ca1d917871f8a1c"}, 0, 7},
+	} {
+		commits := nodes(c, nodeIndex, t.commits...)
+		ahead, behind, err := AheadBehind(commits[0], commits[1])
+		c.Assert(err, IsNil)
+		c.Assert(ahead, Equals, t.ahead)
+		c.Assert(behind, Equals, t.behind)
+	}
+}
+
+func testReachability(c *C, nodeIndex CommitNodeIndex) {
+	testTopoOrder(c, nodeIndex)
+	testMergeBase(c, nodeIndex)
+	testIsAncestor(c, nodeIndex)
+	testIndependents(c, nodeIndex)
+	testAheadBehind(c, nodeIndex)
+}
+
 func (s *CommitNodeSuite) TestObjectGraph(c *C) {
 	f := fixtures.ByTag("commit-graph").One()
 	storer := unpackRepositry(f)
@@ -104,6 +242,7 @@ func (s *CommitNodeSuite) TestObjectGraph(c *C) {
 	testWalker(c, nodeIndex)
 	testParents(c, nodeIndex)
 	testCommitAndTree(c, nodeIndex)
+	testReachability(c, nodeIndex)
 }
 
 func (s *CommitNodeSuite) TestCommitGraph(c *C) {
@@ -119,6 +258,84 @@ func (s *CommitNodeSuite) TestCommitGraph(c *C) {
 	testWalker(c, nodeIndex)
 	testParents(c, nodeIndex)
 	testCommitAndTree(c, nodeIndex)
+	testReachability(c, nodeIndex)
+}
+
+func (s *CommitNodeSuite) TestCommitGraphGenerationV2(c *C) {
+	f := fixtures.ByTag("commit-graph").One()
+	storer := unpackRepositry(f)
+	reader, err := storer.Filesystem().Open(path.Join("objects", "info", "commit-graph"))
+	c.Assert(err, IsNil)
+	defer reader.Close()
+	fileIndex, err := commitgraph.OpenFileIndex(reader)
+	c.Assert(err, IsNil)
+
+	// the commit dates of the fixture are already corrected
+	memoryIndex := commitgraph.NewMemoryIndex()
+	for i, hash := range fileIndex.Hashes() {
+		node, err := fileIndex.GetCommitDataByIndex(i)
+		c.Assert(err, IsNil)
+		node.GenerationV2 = uint64(node.When.Unix())
+		memoryIndex.Add(hash, node)
+	}
+
+	nodeIndex := NewGraphCommitNodeIndex(memoryIndex, storer)
+	testWalker(c, nodeIndex)
+	testReachability(c, nodeIndex)
+}
+
+// plainCommitNode is a CommitNode implemented outside of the package,
+// without the GenerationV2 method.
+type plainCommitNode struct {
+	CommitNode
+}
+
+func (n plainCommitNode) ParentNodes() CommitNodeIter {
+	return newParentgraphCommitNodeIter(n)
+}
+
+func (n plainCommitNode) ParentNode(i int) (CommitNode, error) {
+	parent, err := n.CommitNode.ParentNode(i)
+	if err != nil {
+		return nil, err
+	}
+
+	return plainCommitNode{parent}, nil
+}
+
+type plainCommitNodeIndex struct {
+	CommitNodeIndex
+}
+
+func (i plainCommitNodeIndex) Get(hash plumbing.Hash) (CommitNode, error) {
+	node, err := i.CommitNodeIndex.Get(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return plainCommitNode{node}, nil
+}
+
+func (s *CommitNodeSuite) TestCommitNodeWithoutGenerationV2(c *C) {
+	f := fixtures.ByTag("commit-graph").One()
+	storer := unpackRepositry(f)
+	reader, err := storer.Filesystem().Open(path.Join("objects", "info", "commit-graph"))
+	c.Assert(err, IsNil)
+	defer reader.Close()
+	index, err := commitgraph.OpenFileIndex(reader)
+	c.Assert(err, IsNil)
+
+	var _ GenerationV2CommitNode = &graphCommitNode{}
+	var _ GenerationV2CommitNode = &objectCommitNode{}
+
+	nodeIndex := plainCommitNodeIndex{NewGraphCommitNodeIndex(index, storer)}
+	node, err := nodeIndex.Get(plumbing.NewHash("b9d69064b190e7aedccf84731ca1d917871f8a1c"))
+	c.Assert(err, IsNil)
+	_, ok := node.(GenerationV2CommitNode)
+	c.Assert(ok, Equals, false)
+
+	testWalker(c, nodeIndex)
+	testReachability(c, nodeIndex)
 }
 
 func (s *CommitNodeSuite) TestMixedGraph(c *C) {
@@ -144,4 +361,5 @@ func (s *CommitNodeSuite) TestMixedGraph(c *C) {
 	testWalker(c, nodeIndex)
 	testParents(c, nodeIndex)
 	testCommitAndTree(c, nodeIndex)
+	testReachability(c, nodeIndex)
 }
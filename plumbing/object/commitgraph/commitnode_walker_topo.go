@@ -0,0 +1,158 @@
+package commitgraph
+
+import (
+	"io"
+
+	"github.com/emirpasic/gods/trees/binaryheap"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+type commitNodeIteratorTopological struct {
+	// indegrees are the number of walked children of the commits, plus one.
+	// Zero means that the children of the commit haven't been counted yet.
+	indegrees map[plumbing.Hash]int
+	// indegreeHeap are the commits whose parents are pending to be counted,
+	// sorted by generation.
+	indegreeHeap *binaryheap.Heap
+	// minGeneration is the generation down to which the indegrees are known.
+	minGeneration uint64
+	// stack are the commits ready to be returned, as all their children
+	// were returned.
+	stack        []CommitNode
+	seenExternal map[plumbing.Hash]bool
+	ignore       map[plumbing.Hash]bool
+}
+
+// NewCommitNodeIterTopoOrder returns a CommitNodeIter that walks the commit
+// history, starting at the given commit and visiting its parents in topological
+// order, like `git log --topo-order` does: no parent is returned before all of
+// its children are, and the commits of a line of history are kept together.
+// The children of the commits are counted incrementally, down to the
+// generation of the walked commits, so with a commit-graph only the part of
+// the history being returned is walked. Each commit will be visited only
+// once. Ignore allows to skip some commits from being iterated.
+func NewCommitNodeIterTopoOrder(
+	c CommitNode,
+	seenExternal map[plumbing.Hash]bool,
+	ignore []plumbing.Hash,
+) CommitNodeIter {
+	w := &commitNodeIteratorTopological{
+		indegrees:     make(map[plumbing.Hash]int),
+		indegreeHeap:  newGenerationHeap(),
+		minGeneration: generation(c),
+		seenExternal:  seenExternal,
+		ignore:        make(map[plumbing.Hash]bool),
+	}
+
+	for _, h := range ignore {
+		w.ignore[h] = true
+	}
+
+	if w.skip(c.ID()) {
+		return w
+	}
+
+	w.indegrees[c.ID()] = 1
+	w.indegreeHeap.Push(c)
+	w.stack = append(w.stack, c)
+	return w
+}
+
+func (w *commitNodeIteratorTopological) skip(h plumbing.Hash) bool {
+	return w.ignore[h] || w.seenExternal[h]
+}
+
+// countIndegrees counts the children of the commits down to the given
+// generation.
+func (w *commitNodeIteratorTopological) countIndegrees(minGeneration uint64) error {
+	for {
+		v, ok := w.indegreeHeap.Peek()
+		if !ok || generation(v.(CommitNode)) < minGeneration {
+			return nil
+		}
+
+		w.indegreeHeap.Pop()
+		c := v.(CommitNode)
+		for i, h := range c.ParentHashes() {
+			if w.skip(h) {
+				continue
+			}
+
+			if w.indegrees[h] != 0 {
+				w.indegrees[h]++
+				continue
+			}
+
+			p, err := c.ParentNode(i)
+			if err != nil {
+				return err
+			}
+
+			w.indegrees[h] = 2
+			w.indegreeHeap.Push(p)
+		}
+	}
+}
+
+func (w *commitNodeIteratorTopological) Next() (CommitNode, error) {
+	if len(w.stack) == 0 {
+		return nil, io.EOF
+	}
+
+	c := w.stack[len(w.stack)-1]
+	w.stack = w.stack[:len(w.stack)-1]
+
+	for i, h := range c.ParentHashes() {
+		if w.skip(h) {
+			continue
+		}
+
+		p, err := c.ParentNode(i)
+		if err != nil {
+			return nil, err
+		}
+
+		// the indegree of the parent is only final once all the commits
+		// that may reach it are counted
+		if g := generation(p); g < w.minGeneration {
+			w.minGeneration = g
+		}
+
+		if err := w.countIndegrees(w.minGeneration); err != nil {
+			return nil, err
+		}
+
+		w.indegrees[h]--
+		if w.indegrees[h] == 1 {
+			w.stack = append(w.stack, p)
+		}
+	}
+
+	return c, nil
+}
+
+func (w *commitNodeIteratorTopological) ForEach(cb func(CommitNode) error) error {
+	for {
+		c, err := w.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		err = cb(c)
+		if err == storer.ErrStop {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *commitNodeIteratorTopological) Close() {}
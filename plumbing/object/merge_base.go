@@ -5,6 +5,7 @@ import (
 	"sort"
 
 	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/commitgraph"
 	"gopkg.in/src-d/go-git.v4/plumbing/storer"
 )
 
@@ -20,6 +21,19 @@ func (c *Commit) MergeBase(other *Commit) ([]*Commit, error) {
 	newer := sorted[0]
 	older := sorted[1]
 
+	// with a commit-graph, reachability is checked without walking the whole
+	// history of newer
+	if generations(c.s) != nil {
+		ok, err := older.IsAncestor(newer)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			return []*Commit{older}, nil
+		}
+	}
+
 	newerHistory, err := ancestorsIndex(older, newer)
 	if err == errIsReachable {
 		return []*Commit{older}, nil
@@ -43,9 +57,29 @@ func (c *Commit) MergeBase(other *Commit) ([]*Commit, error) {
 // IsAncestor returns true if the actual commit is ancestor of the passed one.
 // It returns an error if the history is not transversable
 // It mimics the behavior of `git merge --is-ancestor actual other`
+// If the storer has a commit-graph, the walk is limited by the generation
+// numbers: the commits of a generation not bigger than the one of the actual
+// commit can't reach it. If the passed commit has a reachability bitmap, no
+// walk is needed at all.
 func (c *Commit) IsAncestor(other *Commit) (bool, error) {
+	if reachable, ok := bitmapReachable(c.s, other.Hash, c.Hash); ok {
+		return reachable, nil
+	}
+
+	var iter CommitIter
+	if generation := generations(c.s); generation != nil && generation(c.Hash) > 0 {
+		limit := generation(c.Hash)
+		var isLimit CommitFilter = func(commit *Commit) bool {
+			g := generation(commit.Hash)
+			return g > 0 && g <= limit
+		}
+
+		iter = NewFilterCommitIter(other, nil, &isLimit)
+	} else {
+		iter = NewCommitPreorderIter(other, nil, nil)
+	}
+
 	found := false
-	iter := NewCommitPreorderIter(other, nil, nil)
 	err := iter.ForEach(func(comm *Commit) error {
 		if comm.Hash != c.Hash {
 			return nil
@@ -91,20 +125,36 @@ func Independents(commits []*Commit) ([]*Commit, error) {
 	candidates := sortByCommitDateDesc(commits...)
 	candidates = removeDuplicated(candidates)
 
+	if len(candidates) < 2 {
+		return candidates, nil
+	}
+
+	// with a commit-graph, the ancestors of a generation lower than the
+	// minimum of the others can't reach any of them
+	generation := generations(candidates[0].s)
+	var minGeneration int
+
 	seen := map[plumbing.Hash]struct{}{}
 	var isLimit CommitFilter = func(commit *Commit) bool {
-		_, ok := seen[commit.Hash]
-		return ok
-	}
+		if _, ok := seen[commit.Hash]; ok {
+			return true
+		}
 
-	if len(candidates) < 2 {
-		return candidates, nil
+		if minGeneration == 0 {
+			return false
+		}
+
+		g := generation(commit.Hash)
+		return g > 0 && g < minGeneration
 	}
 
 	pos := 0
 	for {
 		from := candidates[pos]
 		others := remove(candidates, from)
+		if generation != nil {
+			minGeneration = minCommitGeneration(generation, others)
+		}
 		fromHistoryIter := NewFilterCommitIter(from, nil, &isLimit)
 		err := fromHistoryIter.ForEach(func(fromAncestor *Commit) error {
 			for _, other := range others {
@@ -208,3 +258,102 @@ func isInIndexCommitFilter(index map[plumbing.Hash]struct{}) CommitFilter {
 		return ok
 	}
 }
+
+// generations returns a function returning the generation of a commit in the
+// commit-graph of the storer, its corrected commit date if available or else
+// its generation number, zero if the commit isn't in it. It returns nil if
+// the storer has no commit-graph.
+func generations(s storer.EncodedObjectStorer) func(plumbing.Hash) int {
+	idx := commitGraph(s)
+	if idx == nil {
+		return nil
+	}
+
+	return func(h plumbing.Hash) int {
+		data := commitGraphData(idx, h)
+		if data == nil {
+			return 0
+		}
+
+		if data.GenerationV2 != 0 {
+			return int(data.GenerationV2)
+		}
+
+		return data.Generation
+	}
+}
+
+// commitGraph returns the commit-graph of the storer, nil if it has none or
+// it can't be read.
+func commitGraph(s storer.EncodedObjectStorer) commitgraph.Index {
+	gs, ok := s.(storer.CommitGraphStorer)
+	if !ok {
+		return nil
+	}
+
+	idx, err := gs.CommitGraph()
+	if err != nil {
+		return nil
+	}
+
+	return idx
+}
+
+// commitGraphData returns the data of a commit in the commit-graph, nil if
+// the commit isn't in it.
+func commitGraphData(idx commitgraph.Index, h plumbing.Hash) *commitgraph.CommitData {
+	i, err := idx.GetIndexByHash(h)
+	if err != nil {
+		return nil
+	}
+
+	data, err := idx.GetCommitDataByIndex(i)
+	if err != nil {
+		return nil
+	}
+
+	return data
+}
+
+// minCommitGeneration returns the minimum generation number of the commits,
+// zero if the generation of any of them is unknown.
+func minCommitGeneration(generation func(plumbing.Hash) int, commits []*Commit) int {
+	min := 0
+	for _, c := range commits {
+		g := generation(c.Hash)
+		if g == 0 {
+			return 0
+		}
+
+		if min == 0 || g < min {
+			min = g
+		}
+	}
+
+	return min
+}
+
+// bitmapReachable returns whether the object with hash h is reachable from
+// the commit from, using the reachability bitmap of from. ok is false if the
+// storer has no bitmap of from.
+func bitmapReachable(s storer.EncodedObjectStorer, from, h plumbing.Hash) (reachable, ok bool) {
+	bs, ok := s.(storer.PackBitmapStorer)
+	if !ok {
+		return false, false
+	}
+
+	idx, err := bs.PackBitmap()
+	if err != nil || idx == nil {
+		return false, false
+	}
+
+	b := idx.Bitmap(from)
+	if b == nil {
+		return false, false
+	}
+
+	// the objects reachable from a commit with a bitmap are all in its
+	// packfile
+	pos, found := idx.Position(h)
+	return found && b.Get(pos), true
+}
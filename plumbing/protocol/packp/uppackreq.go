@@ -39,8 +39,13 @@ func NewUploadPackRequestFromCapabilities(adv *capability.List) *UploadPackReque
 }
 
 // IsEmpty a request if empty if Haves are contained in the Wants, or if Wants
-// length is zero
+// length is zero. A request changing the depth of a shallow repository is
+// never empty, since the server may send the history missing locally.
 func (r *UploadPackRequest) IsEmpty() bool {
+	if len(r.Shallows) != 0 && !r.Depth.IsZero() {
+		return false
+	}
+
 	return isSubset(r.Wants, r.Haves)
 }
 
@@ -30,7 +30,7 @@ type UploadPackResponse struct {
 // NewUploadPackResponse create a new UploadPackResponse instance, the request
 // being responded by the response is required.
 func NewUploadPackResponse(req *UploadPackRequest) *UploadPackResponse {
-	isShallow := !req.Depth.IsZero()
+	isShallow := !req.Depth.IsZero() || len(req.Shallows) != 0
 	isMultiACK := req.Capabilities.Supports(capability.MultiACK) ||
 		req.Capabilities.Supports(capability.MultiACKDetailed)
 
@@ -0,0 +1,322 @@
+package revlist
+
+import (
+	"errors"
+	"fmt"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/bitmap"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+const (
+	// bitmapCommitSpacing is the number of commits between two commits with
+	// a reachability bitmap, besides the tips.
+	bitmapCommitSpacing = 100
+	// minBitmapCommits is the number of commits up to which all of them get
+	// a reachability bitmap.
+	minBitmapCommits = 100
+)
+
+// errNoBitmap is returned by bitmapObjects when the storage has no
+// reachability bitmaps.
+var errNoBitmap = errors.New("no reachability bitmaps")
+
+// bitmapObjects is the same as Objects, but using the reachability bitmaps of
+// the storage. It returns errNoBitmap if the storage has none.
+func bitmapObjects(
+	s storer.EncodedObjectStorer,
+	objs,
+	ignore []plumbing.Hash,
+) ([]plumbing.Hash, error) {
+	bs, ok := s.(storer.PackBitmapStorer)
+	if !ok {
+		return nil, errNoBitmap
+	}
+
+	idx, err := bs.PackBitmap()
+	if err != nil {
+		return nil, err
+	}
+
+	if idx == nil {
+		return nil, errNoBitmap
+	}
+
+	ignored := newBitmapWalker(s, idx)
+	if err := ignored.walk(ignore, true); err != nil {
+		return nil, err
+	}
+
+	w := newBitmapWalker(s, idx)
+	w.exclude = ignored
+	if err := w.walk(objs, false); err != nil {
+		return nil, err
+	}
+
+	return w.objects(), nil
+}
+
+// bitmapWalker walks the objects reachable from others, using the
+// reachability bitmaps of a packfile to skip the walk of the history of the
+// commits with a bitmap. The objects found in the packfile are set in bits,
+// the other ones are kept in extra.
+type bitmapWalker struct {
+	s     storer.EncodedObjectStorer
+	idx   *bitmap.Index
+	bits  *bitmap.Bitmap
+	extra map[plumbing.Hash]bool
+	// exclude is a walker with the objects not to walk.
+	exclude *bitmapWalker
+	// setTypes sets in idx the types of the objects walked.
+	setTypes bool
+}
+
+func newBitmapWalker(s storer.EncodedObjectStorer, idx *bitmap.Index) *bitmapWalker {
+	return &bitmapWalker{
+		s:     s,
+		idx:   idx,
+		bits:  bitmap.NewBitmap(),
+		extra: make(map[plumbing.Hash]bool),
+	}
+}
+
+// has returns whether the object was already found by the walker.
+func (w *bitmapWalker) has(h plumbing.Hash) bool {
+	if pos, ok := w.idx.Position(h); ok {
+		return w.bits.Get(pos)
+	}
+
+	return w.extra[h]
+}
+
+func (w *bitmapWalker) skip(h plumbing.Hash) bool {
+	return w.has(h) || w.exclude != nil && w.exclude.has(h)
+}
+
+func (w *bitmapWalker) add(h plumbing.Hash, t plumbing.ObjectType) {
+	pos, ok := w.idx.Position(h)
+	if !ok {
+		w.extra[h] = true
+		return
+	}
+
+	w.bits.Set(pos)
+	if w.setTypes {
+		w.idx.SetType(pos, t)
+	}
+}
+
+// walk walks the objects reachable from the given ones. The missing objects
+// are skipped if allowMissingObjects is true.
+func (w *bitmapWalker) walk(hashes []plumbing.Hash, allowMissingObjects bool) error {
+	stack := make([]plumbing.Hash, len(hashes))
+	copy(stack, hashes)
+	for len(stack) > 0 {
+		h := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if w.skip(h) {
+			continue
+		}
+
+		if b := w.idx.Bitmap(h); b != nil {
+			w.bits.Or(b)
+			continue
+		}
+
+		o, err := w.s.EncodedObject(plumbing.AnyObject, h)
+		if err == plumbing.ErrObjectNotFound && allowMissingObjects {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		w.add(h, o.Type())
+		do, err := object.DecodeObject(w.s, o)
+		if err != nil {
+			return err
+		}
+
+		switch do := do.(type) {
+		case *object.Commit:
+			// the parents are walked first, so the trees already found
+			// from their bitmaps aren't walked
+			stack = append(stack, do.TreeHash)
+			stack = append(stack, do.ParentHashes...)
+		case *object.Tree:
+			for _, e := range do.Entries {
+				switch {
+				case e.Mode == filemode.Submodule:
+				case e.Mode == filemode.Dir:
+					stack = append(stack, e.Hash)
+				case !w.skip(e.Hash):
+					w.add(e.Hash, plumbing.BlobObject)
+				}
+			}
+		case *object.Tag:
+			stack = append(stack, do.Target)
+		}
+	}
+
+	return nil
+}
+
+// objects returns the objects found by the walker that aren't in the
+// excluded ones.
+func (w *bitmapWalker) objects() []plumbing.Hash {
+	bits := w.bits
+	if w.exclude != nil {
+		bits = bits.Clone()
+		bits.AndNot(w.exclude.bits)
+	}
+
+	result := w.idx.Objects(bits)
+	for h := range w.extra {
+		result = append(result, h)
+	}
+
+	return result
+}
+
+// BuildBitmaps computes the reachability bitmaps of the commits of the given
+// tips, and of a sample of their ancestors, and the type bitmaps of the
+// objects reachable from the tips, setting them in idx. All the objects
+// reachable from the tips must be in the packfile of idx.
+func BuildBitmaps(
+	s storer.EncodedObjectStorer,
+	idx *bitmap.Index,
+	tips []plumbing.Hash,
+) error {
+	w := newBitmapWalker(s, idx)
+	w.setTypes = true
+	if err := w.walk(tips, false); err != nil {
+		return err
+	}
+
+	for h := range w.extra {
+		return fmt.Errorf("object %s is not in packfile %s", h, idx.Packfile())
+	}
+
+	commits, err := bitmapCommits(s, tips)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range commits {
+		cw := newBitmapWalker(s, idx)
+		if err := cw.walk([]plumbing.Hash{c}, false); err != nil {
+			return err
+		}
+
+		if err := idx.Add(c, cw.bits); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// bitmapCommits returns the commits to compute a reachability bitmap for, the
+// ones of the tips and a sample of their ancestors, sorted so the ancestors
+// come first.
+func bitmapCommits(s storer.EncodedObjectStorer, tips []plumbing.Hash) ([]plumbing.Hash, error) {
+	isTip := make(map[plumbing.Hash]bool)
+	var roots []*object.Commit
+	for _, h := range tips {
+		c, err := peelToCommit(s, h)
+		if err != nil {
+			return nil, err
+		}
+
+		if c != nil && !isTip[c.Hash] {
+			isTip[c.Hash] = true
+			roots = append(roots, c)
+		}
+	}
+
+	sorted, err := commitsParentsFirst(roots)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sorted) <= minBitmapCommits {
+		return sorted, nil
+	}
+
+	var selected []plumbing.Hash
+	for i, h := range sorted {
+		if isTip[h] || i%bitmapCommitSpacing == 0 {
+			selected = append(selected, h)
+		}
+	}
+
+	return selected, nil
+}
+
+// peelToCommit returns the commit the given object points to, following the
+// tags, nil if it doesn't point to a commit.
+func peelToCommit(s storer.EncodedObjectStorer, h plumbing.Hash) (*object.Commit, error) {
+	for {
+		o, err := object.GetObject(s, h)
+		if err != nil {
+			return nil, err
+		}
+
+		switch o := o.(type) {
+		case *object.Commit:
+			return o, nil
+		case *object.Tag:
+			h = o.Target
+		default:
+			return nil, nil
+		}
+	}
+}
+
+// commitsParentsFirst returns the commits reachable from the given ones, each
+// one after all its parents.
+func commitsParentsFirst(roots []*object.Commit) ([]plumbing.Hash, error) {
+	type frame struct {
+		commit *object.Commit
+		next   int
+	}
+
+	seen := make(map[plumbing.Hash]bool)
+	var sorted []plumbing.Hash
+	for _, root := range roots {
+		if seen[root.Hash] {
+			continue
+		}
+
+		seen[root.Hash] = true
+		stack := []*frame{{commit: root}}
+		for len(stack) > 0 {
+			f := stack[len(stack)-1]
+			if f.next == f.commit.NumParents() {
+				sorted = append(sorted, f.commit.Hash)
+				stack = stack[:len(stack)-1]
+				continue
+			}
+
+			i := f.next
+			f.next++
+			if seen[f.commit.ParentHashes[i]] {
+				continue
+			}
+
+			p, err := f.commit.Parent(i)
+			if err != nil {
+				return nil, err
+			}
+
+			seen[p.Hash] = true
+			stack = append(stack, &frame{commit: p})
+		}
+	}
+
+	return sorted, nil
+}
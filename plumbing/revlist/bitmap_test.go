@@ -0,0 +1,158 @@
+package revlist
+
+import (
+	"sort"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git-fixtures.v3"
+)
+
+type BitmapSuite struct {
+	fixtures.Suite
+	Storer *filesystem.Storage
+}
+
+var _ = Suite(&BitmapSuite{})
+
+func (s *BitmapSuite) SetUpTest(c *C) {
+	s.Suite.SetUpSuite(c)
+	s.Storer = filesystem.NewStorage(fixtures.Basic().One().DotGit(), cache.NewObjectLRUDefault())
+}
+
+// buildBitmaps stores the reachability bitmaps of the packfile of the
+// storer, computed from its references.
+func (s *BitmapSuite) buildBitmaps(c *C) []plumbing.Hash {
+	idx, err := s.Storer.NewPackBitmap(s.packfile(c))
+	c.Assert(err, IsNil)
+
+	iter, err := s.Storer.IterReferences()
+	c.Assert(err, IsNil)
+
+	var tips []plumbing.Hash
+	c.Assert(iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference {
+			tips = append(tips, ref.Hash())
+		}
+
+		return nil
+	}), IsNil)
+
+	c.Assert(BuildBitmaps(s.Storer, idx, tips), IsNil)
+	c.Assert(s.Storer.SetPackBitmap(idx), IsNil)
+	return tips
+}
+
+func (s *BitmapSuite) assertSameObjects(c *C, objs, ignore []plumbing.Hash) {
+	expected, err := ObjectsWithStorageForIgnores(s.Storer, s.Storer, objs, ignore)
+	c.Assert(err, IsNil)
+
+	obtained, err := bitmapObjects(s.Storer, objs, ignore)
+	c.Assert(err, IsNil)
+
+	sortHashes(expected)
+	sortHashes(obtained)
+	c.Assert(obtained, DeepEquals, expected)
+}
+
+func sortHashes(hashes []plumbing.Hash) {
+	sort.Slice(hashes, func(i, j int) bool {
+		return hashes[i].String() < hashes[j].String()
+	})
+}
+
+func (s *BitmapSuite) TestNoBitmap(c *C) {
+	_, err := bitmapObjects(s.Storer, []plumbing.Hash{plumbing.NewHash(initialCommit)}, nil)
+	c.Assert(err, Equals, errNoBitmap)
+}
+
+func (s *BitmapSuite) TestBuildBitmaps(c *C) {
+	s.buildBitmaps(c)
+
+	idx, err := s.Storer.PackBitmap()
+	c.Assert(err, IsNil)
+	c.Assert(idx, NotNil)
+
+	// all the commits have a bitmap in small repositories
+	c.Assert(idx.Commits(), HasLen, 9)
+	c.Assert(idx.TypeBitmap(plumbing.CommitObject).Count(), Equals, 9)
+	for _, commit := range idx.Commits() {
+		objs, err := ObjectsWithStorageForIgnores(s.Storer, s.Storer, []plumbing.Hash{commit}, nil)
+		c.Assert(err, IsNil)
+		c.Assert(idx.Bitmap(commit).Count(), Equals, len(objs))
+	}
+
+	var typed int
+	for _, t := range []plumbing.ObjectType{
+		plumbing.CommitObject, plumbing.TreeObject,
+		plumbing.BlobObject, plumbing.TagObject,
+	} {
+		typed += idx.TypeBitmap(t).Count()
+	}
+
+	c.Assert(typed, Equals, idx.Count())
+}
+
+func (s *BitmapSuite) TestObjects(c *C) {
+	tips := s.buildBitmaps(c)
+
+	s.assertSameObjects(c, tips, nil)
+	s.assertSameObjects(c, []plumbing.Hash{plumbing.NewHash(secondCommit)},
+		[]plumbing.Hash{plumbing.NewHash(initialCommit)})
+	s.assertSameObjects(c, []plumbing.Hash{plumbing.NewHash(someCommitBranch)},
+		[]plumbing.Hash{plumbing.NewHash(someCommitOtherBranch)})
+
+	// the ignored objects may be missing
+	s.assertSameObjects(c, []plumbing.Hash{plumbing.NewHash(someCommit)},
+		[]plumbing.Hash{plumbing.NewHash(secondCommit), plumbing.ZeroHash})
+
+	// the history isn't walked
+	objs, err := Objects(s.Storer, tips, nil)
+	c.Assert(err, IsNil)
+	c.Assert(objs, HasLen, 31)
+}
+
+func (s *BitmapSuite) TestObjectsNotInPackfile(c *C) {
+	s.buildBitmaps(c)
+
+	parent, err := object.GetCommit(s.Storer, plumbing.NewHash(someCommit))
+	c.Assert(err, IsNil)
+
+	sig := object.Signature{Name: "foo", Email: "foo@foo.foo", When: time.Now()}
+	commit := &object.Commit{
+		Author:       sig,
+		Committer:    sig,
+		Message:      "foo\n",
+		TreeHash:     parent.TreeHash,
+		ParentHashes: []plumbing.Hash{parent.Hash},
+	}
+
+	o := s.Storer.NewEncodedObject()
+	c.Assert(commit.Encode(o), IsNil)
+	h, err := s.Storer.SetEncodedObject(o)
+	c.Assert(err, IsNil)
+
+	s.assertSameObjects(c, []plumbing.Hash{h}, nil)
+	s.assertSameObjects(c, []plumbing.Hash{h}, []plumbing.Hash{parent.Hash})
+
+	objs, err := Objects(s.Storer, []plumbing.Hash{h}, []plumbing.Hash{parent.Hash})
+	c.Assert(err, IsNil)
+	c.Assert(objs, DeepEquals, []plumbing.Hash{h})
+
+	idx, err := s.Storer.NewPackBitmap(s.packfile(c))
+	c.Assert(err, IsNil)
+	err = BuildBitmaps(s.Storer, idx, []plumbing.Hash{h})
+	c.Assert(err, ErrorMatches, "object .* is not in packfile .*")
+}
+
+func (s *BitmapSuite) packfile(c *C) plumbing.Hash {
+	packs, err := s.Storer.ObjectPacks()
+	c.Assert(err, IsNil)
+	c.Assert(packs, HasLen, 1)
+	return packs[0]
+}
@@ -15,12 +15,18 @@ import (
 // Objects applies a complementary set. It gets all the hashes from all
 // the reachable objects from the given objects. Ignore param are object hashes
 // that we want to ignore on the result. All that objects must be accessible
-// from the object storer.
+// from the object storer. If the storer has reachability bitmaps, the history
+// of the commits with a bitmap isn't walked.
 func Objects(
 	s storer.EncodedObjectStorer,
 	objs,
 	ignore []plumbing.Hash,
 ) ([]plumbing.Hash, error) {
+	result, err := bitmapObjects(s, objs, ignore)
+	if err != errNoBitmap {
+		return result, err
+	}
+
 	return ObjectsWithStorageForIgnores(s, s, objs, ignore)
 }
 
@@ -0,0 +1,20 @@
+package storer
+
+import (
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/bitmap"
+)
+
+// PackBitmapStorer is a storage of the reachability bitmaps of a packfile,
+// used to find the objects reachable from its commits without walking the
+// history. It's an optional interface of the storages storing packfiles.
+type PackBitmapStorer interface {
+	// PackBitmap returns the reachability bitmaps, or nil if no packfile
+	// has them.
+	PackBitmap() (*bitmap.Index, error)
+	// NewPackBitmap returns an Index without bitmaps of the given packfile.
+	NewPackBitmap(pack plumbing.Hash) (*bitmap.Index, error)
+	// SetPackBitmap stores the bitmaps of the given Index, replacing the ones
+	// of any other packfile.
+	SetPackBitmap(*bitmap.Index) error
+}
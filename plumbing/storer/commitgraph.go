@@ -0,0 +1,17 @@
+package storer
+
+import "gopkg.in/src-d/go-git.v4/plumbing/format/commitgraph"
+
+// CommitGraphStorer is a storage of the commit-graph, a cache of the commit
+// history used to speed up its walks. It's an optional interface of the
+// storages, the ones without it don't have a commit-graph.
+type CommitGraphStorer interface {
+	// CommitGraph returns the commit-graph, or nil if there is none.
+	CommitGraph() (commitgraph.Index, error)
+	// SetCommitGraph replaces the commit-graph with one containing the
+	// commits of the given index.
+	SetCommitGraph(commitgraph.Index) error
+	// AddCommitGraphLayer adds the commits of the given index missing in the
+	// commit-graph as a new layer of a split commit-graph chain.
+	AddCommitGraphLayer(commitgraph.Index) error
+}
@@ -0,0 +1,19 @@
+package storer
+
+import "gopkg.in/src-d/go-git.v4/plumbing/format/midx"
+
+// MultiPackIndexStorer is a storage of the multi-pack-index, a single index
+// of the objects of all the packfiles used to look them up without searching
+// every packfile index. It's an optional interface of the storages storing
+// packfiles.
+type MultiPackIndexStorer interface {
+	// MultiPackIndex returns the multi-pack-index, or nil if there is none.
+	MultiPackIndex() (midx.Index, error)
+	// WriteMultiPackIndex writes the multi-pack-index of all the packfiles.
+	WriteMultiPackIndex() error
+	// VerifyMultiPackIndex checks that the multi-pack-index matches the
+	// packfiles it covers.
+	VerifyMultiPackIndex() error
+	// RemoveMultiPackIndex removes the multi-pack-index, if any.
+	RemoveMultiPackIndex() error
+}
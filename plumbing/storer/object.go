@@ -87,6 +87,31 @@ type PackedObjectStorer interface {
 	DeleteOldObjectPackAndIndex(plumbing.Hash, time.Time) error
 }
 
+// ObjectPackInfoStorer is an optional interface for PackedObjectStorer
+// giving the details of each packfile, needed to repack without losing the
+// objects that must be kept.
+type ObjectPackInfoStorer interface {
+	// ObjectPackHashes returns the hashes of the objects in the given pack.
+	ObjectPackHashes(plumbing.Hash) ([]plumbing.Hash, error)
+	// ObjectPackTime returns the modification time of the given pack.
+	ObjectPackTime(plumbing.Hash) (time.Time, error)
+	// ObjectPackKept returns whether the given pack is marked to be kept,
+	// with a .keep file, and so it must not be repacked nor deleted.
+	ObjectPackKept(plumbing.Hash) (bool, error)
+}
+
+// CruftPackStorer is an optional interface for PackedObjectStorer keeping
+// unreachable objects in cruft packfiles, which record the modification time
+// of each of their objects, so they expire by age like the loose ones.
+type CruftPackStorer interface {
+	// ObjectPackMTimes returns the modification times of the objects of
+	// the given pack, or nil if it isn't a cruft pack.
+	ObjectPackMTimes(plumbing.Hash) (map[plumbing.Hash]time.Time, error)
+	// SetObjectPackMTimes makes the given pack a cruft pack, recording the
+	// given modification times of its objects.
+	SetObjectPackMTimes(plumbing.Hash, map[plumbing.Hash]time.Time) error
+}
+
 // PackfileWriter is a optional method for ObjectStorer, it enable direct write
 // of packfile to the storage
 type PackfileWriter interface {
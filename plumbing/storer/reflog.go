@@ -0,0 +1,19 @@
+package storer
+
+import (
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/reflog"
+)
+
+// ReflogStorer is an optional interface for ReferenceStorer keeping the
+// reflogs, the history of the values of the references.
+type ReflogStorer interface {
+	// ReflogReferences returns the names of the references with a reflog.
+	ReflogReferences() ([]plumbing.ReferenceName, error)
+	// Reflog returns the entries of the reflog of the given reference,
+	// oldest first, none if it has no reflog.
+	Reflog(plumbing.ReferenceName) ([]*reflog.Entry, error)
+	// SetReflog replaces the entries of the existing reflog of the given
+	// reference.
+	SetReflog(plumbing.ReferenceName, []*reflog.Entry) error
+}
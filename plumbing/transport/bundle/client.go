@@ -0,0 +1,137 @@
+// Package bundle implements a read-only transport reading from git bundle
+// files, allowing to fetch and clone from them as from any other remote.
+package bundle
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/bundle"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp/capability"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/utils/ioutil"
+)
+
+// Extension is the conventional extension of bundle files, endpoints with a
+// path ending with it are served by this transport.
+const Extension = ".bundle"
+
+var (
+	// ErrReceivePackNotSupported is returned when trying to push to a bundle.
+	ErrReceivePackNotSupported = errors.New("bundle: push to a bundle is not supported")
+	// ErrShallowNotSupported is returned when a shallow fetch is requested.
+	ErrShallowNotSupported = errors.New("bundle: shallow fetch is not supported")
+)
+
+// DefaultClient is the default bundle client.
+var DefaultClient = NewClient()
+
+type client struct{}
+
+// NewClient returns a new transport.Transport reading bundle files from the
+// local filesystem.
+func NewClient() transport.Transport {
+	return &client{}
+}
+
+// IsBundle returns true if the given endpoint points to a bundle file.
+func IsBundle(ep *transport.Endpoint) bool {
+	return ep.Protocol == "file" && strings.HasSuffix(ep.Path, Extension)
+}
+
+func (c *client) NewUploadPackSession(ep *transport.Endpoint, auth transport.AuthMethod) (
+	transport.UploadPackSession, error) {
+
+	f, err := os.Open(ep.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, transport.ErrRepositoryNotFound
+		}
+
+		return nil, err
+	}
+
+	b := bundle.New()
+	if err := bundle.NewDecoder(f).Decode(b); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	return &upSession{f: f, b: b}, nil
+}
+
+func (c *client) NewReceivePackSession(*transport.Endpoint, transport.AuthMethod) (
+	transport.ReceivePackSession, error) {
+	return nil, ErrReceivePackNotSupported
+}
+
+type upSession struct {
+	f *os.File
+	b *bundle.Bundle
+}
+
+func (s *upSession) AdvertisedReferences() (*packp.AdvRefs, error) {
+	if len(s.b.References) == 0 {
+		return nil, transport.ErrEmptyRemoteRepository
+	}
+
+	ar := packp.NewAdvRefs()
+	if err := ar.Capabilities.Set(capability.OFSDelta); err != nil {
+		return nil, err
+	}
+
+	for _, r := range s.b.References {
+		if r.Name() == plumbing.HEAD {
+			h := r.Hash()
+			ar.Head = &h
+			continue
+		}
+
+		if err := ar.AddReference(r); err != nil {
+			return nil, err
+		}
+	}
+
+	return ar, nil
+}
+
+// Prerequisites returns the commits the fetching repository must have to
+// store the packfile of the bundle. UploadPack doesn't check them, since the
+// session doesn't know the objects of the client besides the haves of the
+// request.
+func (s *upSession) Prerequisites() []bundle.Prerequisite {
+	return s.b.Prerequisites
+}
+
+// UploadPack returns the packfile of the bundle, a bundle can't be negotiated
+// so the whole packfile is always returned.
+func (s *upSession) UploadPack(ctx context.Context, req *packp.UploadPackRequest) (
+	*packp.UploadPackResponse, error) {
+
+	if req.IsEmpty() {
+		return nil, transport.ErrEmptyUploadPackRequest
+	}
+
+	if !req.Depth.IsZero() {
+		return nil, ErrShallowNotSupported
+	}
+
+	r := ioutil.NewReadCloser(s.b.Packfile, s.f)
+	s.f = nil
+
+	return packp.NewUploadPackResponseWithPackfile(req,
+		ioutil.NewContextReadCloser(ctx, r),
+	), nil
+}
+
+func (s *upSession) Close() error {
+	if s.f == nil {
+		return nil
+	}
+
+	return s.f.Close()
+}
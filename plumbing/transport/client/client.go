@@ -6,8 +6,10 @@ import (
 	"fmt"
 
 	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/bundle"
 	"gopkg.in/src-d/go-git.v4/plumbing/transport/file"
 	"gopkg.in/src-d/go-git.v4/plumbing/transport/git"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/helper"
 	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
 	"gopkg.in/src-d/go-git.v4/plumbing/transport/ssh"
 )
@@ -32,11 +34,22 @@ func InstallProtocol(scheme string, c transport.Transport) {
 }
 
 // NewClient returns the appropriate client among of the set of known protocols:
-// http://, https://, ssh:// and file://.
-// See `InstallProtocol` to add or modify protocols.
+// http://, https://, ssh:// and file://. Local paths to files with the
+// `.bundle` extension are read using the bundle transport. The schemes
+// without a known protocol, and the URLs with the <transport>::<address>
+// syntax, are served by the external git-remote-<transport> helper if it is
+// installed. See `InstallProtocol` to add or modify protocols.
 func NewClient(endpoint *transport.Endpoint) (transport.Transport, error) {
+	if bundle.IsBundle(endpoint) {
+		return bundle.DefaultClient, nil
+	}
+
 	f, ok := Protocols[endpoint.Protocol]
-	if !ok {
+	if !ok || endpoint.RemoteHelper {
+		if helper.IsInstalled(endpoint.Protocol) {
+			return helper.DefaultClient, nil
+		}
+
 		return nil, fmt.Errorf("unsupported scheme %q", endpoint.Protocol)
 	}
 
@@ -33,6 +33,14 @@ func (s *ClientSuite) TestNewClientUnknown(c *C) {
 	c.Assert(err, NotNil)
 }
 
+func (s *ClientSuite) TestNewClientRemoteHelperUnknown(c *C) {
+	e, err := transport.NewEndpoint("unknown::github.com/src-d/go-git")
+	c.Assert(err, IsNil)
+
+	_, err = NewClient(e)
+	c.Assert(err, ErrorMatches, `unsupported scheme "unknown"`)
+}
+
 func (s *ClientSuite) TestNewClientNil(c *C) {
 	Protocols["newscheme"] = nil
 	e, err := transport.NewEndpoint("newscheme://github.com/src-d/go-git")
@@ -107,6 +107,10 @@ type Endpoint struct {
 	Port int
 	// Path is the repository path.
 	Path string
+	// RemoteHelper is true if the endpoint was given with the
+	// <transport>::<address> syntax, Protocol is the transport and Path the
+	// address given to its remote helper.
+	RemoteHelper bool
 }
 
 var defaultPorts = map[string]int{
@@ -118,6 +122,10 @@ var defaultPorts = map[string]int{
 
 // String returns a string representation of the Git URL.
 func (u *Endpoint) String() string {
+	if u.RemoteHelper {
+		return fmt.Sprintf("%s::%s", u.Protocol, u.Path)
+	}
+
 	var buf bytes.Buffer
 	if u.Protocol != "" {
 		buf.WriteString(u.Protocol)
@@ -158,6 +166,10 @@ func (u *Endpoint) String() string {
 }
 
 func NewEndpoint(endpoint string) (*Endpoint, error) {
+	if e, ok := parseRemoteHelper(endpoint); ok {
+		return e, nil
+	}
+
 	if e, ok := parseSCPLike(endpoint); ok {
 		return e, nil
 	}
@@ -244,6 +256,19 @@ func parseSCPLike(endpoint string) (*Endpoint, bool) {
 	}, true
 }
 
+func parseRemoteHelper(endpoint string) (*Endpoint, bool) {
+	if !giturl.MatchesRemoteHelper(endpoint) {
+		return nil, false
+	}
+
+	transport, address := giturl.FindRemoteHelperComponents(endpoint)
+	return &Endpoint{
+		Protocol:     transport,
+		Path:         address,
+		RemoteHelper: true,
+	}, true
+}
+
 func parseFile(endpoint string) (*Endpoint, bool) {
 	if giturl.MatchesScheme(endpoint) {
 		return nil, false
@@ -155,6 +155,16 @@ func (s *SuiteCommon) TestNewEndpointFileURL(c *C) {
 	c.Assert(e.String(), Equals, "file:///foo.git")
 }
 
+func (s *SuiteCommon) TestNewEndpointRemoteHelper(c *C) {
+	e, err := NewEndpoint("s3::bucket/foo.git")
+	c.Assert(err, IsNil)
+	c.Assert(e.Protocol, Equals, "s3")
+	c.Assert(e.Host, Equals, "")
+	c.Assert(e.Path, Equals, "bucket/foo.git")
+	c.Assert(e.RemoteHelper, Equals, true)
+	c.Assert(e.String(), Equals, "s3::bucket/foo.git")
+}
+
 func (s *SuiteCommon) TestValidEndpoint(c *C) {
 	user := "person@mail.com"
 	pass := " !\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~"
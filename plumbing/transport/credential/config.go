@@ -0,0 +1,175 @@
+package credential
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/config"
+	format "gopkg.in/src-d/go-git.v4/plumbing/format/config"
+)
+
+const (
+	credentialSection = "credential"
+	helperKey         = "helper"
+	useHTTPPathKey    = "useHttpPath"
+	usernameKey       = "username"
+
+	cacheHelper = "cache"
+	storeHelper = "store"
+)
+
+// Config is the credential configuration for a URL, read from the
+// credential.* and credential.<url>.* options.
+type Config struct {
+	// Helpers are the configured helpers, in order.
+	Helpers Helpers
+	// UseHTTPPath is true if the path of the URL should be used to lookup
+	// the credentials, otherwise only the protocol and host are used.
+	UseHTTPPath bool
+	// Username is the default username.
+	Username string
+}
+
+// NewConfig returns the credential configuration that applies to u. The
+// options of the credential section apply to all the URLs, and the ones of
+// the credential.<url> subsections to the URLs matching the subsection name.
+// An empty helper value resets the list of helpers.
+//
+// The "cache" and "store" helpers are implemented by a process-wide
+// MemoryHelper and by a StoreHelper, any other helper is run as an external
+// program.
+func NewConfig(raw *format.Config, u *url.URL) *Config {
+	cfg := &Config{}
+	target := NewCredential(u)
+
+	for _, s := range raw.Sections {
+		if !s.IsName(credentialSection) {
+			continue
+		}
+
+		cfg.apply(s.Options)
+		for _, ss := range s.Subsections {
+			if matchURL(target, ss.Name) {
+				cfg.apply(ss.Options)
+			}
+		}
+	}
+
+	return cfg
+}
+
+// Credential returns the credential description to lookup for u.
+func (cfg *Config) Credential(u *url.URL) *Credential {
+	c := NewCredential(u)
+	if !cfg.UseHTTPPath {
+		c.Path = ""
+	}
+
+	if c.Username == "" {
+		c.Username = cfg.Username
+	}
+
+	return c
+}
+
+func (cfg *Config) apply(opts format.Options) {
+	for _, o := range opts {
+		switch {
+		case o.IsKey(helperKey):
+			if o.Value == "" {
+				cfg.Helpers = nil
+				continue
+			}
+
+			cfg.Helpers = append(cfg.Helpers, newHelper(o.Value))
+		case o.IsKey(useHTTPPathKey):
+			cfg.UseHTTPPath = config.IsTrue(o.Value)
+		case o.IsKey(usernameKey):
+			cfg.Username = o.Value
+		}
+	}
+}
+
+// matchURL returns true if the credential c matches the URL pattern of a
+// credential.<url> subsection.
+func matchURL(c *Credential, pattern string) bool {
+	u, err := url.Parse(pattern)
+	if err != nil || u.Scheme == "" {
+		// a bare hostname, as accepted by git
+		return c.Host == pattern
+	}
+
+	p := NewCredential(u)
+	p.Password = ""
+	return c.Match(p)
+}
+
+var (
+	cachesMu sync.Mutex
+	caches   = map[time.Duration]*MemoryHelper{}
+)
+
+func newHelper(value string) Helper {
+	fields := strings.Fields(value)
+	switch fields[0] {
+	case cacheHelper:
+		timeout := DefaultCacheTimeout
+		if v, ok := helperOption(fields[1:], "timeout"); ok {
+			if secs, err := strconv.Atoi(v); err == nil {
+				timeout = time.Duration(secs) * time.Second
+			}
+		}
+
+		cachesMu.Lock()
+		defer cachesMu.Unlock()
+		if _, ok := caches[timeout]; !ok {
+			caches[timeout] = NewMemoryHelper(timeout)
+		}
+
+		return caches[timeout]
+	case storeHelper:
+		path, ok := helperOption(fields[1:], "file")
+		if !ok {
+			home, _ := os.UserHomeDir()
+			path = filepath.Join(home, ".git-credentials")
+		}
+
+		return NewStoreHelper(expandHome(path))
+	default:
+		return NewExecHelper(value)
+	}
+}
+
+// helperOption returns the value of a --<name>=<value> or --<name> <value>
+// argument.
+func helperOption(args []string, name string) (string, bool) {
+	for i, arg := range args {
+		if strings.HasPrefix(arg, "--"+name+"=") {
+			return arg[len(name)+3:], true
+		}
+
+		if arg == "--"+name && i+1 < len(args) {
+			return args[i+1], true
+		}
+	}
+
+	return "", false
+}
+
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+
+	return filepath.Join(home, path[2:])
+}
@@ -0,0 +1,174 @@
+// Package credential implements the git credential helper protocol, used to
+// retrieve and save the credentials of remote repositories, see
+// https://git-scm.com/docs/gitcredentials and
+// https://git-scm.com/docs/git-credential.
+package credential
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+var (
+	// ErrMalformedCredential is returned when a credential description can't
+	// be parsed.
+	ErrMalformedCredential = errors.New("malformed credential")
+)
+
+// Credential is the description of a credential as exchanged with the
+// helpers, a set of attributes written as `key=value` lines.
+type Credential struct {
+	// Protocol is the protocol of the remote, like "https".
+	Protocol string
+	// Host is the remote hostname, including the port if any.
+	Host string
+	// Path is the path of the repository in the remote, only used if the
+	// helpers are configured to use it.
+	Path     string
+	Username string
+	Password string
+	// Quit is set by a helper to stop the lookup in the remaining helpers.
+	Quit bool
+}
+
+// NewCredential returns a credential description for the given URL.
+func NewCredential(u *url.URL) *Credential {
+	c := &Credential{
+		Protocol: u.Scheme,
+		Host:     u.Host,
+		Path:     strings.TrimPrefix(u.Path, "/"),
+	}
+
+	if u.User != nil {
+		c.Username = u.User.Username()
+		c.Password, _ = u.User.Password()
+	}
+
+	return c
+}
+
+// URL returns the URL described by the credential, with the user info.
+func (c *Credential) URL() *url.URL {
+	u := &url.URL{Scheme: c.Protocol, Host: c.Host}
+	if c.Path != "" {
+		u.Path = "/" + c.Path
+	}
+
+	switch {
+	case c.Password != "":
+		u.User = url.UserPassword(c.Username, c.Password)
+	case c.Username != "":
+		u.User = url.User(c.Username)
+	}
+
+	return u
+}
+
+// IsComplete returns true if the credential has both username and password.
+func (c *Credential) IsComplete() bool {
+	return c.Username != "" && c.Password != ""
+}
+
+// Match returns true if the credential is described by pattern, the
+// attributes not set in the pattern match any value.
+func (c *Credential) Match(pattern *Credential) bool {
+	return matchAttribute(pattern.Protocol, c.Protocol) &&
+		matchAttribute(pattern.Host, c.Host) &&
+		matchAttribute(pattern.Username, c.Username) &&
+		(pattern.Path == "" || c.Path == pattern.Path ||
+			strings.HasPrefix(c.Path, strings.TrimSuffix(pattern.Path, "/")+"/"))
+}
+
+func matchAttribute(pattern, value string) bool {
+	return pattern == "" || pattern == value
+}
+
+// Merge sets the attributes of o not empty into c.
+func (c *Credential) Merge(o *Credential) {
+	for _, v := range []struct{ dst, src *string }{
+		{&c.Protocol, &o.Protocol},
+		{&c.Host, &o.Host},
+		{&c.Path, &o.Path},
+		{&c.Username, &o.Username},
+		{&c.Password, &o.Password},
+	} {
+		if *v.src != "" {
+			*v.dst = *v.src
+		}
+	}
+
+	c.Quit = c.Quit || o.Quit
+}
+
+// Encode writes the credential description into w, ending with a blank
+// line.
+func (c *Credential) Encode(w io.Writer) error {
+	for _, attr := range []struct{ key, value string }{
+		{"protocol", c.Protocol},
+		{"host", c.Host},
+		{"path", c.Path},
+		{"username", c.Username},
+		{"password", c.Password},
+	} {
+		if attr.value == "" {
+			continue
+		}
+
+		if strings.ContainsAny(attr.value, "\n\x00") {
+			return ErrMalformedCredential
+		}
+
+		if _, err := fmt.Fprintf(w, "%s=%s\n", attr.key, attr.value); err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprint(w, "\n")
+	return err
+}
+
+// Decode reads a credential description from r, until a blank line or the
+// end of the input. Unknown attributes are ignored.
+func (c *Credential) Decode(r io.Reader) error {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		if line == "" {
+			break
+		}
+
+		i := strings.IndexByte(line, '=')
+		if i < 0 {
+			return ErrMalformedCredential
+		}
+
+		key, value := line[:i], line[i+1:]
+		switch key {
+		case "protocol":
+			c.Protocol = value
+		case "host":
+			c.Host = value
+		case "path":
+			c.Path = value
+		case "username":
+			c.Username = value
+		case "password":
+			c.Password = value
+		case "url":
+			u, err := url.Parse(value)
+			if err != nil {
+				return ErrMalformedCredential
+			}
+
+			c.Merge(NewCredential(u))
+		case "quit":
+			c.Quit = value == "1" || value == "true"
+		}
+	}
+
+	return s.Err()
+}
@@ -0,0 +1,142 @@
+package credential
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Helper is a credential helper, able to retrieve, save and remove
+// credentials.
+type Helper interface {
+	// Get returns the credential matching the description c, the returned
+	// credential may be partial or empty if the helper doesn't know it.
+	Get(c *Credential) (*Credential, error)
+	// Store saves the credential c, that has been used successfully.
+	Store(c *Credential) error
+	// Erase removes the credentials matching c, that has been rejected.
+	Erase(c *Credential) error
+}
+
+// Helpers is an ordered list of helpers, used the same way git uses the
+// helpers configured under credential.helper.
+type Helpers []Helper
+
+// Fill completes the description c asking the helpers in order until the
+// credential has username and password or a helper requests to quit. It
+// returns false if the credential couldn't be completed.
+func (hs Helpers) Fill(c *Credential) (bool, error) {
+	for _, h := range hs {
+		if c.IsComplete() {
+			break
+		}
+
+		found, err := h.Get(c)
+		if err != nil {
+			return false, err
+		}
+
+		if found != nil {
+			c.Merge(found)
+		}
+
+		if c.Quit {
+			break
+		}
+	}
+
+	return c.IsComplete(), nil
+}
+
+// Approve asks all the helpers to store the credential c.
+func (hs Helpers) Approve(c *Credential) error {
+	for _, h := range hs {
+		if err := h.Store(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Reject asks all the helpers to erase the credential c.
+func (hs Helpers) Reject(c *Credential) error {
+	for _, h := range hs {
+		if err := h.Erase(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ExecHelper is a helper implemented by an external program, which talks the
+// credential helper protocol through its standard input and output.
+type ExecHelper struct {
+	// Command is the shell command running the helper, the action (get,
+	// store or erase) is appended as last argument.
+	Command string
+}
+
+// NewExecHelper returns a helper for the given credential.helper value: a
+// shell snippet if it starts with "!", an absolute path, or the name of a
+// `git credential-<name>` helper, followed by its arguments.
+func NewExecHelper(helper string) *ExecHelper {
+	switch {
+	case strings.HasPrefix(helper, "!"):
+		return &ExecHelper{Command: helper[1:]}
+	case strings.HasPrefix(helper, "/"):
+		return &ExecHelper{Command: helper}
+	default:
+		return &ExecHelper{Command: "git credential-" + helper}
+	}
+}
+
+// Get runs the helper with the get action.
+func (h *ExecHelper) Get(c *Credential) (*Credential, error) {
+	out, err := h.run("get", c)
+	if err != nil {
+		return nil, err
+	}
+
+	found := &Credential{}
+	if err := found.Decode(bytes.NewReader(out)); err != nil {
+		return nil, err
+	}
+
+	return found, nil
+}
+
+// Store runs the helper with the store action.
+func (h *ExecHelper) Store(c *Credential) error {
+	_, err := h.run("store", c)
+	return err
+}
+
+// Erase runs the helper with the erase action.
+func (h *ExecHelper) Erase(c *Credential) error {
+	_, err := h.run("erase", c)
+	return err
+}
+
+func (h *ExecHelper) run(action string, c *Credential) ([]byte, error) {
+	in := bytes.NewBuffer(nil)
+	if err := c.Encode(in); err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command("sh", "-c", h.Command+" "+action)
+	cmd.Stdin = in
+
+	stderr := bytes.NewBuffer(nil)
+	cmd.Stderr = stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("credential helper %q failed: %s: %s",
+			h.Command, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return out, nil
+}
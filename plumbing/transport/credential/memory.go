@@ -0,0 +1,103 @@
+package credential
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultCacheTimeout is the time the credentials are kept by a MemoryHelper,
+// the same as the default of `git credential-cache`.
+const DefaultCacheTimeout = 15 * time.Minute
+
+// MemoryHelper is a helper keeping the credentials in memory for a limited
+// time, similar to `git credential-cache` but without a daemon.
+type MemoryHelper struct {
+	// Timeout is the time a credential is kept since it was stored.
+	Timeout time.Duration
+
+	m       sync.Mutex
+	entries []memoryEntry
+}
+
+type memoryEntry struct {
+	c       Credential
+	expires time.Time
+}
+
+// NewMemoryHelper returns a new empty MemoryHelper with the given timeout.
+func NewMemoryHelper(timeout time.Duration) *MemoryHelper {
+	return &MemoryHelper{Timeout: timeout}
+}
+
+// Get returns the first credential stored matching c.
+func (h *MemoryHelper) Get(c *Credential) (*Credential, error) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	h.expire()
+	for _, e := range h.entries {
+		if e.c.Match(c) {
+			found := e.c
+			return &found, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Store saves the credential c, replacing any credential for the same
+// remote and username.
+func (h *MemoryHelper) Store(c *Credential) error {
+	if !c.IsComplete() {
+		return nil
+	}
+
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	h.remove(&Credential{
+		Protocol: c.Protocol,
+		Host:     c.Host,
+		Path:     c.Path,
+		Username: c.Username,
+	})
+
+	h.entries = append([]memoryEntry{{
+		c:       *c,
+		expires: time.Now().Add(h.Timeout),
+	}}, h.entries...)
+
+	return nil
+}
+
+// Erase removes all the credentials matching c.
+func (h *MemoryHelper) Erase(c *Credential) error {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	h.remove(c)
+	return nil
+}
+
+func (h *MemoryHelper) remove(pattern *Credential) {
+	entries := h.entries[:0]
+	for _, e := range h.entries {
+		if !e.c.Match(pattern) {
+			entries = append(entries, e)
+		}
+	}
+
+	h.entries = entries
+}
+
+func (h *MemoryHelper) expire() {
+	now := time.Now()
+	entries := h.entries[:0]
+	for _, e := range h.entries {
+		if now.Before(e.expires) {
+			entries = append(entries, e)
+		}
+	}
+
+	h.entries = entries
+}
@@ -0,0 +1,785 @@
+package helper
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	stdioutil "io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/fastimport"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/internal/common"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+	"gopkg.in/src-d/go-git.v4/utils/ioutil"
+)
+
+// programPrefix is the prefix of the external remote helper programs, the
+// helper of a transport is git-remote-<transport>.
+const programPrefix = "git-remote-"
+
+// ErrExportHistoryMissing is returned when pushing with the export command
+// to a helper listing the hashes of the remote references, their history is
+// needed to export the changes of the pushed commits but it's only available
+// when the references are imported.
+var ErrExportHistoryMissing = errors.New("helper: export needs the imported history of the remote references")
+
+// DefaultClient is the default client running external remote helpers.
+var DefaultClient = NewExternalClient()
+
+// IsInstalled returns true if the external remote helper of the given
+// transport is available in the PATH.
+func IsInstalled(transport string) bool {
+	_, err := exec.LookPath(programPrefix + transport)
+	return err == nil
+}
+
+type externalClient struct{}
+
+// NewExternalClient returns a transport.Transport running the external
+// git-remote-<transport> program of the endpoint protocol.
+//
+// The helpers are run with GIT_DIR pointing to a temporary repository:
+// helpers with the fetch capability write there the fetched objects, and
+// helpers with the push capability find there the objects being pushed,
+// which are only the ones missing in the remote. Helpers with the connect
+// capability speak the pack protocol directly, so they support all its
+// features, shallow fetches included.
+func NewExternalClient() transport.Transport {
+	return &externalClient{}
+}
+
+func (c *externalClient) NewUploadPackSession(ep *transport.Endpoint, auth transport.AuthMethod) (
+	transport.UploadPackSession, error) {
+
+	p, cmd, err := startConnected(ep, transport.UploadPackServiceName)
+	if err != nil {
+		return nil, err
+	}
+
+	if cmd != nil {
+		return common.NewClient(cmd).NewUploadPackSession(ep, auth)
+	}
+
+	return &upSession{session{helper: p}}, nil
+}
+
+func (c *externalClient) NewReceivePackSession(ep *transport.Endpoint, auth transport.AuthMethod) (
+	transport.ReceivePackSession, error) {
+
+	p, cmd, err := startConnected(ep, transport.ReceivePackServiceName)
+	if err != nil {
+		return nil, err
+	}
+
+	if cmd != nil {
+		return common.NewClient(cmd).NewReceivePackSession(ep, auth)
+	}
+
+	return &rpSession{session{helper: p, forPush: true}}, nil
+}
+
+// startConnected starts the helper, connecting it to the given service if
+// it has the connect capability. The returned command is not nil if the
+// connection was established, otherwise the process is used as a Helper.
+func startConnected(ep *transport.Endpoint, service string) (*process, *connectedCommand, error) {
+	p, err := startProcess(ep)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if p.capabilities["connect"] {
+		cmd, err := p.connect(service)
+		if err != nil {
+			_ = p.Close()
+			return nil, nil, err
+		}
+
+		if cmd != nil {
+			return nil, cmd, nil
+		}
+	}
+
+	p.drainStderr()
+	return p, nil, nil
+}
+
+// process is a running external remote helper, it implements Helper
+// translating its methods into commands of the remote-helper protocol.
+type process struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	// stdoutCloser closes the pipe wrapped by stdout.
+	stdoutCloser io.Closer
+	stderr       *os.File
+	gitDir       string
+
+	capabilities map[string]bool
+	refspecs     []config.RefSpec
+
+	// refs are the references returned by the last list.
+	refs []*plumbing.Reference
+	// imported holds the objects imported while listing, when the helper
+	// can't tell the hashes of the references.
+	imported *memory.Storage
+
+	mu     sync.Mutex
+	errBuf bytes.Buffer
+	// stderrDone is closed when the stderr is drained.
+	stderrDone chan struct{}
+	closed     bool
+}
+
+func startProcess(ep *transport.Endpoint) (p *process, err error) {
+	bin, err := exec.LookPath(programPrefix + ep.Protocol)
+	if err != nil {
+		return nil, fmt.Errorf("helper: remote helper for %q not found", ep.Protocol)
+	}
+
+	gitDir, err := initGitDir()
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = os.RemoveAll(gitDir)
+		}
+	}()
+
+	url := ep.String()
+	if ep.RemoteHelper {
+		url = ep.Path
+	}
+
+	p = &process{
+		cmd:          exec.Command(bin, url, url),
+		gitDir:       gitDir,
+		capabilities: make(map[string]bool),
+	}
+
+	p.cmd.Env = append(os.Environ(), "GIT_DIR="+gitDir)
+	if p.stdin, err = p.cmd.StdinPipe(); err != nil {
+		return nil, err
+	}
+
+	stdout, err := p.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	p.stdout = bufio.NewReader(stdout)
+	p.stdoutCloser = stdout
+
+	// the stderr is an OS pipe, so the helper doesn't block writing to it
+	// before knowing who reads it
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+
+	p.stderr = r
+	p.cmd.Stderr = w
+	err = p.cmd.Start()
+	_ = w.Close()
+	if err != nil {
+		_ = r.Close()
+		return nil, err
+	}
+
+	if err := p.readCapabilities(); err != nil {
+		_ = p.Close()
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// initGitDir creates the temporary repository given to the helper.
+func initGitDir() (string, error) {
+	dir, err := stdioutil.TempDir("", "go-git-remote-helper")
+	if err != nil {
+		return "", err
+	}
+
+	sto := filesystem.NewStorage(osfs.New(dir), cache.NewObjectLRUDefault())
+	if err := sto.Init(); err != nil {
+		return "", err
+	}
+
+	return dir, sto.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.Master))
+}
+
+func (p *process) storage() *filesystem.Storage {
+	return filesystem.NewStorage(osfs.New(p.gitDir), cache.NewObjectLRUDefault())
+}
+
+func (p *process) readCapabilities() error {
+	if err := p.writeLine("capabilities"); err != nil {
+		return err
+	}
+
+	return p.readBlock(func(line string) error {
+		mandatory := strings.HasPrefix(line, "*")
+		line = strings.TrimPrefix(line, "*")
+
+		name, value := splitLine(line)
+		switch name {
+		case "refspec":
+			rs := config.RefSpec(value)
+			if err := rs.Validate(); err != nil {
+				return err
+			}
+
+			p.refspecs = append(p.refspecs, rs)
+		case "fetch", "push", "import", "export", "connect", "option",
+			"check-connectivity", "no-private-update", "signed-tags",
+			"import-marks", "export-marks":
+		default:
+			if mandatory {
+				return fmt.Errorf("helper: unsupported mandatory capability %q", name)
+			}
+		}
+
+		p.capabilities[name] = true
+		return nil
+	})
+}
+
+// connect asks the helper to connect to the given service, a nil command is
+// returned if the helper falls back to the other commands.
+func (p *process) connect(service string) (*connectedCommand, error) {
+	if err := p.writeLine("connect " + service); err != nil {
+		return nil, err
+	}
+
+	line, err := p.readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	switch line {
+	case "":
+		return &connectedCommand{p: p}, nil
+	case "fallback":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("helper: unexpected reply to connect: %q", line)
+	}
+}
+
+// List implements Helper running the list command. If the helper doesn't
+// know the hashes of the references, they are imported to find them out.
+func (p *process) List(ctx context.Context, forPush bool) ([]*plumbing.Reference, error) {
+	cmd := "list"
+	if forPush && (p.capabilities["push"] || p.capabilities["export"]) {
+		cmd = "list for-push"
+	}
+
+	if err := p.writeLine(cmd); err != nil {
+		return nil, err
+	}
+
+	var refs []*plumbing.Reference
+	var unknown []plumbing.ReferenceName
+	err := p.readBlock(func(line string) error {
+		// the lines starting with ':' are attributes of the list
+		if strings.HasPrefix(line, ":") {
+			return nil
+		}
+
+		value, name := splitLine(line)
+		if i := strings.Index(name, " "); i != -1 {
+			name = name[:i]
+		}
+
+		n := plumbing.ReferenceName(name)
+		switch {
+		case value == "?":
+			unknown = append(unknown, n)
+		case strings.HasPrefix(value, "@"):
+			refs = append(refs, plumbing.NewSymbolicReference(n, plumbing.ReferenceName(value[1:])))
+		case plumbing.IsHash(value):
+			refs = append(refs, plumbing.NewHashReference(n, plumbing.NewHash(value)))
+		default:
+			return fmt.Errorf("helper: malformed list line: %q", line)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(unknown) != 0 {
+		imported, err := p.importReferences(unknown)
+		if err != nil {
+			return nil, err
+		}
+
+		refs = append(refs, imported...)
+	}
+
+	p.refs = refs
+	return refs, nil
+}
+
+// importReferences runs the import command for the given references, and
+// returns them with the hashes of the imported commits.
+func (p *process) importReferences(names []plumbing.ReferenceName) ([]*plumbing.Reference, error) {
+	if !p.capabilities["import"] {
+		return nil, fmt.Errorf("helper: unknown hash of reference %q", names[0])
+	}
+
+	for _, n := range names {
+		if err := p.writeLine("import " + n.String()); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.writeLine(""); err != nil {
+		return nil, err
+	}
+
+	p.imported = memory.NewStorage()
+	err := fastimport.NewImporter(p.imported, p.imported, nil).Import(p.stdout)
+	if err != nil {
+		return nil, p.wrapError(err)
+	}
+
+	var refs []*plumbing.Reference
+	for _, n := range names {
+		ref, err := p.imported.Reference(p.privateName(n))
+		if err != nil {
+			return nil, fmt.Errorf("helper: reference %q not imported", n)
+		}
+
+		refs = append(refs, plumbing.NewHashReference(n, ref.Hash()))
+	}
+
+	return refs, nil
+}
+
+// privateName returns the name under which the helper imports the given
+// reference, according to its refspecs.
+func (p *process) privateName(n plumbing.ReferenceName) plumbing.ReferenceName {
+	for _, rs := range p.refspecs {
+		if rs.Match(n) {
+			return rs.Dst(n)
+		}
+	}
+
+	return n
+}
+
+// Fetch implements Helper, the objects are the ones imported while listing,
+// or the ones written by the fetch command into the temporary repository.
+func (p *process) Fetch(ctx context.Context, sto storer.EncodedObjectStorer, wants, haves []plumbing.Hash) error {
+	fetched, err := p.fetchStorage(ctx, wants)
+	if err != nil {
+		return err
+	}
+
+	return copyObjects(sto, fetched)
+}
+
+// fetchStorage returns the storage with the fetched objects, the one of the
+// imported objects or the temporary repository.
+func (p *process) fetchStorage(ctx context.Context, wants []plumbing.Hash) (storer.EncodedObjectStorer, error) {
+	if p.imported != nil {
+		return p.imported, nil
+	}
+
+	if !p.capabilities["fetch"] {
+		return nil, ErrFetchNotSupported
+	}
+
+	wanted := make(map[plumbing.Hash]bool)
+	for _, h := range wants {
+		wanted[h] = true
+	}
+
+	for _, ref := range p.refs {
+		if ref.Type() != plumbing.HashReference || !wanted[ref.Hash()] {
+			continue
+		}
+
+		delete(wanted, ref.Hash())
+		if err := p.writeLine(fmt.Sprintf("fetch %s %s", ref.Hash(), ref.Name())); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.writeLine(""); err != nil {
+		return nil, err
+	}
+
+	// the helper may reply with lock and connectivity-ok lines
+	if err := p.readBlock(func(string) error { return nil }); err != nil {
+		return nil, err
+	}
+
+	return p.storage(), nil
+}
+
+// Push implements Helper running the push command, or the export command
+// with a fast-import stream of the pushed references.
+func (p *process) Push(ctx context.Context, sto storer.EncodedObjectStorer, cmds []*PushCommand) ([]error, error) {
+	switch {
+	case p.capabilities["push"]:
+		return p.push(sto, cmds)
+	case p.capabilities["export"]:
+		return p.export(sto, cmds)
+	default:
+		return nil, ErrPushNotSupported
+	}
+}
+
+func (p *process) push(sto storer.EncodedObjectStorer, cmds []*PushCommand) ([]error, error) {
+	if err := p.writeObjects(sto); err != nil {
+		return nil, err
+	}
+
+	for _, c := range cmds {
+		// the client has already checked if the update is a fast-forward
+		src := "+" + c.New.String()
+		if c.New.IsZero() {
+			src = ""
+		}
+
+		if err := p.writeLine(fmt.Sprintf("push %s:%s", src, c.Name)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.writeLine(""); err != nil {
+		return nil, err
+	}
+
+	return p.readPushStatus(cmds)
+}
+
+// writeObjects writes the objects of sto as a packfile of the temporary
+// repository.
+func (p *process) writeObjects(sto storer.EncodedObjectStorer) (err error) {
+	hashes, err := objectHashes(sto)
+	if err != nil || len(hashes) == 0 {
+		return err
+	}
+
+	w, err := p.storage().PackfileWriter()
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(w, &err)
+	_, err = packfile.NewEncoder(w, sto, false).Encode(hashes, 0)
+	return err
+}
+
+func (p *process) export(sto storer.EncodedObjectStorer, cmds []*PushCommand) ([]error, error) {
+	errs := make([]error, len(cmds))
+	var refs []*plumbing.Reference
+	for i, c := range cmds {
+		if c.New.IsZero() {
+			errs[i] = fmt.Errorf("deleting references is not supported by export")
+			continue
+		}
+
+		refs = append(refs, plumbing.NewHashReference(c.Name, c.New))
+	}
+
+	if len(refs) == 0 {
+		return errs, nil
+	}
+
+	// the history of the remote is needed to compute the changes of the
+	// pushed commits, it's available if the references were imported
+	if p.imported != nil {
+		if err := copyObjects(sto, p.imported); err != nil {
+			return nil, err
+		}
+	} else if err := checkExportHistory(sto, p.refs); err != nil {
+		return nil, err
+	}
+
+	if err := p.writeLine("export"); err != nil {
+		return nil, err
+	}
+
+	w := bufio.NewWriter(p.stdin)
+	e := fastimport.NewExporter(w, sto, nil)
+	for _, ref := range p.refs {
+		if ref.Type() == plumbing.HashReference {
+			e.Exclude(ref.Hash())
+		}
+	}
+
+	if err := e.Export(refs...); err != nil {
+		return nil, err
+	}
+
+	if err := fastimport.NewEncoder(w).Encode(&fastimport.Done{}); err != nil {
+		return nil, err
+	}
+
+	if err := w.Flush(); err != nil {
+		return nil, p.wrapError(err)
+	}
+
+	status, err := p.readPushStatus(cmds)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range errs {
+		if errs[i] == nil {
+			errs[i] = status[i]
+		}
+	}
+
+	return errs, nil
+}
+
+// checkExportHistory returns ErrExportHistoryMissing if the commits of the
+// listed references aren't in sto, which only has the pushed objects when the
+// helper listed the hashes instead of importing the references.
+func checkExportHistory(sto storer.EncodedObjectStorer, refs []*plumbing.Reference) error {
+	for _, ref := range refs {
+		if ref.Type() != plumbing.HashReference {
+			continue
+		}
+
+		_, err := sto.EncodedObject(plumbing.AnyObject, ref.Hash())
+		if err == plumbing.ErrObjectNotFound {
+			return ErrExportHistoryMissing
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readPushStatus reads the "ok <ref>" and "error <ref> <why>" lines replied
+// to a push or an export.
+func (p *process) readPushStatus(cmds []*PushCommand) ([]error, error) {
+	status := make(map[plumbing.ReferenceName]error)
+	err := p.readBlock(func(line string) error {
+		result, rest := splitLine(line)
+		name, why := splitLine(rest)
+		switch result {
+		case "ok":
+			status[plumbing.ReferenceName(name)] = nil
+		case "error":
+			if why == "" {
+				why = "rejected by the remote helper"
+			}
+
+			status[plumbing.ReferenceName(name)] = fmt.Errorf("%s", why)
+		default:
+			return fmt.Errorf("helper: malformed push status: %q", line)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	errs := make([]error, len(cmds))
+	for i, c := range cmds {
+		err, ok := status[c.Name]
+		if !ok {
+			err = fmt.Errorf("no status reported by the remote helper")
+		}
+
+		errs[i] = err
+	}
+
+	return errs, nil
+}
+
+func (p *process) writeLine(line string) error {
+	if _, err := io.WriteString(p.stdin, line+"\n"); err != nil {
+		return p.wrapError(err)
+	}
+
+	return nil
+}
+
+func (p *process) readLine() (string, error) {
+	line, err := p.stdout.ReadString('\n')
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+
+		return "", p.wrapError(err)
+	}
+
+	return strings.TrimSuffix(line, "\n"), nil
+}
+
+// readBlock calls fn with each line until a blank one.
+func (p *process) readBlock(fn func(line string) error) error {
+	for {
+		line, err := p.readLine()
+		if err != nil {
+			return err
+		}
+
+		if line == "" {
+			return nil
+		}
+
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+}
+
+// drainStderr keeps the last output of the helper to report it with the
+// errors.
+func (p *process) drainStderr() {
+	p.stderrDone = make(chan struct{})
+	go func() {
+		defer close(p.stderrDone)
+		s := bufio.NewScanner(p.stderr)
+		for s.Scan() {
+			p.mu.Lock()
+			p.errBuf.Reset()
+			p.errBuf.WriteString(s.Text())
+			p.mu.Unlock()
+		}
+	}()
+}
+
+func (p *process) wrapError(err error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.errBuf.Len() == 0 {
+		return fmt.Errorf("helper: %s", err)
+	}
+
+	return fmt.Errorf("helper: %s: %s", err, p.errBuf.String())
+}
+
+// Close ends the conversation with the helper, waits for it to exit and
+// removes the temporary repository.
+func (p *process) Close() error {
+	if p.closed {
+		return nil
+	}
+
+	p.closed = true
+	defer os.RemoveAll(p.gitDir)
+
+	// a blank line ends the conversation
+	_, _ = io.WriteString(p.stdin, "\n")
+	_ = p.stdin.Close()
+
+	if err := p.wait(); err != nil {
+		return p.wrapError(err)
+	}
+
+	return nil
+}
+
+// wait waits for the helper to exit and for its stderr to be drained.
+func (p *process) wait() error {
+	err := p.cmd.Wait()
+	if p.stderrDone != nil {
+		<-p.stderrDone
+	}
+
+	_ = p.stderr.Close()
+	return err
+}
+
+// connectedCommand is a helper connected to a service, it implements
+// common.Commander and common.Command so the pack protocol is used through
+// it.
+type connectedCommand struct {
+	p *process
+}
+
+func (c *connectedCommand) Command(string, *transport.Endpoint, transport.AuthMethod) (common.Command, error) {
+	return c, nil
+}
+
+func (c *connectedCommand) StderrPipe() (io.Reader, error) {
+	return c.p.stderr, nil
+}
+
+func (c *connectedCommand) StdinPipe() (io.WriteCloser, error) {
+	return c.p.stdin, nil
+}
+
+func (c *connectedCommand) StdoutPipe() (io.Reader, error) {
+	return c.p.stdout, nil
+}
+
+// Start does nothing, the helper is already running.
+func (c *connectedCommand) Start() error {
+	return nil
+}
+
+// Close waits for the helper to exit, the output not read is discarded.
+func (c *connectedCommand) Close() error {
+	if c.p.closed {
+		return nil
+	}
+
+	c.p.closed = true
+	defer os.RemoveAll(c.p.gitDir)
+
+	_ = c.p.stdin.Close()
+	_ = c.p.stdoutCloser.Close()
+
+	// a helper killed writing the discarded output didn't fail
+	if err := c.p.wait(); err != nil && !isBrokenPipe(err) {
+		return c.p.wrapError(err)
+	}
+
+	return nil
+}
+
+func isBrokenPipe(err error) bool {
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		return false
+	}
+
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	return ok && status.Signaled() && status.Signal() == syscall.SIGPIPE
+}
+
+func splitLine(line string) (string, string) {
+	i := strings.Index(line, " ")
+	if i == -1 {
+		return line, ""
+	}
+
+	return line[:i], line[i+1:]
+}
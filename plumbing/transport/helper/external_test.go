@@ -0,0 +1,362 @@
+package helper
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp/capability"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	"gopkg.in/src-d/go-git-fixtures.v3"
+)
+
+// testconnect connects to the git services of the repository.
+const connectHelper = `#!/bin/sh
+while read cmd arg; do
+	case "$cmd" in
+	capabilities) printf 'connect\n\n' ;;
+	connect) printf '\n'; exec git "${arg#git-}" "$2" ;;
+	*) exit 0 ;;
+	esac
+done
+`
+
+// testfetch copies the packfiles between the repository and GIT_DIR.
+const fetchHelper = `#!/bin/sh
+repo="$2"
+while read cmd arg; do
+	case "$cmd" in
+	capabilities) printf 'fetch\npush\n\n' ;;
+	list)
+		git --git-dir="$repo" for-each-ref --format='%(objectname) %(refname)'
+		echo "@$(git --git-dir="$repo" symbolic-ref HEAD) HEAD"
+		echo ;;
+	fetch)
+		while read line && [ -n "$line" ]; do :; done
+		git --git-dir="$repo" pack-objects --revs --all --stdout </dev/null | git index-pack --stdin >/dev/null
+		echo ;;
+	push)
+		status=""
+		while [ -n "$cmd" ]; do
+			src="${arg%%:*}"; src="${src#+}"; dst="${arg#*:}"
+			cp "$GIT_DIR"/objects/pack/* "$repo/objects/pack/" 2>/dev/null
+			if [ -z "$src" ]; then
+				git --git-dir="$repo" update-ref -d "$dst"
+			else
+				git --git-dir="$repo" update-ref "$dst" "$src"
+			fi
+			status="${status}ok $dst\n"
+			read cmd arg
+		done
+		printf "${status}\n" ;;
+	*) exit 0 ;;
+	esac
+done
+`
+
+// testimport imports and exports the branches of the repository using git
+// fast-export and git fast-import.
+const importHelper = `#!/bin/sh
+repo="$2"
+while read cmd arg; do
+	case "$cmd" in
+	capabilities) printf 'import\nexport\nrefspec refs/heads/*:refs/testimport/heads/*\n\n' ;;
+	list)
+		git --git-dir="$repo" for-each-ref --format='? %(refname)' refs/heads
+		echo "@$(git --git-dir="$repo" symbolic-ref HEAD) HEAD"
+		echo ;;
+	import)
+		refs="$arg"
+		while read cmd arg && [ -n "$cmd" ]; do refs="$refs $arg"; done
+		git --git-dir="$repo" fast-export --use-done-feature \
+			--refspec 'refs/heads/*:refs/testimport/heads/*' $refs ;;
+	export)
+		sed '/^done$/q' > "$GIT_DIR/export"
+		git --git-dir="$repo" fast-import --force --quiet < "$GIT_DIR/export"
+		grep '^commit ' "$GIT_DIR/export" | cut -d' ' -f2 | sort -u | sed 's/^/ok /'
+		echo ;;
+	*) exit 0 ;;
+	esac
+done
+`
+
+// testfail lists a reference and fails when the conversation ends.
+const failHelper = `#!/bin/sh
+while read cmd arg; do
+	case "$cmd" in
+	capabilities) printf 'fetch\n\n' ;;
+	list) printf '6ecf0ef2c2dffb796033e5a02219af86ec6584e5 refs/heads/master\n\n' ;;
+	*) echo "fatal: remote failure" >&2; exit 1 ;;
+	esac
+done
+`
+
+// testexport lists the hashes of the branches and exports to them.
+const exportHelper = `#!/bin/sh
+repo="$2"
+while read cmd arg; do
+	case "$cmd" in
+	capabilities) printf 'export\n\n' ;;
+	list)
+		git --git-dir="$repo" for-each-ref --format='%(objectname) %(refname)' refs/heads
+		echo ;;
+	export)
+		git --git-dir="$repo" fast-import --force --quiet
+		echo ;;
+	*) exit 0 ;;
+	esac
+done
+`
+
+type ExternalSuite struct {
+	fixtures.Suite
+
+	path string
+}
+
+var _ = Suite(&ExternalSuite{})
+
+func (s *ExternalSuite) SetUpSuite(c *C) {
+	if runtime.GOOS == "windows" {
+		c.Skip("remote helpers are shell scripts")
+	}
+
+	if _, err := exec.LookPath("git"); err != nil {
+		c.Skip("git command not found")
+	}
+
+	s.Suite.SetUpSuite(c)
+
+	bin := c.MkDir()
+	for name, script := range map[string]string{
+		"testconnect": connectHelper,
+		"testfetch":   fetchHelper,
+		"testimport":  importHelper,
+		"testfail":    failHelper,
+		"testexport":  exportHelper,
+	} {
+		path := filepath.Join(bin, programPrefix+name)
+		c.Assert(ioutil.WriteFile(path, []byte(script), 0755), IsNil)
+	}
+
+	s.path = os.Getenv("PATH")
+	c.Assert(os.Setenv("PATH", bin+string(filepath.ListSeparator)+s.path), IsNil)
+}
+
+func (s *ExternalSuite) TearDownSuite(c *C) {
+	c.Assert(os.Setenv("PATH", s.path), IsNil)
+	s.Suite.TearDownSuite(c)
+}
+
+func (s *ExternalSuite) prepareRepository(c *C) string {
+	fs := fixtures.Basic().One().DotGit()
+	c.Assert(fixtures.EnsureIsBare(fs), IsNil)
+	return fs.Root()
+}
+
+func (s *ExternalSuite) newEndpoint(c *C, helper, path string) *transport.Endpoint {
+	ep, err := transport.NewEndpoint(helper + "::" + path)
+	c.Assert(err, IsNil)
+	c.Assert(ep.RemoteHelper, Equals, true)
+
+	return ep
+}
+
+func (s *ExternalSuite) TestIsInstalled(c *C) {
+	c.Assert(IsInstalled("testfetch"), Equals, true)
+	c.Assert(IsInstalled("foo"), Equals, false)
+}
+
+func (s *ExternalSuite) TestNotInstalled(c *C) {
+	_, err := DefaultClient.NewUploadPackSession(s.newEndpoint(c, "foo", "/tmp/foo"), nil)
+	c.Assert(err, ErrorMatches, `helper: remote helper for "foo" not found`)
+}
+
+func (s *ExternalSuite) TestConnectAdvertisedReferences(c *C) {
+	s.testAdvertisedReferences(c, "testconnect")
+}
+
+func (s *ExternalSuite) TestConnectUploadPack(c *C) {
+	s.testUploadPack(c, "testconnect")
+}
+
+func (s *ExternalSuite) TestConnectUploadPackShallow(c *C) {
+	ep := s.newEndpoint(c, "testconnect", s.prepareRepository(c))
+	r, err := DefaultClient.NewUploadPackSession(ep, nil)
+	c.Assert(err, IsNil)
+	defer func() { c.Assert(r.Close(), IsNil) }()
+
+	_, err = r.AdvertisedReferences()
+	c.Assert(err, IsNil)
+
+	req := packp.NewUploadPackRequest()
+	req.Wants = []plumbing.Hash{plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")}
+	req.Depth = packp.DepthCommits(1)
+	c.Assert(req.Capabilities.Set(capability.Shallow), IsNil)
+
+	resp, err := r.UploadPack(context.Background(), req)
+	c.Assert(err, IsNil)
+	c.Assert(resp.Close(), IsNil)
+	c.Assert(resp.Shallows, HasLen, 1)
+}
+
+func (s *ExternalSuite) TestConnectReceivePack(c *C) {
+	s.testReceivePack(c, "testconnect")
+}
+
+func (s *ExternalSuite) TestCloseFailure(c *C) {
+	ep := s.newEndpoint(c, "testfail", s.prepareRepository(c))
+	r, err := DefaultClient.NewUploadPackSession(ep, nil)
+	c.Assert(err, IsNil)
+
+	_, err = r.AdvertisedReferences()
+	c.Assert(err, IsNil)
+
+	err = r.Close()
+	c.Assert(err, ErrorMatches, "helper: exit status 1: fatal: remote failure")
+}
+
+func (s *ExternalSuite) TestFetchAdvertisedReferences(c *C) {
+	s.testAdvertisedReferences(c, "testfetch")
+}
+
+func (s *ExternalSuite) TestFetchUploadPack(c *C) {
+	s.testUploadPack(c, "testfetch")
+}
+
+func (s *ExternalSuite) TestFetchUploadPackShallow(c *C) {
+	ep := s.newEndpoint(c, "testfetch", s.prepareRepository(c))
+	r, err := DefaultClient.NewUploadPackSession(ep, nil)
+	c.Assert(err, IsNil)
+	defer func() { c.Assert(r.Close(), IsNil) }()
+
+	req := packp.NewUploadPackRequest()
+	req.Wants = []plumbing.Hash{plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")}
+	req.Depth = packp.DepthCommits(1)
+
+	_, err = r.UploadPack(context.Background(), req)
+	c.Assert(err, Equals, ErrShallowNotSupported)
+}
+
+func (s *ExternalSuite) TestFetchReceivePack(c *C) {
+	s.testReceivePack(c, "testfetch")
+}
+
+func (s *ExternalSuite) TestImportAdvertisedReferences(c *C) {
+	ep := s.newEndpoint(c, "testimport", s.prepareRepository(c))
+	r, err := DefaultClient.NewUploadPackSession(ep, nil)
+	c.Assert(err, IsNil)
+	defer func() { c.Assert(r.Close(), IsNil) }()
+
+	ar, err := r.AdvertisedReferences()
+	c.Assert(err, IsNil)
+	c.Assert(ar.Head.String(), Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	c.Assert(ar.References["refs/heads/master"].String(), Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	c.Assert(ar.References["refs/heads/branch"].String(), Equals, "e8d3ffab552895c19b9fcf7aa264d277cde33881")
+}
+
+func (s *ExternalSuite) TestImportUploadPack(c *C) {
+	s.testUploadPack(c, "testimport")
+}
+
+func (s *ExternalSuite) TestExportReceivePack(c *C) {
+	s.testReceivePack(c, "testimport")
+}
+
+func (s *ExternalSuite) TestExportReceivePackDelete(c *C) {
+	ep := s.newEndpoint(c, "testimport", s.prepareRepository(c))
+	rs := receivePack(c, DefaultClient, ep, nil, &packp.Command{
+		Name: "refs/heads/branch",
+		Old:  plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881"),
+	})
+
+	c.Assert(rs.Error(), ErrorMatches, ".*deleting references is not supported by export")
+}
+
+func (s *ExternalSuite) TestExportReceivePackListedHashes(c *C) {
+	ep := s.newEndpoint(c, "testexport", s.prepareRepository(c))
+	r, err := DefaultClient.NewReceivePackSession(ep, nil)
+	c.Assert(err, IsNil)
+	defer func() { c.Assert(r.Close(), IsNil) }()
+
+	ar, err := r.AdvertisedReferences()
+	c.Assert(err, IsNil)
+
+	master := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	commit := newCommit(c, master)
+
+	req := packp.NewReferenceUpdateRequestFromCapabilities(ar.Capabilities)
+	req.Commands = []*packp.Command{{Name: plumbing.Master, Old: master, New: commit.Hash()}}
+	req.Packfile = encodeObjects(c, commit)
+
+	_, err = r.ReceivePack(context.Background(), req)
+	c.Assert(err, Equals, ErrExportHistoryMissing)
+}
+
+func (s *ExternalSuite) testAdvertisedReferences(c *C, helper string) {
+	ep := s.newEndpoint(c, helper, s.prepareRepository(c))
+	r, err := DefaultClient.NewUploadPackSession(ep, nil)
+	c.Assert(err, IsNil)
+	defer func() { c.Assert(r.Close(), IsNil) }()
+
+	ar, err := r.AdvertisedReferences()
+	c.Assert(err, IsNil)
+	c.Assert(ar.Head.String(), Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	c.Assert(ar.References["refs/heads/branch"].String(), Equals, "e8d3ffab552895c19b9fcf7aa264d277cde33881")
+
+	refs, err := ar.AllReferences()
+	c.Assert(err, IsNil)
+	c.Assert(refs[plumbing.HEAD].Target(), Equals, plumbing.Master)
+}
+
+func (s *ExternalSuite) testUploadPack(c *C, helper string) {
+	ep := s.newEndpoint(c, helper, s.prepareRepository(c))
+	sto := uploadPack(c, DefaultClient, ep, plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+
+	commit, err := object.GetCommit(sto, plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	c.Assert(err, IsNil)
+	c.Assert(commit.Message, Equals, "vendor stuff\n")
+
+	files, err := commit.Files()
+	c.Assert(err, IsNil)
+
+	var count int
+	c.Assert(files.ForEach(func(*object.File) error {
+		count++
+		return nil
+	}), IsNil)
+	c.Assert(count, Equals, 9)
+}
+
+func (s *ExternalSuite) testReceivePack(c *C, helper string) {
+	path := s.prepareRepository(c)
+	ep := s.newEndpoint(c, helper, path)
+
+	master := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	commit := newCommit(c, master)
+
+	rs := receivePack(c, DefaultClient, ep, commit, &packp.Command{
+		Name: plumbing.Master, Old: master, New: commit.Hash(),
+	})
+	c.Assert(rs.Error(), IsNil)
+
+	sto := filesystem.NewStorage(osfs.New(path), cache.NewObjectLRUDefault())
+	ref, err := sto.Reference(plumbing.Master)
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash(), Equals, commit.Hash())
+
+	pushed, err := object.GetCommit(sto, commit.Hash())
+	c.Assert(err, IsNil)
+	c.Assert(pushed.Message, Equals, "helper\n")
+}
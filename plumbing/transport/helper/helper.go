@@ -0,0 +1,328 @@
+// Package helper implements the git remote-helper protocol, allowing to use
+// as transports both external git-remote-<transport> programs and remote
+// helpers written in Go, see https://git-scm.com/docs/gitremote-helpers.
+//
+// Remote helpers written in Go implement the Helper interface, and are
+// installed for a custom scheme with client.InstallProtocol:
+//
+//	client.InstallProtocol("s3", helper.NewClient(newS3Helper))
+//
+// External helpers are used for the schemes without an installed transport,
+// and for the URLs with the <transport>::<address> syntax.
+package helper
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp/capability"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+	"gopkg.in/src-d/go-git.v4/utils/ioutil"
+)
+
+var (
+	// ErrShallowNotSupported is returned when a shallow fetch is requested
+	// to a remote helper.
+	ErrShallowNotSupported = errors.New("helper: shallow fetch is not supported")
+	// ErrFetchNotSupported is returned when fetching from a remote helper
+	// without the fetch, import or connect capabilities.
+	ErrFetchNotSupported = errors.New("helper: fetch is not supported by the remote helper")
+	// ErrPushNotSupported is returned when pushing to a remote helper
+	// without the push, export or connect capabilities.
+	ErrPushNotSupported = errors.New("helper: push is not supported by the remote helper")
+)
+
+// Helper is a remote helper written in Go. Its methods mirror the commands of
+// the remote-helper protocol, so a helper only lists the references of the
+// remote and copies objects from and to it, without implementing the
+// negotiation of the pack protocol.
+type Helper interface {
+	// List returns the references of the remote, HEAD can be returned as a
+	// symbolic reference. forPush is true when the references are listed
+	// before a push.
+	List(ctx context.Context, forPush bool) ([]*plumbing.Reference, error)
+	// Fetch writes into sto the objects reachable from wants, which are
+	// hashes of references returned by List. haves are objects present in
+	// the client, the objects reachable from them can be skipped.
+	Fetch(ctx context.Context, sto storer.EncodedObjectStorer, wants, haves []plumbing.Hash) error
+	// Push updates the references of the remote, sto contains the objects
+	// missing in the remote. It returns for each command the error updating
+	// its reference, or nil if it was updated. The fast-forward checks are
+	// done by the client before pushing.
+	Push(ctx context.Context, sto storer.EncodedObjectStorer, cmds []*PushCommand) ([]error, error)
+}
+
+// PushCommand is the update of a remote reference requested by a push.
+type PushCommand struct {
+	// Name is the name of the remote reference.
+	Name plumbing.ReferenceName
+	// Old is the hash of the reference listed before the push, zero if the
+	// reference is being created.
+	Old plumbing.Hash
+	// New is the new hash of the reference, zero if it is being deleted.
+	New plumbing.Hash
+}
+
+// Factory returns the Helper serving the given endpoint.
+type Factory func(ep *transport.Endpoint) (Helper, error)
+
+type client struct {
+	factory Factory
+}
+
+// NewClient returns a transport.Transport using the helpers returned by the
+// given factory. If a helper implements io.Closer it is closed with the
+// session.
+func NewClient(f Factory) transport.Transport {
+	return &client{factory: f}
+}
+
+func (c *client) NewUploadPackSession(ep *transport.Endpoint, auth transport.AuthMethod) (
+	transport.UploadPackSession, error) {
+
+	h, err := c.factory(ep)
+	if err != nil {
+		return nil, err
+	}
+
+	return &upSession{session{helper: h}}, nil
+}
+
+func (c *client) NewReceivePackSession(ep *transport.Endpoint, auth transport.AuthMethod) (
+	transport.ReceivePackSession, error) {
+
+	h, err := c.factory(ep)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rpSession{session{helper: h, forPush: true}}, nil
+}
+
+type session struct {
+	helper  Helper
+	forPush bool
+	advRefs *packp.AdvRefs
+}
+
+// AdvertisedReferences returns the references listed by the helper.
+func (s *session) AdvertisedReferences() (*packp.AdvRefs, error) {
+	if s.advRefs != nil {
+		return s.advRefs, nil
+	}
+
+	refs, err := s.helper.List(context.Background(), s.forPush)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(refs) == 0 && !s.forPush {
+		return nil, transport.ErrEmptyRemoteRepository
+	}
+
+	ar, err := newAdvRefs(refs, s.forPush)
+	if err != nil {
+		return nil, err
+	}
+
+	s.advRefs = ar
+	return ar, nil
+}
+
+func newAdvRefs(refs []*plumbing.Reference, forPush bool) (*packp.AdvRefs, error) {
+	ar := packp.NewAdvRefs()
+	if err := ar.Capabilities.Set(capability.OFSDelta); err != nil {
+		return nil, err
+	}
+
+	if forPush {
+		for _, c := range []capability.Capability{capability.ReportStatus, capability.DeleteRefs} {
+			if err := ar.Capabilities.Add(c); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	hashes := make(map[plumbing.ReferenceName]plumbing.Hash)
+	for _, r := range refs {
+		if r.Type() == plumbing.HashReference {
+			hashes[r.Name()] = r.Hash()
+		}
+	}
+
+	for _, r := range refs {
+		if r.Name() != plumbing.HEAD {
+			if err := ar.AddReference(r); err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		h := r.Hash()
+		if r.Type() == plumbing.SymbolicReference {
+			var ok bool
+			if h, ok = hashes[r.Target()]; !ok {
+				continue
+			}
+
+			if err := ar.AddReference(r); err != nil {
+				return nil, err
+			}
+		}
+
+		ar.Head = &h
+	}
+
+	return ar, nil
+}
+
+// Close closes the helper if it implements io.Closer.
+func (s *session) Close() error {
+	if c, ok := s.helper.(io.Closer); ok {
+		return c.Close()
+	}
+
+	return nil
+}
+
+type upSession struct {
+	session
+}
+
+// UploadPack asks the helper to fetch the wanted objects, and returns a
+// packfile with all the objects written by it.
+func (s *upSession) UploadPack(ctx context.Context, req *packp.UploadPackRequest) (
+	*packp.UploadPackResponse, error) {
+
+	if req.IsEmpty() {
+		return nil, transport.ErrEmptyUploadPackRequest
+	}
+
+	if !req.Depth.IsZero() {
+		return nil, ErrShallowNotSupported
+	}
+
+	var sto storer.EncodedObjectStorer
+	if f, ok := s.helper.(storageFetcher); ok {
+		var err error
+		if sto, err = f.fetchStorage(ctx, req.Wants); err != nil {
+			return nil, err
+		}
+	} else {
+		mem := memory.NewStorage()
+		if err := s.helper.Fetch(ctx, mem, req.Wants, req.Haves); err != nil {
+			return nil, err
+		}
+
+		sto = mem
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(encodeAll(pw, sto))
+	}()
+
+	return packp.NewUploadPackResponseWithPackfile(req,
+		ioutil.NewContextReadCloser(ctx, pr),
+	), nil
+}
+
+// storageFetcher is implemented by the helpers fetching the objects into a
+// storage of their own, which is encoded without copying it to memory.
+type storageFetcher interface {
+	fetchStorage(ctx context.Context, wants []plumbing.Hash) (storer.EncodedObjectStorer, error)
+}
+
+type rpSession struct {
+	session
+}
+
+// ReceivePack decodes the packfile of the request and asks the helper to
+// update the references.
+func (s *rpSession) ReceivePack(ctx context.Context, req *packp.ReferenceUpdateRequest) (
+	*packp.ReportStatus, error) {
+
+	sto := memory.NewStorage()
+	if req.Packfile != nil {
+		err := packfile.UpdateObjectStorage(sto, req.Packfile)
+		if cerr := req.Packfile.Close(); err == nil {
+			err = cerr
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cmds := make([]*PushCommand, len(req.Commands))
+	for i, c := range req.Commands {
+		cmds[i] = &PushCommand{Name: c.Name, Old: c.Old, New: c.New}
+	}
+
+	errs, err := s.helper.Push(ctx, sto, cmds)
+	if err != nil {
+		return nil, err
+	}
+
+	rs := packp.NewReportStatus()
+	rs.UnpackStatus = "ok"
+	for i, c := range cmds {
+		status := "ok"
+		if i < len(errs) && errs[i] != nil {
+			status = errs[i].Error()
+		}
+
+		rs.CommandStatuses = append(rs.CommandStatuses, &packp.CommandStatus{
+			ReferenceName: c.Name,
+			Status:        status,
+		})
+	}
+
+	return rs, nil
+}
+
+// encodeAll writes into w a packfile with all the objects of sto.
+func encodeAll(w io.Writer, sto storer.EncodedObjectStorer) error {
+	hashes, err := objectHashes(sto)
+	if err != nil {
+		return err
+	}
+
+	_, err = packfile.NewEncoder(w, sto, false).Encode(hashes, 0)
+	return err
+}
+
+func objectHashes(sto storer.EncodedObjectStorer) ([]plumbing.Hash, error) {
+	iter, err := sto.IterEncodedObjects(plumbing.AnyObject)
+	if err != nil {
+		return nil, err
+	}
+
+	var hashes []plumbing.Hash
+	err = iter.ForEach(func(o plumbing.EncodedObject) error {
+		hashes = append(hashes, o.Hash())
+		return nil
+	})
+
+	return hashes, err
+}
+
+// copyObjects writes into dst all the objects of src.
+func copyObjects(dst, src storer.EncodedObjectStorer) error {
+	iter, err := src.IterEncodedObjects(plumbing.AnyObject)
+	if err != nil {
+		return err
+	}
+
+	return iter.ForEach(func(o plumbing.EncodedObject) error {
+		_, err := dst.SetEncodedObject(o)
+		return err
+	})
+}
@@ -0,0 +1,245 @@
+package helper
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+	"gopkg.in/src-d/go-git.v4/plumbing/revlist"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git-fixtures.v3"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type HelperSuite struct {
+	fixtures.Suite
+}
+
+var _ = Suite(&HelperSuite{})
+
+// storageHelper is a Helper serving the objects and references of a storer.
+type storageHelper struct {
+	sto    storer.Storer
+	closed bool
+}
+
+func (h *storageHelper) List(ctx context.Context, forPush bool) ([]*plumbing.Reference, error) {
+	iter, err := h.sto.IterReferences()
+	if err != nil {
+		return nil, err
+	}
+
+	var refs []*plumbing.Reference
+	err = iter.ForEach(func(r *plumbing.Reference) error {
+		refs = append(refs, r)
+		return nil
+	})
+
+	return refs, err
+}
+
+func (h *storageHelper) Fetch(ctx context.Context, sto storer.EncodedObjectStorer, wants, haves []plumbing.Hash) error {
+	hashes, err := revlist.Objects(h.sto, wants, haves)
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range hashes {
+		o, err := h.sto.EncodedObject(plumbing.AnyObject, hash)
+		if err != nil {
+			return err
+		}
+
+		if _, err := sto.SetEncodedObject(o); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (h *storageHelper) Push(ctx context.Context, sto storer.EncodedObjectStorer, cmds []*PushCommand) ([]error, error) {
+	if err := copyObjects(h.sto, sto); err != nil {
+		return nil, err
+	}
+
+	errs := make([]error, len(cmds))
+	for i, c := range cmds {
+		if c.New.IsZero() {
+			errs[i] = h.sto.RemoveReference(c.Name)
+			continue
+		}
+
+		errs[i] = h.sto.SetReference(plumbing.NewHashReference(c.Name, c.New))
+	}
+
+	return errs, nil
+}
+
+func (h *storageHelper) Close() error {
+	h.closed = true
+	return nil
+}
+
+func (s *HelperSuite) newHelper() *storageHelper {
+	dotgit := fixtures.Basic().One().DotGit()
+	return &storageHelper{sto: filesystem.NewStorage(dotgit, cache.NewObjectLRUDefault())}
+}
+
+func (s *HelperSuite) TestAdvertisedReferences(c *C) {
+	h := s.newHelper()
+	r, err := NewClient(func(*transport.Endpoint) (Helper, error) {
+		return h, nil
+	}).NewUploadPackSession(nil, nil)
+	c.Assert(err, IsNil)
+
+	ar, err := r.AdvertisedReferences()
+	c.Assert(err, IsNil)
+	c.Assert(ar.Head.String(), Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	c.Assert(ar.References["refs/heads/branch"].String(), Equals, "e8d3ffab552895c19b9fcf7aa264d277cde33881")
+
+	refs, err := ar.AllReferences()
+	c.Assert(err, IsNil)
+	c.Assert(refs[plumbing.HEAD].Target(), Equals, plumbing.Master)
+
+	c.Assert(r.Close(), IsNil)
+	c.Assert(h.closed, Equals, true)
+}
+
+func (s *HelperSuite) TestAdvertisedReferencesEmpty(c *C) {
+	r, err := NewClient(func(*transport.Endpoint) (Helper, error) {
+		return &storageHelper{sto: memory.NewStorage()}, nil
+	}).NewUploadPackSession(nil, nil)
+	c.Assert(err, IsNil)
+
+	_, err = r.AdvertisedReferences()
+	c.Assert(err, Equals, transport.ErrEmptyRemoteRepository)
+}
+
+func (s *HelperSuite) TestUploadPack(c *C) {
+	h := s.newHelper()
+	t := NewClient(func(*transport.Endpoint) (Helper, error) {
+		return h, nil
+	})
+
+	sto := uploadPack(c, t, nil, plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	c.Assert(sto.Objects, HasLen, 28)
+}
+
+func (s *HelperSuite) TestReceivePack(c *C) {
+	h := s.newHelper()
+	t := NewClient(func(*transport.Endpoint) (Helper, error) {
+		return h, nil
+	})
+
+	master := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	commit := newCommit(c, master)
+
+	rs := receivePack(c, t, nil, commit, &packp.Command{
+		Name: plumbing.Master, Old: master, New: commit.Hash(),
+	}, &packp.Command{
+		Name: "refs/heads/branch",
+		Old:  plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881"),
+	})
+
+	c.Assert(rs.Error(), IsNil)
+	c.Assert(rs.CommandStatuses, HasLen, 2)
+
+	ref, err := h.sto.Reference(plumbing.Master)
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash(), Equals, commit.Hash())
+
+	_, err = h.sto.Reference("refs/heads/branch")
+	c.Assert(err, Equals, plumbing.ErrReferenceNotFound)
+
+	_, err = object.GetCommit(h.sto, commit.Hash())
+	c.Assert(err, IsNil)
+}
+
+func uploadPack(c *C, t transport.Transport, ep *transport.Endpoint, wants ...plumbing.Hash) *memory.Storage {
+	r, err := t.NewUploadPackSession(ep, nil)
+	c.Assert(err, IsNil)
+	defer func() { c.Assert(r.Close(), IsNil) }()
+
+	_, err = r.AdvertisedReferences()
+	c.Assert(err, IsNil)
+
+	req := packp.NewUploadPackRequest()
+	req.Wants = wants
+
+	resp, err := r.UploadPack(context.Background(), req)
+	c.Assert(err, IsNil)
+
+	sto := memory.NewStorage()
+	c.Assert(packfile.UpdateObjectStorage(sto, resp), IsNil)
+	return sto
+}
+
+// receivePack sends the given commands, with a packfile containing the
+// commit and its tree, if any.
+func receivePack(c *C, t transport.Transport, ep *transport.Endpoint,
+	commit plumbing.EncodedObject, cmds ...*packp.Command) *packp.ReportStatus {
+
+	r, err := t.NewReceivePackSession(ep, nil)
+	c.Assert(err, IsNil)
+	defer func() { c.Assert(r.Close(), IsNil) }()
+
+	ar, err := r.AdvertisedReferences()
+	c.Assert(err, IsNil)
+
+	req := packp.NewReferenceUpdateRequestFromCapabilities(ar.Capabilities)
+	req.Commands = cmds
+	if commit != nil {
+		req.Packfile = encodeObjects(c, commit)
+	}
+
+	rs, err := r.ReceivePack(context.Background(), req)
+	c.Assert(err, IsNil)
+	return rs
+}
+
+// encodeObjects returns a packfile with the given objects.
+func encodeObjects(c *C, objs ...plumbing.EncodedObject) io.ReadCloser {
+	sto := memory.NewStorage()
+	var hashes []plumbing.Hash
+	for _, o := range objs {
+		h, err := sto.SetEncodedObject(o)
+		c.Assert(err, IsNil)
+		hashes = append(hashes, h)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	_, err := packfile.NewEncoder(buf, sto, false).Encode(hashes, 0)
+	c.Assert(err, IsNil)
+	return ioutil.NopCloser(buf)
+}
+
+// newCommit returns a commit on top of the given parent, with its tree.
+func newCommit(c *C, parent plumbing.Hash) plumbing.EncodedObject {
+	when := time.Unix(1500000000, 0).UTC()
+	commit := &object.Commit{
+		Author:       object.Signature{Name: "foo", Email: "foo@foo.foo", When: when},
+		Committer:    object.Signature{Name: "foo", Email: "foo@foo.foo", When: when},
+		Message:      "helper\n",
+		TreeHash:     plumbing.NewHash("a8d315b2b1c615d43042c3a62402b8a54288cf5c"),
+		ParentHashes: []plumbing.Hash{parent},
+	}
+
+	obj := &plumbing.MemoryObject{}
+	c.Assert(commit.Encode(obj), IsNil)
+	return obj
+}
@@ -8,8 +8,10 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 
 	"gopkg.in/src-d/go-git.v4/plumbing"
+	format "gopkg.in/src-d/go-git.v4/plumbing/format/config"
 	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
 	"gopkg.in/src-d/go-git.v4/plumbing/transport"
 	"gopkg.in/src-d/go-git.v4/utils/ioutil"
@@ -38,14 +40,7 @@ func advertisedReferences(s *session, serviceName string) (ref *packp.AdvRefs, e
 		s.endpoint.String(), infoRefsPath, serviceName,
 	)
 
-	req, err := http.NewRequest(http.MethodGet, url, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	s.ApplyAuthToRequest(req)
-	applyHeadersToRequest(req, nil, s.endpoint.Host, serviceName)
-	res, err := s.client.Do(req)
+	res, err := s.infoRefs(url, serviceName)
 	if err != nil {
 		return nil, err
 	}
@@ -54,9 +49,34 @@ func advertisedReferences(s *session, serviceName string) (ref *packp.AdvRefs, e
 	defer ioutil.CheckClose(res.Body, &err)
 
 	if err = NewErr(res); err != nil {
+		if res.StatusCode == http.StatusUnauthorized {
+			if rerr := s.rejectCredentials(); rerr != nil {
+				return nil, rerr
+			}
+		}
+
 		return nil, err
 	}
 
+	if err = s.approveCredentials(); err != nil {
+		return nil, err
+	}
+
+	if !isSmartResponse(res, serviceName) {
+		if serviceName != transport.UploadPackServiceName {
+			return nil, ErrDumbPushNotSupported
+		}
+
+		ar, err := dumbAdvertisedReferences(s, res.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		s.dumb = true
+		s.advRefs = ar
+		return ar, nil
+	}
+
 	ar := packp.NewAdvRefs()
 	if err = ar.Decode(res.Body); err != nil {
 		if err == packp.ErrEmptyAdvRefs {
@@ -72,8 +92,54 @@ func advertisedReferences(s *session, serviceName string) (ref *packp.AdvRefs, e
 	return ar, nil
 }
 
+// infoRefs requests the advertised references, if the server requests
+// authentication and the session uses a CredentialHelperAuth the request is
+// retried with the credentials given by the helpers.
+func (s *session) infoRefs(url, serviceName string) (*http.Response, error) {
+	res, err := s.infoRefsRequest(url, serviceName)
+	if err != nil || res.StatusCode != http.StatusUnauthorized {
+		return res, err
+	}
+
+	a, ok := s.auth.(*CredentialHelperAuth)
+	if !ok {
+		return res, nil
+	}
+
+	filled, err := a.fill(s.endpoint)
+	if err != nil || !filled {
+		_ = res.Body.Close()
+		if err == nil {
+			err = transport.ErrAuthenticationRequired
+		}
+
+		return nil, err
+	}
+
+	_ = res.Body.Close()
+	return s.infoRefsRequest(url, serviceName)
+}
+
+func (s *session) infoRefsRequest(url, serviceName string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	s.ApplyAuthToRequest(req)
+	applyHeadersToRequest(req, nil, s.endpoint.Host, serviceName)
+	s.applyConfigToRequest(req)
+	return s.client.Do(req)
+}
+
 type client struct {
-	c *http.Client
+	c   *http.Client
+	raw *format.Config
+
+	mu sync.Mutex
+	// clients are the net/http clients built for the http.* options, so
+	// the sessions with the same options share their connections.
+	clients map[clientKey]*http.Client
 }
 
 // DefaultClient is the default HTTP client, which uses `http.DefaultClient`.
@@ -89,7 +155,7 @@ var DefaultClient = NewClient(nil)
 // for both.
 func NewClient(c *http.Client) transport.Transport {
 	if c == nil {
-		return &client{http.DefaultClient}
+		return &client{c: http.DefaultClient}
 	}
 
 	return &client{
@@ -97,31 +163,83 @@ func NewClient(c *http.Client) transport.Transport {
 	}
 }
 
+// NewClientFromConfig creates a new client with a custom net/http client,
+// which is configured for each endpoint with the http.* options of the given
+// git configuration. See NewConfig for the supported options.
+func NewClientFromConfig(c *http.Client, raw *format.Config) transport.Transport {
+	if c == nil {
+		c = http.DefaultClient
+	}
+
+	return &client{c: c, raw: raw}
+}
+
 func (c *client) NewUploadPackSession(ep *transport.Endpoint, auth transport.AuthMethod) (
 	transport.UploadPackSession, error) {
 
-	return newUploadPackSession(c.c, ep, auth)
+	return newUploadPackSession(c, ep, auth)
 }
 
 func (c *client) NewReceivePackSession(ep *transport.Endpoint, auth transport.AuthMethod) (
 	transport.ReceivePackSession, error) {
 
-	return newReceivePackSession(c.c, ep, auth)
+	return newReceivePackSession(c, ep, auth)
+}
+
+// configuredClient returns the net/http client for the given configuration,
+// built once for each set of options.
+func (c *client) configuredClient(cfg *Config) (*http.Client, error) {
+	key := cfg.clientKey()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if hc, ok := c.clients[key]; ok {
+		return hc, nil
+	}
+
+	hc, err := cfg.Client(c.c)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.clients == nil {
+		c.clients = make(map[clientKey]*http.Client)
+	}
+
+	c.clients[key] = hc
+	return hc, nil
 }
 
 type session struct {
 	auth     AuthMethod
 	client   *http.Client
 	endpoint *transport.Endpoint
-	advRefs  *packp.AdvRefs
+	// config is the configuration of the endpoint, nil if the client has
+	// no git configuration.
+	config  *Config
+	advRefs *packp.AdvRefs
+	// dumb is true if the server only speaks the dumb HTTP protocol.
+	dumb bool
 }
 
-func newSession(c *http.Client, ep *transport.Endpoint, auth transport.AuthMethod) (*session, error) {
+func newSession(c *client, ep *transport.Endpoint, auth transport.AuthMethod) (*session, error) {
 	s := &session{
 		auth:     basicAuthFromEndpoint(ep),
-		client:   c,
+		client:   c.c,
 		endpoint: ep,
 	}
+
+	if c.raw != nil {
+		s.config = NewConfig(c.raw, endpointURL(ep))
+		if !s.config.isDefault() {
+			var err error
+			if s.client, err = c.configuredClient(s.config); err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	if auth != nil {
 		a, ok := auth.(AuthMethod)
 		if !ok {
@@ -142,6 +260,32 @@ func (s *session) ApplyAuthToRequest(req *http.Request) {
 	s.auth.SetAuth(req)
 }
 
+// applyConfigToRequest sets the user agent and the extra headers of the
+// configuration.
+func (s *session) applyConfigToRequest(req *http.Request) {
+	if s.config == nil {
+		return
+	}
+
+	s.config.applyToRequest(req)
+}
+
+func (s *session) approveCredentials() error {
+	if a, ok := s.auth.(*CredentialHelperAuth); ok {
+		return a.approve()
+	}
+
+	return nil
+}
+
+func (s *session) rejectCredentials() error {
+	if a, ok := s.auth.(*CredentialHelperAuth); ok {
+		return a.reject()
+	}
+
+	return nil
+}
+
 func (s *session) ModifyEndpointIfRedirect(res *http.Response) {
 	if res.Request == nil {
 		return
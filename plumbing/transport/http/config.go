@@ -0,0 +1,431 @@
+package http
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/config"
+	format "gopkg.in/src-d/go-git.v4/plumbing/format/config"
+
+	"github.com/mitchellh/go-homedir"
+	"golang.org/x/net/http/httpproxy"
+)
+
+const (
+	httpSection    = "http"
+	proxyKey       = "proxy"
+	extraHeaderKey = "extraHeader"
+	sslCAInfoKey   = "sslCAInfo"
+	sslCertKey     = "sslCert"
+	sslKeyKey      = "sslKey"
+	sslVerifyKey   = "sslVerify"
+	cookieFileKey  = "cookieFile"
+	userAgentKey   = "userAgent"
+)
+
+// Config is the HTTP configuration for a URL, read from the http.* and
+// http.<url>.* options.
+type Config struct {
+	// Proxy is the proxy URL, if empty the proxy of the base transport is
+	// kept, which for http.DefaultTransport is read from the HTTP_PROXY and
+	// HTTPS_PROXY environment variables. The hosts listed in NO_PROXY are
+	// always accessed directly.
+	Proxy string
+	// ExtraHeaders are the headers added to every request, as "Name: value".
+	ExtraHeaders []string
+	// SSLCAInfo is the file with the certificates used to verify the server,
+	// instead of the ones of the system.
+	SSLCAInfo string
+	// SSLCert and SSLKey are the files with the client certificate and its
+	// private key.
+	SSLCert, SSLKey string
+	// SSLVerify is false if the server certificate is not verified.
+	SSLVerify bool
+	// CookieFile is a file with cookies in the Netscape format, sent with
+	// the requests.
+	CookieFile string
+	// UserAgent is the user agent of the requests.
+	UserAgent string
+}
+
+// NewConfig returns the HTTP configuration that applies to u. The options of
+// the http section apply to all the URLs, and the ones of the http.<url>
+// subsections to the URLs matching the subsection name, the more specific
+// match taking precedence. An empty extraHeader value resets the list of
+// headers.
+func NewConfig(raw *format.Config, u *url.URL) *Config {
+	cfg := &Config{SSLVerify: true}
+	for _, s := range raw.Sections {
+		if !s.IsName(httpSection) {
+			continue
+		}
+
+		cfg.apply(s.Options)
+
+		var matches []*urlMatch
+		for _, ss := range s.Subsections {
+			if m, ok := matchURL(ss, u); ok {
+				matches = append(matches, m)
+			}
+		}
+
+		sort.SliceStable(matches, func(i, j int) bool {
+			return matches[i].less(matches[j])
+		})
+
+		for _, m := range matches {
+			cfg.apply(m.subsection.Options)
+		}
+	}
+
+	return cfg
+}
+
+func (cfg *Config) apply(opts format.Options) {
+	for _, o := range opts {
+		switch {
+		case o.IsKey(proxyKey):
+			cfg.Proxy = o.Value
+		case o.IsKey(extraHeaderKey):
+			if o.Value == "" {
+				cfg.ExtraHeaders = nil
+				continue
+			}
+
+			cfg.ExtraHeaders = append(cfg.ExtraHeaders, o.Value)
+		case o.IsKey(sslCAInfoKey):
+			cfg.SSLCAInfo = o.Value
+		case o.IsKey(sslCertKey):
+			cfg.SSLCert = o.Value
+		case o.IsKey(sslKeyKey):
+			cfg.SSLKey = o.Value
+		case o.IsKey(sslVerifyKey):
+			cfg.SSLVerify = config.IsTrue(o.Value)
+		case o.IsKey(cookieFileKey):
+			cfg.CookieFile = o.Value
+		case o.IsKey(userAgentKey):
+			cfg.UserAgent = o.Value
+		}
+	}
+}
+
+// isDefault returns true if the configuration doesn't change the behavior of
+// a net/http client.
+func (cfg *Config) isDefault() bool {
+	return cfg.Proxy == "" && cfg.SSLCAInfo == "" && cfg.SSLCert == "" &&
+		cfg.SSLKey == "" && cfg.SSLVerify && cfg.CookieFile == ""
+}
+
+// clientKey is the part of the configuration used by Client, the sessions
+// with the same key share their net/http client.
+type clientKey struct {
+	proxy, sslCAInfo, sslCert, sslKey, cookieFile string
+	sslVerify                                     bool
+}
+
+func (cfg *Config) clientKey() clientKey {
+	return clientKey{
+		proxy:      cfg.Proxy,
+		sslCAInfo:  cfg.SSLCAInfo,
+		sslCert:    cfg.SSLCert,
+		sslKey:     cfg.SSLKey,
+		cookieFile: cfg.CookieFile,
+		sslVerify:  cfg.SSLVerify,
+	}
+}
+
+// urlMatch is a http.<url> subsection matching a URL.
+type urlMatch struct {
+	subsection *format.Subsection
+	pathLen    int
+	hasUser    bool
+}
+
+// less returns true if m is less specific than o: the longest path match is
+// the most specific, and on a tie, the one with a user name.
+func (m *urlMatch) less(o *urlMatch) bool {
+	if m.pathLen != o.pathLen {
+		return m.pathLen < o.pathLen
+	}
+
+	return !m.hasUser && o.hasUser
+}
+
+// matchURL returns if u matches the URL of the subsection, as git does: the
+// scheme, host and port must be equal, the host of the subsection can use '*'
+// to match any label, its path must be a prefix of the path of u, and its user,
+// if any, must be equal.
+func matchURL(ss *format.Subsection, u *url.URL) (*urlMatch, bool) {
+	p, err := url.Parse(ss.Name)
+	if err != nil || p.Scheme == "" {
+		return nil, false
+	}
+
+	if !strings.EqualFold(p.Scheme, u.Scheme) || portOf(p) != portOf(u) ||
+		!matchHost(p.Hostname(), u.Hostname()) {
+		return nil, false
+	}
+
+	if p.User != nil && (u.User == nil || p.User.Username() != u.User.Username()) {
+		return nil, false
+	}
+
+	path := strings.TrimSuffix(p.Path, "/")
+	if path != "" && u.Path != path && !strings.HasPrefix(u.Path, path+"/") {
+		return nil, false
+	}
+
+	return &urlMatch{subsection: ss, pathLen: len(path), hasUser: p.User != nil}, true
+}
+
+func matchHost(pattern, host string) bool {
+	pl := strings.Split(strings.ToLower(pattern), ".")
+	hl := strings.Split(strings.ToLower(host), ".")
+	if len(pl) != len(hl) {
+		return false
+	}
+
+	for i := range pl {
+		if pl[i] != "*" && pl[i] != hl[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func portOf(u *url.URL) string {
+	if p := u.Port(); p != "" {
+		return p
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "http":
+		return "80"
+	case "https":
+		return "443"
+	}
+
+	return ""
+}
+
+// applyToRequest sets the user agent and the extra headers of the request.
+func (cfg *Config) applyToRequest(req *http.Request) {
+	if cfg.UserAgent != "" {
+		req.Header.Set("User-Agent", cfg.UserAgent)
+	}
+
+	for _, h := range cfg.ExtraHeaders {
+		i := strings.Index(h, ":")
+		if i == -1 {
+			continue
+		}
+
+		req.Header.Add(strings.TrimSpace(h[:i]), strings.TrimSpace(h[i+1:]))
+	}
+}
+
+// Client returns a net/http client with the configured proxy, certificates
+// and cookies, based on the given client.
+func (cfg *Config) Client(base *http.Client) (*http.Client, error) {
+	if base == nil {
+		base = http.DefaultClient
+	}
+
+	c := *base
+	t, ok := base.Transport.(*http.Transport)
+	if !ok || t == nil {
+		t, ok = http.DefaultTransport.(*http.Transport)
+		if !ok {
+			return nil, fmt.Errorf("http: unable to configure transport %T", base.Transport)
+		}
+	}
+
+	t = cloneTransport(t)
+	if err := cfg.configureTransport(t); err != nil {
+		return nil, err
+	}
+
+	c.Transport = t
+	if cfg.CookieFile != "" {
+		jar, err := loadCookieFile(expandPath(cfg.CookieFile))
+		if err != nil {
+			return nil, err
+		}
+
+		c.Jar = jar
+	}
+
+	return &c, nil
+}
+
+// cloneTransport returns a copy of the given transport without its idle
+// connections, as http.Transport.Clone does since Go 1.13.
+func cloneTransport(t *http.Transport) *http.Transport {
+	c := &http.Transport{
+		Proxy:                  t.Proxy,
+		DialContext:            t.DialContext,
+		Dial:                   t.Dial,
+		DialTLS:                t.DialTLS,
+		TLSClientConfig:        t.TLSClientConfig,
+		TLSHandshakeTimeout:    t.TLSHandshakeTimeout,
+		DisableKeepAlives:      t.DisableKeepAlives,
+		DisableCompression:     t.DisableCompression,
+		MaxIdleConns:           t.MaxIdleConns,
+		MaxIdleConnsPerHost:    t.MaxIdleConnsPerHost,
+		MaxConnsPerHost:        t.MaxConnsPerHost,
+		IdleConnTimeout:        t.IdleConnTimeout,
+		ResponseHeaderTimeout:  t.ResponseHeaderTimeout,
+		ExpectContinueTimeout:  t.ExpectContinueTimeout,
+		ProxyConnectHeader:     cloneHeader(t.ProxyConnectHeader),
+		MaxResponseHeaderBytes: t.MaxResponseHeaderBytes,
+	}
+
+	// a nil TLSNextProto keeps HTTP/2 enabled, while an empty one disables it
+	if t.TLSNextProto != nil {
+		c.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper, len(t.TLSNextProto))
+		for k, v := range t.TLSNextProto {
+			c.TLSNextProto[k] = v
+		}
+	}
+
+	return c
+}
+
+func cloneHeader(h http.Header) http.Header {
+	if h == nil {
+		return nil
+	}
+
+	c := make(http.Header, len(h))
+	for k, v := range h {
+		c[k] = append([]string(nil), v...)
+	}
+
+	return c
+}
+
+func (cfg *Config) configureTransport(t *http.Transport) error {
+	if cfg.Proxy != "" {
+		proxy := httpproxy.FromEnvironment()
+		proxy.HTTPProxy = cfg.Proxy
+		proxy.HTTPSProxy = cfg.Proxy
+
+		proxyFunc := proxy.ProxyFunc()
+		t.Proxy = func(req *http.Request) (*url.URL, error) {
+			return proxyFunc(req.URL)
+		}
+	}
+
+	tc := &tls.Config{}
+	if t.TLSClientConfig != nil {
+		tc = t.TLSClientConfig.Clone()
+	}
+
+	tc.InsecureSkipVerify = !cfg.SSLVerify
+	if cfg.SSLCAInfo != "" {
+		pem, err := ioutil.ReadFile(expandPath(cfg.SSLCAInfo))
+		if err != nil {
+			return err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("http: no certificates found in %s", cfg.SSLCAInfo)
+		}
+
+		tc.RootCAs = pool
+	}
+
+	if cfg.SSLCert != "" {
+		key := cfg.SSLKey
+		if key == "" {
+			key = cfg.SSLCert
+		}
+
+		cert, err := tls.LoadX509KeyPair(expandPath(cfg.SSLCert), expandPath(key))
+		if err != nil {
+			return err
+		}
+
+		tc.Certificates = []tls.Certificate{cert}
+	}
+
+	t.TLSClientConfig = tc
+	return nil
+}
+
+// loadCookieFile returns a cookie jar with the cookies of a file in the
+// Netscape format, as written by curl.
+func loadCookieFile(path string) (http.CookieJar, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := s.Text()
+		httpOnly := strings.HasPrefix(line, "#HttpOnly_")
+		if httpOnly {
+			line = line[len("#HttpOnly_"):]
+		}
+
+		fields := strings.Split(line, "\t")
+		if strings.HasPrefix(line, "#") || len(fields) != 7 {
+			continue
+		}
+
+		c := &http.Cookie{
+			Path:     fields[2],
+			Secure:   fields[3] == "TRUE",
+			Name:     fields[5],
+			Value:    fields[6],
+			HttpOnly: httpOnly,
+		}
+
+		host := strings.TrimPrefix(fields[0], ".")
+		if fields[1] == "TRUE" {
+			c.Domain = host
+		}
+
+		if secs, err := strconv.ParseInt(fields[4], 10, 64); err == nil && secs != 0 {
+			c.Expires = time.Unix(secs, 0)
+		}
+
+		scheme := "http"
+		if c.Secure {
+			scheme = "https"
+		}
+
+		jar.SetCookies(&url.URL{Scheme: scheme, Host: host, Path: c.Path}, []*http.Cookie{c})
+	}
+
+	return jar, s.Err()
+}
+
+func expandPath(path string) string {
+	if p, err := homedir.Expand(path); err == nil {
+		return p
+	}
+
+	return path
+}
@@ -0,0 +1,214 @@
+package http
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	format "gopkg.in/src-d/go-git.v4/plumbing/format/config"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+
+	. "gopkg.in/check.v1"
+)
+
+type ConfigSuite struct{}
+
+var _ = Suite(&ConfigSuite{})
+
+func (s *ConfigSuite) newConfig(c *C, rawURL string, raw *format.Config) *Config {
+	u, err := url.Parse(rawURL)
+	c.Assert(err, IsNil)
+
+	return NewConfig(raw, u)
+}
+
+func (s *ConfigSuite) TestNewConfig(c *C) {
+	raw := format.New()
+	raw.Section("http").
+		AddOption("proxy", "http://proxy.local:3128").
+		AddOption("extraHeader", "X-Foo: foo").
+		AddOption("userAgent", "foo/1.0")
+	raw.Section("http").Subsection("https://github.com").
+		AddOption("sslVerify", "false").
+		AddOption("extraHeader", "X-Bar: bar")
+	raw.Section("http").Subsection("https://github.com/src-d/go-git").
+		AddOption("extraHeader", "").
+		AddOption("extraHeader", "X-Baz: baz")
+	raw.Section("http").Subsection("https://example.com").
+		AddOption("cookieFile", "/tmp/cookies")
+
+	cfg := s.newConfig(c, "https://github.com/foo/bar", raw)
+	c.Assert(cfg.Proxy, Equals, "http://proxy.local:3128")
+	c.Assert(cfg.UserAgent, Equals, "foo/1.0")
+	c.Assert(cfg.SSLVerify, Equals, false)
+	c.Assert(cfg.ExtraHeaders, DeepEquals, []string{"X-Foo: foo", "X-Bar: bar"})
+	c.Assert(cfg.CookieFile, Equals, "")
+
+	cfg = s.newConfig(c, "https://github.com/src-d/go-git.git", raw)
+	c.Assert(cfg.ExtraHeaders, DeepEquals, []string{"X-Foo: foo", "X-Bar: bar"})
+
+	cfg = s.newConfig(c, "https://github.com/src-d/go-git/", raw)
+	c.Assert(cfg.ExtraHeaders, DeepEquals, []string{"X-Baz: baz"})
+
+	cfg = s.newConfig(c, "http://github.com/foo/bar", raw)
+	c.Assert(cfg.SSLVerify, Equals, true)
+	c.Assert(cfg.ExtraHeaders, DeepEquals, []string{"X-Foo: foo"})
+}
+
+func (s *ConfigSuite) TestNewConfigSpecificity(c *C) {
+	raw := format.New()
+	raw.Section("http").Subsection("https://user@example.com").
+		AddOption("userAgent", "user")
+	raw.Section("http").Subsection("https://example.com/repo").
+		AddOption("userAgent", "path")
+	raw.Section("http").Subsection("https://example.com").
+		AddOption("userAgent", "host")
+	raw.Section("http").Subsection("https://*.example.com").
+		AddOption("userAgent", "wildcard")
+
+	c.Assert(s.newConfig(c, "https://example.com/foo", raw).UserAgent, Equals, "host")
+	c.Assert(s.newConfig(c, "https://user@example.com/foo", raw).UserAgent, Equals, "user")
+	c.Assert(s.newConfig(c, "https://user@example.com/repo", raw).UserAgent, Equals, "path")
+	c.Assert(s.newConfig(c, "https://www.example.com/repo", raw).UserAgent, Equals, "wildcard")
+	c.Assert(s.newConfig(c, "https://example.com:8443/repo", raw).UserAgent, Equals, "")
+	c.Assert(s.newConfig(c, "https://example.com:443/repo", raw).UserAgent, Equals, "path")
+}
+
+func (s *ConfigSuite) TestProxy(c *C) {
+	defer os.Setenv("NO_PROXY", os.Getenv("NO_PROXY"))
+	c.Assert(os.Setenv("NO_PROXY", "internal.local"), IsNil)
+
+	cfg := &Config{Proxy: "proxy.local:3128", SSLVerify: true}
+	client, err := cfg.Client(nil)
+	c.Assert(err, IsNil)
+
+	proxy := client.Transport.(*http.Transport).Proxy
+	req, err := http.NewRequest(http.MethodGet, "https://github.com/foo/bar", nil)
+	c.Assert(err, IsNil)
+
+	u, err := proxy(req)
+	c.Assert(err, IsNil)
+	c.Assert(u.String(), Equals, "http://proxy.local:3128")
+
+	req, err = http.NewRequest(http.MethodGet, "https://internal.local/foo/bar", nil)
+	c.Assert(err, IsNil)
+
+	u, err = proxy(req)
+	c.Assert(err, IsNil)
+	c.Assert(u, IsNil)
+}
+
+func (s *ConfigSuite) TestClientKeepsTransport(c *C) {
+	base := &http.Transport{
+		MaxIdleConns:          7,
+		IdleConnTimeout:       time.Minute,
+		ResponseHeaderTimeout: time.Second,
+		ProxyConnectHeader:    http.Header{"X-Foo": []string{"bar"}},
+	}
+
+	client, err := (&Config{SSLVerify: false}).Client(&http.Client{Transport: base})
+	c.Assert(err, IsNil)
+
+	t := client.Transport.(*http.Transport)
+	c.Assert(t, Not(Equals), base)
+	c.Assert(t.MaxIdleConns, Equals, 7)
+	c.Assert(t.IdleConnTimeout, Equals, time.Minute)
+	c.Assert(t.ResponseHeaderTimeout, Equals, time.Second)
+	c.Assert(t.ProxyConnectHeader, DeepEquals, base.ProxyConnectHeader)
+	c.Assert(t.TLSClientConfig.InsecureSkipVerify, Equals, true)
+
+	// the base transport isn't modified, and without http.proxy its proxy
+	// is kept
+	c.Assert(base.TLSClientConfig, IsNil)
+	c.Assert(base.Proxy, IsNil)
+	c.Assert(t.Proxy, IsNil)
+}
+
+func (s *ConfigSuite) TestSessionClientCache(c *C) {
+	raw := format.New()
+	raw.Section("http").AddOption("sslVerify", "false")
+	raw.Section("http").Subsection("https://other.com").AddOption("cookieFile", "/dev/null")
+	t := NewClientFromConfig(nil, raw)
+
+	session := func(url string) *session {
+		ep, err := transport.NewEndpoint(url)
+		c.Assert(err, IsNil)
+
+		r, err := t.NewUploadPackSession(ep, nil)
+		c.Assert(err, IsNil)
+		return r.(*upSession).session
+	}
+
+	foo := session("https://example.com/foo.git")
+	c.Assert(foo.client, Not(Equals), http.DefaultClient)
+	c.Assert(session("https://example.com/bar.git").client, Equals, foo.client)
+	c.Assert(session("https://other.com/foo.git").client, Not(Equals), foo.client)
+}
+
+func (s *ConfigSuite) TestCookieFile(c *C) {
+	path := filepath.Join(c.MkDir(), "cookies")
+	content := "# Netscape HTTP Cookie File\n" +
+		".example.com\tTRUE\t/\tFALSE\t0\tfoo\tbar\n" +
+		"#HttpOnly_other.com\tFALSE\t/repo\tTRUE\t0\tqux\tbaz\n"
+	c.Assert(ioutil.WriteFile(path, []byte(content), 0600), IsNil)
+
+	client, err := (&Config{CookieFile: path, SSLVerify: true}).Client(nil)
+	c.Assert(err, IsNil)
+
+	u, _ := url.Parse("https://www.example.com/foo")
+	cookies := client.Jar.Cookies(u)
+	c.Assert(cookies, HasLen, 1)
+	c.Assert(cookies[0].Name, Equals, "foo")
+	c.Assert(cookies[0].Value, Equals, "bar")
+
+	u, _ = url.Parse("https://other.com/repo/info/refs")
+	c.Assert(client.Jar.Cookies(u), HasLen, 1)
+
+	u, _ = url.Parse("http://other.com/repo/info/refs")
+	c.Assert(client.Jar.Cookies(u), HasLen, 0)
+}
+
+func (s *ConfigSuite) TestClientCertNotFound(c *C) {
+	_, err := (&Config{SSLCert: "/non-existent/cert.pem", SSLVerify: true}).Client(nil)
+	c.Assert(err, NotNil)
+}
+
+func (s *ConfigSuite) TestSession(c *C) {
+	var header http.Header
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	ep, err := transport.NewEndpoint(server.URL + "/foo.git")
+	c.Assert(err, IsNil)
+
+	// the certificate of the server isn't trusted
+	raw := format.New()
+	r, err := NewClientFromConfig(nil, raw).NewUploadPackSession(ep, nil)
+	c.Assert(err, IsNil)
+	_, err = r.AdvertisedReferences()
+	c.Assert(err, ErrorMatches, ".*certificate.*")
+
+	caInfo := filepath.Join(c.MkDir(), "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	c.Assert(ioutil.WriteFile(caInfo, cert, 0600), IsNil)
+
+	raw.Section("http").AddOption("sslCAInfo", caInfo)
+	raw.Section("http").Subsection(server.URL).
+		AddOption("extraHeader", "Authorization: Bearer foo").
+		AddOption("userAgent", "foo/1.0")
+
+	r, err = NewClientFromConfig(nil, raw).NewUploadPackSession(ep, nil)
+	c.Assert(err, IsNil)
+	_, err = r.AdvertisedReferences()
+	c.Assert(err, Equals, transport.ErrRepositoryNotFound)
+	c.Assert(header.Get("Authorization"), Equals, "Bearer foo")
+	c.Assert(header.Get("User-Agent"), Equals, "foo/1.0")
+}
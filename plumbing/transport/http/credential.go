@@ -0,0 +1,155 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/credential"
+)
+
+// CredentialHelperAuth implements an http.AuthMethod that retrieves the
+// credentials from git credential helpers when the server requests
+// authentication. The credentials accepted by the server are stored in the
+// helpers, and the rejected ones are erased from them.
+type CredentialHelperAuth struct {
+	// Helpers used to retrieve, store and erase the credentials.
+	Helpers credential.Helpers
+	// UseHTTPPath includes the path of the repository in the credential
+	// lookups.
+	UseHTTPPath bool
+	// Username is the default username, if the URL has none.
+	Username string
+
+	m    sync.Mutex
+	cred *credential.Credential
+}
+
+// NewCredentialHelperAuth returns a CredentialHelperAuth using the given
+// helpers.
+func NewCredentialHelperAuth(helpers ...credential.Helper) *CredentialHelperAuth {
+	return &CredentialHelperAuth{Helpers: helpers}
+}
+
+// NewCredentialHelperAuthFromConfig returns a CredentialHelperAuth using the
+// helpers and options configured for the endpoint.
+func NewCredentialHelperAuthFromConfig(cfg *credential.Config) *CredentialHelperAuth {
+	return &CredentialHelperAuth{
+		Helpers:     cfg.Helpers,
+		UseHTTPPath: cfg.UseHTTPPath,
+		Username:    cfg.Username,
+	}
+}
+
+// SetAuth sets the basic authentication header, if the credentials were
+// already retrieved.
+func (a *CredentialHelperAuth) SetAuth(r *http.Request) {
+	if a == nil {
+		return
+	}
+
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	if a.cred != nil {
+		r.SetBasicAuth(a.cred.Username, a.cred.Password)
+	}
+}
+
+// Name is name of the auth
+func (a *CredentialHelperAuth) Name() string {
+	return "http-credential-helper"
+}
+
+func (a *CredentialHelperAuth) String() string {
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	if a.cred == nil {
+		return fmt.Sprintf("%s - <empty>", a.Name())
+	}
+
+	return fmt.Sprintf("%s - %s:*******", a.Name(), a.cred.Username)
+}
+
+// fill retrieves the credentials for the endpoint from the helpers, it
+// returns false if no helper knows them.
+func (a *CredentialHelperAuth) fill(ep *transport.Endpoint) (bool, error) {
+	c := credential.NewCredential(&url.URL{
+		Scheme: ep.Protocol,
+		Host:   hostWithPort(ep),
+		Path:   ep.Path,
+	})
+
+	if !a.UseHTTPPath {
+		c.Path = ""
+	}
+
+	c.Username, c.Password = ep.User, ep.Password
+	if c.Username == "" {
+		c.Username = a.Username
+	}
+
+	ok, err := a.Helpers.Fill(c)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	a.m.Lock()
+	a.cred = c
+	a.m.Unlock()
+
+	return true, nil
+}
+
+// approve stores the credentials in use, after being accepted by the server.
+func (a *CredentialHelperAuth) approve() error {
+	a.m.Lock()
+	c := a.cred
+	a.m.Unlock()
+
+	if c == nil {
+		return nil
+	}
+
+	return a.Helpers.Approve(c)
+}
+
+// reject erases the credentials in use, after being rejected by the server.
+func (a *CredentialHelperAuth) reject() error {
+	a.m.Lock()
+	c := a.cred
+	a.cred = nil
+	a.m.Unlock()
+
+	if c == nil {
+		return nil
+	}
+
+	return a.Helpers.Reject(c)
+}
+
+// endpointURL returns the URL of the endpoint, without the password.
+func endpointURL(ep *transport.Endpoint) *url.URL {
+	u := &url.URL{
+		Scheme: ep.Protocol,
+		Host:   hostWithPort(ep),
+		Path:   ep.Path,
+	}
+
+	if ep.User != "" {
+		u.User = url.User(ep.User)
+	}
+
+	return u
+}
+
+func hostWithPort(ep *transport.Endpoint) string {
+	if ep.Port == 0 {
+		return ep.Host
+	}
+
+	return fmt.Sprintf("%s:%d", ep.Host, ep.Port)
+}
@@ -0,0 +1,99 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/pktline"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/credential"
+
+	. "gopkg.in/check.v1"
+)
+
+type CredentialHelperSuite struct {
+	server   *httptest.Server
+	requests int
+}
+
+var _ = Suite(&CredentialHelperSuite{})
+
+func (s *CredentialHelperSuite) SetUpTest(c *C) {
+	s.requests = 0
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests++
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "foo" || pass != "bar" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		ar := packp.NewAdvRefs()
+		ar.Prefix = [][]byte{[]byte("# service=git-upload-pack"), pktline.Flush}
+		ar.References["refs/heads/master"] = plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+
+		w.Header().Set("Content-Type", "application/x-git-upload-pack-advertisement")
+		c.Assert(ar.Encode(w), IsNil)
+	}))
+}
+
+func (s *CredentialHelperSuite) TearDownTest(c *C) {
+	s.server.Close()
+}
+
+func (s *CredentialHelperSuite) advertisedReferences(c *C, auth transport.AuthMethod) error {
+	ep, err := transport.NewEndpoint(s.server.URL + "/repo.git")
+	c.Assert(err, IsNil)
+
+	session, err := DefaultClient.NewUploadPackSession(ep, auth)
+	c.Assert(err, IsNil)
+
+	_, err = session.AdvertisedReferences()
+	return err
+}
+
+func (s *CredentialHelperSuite) TestFillAndApprove(c *C) {
+	filled := credential.NewMemoryHelper(time.Hour)
+	approved := credential.NewMemoryHelper(time.Hour)
+	c.Assert(filled.Store(&credential.Credential{
+		Protocol: "http", Host: s.server.Listener.Addr().String(), Username: "foo", Password: "bar",
+	}), IsNil)
+
+	auth := NewCredentialHelperAuth(filled, approved)
+	c.Assert(s.advertisedReferences(c, auth), IsNil)
+	c.Assert(s.requests, Equals, 2)
+	c.Assert(auth.String(), Equals, "http-credential-helper - foo:*******")
+
+	found, err := approved.Get(&credential.Credential{Protocol: "http"})
+	c.Assert(err, IsNil)
+	c.Assert(found.Password, Equals, "bar")
+
+	// the credentials are reused by later sessions
+	c.Assert(s.advertisedReferences(c, auth), IsNil)
+	c.Assert(s.requests, Equals, 3)
+}
+
+func (s *CredentialHelperSuite) TestReject(c *C) {
+	h := credential.NewMemoryHelper(time.Hour)
+	c.Assert(h.Store(&credential.Credential{
+		Protocol: "http", Host: s.server.Listener.Addr().String(), Username: "foo", Password: "wrong",
+	}), IsNil)
+
+	auth := NewCredentialHelperAuth(h)
+	err := s.advertisedReferences(c, auth)
+	c.Assert(err, Equals, transport.ErrAuthenticationRequired)
+	c.Assert(auth.String(), Equals, "http-credential-helper - <empty>")
+
+	found, err := h.Get(&credential.Credential{Protocol: "http"})
+	c.Assert(err, IsNil)
+	c.Assert(found, IsNil)
+}
+
+func (s *CredentialHelperSuite) TestNoCredentials(c *C) {
+	err := s.advertisedReferences(c, NewCredentialHelperAuth())
+	c.Assert(err, Equals, transport.ErrAuthenticationRequired)
+	c.Assert(s.requests, Equals, 1)
+}
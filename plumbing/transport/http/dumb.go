@@ -0,0 +1,792 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	stdioutil "io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/idxfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/objfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp/capability"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+	"gopkg.in/src-d/go-git.v4/utils/ioutil"
+)
+
+var (
+	// ErrDumbPushNotSupported is returned when pushing to a server that only
+	// speaks the dumb HTTP protocol.
+	ErrDumbPushNotSupported = errors.New("push is not supported by the dumb HTTP protocol")
+	// ErrDumbShallowNotSupported is returned when a shallow fetch is requested
+	// from a server that only speaks the dumb HTTP protocol.
+	ErrDumbShallowNotSupported = errors.New("shallow fetch is not supported by the dumb HTTP protocol")
+)
+
+const (
+	headPath           = "/HEAD"
+	objectsPath        = "/objects"
+	infoPacksPath      = "/info/packs"
+	httpAlternatesPath = "/info/http-alternates"
+	alternatesPath     = "/info/alternates"
+)
+
+// isSmartResponse returns true if the response to the info/refs request was
+// sent by a smart server, since dumb servers serve the file as is, ignoring
+// the service parameter.
+func isSmartResponse(res *http.Response, serviceName string) bool {
+	t, _, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+
+	return t == fmt.Sprintf("application/x-%s-advertisement", serviceName)
+}
+
+// dumbAdvertisedReferences builds the advertised references from the
+// info/refs and HEAD files served by a dumb server.
+func dumbAdvertisedReferences(s *session, r io.Reader) (*packp.AdvRefs, error) {
+	ar := packp.NewAdvRefs()
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+
+		parts := strings.Split(line, "\t")
+		if len(parts) != 2 || len(parts[0]) != 40 {
+			return nil, fmt.Errorf("malformed info/refs line: %q", line)
+		}
+
+		hash, name := plumbing.NewHash(parts[0]), parts[1]
+		if strings.HasSuffix(name, "^{}") {
+			ar.Peeled[strings.TrimSuffix(name, "^{}")] = hash
+			continue
+		}
+
+		ar.References[name] = hash
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(ar.References) == 0 {
+		return nil, transport.ErrEmptyRemoteRepository
+	}
+
+	if err := dumbHead(s, ar); err != nil {
+		return nil, err
+	}
+
+	return ar, nil
+}
+
+// dumbHead reads the HEAD file of the repository, which may contain a
+// symbolic reference or, if it's detached, a hash. A missing HEAD is not an
+// error.
+func dumbHead(s *session, ar *packp.AdvRefs) (err error) {
+	res, err := s.get(context.Background(), s.endpoint.String()+headPath)
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(res.Body, &err)
+	if res.StatusCode == http.StatusNotFound {
+		return nil
+	}
+
+	if err := NewErr(res); err != nil {
+		return err
+	}
+
+	content, err := readAllLimited(res.Body)
+	if err != nil {
+		return err
+	}
+
+	line := strings.TrimSpace(string(content))
+	if strings.HasPrefix(line, "ref: ") {
+		target := strings.TrimPrefix(line, "ref: ")
+		hash, ok := ar.References[target]
+		if !ok {
+			return nil
+		}
+
+		ar.Head = &hash
+		return ar.Capabilities.Add(capability.SymRef,
+			fmt.Sprintf("%s:%s", plumbing.HEAD, target),
+		)
+	}
+
+	if len(line) == 40 {
+		hash := plumbing.NewHash(line)
+		ar.Head = &hash
+	}
+
+	return nil
+}
+
+func readAllLimited(r io.Reader) ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	_, err := io.Copy(buf, io.LimitReader(r, 1<<16))
+	return buf.Bytes(), err
+}
+
+// get requests the given URL, the response is returned regardless of its
+// status code.
+func (s *session) get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, plumbing.NewPermanentError(err)
+	}
+
+	applyHeadersToRequest(req, nil, s.endpoint.Host, transport.UploadPackServiceName)
+	s.ApplyAuthToRequest(req)
+	s.applyConfigToRequest(req)
+
+	res, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, plumbing.NewUnexpectedError(err)
+	}
+
+	return res, nil
+}
+
+// dumbPack is a packfile listed in objects/info/packs of an objects
+// directory.
+type dumbPack struct {
+	name       string
+	idx        *idxfile.MemoryIndex
+	downloaded bool
+}
+
+// objectsDir is an objects directory served by a dumb server, the one of
+// the repository or one of its alternates.
+type objectsDir struct {
+	url   string
+	packs []*dumbPack
+
+	packsLoaded      bool
+	alternatesLoaded bool
+}
+
+// dumbFetcher walks the objects reachable from the wanted objects,
+// downloading the loose objects and packfiles containing them.
+type dumbFetcher struct {
+	s    *session
+	ctx  context.Context
+	dirs []*objectsDir
+	sto  *dumbStorage
+}
+
+func newDumbFetcher(ctx context.Context, s *session) *dumbFetcher {
+	return &dumbFetcher{
+		s:    s,
+		ctx:  ctx,
+		dirs: []*objectsDir{{url: s.endpoint.String() + objectsPath}},
+		sto:  &dumbStorage{loose: memory.NewStorage()},
+	}
+}
+
+// dumbStorage holds the objects downloaded from a dumb server, the loose
+// objects in memory and the packfiles in a temporary directory, where their
+// objects are read from when needed.
+type dumbStorage struct {
+	loose *memory.Storage
+	fs    billy.Filesystem
+	packs []*packfile.Packfile
+}
+
+func (s *dumbStorage) NewEncodedObject() plumbing.EncodedObject {
+	return s.loose.NewEncodedObject()
+}
+
+func (s *dumbStorage) SetEncodedObject(o plumbing.EncodedObject) (plumbing.Hash, error) {
+	return s.loose.SetEncodedObject(o)
+}
+
+func (s *dumbStorage) EncodedObject(t plumbing.ObjectType, h plumbing.Hash) (plumbing.EncodedObject, error) {
+	if o, err := s.loose.EncodedObject(t, h); err != plumbing.ErrObjectNotFound {
+		return o, err
+	}
+
+	for _, p := range s.packs {
+		o, err := p.Get(h)
+		if err == plumbing.ErrObjectNotFound {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if t != plumbing.AnyObject && o.Type() != t {
+			return nil, plumbing.ErrObjectNotFound
+		}
+
+		return o, nil
+	}
+
+	return nil, plumbing.ErrObjectNotFound
+}
+
+func (s *dumbStorage) IterEncodedObjects(t plumbing.ObjectType) (storer.EncodedObjectIter, error) {
+	iter, err := s.loose.IterEncodedObjects(t)
+	if err != nil {
+		return nil, err
+	}
+
+	iters := []storer.EncodedObjectIter{iter}
+	for _, p := range s.packs {
+		iter, err := p.GetByType(t)
+		if err != nil {
+			return nil, err
+		}
+
+		iters = append(iters, iter)
+	}
+
+	return storer.NewMultiEncodedObjectIter(iters), nil
+}
+
+func (s *dumbStorage) HasEncodedObject(h plumbing.Hash) error {
+	_, err := s.EncodedObject(plumbing.AnyObject, h)
+	return err
+}
+
+func (s *dumbStorage) EncodedObjectSize(h plumbing.Hash) (int64, error) {
+	o, err := s.EncodedObject(plumbing.AnyObject, h)
+	if err != nil {
+		return 0, err
+	}
+
+	return o.Size(), nil
+}
+
+// addPack writes the packfile read from r to the temporary directory, its
+// objects are read using the given index.
+func (s *dumbStorage) addPack(name string, idx idxfile.Index, r io.Reader) (err error) {
+	if s.fs == nil {
+		dir, err := stdioutil.TempDir("", "go-git-dumb")
+		if err != nil {
+			return err
+		}
+
+		s.fs = osfs.New(dir)
+	}
+
+	path := name + ".pack"
+	w, err := s.fs.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(w, r); err != nil {
+		_ = w.Close()
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	f, err := s.fs.Open(path)
+	if err != nil {
+		return err
+	}
+
+	s.packs = append(s.packs, packfile.NewPackfile(idx, s.fs, f))
+	return nil
+}
+
+// Close closes the packfiles and removes the temporary directory.
+func (s *dumbStorage) Close() error {
+	var firstErr error
+	for _, p := range s.packs {
+		if err := p.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if s.fs == nil {
+		return firstErr
+	}
+
+	if err := os.RemoveAll(s.fs.Root()); err != nil && firstErr == nil {
+		firstErr = err
+	}
+
+	return firstErr
+}
+
+// dumbUploadPack emulates the upload-pack service on a dumb server, the
+// objects reachable from the wants and not from the haves are downloaded
+// and packed into the packfile of the response, which is encoded as it's
+// read.
+func (s *upSession) dumbUploadPack(
+	ctx context.Context, req *packp.UploadPackRequest,
+) (*packp.UploadPackResponse, error) {
+
+	if !req.Depth.IsZero() || len(req.Shallows) != 0 {
+		return nil, ErrDumbShallowNotSupported
+	}
+
+	f := newDumbFetcher(ctx, s.session)
+	objects, err := f.walk(req.Wants, req.Haves)
+	if err != nil {
+		_ = f.sto.Close()
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	e := packfile.NewEncoder(pw, f.sto, false)
+	go func() {
+		_, err := e.Encode(objects, 0)
+		pw.CloseWithError(err)
+		done <- f.sto.Close()
+	}()
+
+	return packp.NewUploadPackResponseWithPackfile(req, &dumbPackfile{
+		ReadCloser: ioutil.NewContextReadCloser(ctx, pr),
+		done:       done,
+	}), nil
+}
+
+// dumbPackfile is the packfile of the response of a dumb upload-pack, closing
+// it waits for the encoding to stop and the downloaded packfiles to be
+// removed.
+type dumbPackfile struct {
+	io.ReadCloser
+	done <-chan error
+
+	once sync.Once
+	err  error
+}
+
+func (p *dumbPackfile) Close() error {
+	p.once.Do(func() {
+		p.err = p.ReadCloser.Close()
+		if err := <-p.done; p.err == nil {
+			p.err = err
+		}
+	})
+
+	return p.err
+}
+
+// walk returns the objects reachable from wants, stopping at the haves,
+// which are assumed to be complete in the client.
+func (f *dumbFetcher) walk(wants, haves []plumbing.Hash) ([]plumbing.Hash, error) {
+	seen := make(map[plumbing.Hash]bool)
+	for _, h := range haves {
+		seen[h] = true
+	}
+
+	if err := f.markTrees(haves, seen); err != nil {
+		return nil, err
+	}
+
+	var objects []plumbing.Hash
+	pending := append([]plumbing.Hash(nil), wants...)
+	for len(pending) != 0 {
+		h := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if seen[h] {
+			continue
+		}
+
+		seen[h] = true
+		o, err := f.object(h)
+		if err != nil {
+			return nil, err
+		}
+
+		objects = append(objects, h)
+		pending, err = appendReferenced(f.sto, o, pending)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return objects, nil
+}
+
+// markTrees marks as seen the trees and blobs of the given commits, so the
+// unchanged parts of their snapshots aren't downloaded again. Only the trees
+// are read, the haves missing in the server are skipped.
+func (f *dumbFetcher) markTrees(haves []plumbing.Hash, seen map[plumbing.Hash]bool) error {
+	var pending []plumbing.Hash
+	for _, h := range haves {
+		o, err := f.object(h)
+		if err == plumbing.ErrObjectNotFound {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if o.Type() != plumbing.CommitObject {
+			continue
+		}
+
+		commit, err := object.DecodeCommit(f.sto, o)
+		if err != nil {
+			return err
+		}
+
+		pending = append(pending, commit.TreeHash)
+	}
+
+	for len(pending) != 0 {
+		h := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if seen[h] {
+			continue
+		}
+
+		seen[h] = true
+		o, err := f.object(h)
+		if err != nil {
+			return err
+		}
+
+		tree, err := object.DecodeTree(f.sto, o)
+		if err != nil {
+			return err
+		}
+
+		for _, e := range tree.Entries {
+			switch e.Mode {
+			case filemode.Dir:
+				pending = append(pending, e.Hash)
+			case filemode.Submodule:
+			default:
+				seen[e.Hash] = true
+			}
+		}
+	}
+
+	return nil
+}
+
+// appendReferenced appends to pending the objects directly referenced by
+// the given one.
+func appendReferenced(
+	sto storer.EncodedObjectStorer, o plumbing.EncodedObject, pending []plumbing.Hash,
+) ([]plumbing.Hash, error) {
+
+	decoded, err := object.DecodeObject(sto, o)
+	if err != nil {
+		return nil, err
+	}
+
+	switch obj := decoded.(type) {
+	case *object.Commit:
+		pending = append(pending, obj.TreeHash)
+		pending = append(pending, obj.ParentHashes...)
+	case *object.Tree:
+		for _, e := range obj.Entries {
+			if e.Mode == filemode.Submodule {
+				continue
+			}
+
+			pending = append(pending, e.Hash)
+		}
+	case *object.Tag:
+		pending = append(pending, obj.Target)
+	}
+
+	return pending, nil
+}
+
+// object returns the object with the given hash, looking for it in the
+// packfiles and as a loose object, of the repository and its alternates. The
+// packfiles are looked first, since their indexes are downloaded once, while
+// each loose object is a request.
+func (f *dumbFetcher) object(h plumbing.Hash) (plumbing.EncodedObject, error) {
+	if o, err := f.sto.EncodedObject(plumbing.AnyObject, h); err == nil {
+		return o, nil
+	}
+
+	for i := 0; i < len(f.dirs); i++ {
+		dir := f.dirs[i]
+		found, err := f.fetchFromPacks(dir, h)
+		if err != nil {
+			return nil, err
+		}
+
+		if !found {
+			found, err = f.fetchLoose(dir, h)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if found {
+			return f.sto.EncodedObject(plumbing.AnyObject, h)
+		}
+
+		if err := f.loadAlternates(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, plumbing.ErrObjectNotFound
+}
+
+// fetchLoose downloads the loose object with the given hash, returns false
+// if the object directory doesn't contain it.
+func (f *dumbFetcher) fetchLoose(dir *objectsDir, h plumbing.Hash) (found bool, err error) {
+	hash := h.String()
+	res, err := f.getFile(fmt.Sprintf("%s/%s/%s", dir.url, hash[:2], hash[2:]))
+	if err != nil || res == nil {
+		return false, err
+	}
+
+	defer ioutil.CheckClose(res.Body, &err)
+
+	r, err := objfile.NewReader(res.Body)
+	if err != nil {
+		return false, err
+	}
+
+	defer ioutil.CheckClose(r, &err)
+
+	t, size, err := r.Header()
+	if err != nil {
+		return false, err
+	}
+
+	o := f.sto.NewEncodedObject()
+	o.SetType(t)
+	o.SetSize(size)
+
+	w, err := o.Writer()
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := io.Copy(w, r); err != nil {
+		return false, err
+	}
+
+	if err := w.Close(); err != nil {
+		return false, err
+	}
+
+	if r.Hash() != h {
+		return false, fmt.Errorf("loose object %s has a wrong hash %s", h, r.Hash())
+	}
+
+	_, err = f.sto.SetEncodedObject(o)
+	return true, err
+}
+
+// fetchFromPacks downloads the packfile containing the object with the given
+// hash, returns false if none of the packfiles of the objects directory
+// contains it.
+func (f *dumbFetcher) fetchFromPacks(dir *objectsDir, h plumbing.Hash) (bool, error) {
+	if err := f.loadPacks(dir); err != nil {
+		return false, err
+	}
+
+	for _, p := range dir.packs {
+		if p.downloaded {
+			continue
+		}
+
+		if p.idx == nil {
+			idx, err := f.fetchIndex(dir, p.name)
+			if err != nil {
+				return false, err
+			}
+
+			p.idx = idx
+		}
+
+		ok, err := p.idx.Contains(h)
+		if err != nil {
+			return false, err
+		}
+
+		if !ok {
+			continue
+		}
+
+		if err := f.fetchPack(dir, p); err != nil {
+			return false, err
+		}
+
+		p.downloaded = true
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// loadPacks reads the packfiles listed in objects/info/packs.
+func (f *dumbFetcher) loadPacks(dir *objectsDir) (err error) {
+	if dir.packsLoaded {
+		return nil
+	}
+
+	dir.packsLoaded = true
+	res, err := f.getFile(dir.url + infoPacksPath)
+	if err != nil || res == nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(res.Body, &err)
+
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || fields[0] != "P" {
+			continue
+		}
+
+		name := fields[1]
+		if !strings.HasPrefix(name, "pack-") || !strings.HasSuffix(name, ".pack") {
+			continue
+		}
+
+		dir.packs = append(dir.packs, &dumbPack{name: strings.TrimSuffix(name, ".pack")})
+	}
+
+	return scanner.Err()
+}
+
+func (f *dumbFetcher) fetchIndex(dir *objectsDir, name string) (idx *idxfile.MemoryIndex, err error) {
+	url := fmt.Sprintf("%s/pack/%s.idx", dir.url, name)
+	res, err := f.getFile(url)
+	if err != nil {
+		return nil, err
+	}
+
+	if res == nil {
+		return nil, fmt.Errorf("packfile index %q not found", url)
+	}
+
+	defer ioutil.CheckClose(res.Body, &err)
+
+	idx = idxfile.NewMemoryIndex()
+	if err := idxfile.NewDecoder(res.Body).Decode(idx); err != nil {
+		return nil, err
+	}
+
+	return idx, nil
+}
+
+func (f *dumbFetcher) fetchPack(dir *objectsDir, p *dumbPack) (err error) {
+	url := fmt.Sprintf("%s/pack/%s.pack", dir.url, p.name)
+	res, err := f.getFile(url)
+	if err != nil {
+		return err
+	}
+
+	if res == nil {
+		return fmt.Errorf("packfile %q not found", url)
+	}
+
+	defer ioutil.CheckClose(res.Body, &err)
+	return f.sto.addPack(p.name, p.idx, res.Body)
+}
+
+// loadAlternates adds the objects directories listed in
+// objects/info/http-alternates, or if missing objects/info/alternates, to
+// the ones where the objects are looked for.
+func (f *dumbFetcher) loadAlternates(dir *objectsDir) (err error) {
+	if dir.alternatesLoaded {
+		return nil
+	}
+
+	dir.alternatesLoaded = true
+	res, err := f.getFile(dir.url + httpAlternatesPath)
+	if err == nil && res == nil {
+		res, err = f.getFile(dir.url + alternatesPath)
+	}
+
+	if err != nil || res == nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(res.Body, &err)
+
+	base, err := url.Parse(dir.url + "/")
+	if err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		ref, err := url.Parse(line)
+		if err != nil {
+			return err
+		}
+
+		alternate := strings.TrimSuffix(base.ResolveReference(ref).String(), "/")
+		if !f.hasObjectsDir(alternate) {
+			f.dirs = append(f.dirs, &objectsDir{url: alternate})
+		}
+	}
+
+	return scanner.Err()
+}
+
+func (f *dumbFetcher) hasObjectsDir(url string) bool {
+	for _, dir := range f.dirs {
+		if dir.url == url {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getFile requests a file from the server, if it doesn't exist a nil
+// response is returned.
+func (f *dumbFetcher) getFile(url string) (*http.Response, error) {
+	res, err := f.s.get(f.ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusNotFound {
+		_ = res.Body.Close()
+		return nil, nil
+	}
+
+	if err := NewErr(res); err != nil {
+		_ = res.Body.Close()
+		return nil, err
+	}
+
+	return res, nil
+}
@@ -0,0 +1,276 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/objfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git-fixtures.v3"
+)
+
+type DumbSuite struct {
+	fixtures.Suite
+
+	base   string
+	server *httptest.Server
+
+	mu       sync.Mutex
+	requests []string
+}
+
+var _ = Suite(&DumbSuite{})
+
+func (s *DumbSuite) SetUpTest(c *C) {
+	s.base = c.MkDir()
+	s.requests = nil
+
+	files := http.FileServer(http.Dir(s.base))
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r.URL.Path)
+		s.mu.Unlock()
+
+		files.ServeHTTP(w, r)
+	}))
+}
+
+func (s *DumbSuite) TearDownTest(c *C) {
+	s.server.Close()
+}
+
+func (s *DumbSuite) prepareRepository(c *C, f *fixtures.Fixture, name string) *transport.Endpoint {
+	fs := f.DotGit()
+	c.Assert(fixtures.EnsureIsBare(fs), IsNil)
+	c.Assert(os.Rename(fs.Root(), filepath.Join(s.base, name)), IsNil)
+
+	return s.newEndpoint(c, name)
+}
+
+func (s *DumbSuite) newEndpoint(c *C, name string) *transport.Endpoint {
+	ep, err := transport.NewEndpoint(fmt.Sprintf("%s/%s", s.server.URL, name))
+	c.Assert(err, IsNil)
+
+	return ep
+}
+
+func (s *DumbSuite) TestAdvertisedReferences(c *C) {
+	ep := s.prepareRepository(c, fixtures.Basic().One(), "basic.git")
+
+	r, err := DefaultClient.NewUploadPackSession(ep, nil)
+	c.Assert(err, IsNil)
+
+	ar, err := r.AdvertisedReferences()
+	c.Assert(err, IsNil)
+	c.Assert(ar.References, HasLen, 4)
+	c.Assert(ar.References["refs/heads/master"].String(), Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	c.Assert(ar.Head.String(), Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+
+	refs, err := ar.AllReferences()
+	c.Assert(err, IsNil)
+	c.Assert(refs[plumbing.HEAD].Target(), Equals, plumbing.Master)
+}
+
+func (s *DumbSuite) TestAdvertisedReferencesNotExists(c *C) {
+	r, err := DefaultClient.NewUploadPackSession(s.newEndpoint(c, "non-existent.git"), nil)
+	c.Assert(err, IsNil)
+
+	_, err = r.AdvertisedReferences()
+	c.Assert(err, Equals, transport.ErrRepositoryNotFound)
+}
+
+func (s *DumbSuite) TestUploadPack(c *C) {
+	ep := s.prepareRepository(c, fixtures.Basic().One(), "basic.git")
+
+	sto := s.uploadPack(c, ep,
+		[]plumbing.Hash{plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")}, nil,
+	)
+
+	c.Assert(sto.Objects, HasLen, 28)
+}
+
+func (s *DumbSuite) TestUploadPackPackedRequests(c *C) {
+	ep := s.prepareRepository(c, fixtures.Basic().One(), "basic.git")
+
+	tmp := c.MkDir()
+	defer os.Setenv("TMPDIR", os.Getenv("TMPDIR"))
+	os.Setenv("TMPDIR", tmp)
+
+	sto := s.uploadPack(c, ep,
+		[]plumbing.Hash{plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")}, nil,
+	)
+	c.Assert(sto.Objects, HasLen, 28)
+
+	// all the objects are packed, so no loose object is requested
+	var packs int
+	for _, path := range s.requests {
+		path = strings.TrimPrefix(path, "/basic.git/objects/")
+		c.Assert(len(path) == 41 && path[2] == '/', Equals, false, Commentf("%s", path))
+		if strings.HasSuffix(path, ".pack") {
+			packs++
+		}
+	}
+
+	c.Assert(packs, Equals, 1)
+
+	// the packfile was downloaded to a temporary directory, removed once
+	// the response is read
+	dirs, err := filepath.Glob(filepath.Join(tmp, "go-git-dumb*"))
+	c.Assert(err, IsNil)
+	c.Assert(dirs, HasLen, 0)
+}
+
+func (s *DumbSuite) TestUploadPackPartial(c *C) {
+	ep := s.prepareRepository(c, fixtures.Basic().One(), "basic.git")
+
+	sto := s.uploadPack(c, ep,
+		[]plumbing.Hash{plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")},
+		[]plumbing.Hash{plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294")},
+	)
+
+	commit, err := object.GetCommit(sto, plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	c.Assert(err, IsNil)
+	c.Assert(commit.Message, Equals, "vendor stuff\n")
+
+	_, err = object.GetCommit(sto, plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294"))
+	c.Assert(err, Equals, plumbing.ErrObjectNotFound)
+}
+
+func (s *DumbSuite) TestUploadPackLooseAndAlternates(c *C) {
+	s.prepareRepository(c, fixtures.Basic().One(), "basic.git")
+
+	// the fork only contains a loose commit on top of master, the rest of
+	// the objects are borrowed from the alternate
+	fork := filepath.Join(s.base, "fork.git")
+	parent := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	commit := &object.Commit{
+		Author:       object.Signature{Name: "foo", Email: "foo@foo.foo"},
+		Committer:    object.Signature{Name: "foo", Email: "foo@foo.foo"},
+		Message:      "fork\n",
+		TreeHash:     plumbing.NewHash("a8d315b2b1c615d43042c3a62402b8a54288cf5c"),
+		ParentHashes: []plumbing.Hash{parent},
+	}
+
+	obj := &plumbing.MemoryObject{}
+	c.Assert(commit.Encode(obj), IsNil)
+	writeLooseObject(c, fork, obj)
+
+	writeFile(c, filepath.Join(fork, "objects", "info", "http-alternates"), "../../basic.git/objects\n")
+	writeFile(c, filepath.Join(fork, "info", "refs"), fmt.Sprintf("%s\trefs/heads/master\n", obj.Hash()))
+	writeFile(c, filepath.Join(fork, "HEAD"), "ref: refs/heads/master\n")
+
+	sto := s.uploadPack(c, s.newEndpoint(c, "fork.git"), []plumbing.Hash{obj.Hash()}, nil)
+	c.Assert(sto.Objects, HasLen, 29)
+
+	iter := object.NewCommitPreorderIter(mustCommit(c, sto, obj.Hash()), nil, nil)
+
+	var count int
+	c.Assert(iter.ForEach(func(*object.Commit) error {
+		count++
+		return nil
+	}), IsNil)
+	c.Assert(count, Equals, 9)
+
+	// the snapshot of the have is in the client, so only the commit is
+	// downloaded
+	partial := s.uploadPack(c, s.newEndpoint(c, "fork.git"),
+		[]plumbing.Hash{obj.Hash()}, []plumbing.Hash{parent},
+	)
+	c.Assert(partial.Objects, HasLen, 1)
+	c.Assert(partial.Objects[obj.Hash()], NotNil)
+}
+
+func (s *DumbSuite) TestUploadPackShallow(c *C) {
+	ep := s.prepareRepository(c, fixtures.Basic().One(), "basic.git")
+
+	r, err := DefaultClient.NewUploadPackSession(ep, nil)
+	c.Assert(err, IsNil)
+	_, err = r.AdvertisedReferences()
+	c.Assert(err, IsNil)
+
+	req := packp.NewUploadPackRequest()
+	req.Wants = append(req.Wants, plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	req.Depth = packp.DepthCommits(1)
+
+	_, err = r.UploadPack(context.Background(), req)
+	c.Assert(err, Equals, ErrDumbShallowNotSupported)
+}
+
+func (s *DumbSuite) TestReceivePack(c *C) {
+	ep := s.prepareRepository(c, fixtures.Basic().One(), "basic.git")
+
+	r, err := DefaultClient.NewReceivePackSession(ep, nil)
+	c.Assert(err, IsNil)
+
+	_, err = r.AdvertisedReferences()
+	c.Assert(err, Equals, ErrDumbPushNotSupported)
+}
+
+func (s *DumbSuite) uploadPack(c *C, ep *transport.Endpoint, wants, haves []plumbing.Hash) *memory.Storage {
+	r, err := DefaultClient.NewUploadPackSession(ep, nil)
+	c.Assert(err, IsNil)
+	defer func() { c.Assert(r.Close(), IsNil) }()
+
+	_, err = r.AdvertisedReferences()
+	c.Assert(err, IsNil)
+
+	req := packp.NewUploadPackRequest()
+	req.Wants = wants
+	req.Haves = haves
+
+	reader, err := r.UploadPack(context.Background(), req)
+	c.Assert(err, IsNil)
+	defer func() { c.Assert(reader.Close(), IsNil) }()
+
+	sto := memory.NewStorage()
+	c.Assert(packfile.UpdateObjectStorage(sto, reader), IsNil)
+	return sto
+}
+
+func mustCommit(c *C, sto *memory.Storage, h plumbing.Hash) *object.Commit {
+	commit, err := object.GetCommit(sto, h)
+	c.Assert(err, IsNil)
+	return commit
+}
+
+func writeLooseObject(c *C, repo string, obj plumbing.EncodedObject) {
+	hash := obj.Hash().String()
+	path := filepath.Join(repo, "objects", hash[:2], hash[2:])
+	c.Assert(os.MkdirAll(filepath.Dir(path), 0755), IsNil)
+
+	f, err := os.Create(path)
+	c.Assert(err, IsNil)
+	defer func() { c.Assert(f.Close(), IsNil) }()
+
+	w := objfile.NewWriter(f)
+	c.Assert(w.WriteHeader(obj.Type(), obj.Size()), IsNil)
+
+	r, err := obj.Reader()
+	c.Assert(err, IsNil)
+
+	content, err := ioutil.ReadAll(r)
+	c.Assert(err, IsNil)
+
+	_, err = w.Write(content)
+	c.Assert(err, IsNil)
+	c.Assert(w.Close(), IsNil)
+}
+
+func writeFile(c *C, path, content string) {
+	c.Assert(os.MkdirAll(filepath.Dir(path), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(path, []byte(content), 0644), IsNil)
+}
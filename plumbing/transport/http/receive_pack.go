@@ -19,7 +19,7 @@ type rpSession struct {
 	*session
 }
 
-func newReceivePackSession(c *http.Client, ep *transport.Endpoint, auth transport.AuthMethod) (transport.ReceivePackSession, error) {
+func newReceivePackSession(c *client, ep *transport.Endpoint, auth transport.AuthMethod) (transport.ReceivePackSession, error) {
 	s, err := newSession(c, ep, auth)
 	return &rpSession{s}, err
 }
@@ -91,6 +91,7 @@ func (s *rpSession) doRequest(
 
 	applyHeadersToRequest(req, content, s.endpoint.Host, transport.ReceivePackServiceName)
 	s.ApplyAuthToRequest(req)
+	s.applyConfigToRequest(req)
 
 	res, err := s.client.Do(req.WithContext(ctx))
 	if err != nil {
@@ -99,6 +100,12 @@ func (s *rpSession) doRequest(
 
 	if err := NewErr(res); err != nil {
 		_ = res.Body.Close()
+		if res.StatusCode == http.StatusUnauthorized {
+			if rerr := s.rejectCredentials(); rerr != nil {
+				return nil, rerr
+			}
+		}
+
 		return nil, err
 	}
 
@@ -19,7 +19,7 @@ type upSession struct {
 	*session
 }
 
-func newUploadPackSession(c *http.Client, ep *transport.Endpoint, auth transport.AuthMethod) (transport.UploadPackSession, error) {
+func newUploadPackSession(c *client, ep *transport.Endpoint, auth transport.AuthMethod) (transport.UploadPackSession, error) {
 	s, err := newSession(c, ep, auth)
 	return &upSession{s}, err
 }
@@ -36,6 +36,10 @@ func (s *upSession) UploadPack(
 		return nil, transport.ErrEmptyUploadPackRequest
 	}
 
+	if s.dumb {
+		return s.dumbUploadPack(ctx, req)
+	}
+
 	if err := req.Validate(); err != nil {
 		return nil, err
 	}
@@ -89,6 +93,7 @@ func (s *upSession) doRequest(
 
 	applyHeadersToRequest(req, content, s.endpoint.Host, transport.UploadPackServiceName)
 	s.ApplyAuthToRequest(req)
+	s.applyConfigToRequest(req)
 
 	res, err := s.client.Do(req.WithContext(ctx))
 	if err != nil {
@@ -97,6 +102,12 @@ func (s *upSession) doRequest(
 
 	if err := NewErr(res); err != nil {
 		_ = res.Body.Close()
+		if res.StatusCode == http.StatusUnauthorized {
+			if rerr := s.rejectCredentials(); rerr != nil {
+				return nil, rerr
+			}
+		}
+
 		return nil, err
 	}
 
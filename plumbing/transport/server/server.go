@@ -175,13 +175,11 @@ func (s *upSession) UploadPack(ctx context.Context, req *packp.UploadPackRequest
 	), nil
 }
 
+// objectsToUpload returns the objects reachable from the wants that aren't
+// reachable from the haves. With reachability bitmaps in the storer, the
+// history of the commits with a bitmap isn't walked.
 func (s *upSession) objectsToUpload(req *packp.UploadPackRequest) ([]plumbing.Hash, error) {
-	haves, err := revlist.Objects(s.storer, req.Haves, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	return revlist.Objects(s.storer, req.Wants, haves)
+	return revlist.Objects(s.storer, req.Wants, req.Haves)
 }
 
 func (*upSession) setSupportedCapabilities(c *capability.List) error {
@@ -5,12 +5,12 @@ import (
 	"context"
 	"fmt"
 	"reflect"
-	"strconv"
 
 	"gopkg.in/src-d/go-git.v4/plumbing/transport"
 	"gopkg.in/src-d/go-git.v4/plumbing/transport/internal/common"
 
 	"github.com/kevinburke/ssh_config"
+	"github.com/mitchellh/go-homedir"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/net/proxy"
 )
@@ -63,6 +63,7 @@ type command struct {
 	client    *ssh.Client
 	auth      AuthMethod
 	config    *ssh.ClientConfig
+	host      *hostConfig
 }
 
 func (c *command) setAuth(auth transport.AuthMethod) error {
@@ -117,7 +118,7 @@ func (c *command) connect() error {
 
 	overrideConfig(c.config, config)
 
-	c.client, err = dial("tcp", c.getHostWithPort(), config)
+	c.client, err = c.dial(config)
 	if err != nil {
 		return err
 	}
@@ -132,6 +133,20 @@ func (c *command) connect() error {
 	return nil
 }
 
+// dial connects to the host using its ProxyCommand or ProxyJump options, if
+// any, from the ssh_config files.
+func (c *command) dial(config *ssh.ClientConfig) (*ssh.Client, error) {
+	hc := c.hostConfig()
+	switch {
+	case hc.proxyCommand != "":
+		return dialCommand(hc, config)
+	case hc.proxyJump != "":
+		return dialJumps(hc, config)
+	default:
+		return dial("tcp", hc.address(), config)
+	}
+}
+
 func dial(network, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
 	var (
 		ctx    = context.Background()
@@ -148,59 +163,51 @@ func dial(network, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
 	if err != nil {
 		return nil, err
 	}
-	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
-	if err != nil {
-		return nil, err
-	}
-	return ssh.NewClient(c, chans, reqs), nil
+
+	return newClient(conn, addr, config)
 }
 
 func (c *command) getHostWithPort() string {
-	if addr, found := c.doGetHostWithPortFromSSHConfig(); found {
-		return addr
-	}
-
-	host := c.endpoint.Host
-	port := c.endpoint.Port
-	if port <= 0 {
-		port = DefaultPort
-	}
-
-	return fmt.Sprintf("%s:%d", host, port)
+	return c.hostConfig().address()
 }
 
-func (c *command) doGetHostWithPortFromSSHConfig() (addr string, found bool) {
-	if DefaultSSHConfig == nil {
-		return
+// hostConfig returns the configuration of the endpoint host, resolved through
+// the ssh_config files.
+func (c *command) hostConfig() *hostConfig {
+	if c.host == nil {
+		c.host = newHostConfig(c.endpoint.Host, c.endpoint.Port, c.endpoint.User)
 	}
 
-	host := c.endpoint.Host
-	port := c.endpoint.Port
+	return c.host
+}
 
-	configHost := DefaultSSHConfig.Get(c.endpoint.Host, "Hostname")
-	if configHost != "" {
-		host = configHost
-		found = true
-	}
+// setAuthFromEndpoint uses the IdentityFile configured for the host, if it can
+// be read without a password, otherwise the auth method is created by
+// DefaultAuthBuilder.
+func (c *command) setAuthFromEndpoint() error {
+	hc := c.hostConfig()
+	if hc.identityFile != "" {
+		user := hc.user
+		if user == "" {
+			var err error
+			if user, err = username(); err != nil {
+				return err
+			}
+		}
 
-	if !found {
-		return
-	}
+		path, err := homedir.Expand(hc.identityFile)
+		if err != nil {
+			return err
+		}
 
-	configPort := DefaultSSHConfig.Get(c.endpoint.Host, "Port")
-	if configPort != "" {
-		if i, err := strconv.Atoi(configPort); err == nil {
-			port = i
+		if auth, err := NewPublicKeysFromFile(user, path, ""); err == nil {
+			c.auth = auth
+			return nil
 		}
 	}
 
-	addr = fmt.Sprintf("%s:%d", host, port)
-	return
-}
-
-func (c *command) setAuthFromEndpoint() error {
 	var err error
-	c.auth, err = DefaultAuthBuilder(c.endpoint.User)
+	c.auth, err = DefaultAuthBuilder(hc.user)
 	return err
 }
 
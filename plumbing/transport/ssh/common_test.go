@@ -91,7 +91,92 @@ func (s *SuiteCommon) TestDefaultSSHConfigWildcard(c *C) {
 	c.Assert(err, IsNil)
 
 	cmd := &command{endpoint: ep}
-	c.Assert(cmd.getHostWithPort(), Equals, "github.com:22")
+	c.Assert(cmd.getHostWithPort(), Equals, "github.com:42")
+}
+
+func (s *SuiteCommon) TestDefaultSSHConfigEndpointPort(c *C) {
+	defer func() {
+		DefaultSSHConfig = ssh_config.DefaultUserSettings
+	}()
+
+	DefaultSSHConfig = &mockSSHConfig{map[string]map[string]string{
+		"github.com": {
+			"Hostname": "foo.local",
+			"Port":     "42",
+		},
+	}}
+
+	ep, err := transport.NewEndpoint("ssh://git@github.com:2222/foo/bar.git")
+	c.Assert(err, IsNil)
+
+	cmd := &command{endpoint: ep}
+	c.Assert(cmd.getHostWithPort(), Equals, "foo.local:2222")
+}
+
+func (s *SuiteCommon) TestDefaultSSHConfigAlias(c *C) {
+	defer func() {
+		DefaultSSHConfig = ssh_config.DefaultUserSettings
+	}()
+
+	DefaultSSHConfig = &mockSSHConfig{map[string]map[string]string{
+		"work": {
+			"Hostname":     "%h.example.com",
+			"User":         "bar",
+			"IdentityFile": "~/.ssh/work",
+			"ProxyJump":    "jump@bastion:2222,[::1]",
+		},
+		"bastion": {
+			"Hostname": "bastion.example.com",
+		},
+	}}
+
+	ep, err := transport.NewEndpoint("ssh://work/foo/bar.git")
+	c.Assert(err, IsNil)
+
+	hc := (&command{endpoint: ep}).hostConfig()
+	c.Assert(hc.address(), Equals, "work.example.com:22")
+	c.Assert(hc.user, Equals, "bar")
+	c.Assert(hc.identityFile, Equals, "~/.ssh/work")
+
+	jumps := hc.jumpHosts()
+	c.Assert(jumps, HasLen, 2)
+	c.Assert(jumps[0].address(), Equals, "bastion.example.com:2222")
+	c.Assert(jumps[0].user, Equals, "jump")
+	c.Assert(jumps[1].address(), Equals, "[::1]:22")
+	c.Assert(jumps[1].user, Equals, "")
+}
+
+func (s *SuiteCommon) TestDefaultSSHConfigNone(c *C) {
+	defer func() {
+		DefaultSSHConfig = ssh_config.DefaultUserSettings
+	}()
+
+	DefaultSSHConfig = &mockSSHConfig{map[string]map[string]string{
+		"github.com": {
+			"ProxyJump":    "none",
+			"ProxyCommand": "none",
+		},
+	}}
+
+	ep, err := transport.NewEndpoint("git@github.com:foo/bar.git")
+	c.Assert(err, IsNil)
+
+	hc := (&command{endpoint: ep}).hostConfig()
+	c.Assert(hc.proxyJump, Equals, "")
+	c.Assert(hc.proxyCommand, Equals, "")
+	c.Assert(hc.jumpHosts(), HasLen, 0)
+}
+
+func (s *SuiteCommon) TestExpandProxyCommand(c *C) {
+	hc := &hostConfig{
+		alias:        "work",
+		hostname:     "work.example.com",
+		port:         2222,
+		user:         "bar",
+		proxyCommand: "connect %r@%h:%p %n 100%%",
+	}
+
+	c.Assert(hc.expandProxyCommand(), Equals, "connect bar@work.example.com:2222 work 100%")
 }
 
 type mockSSHConfig struct {
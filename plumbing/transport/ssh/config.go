@@ -0,0 +1,135 @@
+package ssh
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/kevinburke/ssh_config"
+)
+
+// hostConfig holds the parameters used to connect to a host, resolved from
+// the endpoint and the ssh_config files.
+type hostConfig struct {
+	// alias is the host as written in the endpoint, or in the ProxyJump.
+	alias    string
+	hostname string
+	port     int
+	user     string
+	// identityFile is the private key configured for the host, if any.
+	identityFile string
+	// proxyJump is the comma separated list of jump hosts, if any.
+	proxyJump string
+	// proxyCommand is the command used to connect to the host, if any.
+	proxyCommand string
+}
+
+// newHostConfig resolves the given host through DefaultSSHConfig. The port and
+// the user of the endpoint, if set, take precedence over the configured ones.
+func newHostConfig(host string, port int, user string) *hostConfig {
+	// the scp-like endpoints have always a port, so the default one is
+	// considered as not set
+	if port == DefaultPort {
+		port = 0
+	}
+
+	hc := &hostConfig{alias: host, hostname: host, port: port, user: user}
+	if DefaultSSHConfig != nil {
+		hc.load(DefaultSSHConfig)
+	}
+
+	if hc.port <= 0 {
+		hc.port = DefaultPort
+	}
+
+	return hc
+}
+
+func (hc *hostConfig) load(cfg sshConfig) {
+	if v := cfg.Get(hc.alias, "Hostname"); v != "" {
+		hc.hostname = strings.Replace(v, "%h", hc.alias, -1)
+	}
+
+	if hc.port <= 0 {
+		if p, err := strconv.Atoi(cfg.Get(hc.alias, "Port")); err == nil {
+			hc.port = p
+		}
+	}
+
+	if hc.user == "" {
+		hc.user = cfg.Get(hc.alias, "User")
+	}
+
+	// the default IdentityFile of ssh_config is the key of the protocol 1,
+	// so it's only used if explicitly configured
+	if v := cfg.Get(hc.alias, "IdentityFile"); v != ssh_config.Default("IdentityFile") {
+		hc.identityFile = v
+	}
+
+	hc.proxyJump = valueOrNone(cfg.Get(hc.alias, "ProxyJump"))
+	hc.proxyCommand = valueOrNone(cfg.Get(hc.alias, "ProxyCommand"))
+}
+
+// valueOrNone returns the empty string for the "none" value, used to disable
+// options like ProxyJump or ProxyCommand.
+func valueOrNone(v string) string {
+	if strings.EqualFold(v, "none") {
+		return ""
+	}
+
+	return v
+}
+
+// address returns the host and port to connect to.
+func (hc *hostConfig) address() string {
+	return net.JoinHostPort(hc.hostname, strconv.Itoa(hc.port))
+}
+
+// jumpHosts returns the configuration of the jump hosts of the ProxyJump
+// option, in the order they are connected.
+func (hc *hostConfig) jumpHosts() []*hostConfig {
+	if hc.proxyJump == "" {
+		return nil
+	}
+
+	var hosts []*hostConfig
+	for _, jump := range strings.Split(hc.proxyJump, ",") {
+		hosts = append(hosts, parseJumpHost(strings.TrimSpace(jump)))
+	}
+
+	return hosts
+}
+
+// parseJumpHost parses a jump host with the form [user@]host[:port] or
+// ssh://[user@]host[:port].
+func parseJumpHost(jump string) *hostConfig {
+	jump = strings.TrimPrefix(jump, "ssh://")
+
+	var user string
+	if i := strings.LastIndex(jump, "@"); i != -1 {
+		user, jump = jump[:i], jump[i+1:]
+	}
+
+	host, port := jump, 0
+	if h, p, err := net.SplitHostPort(jump); err == nil {
+		host = h
+		port, _ = strconv.Atoi(p)
+	} else if strings.HasPrefix(jump, "[") && strings.HasSuffix(jump, "]") {
+		host = jump[1 : len(jump)-1]
+	}
+
+	return newHostConfig(host, port, user)
+}
+
+// expandProxyCommand replaces the tokens of the ProxyCommand option: %h the
+// hostname, %p the port, %r the user, %n the original host and %% a literal
+// '%'.
+func (hc *hostConfig) expandProxyCommand() string {
+	return strings.NewReplacer(
+		"%%", "%",
+		"%h", hc.hostname,
+		"%p", strconv.Itoa(hc.port),
+		"%r", hc.user,
+		"%n", hc.alias,
+	).Replace(hc.proxyCommand)
+}
@@ -0,0 +1,126 @@
+package ssh
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// KnownHosts verifies the host keys against known_hosts files, both with
+// plain and hashed hostnames. With TrustOnFirstUse the keys of the unknown
+// hosts are accepted and recorded, as the accept-new value of the
+// StrictHostKeyChecking option of ssh_config.
+type KnownHosts struct {
+	// Files are the known_hosts files, if empty the files returned by
+	// NewKnownHostsCallback are used. The new hosts are written to the first
+	// file, it's created if it doesn't exist.
+	Files []string
+	// TrustOnFirstUse accepts the keys of the hosts not present in the files.
+	// The keys of the known hosts are still verified.
+	TrustOnFirstUse bool
+	// HashHosts writes the new hostnames hashed, as the HashKnownHosts option
+	// of ssh_config.
+	HashHosts bool
+
+	mu       sync.Mutex
+	callback ssh.HostKeyCallback
+}
+
+// HostKeyCallback returns a ssh.HostKeyCallback verifying the keys with the
+// known_hosts files.
+func (k *KnownHosts) HostKeyCallback() (ssh.HostKeyCallback, error) {
+	if !k.TrustOnFirstUse {
+		return NewKnownHostsCallback(k.Files...)
+	}
+
+	if len(k.Files) == 0 {
+		files, err := getDefaultKnownHostsFiles()
+		if err != nil {
+			return nil, err
+		}
+
+		k.Files = files
+	}
+
+	if err := k.load(); err != nil {
+		return nil, err
+	}
+
+	return k.check, nil
+}
+
+// load reads the existing files, the missing ones are ignored.
+func (k *KnownHosts) load() error {
+	var files []string
+	for _, f := range k.Files {
+		if _, err := os.Stat(f); err == nil {
+			files = append(files, f)
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	callback, err := knownhosts.New(files...)
+	if err != nil {
+		return err
+	}
+
+	k.callback = callback
+	return nil
+}
+
+func (k *KnownHosts) check(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	err := k.callback(hostname, remote, key)
+	if err == nil {
+		return nil
+	}
+
+	keyErr, ok := err.(*knownhosts.KeyError)
+	if !ok {
+		return err
+	}
+
+	// the host is known with a different key
+	if len(keyErr.Want) != 0 {
+		return err
+	}
+
+	if err := k.add(hostname, key); err != nil {
+		return err
+	}
+
+	return k.load()
+}
+
+// add appends the host key to the first file.
+func (k *KnownHosts) add(hostname string, key ssh.PublicKey) error {
+	host := knownhosts.Normalize(hostname)
+	if k.HashHosts {
+		host = knownhosts.HashHostname(host)
+	}
+
+	path := k.Files[0]
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(f, "%s %s", host, ssh.MarshalAuthorizedKey(key))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
@@ -0,0 +1,86 @@
+package ssh
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"golang.org/x/crypto/ssh/testdata"
+
+	. "gopkg.in/check.v1"
+)
+
+type KnownHostsSuite struct{}
+
+var _ = Suite(&KnownHostsSuite{})
+
+func (s *KnownHostsSuite) publicKey(c *C, name string) ssh.PublicKey {
+	signer, err := ssh.ParsePrivateKey(testdata.PEMBytes[name])
+	c.Assert(err, IsNil)
+	return signer.PublicKey()
+}
+
+func (s *KnownHostsSuite) TestTrustOnFirstUse(c *C) {
+	file := filepath.Join(c.MkDir(), ".ssh", "known_hosts")
+	k := &KnownHosts{Files: []string{file}, TrustOnFirstUse: true}
+
+	callback, err := k.HostKeyCallback()
+	c.Assert(err, IsNil)
+
+	key := s.publicKey(c, "rsa")
+	c.Assert(callback("github.com:22", mockKnownHosts{}, key), IsNil)
+	c.Assert(callback("github.com:22", mockKnownHosts{}, key), IsNil)
+
+	content, err := ioutil.ReadFile(file)
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "github.com "+string(ssh.MarshalAuthorizedKey(key)))
+
+	err = callback("github.com:22", mockKnownHosts{}, s.publicKey(c, "ecdsa"))
+	c.Assert(err, FitsTypeOf, &knownhosts.KeyError{})
+
+	// the written file is valid for the callbacks not trusting new hosts
+	strict, err := NewKnownHostsCallback(file)
+	c.Assert(err, IsNil)
+	c.Assert(strict("github.com:22", mockKnownHosts{}, key), IsNil)
+}
+
+func (s *KnownHostsSuite) TestTrustOnFirstUseHashed(c *C) {
+	file := filepath.Join(c.MkDir(), "known_hosts")
+	k := &KnownHosts{Files: []string{file}, TrustOnFirstUse: true, HashHosts: true}
+
+	callback, err := k.HostKeyCallback()
+	c.Assert(err, IsNil)
+
+	key := s.publicKey(c, "ed25519")
+	c.Assert(callback("example.com:2222", mockKnownHosts{}, key), IsNil)
+
+	content, err := ioutil.ReadFile(file)
+	c.Assert(err, IsNil)
+	c.Assert(strings.HasPrefix(string(content), "|1|"), Equals, true)
+	c.Assert(strings.Contains(string(content), "example.com"), Equals, false)
+
+	strict, err := NewKnownHostsCallback(file)
+	c.Assert(err, IsNil)
+	c.Assert(strict("example.com:2222", mockKnownHosts{}, key), IsNil)
+
+	err = strict("example.com:22", mockKnownHosts{}, key)
+	c.Assert(err, FitsTypeOf, &knownhosts.KeyError{})
+}
+
+func (s *KnownHostsSuite) TestWithoutTrustOnFirstUse(c *C) {
+	file := filepath.Join(c.MkDir(), "known_hosts")
+	c.Assert(ioutil.WriteFile(file, mockKnownHosts{}.knownHosts(), 0600), IsNil)
+
+	k := &KnownHosts{Files: []string{file}}
+	callback, err := k.HostKeyCallback()
+	c.Assert(err, IsNil)
+
+	err = callback("example.com:22", mockKnownHosts{}, s.publicKey(c, "rsa"))
+	c.Assert(err, FitsTypeOf, &knownhosts.KeyError{})
+
+	content, err := ioutil.ReadFile(file)
+	c.Assert(err, IsNil)
+	c.Assert(content, DeepEquals, mockKnownHosts{}.knownHosts())
+}
@@ -0,0 +1,164 @@
+package ssh
+
+import (
+	"io"
+	"net"
+	"os/exec"
+	"runtime"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// dialJumps connects to the host through its chain of jump hosts. The first
+// jump host is dialed as any other host, so the proxy environment variables
+// are honored, the following ones are reached through the previous.
+func dialJumps(hc *hostConfig, config *ssh.ClientConfig) (*ssh.Client, error) {
+	var client *ssh.Client
+	for _, jump := range hc.jumpHosts() {
+		next, err := dialThrough(client, jump.address(), jumpConfig(config, jump))
+		if err != nil {
+			if client != nil {
+				_ = client.Close()
+			}
+
+			return nil, err
+		}
+
+		client = next
+	}
+
+	return dialThrough(client, hc.address(), config)
+}
+
+// jumpConfig returns a copy of config for the given jump host, which may be
+// logged in as a different user.
+func jumpConfig(config *ssh.ClientConfig, jump *hostConfig) *ssh.ClientConfig {
+	c := *config
+	if jump.user != "" {
+		c.User = jump.user
+	}
+
+	return &c
+}
+
+// dialThrough connects to addr using the via client, or directly if it's nil.
+// The via client is closed along with the returned one.
+func dialThrough(via *ssh.Client, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	if via == nil {
+		return dial("tcp", addr, config)
+	}
+
+	conn, err := via.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return newClient(&chainedConn{Conn: conn, via: via}, addr, config)
+}
+
+// chainedConn is a connection opened through a jump host.
+type chainedConn struct {
+	net.Conn
+	via *ssh.Client
+}
+
+// Close closes the connection and the jump host client.
+func (c *chainedConn) Close() error {
+	err := c.Conn.Close()
+	if verr := c.via.Close(); err == nil {
+		err = verr
+	}
+
+	return err
+}
+
+// dialCommand connects to the host using the standard input and output of its
+// ProxyCommand.
+func dialCommand(hc *hostConfig, config *ssh.ClientConfig) (*ssh.Client, error) {
+	conn, err := newCommandConn(hc.expandProxyCommand())
+	if err != nil {
+		return nil, err
+	}
+
+	return newClient(conn, hc.address(), config)
+}
+
+func newClient(conn net.Conn, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// commandConn is a net.Conn over the standard input and output of a command.
+type commandConn struct {
+	io.Reader
+	io.WriteCloser
+	cmd *exec.Cmd
+}
+
+func newCommandConn(command string) (*commandConn, error) {
+	cmd := exec.Command("sh", "-c", command)
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	return &commandConn{Reader: stdout, WriteCloser: stdin, cmd: cmd}, nil
+}
+
+// Close closes the standard input of the command and kills it.
+func (c *commandConn) Close() error {
+	_ = c.WriteCloser.Close()
+	_ = c.cmd.Process.Kill()
+	_ = c.cmd.Wait()
+	return nil
+}
+
+func (c *commandConn) LocalAddr() net.Addr {
+	return commandAddr(c.cmd.Path)
+}
+
+func (c *commandConn) RemoteAddr() net.Addr {
+	return commandAddr(c.cmd.Path)
+}
+
+func (c *commandConn) SetDeadline(time.Time) error {
+	return nil
+}
+
+func (c *commandConn) SetReadDeadline(time.Time) error {
+	return nil
+}
+
+func (c *commandConn) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+// commandAddr is the address of a commandConn.
+type commandAddr string
+
+func (a commandAddr) Network() string {
+	return "command"
+}
+
+func (a commandAddr) String() string {
+	return string(a)
+}
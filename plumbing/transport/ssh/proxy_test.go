@@ -2,11 +2,15 @@ package ssh
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"os"
+	"runtime"
 
 	"github.com/armon/go-socks5"
+	"github.com/gliderlabs/ssh"
+	"github.com/kevinburke/ssh_config"
 	. "gopkg.in/check.v1"
 )
 
@@ -34,3 +38,63 @@ func (s *ProxySuite) SetUpSuite(c *C) {
 		log.Fatal(server.Serve(l))
 	}()
 }
+
+type JumpSuite struct {
+	UploadPackSuite
+}
+
+var _ = Suite(&JumpSuite{})
+
+func (s *JumpSuite) SetUpSuite(c *C) {
+	s.UploadPackSuite.SetUpSuite(c)
+
+	l, err := net.Listen("tcp", "localhost:0")
+	c.Assert(err, IsNil)
+
+	server := &ssh.Server{
+		LocalPortForwardingCallback: func(ssh.Context, string, uint32) bool {
+			return true
+		},
+		ChannelHandlers: map[string]ssh.ChannelHandler{
+			"direct-tcpip": ssh.DirectTCPIPHandler,
+		},
+	}
+
+	go func() {
+		log.Fatal(server.Serve(l))
+	}()
+
+	DefaultSSHConfig = &mockSSHConfig{map[string]map[string]string{
+		"localhost": {
+			"ProxyJump": fmt.Sprintf("jump@localhost:%d", l.Addr().(*net.TCPAddr).Port),
+		},
+	}}
+}
+
+func (s *JumpSuite) TearDownSuite(c *C) {
+	DefaultSSHConfig = ssh_config.DefaultUserSettings
+}
+
+type CommandConnSuite struct{}
+
+var _ = Suite(&CommandConnSuite{})
+
+func (s *CommandConnSuite) TestReadWrite(c *C) {
+	if runtime.GOOS == "windows" {
+		c.Skip("cat is not available")
+	}
+
+	conn, err := newCommandConn("cat")
+	c.Assert(err, IsNil)
+
+	_, err = conn.Write([]byte("foo"))
+	c.Assert(err, IsNil)
+
+	buf := make([]byte, 3)
+	_, err = io.ReadFull(conn, buf)
+	c.Assert(err, IsNil)
+	c.Assert(string(buf), Equals, "foo")
+	c.Assert(conn.RemoteAddr().Network(), Equals, "command")
+
+	c.Assert(conn.Close(), IsNil)
+}
@@ -42,7 +42,12 @@ func (s *UploadPackSuite) SetUpSuite(c *C) {
 	c.Assert(err, IsNil)
 
 	DefaultAuthBuilder = func(user string) (AuthMethod, error) {
-		return &Password{User: user}, nil
+		return &Password{
+			User: user,
+			HostKeyCallbackHelper: HostKeyCallbackHelper{
+				HostKeyCallback: stdssh.InsecureIgnoreHostKey(),
+			},
+		}, nil
 	}
 
 	s.UploadPackSuite.Client = NewClient(&stdssh.ClientConfig{
@@ -5,9 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/url"
+	"strings"
 
 	"gopkg.in/src-d/go-billy.v4/osfs"
 	"gopkg.in/src-d/go-git.v4/config"
+	giturl "gopkg.in/src-d/go-git.v4/internal/url"
 	"gopkg.in/src-d/go-git.v4/plumbing"
 	"gopkg.in/src-d/go-git.v4/plumbing/cache"
 	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
@@ -19,6 +22,8 @@ import (
 	"gopkg.in/src-d/go-git.v4/plumbing/storer"
 	"gopkg.in/src-d/go-git.v4/plumbing/transport"
 	"gopkg.in/src-d/go-git.v4/plumbing/transport/client"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/credential"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
 	"gopkg.in/src-d/go-git.v4/storage"
 	"gopkg.in/src-d/go-git.v4/storage/filesystem"
 	"gopkg.in/src-d/go-git.v4/storage/memory"
@@ -29,27 +34,49 @@ var (
 	NoErrAlreadyUpToDate     = errors.New("already up-to-date")
 	ErrDeleteRefNotSupported = errors.New("server does not support delete-refs")
 	ErrForceNeeded           = errors.New("some refs were not updated")
+	ErrUnshallowComplete     = errors.New("unshallow on a complete repository")
 )
 
+// StaleLeaseError is returned by Push when the remote value of some
+// references with a lease in PushOptions.ForceWithLease isn't the expected
+// one. Those references aren't updated, the rest of the push is performed.
+type StaleLeaseError struct {
+	References []plumbing.ReferenceName
+}
+
+func (e *StaleLeaseError) Error() string {
+	names := make([]string, len(e.References))
+	for i, n := range e.References {
+		names[i] = n.String()
+	}
+
+	return fmt.Sprintf("stale info, rejected references: %s", strings.Join(names, ", "))
+}
+
 const (
 	// This describes the maximum number of commits to walk when
 	// computing the haves to send to a server, for each ref in the
 	// repo containing this remote, when not using the multi-ack
 	// protocol.  Setting this to 0 means there is no limit.
 	maxHavesToVisitPerRef = 100
+
+	// infiniteDepth is the depth requested to unshallow a repository, the
+	// same used by git.
+	infiniteDepth = 0x7fffffff
 )
 
 // Remote represents a connection to a remote repository.
 type Remote struct {
-	c *config.RemoteConfig
-	s storage.Storer
+	c      *config.RemoteConfig
+	s      storage.Storer
+	loader *config.Loader
 }
 
 // NewRemote creates a new Remote.
 // The intended purpose is to use the Remote for tasks such as listing remote references (like using git ls-remote).
 // Otherwise Remotes should be created via the use of a Repository.
 func NewRemote(s storage.Storer, c *config.RemoteConfig) *Remote {
-	return &Remote{s: s, c: c}
+	return &Remote{s: s, c: c, loader: config.NewDefaultLoader()}
 }
 
 // Config returns the RemoteConfig object used to instantiate this Remote.
@@ -80,6 +107,13 @@ func (r *Remote) Push(o *PushOptions) error {
 // operation is complete, an error is returned. The context only affects to the
 // transport operations.
 func (r *Remote) PushContext(ctx context.Context, o *PushOptions) (err error) {
+	if r.c.Mirror && len(o.RefSpecs) == 0 {
+		mirror := *o
+		mirror.RefSpecs = []config.RefSpec{refspecMirror}
+		mirror.Prune = true
+		o = &mirror
+	}
+
 	if err := o.Validate(); err != nil {
 		return err
 	}
@@ -88,7 +122,13 @@ func (r *Remote) PushContext(ctx context.Context, o *PushOptions) (err error) {
 		return fmt.Errorf("remote names don't match: %s != %s", o.RemoteName, r.c.Name)
 	}
 
-	s, err := newSendPackSession(r.c.URLs[0], o.Auth)
+	cfg, err := r.mergedConfig()
+	if err != nil {
+		return err
+	}
+
+	endpoint := cfg.RewritePushURL(r.c.URLs[0])
+	s, err := newSendPackSession(cfg, endpoint, r.auth(cfg, endpoint, o.Auth))
 	if err != nil {
 		return err
 	}
@@ -127,12 +167,22 @@ func (r *Remote) PushContext(ctx context.Context, o *PushOptions) (err error) {
 		return err
 	}
 
-	req, err := r.newReferenceUpdateRequest(o, localRefs, remoteRefs, ar)
+	req, stale, err := r.newReferenceUpdateRequest(o, localRefs, remoteRefs, ar)
 	if err != nil {
 		return err
 	}
 
+	if o.FollowTags || cfg.Push.FollowTags {
+		if err := r.addFollowTags(localRefs, remoteRefs, req); err != nil {
+			return err
+		}
+	}
+
 	if len(req.Commands) == 0 {
+		if stale != nil {
+			return stale
+		}
+
 		return NoErrAlreadyUpToDate
 	}
 
@@ -155,12 +205,12 @@ func (r *Remote) PushContext(ctx context.Context, o *PushOptions) (err error) {
 	var hashesToPush []plumbing.Hash
 	// Avoid the expensive revlist operation if we're only doing deletes.
 	if !allDelete {
-		if r.c.IsFirstURLLocal() {
+		if giturl.IsLocalEndpoint(endpoint) {
 			// If we're are pushing to a local repo, it might be much
 			// faster to use a local storage layer to get the commits
 			// to ignore, when calculating the object revlist.
 			localStorer := filesystem.NewStorage(
-				osfs.New(r.c.URLs[0]), cache.NewObjectLRUDefault())
+				osfs.New(endpoint), cache.NewObjectLRUDefault())
 			hashesToPush, err = revlist.ObjectsWithStorageForIgnores(
 				r.s, localStorer, objects, haves)
 		} else {
@@ -190,7 +240,15 @@ func (r *Remote) PushContext(ctx context.Context, o *PushOptions) (err error) {
 		return err
 	}
 
-	return r.updateRemoteReferenceStorage(req, rs)
+	if err := r.updateRemoteReferenceStorage(req, rs); err != nil {
+		return err
+	}
+
+	if stale != nil {
+		return stale
+	}
+
+	return nil
 }
 
 func (r *Remote) useRefDeltas(ar *packp.AdvRefs) bool {
@@ -202,7 +260,7 @@ func (r *Remote) newReferenceUpdateRequest(
 	localRefs []*plumbing.Reference,
 	remoteRefs storer.ReferenceStorer,
 	ar *packp.AdvRefs,
-) (*packp.ReferenceUpdateRequest, error) {
+) (*packp.ReferenceUpdateRequest, *StaleLeaseError, error) {
 	req := packp.NewReferenceUpdateRequestFromCapabilities(ar.Capabilities)
 
 	if o.Progress != nil {
@@ -214,11 +272,204 @@ func (r *Remote) newReferenceUpdateRequest(
 		}
 	}
 
-	if err := r.addReferencesToUpdate(o.RefSpecs, localRefs, remoteRefs, req, o.Prune); err != nil {
-		return nil, err
+	if err := r.addReferencesToUpdate(o.RefSpecs, localRefs, remoteRefs, req, o.Prune, o.ForceWithLease); err != nil {
+		return nil, nil, err
 	}
 
-	return req, nil
+	stale, err := r.checkLeases(o.ForceWithLease, req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return req, stale, nil
+}
+
+// checkLeases removes from the request the commands of the references with
+// a lease, whose current value isn't the expected one. The rejected
+// references are returned as a StaleLeaseError.
+func (r *Remote) checkLeases(leases []ForceWithLease, req *packp.ReferenceUpdateRequest) (*StaleLeaseError, error) {
+	if len(leases) == 0 {
+		return nil, nil
+	}
+
+	var stale []plumbing.ReferenceName
+	commands := req.Commands[:0]
+	for _, cmd := range req.Commands {
+		lease, ok := findLease(leases, cmd.Name)
+		if !ok {
+			commands = append(commands, cmd)
+			continue
+		}
+
+		expected, err := r.leaseExpectedHash(lease, cmd.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		if cmd.Old != expected {
+			stale = append(stale, cmd.Name)
+			continue
+		}
+
+		commands = append(commands, cmd)
+	}
+
+	req.Commands = commands
+	if len(stale) == 0 {
+		return nil, nil
+	}
+
+	return &StaleLeaseError{References: stale}, nil
+}
+
+// leaseExpectedHash returns the value the remote reference is expected to
+// have, the one of the lease or the one of the remote-tracking reference. The
+// zero hash means the reference is expected not to exist.
+func (r *Remote) leaseExpectedHash(lease ForceWithLease, name plumbing.ReferenceName) (plumbing.Hash, error) {
+	if lease.ExpectAbsent {
+		return plumbing.ZeroHash, nil
+	}
+
+	if !lease.Hash.IsZero() {
+		return lease.Hash, nil
+	}
+
+	for _, rs := range r.c.Fetch {
+		if !rs.Match(name) {
+			continue
+		}
+
+		ref, err := r.s.Reference(rs.Dst(name))
+		if err == plumbing.ErrReferenceNotFound {
+			return plumbing.ZeroHash, nil
+		}
+
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		return ref.Hash(), nil
+	}
+
+	return plumbing.ZeroHash, nil
+}
+
+// addFollowTags adds to the request the annotated tags missing on the remote
+// that point to commits reachable from the pushed references.
+func (r *Remote) addFollowTags(
+	localRefs []*plumbing.Reference,
+	remoteRefs storer.ReferenceStorer,
+	req *packp.ReferenceUpdateRequest,
+) error {
+	var reachable map[plumbing.Hash]bool
+	for _, ref := range localRefs {
+		if ref.Type() != plumbing.HashReference || !ref.Name().IsTag() {
+			continue
+		}
+
+		_, err := remoteRefs.Reference(ref.Name())
+		if err == nil {
+			continue
+		}
+
+		if err != plumbing.ErrReferenceNotFound {
+			return err
+		}
+
+		tag, err := object.GetTag(r.s, ref.Hash())
+		if err == plumbing.ErrObjectNotFound {
+			// lightweight tag
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if tag.TargetType != plumbing.CommitObject {
+			continue
+		}
+
+		if reachable == nil {
+			if reachable, err = r.pushedCommits(req); err != nil {
+				return err
+			}
+		}
+
+		if !reachable[tag.Target] || hasCommand(req, ref.Name()) {
+			continue
+		}
+
+		req.Commands = append(req.Commands, &packp.Command{
+			Name: ref.Name(),
+			Old:  plumbing.ZeroHash,
+			New:  ref.Hash(),
+		})
+	}
+
+	return nil
+}
+
+// pushedCommits returns the commits reachable from the new values of the
+// references in the request.
+func (r *Remote) pushedCommits(req *packp.ReferenceUpdateRequest) (map[plumbing.Hash]bool, error) {
+	reachable := make(map[plumbing.Hash]bool)
+	for _, cmd := range req.Commands {
+		if cmd.New.IsZero() {
+			continue
+		}
+
+		c, err := object.GetCommit(r.s, cmd.New)
+		if err == plumbing.ErrObjectNotFound {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		err = object.NewCommitPreorderIter(c, reachable, nil).ForEach(func(c *object.Commit) error {
+			reachable[c.Hash] = true
+			return nil
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return reachable, nil
+}
+
+func hasCommand(req *packp.ReferenceUpdateRequest, name plumbing.ReferenceName) bool {
+	for _, cmd := range req.Commands {
+		if cmd.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// findLease returns the lease of the remote reference, or the lease applying
+// to all the references.
+func findLease(leases []ForceWithLease, name plumbing.ReferenceName) (ForceWithLease, bool) {
+	var all *ForceWithLease
+	for i, l := range leases {
+		if l.RefName == name {
+			return l, true
+		}
+
+		if l.RefName == "" {
+			all = &leases[i]
+		}
+	}
+
+	if all == nil {
+		return ForceWithLease{}, false
+	}
+
+	return *all, true
 }
 
 func (r *Remote) updateRemoteReferenceStorage(
@@ -286,7 +537,66 @@ func (r *Remote) fetch(ctx context.Context, o *FetchOptions) (sto storer.Referen
 		o.RefSpecs = r.c.Fetch
 	}
 
-	s, err := newUploadPackSession(r.c.URLs[0], o.Auth)
+	cfg, err := r.mergedConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	resume := newFetchResume()
+	if err := r.fetchBundleURI(ctx, cfg, o, resume); err != nil && o.Progress != nil {
+		// as git does, the fetch goes on without the bundle
+		fmt.Fprintf(o.Progress, "warning: failed to fetch the bundle: %s\n", err)
+	}
+
+	var f *fetchedRefs
+	err = retry(ctx, o.Retry, func() error {
+		f, err = r.fetchObjects(ctx, cfg, o, resume)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var pruned bool
+	prune, pruneTags := cfg.FetchPrune(r.c.Name)
+	if o.Prune || (prune && !o.NoPrune) {
+		pruned, err = r.pruneReferences(o.RefSpecs, f.local, f.remote, o.PruneTags || pruneTags)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	updated, err := r.updateLocalReferenceStorage(o.RefSpecs, f.refs, f.remote, o.Tags, o.Force)
+	if err != nil {
+		return nil, err
+	}
+
+	if !updated && !pruned && !f.deepen {
+		return f.remote, NoErrAlreadyUpToDate
+	}
+
+	return f.remote, nil
+}
+
+// fetchedRefs are the references involved in a fetch.
+type fetchedRefs struct {
+	// local are the references of the repository before the fetch.
+	local []*plumbing.Reference
+	// remote are the references advertised by the remote.
+	remote memory.ReferenceStorage
+	// refs are the remote references matching the refspecs.
+	refs memory.ReferenceStorage
+	// deepen is true if the history of a shallow repository was deepened.
+	deepen bool
+}
+
+// fetchObjects negotiates with the remote and fetches the objects of the
+// references matching the refspecs, taking into account the objects stored
+// by the previous attempts, kept by resume.
+func (r *Remote) fetchObjects(ctx context.Context, cfg *config.Config, o *FetchOptions,
+	resume *fetchResume) (f *fetchedRefs, err error) {
+
+	s, err := r.newUploadPackSession(cfg, o.Auth)
 	if err != nil {
 		return nil, err
 	}
@@ -303,47 +613,157 @@ func (r *Remote) fetch(ctx context.Context, o *FetchOptions) (sto storer.Referen
 		return nil, err
 	}
 
-	remoteRefs, err := ar.AllReferences()
+	f = &fetchedRefs{}
+	f.remote, err = ar.AllReferences()
 	if err != nil {
 		return nil, err
 	}
 
-	localRefs, err := r.references()
+	f.local, err = r.references()
 	if err != nil {
 		return nil, err
 	}
 
-	refs, err := calculateRefs(o.RefSpecs, remoteRefs, o.Tags)
+	f.refs, err = calculateRefs(o.RefSpecs, f.remote, o.Tags)
 	if err != nil {
 		return nil, err
 	}
 
-	req.Wants, err = getWants(r.s, refs)
+	f.deepen = len(req.Shallows) != 0 && !req.Depth.IsZero()
+	if f.deepen {
+		// deepening needs the tips even if they are already present
+		req.Wants = refsToHashes(f.refs)
+	} else {
+		req.Wants, err = getWants(r.s, f.refs)
+		if err != nil {
+			return nil, err
+		}
+
+		incomplete, err := resume.incomplete(r.s, f.refs)
+		if err != nil {
+			return nil, err
+		}
+
+		req.Wants = append(req.Wants, incomplete...)
+	}
+
 	if len(req.Wants) > 0 {
-		req.Haves, err = getHaves(localRefs, remoteRefs, r.s)
+		haveRefs, err := r.referencesWithAlternates(f.local)
 		if err != nil {
 			return nil, err
 		}
 
-		if err = r.fetchPack(ctx, o, s, req); err != nil {
+		req.Haves, err = getHaves(haveRefs, f.remote, r.s)
+		if err != nil {
+			return nil, err
+		}
+
+		req.Haves = resume.addHaves(req.Haves)
+		if ps, ok := s.(prerequisitesSession); ok {
+			if err = checkPrerequisites(r.s, ps.Prerequisites(), req.Haves); err != nil {
+				return nil, err
+			}
+		}
+
+		if err = r.fetchPack(ctx, o, s, req, resume); err != nil {
 			return nil, err
 		}
 	}
 
-	updated, err := r.updateLocalReferenceStorage(o.RefSpecs, refs, remoteRefs, o.Tags, o.Force)
+	return f, nil
+}
+
+// pruneReferences removes the local references matching the destination of
+// the refspecs whose source doesn't exist on the remote, and if pruneTags is
+// true, the local tags that don't exist on the remote.
+func (r *Remote) pruneReferences(
+	specs []config.RefSpec,
+	localRefs []*plumbing.Reference,
+	remoteRefs storer.ReferenceStorer,
+	pruneTags bool,
+) (updated bool, err error) {
+	if pruneTags {
+		specs = append(specs[:len(specs):len(specs)], refspecAllTags)
+	}
+
+	for _, ref := range localRefs {
+		if ref.Type() != plumbing.HashReference {
+			continue
+		}
+
+		matched, exists := false, false
+		for _, spec := range specs {
+			reverse := spec.Reverse()
+			if !reverse.Match(ref.Name()) {
+				continue
+			}
+
+			matched = true
+			_, err := remoteRefs.Reference(reverse.Dst(ref.Name()))
+			if err == nil {
+				exists = true
+				break
+			}
+
+			if err != plumbing.ErrReferenceNotFound {
+				return updated, err
+			}
+		}
+
+		if !matched || exists {
+			continue
+		}
+
+		if err := r.s.RemoveReference(ref.Name()); err != nil {
+			return updated, err
+		}
+
+		updated = true
+	}
+
+	return updated, nil
+}
+
+// mergedConfig returns the config of all the scopes, used to apply the url
+// rewriting rules and credential helpers configured globally.
+func (r *Remote) mergedConfig() (*config.Config, error) {
+	layered, err := loadLayeredConfig(r.s, r.loader)
 	if err != nil {
 		return nil, err
 	}
 
-	if !updated {
-		return remoteRefs, NoErrAlreadyUpToDate
+	return layered.Config()
+}
+
+// newUploadPackSession opens a session to fetch from the first URL of the
+// remote, rewritten with the url.<base>.insteadOf rules of the config.
+func (r *Remote) newUploadPackSession(cfg *config.Config, auth transport.AuthMethod) (transport.UploadPackSession, error) {
+	endpoint := cfg.RewriteURL(r.c.URLs[0])
+	return newUploadPackSession(cfg, endpoint, r.auth(cfg, endpoint, auth))
+}
+
+// auth returns the given auth method, or if nil and the remote is accessed by
+// HTTP, a method using the credential helpers of the config.
+func (r *Remote) auth(cfg *config.Config, endpoint string, auth transport.AuthMethod) transport.AuthMethod {
+	if auth != nil || cfg.Raw == nil {
+		return auth
 	}
 
-	return remoteRefs, nil
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil
+	}
+
+	cc := credential.NewConfig(cfg.Raw, u)
+	if len(cc.Helpers) == 0 {
+		return nil
+	}
+
+	return http.NewCredentialHelperAuthFromConfig(cc)
 }
 
-func newUploadPackSession(url string, auth transport.AuthMethod) (transport.UploadPackSession, error) {
-	c, ep, err := newClient(url)
+func newUploadPackSession(cfg *config.Config, url string, auth transport.AuthMethod) (transport.UploadPackSession, error) {
+	c, ep, err := newClient(cfg, url)
 	if err != nil {
 		return nil, err
 	}
@@ -351,8 +771,8 @@ func newUploadPackSession(url string, auth transport.AuthMethod) (transport.Uplo
 	return c.NewUploadPackSession(ep, auth)
 }
 
-func newSendPackSession(url string, auth transport.AuthMethod) (transport.ReceivePackSession, error) {
-	c, ep, err := newClient(url)
+func newSendPackSession(cfg *config.Config, url string, auth transport.AuthMethod) (transport.ReceivePackSession, error) {
+	c, ep, err := newClient(cfg, url)
 	if err != nil {
 		return nil, err
 	}
@@ -360,7 +780,9 @@ func newSendPackSession(url string, auth transport.AuthMethod) (transport.Receiv
 	return c.NewReceivePackSession(ep, auth)
 }
 
-func newClient(url string) (transport.Transport, *transport.Endpoint, error) {
+// newClient returns the transport for the URL, the default HTTP client is
+// replaced by one using the http.* options of the config.
+func newClient(cfg *config.Config, url string) (transport.Transport, *transport.Endpoint, error) {
 	ep, err := transport.NewEndpoint(url)
 	if err != nil {
 		return nil, nil, err
@@ -371,11 +793,18 @@ func newClient(url string) (transport.Transport, *transport.Endpoint, error) {
 		return nil, nil, err
 	}
 
+	if c == http.DefaultClient && cfg.Raw != nil {
+		c = http.NewClientFromConfig(nil, cfg.Raw)
+	}
+
 	return c, ep, err
 }
 
+// fetchPack fetches the packfile of the request, if the fetch is retried the
+// packfile is spooled, so the objects received before a transient error are
+// kept in resume.
 func (r *Remote) fetchPack(ctx context.Context, o *FetchOptions, s transport.UploadPackSession,
-	req *packp.UploadPackRequest) (err error) {
+	req *packp.UploadPackRequest, resume *fetchResume) (err error) {
 
 	reader, err := s.UploadPack(ctx, req)
 	if err != nil {
@@ -384,17 +813,31 @@ func (r *Remote) fetchPack(ctx context.Context, o *FetchOptions, s transport.Upl
 
 	defer ioutil.CheckClose(reader, &err)
 
-	if err = r.updateShallow(o, reader); err != nil {
+	if err = r.updateShallow(reader); err != nil {
 		return err
 	}
 
-	if err = packfile.UpdateObjectStorage(r.s,
-		buildSidebandIfSupported(req.Capabilities, reader, o.Progress),
-	); err != nil {
-		return err
+	pack := buildSidebandIfSupported(req.Capabilities, reader, o.Progress)
+	if o.Retry.MaxRetries > 0 {
+		var spool *packSpool
+		spool, err = newPackSpool()
+		if err != nil {
+			return err
+		}
+
+		defer ioutil.CheckClose(spool, &err)
+		defer func() {
+			if err != nil && isTransientError(err) {
+				if rerr := spool.recover(r.s, resume); rerr != nil {
+					err = rerr
+				}
+			}
+		}()
+
+		pack = io.TeeReader(pack, spool)
 	}
 
-	return err
+	return packfile.UpdateObjectStorage(r.s, pack)
 }
 
 func (r *Remote) addReferencesToUpdate(
@@ -403,6 +846,7 @@ func (r *Remote) addReferencesToUpdate(
 	remoteRefs storer.ReferenceStorer,
 	req *packp.ReferenceUpdateRequest,
 	prune bool,
+	leases []ForceWithLease,
 ) error {
 	// This references dictionary will be used to search references by name.
 	refsDict := make(map[string]*plumbing.Reference)
@@ -416,7 +860,7 @@ func (r *Remote) addReferencesToUpdate(
 				return err
 			}
 		} else {
-			err := r.addOrUpdateReferences(rs, localRefs, refsDict, remoteRefs, req)
+			err := r.addOrUpdateReferences(rs, localRefs, refsDict, remoteRefs, req, leases)
 			if err != nil {
 				return err
 			}
@@ -438,6 +882,7 @@ func (r *Remote) addOrUpdateReferences(
 	refsDict map[string]*plumbing.Reference,
 	remoteRefs storer.ReferenceStorer,
 	req *packp.ReferenceUpdateRequest,
+	leases []ForceWithLease,
 ) error {
 	// If it is not a wilcard refspec we can directly search for the reference
 	// in the references dictionary.
@@ -447,11 +892,11 @@ func (r *Remote) addOrUpdateReferences(
 			return nil
 		}
 
-		return r.addReferenceIfRefSpecMatches(rs, remoteRefs, ref, req)
+		return r.addReferenceIfRefSpecMatches(rs, remoteRefs, ref, req, leases)
 	}
 
 	for _, ref := range localRefs {
-		err := r.addReferenceIfRefSpecMatches(rs, remoteRefs, ref, req)
+		err := r.addReferenceIfRefSpecMatches(rs, remoteRefs, ref, req, leases)
 		if err != nil {
 			return err
 		}
@@ -502,7 +947,7 @@ func (r *Remote) deleteReferences(rs config.RefSpec,
 
 func (r *Remote) addReferenceIfRefSpecMatches(rs config.RefSpec,
 	remoteRefs storer.ReferenceStorer, localRef *plumbing.Reference,
-	req *packp.ReferenceUpdateRequest) error {
+	req *packp.ReferenceUpdateRequest, leases []ForceWithLease) error {
 
 	if localRef.Type() != plumbing.HashReference {
 		return nil
@@ -534,7 +979,9 @@ func (r *Remote) addReferenceIfRefSpecMatches(rs config.RefSpec,
 		return nil
 	}
 
-	if !rs.IsForceUpdate() {
+	// the references with a lease are forced, their value is checked later
+	_, leased := findLease(leases, cmd.Name)
+	if !rs.IsForceUpdate() && !leased {
 		if err := checkFastForwardUpdate(r.s, remoteRefs, cmd); err != nil {
 			return err
 		}
@@ -567,6 +1014,30 @@ func (r *Remote) references() ([]*plumbing.Reference, error) {
 	return localRefs, nil
 }
 
+// alternateRefsStorer is implemented by the storages borrowing objects from
+// other repositories, like the ones with objects/info/alternates.
+type alternateRefsStorer interface {
+	AlternateReferences() ([]*plumbing.Reference, error)
+}
+
+// referencesWithAlternates returns the local references along with the ones
+// of the repositories the storage borrows objects from, since their objects
+// are available too.
+func (r *Remote) referencesWithAlternates(localRefs []*plumbing.Reference) ([]*plumbing.Reference, error) {
+	s, ok := r.s.(alternateRefsStorer)
+	if !ok {
+		return localRefs, nil
+	}
+
+	alternates, err := s.AlternateReferences()
+	if err != nil || len(alternates) == 0 {
+		return localRefs, err
+	}
+
+	refs := make([]*plumbing.Reference, 0, len(localRefs)+len(alternates))
+	return append(append(refs, localRefs...), alternates...), nil
+}
+
 func getRemoteRefsFromStorer(remoteRefStorer storer.ReferenceStorer) (
 	map[plumbing.Hash]bool, error) {
 	remoteRefs := map[plumbing.Hash]bool{}
@@ -670,7 +1141,10 @@ func getHaves(
 	return result, nil
 }
 
-const refspecAllTags = "+refs/tags/*:refs/tags/*"
+const (
+	refspecAllTags = "+refs/tags/*:refs/tags/*"
+	refspecMirror  = "+refs/*:refs/*"
+)
 
 func calculateRefs(
 	spec []config.RefSpec,
@@ -761,6 +1235,21 @@ func getWants(localStorer storage.Storer, refs memory.ReferenceStorage) ([]plumb
 	return result, nil
 }
 
+func refsToHashes(refs memory.ReferenceStorage) []plumbing.Hash {
+	seen := make(map[plumbing.Hash]bool)
+	var result []plumbing.Hash
+	for _, ref := range refs {
+		if seen[ref.Hash()] {
+			continue
+		}
+
+		seen[ref.Hash()] = true
+		result = append(result, ref.Hash())
+	}
+
+	return result
+}
+
 func objectExists(s storer.EncodedObjectStorer, h plumbing.Hash) (bool, error) {
 	_, err := s.EncodedObject(plumbing.AnyObject, h)
 	if err == plumbing.ErrObjectNotFound {
@@ -820,13 +1309,26 @@ func (r *Remote) newUploadPackRequest(o *FetchOptions,
 
 	req := packp.NewUploadPackRequestFromCapabilities(ar.Capabilities)
 
-	if o.Depth != 0 {
-		req.Depth = packp.DepthCommits(o.Depth)
+	shallows, err := r.s.Shallow()
+	if err != nil {
+		return nil, err
+	}
+
+	if o.Unshallow && len(shallows) == 0 {
+		return nil, ErrUnshallowComplete
+	}
+
+	if len(shallows) != 0 && ar.Capabilities.Supports(capability.Shallow) {
+		req.Shallows = shallows
 		if err := req.Capabilities.Set(capability.Shallow); err != nil {
 			return nil, err
 		}
 	}
 
+	if err := setUploadPackDepth(o, ar, req); err != nil {
+		return nil, err
+	}
+
 	if o.Progress == nil && ar.Capabilities.Supports(capability.NoProgress) {
 		if err := req.Capabilities.Set(capability.NoProgress); err != nil {
 			return nil, err
@@ -850,6 +1352,41 @@ func (r *Remote) newUploadPackRequest(o *FetchOptions,
 	return req, nil
 }
 
+// setUploadPackDepth sets the depth of the request from the fetch options,
+// along with the capabilities required by it.
+func setUploadPackDepth(o *FetchOptions, ar *packp.AdvRefs, req *packp.UploadPackRequest) error {
+	var caps []capability.Capability
+	switch {
+	case o.Depth != 0:
+		req.Depth = packp.DepthCommits(o.Depth)
+	case o.Deepen != 0:
+		req.Depth = packp.DepthCommits(o.Deepen)
+		caps = append(caps, capability.DeepenRelative)
+	case o.Unshallow:
+		req.Depth = packp.DepthCommits(infiniteDepth)
+	case !o.ShallowSince.IsZero():
+		req.Depth = packp.DepthSince(o.ShallowSince)
+		caps = append(caps, capability.DeepenSince)
+	case o.ShallowExclude != "":
+		req.Depth = packp.DepthReference(o.ShallowExclude)
+		caps = append(caps, capability.DeepenNot)
+	default:
+		return nil
+	}
+
+	for _, c := range append(caps, capability.Shallow) {
+		if c != capability.Shallow && !ar.Capabilities.Supports(c) {
+			return fmt.Errorf("server does not support %s", c)
+		}
+
+		if err := req.Capabilities.Set(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func buildSidebandIfSupported(l *capability.List, reader io.Reader, p sideband.Progress) io.Reader {
 	var t sideband.Type
 
@@ -974,7 +1511,12 @@ func (r *Remote) buildFetchedTags(refs memory.ReferenceStorage) (updated bool, e
 
 // List the references on the remote repository.
 func (r *Remote) List(o *ListOptions) (rfs []*plumbing.Reference, err error) {
-	s, err := newUploadPackSession(r.c.URLs[0], o.Auth)
+	cfg, err := r.mergedConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := r.newUploadPackSession(cfg, o.Auth)
 	if err != nil {
 		return nil, err
 	}
@@ -1090,8 +1632,10 @@ func pushHashes(
 	return rs, nil
 }
 
-func (r *Remote) updateShallow(o *FetchOptions, resp *packp.UploadPackResponse) error {
-	if o.Depth == 0 || len(resp.Shallows) == 0 {
+// updateShallow adds to the shallow commits of the storage the ones sent by
+// the server, and removes the ones the server sent as unshallow.
+func (r *Remote) updateShallow(resp *packp.UploadPackResponse) error {
+	if len(resp.Shallows) == 0 && len(resp.Unshallows) == 0 {
 		return nil
 	}
 
@@ -1100,15 +1644,23 @@ func (r *Remote) updateShallow(o *FetchOptions, resp *packp.UploadPackResponse)
 		return err
 	}
 
-outer:
-	for _, s := range resp.Shallows {
-		for _, oldS := range shallows {
-			if s == oldS {
-				continue outer
+	unshallows := make(map[plumbing.Hash]bool, len(resp.Unshallows))
+	for _, h := range resp.Unshallows {
+		unshallows[h] = true
+	}
+
+	var result []plumbing.Hash
+	seen := make(map[plumbing.Hash]bool)
+	for _, list := range [][]plumbing.Hash{shallows, resp.Shallows} {
+		for _, h := range list {
+			if seen[h] || unshallows[h] {
+				continue
 			}
+
+			seen[h] = true
+			result = append(result, h)
 		}
-		shallows = append(shallows, s)
 	}
 
-	return r.s.SetShallow(shallows)
+	return r.s.SetShallow(result)
 }
@@ -6,15 +6,18 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"runtime"
 	"time"
 
 	"gopkg.in/src-d/go-git.v4/config"
 	"gopkg.in/src-d/go-git.v4/plumbing"
 	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
 	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
 	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp/capability"
 	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
 	"gopkg.in/src-d/go-git.v4/storage"
 	"gopkg.in/src-d/go-git.v4/storage/filesystem"
 	"gopkg.in/src-d/go-git.v4/storage/memory"
@@ -189,6 +192,78 @@ func (s *RemoteSuite) TestFetchWithDepth(c *C) {
 	c.Assert(r.s.(*memory.Storage).Objects, HasLen, 18)
 }
 
+func (s *RemoteSuite) TestFetchDeepenAndUnshallow(c *C) {
+	sto := memory.NewStorage()
+	r := NewRemote(sto, &config.RemoteConfig{
+		Name: DefaultRemoteName,
+		URLs: []string{s.GetBasicLocalRepositoryURL()},
+	})
+
+	refspecs := []config.RefSpec{"+refs/heads/master:refs/remotes/origin/master"}
+	err := r.Fetch(&FetchOptions{RefSpecs: refspecs, Depth: 1, Tags: NoTags})
+	c.Assert(err, IsNil)
+
+	shallows, err := sto.Shallow()
+	c.Assert(err, IsNil)
+	c.Assert(shallows, DeepEquals, []plumbing.Hash{
+		plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+	})
+
+	err = r.Fetch(&FetchOptions{RefSpecs: refspecs, Deepen: 1, Tags: NoTags})
+	c.Assert(err, IsNil)
+
+	shallows, err = sto.Shallow()
+	c.Assert(err, IsNil)
+	c.Assert(shallows, DeepEquals, []plumbing.Hash{
+		plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294"),
+	})
+
+	err = r.Fetch(&FetchOptions{RefSpecs: refspecs, Unshallow: true, Tags: NoTags})
+	c.Assert(err, IsNil)
+
+	shallows, err = sto.Shallow()
+	c.Assert(err, IsNil)
+	c.Assert(shallows, HasLen, 0)
+
+	iter := object.NewCommitPreorderIter(mustCommit(c, sto, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5"), nil, nil)
+	var commits int
+	c.Assert(iter.ForEach(func(*object.Commit) error { commits++; return nil }), IsNil)
+	c.Assert(commits, Equals, 8)
+
+	err = r.Fetch(&FetchOptions{RefSpecs: refspecs, Unshallow: true, Tags: NoTags})
+	c.Assert(err, Equals, ErrUnshallowComplete)
+}
+
+func (s *RemoteSuite) TestFetchShallowSince(c *C) {
+	sto := memory.NewStorage()
+	r := NewRemote(sto, &config.RemoteConfig{
+		Name: DefaultRemoteName,
+		URLs: []string{s.GetBasicLocalRepositoryURL()},
+	})
+
+	since, err := time.Parse(time.RFC3339, "2015-04-01T00:00:00Z")
+	c.Assert(err, IsNil)
+
+	err = r.Fetch(&FetchOptions{
+		RefSpecs:     []config.RefSpec{"+refs/heads/master:refs/remotes/origin/master"},
+		ShallowSince: since,
+		Tags:         NoTags,
+	})
+	c.Assert(err, IsNil)
+
+	shallows, err := sto.Shallow()
+	c.Assert(err, IsNil)
+	c.Assert(shallows, DeepEquals, []plumbing.Hash{
+		plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+	})
+}
+
+func mustCommit(c *C, s storer.EncodedObjectStorer, hash string) *object.Commit {
+	commit, err := object.GetCommit(s, plumbing.NewHash(hash))
+	c.Assert(err, IsNil)
+	return commit
+}
+
 func (s *RemoteSuite) testFetch(c *C, r *Remote, o *FetchOptions, expected []*plumbing.Reference) {
 	err := r.Fetch(o)
 	c.Assert(err, IsNil)
@@ -207,6 +282,94 @@ func (s *RemoteSuite) testFetch(c *C, r *Remote, o *FetchOptions, expected []*pl
 	}
 }
 
+func (s *RemoteSuite) TestFetchPrune(c *C) {
+	url := s.GetBasicLocalRepositoryURL()
+	sto := memory.NewStorage()
+	r := NewRemote(sto, &config.RemoteConfig{Name: DefaultRemoteName, URLs: []string{url}})
+
+	refspec := config.RefSpec("+refs/heads/*:refs/remotes/origin/*")
+	err := r.Fetch(&FetchOptions{RefSpecs: []config.RefSpec{refspec}})
+	c.Assert(err, IsNil)
+
+	gone := plumbing.NewReferenceFromStrings("refs/remotes/origin/gone", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	c.Assert(sto.SetReference(gone), IsNil)
+	tag := plumbing.NewReferenceFromStrings("refs/tags/gone", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	c.Assert(sto.SetReference(tag), IsNil)
+
+	s.testFetch(c, r, &FetchOptions{
+		RefSpecs: []config.RefSpec{refspec},
+		Prune:    true,
+	}, []*plumbing.Reference{
+		plumbing.NewReferenceFromStrings("refs/remotes/origin/master", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+		plumbing.NewReferenceFromStrings("refs/remotes/origin/branch", "e8d3ffab552895c19b9fcf7aa264d277cde33881"),
+		plumbing.NewReferenceFromStrings("refs/tags/v1.0.0", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+		tag,
+	})
+
+	s.testFetch(c, r, &FetchOptions{
+		RefSpecs:  []config.RefSpec{refspec},
+		Prune:     true,
+		PruneTags: true,
+	}, []*plumbing.Reference{
+		plumbing.NewReferenceFromStrings("refs/remotes/origin/master", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+		plumbing.NewReferenceFromStrings("refs/remotes/origin/branch", "e8d3ffab552895c19b9fcf7aa264d277cde33881"),
+		plumbing.NewReferenceFromStrings("refs/tags/v1.0.0", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+	})
+}
+
+func (s *RemoteSuite) TestFetchPruneFromConfig(c *C) {
+	url := s.GetBasicLocalRepositoryURL()
+	sto := memory.NewStorage()
+
+	cfg := config.NewConfig()
+	cfg.Fetch.Prune = true
+	c.Assert(sto.SetConfig(cfg), IsNil)
+
+	r := NewRemote(sto, &config.RemoteConfig{Name: DefaultRemoteName, URLs: []string{url}})
+
+	o := &FetchOptions{RefSpecs: []config.RefSpec{"+refs/heads/*:refs/remotes/origin/*"}}
+	c.Assert(r.Fetch(o), IsNil)
+
+	gone := plumbing.NewReferenceFromStrings("refs/remotes/origin/gone", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	c.Assert(sto.SetReference(gone), IsNil)
+
+	// an explicit NoPrune overrides the config
+	noPrune := &FetchOptions{RefSpecs: o.RefSpecs, NoPrune: true}
+	c.Assert(r.Fetch(noPrune), Equals, NoErrAlreadyUpToDate)
+
+	_, err := sto.Reference(gone.Name())
+	c.Assert(err, IsNil)
+
+	c.Assert(r.Fetch(o), IsNil)
+
+	_, err = sto.Reference(gone.Name())
+	c.Assert(err, Equals, plumbing.ErrReferenceNotFound)
+
+	c.Assert(cfg.Unmarshal([]byte(`[fetch]
+	prune = true
+[remote "origin"]
+	url = `+url+`
+	prune = false
+`)), IsNil)
+	c.Assert(sto.SetConfig(cfg), IsNil)
+
+	c.Assert(sto.SetReference(gone), IsNil)
+	c.Assert(r.Fetch(o), Equals, NoErrAlreadyUpToDate)
+
+	_, err = sto.Reference(gone.Name())
+	c.Assert(err, IsNil)
+}
+
+func (s *RemoteSuite) TestFetchPruneConflict(c *C) {
+	r := NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: DefaultRemoteName,
+		URLs: []string{s.GetBasicLocalRepositoryURL()},
+	})
+
+	err := r.Fetch(&FetchOptions{Prune: true, NoPrune: true})
+	c.Assert(err, Equals, ErrConflictingPruneOptions)
+}
+
 func (s *RemoteSuite) TestFetchWithProgress(c *C) {
 	url := s.GetBasicLocalRepositoryURL()
 	sto := memory.NewStorage()
@@ -397,6 +560,83 @@ func (s *RemoteSuite) TestString(c *C) {
 	)
 }
 
+func (s *RemoteSuite) TestAuthFromCredentialHelpers(c *C) {
+	cfg := config.NewConfig()
+	cfg.Raw.AddOption("credential", "https://github.com", "helper", "cache")
+
+	r := NewRemote(nil, &config.RemoteConfig{Name: "foo"})
+
+	auth, ok := r.auth(cfg, "https://github.com/git-fixtures/basic.git", nil).(*http.CredentialHelperAuth)
+	c.Assert(ok, Equals, true)
+	c.Assert(auth.Helpers, HasLen, 1)
+
+	basic := &http.BasicAuth{Username: "foo"}
+	c.Assert(r.auth(cfg, "https://github.com/git-fixtures/basic.git", basic), Equals, basic)
+	c.Assert(r.auth(cfg, "https://example.com/basic.git", nil), IsNil)
+}
+
+func (s *RemoteSuite) TestFetchWithInsteadOf(c *C) {
+	root := s.GetBasicLocalRepositoryURL()
+
+	sto := memory.NewStorage()
+	cfg, err := sto.Config()
+	c.Assert(err, IsNil)
+	cfg.URLs[filepath.Dir(root)+"/"] = &config.URL{
+		Name:       filepath.Dir(root) + "/",
+		InsteadOfs: []string{"https://example.com/"},
+	}
+	c.Assert(sto.SetConfig(cfg), IsNil)
+
+	r := NewRemote(sto, &config.RemoteConfig{
+		Name: DefaultRemoteName,
+		URLs: []string{"https://example.com/" + filepath.Base(root)},
+	})
+
+	s.testFetch(c, r, &FetchOptions{
+		RefSpecs: []config.RefSpec{
+			config.RefSpec("+refs/heads/master:refs/remotes/origin/master"),
+		},
+	}, []*plumbing.Reference{
+		plumbing.NewReferenceFromStrings("refs/remotes/origin/master", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+	})
+}
+
+func (s *RemoteSuite) TestPushWithPushInsteadOf(c *C) {
+	url := c.MkDir()
+	server, err := PlainInit(url, true)
+	c.Assert(err, IsNil)
+
+	srcFs := fixtures.Basic().One().DotGit()
+	sto := filesystem.NewStorage(srcFs, cache.NewObjectLRUDefault())
+
+	cfg, err := sto.Config()
+	c.Assert(err, IsNil)
+	cfg.URLs["https://example.com/"] = &config.URL{
+		Name:       "https://example.com/",
+		InsteadOfs: []string{"mirror:"},
+	}
+	cfg.URLs[url] = &config.URL{
+		Name:           url,
+		PushInsteadOfs: []string{"mirror:repo"},
+	}
+	c.Assert(sto.SetConfig(cfg), IsNil)
+
+	r := NewRemote(sto, &config.RemoteConfig{
+		Name: DefaultRemoteName,
+		URLs: []string{"mirror:repo"},
+	})
+
+	rs := config.RefSpec("refs/heads/master:refs/heads/master")
+	err = r.Push(&PushOptions{
+		RefSpecs: []config.RefSpec{rs},
+	})
+	c.Assert(err, IsNil)
+
+	ref, err := server.Reference(plumbing.Master, false)
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash().String(), Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+}
+
 func (s *RemoteSuite) TestPushToEmptyRepository(c *C) {
 	url := c.MkDir()
 	server, err := PlainInit(url, true)
@@ -490,6 +730,37 @@ func (s *RemoteSuite) TestPushTags(c *C) {
 	})
 }
 
+func (s *RemoteSuite) TestPushFollowTags(c *C) {
+	url := c.MkDir()
+	server, err := PlainInit(url, true)
+	c.Assert(err, IsNil)
+
+	fs := fixtures.ByURL("https://github.com/git-fixtures/tags.git").One().DotGit()
+	sto := filesystem.NewStorage(fs, cache.NewObjectLRUDefault())
+
+	r := NewRemote(sto, &config.RemoteConfig{
+		Name: DefaultRemoteName,
+		URLs: []string{url},
+	})
+
+	err = r.Push(&PushOptions{
+		RefSpecs:   []config.RefSpec{"refs/heads/master:refs/heads/master"},
+		FollowTags: true,
+	})
+	c.Assert(err, IsNil)
+
+	AssertReferences(c, server, map[string]string{
+		"refs/heads/master":       "f7b877701fbf855b44c0a9e86f3fdce2c298b07f",
+		"refs/tags/annotated-tag": "b742a2a9fa0afcfa9a6fad080980fbc26b007c69",
+		"refs/tags/commit-tag":    "ad7897c0fb8e7d9a9ba41fa66072cf06095a6cfc",
+	})
+
+	for _, name := range []string{"lightweight-tag", "blob-tag", "tree-tag"} {
+		_, err := server.Reference(plumbing.NewTagReferenceName(name), false)
+		c.Assert(err, Equals, plumbing.ErrReferenceNotFound)
+	}
+}
+
 func (s *RemoteSuite) TestPushNoErrAlreadyUpToDate(c *C) {
 	fs := fixtures.Basic().One().DotGit()
 	sto := filesystem.NewStorage(fs, cache.NewObjectLRUDefault())
@@ -583,6 +854,120 @@ func (s *RemoteSuite) TestPushForce(c *C) {
 	c.Assert(newRef, Not(DeepEquals), oldRef)
 }
 
+func (s *RemoteSuite) TestPushForceWithLease(c *C) {
+	f := fixtures.Basic().One()
+	sto := filesystem.NewStorage(f.DotGit(), cache.NewObjectLRUDefault())
+
+	dstFs := f.DotGit()
+	dstSto := filesystem.NewStorage(dstFs, cache.NewObjectLRUDefault())
+
+	r := NewRemote(sto, &config.RemoteConfig{
+		Name:  DefaultRemoteName,
+		URLs:  []string{dstFs.Root()},
+		Fetch: []config.RefSpec{"+refs/heads/*:refs/remotes/origin/*"},
+	})
+
+	rs := config.RefSpec("refs/heads/master:refs/heads/branch")
+	err := r.Push(&PushOptions{RefSpecs: []config.RefSpec{rs}})
+	c.Assert(err, ErrorMatches, "non-fast-forward update: refs/heads/branch")
+
+	err = r.Push(&PushOptions{
+		RefSpecs: []config.RefSpec{rs, "refs/heads/master:refs/heads/new"},
+		ForceWithLease: []ForceWithLease{{
+			RefName: "refs/heads/branch",
+			Hash:    plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294"),
+		}},
+	})
+
+	stale, ok := err.(*StaleLeaseError)
+	c.Assert(ok, Equals, true)
+	c.Assert(stale.References, DeepEquals, []plumbing.ReferenceName{"refs/heads/branch"})
+
+	ref, err := dstSto.Reference("refs/heads/branch")
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash().String(), Equals, "e8d3ffab552895c19b9fcf7aa264d277cde33881")
+
+	ref, err = dstSto.Reference("refs/heads/new")
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash().String(), Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+
+	err = r.Push(&PushOptions{
+		RefSpecs:       []config.RefSpec{rs},
+		ForceWithLease: []ForceWithLease{{}},
+	})
+	c.Assert(err, IsNil)
+
+	ref, err = dstSto.Reference("refs/heads/branch")
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash().String(), Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+}
+
+func (s *RemoteSuite) TestPushForceWithLeaseMissingTracking(c *C) {
+	f := fixtures.Basic().One()
+	sto := filesystem.NewStorage(f.DotGit(), cache.NewObjectLRUDefault())
+
+	dstFs := f.DotGit()
+	r := NewRemote(sto, &config.RemoteConfig{
+		Name:  "other",
+		URLs:  []string{dstFs.Root()},
+		Fetch: []config.RefSpec{"+refs/heads/*:refs/remotes/other/*"},
+	})
+
+	err := r.Push(&PushOptions{
+		RemoteName:     "other",
+		RefSpecs:       []config.RefSpec{"refs/heads/master:refs/heads/branch"},
+		ForceWithLease: []ForceWithLease{{RefName: "refs/heads/branch"}},
+	})
+
+	stale, ok := err.(*StaleLeaseError)
+	c.Assert(ok, Equals, true)
+	c.Assert(stale.References, DeepEquals, []plumbing.ReferenceName{"refs/heads/branch"})
+}
+
+func (s *RemoteSuite) TestPushForceWithLeaseExpectAbsent(c *C) {
+	f := fixtures.Basic().One()
+	sto := filesystem.NewStorage(f.DotGit(), cache.NewObjectLRUDefault())
+
+	dstFs := f.DotGit()
+	dstSto := filesystem.NewStorage(dstFs, cache.NewObjectLRUDefault())
+
+	r := NewRemote(sto, &config.RemoteConfig{
+		Name:  DefaultRemoteName,
+		URLs:  []string{dstFs.Root()},
+		Fetch: []config.RefSpec{"+refs/heads/*:refs/remotes/origin/*"},
+	})
+
+	// refs/remotes/origin/branch matches the remote reference, but it's
+	// expected not to exist
+	err := r.Push(&PushOptions{
+		RefSpecs:       []config.RefSpec{"refs/heads/master:refs/heads/branch"},
+		ForceWithLease: []ForceWithLease{{RefName: "refs/heads/branch", ExpectAbsent: true}},
+	})
+
+	stale, ok := err.(*StaleLeaseError)
+	c.Assert(ok, Equals, true)
+	c.Assert(stale.References, DeepEquals, []plumbing.ReferenceName{"refs/heads/branch"})
+
+	err = r.Push(&PushOptions{
+		RefSpecs:       []config.RefSpec{"refs/heads/master:refs/heads/new"},
+		ForceWithLease: []ForceWithLease{{RefName: "refs/heads/new", ExpectAbsent: true}},
+	})
+	c.Assert(err, IsNil)
+
+	ref, err := dstSto.Reference("refs/heads/new")
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash().String(), Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+
+	err = r.Push(&PushOptions{
+		RefSpecs:       []config.RefSpec{"+refs/heads/branch:refs/heads/new"},
+		ForceWithLease: []ForceWithLease{{RefName: "refs/heads/new", ExpectAbsent: true}},
+	})
+
+	stale, ok = err.(*StaleLeaseError)
+	c.Assert(ok, Equals, true)
+	c.Assert(stale.References, DeepEquals, []plumbing.ReferenceName{"refs/heads/new"})
+}
+
 func (s *RemoteSuite) TestPushPrune(c *C) {
 	fs := fixtures.Basic().One().DotGit()
 	url := c.MkDir()
@@ -850,13 +1235,10 @@ func (s *RemoteSuite) TestUpdateShallows(c *C) {
 	c.Assert(len(shallows), Equals, 0)
 
 	resp := new(packp.UploadPackResponse)
-	o := &FetchOptions{
-		Depth: 1,
-	}
 
 	for _, t := range tests {
 		resp.Shallows = t.hashes
-		err = remote.updateShallow(o, resp)
+		err = remote.updateShallow(resp)
 		c.Assert(err, IsNil)
 
 		shallow, err := remote.s.Shallow()
@@ -864,6 +1246,14 @@ func (s *RemoteSuite) TestUpdateShallows(c *C) {
 		c.Assert(len(shallow), Equals, len(t.result))
 		c.Assert(shallow, DeepEquals, t.result)
 	}
+
+	resp.Shallows = hashes[0:1]
+	resp.Unshallows = hashes[1:5]
+	c.Assert(remote.updateShallow(resp), IsNil)
+
+	shallows, err = remote.s.Shallow()
+	c.Assert(err, IsNil)
+	c.Assert(shallows, DeepEquals, []plumbing.Hash{hashes[0], hashes[5]})
 }
 
 func (s *RemoteSuite) TestUseRefDeltas(c *C) {
@@ -0,0 +1,182 @@
+package git
+
+import (
+	"errors"
+	"sort"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+var (
+	// ErrRepackGeometricFactor is returned by RepackObjects when the
+	// geometric factor is less than 2.
+	ErrRepackGeometricFactor = errors.New("geometric repack factor must be at least 2")
+	// ErrRepackIncrementalBitmaps is returned by RepackObjects when the
+	// bitmaps are requested by an incremental repack, as they need all the
+	// reachable objects in a packfile.
+	ErrRepackIncrementalBitmaps = errors.New("bitmaps can't be written by an incremental repack")
+)
+
+// repackIncremental packs the loose objects, along with the objects of the
+// packs rolled up by a geometric repack, into a new pack, and deletes them.
+func (r *Repository) repackIncremental(pos storer.PackedObjectStorer, cfg *RepackConfig) error {
+	if cfg.Geometric != 0 && cfg.Geometric < 2 {
+		return ErrRepackGeometricFactor
+	}
+
+	if cfg.WriteBitmaps {
+		return ErrRepackIncrementalBitmaps
+	}
+
+	los, ok := r.Storer.(storer.LooseObjectStorer)
+	if !ok {
+		return ErrLooseObjectsNotSupported
+	}
+
+	var pis storer.ObjectPackInfoStorer
+	var packs []plumbing.Hash
+	if cfg.Geometric != 0 {
+		if pis, ok = r.Storer.(storer.ObjectPackInfoStorer); !ok {
+			return ErrPackedObjectsNotSupported
+		}
+
+		var err error
+		if packs, err = geometricRollUp(pos, pis, cfg.Geometric); err != nil {
+			return err
+		}
+	}
+
+	var loose []plumbing.Hash
+	err := los.ForEachObjectHash(func(h plumbing.Hash) error {
+		loose = append(loose, h)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[plumbing.Hash]struct{}, len(loose))
+	objs := make([]plumbing.Hash, 0, len(loose))
+	add := func(h plumbing.Hash) {
+		if _, ok := seen[h]; !ok {
+			seen[h] = struct{}{}
+			objs = append(objs, h)
+		}
+	}
+
+	for _, h := range loose {
+		add(h)
+	}
+
+	for _, pack := range packs {
+		hs, err := pis.ObjectPackHashes(pack)
+		if err != nil {
+			return err
+		}
+
+		for _, h := range hs {
+			add(h)
+		}
+	}
+
+	if len(objs) == 0 {
+		return r.updateMultiPackIndex(cfg)
+	}
+
+	nh, err := r.encodeObjectPack(objs, cfg)
+	if err != nil {
+		return err
+	}
+
+	for _, h := range loose {
+		if err := los.DeleteLooseObject(h); err != nil {
+			return err
+		}
+	}
+
+	for _, h := range packs {
+		if h == nh {
+			continue
+		}
+
+		if err := pos.DeleteOldObjectPackAndIndex(h, cfg.OnlyDeletePacksOlderThan); err != nil {
+			return err
+		}
+	}
+
+	return r.updateMultiPackIndex(cfg)
+}
+
+// geometricRollUp returns the packs, not kept nor cruft, to roll up into a
+// new one so the ones left form a geometric progression by number of objects,
+// as git repack --geometric does.
+func geometricRollUp(pos storer.PackedObjectStorer, pis storer.ObjectPackInfoStorer, factor int) ([]plumbing.Hash, error) {
+	hs, err := pos.ObjectPacks()
+	if err != nil {
+		return nil, err
+	}
+
+	cps, _ := pos.(storer.CruftPackStorer)
+
+	var packs []plumbing.Hash
+	counts := make(map[plumbing.Hash]int, len(hs))
+	for _, h := range hs {
+		kept, err := pis.ObjectPackKept(h)
+		if err != nil {
+			return nil, err
+		}
+
+		cruft, err := isCruftPack(cps, h)
+		if err != nil {
+			return nil, err
+		}
+
+		if kept || cruft {
+			continue
+		}
+
+		objs, err := pis.ObjectPackHashes(h)
+		if err != nil {
+			return nil, err
+		}
+
+		packs = append(packs, h)
+		counts[h] = len(objs)
+	}
+
+	sort.Slice(packs, func(i, j int) bool {
+		if counts[packs[i]] != counts[packs[j]] {
+			return counts[packs[i]] < counts[packs[j]]
+		}
+
+		return packs[i].String() < packs[j].String()
+	})
+
+	// Find the largest pack breaking the progression, it's rolled up along
+	// with the smaller ones.
+	split := 0
+	for i := len(packs) - 1; i > 0; i-- {
+		if factor*counts[packs[i-1]] > counts[packs[i]] {
+			split = i + 1
+			break
+		}
+	}
+
+	// The rolled up objects may be enough to break the progression with the
+	// next packs, which are rolled up too.
+	var total int
+	for _, h := range packs[:split] {
+		total += counts[h]
+	}
+
+	for ; split < len(packs); split++ {
+		if counts[packs[split]] >= factor*total {
+			break
+		}
+
+		total += counts[packs[split]]
+	}
+
+	return packs[:split], nil
+}
@@ -0,0 +1,264 @@
+package git
+
+import (
+	"sort"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git-fixtures.v3"
+)
+
+type RepackSuite struct {
+	BaseSuite
+}
+
+var _ = Suite(&RepackSuite{})
+
+func (s *RepackSuite) looseObjects(c *C, r *Repository) []plumbing.Hash {
+	var hs []plumbing.Hash
+	err := r.Storer.(storer.LooseObjectStorer).ForEachObjectHash(func(h plumbing.Hash) error {
+		hs = append(hs, h)
+		return nil
+	})
+	c.Assert(err, IsNil)
+	return hs
+}
+
+func (s *RepackSuite) objectPacks(c *C, r *Repository) []plumbing.Hash {
+	packs, err := r.Storer.(storer.PackedObjectStorer).ObjectPacks()
+	c.Assert(err, IsNil)
+	return packs
+}
+
+func (s *RepackSuite) objectPackCounts(c *C, r *Repository) []int {
+	pis := r.Storer.(storer.ObjectPackInfoStorer)
+
+	var counts []int
+	for _, h := range s.objectPacks(c, r) {
+		hs, err := pis.ObjectPackHashes(h)
+		c.Assert(err, IsNil)
+		counts = append(counts, len(hs))
+	}
+
+	sort.Ints(counts)
+	return counts
+}
+
+func (s *RepackSuite) allObjects(c *C, r *Repository) []plumbing.Hash {
+	iter, err := r.Storer.IterEncodedObjects(plumbing.AnyObject)
+	c.Assert(err, IsNil)
+
+	var hs []plumbing.Hash
+	err = iter.ForEach(func(o plumbing.EncodedObject) error {
+		hs = append(hs, o.Hash())
+		return nil
+	})
+	c.Assert(err, IsNil)
+	return hs
+}
+
+func (s *RepackSuite) assertObjects(c *C, r *Repository, hs []plumbing.Hash) {
+	for _, h := range hs {
+		_, err := r.Storer.EncodedObject(plumbing.AnyObject, h)
+		c.Assert(err, IsNil, Commentf("object %s", h))
+	}
+}
+
+func (s *RepackSuite) TestRepackObjectsOnlyLooseObjects(c *C) {
+	r := s.NewRepository(fixtures.ByTag("unpacked").One())
+	packs := s.objectPacks(c, r)
+	c.Assert(packs, HasLen, 2)
+	loose := s.looseObjects(c, r)
+	c.Assert(len(loose) > 0, Equals, true)
+	objs := s.allObjects(c, r)
+
+	err := r.RepackObjects(&RepackConfig{OnlyLooseObjects: true})
+	c.Assert(err, IsNil)
+
+	c.Assert(s.looseObjects(c, r), HasLen, 0)
+	after := s.objectPacks(c, r)
+	c.Assert(after, HasLen, 3)
+	for _, h := range packs {
+		c.Assert(containsHash(after, h), Equals, true)
+	}
+
+	s.assertObjects(c, r, objs)
+}
+
+func (s *RepackSuite) TestRepackObjectsOnlyLooseObjectsNoLoose(c *C) {
+	r := s.NewRepository(fixtures.Basic().One())
+	packs := s.objectPacks(c, r)
+	c.Assert(s.looseObjects(c, r), HasLen, 0)
+
+	err := r.RepackObjects(&RepackConfig{OnlyLooseObjects: true})
+	c.Assert(err, IsNil)
+	c.Assert(s.objectPacks(c, r), DeepEquals, packs)
+}
+
+func (s *RepackSuite) TestRepackObjectsGeometric(c *C) {
+	r := s.NewRepository(fixtures.ByTag("unpacked").One())
+	objs := s.allObjects(c, r)
+
+	// The loose objects are packed apart from the rolled up packs, so a
+	// first repack leaves a pack breaking the progression.
+	err := r.RepackObjects(&RepackConfig{Geometric: 2})
+	c.Assert(err, IsNil)
+	c.Assert(s.looseObjects(c, r), HasLen, 0)
+	c.Assert(s.objectPacks(c, r), HasLen, 3)
+
+	err = r.RepackObjects(&RepackConfig{Geometric: 2})
+	c.Assert(err, IsNil)
+
+	counts := s.objectPackCounts(c, r)
+	c.Assert(counts, HasLen, 2)
+	for i := 1; i < len(counts); i++ {
+		c.Assert(counts[i] >= 2*counts[i-1], Equals, true, Commentf("counts %v", counts))
+	}
+
+	s.assertObjects(c, r, objs)
+
+	// A second repack finds nothing to do.
+	packs := s.objectPacks(c, r)
+	err = r.RepackObjects(&RepackConfig{Geometric: 2})
+	c.Assert(err, IsNil)
+	c.Assert(s.objectPacks(c, r), DeepEquals, packs)
+}
+
+func (s *RepackSuite) TestRepackObjectsGeometricNoDelete(c *C) {
+	r := s.NewRepository(fixtures.ByTag("unpacked").One())
+	packs := s.objectPacks(c, r)
+
+	err := r.RepackObjects(&RepackConfig{
+		Geometric:                2,
+		OnlyDeletePacksOlderThan: time.Unix(0, 1),
+	})
+	c.Assert(err, IsNil)
+
+	after := s.objectPacks(c, r)
+	for _, h := range packs {
+		c.Assert(containsHash(after, h), Equals, true)
+	}
+}
+
+func (s *RepackSuite) TestRepackObjectsGeometricInvalidFactor(c *C) {
+	r := s.NewRepository(fixtures.ByTag("unpacked").One())
+	err := r.RepackObjects(&RepackConfig{Geometric: 1})
+	c.Assert(err, Equals, ErrRepackGeometricFactor)
+}
+
+func (s *RepackSuite) TestRepackObjectsIncrementalBitmaps(c *C) {
+	r := s.NewRepository(fixtures.ByTag("unpacked").One())
+	err := r.RepackObjects(&RepackConfig{
+		OnlyLooseObjects: true,
+		WriteBitmaps:     true,
+	})
+	c.Assert(err, Equals, ErrRepackIncrementalBitmaps)
+}
+
+func containsHash(hs []plumbing.Hash, h plumbing.Hash) bool {
+	for _, o := range hs {
+		if o == h {
+			return true
+		}
+	}
+
+	return false
+}
+
+type geometricPacks struct {
+	storer.PackedObjectStorer
+	counts map[plumbing.Hash]int
+	kept   map[plumbing.Hash]bool
+	cruft  map[plumbing.Hash]bool
+}
+
+func (p *geometricPacks) ObjectPacks() ([]plumbing.Hash, error) {
+	var hs []plumbing.Hash
+	for h := range p.counts {
+		hs = append(hs, h)
+	}
+
+	return hs, nil
+}
+
+func (p *geometricPacks) ObjectPackHashes(pack plumbing.Hash) ([]plumbing.Hash, error) {
+	return make([]plumbing.Hash, p.counts[pack]), nil
+}
+
+func (p *geometricPacks) ObjectPackTime(pack plumbing.Hash) (time.Time, error) {
+	return time.Time{}, nil
+}
+
+func (p *geometricPacks) ObjectPackKept(pack plumbing.Hash) (bool, error) {
+	return p.kept[pack], nil
+}
+
+func (p *geometricPacks) ObjectPackMTimes(pack plumbing.Hash) (map[plumbing.Hash]time.Time, error) {
+	if !p.cruft[pack] {
+		return nil, nil
+	}
+
+	return map[plumbing.Hash]time.Time{}, nil
+}
+
+func (p *geometricPacks) SetObjectPackMTimes(plumbing.Hash, map[plumbing.Hash]time.Time) error {
+	return nil
+}
+
+func (s *RepackSuite) TestGeometricRollUp(c *C) {
+	pack := func(i int) plumbing.Hash {
+		return plumbing.NewHash(string(rune('0'+i)) + "000000000000000000000000000000000000000")
+	}
+
+	for _, t := range []struct {
+		counts   []int
+		kept     []int
+		cruft    []int
+		expected []int
+	}{
+		{[]int{1, 1, 1, 100}, nil, nil, []int{0, 1, 2}},
+		{[]int{5, 20, 100}, nil, nil, nil},
+		{[]int{10, 12, 100}, nil, nil, []int{0, 1}},
+		{[]int{10, 12, 30}, nil, nil, []int{0, 1, 2}},
+		{[]int{1, 1, 100, 150}, nil, nil, []int{0, 1, 2, 3}},
+		{[]int{1, 1, 1, 100}, []int{3}, nil, []int{0, 1, 2}},
+		{[]int{1, 1, 100}, []int{0}, nil, nil},
+		{[]int{1, 1, 100}, nil, []int{0}, nil},
+		{[]int{1, 1, 1, 100}, nil, []int{2}, []int{0, 1}},
+		{nil, nil, nil, nil},
+	} {
+		p := &geometricPacks{
+			counts: make(map[plumbing.Hash]int),
+			kept:   make(map[plumbing.Hash]bool),
+			cruft:  make(map[plumbing.Hash]bool),
+		}
+
+		for i, n := range t.counts {
+			p.counts[pack(i)] = n
+		}
+
+		for _, i := range t.kept {
+			p.kept[pack(i)] = true
+		}
+
+		for _, i := range t.cruft {
+			p.cruft[pack(i)] = true
+		}
+
+		packs, err := geometricRollUp(p, p, 2)
+		c.Assert(err, IsNil)
+
+		var expected []plumbing.Hash
+		for _, i := range t.expected {
+			expected = append(expected, pack(i))
+		}
+
+		c.Assert(packs, HasLen, len(expected), Commentf("counts %v", t.counts))
+		for _, h := range expected {
+			c.Assert(containsHash(packs, h), Equals, true, Commentf("counts %v", t.counts))
+		}
+	}
+}
@@ -32,6 +32,10 @@ import (
 // GitDirName this is a special folder where all the git stuff is.
 const GitDirName = ".git"
 
+// worktreeConfigFile is the name of the worktree specific config file, in the
+// git directory.
+const worktreeConfigFile = "config.worktree"
+
 var (
 	// ErrBranchExists an error stating the specified branch already exists
 	ErrBranchExists = errors.New("branch already exists")
@@ -54,14 +58,16 @@ var (
 	ErrIsBareRepository          = errors.New("worktree not available in a bare repository")
 	ErrUnableToResolveCommit     = errors.New("unable to resolve commit")
 	ErrPackedObjectsNotSupported = errors.New("Packed objects not supported")
+	ErrMirrorNotBare             = errors.New("mirror clones must be bare")
 )
 
 // Repository represents a git repository
 type Repository struct {
 	Storer storage.Storer
 
-	r  map[string]*Remote
-	wt billy.Filesystem
+	r      map[string]*Remote
+	wt     billy.Filesystem
+	loader *config.Loader
 }
 
 // Init creates an empty git repository, based on the given Storer and worktree.
@@ -357,7 +363,11 @@ func PlainCloneContext(ctx context.Context, path string, isBare bool, o *CloneOp
 		return nil, err
 	}
 
-	err = r.clone(ctx, o)
+	err = r.copyLocalObjects(ctx, o)
+	if err == nil {
+		err = r.clone(ctx, o)
+	}
+
 	if err != nil && err != ErrRepositoryAlreadyExists {
 		if cleanup {
 			cleanUpDir(path, cleanupParent)
@@ -372,6 +382,7 @@ func newRepository(s storage.Storer, worktree billy.Filesystem) *Repository {
 		Storer: s,
 		wt:     worktree,
 		r:      make(map[string]*Remote),
+		loader: config.NewDefaultLoader(),
 	}
 }
 
@@ -439,6 +450,150 @@ func (r *Repository) Config() (*config.Config, error) {
 	return r.Storer.Config()
 }
 
+// ConfigScoped returns the repository config merged with the config of the
+// scopes with higher precedence than the given one, e.g. config.GlobalScope
+// returns the global, local and worktree config merged in one Config. The
+// system and global config files are read with the ConfigLoader of the
+// repository.
+func (r *Repository) ConfigScoped(scope config.Scope) (*config.Config, error) {
+	layered, err := r.LayeredConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	scoped := config.NewLayered()
+	for _, v := range layered.Values {
+		if v.Origin.Scope >= scope {
+			scoped.Add(v)
+		}
+	}
+
+	return scoped.Config()
+}
+
+// LayeredConfig returns the values of the system, global, local and worktree
+// config along with their origins, following the include and includeIf
+// sections. The system and global config files are read with the
+// ConfigLoader of the repository.
+func (r *Repository) LayeredConfig() (*config.Layered, error) {
+	return loadLayeredConfig(r.Storer, r.loader)
+}
+
+// ConfigLoader returns the Loader used to read the system and global config
+// files and the environment, by default config.NewDefaultLoader.
+func (r *Repository) ConfigLoader() *config.Loader {
+	return r.loader
+}
+
+// SetConfigLoader sets the Loader used to read the system and global config
+// files and the environment, by the repository and the remotes returned from
+// then on.
+func (r *Repository) SetConfigLoader(l *config.Loader) {
+	r.loader = l
+}
+
+// loadLayeredConfig reads the config of all the scopes for the repository
+// stored in s with the given loader, if s is nil only the system and global
+// config are read.
+func loadLayeredConfig(s storage.Storer, loader *config.Loader) (*config.Layered, error) {
+	ctx, err := includeContext(s)
+	if err != nil {
+		return nil, err
+	}
+
+	layered := config.NewLayered()
+	for _, scope := range []config.Scope{config.SystemScope, config.GlobalScope} {
+		cfg, err := loader.Load(scope, ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		layered.Values = append(layered.Values, cfg.Values...)
+	}
+
+	if s == nil {
+		return layered, nil
+	}
+
+	local, err := s.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := local.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	var fs billy.Filesystem
+	if fss, ok := s.(*filesystem.Storage); ok {
+		fs = fss.Filesystem()
+	}
+
+	if err := loader.Decode(layered, config.LocalScope, storagePath(fs, "config"), bytes.NewReader(b), ctx); err != nil {
+		return nil, err
+	}
+
+	wc := layered.Get("extensions", "", "worktreeConfig")
+	if fs == nil || wc == nil || !config.IsTrue(wc.Value) {
+		return layered, nil
+	}
+
+	f, err := fs.Open(worktreeConfigFile)
+	if os.IsNotExist(err) {
+		return layered, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+	if err := loader.Decode(layered, config.WorktreeScope, storagePath(fs, worktreeConfigFile), f, ctx); err != nil {
+		return nil, err
+	}
+
+	return layered, nil
+}
+
+// includeContext returns the information used to evaluate the includeIf
+// conditions of the config files.
+func includeContext(s storage.Storer) (*config.IncludeContext, error) {
+	ctx := &config.IncludeContext{}
+	if s == nil {
+		return ctx, nil
+	}
+
+	if fss, ok := s.(*filesystem.Storage); ok {
+		ctx.GitDir = storagePath(fss.Filesystem(), "")
+	}
+
+	head, err := s.Reference(plumbing.HEAD)
+	if err == plumbing.ErrReferenceNotFound {
+		return ctx, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if head.Type() == plumbing.SymbolicReference && head.Target().IsBranch() {
+		ctx.Branch = head.Target().Short()
+	}
+
+	return ctx, nil
+}
+
+// storagePath returns the absolute path of a file in the git directory, or
+// an empty string if the repository isn't stored in a filesystem.
+func storagePath(fs billy.Filesystem, name string) string {
+	if fs == nil {
+		return ""
+	}
+
+	return filepath.ToSlash(filepath.Join(fs.Root(), name))
+}
+
 // Remote return a remote if exists
 func (r *Repository) Remote(name string) (*Remote, error) {
 	cfg, err := r.Storer.Config()
@@ -451,7 +606,15 @@ func (r *Repository) Remote(name string) (*Remote, error) {
 		return nil, ErrRemoteNotFound
 	}
 
-	return NewRemote(r.Storer, c), nil
+	return r.newRemote(c), nil
+}
+
+// newRemote returns a Remote of the repository, reading the config with the
+// ConfigLoader of the repository.
+func (r *Repository) newRemote(c *config.RemoteConfig) *Remote {
+	remote := NewRemote(r.Storer, c)
+	remote.loader = r.loader
+	return remote
 }
 
 // Remotes returns a list with all the remotes
@@ -465,7 +628,7 @@ func (r *Repository) Remotes() ([]*Remote, error) {
 
 	var i int
 	for _, c := range cfg.Remotes {
-		remotes[i] = NewRemote(r.Storer, c)
+		remotes[i] = r.newRemote(c)
 		i++
 	}
 
@@ -478,7 +641,7 @@ func (r *Repository) CreateRemote(c *config.RemoteConfig) (*Remote, error) {
 		return nil, err
 	}
 
-	remote := NewRemote(r.Storer, c)
+	remote := r.newRemote(c)
 
 	cfg, err := r.Storer.Config()
 	if err != nil {
@@ -504,7 +667,7 @@ func (r *Repository) CreateRemoteAnonymous(c *config.RemoteConfig) (*Remote, err
 		return nil, ErrAnonymousRemoteName
 	}
 
-	remote := NewRemote(r.Storer, c)
+	remote := r.newRemote(c)
 
 	return remote, nil
 }
@@ -731,10 +894,25 @@ func (r *Repository) clone(ctx context.Context, o *CloneOptions) error {
 		return err
 	}
 
+	if o.Mirror && r.wt != nil {
+		return ErrMirrorNotBare
+	}
+
+	if o.ConfigLoader != nil {
+		r.loader = o.ConfigLoader
+	}
+
+	if o.Reference != "" {
+		if err := r.addReferenceAlternate(o.Reference); err != nil {
+			return err
+		}
+	}
+
 	c := &config.RemoteConfig{
-		Name:  o.RemoteName,
-		URLs:  []string{o.URL},
-		Fetch: r.cloneRefSpec(o),
+		Name:   o.RemoteName,
+		URLs:   []string{o.URL},
+		Fetch:  r.cloneRefSpec(o),
+		Mirror: o.Mirror,
 	}
 
 	if _, err := r.CreateRemote(c); err != nil {
@@ -748,11 +926,19 @@ func (r *Repository) clone(ctx context.Context, o *CloneOptions) error {
 		Progress:   o.Progress,
 		Tags:       o.Tags,
 		RemoteName: o.RemoteName,
+		Retry:      o.Retry,
+		BundleURI:  o.BundleURI,
 	}, o.ReferenceName)
 	if err != nil {
 		return err
 	}
 
+	if o.Reference != "" && o.Dissociate {
+		if err := r.dissociate(); err != nil {
+			return err
+		}
+	}
+
 	if r.wt != nil && !o.NoCheckout {
 		w, err := r.Worktree()
 		if err != nil {
@@ -785,7 +971,7 @@ func (r *Repository) clone(ctx context.Context, o *CloneOptions) error {
 		return err
 	}
 
-	if ref.Name().IsBranch() {
+	if ref.Name().IsBranch() && !o.Mirror {
 		branchRef := ref.Name()
 		branchName := strings.Split(string(branchRef), "refs/heads/")[1]
 
@@ -814,6 +1000,8 @@ const (
 
 func (r *Repository) cloneRefSpec(o *CloneOptions) []config.RefSpec {
 	switch {
+	case o.Mirror:
+		return []config.RefSpec{refspecMirror}
 	case o.ReferenceName.IsTag():
 		return []config.RefSpec{
 			config.RefSpec(fmt.Sprintf(refspecTag, o.ReferenceName.Short())),
@@ -1012,7 +1200,11 @@ func (r *Repository) FetchContext(ctx context.Context, o *FetchOptions) error {
 		return err
 	}
 
-	return remote.FetchContext(ctx, o)
+	if err := remote.FetchContext(ctx, o); err != nil || !o.AutoGC {
+		return err
+	}
+
+	return r.GC(&GCOptions{Auto: true})
 }
 
 // Push performs a push to the remote. Returns NoErrAlreadyUpToDate if
@@ -1030,8 +1222,8 @@ func (r *Repository) Push(o *PushOptions) error {
 // operation is complete, an error is returned. The context only affects to the
 // transport operations.
 func (r *Repository) PushContext(ctx context.Context, o *PushOptions) error {
-	if err := o.Validate(); err != nil {
-		return err
+	if o.RemoteName == "" {
+		o.RemoteName = DefaultRemoteName
 	}
 
 	remote, err := r.Remote(o.RemoteName)
@@ -1039,20 +1231,45 @@ func (r *Repository) PushContext(ctx context.Context, o *PushOptions) error {
 		return err
 	}
 
-	return remote.PushContext(ctx, o)
+	if len(o.RefSpecs) == 0 && !remote.c.Mirror {
+		specs, err := r.pushDefaultRefSpecs(o.RemoteName)
+		if err != nil {
+			return err
+		}
+
+		o.RefSpecs = specs
+	}
+
+	err = remote.PushContext(ctx, o)
+	if err != nil && err != NoErrAlreadyUpToDate {
+		return err
+	}
+
+	if o.SetUpstream {
+		if err := r.setUpstream(o.RemoteName, o.RefSpecs); err != nil {
+			return err
+		}
+	}
+
+	return err
 }
 
 // Log returns the commit history from the given LogOptions.
 func (r *Repository) Log(o *LogOptions) (object.CommitIter, error) {
-	fn := commitIterFunc(o.Order)
+	fn, err := r.commitNodeIterFunc(o.Order)
+	if err != nil {
+		return nil, err
+	}
+
+	if fn == nil {
+		fn = commitIterFunc(o.Order)
+	}
+
 	if fn == nil {
 		return nil, fmt.Errorf("invalid Order=%v", o.Order)
 	}
 
-	var (
-		it  object.CommitIter
-		err error
-	)
+	var it object.CommitIter
 	if o.All {
 		it, err = r.logAll(fn)
 	} else {
@@ -1467,6 +1684,26 @@ type RepackConfig struct {
 	// OnlyDeletePacksOlderThan if set to non-zero value
 	// selects only objects older than the time provided.
 	OnlyDeletePacksOlderThan time.Time
+	// WriteBitmaps writes the reachability bitmaps of the new packfile, used
+	// to find the objects reachable from its commits without walking the
+	// history, such as when serving a clone or a fetch.
+	WriteBitmaps bool
+	// WriteMultiPackIndex writes the multi-pack-index of the packfiles left
+	// after the repack. Otherwise the existing multi-pack-index is removed,
+	// as its packfiles are deleted.
+	WriteMultiPackIndex bool
+	// Geometric if not zero, instead of packing all the reachable objects,
+	// the loose objects and the objects of the smallest packfiles are packed
+	// together, so the packfiles left have each at least Geometric times the
+	// objects of the next smaller one, as git repack --geometric does. The
+	// factor must be at least 2. The kept and cruft packfiles are left
+	// untouched.
+	Geometric int
+	// OnlyLooseObjects if true, instead of packing all the reachable
+	// objects, only the loose objects are packed into a new packfile, and
+	// the existing packfiles are left untouched, as git repack without -a
+	// does. It's ignored if Geometric is set.
+	OnlyLooseObjects bool
 }
 
 func (r *Repository) RepackObjects(cfg *RepackConfig) (err error) {
@@ -1475,6 +1712,10 @@ func (r *Repository) RepackObjects(cfg *RepackConfig) (err error) {
 		return ErrPackedObjectsNotSupported
 	}
 
+	if cfg.Geometric != 0 || cfg.OnlyLooseObjects {
+		return r.repackIncremental(pos, cfg)
+	}
+
 	// Get the existing object packs.
 	hs, err := pos.ObjectPacks()
 	if err != nil {
@@ -1499,39 +1740,64 @@ func (r *Repository) RepackObjects(cfg *RepackConfig) (err error) {
 		}
 	}
 
-	return nil
+	if cfg.WriteBitmaps {
+		if err := r.writePackBitmap(nh); err != nil {
+			return err
+		}
+	}
+
+	return r.updateMultiPackIndex(cfg)
+}
+
+// updateMultiPackIndex writes or removes the multi-pack-index after a repack,
+// if the storage supports it.
+func (r *Repository) updateMultiPackIndex(cfg *RepackConfig) error {
+	s, ok := r.Storer.(storer.MultiPackIndexStorer)
+	if !ok {
+		if cfg.WriteMultiPackIndex {
+			return ErrMultiPackIndexNotSupported
+		}
+
+		return nil
+	}
+
+	if cfg.WriteMultiPackIndex {
+		return s.WriteMultiPackIndex()
+	}
+
+	return s.RemoveMultiPackIndex()
 }
 
 // createNewObjectPack is a helper for RepackObjects taking care
-// of creating a new pack. It is used so the the PackfileWriter
-// deferred close has the right scope.
+// of creating a new pack with all the objects reachable from the
+// references.
 func (r *Repository) createNewObjectPack(cfg *RepackConfig) (h plumbing.Hash, err error) {
 	ow := newObjectWalker(r.Storer)
 	err = ow.walkAllRefs()
 	if err != nil {
 		return h, err
 	}
+
+	return r.packObjects(ow, nil, cfg)
+}
+
+// packObjects writes a new pack with the objects seen by the walker, but the
+// ones in skip, and deletes their loose copies.
+func (r *Repository) packObjects(ow *objectWalker, skip map[plumbing.Hash]struct{}, cfg *RepackConfig) (h plumbing.Hash, err error) {
 	objs := make([]plumbing.Hash, 0, len(ow.seen))
 	for h := range ow.seen {
-		objs = append(objs, h)
-	}
-	pfw, ok := r.Storer.(storer.PackfileWriter)
-	if !ok {
-		return h, fmt.Errorf("Repository storer is not a storer.PackfileWriter")
-	}
-	wc, err := pfw.PackfileWriter()
-	if err != nil {
-		return h, err
-	}
-	defer ioutil.CheckClose(wc, &err)
-	scfg, err := r.Storer.Config()
-	if err != nil {
-		return h, err
+		if _, ok := skip[h]; !ok {
+			objs = append(objs, h)
+		}
 	}
-	enc := packfile.NewEncoder(wc, r.Storer, cfg.UseRefDeltas)
-	h, err = enc.Encode(objs, scfg.Pack.Window)
-	if err != nil {
-		return h, err
+
+	// An empty pack is only written without skip, so the repack of an
+	// empty repository still creates a pack.
+	if len(objs) != 0 || skip == nil {
+		h, err = r.encodeObjectPack(objs, cfg)
+		if err != nil {
+			return h, err
+		}
 	}
 
 	// Delete the packed, loose objects.
@@ -1552,3 +1818,23 @@ func (r *Repository) createNewObjectPack(cfg *RepackConfig) (h plumbing.Hash, er
 
 	return h, err
 }
+
+// encodeObjectPack writes the given objects to a new pack. It is used so the
+// PackfileWriter deferred close has the right scope.
+func (r *Repository) encodeObjectPack(objs []plumbing.Hash, cfg *RepackConfig) (h plumbing.Hash, err error) {
+	pfw, ok := r.Storer.(storer.PackfileWriter)
+	if !ok {
+		return h, fmt.Errorf("Repository storer is not a storer.PackfileWriter")
+	}
+	wc, err := pfw.PackfileWriter()
+	if err != nil {
+		return h, err
+	}
+	defer ioutil.CheckClose(wc, &err)
+	scfg, err := r.Storer.Config()
+	if err != nil {
+		return h, err
+	}
+	enc := packfile.NewEncoderWithMaxDepth(wc, r.Storer, cfg.UseRefDeltas, scfg.Pack.Depth)
+	return enc.Encode(objs, scfg.Pack.Window)
+}
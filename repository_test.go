@@ -396,6 +396,108 @@ func (s *RepositorySuite) TestDeleteBranch(c *C) {
 	c.Assert(err, Equals, ErrBranchNotFound)
 }
 
+func (s *RepositorySuite) TestLayeredConfig(c *C) {
+	dir, err := ioutil.TempDir("", "layered-config")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	r, err := PlainInit(dir, false)
+	c.Assert(err, IsNil)
+
+	gitdir := filepath.ToSlash(filepath.Join(dir, GitDirName))
+	fs := memfs.New()
+	err = util.WriteFile(fs, "/etc/gitconfig", []byte("[user]\n\tname = system\n"), 0644)
+	c.Assert(err, IsNil)
+	err = util.WriteFile(fs, "/home/user/.gitconfig", []byte(fmt.Sprintf(
+		"[user]\n\tname = global\n[includeIf \"gitdir:%s\"]\n\tpath = work\n", gitdir,
+	)), 0644)
+	c.Assert(err, IsNil)
+	err = util.WriteFile(fs, "/home/user/work", []byte("[user]\n\temail = work@example.com\n"), 0644)
+	c.Assert(err, IsNil)
+
+	loader := config.NewLoader(fs)
+	loader.Getenv = func(key string) string {
+		if key == "HOME" {
+			return "/home/user"
+		}
+
+		return ""
+	}
+
+	r.SetConfigLoader(loader)
+
+	cfg, err := r.Config()
+	c.Assert(err, IsNil)
+	cfg.Raw.SetOption("extensions", "", "worktreeConfig", "true")
+	c.Assert(r.Storer.SetConfig(cfg), IsNil)
+
+	err = ioutil.WriteFile(filepath.Join(gitdir, "config.worktree"), []byte("[user]\n\tname = worktree\n"), 0644)
+	c.Assert(err, IsNil)
+
+	layered, err := r.LayeredConfig()
+	c.Assert(err, IsNil)
+
+	names := layered.GetAll("user", "", "name")
+	c.Assert(names, HasLen, 3)
+	c.Assert(names[0].Origin, Equals, config.Origin{Scope: config.SystemScope, Path: "/etc/gitconfig"})
+	c.Assert(names[1].Origin, Equals, config.Origin{Scope: config.GlobalScope, Path: "/home/user/.gitconfig"})
+	c.Assert(names[2].Origin, Equals, config.Origin{
+		Scope: config.WorktreeScope,
+		Path:  filepath.ToSlash(filepath.Join(gitdir, "config.worktree")),
+	})
+
+	email := layered.Get("user", "", "email")
+	c.Assert(email, NotNil)
+	c.Assert(email.Value, Equals, "work@example.com")
+	c.Assert(email.Origin.Path, Equals, "/home/user/work")
+
+	bare := layered.Get("core", "", "bare")
+	c.Assert(bare.Origin, Equals, config.Origin{
+		Scope: config.LocalScope,
+		Path:  filepath.ToSlash(filepath.Join(gitdir, "config")),
+	})
+
+	scoped, err := r.ConfigScoped(config.LocalScope)
+	c.Assert(err, IsNil)
+	c.Assert(scoped.Raw.Section("user").Options.Get("name"), Equals, "worktree")
+	c.Assert(scoped.Raw.Section("user").Options.Get("email"), Equals, "")
+
+	scoped, err = r.ConfigScoped(config.SystemScope)
+	c.Assert(err, IsNil)
+	c.Assert(scoped.Raw.Section("user").Options.Get("email"), Equals, "work@example.com")
+}
+
+func (s *RepositorySuite) TestCloneConfigLoader(c *C) {
+	fs := memfs.New()
+	err := util.WriteFile(fs, "/home/user/.gitconfig", []byte(fmt.Sprintf(
+		"[url \"%s\"]\n\tinsteadOf = fixtures:\n", s.GetBasicLocalRepositoryURL(),
+	)), 0644)
+	c.Assert(err, IsNil)
+
+	loader := config.NewLoader(fs)
+	loader.Getenv = func(key string) string {
+		if key == "HOME" {
+			return "/home/user"
+		}
+
+		return ""
+	}
+
+	r, err := Clone(memory.NewStorage(), nil, &CloneOptions{
+		URL:          "fixtures:",
+		ConfigLoader: loader,
+	})
+	c.Assert(err, IsNil)
+	c.Assert(r.ConfigLoader(), Equals, loader)
+
+	head, err := r.Reference(plumbing.HEAD, true)
+	c.Assert(err, IsNil)
+	c.Assert(head.Hash(), Equals, plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+
+	_, err = Clone(memory.NewStorage(), nil, &CloneOptions{URL: "fixtures:"})
+	c.Assert(err, NotNil)
+}
+
 func (s *RepositorySuite) TestPlainInit(c *C) {
 	dir, err := ioutil.TempDir("", "plain-init")
 	c.Assert(err, IsNil)
@@ -618,6 +720,143 @@ func (s *RepositorySuite) TestPlainCloneWithRemoteName(c *C) {
 	c.Assert(remote, NotNil)
 }
 
+func (s *RepositorySuite) TestPlainCloneLocal(c *C) {
+	url := s.GetBasicLocalRepositoryURL()
+	packs, err := filepath.Glob(filepath.Join(url, "objects", "pack", "*.pack"))
+	c.Assert(err, IsNil)
+	c.Assert(packs, HasLen, 1)
+
+	source, err := os.Stat(packs[0])
+	c.Assert(err, IsNil)
+
+	for _, hardlinks := range []bool{true, false} {
+		dir := c.MkDir()
+		r, err := PlainClone(dir, true, &CloneOptions{URL: url, NoHardlinks: !hardlinks})
+		c.Assert(err, IsNil)
+
+		head, err := r.Head()
+		c.Assert(err, IsNil)
+		c.Assert(head.Hash().String(), Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+
+		cloned, err := os.Stat(filepath.Join(dir, "objects", "pack", filepath.Base(packs[0])))
+		c.Assert(err, IsNil)
+		c.Assert(os.SameFile(source, cloned), Equals, hardlinks)
+	}
+
+	dir := c.MkDir()
+	_, err = PlainClone(dir, true, &CloneOptions{URL: url, NoLocal: true})
+	c.Assert(err, IsNil)
+
+	_, err = os.Stat(filepath.Join(dir, "objects", "pack", filepath.Base(packs[0])))
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
+
+func (s *RepositorySuite) TestPlainCloneReference(c *C) {
+	url := s.GetBasicLocalRepositoryURL()
+	reference := s.GetBasicLocalRepositoryURL()
+
+	dir := c.MkDir()
+	r, err := PlainClone(dir, true, &CloneOptions{URL: url, Reference: reference})
+	c.Assert(err, IsNil)
+
+	alternates, err := ioutil.ReadFile(filepath.Join(dir, "objects", "info", "alternates"))
+	c.Assert(err, IsNil)
+	c.Assert(string(alternates), Equals, filepath.Join(reference, "objects")+"\n")
+
+	packs, err := filepath.Glob(filepath.Join(dir, "objects", "pack", "*.pack"))
+	c.Assert(err, IsNil)
+	c.Assert(packs, HasLen, 0)
+
+	_, err = r.CommitObject(plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	c.Assert(err, IsNil)
+
+	dir = c.MkDir()
+	r, err = PlainClone(dir, true, &CloneOptions{URL: url, Reference: reference, Dissociate: true})
+	c.Assert(err, IsNil)
+
+	_, err = os.Stat(filepath.Join(dir, "objects", "info", "alternates"))
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	packs, err = filepath.Glob(filepath.Join(dir, "objects", "pack", "*.pack"))
+	c.Assert(err, IsNil)
+	c.Assert(packs, HasLen, 1)
+
+	commits, err := r.Log(&LogOptions{})
+	c.Assert(err, IsNil)
+	var count int
+	c.Assert(commits.ForEach(func(*object.Commit) error { count++; return nil }), IsNil)
+	c.Assert(count, Equals, 8)
+
+	_, err = Clone(memory.NewStorage(), nil, &CloneOptions{URL: url, Reference: reference})
+	c.Assert(err, Equals, ErrAlternatesNotSupported)
+}
+
+func (s *RepositorySuite) TestPlainCloneMirror(c *C) {
+	url := s.GetBasicLocalRepositoryURL()
+	r, err := PlainClone(c.MkDir(), true, &CloneOptions{URL: url, Mirror: true})
+	c.Assert(err, IsNil)
+
+	cfg, err := r.Config()
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Branches, HasLen, 0)
+	c.Assert(cfg.Remotes[DefaultRemoteName].Mirror, Equals, true)
+	c.Assert(cfg.Remotes[DefaultRemoteName].Fetch, DeepEquals, []config.RefSpec{"+refs/*:refs/*"})
+
+	AssertReferences(c, r, map[string]string{
+		"refs/heads/master": "6ecf0ef2c2dffb796033e5a02219af86ec6584e5",
+		"refs/heads/branch": "e8d3ffab552895c19b9fcf7aa264d277cde33881",
+		"refs/tags/v1.0.0":  "6ecf0ef2c2dffb796033e5a02219af86ec6584e5",
+	})
+
+	_, err = PlainClone(c.MkDir(), false, &CloneOptions{URL: url, Mirror: true})
+	c.Assert(err, Equals, ErrMirrorNotBare)
+}
+
+func (s *RepositorySuite) TestPushMirror(c *C) {
+	url := c.MkDir()
+	server, err := PlainInit(url, true)
+	c.Assert(err, IsNil)
+
+	r, err := PlainClone(c.MkDir(), true, &CloneOptions{
+		URL:    s.GetBasicLocalRepositoryURL(),
+		Mirror: true,
+	})
+	c.Assert(err, IsNil)
+
+	_, err = r.CreateRemote(&config.RemoteConfig{
+		Name:   "backup",
+		URLs:   []string{url},
+		Mirror: true,
+	})
+	c.Assert(err, IsNil)
+
+	o := &PushOptions{RemoteName: "backup"}
+	err = r.Push(o)
+	c.Assert(err, IsNil)
+	c.Assert(o.RefSpecs, HasLen, 0)
+	c.Assert(o.Prune, Equals, false)
+
+	AssertReferences(c, server, map[string]string{
+		"refs/heads/master": "6ecf0ef2c2dffb796033e5a02219af86ec6584e5",
+		"refs/heads/branch": "e8d3ffab552895c19b9fcf7aa264d277cde33881",
+		"refs/tags/v1.0.0":  "6ecf0ef2c2dffb796033e5a02219af86ec6584e5",
+	})
+
+	c.Assert(r.Storer.RemoveReference("refs/heads/branch"), IsNil)
+	c.Assert(r.Storer.SetReference(plumbing.NewReferenceFromStrings(
+		"refs/heads/master", "918c48b83bd081e863dbe1b80f8998f058cd8294")), IsNil)
+
+	err = r.Push(o)
+	c.Assert(err, IsNil)
+
+	AssertReferences(c, server, map[string]string{
+		"refs/heads/master": "918c48b83bd081e863dbe1b80f8998f058cd8294",
+	})
+
+	_, err = server.Reference("refs/heads/branch", false)
+	c.Assert(err, Equals, plumbing.ErrReferenceNotFound)
+}
+
 func (s *RepositorySuite) TestPlainCloneOverExistingGitDirectory(c *C) {
 	tmpDir := c.MkDir()
 	r, err := PlainInit(tmpDir, false)
@@ -2036,6 +2275,32 @@ func (s *RepositorySuite) TestCreateTagAnnotatedBadOpts(c *C) {
 	c.Assert(err, Equals, ErrMissingMessage)
 }
 
+func (s *RepositorySuite) TestCreateTagAnnotatedTaggerFromConfig(c *C) {
+	r, _ := Init(memory.NewStorage(), nil)
+	err := r.clone(context.Background(), &CloneOptions{URL: s.GetBasicLocalRepositoryURL()})
+	c.Assert(err, IsNil)
+
+	cfg, err := r.Config()
+	c.Assert(err, IsNil)
+	cfg.User.Name = "John Doe"
+	cfg.User.Email = "john@example.com"
+	cfg.Author.Name = "Not Used"
+	c.Assert(r.Storer.SetConfig(cfg), IsNil)
+
+	h, err := r.Head()
+	c.Assert(err, IsNil)
+
+	ref, err := r.CreateTag("foobar", h.Hash(), &CreateTagOptions{
+		Message: "foo bar baz qux",
+	})
+	c.Assert(err, IsNil)
+
+	tag, err := r.TagObject(ref.Hash())
+	c.Assert(err, IsNil)
+	c.Assert(tag.Tagger.Name, Equals, "John Doe")
+	c.Assert(tag.Tagger.Email, Equals, "john@example.com")
+}
+
 func (s *RepositorySuite) TestCreateTagAnnotatedBadHash(c *C) {
 	url := s.GetLocalRepositoryURL(
 		fixtures.ByURL("https://github.com/git-fixtures/tags.git").One(),
@@ -2755,9 +3020,10 @@ func (s *RepositorySuite) TestBrokenMultipleShallowFetch(c *C) {
 		RefSpecs: []config.RefSpec{config.RefSpec("refs/heads/*:refs/heads/*")},
 	}), IsNil)
 
+	// the previous shallow commit is unshallowed by the server, like git does
 	shallows, err = r.Storer.Shallow()
 	c.Assert(err, IsNil)
-	c.Assert(len(shallows), Equals, 3)
+	c.Assert(len(shallows), Equals, 2)
 
 	ref, err = r.Reference("refs/heads/master", true)
 	c.Assert(err, IsNil)
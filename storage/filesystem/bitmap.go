@@ -0,0 +1,112 @@
+package filesystem
+
+import (
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/bitmap"
+	"gopkg.in/src-d/go-git.v4/utils/ioutil"
+)
+
+// PackBitmap returns the reachability bitmaps of the first packfile with a
+// bitmap file, as git does, nil if there is none.
+func (s *ObjectStorage) PackBitmap() (*bitmap.Index, error) {
+	if err := s.requireIndex(); err != nil {
+		return nil, err
+	}
+
+	if s.packBitmapLoaded {
+		return s.packBitmap, nil
+	}
+
+	packs, err := s.dir.ObjectPacks()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, h := range packs {
+		idx, err := s.readPackBitmap(h)
+		if err != nil {
+			return nil, err
+		}
+
+		if idx != nil {
+			s.packBitmap = idx
+			break
+		}
+	}
+
+	s.packBitmapLoaded = true
+	return s.packBitmap, nil
+}
+
+func (s *ObjectStorage) readPackBitmap(pack plumbing.Hash) (idx *bitmap.Index, err error) {
+	f, err := s.dir.ObjectPackBitmap(pack)
+	if f == nil || err != nil {
+		return nil, err
+	}
+
+	defer ioutil.CheckClose(f, &err)
+	idx, err = s.NewPackBitmap(pack)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := bitmap.NewDecoder(f).Decode(idx); err != nil {
+		return nil, err
+	}
+
+	return idx, nil
+}
+
+// NewPackBitmap returns an Index without bitmaps of the given packfile.
+func (s *ObjectStorage) NewPackBitmap(pack plumbing.Hash) (*bitmap.Index, error) {
+	if err := s.requireIndex(); err != nil {
+		return nil, err
+	}
+
+	idx, err := s.packIndex(pack)
+	if err != nil {
+		return nil, err
+	}
+
+	return bitmap.NewIndex(pack, idx)
+}
+
+// SetPackBitmap writes the bitmap file of the packfile of the given Index,
+// removing the ones of the other packfiles.
+func (s *ObjectStorage) SetPackBitmap(idx *bitmap.Index) error {
+	f, err := s.dir.NewObjectPackBitmap()
+	if err != nil {
+		return err
+	}
+
+	if err := bitmap.NewEncoder(f).Encode(idx); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	packs, err := s.dir.ObjectPacks()
+	if err != nil {
+		return err
+	}
+
+	for _, h := range packs {
+		if h == idx.Packfile() {
+			continue
+		}
+
+		if err := s.dir.RemoveObjectPackBitmap(h); err != nil {
+			return err
+		}
+	}
+
+	if err := s.dir.SetObjectPackBitmap(f, idx.Packfile()); err != nil {
+		return err
+	}
+
+	s.packBitmap, s.packBitmapLoaded = idx, true
+	return nil
+}
@@ -0,0 +1,59 @@
+package filesystem
+
+import (
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git-fixtures.v3"
+)
+
+type PackBitmapSuite struct {
+	fixtures.Suite
+}
+
+var _ = Suite(&PackBitmapSuite{})
+
+func (s *PackBitmapSuite) TestSetPackBitmap(c *C) {
+	fs := fixtures.Basic().One().DotGit()
+	sto := NewStorage(fs, cache.NewObjectLRUDefault())
+
+	idx, err := sto.PackBitmap()
+	c.Assert(err, IsNil)
+	c.Assert(idx, IsNil)
+
+	packs, err := sto.ObjectPacks()
+	c.Assert(err, IsNil)
+
+	idx, err = sto.NewPackBitmap(packs[0])
+	c.Assert(err, IsNil)
+
+	commit := plumbing.NewHash("1669dce138d9b841a518c64b10914d88f5e488ea")
+	pos, ok := idx.Position(commit)
+	c.Assert(ok, Equals, true)
+	idx.SetType(pos, plumbing.CommitObject)
+	b := idx.TypeBitmap(plumbing.CommitObject).Clone()
+	c.Assert(idx.Add(commit, b), IsNil)
+	c.Assert(sto.SetPackBitmap(idx), IsNil)
+
+	_, err = fs.Stat(fs.Join("objects", "pack", "pack-"+packs[0].String()+".bitmap"))
+	c.Assert(err, IsNil)
+
+	sto = NewStorage(fs, cache.NewObjectLRUDefault())
+	idx, err = sto.PackBitmap()
+	c.Assert(err, IsNil)
+	c.Assert(idx, NotNil)
+	c.Assert(idx.Packfile(), Equals, packs[0])
+	c.Assert(idx.Commits(), DeepEquals, []plumbing.Hash{commit})
+	c.Assert(idx.Bitmap(commit).Equal(b), Equals, true)
+
+	c.Assert(sto.DeleteOldObjectPackAndIndex(packs[0], time.Time{}), IsNil)
+	_, err = fs.Stat(fs.Join("objects", "pack", "pack-"+packs[0].String()+".bitmap"))
+	c.Assert(err, NotNil)
+
+	idx, err = sto.PackBitmap()
+	c.Assert(err, IsNil)
+	c.Assert(idx, IsNil)
+}
@@ -0,0 +1,233 @@
+package filesystem
+
+import (
+	"bytes"
+	"io"
+	stdioutil "io/ioutil"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/commitgraph"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem/dotgit"
+	"gopkg.in/src-d/go-git.v4/utils/ioutil"
+
+	"gopkg.in/src-d/go-billy.v4"
+)
+
+// commitGraphSizeMultiple is the minimum size ratio between two consecutive
+// layers of a split commit-graph chain, the top layers are merged while
+// they're bigger than the layer below them divided by this ratio, as git
+// does by default.
+const commitGraphSizeMultiple = 2
+
+// CommitGraphStorage is where the commit-graph is stored, either as the
+// objects/info/commit-graph file or as a split commit-graph chain in
+// objects/info/commit-graphs.
+type CommitGraphStorage struct {
+	dir *dotgit.DotGit
+
+	// graph is the last commit-graph read, valid while the stamp of the
+	// files doesn't change.
+	graph commitgraph.Index
+	stamp string
+}
+
+// CommitGraph returns the commit-graph of the repository, the split
+// commit-graph chain if any, nil if there is no commit-graph.
+func (s *CommitGraphStorage) CommitGraph() (commitgraph.Index, error) {
+	stamp, err := s.dir.CommitGraphStamp()
+	if err != nil {
+		return nil, err
+	}
+
+	if stamp != s.stamp {
+		if s.graph, err = s.readCommitGraph(); err != nil {
+			return nil, err
+		}
+
+		s.stamp = stamp
+	}
+
+	return s.graph, nil
+}
+
+func (s *CommitGraphStorage) readCommitGraph() (commitgraph.Index, error) {
+	idx, _, err := s.commitGraphChain()
+	if idx != nil || err != nil {
+		return idx, err
+	}
+
+	f, err := s.dir.CommitGraph()
+	if f == nil || err != nil {
+		return nil, err
+	}
+
+	r, err := readAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	return commitgraph.OpenFileIndex(r)
+}
+
+// commitGraphChain returns the index of the split commit-graph chain and the
+// indexes of each of its layers, from the base to the top one.
+func (s *CommitGraphStorage) commitGraphChain() (commitgraph.Index, []commitgraph.Index, error) {
+	chain, err := s.dir.CommitGraphChain()
+	if len(chain) == 0 || err != nil {
+		return nil, nil, err
+	}
+
+	readers := make([]io.ReaderAt, len(chain))
+	layers := make([]commitgraph.Index, len(chain))
+	for i, h := range chain {
+		f, err := s.dir.CommitGraphLayer(h)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if readers[i], err = readAll(f); err != nil {
+			return nil, nil, err
+		}
+
+		if layers[i], err = commitgraph.OpenChainIndex(readers[:i+1]); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return layers[len(layers)-1], layers, nil
+}
+
+// SetCommitGraph writes the commits of idx to the commit-graph file, removing
+// the split commit-graph chain if any.
+func (s *CommitGraphStorage) SetCommitGraph(idx commitgraph.Index) error {
+	w, err := s.writeCommitGraph(idx, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	return s.dir.SetCommitGraph(w)
+}
+
+// AddCommitGraphLayer writes the commits of idx missing in the split
+// commit-graph chain as a new layer on top of it. As git does, the top layers
+// of the chain are merged with the new one while they have less than
+// commitGraphSizeMultiple times its commits. A commit-graph file is replaced
+// by the chain.
+func (s *CommitGraphStorage) AddCommitGraphLayer(idx commitgraph.Index) error {
+	chain, err := s.dir.CommitGraphChain()
+	if err != nil {
+		return err
+	}
+
+	top, layers, err := s.commitGraphChain()
+	if err != nil {
+		return err
+	}
+
+	// the commits of the chain are kept, even if they aren't in idx, since
+	// the merged layers are rewritten
+	all := commitgraph.NewMemoryIndex()
+	added := 0
+	for _, h := range idx.Hashes() {
+		data, err := commitData(idx, h)
+		if err != nil {
+			return err
+		}
+
+		if top != nil {
+			if _, err := top.GetIndexByHash(h); err == nil {
+				continue
+			}
+		}
+
+		all.Add(h, data)
+		added++
+	}
+
+	if top != nil {
+		for _, h := range top.Hashes() {
+			data, err := commitData(top, h)
+			if err != nil {
+				return err
+			}
+
+			all.Add(h, data)
+		}
+	}
+
+	count := added
+	for len(layers) > 0 {
+		var below int
+		if len(layers) > 1 {
+			below = len(layers[len(layers)-2].Hashes())
+		}
+
+		layer := len(layers[len(layers)-1].Hashes()) - below
+		if count*commitGraphSizeMultiple < layer {
+			break
+		}
+
+		count += layer
+		layers = layers[:len(layers)-1]
+		chain = chain[:len(chain)-1]
+	}
+
+	var base commitgraph.Index
+	if len(layers) > 0 {
+		base = layers[len(layers)-1]
+	}
+
+	w, err := s.writeCommitGraph(all, base, chain)
+	if err != nil {
+		return err
+	}
+
+	return s.dir.SetCommitGraphChain(chain, w)
+}
+
+func (s *CommitGraphStorage) writeCommitGraph(idx, base commitgraph.Index, baseGraphs []plumbing.Hash) (*dotgit.CommitGraphWriter, error) {
+	w, err := s.dir.NewCommitGraph()
+	if err != nil {
+		return nil, err
+	}
+
+	err = commitgraph.NewEncoder(w).EncodeLayer(idx, base, baseGraphs)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		_ = s.dir.Fs().Remove(w.Name())
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func commitData(idx commitgraph.Index, h plumbing.Hash) (*commitgraph.CommitData, error) {
+	i, err := idx.GetIndexByHash(h)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := idx.GetCommitDataByIndex(i)
+	if err != nil {
+		return nil, err
+	}
+
+	c := *data
+	return &c, nil
+}
+
+// readAll reads and closes f, the commit-graph files are kept in memory so
+// they aren't kept open.
+func readAll(f billy.File) (r *bytes.Reader, err error) {
+	defer ioutil.CheckClose(f, &err)
+
+	b, err := stdioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.NewReader(b), nil
+}
@@ -0,0 +1,153 @@
+package filesystem
+
+import (
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/commitgraph"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	"gopkg.in/src-d/go-billy.v4/util"
+)
+
+type CommitGraphSuite struct {
+	fs billy.Filesystem
+	s  *Storage
+}
+
+var _ = Suite(&CommitGraphSuite{})
+
+func (s *CommitGraphSuite) SetUpTest(c *C) {
+	s.fs = osfs.New(c.MkDir())
+	s.s = NewStorage(s.fs, cache.NewObjectLRUDefault())
+}
+
+// linearHistory returns an index with n commits, each one the parent of the
+// next one.
+func linearHistory(n int) (*commitgraph.MemoryIndex, []plumbing.Hash) {
+	idx := commitgraph.NewMemoryIndex()
+	var hashes []plumbing.Hash
+	for i := 0; i < n; i++ {
+		h := plumbing.ComputeHash(plumbing.CommitObject, []byte{byte(i)})
+		data := &commitgraph.CommitData{
+			TreeHash:   plumbing.ComputeHash(plumbing.TreeObject, []byte{byte(i)}),
+			Generation: i + 1,
+			When:       time.Unix(int64(i), 0),
+		}
+
+		if i > 0 {
+			data.ParentHashes = []plumbing.Hash{hashes[i-1]}
+		}
+
+		idx.Add(h, data)
+		hashes = append(hashes, h)
+	}
+
+	return idx, hashes
+}
+
+func (s *CommitGraphSuite) chain(c *C) []plumbing.Hash {
+	chain, err := s.s.dir.CommitGraphChain()
+	c.Assert(err, IsNil)
+	return chain
+}
+
+func (s *CommitGraphSuite) assertGraph(c *C, hashes []plumbing.Hash) {
+	graph, err := s.s.CommitGraph()
+	c.Assert(err, IsNil)
+	c.Assert(graph.Hashes(), HasLen, len(hashes))
+
+	for i, h := range hashes {
+		idx, err := graph.GetIndexByHash(h)
+		c.Assert(err, IsNil)
+
+		data, err := graph.GetCommitDataByIndex(idx)
+		c.Assert(err, IsNil)
+		c.Assert(data.Generation, Equals, i+1)
+		if i > 0 {
+			c.Assert(data.ParentHashes, DeepEquals, []plumbing.Hash{hashes[i-1]})
+		}
+	}
+}
+
+func (s *CommitGraphSuite) TestNoCommitGraph(c *C) {
+	graph, err := s.s.CommitGraph()
+	c.Assert(err, IsNil)
+	c.Assert(graph, IsNil)
+}
+
+func (s *CommitGraphSuite) TestSetCommitGraph(c *C) {
+	idx, hashes := linearHistory(4)
+	c.Assert(s.s.SetCommitGraph(idx), IsNil)
+	s.assertGraph(c, hashes)
+
+	_, err := s.fs.Stat("objects/info/commit-graph")
+	c.Assert(err, IsNil)
+	c.Assert(s.chain(c), HasLen, 0)
+}
+
+func (s *CommitGraphSuite) TestAddCommitGraphLayer(c *C) {
+	idx, hashes := linearHistory(14)
+
+	c.Assert(s.s.SetCommitGraph(partialHistory(idx, hashes[:8])), IsNil)
+	c.Assert(s.s.AddCommitGraphLayer(partialHistory(idx, hashes[:8])), IsNil)
+	c.Assert(s.chain(c), HasLen, 1)
+	s.assertGraph(c, hashes[:8])
+
+	// the commit-graph file is replaced by the chain
+	_, err := s.fs.Stat("objects/info/commit-graph")
+	c.Assert(err, NotNil)
+
+	// 2 commits are less than half of the 8 of the layer below
+	c.Assert(s.s.AddCommitGraphLayer(partialHistory(idx, hashes[:10])), IsNil)
+	c.Assert(s.chain(c), HasLen, 2)
+	s.assertGraph(c, hashes[:10])
+
+	// 4 commits are more than half of the 2 of the top layer, and the 6 of
+	// the merged layer are more than half of the base
+	c.Assert(s.s.AddCommitGraphLayer(partialHistory(idx, hashes)), IsNil)
+	c.Assert(s.chain(c), HasLen, 1)
+	s.assertGraph(c, hashes)
+
+	files, err := s.fs.ReadDir("objects/info/commit-graphs")
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 2)
+
+	// a commit-graph file replaces the chain
+	c.Assert(s.s.SetCommitGraph(idx), IsNil)
+	c.Assert(s.chain(c), HasLen, 0)
+	s.assertGraph(c, hashes)
+
+	files, err = s.fs.ReadDir("objects/info/commit-graphs")
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 0)
+}
+
+func (s *CommitGraphSuite) TestCommitGraphReplacedExternally(c *C) {
+	idx, hashes := linearHistory(4)
+	c.Assert(s.s.SetCommitGraph(partialHistory(idx, hashes[:2])), IsNil)
+	s.assertGraph(c, hashes[:2])
+
+	// another storage writes the commit-graph
+	other := NewStorage(s.fs, cache.NewObjectLRUDefault())
+	c.Assert(util.RemoveAll(s.fs, "objects/info/commit-graph"), IsNil)
+	c.Assert(other.SetCommitGraph(idx), IsNil)
+	s.assertGraph(c, hashes)
+}
+
+// partialHistory returns an index with the commits of idx with the given
+// hashes.
+func partialHistory(idx commitgraph.Index, hashes []plumbing.Hash) commitgraph.Index {
+	partial := commitgraph.NewMemoryIndex()
+	for _, h := range hashes {
+		i, _ := idx.GetIndexByHash(h)
+		data, _ := idx.GetCommitDataByIndex(i)
+		c := *data
+		partial.Add(h, &c)
+	}
+
+	return partial
+}
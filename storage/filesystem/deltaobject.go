@@ -9,18 +9,22 @@ type deltaObject struct {
 	base plumbing.Hash
 	hash plumbing.Hash
 	size int64
+
+	compressed func() ([]byte, error)
 }
 
 func newDeltaObject(
 	obj plumbing.EncodedObject,
 	hash plumbing.Hash,
 	base plumbing.Hash,
-	size int64) plumbing.DeltaObject {
+	size int64,
+	compressed func() ([]byte, error)) plumbing.DeltaObject {
 	return &deltaObject{
 		EncodedObject: obj,
 		hash:          hash,
 		base:          base,
 		size:          size,
+		compressed:    compressed,
 	}
 }
 
@@ -35,3 +39,21 @@ func (o *deltaObject) ActualSize() int64 {
 func (o *deltaObject) ActualHash() plumbing.Hash {
 	return o.hash
 }
+
+// CompressedContent implements the packfile.CompressedObject interface,
+// returning the compressed delta as stored in its packfile.
+func (o *deltaObject) CompressedContent() ([]byte, error) {
+	return o.compressed()
+}
+
+// packedObject is a whole object stored in a packfile, which compressed
+// content is reused by the packfile encoder.
+type packedObject struct {
+	plumbing.EncodedObject
+	compressed func() ([]byte, error)
+}
+
+// CompressedContent implements the packfile.CompressedObject interface.
+func (o *packedObject) CompressedContent() ([]byte, error) {
+	return o.compressed()
+}
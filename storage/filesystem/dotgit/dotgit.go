@@ -176,6 +176,16 @@ func (d *DotGit) ShallowWriter() (billy.File, error) {
 	return d.fs.Create(shallowPath)
 }
 
+// RemoveShallow removes the shallow file, if any.
+func (d *DotGit) RemoveShallow() error {
+	err := d.fs.Remove(shallowPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
 // Shallow returns a file pointer for read to the shallow file
 func (d *DotGit) Shallow() (billy.File, error) {
 	f, err := d.fs.Open(shallowPath)
@@ -298,6 +308,34 @@ func (d *DotGit) ObjectPackIdx(hash plumbing.Hash) (billy.File, error) {
 	return d.objectPackOpen(hash, `idx`)
 }
 
+// ObjectPackStat returns the os.FileInfo of the given packfile.
+func (d *DotGit) ObjectPackStat(hash plumbing.Hash) (os.FileInfo, error) {
+	if err := d.hasPack(hash); err != nil {
+		return nil, err
+	}
+
+	return d.fs.Stat(d.objectPackPath(hash, `pack`))
+}
+
+// ObjectPackKept returns whether the given packfile has a .keep file, so it
+// must be left untouched when repacking.
+func (d *DotGit) ObjectPackKept(hash plumbing.Hash) (bool, error) {
+	if err := d.hasPack(hash); err != nil {
+		return false, err
+	}
+
+	_, err := d.fs.Stat(d.objectPackPath(hash, `keep`))
+	if err == nil {
+		return true, nil
+	}
+
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	return false, err
+}
+
 func (d *DotGit) DeleteOldObjectPackAndIndex(hash plumbing.Hash, t time.Time) error {
 	d.cleanPackList()
 
@@ -316,6 +354,12 @@ func (d *DotGit) DeleteOldObjectPackAndIndex(hash plumbing.Hash, t time.Time) er
 	if err != nil {
 		return err
 	}
+	if err := d.RemoveObjectPackBitmap(hash); err != nil {
+		return err
+	}
+	if err := d.RemoveObjectPackMTimes(hash); err != nil {
+		return err
+	}
 	return d.fs.Remove(d.objectPackPath(hash, `idx`))
 }
 
@@ -973,6 +1017,14 @@ func (d *DotGit) PackRefs() (err error) {
 	if err = d.addRefsFromRefDir(&refs, seen); err != nil {
 		return err
 	}
+	// Symbolic refs can't be packed, keep them loose.
+	hashRefs := refs[:0]
+	for _, ref := range refs {
+		if ref.Type() == plumbing.HashReference {
+			hashRefs = append(hashRefs, ref)
+		}
+	}
+	refs = hashRefs
 	if len(refs) == 0 {
 		// Nothing to do!
 		return nil
@@ -1070,6 +1122,60 @@ func (d *DotGit) Alternates() ([]*DotGit, error) {
 	return alternates, nil
 }
 
+// AddAlternate adds the path of the objects directory of another repository
+// to objects/info/alternates, if not already present.
+func (d *DotGit) AddAlternate(path string) error {
+	altpath := d.fs.Join("objects", "info", "alternates")
+
+	var paths []string
+	f, err := d.fs.Open(altpath)
+	if err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			paths = append(paths, scanner.Text())
+		}
+
+		err = scanner.Err()
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for _, p := range paths {
+		if p == path {
+			return nil
+		}
+	}
+
+	f, err = d.fs.Create(altpath)
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(f, &err)
+	for _, p := range append(paths, path) {
+		if _, err = fmt.Fprintln(f, p); err != nil {
+			return err
+		}
+	}
+
+	return err
+}
+
+// RemoveAlternates removes objects/info/alternates, if any.
+func (d *DotGit) RemoveAlternates() error {
+	err := d.fs.Remove(d.fs.Join("objects", "info", "alternates"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
 // Fs returns the underlying filesystem of the DotGit folder.
 func (d *DotGit) Fs() billy.Filesystem {
 	return d.fs
@@ -0,0 +1,46 @@
+package dotgit
+
+import (
+	"os"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+
+	"gopkg.in/src-d/go-billy.v4"
+)
+
+// ObjectPackBitmap returns a file pointer for read to the reachability bitmap
+// file of the given packfile, nil if it has none.
+func (d *DotGit) ObjectPackBitmap(hash plumbing.Hash) (billy.File, error) {
+	if err := d.hasPack(hash); err != nil {
+		return nil, err
+	}
+
+	return d.openIfExists(d.objectPackPath(hash, `bitmap`))
+}
+
+// NewObjectPackBitmap returns a temporary file to write a new bitmap file,
+// until it's set by SetObjectPackBitmap.
+func (d *DotGit) NewObjectPackBitmap() (billy.File, error) {
+	return d.fs.TempFile(d.fs.Join(objectsPath, packPath), "tmp_bitmap_")
+}
+
+// SetObjectPackBitmap makes the file f, already closed, the bitmap file of
+// the given packfile.
+func (d *DotGit) SetObjectPackBitmap(f billy.File, hash plumbing.Hash) error {
+	if err := d.hasPack(hash); err != nil {
+		return err
+	}
+
+	return d.fs.Rename(f.Name(), d.objectPackPath(hash, `bitmap`))
+}
+
+// RemoveObjectPackBitmap removes the bitmap file of the given packfile, if
+// any.
+func (d *DotGit) RemoveObjectPackBitmap(hash plumbing.Hash) error {
+	err := d.fs.Remove(d.objectPackPath(hash, `bitmap`))
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,249 @@
+package dotgit
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/utils/ioutil"
+
+	"gopkg.in/src-d/go-billy.v4"
+)
+
+const (
+	commitGraphPath      = "commit-graph"
+	commitGraphsPath     = "commit-graphs"
+	commitGraphChainPath = "commit-graph-chain"
+
+	commitGraphExt = ".graph"
+)
+
+// CommitGraph returns a file pointer for read to the commit-graph file, nil
+// if it doesn't exist.
+func (d *DotGit) CommitGraph() (billy.File, error) {
+	return d.openIfExists(d.fs.Join(objectsPath, "info", commitGraphPath))
+}
+
+// CommitGraphChain returns the checksums of the layers of the split
+// commit-graph chain, from the base layer to the top one, nil if there is no
+// chain.
+func (d *DotGit) CommitGraphChain() (hashes []plumbing.Hash, err error) {
+	f, err := d.openIfExists(d.commitGraphsPath(commitGraphChainPath))
+	if f == nil || err != nil {
+		return nil, err
+	}
+
+	defer ioutil.CheckClose(f, &err)
+
+	scn := bufio.NewScanner(f)
+	for scn.Scan() {
+		line := strings.TrimSpace(scn.Text())
+		if line == "" {
+			continue
+		}
+
+		if !isHex(line) || len(line) != 40 {
+			return nil, fmt.Errorf("malformed commit-graph chain: %q", line)
+		}
+
+		hashes = append(hashes, plumbing.NewHash(line))
+	}
+
+	return hashes, scn.Err()
+}
+
+// CommitGraphLayer returns a file pointer for read to the layer of the split
+// commit-graph chain with the given checksum.
+func (d *DotGit) CommitGraphLayer(h plumbing.Hash) (billy.File, error) {
+	return d.fs.Open(d.commitGraphLayerPath(h))
+}
+
+// CommitGraphStamp returns a string that changes when the commit-graph file or
+// the split commit-graph chain are replaced.
+func (d *DotGit) CommitGraphStamp() (string, error) {
+	var stamp string
+	paths := []string{
+		d.fs.Join(objectsPath, "info", commitGraphPath),
+		d.commitGraphsPath(commitGraphChainPath),
+	}
+
+	for _, path := range paths {
+		fi, err := d.fs.Stat(path)
+		if os.IsNotExist(err) {
+			stamp += "-;"
+			continue
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		stamp += fmt.Sprintf("%d:%d;", fi.ModTime().UnixNano(), fi.Size())
+	}
+
+	return stamp, nil
+}
+
+// NewCommitGraph returns a writer for a new commit-graph file, written to a
+// temporary file until it's set by SetCommitGraph or SetCommitGraphChain.
+func (d *DotGit) NewCommitGraph() (*CommitGraphWriter, error) {
+	f, err := d.fs.TempFile(d.fs.Join(objectsPath, "info"), "tmp_graph_")
+	if err != nil {
+		return nil, err
+	}
+
+	return &CommitGraphWriter{File: f}, nil
+}
+
+// SetCommitGraph makes the file written by w, already closed, the
+// commit-graph file, removing the split commit-graph chain if any.
+func (d *DotGit) SetCommitGraph(w *CommitGraphWriter) error {
+	if err := d.fs.Rename(w.Name(), d.fs.Join(objectsPath, "info", commitGraphPath)); err != nil {
+		return err
+	}
+
+	return d.removeCommitGraphLayers(nil)
+}
+
+// SetCommitGraphChain makes the file written by w, already closed, the top
+// layer of the split commit-graph chain, on top of the layers with the given
+// checksums. The commit-graph file and the layers no longer in the chain are
+// removed.
+func (d *DotGit) SetCommitGraphChain(base []plumbing.Hash, w *CommitGraphWriter) error {
+	if err := d.fs.Rename(w.Name(), d.commitGraphLayerPath(w.Checksum())); err != nil {
+		return err
+	}
+
+	chain := append(append([]plumbing.Hash{}, base...), w.Checksum())
+	if err := d.writeCommitGraphChain(chain); err != nil {
+		return err
+	}
+
+	if err := d.RemoveCommitGraph(); err != nil {
+		return err
+	}
+
+	return d.removeCommitGraphLayers(chain)
+}
+
+func (d *DotGit) writeCommitGraphChain(chain []plumbing.Hash) (err error) {
+	tmp, err := d.fs.TempFile(d.commitGraphsPath(""), "tmp_graph_chain_")
+	if err != nil {
+		return err
+	}
+
+	for _, h := range chain {
+		if _, err = fmt.Fprintf(tmp, "%s\n", h); err != nil {
+			_ = tmp.Close()
+			return err
+		}
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return d.fs.Rename(tmp.Name(), d.commitGraphsPath(commitGraphChainPath))
+}
+
+// RemoveCommitGraph removes the commit-graph file, if any. The split
+// commit-graph chain is kept.
+func (d *DotGit) RemoveCommitGraph() error {
+	err := d.fs.Remove(d.fs.Join(objectsPath, "info", commitGraphPath))
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+// removeCommitGraphLayers removes the layers of the commit-graph-chain not in
+// keep, removing the chain file if keep is empty.
+func (d *DotGit) removeCommitGraphLayers(keep []plumbing.Hash) error {
+	files, err := d.fs.ReadDir(d.commitGraphsPath(""))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	kept := make(map[string]bool)
+	for _, h := range keep {
+		kept[commitGraphLayerName(h)] = true
+	}
+
+	if len(keep) != 0 {
+		kept[commitGraphChainPath] = true
+	}
+
+	for _, f := range files {
+		if kept[f.Name()] {
+			continue
+		}
+
+		if !strings.HasSuffix(f.Name(), commitGraphExt) && f.Name() != commitGraphChainPath {
+			continue
+		}
+
+		name := d.commitGraphsPath(f.Name())
+		if err := d.fs.Remove(name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *DotGit) commitGraphsPath(name string) string {
+	return d.fs.Join(objectsPath, "info", commitGraphsPath, name)
+}
+
+func (d *DotGit) commitGraphLayerPath(h plumbing.Hash) string {
+	return d.commitGraphsPath(commitGraphLayerName(h))
+}
+
+func commitGraphLayerName(h plumbing.Hash) string {
+	return fmt.Sprintf("graph-%s%s", h, commitGraphExt)
+}
+
+func (d *DotGit) openIfExists(path string) (billy.File, error) {
+	f, err := d.fs.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// CommitGraphWriter is a writer of a commit-graph file, keeping track of its
+// checksum, the trailing hash of the file.
+type CommitGraphWriter struct {
+	billy.File
+	tail []byte
+}
+
+// Write writes p to the temporary file.
+func (w *CommitGraphWriter) Write(p []byte) (int, error) {
+	n, err := w.File.Write(p)
+	w.tail = append(w.tail, p[:n]...)
+	if len(w.tail) > len(plumbing.ZeroHash) {
+		w.tail = w.tail[len(w.tail)-len(plumbing.ZeroHash):]
+	}
+
+	return n, err
+}
+
+// Checksum returns the checksum of the written commit-graph.
+func (w *CommitGraphWriter) Checksum() plumbing.Hash {
+	var h plumbing.Hash
+	copy(h[:], w.tail)
+	return h
+}
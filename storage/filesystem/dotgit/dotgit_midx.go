@@ -0,0 +1,41 @@
+package dotgit
+
+import (
+	"os"
+
+	"gopkg.in/src-d/go-billy.v4"
+)
+
+const multiPackIndexPath = "multi-pack-index"
+
+// MultiPackIndex returns a file pointer for read to the multi-pack-index file,
+// nil if it doesn't exist.
+func (d *DotGit) MultiPackIndex() (billy.File, error) {
+	return d.openIfExists(d.multiPackIndexPath())
+}
+
+// NewMultiPackIndex returns a temporary file to write a new multi-pack-index
+// file, until it's set by SetMultiPackIndex.
+func (d *DotGit) NewMultiPackIndex() (billy.File, error) {
+	return d.fs.TempFile(d.fs.Join(objectsPath, packPath), "tmp_midx_")
+}
+
+// SetMultiPackIndex makes the file f, already closed, the multi-pack-index
+// file.
+func (d *DotGit) SetMultiPackIndex(f billy.File) error {
+	return d.fs.Rename(f.Name(), d.multiPackIndexPath())
+}
+
+// RemoveMultiPackIndex removes the multi-pack-index file, if any.
+func (d *DotGit) RemoveMultiPackIndex() error {
+	err := d.fs.Remove(d.multiPackIndexPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+func (d *DotGit) multiPackIndexPath() string {
+	return d.fs.Join(objectsPath, packPath, multiPackIndexPath)
+}
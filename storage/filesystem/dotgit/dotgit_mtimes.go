@@ -0,0 +1,46 @@
+package dotgit
+
+import (
+	"os"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+
+	"gopkg.in/src-d/go-billy.v4"
+)
+
+// ObjectPackMTimes returns a file pointer for read to the mtimes file of the
+// given packfile, nil if it has none, as it isn't a cruft packfile.
+func (d *DotGit) ObjectPackMTimes(hash plumbing.Hash) (billy.File, error) {
+	if err := d.hasPack(hash); err != nil {
+		return nil, err
+	}
+
+	return d.openIfExists(d.objectPackPath(hash, `mtimes`))
+}
+
+// NewObjectPackMTimes returns a temporary file to write a new mtimes file,
+// until it's set by SetObjectPackMTimes.
+func (d *DotGit) NewObjectPackMTimes() (billy.File, error) {
+	return d.fs.TempFile(d.fs.Join(objectsPath, packPath), "tmp_mtimes_")
+}
+
+// SetObjectPackMTimes makes the file f, already closed, the mtimes file of
+// the given packfile.
+func (d *DotGit) SetObjectPackMTimes(f billy.File, hash plumbing.Hash) error {
+	if err := d.hasPack(hash); err != nil {
+		return err
+	}
+
+	return d.fs.Rename(f.Name(), d.objectPackPath(hash, `mtimes`))
+}
+
+// RemoveObjectPackMTimes removes the mtimes file of the given packfile, if
+// any.
+func (d *DotGit) RemoveObjectPackMTimes(hash plumbing.Hash) error {
+	err := d.fs.Remove(d.objectPackPath(hash, `mtimes`))
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
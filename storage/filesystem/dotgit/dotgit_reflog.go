@@ -0,0 +1,73 @@
+package dotgit
+
+import (
+	"os"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+
+	"gopkg.in/src-d/go-billy.v4"
+)
+
+const logsPath = "logs"
+
+// Reflogs returns the names of the references with a reflog.
+func (d *DotGit) Reflogs() ([]plumbing.ReferenceName, error) {
+	var names []plumbing.ReferenceName
+	if _, err := d.fs.Stat(d.reflogPath(plumbing.HEAD)); err == nil {
+		names = append(names, plumbing.HEAD)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	err := d.walkReflogsTree(&names, []string{refsPath})
+	return names, err
+}
+
+func (d *DotGit) walkReflogsTree(names *[]plumbing.ReferenceName, relPath []string) error {
+	files, err := d.fs.ReadDir(d.fs.Join(append([]string{logsPath}, relPath...)...))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	for _, f := range files {
+		newRelPath := append(append([]string(nil), relPath...), f.Name())
+		if f.IsDir() {
+			if err := d.walkReflogsTree(names, newRelPath); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		*names = append(*names, plumbing.ReferenceName(strings.Join(newRelPath, "/")))
+	}
+
+	return nil
+}
+
+// Reflog returns a file pointer for read to the reflog of the given
+// reference, nil if it has none.
+func (d *DotGit) Reflog(name plumbing.ReferenceName) (billy.File, error) {
+	return d.openIfExists(d.reflogPath(name))
+}
+
+// NewReflog returns a temporary file to write a new reflog, until it's set by
+// SetReflog.
+func (d *DotGit) NewReflog() (billy.File, error) {
+	return d.fs.TempFile(logsPath, "tmp_reflog_")
+}
+
+// SetReflog makes the file f, already closed, the reflog of the given
+// reference.
+func (d *DotGit) SetReflog(f billy.File, name plumbing.ReferenceName) error {
+	return d.fs.Rename(f.Name(), d.reflogPath(name))
+}
+
+func (d *DotGit) reflogPath(name plumbing.ReferenceName) string {
+	return d.fs.Join(logsPath, d.fs.Join(strings.Split(name.String(), "/")...))
+}
@@ -8,6 +8,7 @@ import (
 	"runtime"
 	"strings"
 	"testing"
+	"time"
 
 	"gopkg.in/src-d/go-billy.v4"
 	"gopkg.in/src-d/go-git.v4/plumbing"
@@ -760,6 +761,106 @@ func (s *SuiteDotGit) TestPackRefs(c *C) {
 	c.Assert(ref.Hash().String(), Equals, "b8d3ffab552895c19b9fcf7aa264d277cde33881")
 }
 
+func (s *SuiteDotGit) TestPackRefsKeepsSymbolicRefs(c *C) {
+	tmp, err := ioutil.TempDir("", "dot-git")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(tmp)
+
+	fs := osfs.New(tmp)
+	dir := New(fs)
+
+	err = dir.SetRef(plumbing.NewReferenceFromStrings(
+		"refs/remotes/origin/master",
+		"e8d3ffab552895c19b9fcf7aa264d277cde33881",
+	), nil)
+	c.Assert(err, IsNil)
+	err = dir.SetRef(plumbing.NewSymbolicReference(
+		"refs/remotes/origin/HEAD", "refs/remotes/origin/master",
+	), nil)
+	c.Assert(err, IsNil)
+
+	err = dir.PackRefs()
+	c.Assert(err, IsNil)
+
+	looseCount, err := dir.CountLooseRefs()
+	c.Assert(err, IsNil)
+	c.Assert(looseCount, Equals, 1)
+
+	refs, err := dir.Refs()
+	c.Assert(err, IsNil)
+	c.Assert(refs, HasLen, 2)
+
+	ref, err := dir.Ref("refs/remotes/origin/HEAD")
+	c.Assert(err, IsNil)
+	c.Assert(ref.Target(), Equals, plumbing.ReferenceName("refs/remotes/origin/master"))
+}
+
+func (s *SuiteDotGit) TestObjectPackKept(c *C) {
+	fs := fixtures.Basic().ByTag(".git").One().DotGit()
+	dir := New(fs)
+
+	packs, err := dir.ObjectPacks()
+	c.Assert(err, IsNil)
+
+	kept, err := dir.ObjectPackKept(packs[0])
+	c.Assert(err, IsNil)
+	c.Assert(kept, Equals, false)
+
+	f, err := fs.Create(fs.Join("objects", "pack", "pack-"+packs[0].String()+".keep"))
+	c.Assert(err, IsNil)
+	c.Assert(f.Close(), IsNil)
+
+	kept, err = dir.ObjectPackKept(packs[0])
+	c.Assert(err, IsNil)
+	c.Assert(kept, Equals, true)
+}
+
+func (s *SuiteDotGit) TestObjectPackMTimes(c *C) {
+	fs := fixtures.Basic().ByTag(".git").One().DotGit()
+	dir := New(fs)
+
+	packs, err := dir.ObjectPacks()
+	c.Assert(err, IsNil)
+
+	f, err := dir.ObjectPackMTimes(packs[0])
+	c.Assert(err, IsNil)
+	c.Assert(f, IsNil)
+
+	f, err = dir.NewObjectPackMTimes()
+	c.Assert(err, IsNil)
+	_, err = f.Write([]byte("MTME"))
+	c.Assert(err, IsNil)
+	c.Assert(f.Close(), IsNil)
+	c.Assert(dir.SetObjectPackMTimes(f, packs[0]), IsNil)
+
+	f, err = dir.ObjectPackMTimes(packs[0])
+	c.Assert(err, IsNil)
+	c.Assert(f, NotNil)
+	c.Assert(f.Close(), IsNil)
+
+	c.Assert(dir.DeleteOldObjectPackAndIndex(packs[0], time.Time{}), IsNil)
+	_, err = fs.Stat(fs.Join("objects", "pack", "pack-"+packs[0].String()+".mtimes"))
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
+
+func (s *SuiteDotGit) TestReflogs(c *C) {
+	fs := fixtures.Basic().ByTag(".git").One().DotGit()
+	dir := New(fs)
+
+	names, err := dir.Reflogs()
+	c.Assert(err, IsNil)
+	c.Assert(names, DeepEquals, []plumbing.ReferenceName{
+		plumbing.HEAD,
+		"refs/heads/branch",
+		"refs/heads/master",
+		"refs/remotes/origin/HEAD",
+	})
+
+	f, err := dir.Reflog("refs/heads/foo")
+	c.Assert(err, IsNil)
+	c.Assert(f, IsNil)
+}
+
 func (s *SuiteDotGit) TestAlternates(c *C) {
 	tmp, err := ioutil.TempDir("", "dot-git")
 	c.Assert(err, IsNil)
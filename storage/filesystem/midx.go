@@ -0,0 +1,340 @@
+package filesystem
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/midx"
+)
+
+// MultiPackIndex returns the multi-pack-index of the packfiles, nil if there
+// is none or if it covers packfiles no longer available.
+func (s *ObjectStorage) MultiPackIndex() (midx.Index, error) {
+	if err := s.requireIndex(); err != nil {
+		return nil, err
+	}
+
+	return s.multiPackIndex, nil
+}
+
+// WriteMultiPackIndex writes the multi-pack-index of all the packfiles,
+// replacing the existing one. The objects stored in several packfiles are
+// located in the most recently modified one, as git does.
+func (s *ObjectStorage) WriteMultiPackIndex() error {
+	if err := s.requireIndex(); err != nil {
+		return err
+	}
+
+	packs, err := s.dir.ObjectPacks()
+	if err != nil {
+		return err
+	}
+
+	if len(packs) == 0 {
+		s.multiPackIndex, s.multiPackIndexPacks = nil, nil
+		return s.dir.RemoveMultiPackIndex()
+	}
+
+	sort.Slice(packs, func(i, j int) bool {
+		return packIdxName(packs[i]) < packIdxName(packs[j])
+	})
+
+	order, err := s.packsByModTime(packs)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, len(packs))
+	for i, h := range packs {
+		names[i] = packIdxName(h)
+	}
+
+	idx := midx.NewMemoryIndex(names)
+	for _, packID := range order {
+		if err := s.addPackToMultiPackIndex(idx, packs[packID], packID); err != nil {
+			return err
+		}
+	}
+
+	f, err := s.dir.NewMultiPackIndex()
+	if err != nil {
+		return err
+	}
+
+	if err := midx.NewEncoder(f).Encode(idx); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := s.dir.SetMultiPackIndex(f); err != nil {
+		return err
+	}
+
+	s.multiPackIndex, s.multiPackIndexPacks = idx, packs
+	return nil
+}
+
+// packsByModTime returns the positions of the given packfiles sorted by
+// modification time, the newest first.
+func (s *ObjectStorage) packsByModTime(packs []plumbing.Hash) ([]int, error) {
+	order := make([]int, len(packs))
+	modTimes := make([]int64, len(packs))
+	for i, h := range packs {
+		fi, err := s.dir.ObjectPackStat(h)
+		if err != nil {
+			return nil, err
+		}
+
+		order[i] = i
+		modTimes[i] = fi.ModTime().UnixNano()
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		return modTimes[order[i]] > modTimes[order[j]]
+	})
+
+	return order, nil
+}
+
+func (s *ObjectStorage) addPackToMultiPackIndex(
+	idx *midx.MemoryIndex,
+	pack plumbing.Hash,
+	packID int,
+) error {
+	pidx, err := s.packIndex(pack)
+	if err != nil {
+		return err
+	}
+
+	iter, err := pidx.Entries()
+	if err != nil {
+		return err
+	}
+
+	defer iter.Close()
+	for {
+		e, err := iter.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if _, _, err := idx.FindOffset(e.Hash); err == nil {
+			continue
+		}
+
+		idx.Add(e.Hash, packID, int64(e.Offset))
+	}
+}
+
+// VerifyMultiPackIndex checks that the multi-pack-index is well formed and
+// that it locates every object of its packfiles at the offsets of their idx
+// files, like `git multi-pack-index verify` does. It's a no-op if there is no
+// multi-pack-index.
+func (s *ObjectStorage) VerifyMultiPackIndex() error {
+	f, err := s.dir.MultiPackIndex()
+	if f == nil || err != nil {
+		return err
+	}
+
+	r, err := readAll(f)
+	if err != nil {
+		return err
+	}
+
+	if err := verifyMultiPackIndexChecksum(r); err != nil {
+		return err
+	}
+
+	idx, err := midx.OpenFileIndex(r)
+	if err != nil {
+		return err
+	}
+
+	packs := make([]plumbing.Hash, len(idx.PackNames()))
+	for i, name := range idx.PackNames() {
+		h, ok := packHashFromIdxName(name)
+		if !ok {
+			return fmt.Errorf("multi-pack-index: invalid pack name %q", name)
+		}
+
+		if _, err := s.dir.ObjectPackStat(h); err != nil {
+			return fmt.Errorf("multi-pack-index: pack %q: %s", name, err)
+		}
+
+		packs[i] = h
+	}
+
+	if err := s.requireIndex(); err != nil {
+		return err
+	}
+
+	var prev plumbing.Hash
+	for i := 0; i < idx.Count(); i++ {
+		e, err := idx.EntryAt(i)
+		if err != nil {
+			return err
+		}
+
+		if i > 0 && bytes.Compare(prev[:], e.Hash[:]) >= 0 {
+			return fmt.Errorf("multi-pack-index: object %s out of order", e.Hash)
+		}
+
+		prev = e.Hash
+		pidx, err := s.packIndex(packs[e.PackID])
+		if err != nil {
+			return err
+		}
+
+		offset, err := pidx.FindOffset(e.Hash)
+		if err != nil {
+			return fmt.Errorf("multi-pack-index: object %s not found in pack %s",
+				e.Hash, packs[e.PackID])
+		}
+
+		if offset != e.Offset {
+			return fmt.Errorf("multi-pack-index: wrong offset of object %s", e.Hash)
+		}
+	}
+
+	for _, h := range packs {
+		if err := s.verifyPackInMultiPackIndex(idx, h); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *ObjectStorage) verifyPackInMultiPackIndex(idx midx.Index, pack plumbing.Hash) error {
+	pidx, err := s.packIndex(pack)
+	if err != nil {
+		return err
+	}
+
+	iter, err := pidx.Entries()
+	if err != nil {
+		return err
+	}
+
+	defer iter.Close()
+	for {
+		e, err := iter.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if _, _, err := idx.FindOffset(e.Hash); err != nil {
+			return fmt.Errorf("multi-pack-index: object %s of pack %s missing",
+				e.Hash, pack)
+		}
+	}
+}
+
+// RemoveMultiPackIndex removes the multi-pack-index, if any.
+func (s *ObjectStorage) RemoveMultiPackIndex() error {
+	if err := s.dir.RemoveMultiPackIndex(); err != nil {
+		return err
+	}
+
+	if s.multiPackIndex != nil {
+		s.Reindex()
+	}
+
+	return nil
+}
+
+// loadMultiPackIndex loads the multi-pack-index, if any, returning the
+// packfiles it covers. A multi-pack-index that can't be decoded or that
+// covers packfiles no longer available is ignored, git rewrites it on the
+// next repack.
+func (s *ObjectStorage) loadMultiPackIndex(packs []plumbing.Hash) (map[plumbing.Hash]bool, error) {
+	s.multiPackIndex, s.multiPackIndexPacks = nil, nil
+
+	f, err := s.dir.MultiPackIndex()
+	if f == nil || err != nil {
+		return nil, err
+	}
+
+	r, err := readAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	idx, err := midx.OpenFileIndex(r)
+	if err != nil {
+		return nil, nil
+	}
+
+	available := hashListAsMap(packs)
+	covered := make(map[plumbing.Hash]bool)
+	coveredPacks := make([]plumbing.Hash, len(idx.PackNames()))
+	for i, name := range idx.PackNames() {
+		h, ok := packHashFromIdxName(name)
+		if _, found := available[h]; !ok || !found {
+			return nil, nil
+		}
+
+		covered[h] = true
+		coveredPacks[i] = h
+	}
+
+	s.multiPackIndex, s.multiPackIndexPacks = idx, coveredPacks
+	return covered, nil
+}
+
+func verifyMultiPackIndexChecksum(r *bytes.Reader) error {
+	size := r.Size()
+	if size < sha1.Size {
+		return midx.ErrMalformedMultiPackIndex
+	}
+
+	h := sha1.New()
+	if _, err := io.Copy(h, io.NewSectionReader(r, 0, size-sha1.Size)); err != nil {
+		return err
+	}
+
+	checksum := make([]byte, sha1.Size)
+	if _, err := r.ReadAt(checksum, size-sha1.Size); err != nil {
+		return err
+	}
+
+	if !bytes.Equal(h.Sum(nil), checksum) {
+		return fmt.Errorf("multi-pack-index: incorrect checksum")
+	}
+
+	return nil
+}
+
+func packIdxName(h plumbing.Hash) string {
+	return fmt.Sprintf("pack-%s.idx", h)
+}
+
+func packHashFromIdxName(name string) (plumbing.Hash, bool) {
+	if !strings.HasPrefix(name, "pack-") || !strings.HasSuffix(name, ".idx") {
+		return plumbing.ZeroHash, false
+	}
+
+	hex := strings.TrimSuffix(strings.TrimPrefix(name, "pack-"), ".idx")
+	if len(hex) != 40 {
+		return plumbing.ZeroHash, false
+	}
+
+	return plumbing.NewHash(hex), true
+}
@@ -0,0 +1,92 @@
+package filesystem
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem/dotgit"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git-fixtures.v3"
+)
+
+type MultiPackIndexSuite struct {
+	fixtures.Suite
+}
+
+var _ = Suite(&MultiPackIndexSuite{})
+
+func (s *MultiPackIndexSuite) TestWriteMultiPackIndex(c *C) {
+	fs := fixtures.ByTag(".git").ByTag("multi-packfile").One().DotGit()
+	o := NewObjectStorage(dotgit.New(fs), cache.NewObjectLRUDefault())
+
+	idx, err := o.MultiPackIndex()
+	c.Assert(err, IsNil)
+	c.Assert(idx, IsNil)
+
+	packs, err := o.ObjectPacks()
+	c.Assert(err, IsNil)
+	c.Assert(len(packs) > 1, Equals, true)
+
+	c.Assert(o.WriteMultiPackIndex(), IsNil)
+	c.Assert(o.VerifyMultiPackIndex(), IsNil)
+
+	o = NewObjectStorage(dotgit.New(fs), cache.NewObjectLRUDefault())
+	idx, err = o.MultiPackIndex()
+	c.Assert(err, IsNil)
+	c.Assert(idx, NotNil)
+	c.Assert(idx.PackNames(), HasLen, len(packs))
+	c.Assert(o.index, HasLen, 0)
+
+	for i := 0; i < idx.Count(); i++ {
+		e, err := idx.EntryAt(i)
+		c.Assert(err, IsNil)
+
+		obj, err := o.EncodedObject(plumbing.AnyObject, e.Hash)
+		c.Assert(err, IsNil)
+		c.Assert(obj.Hash(), Equals, e.Hash)
+	}
+
+	obj, err := o.getFromPackfile(plumbing.NewHash("8d45a34641d73851e01d3754320b33bb5be3c4d3"), false)
+	c.Assert(err, IsNil)
+	c.Assert(obj.Hash().String(), Equals, "8d45a34641d73851e01d3754320b33bb5be3c4d3")
+}
+
+func (s *MultiPackIndexSuite) TestMultiPackIndexMissingPack(c *C) {
+	fs := fixtures.ByTag(".git").ByTag("multi-packfile").One().DotGit()
+	o := NewObjectStorage(dotgit.New(fs), cache.NewObjectLRUDefault())
+	c.Assert(o.WriteMultiPackIndex(), IsNil)
+
+	packs, err := o.ObjectPacks()
+	c.Assert(err, IsNil)
+	c.Assert(o.DeleteOldObjectPackAndIndex(packs[0], time.Time{}), IsNil)
+
+	idx, err := o.MultiPackIndex()
+	c.Assert(err, IsNil)
+	c.Assert(idx, IsNil)
+
+	err = o.VerifyMultiPackIndex()
+	c.Assert(err, ErrorMatches, "multi-pack-index: pack .*")
+
+	c.Assert(o.RemoveMultiPackIndex(), IsNil)
+	c.Assert(o.VerifyMultiPackIndex(), IsNil)
+}
+
+func (s *MultiPackIndexSuite) TestVerifyMultiPackIndexChecksum(c *C) {
+	fs := fixtures.ByTag(".git").ByTag("multi-packfile").One().DotGit()
+	o := NewObjectStorage(dotgit.New(fs), cache.NewObjectLRUDefault())
+	c.Assert(o.WriteMultiPackIndex(), IsNil)
+
+	path := filepath.Join(fs.Root(), "objects", "pack", "multi-pack-index")
+	b, err := ioutil.ReadFile(path)
+	c.Assert(err, IsNil)
+
+	b[len(b)-1]++
+	c.Assert(ioutil.WriteFile(path, b, 0644), IsNil)
+
+	err = o.VerifyMultiPackIndex()
+	c.Assert(err, ErrorMatches, "multi-pack-index: incorrect checksum")
+}
@@ -0,0 +1,78 @@
+package filesystem
+
+import (
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/mtimes"
+	"gopkg.in/src-d/go-git.v4/utils/ioutil"
+)
+
+// ObjectPackMTimes returns the modification times of the objects of the given
+// packfile, read from its mtimes file, or nil if it has none, as it isn't a
+// cruft packfile.
+func (s *ObjectStorage) ObjectPackMTimes(pack plumbing.Hash) (m map[plumbing.Hash]time.Time, err error) {
+	f, err := s.dir.ObjectPackMTimes(pack)
+	if f == nil || err != nil {
+		return nil, err
+	}
+
+	defer ioutil.CheckClose(f, &err)
+	hashes, err := s.ObjectPackHashes(pack)
+	if err != nil {
+		return nil, err
+	}
+
+	mt := mtimes.New(pack, len(hashes))
+	if err := mtimes.NewDecoder(f).Decode(mt); err != nil {
+		return nil, err
+	}
+
+	m = make(map[plumbing.Hash]time.Time, len(hashes))
+	for i, h := range hashes {
+		m[h] = mt.Time(i)
+	}
+
+	return m, nil
+}
+
+// SetObjectPackMTimes writes the mtimes file of the given packfile, making it
+// a cruft packfile. The objects missing from m get the modification time of
+// the packfile.
+func (s *ObjectStorage) SetObjectPackMTimes(pack plumbing.Hash, m map[plumbing.Hash]time.Time) error {
+	hashes, err := s.ObjectPackHashes(pack)
+	if err != nil {
+		return err
+	}
+
+	packTime, err := s.ObjectPackTime(pack)
+	if err != nil {
+		return err
+	}
+
+	mt := mtimes.New(pack, len(hashes))
+	for i, h := range hashes {
+		t, ok := m[h]
+		if !ok {
+			t = packTime
+		}
+
+		mt.SetTime(i, t)
+	}
+
+	f, err := s.dir.NewObjectPackMTimes()
+	if err != nil {
+		return err
+	}
+
+	if err := mtimes.NewEncoder(f).Encode(mt); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return s.dir.SetObjectPackMTimes(f, pack)
+}
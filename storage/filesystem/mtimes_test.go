@@ -0,0 +1,48 @@
+package filesystem
+
+import (
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git-fixtures.v3"
+)
+
+type MTimesSuite struct {
+	fixtures.Suite
+}
+
+var _ = Suite(&MTimesSuite{})
+
+func (s *MTimesSuite) TestSetObjectPackMTimes(c *C) {
+	fs := fixtures.Basic().One().DotGit()
+	sto := NewStorage(fs, cache.NewObjectLRUDefault())
+
+	packs, err := sto.ObjectPacks()
+	c.Assert(err, IsNil)
+
+	m, err := sto.ObjectPackMTimes(packs[0])
+	c.Assert(err, IsNil)
+	c.Assert(m, IsNil)
+
+	packTime, err := sto.ObjectPackTime(packs[0])
+	c.Assert(err, IsNil)
+
+	commit := plumbing.NewHash("1669dce138d9b841a518c64b10914d88f5e488ea")
+	when := time.Unix(1500000000, 0)
+	err = sto.SetObjectPackMTimes(packs[0], map[plumbing.Hash]time.Time{
+		commit: when,
+	})
+	c.Assert(err, IsNil)
+
+	sto = NewStorage(fs, cache.NewObjectLRUDefault())
+	m, err = sto.ObjectPackMTimes(packs[0])
+	c.Assert(err, IsNil)
+	c.Assert(m, HasLen, 31)
+	c.Assert(m[commit].Equal(when), Equals, true)
+
+	blob := plumbing.NewHash("32858aad3c383ed1ff0a0f9bdf231d54a00c9e88")
+	c.Assert(m[blob].Equal(time.Unix(packTime.Unix(), 0)), Equals, true)
+}
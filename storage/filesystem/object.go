@@ -7,7 +7,9 @@ import (
 
 	"gopkg.in/src-d/go-git.v4/plumbing"
 	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/bitmap"
 	"gopkg.in/src-d/go-git.v4/plumbing/format/idxfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/midx"
 	"gopkg.in/src-d/go-git.v4/plumbing/format/objfile"
 	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
 	"gopkg.in/src-d/go-git.v4/plumbing/storer"
@@ -26,6 +28,14 @@ type ObjectStorage struct {
 
 	dir   *dotgit.DotGit
 	index map[plumbing.Hash]idxfile.Index
+	// multiPackIndex is the multi-pack-index of the packfiles, if any, and
+	// multiPackIndexPacks the packfiles it covers by pack ID. The idx files
+	// of the packfiles covered are only loaded when they're needed.
+	multiPackIndex      midx.Index
+	multiPackIndexPacks []plumbing.Hash
+	// packBitmap are the reachability bitmaps of a packfile, once loaded.
+	packBitmap       *bitmap.Index
+	packBitmapLoaded bool
 
 	packList    []plumbing.Hash
 	packListIdx int
@@ -57,7 +67,16 @@ func (s *ObjectStorage) requireIndex() error {
 		return err
 	}
 
+	covered, err := s.loadMultiPackIndex(packs)
+	if err != nil {
+		return err
+	}
+
 	for _, h := range packs {
+		if covered[h] {
+			continue
+		}
+
 		if err := s.loadIdxFile(h); err != nil {
 			return err
 		}
@@ -69,6 +88,24 @@ func (s *ObjectStorage) requireIndex() error {
 // Reindex indexes again all packfiles. Useful if git changed packfiles externally
 func (s *ObjectStorage) Reindex() {
 	s.index = nil
+	s.multiPackIndex = nil
+	s.multiPackIndexPacks = nil
+	s.packBitmap = nil
+	s.packBitmapLoaded = false
+}
+
+// packIndex returns the index of the given packfile, loading it if it wasn't
+// because the packfile is covered by the multi-pack-index.
+func (s *ObjectStorage) packIndex(h plumbing.Hash) (idxfile.Index, error) {
+	if idx, ok := s.index[h]; ok {
+		return idx, nil
+	}
+
+	if err := s.loadIdxFile(h); err != nil {
+		return nil, err
+	}
+
+	return s.index[h], nil
 }
 
 func (s *ObjectStorage) loadIdxFile(h plumbing.Hash) (err error) {
@@ -269,7 +306,11 @@ func (s *ObjectStorage) encodedObjectSizeFromPackfile(h plumbing.Hash) (
 		return 0, plumbing.ErrObjectNotFound
 	}
 
-	idx := s.index[pack]
+	idx, err := s.packIndex(pack)
+	if err != nil {
+		return 0, err
+	}
+
 	hash, err := idx.FindHash(offset)
 	if err == nil {
 		obj, ok := s.objectCache.Get(hash)
@@ -327,19 +368,7 @@ func (s *ObjectStorage) EncodedObject(t plumbing.ObjectType, h plumbing.Hash) (p
 	// If the error is still object not found, check if it's a shared object
 	// repository.
 	if err == plumbing.ErrObjectNotFound {
-		dotgits, e := s.dir.Alternates()
-		if e == nil {
-			// Create a new object storage with the DotGit(s) and check for the
-			// required hash object. Skip when not found.
-			for _, dg := range dotgits {
-				o := NewObjectStorage(dg, s.objectCache)
-				enobj, enerr := o.EncodedObject(t, h)
-				if enerr != nil {
-					continue
-				}
-				return enobj, nil
-			}
-		}
+		return s.getFromAlternates(t, h)
 	}
 
 	if err != nil {
@@ -353,6 +382,28 @@ func (s *ObjectStorage) EncodedObject(t plumbing.ObjectType, h plumbing.Hash) (p
 	return obj, nil
 }
 
+// getFromAlternates returns the object with the given hash from the
+// repositories in objects/info/alternates, if any.
+func (s *ObjectStorage) getFromAlternates(t plumbing.ObjectType, h plumbing.Hash) (plumbing.EncodedObject, error) {
+	dotgits, err := s.dir.Alternates()
+	if err != nil {
+		return nil, plumbing.ErrObjectNotFound
+	}
+
+	// Create a new object storage with the DotGit(s) and check for the
+	// required hash object. Skip when not found.
+	for _, dg := range dotgits {
+		o := NewObjectStorage(dg, s.objectCache)
+		enobj, enerr := o.EncodedObject(t, h)
+		if enerr != nil {
+			continue
+		}
+		return enobj, nil
+	}
+
+	return nil, plumbing.ErrObjectNotFound
+}
+
 // DeltaObject returns the object with the given hash, by searching for
 // it in the packfile and the git object directories.
 func (s *ObjectStorage) DeltaObject(t plumbing.ObjectType,
@@ -362,6 +413,10 @@ func (s *ObjectStorage) DeltaObject(t plumbing.ObjectType,
 		obj, err = s.getFromPackfile(h, true)
 	}
 
+	if err == plumbing.ErrObjectNotFound {
+		return s.getFromAlternates(t, h)
+	}
+
 	if err != nil {
 		return nil, err
 	}
@@ -428,7 +483,11 @@ func (s *ObjectStorage) getFromPackfile(h plumbing.Hash, canBeDelta bool) (
 		return nil, plumbing.ErrObjectNotFound
 	}
 
-	idx := s.index[pack]
+	idx, err := s.packIndex(pack)
+	if err != nil {
+		return nil, err
+	}
+
 	p, err := s.packfile(idx, pack)
 	if err != nil {
 		return nil, err
@@ -439,7 +498,7 @@ func (s *ObjectStorage) getFromPackfile(h plumbing.Hash, canBeDelta bool) (
 	}
 
 	if canBeDelta {
-		return s.decodeDeltaObjectAt(p, offset, hash)
+		return s.decodeDeltaObjectAt(p, pack, offset, hash)
 	}
 
 	return s.decodeObjectAt(p, offset)
@@ -466,6 +525,7 @@ func (s *ObjectStorage) decodeObjectAt(
 
 func (s *ObjectStorage) decodeDeltaObjectAt(
 	p *packfile.Packfile,
+	pack plumbing.Hash,
 	offset int64,
 	hash plumbing.Hash,
 ) (plumbing.EncodedObject, error) {
@@ -488,7 +548,12 @@ func (s *ObjectStorage) decodeDeltaObjectAt(
 			return nil, err
 		}
 	default:
-		return s.decodeObjectAt(p, offset)
+		obj, err := s.decodeObjectAt(p, offset)
+		if err != nil {
+			return nil, err
+		}
+
+		return &packedObject{obj, s.compressedContent(pack, offset)}, nil
 	}
 
 	obj := &plumbing.MemoryObject{}
@@ -502,10 +567,40 @@ func (s *ObjectStorage) decodeDeltaObjectAt(
 		return nil, err
 	}
 
-	return newDeltaObject(obj, hash, base, header.Length), nil
+	return newDeltaObject(obj, hash, base, header.Length, s.compressedContent(pack, offset)), nil
+}
+
+// compressedContent returns a function reading the compressed content of
+// the object at the given offset of the pack, to reuse it when the object is
+// written to a new packfile.
+func (s *ObjectStorage) compressedContent(pack plumbing.Hash, offset int64) func() ([]byte, error) {
+	return func() (data []byte, err error) {
+		idx, err := s.packIndex(pack)
+		if err != nil {
+			return nil, err
+		}
+
+		p, err := s.packfile(idx, pack)
+		if err != nil {
+			return nil, err
+		}
+
+		if !s.options.KeepDescriptors && s.options.MaxOpenDescriptors == 0 {
+			defer ioutil.CheckClose(p, &err)
+		}
+
+		return p.CompressedContentAt(offset)
+	}
 }
 
 func (s *ObjectStorage) findObjectInPackfile(h plumbing.Hash) (plumbing.Hash, plumbing.Hash, int64) {
+	if s.multiPackIndex != nil {
+		packID, offset, err := s.multiPackIndex.FindOffset(h)
+		if err == nil {
+			return s.multiPackIndexPacks[packID], h, offset
+		}
+	}
+
 	for packfile, index := range s.index {
 		offset, err := index.FindOffset(h)
 		if err == nil {
@@ -555,12 +650,17 @@ func (s *ObjectStorage) buildPackfileIters(
 	return &lazyPackfilesIter{
 		hashes: packs,
 		open: func(h plumbing.Hash) (storer.EncodedObjectIter, error) {
+			idx, err := s.packIndex(h)
+			if err != nil {
+				return nil, err
+			}
+
 			pack, err := s.dir.ObjectPack(h)
 			if err != nil {
 				return nil, err
 			}
 			return newPackfileIter(
-				s.dir.Fs(), pack, t, seen, s.index[h],
+				s.dir.Fs(), pack, t, seen, idx,
 				s.objectCache, s.options.KeepDescriptors,
 			)
 		},
@@ -811,5 +911,64 @@ func (s *ObjectStorage) ObjectPacks() ([]plumbing.Hash, error) {
 }
 
 func (s *ObjectStorage) DeleteOldObjectPackAndIndex(h plumbing.Hash, t time.Time) error {
-	return s.dir.DeleteOldObjectPackAndIndex(h, t)
+	if err := s.dir.DeleteOldObjectPackAndIndex(h, t); err != nil {
+		return err
+	}
+
+	// the packfile may be gone, along with its bitmaps, and then the
+	// multi-pack-index covering it is ignored
+	s.Reindex()
+	return nil
+}
+
+// ObjectPackHashes returns the hashes of the objects in the given pack.
+func (s *ObjectStorage) ObjectPackHashes(h plumbing.Hash) ([]plumbing.Hash, error) {
+	if err := s.requireIndex(); err != nil {
+		return nil, err
+	}
+
+	idx, err := s.packIndex(h)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := idx.Count()
+	if err != nil {
+		return nil, err
+	}
+
+	iter, err := idx.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	defer iter.Close()
+	hashes := make([]plumbing.Hash, 0, count)
+	for {
+		e, err := iter.Next()
+		if err == io.EOF {
+			return hashes, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		hashes = append(hashes, e.Hash)
+	}
+}
+
+// ObjectPackTime returns the modification time of the given pack.
+func (s *ObjectStorage) ObjectPackTime(h plumbing.Hash) (time.Time, error) {
+	fi, err := s.dir.ObjectPackStat(h)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return fi.ModTime(), nil
+}
+
+// ObjectPackKept returns whether the given pack has a .keep file.
+func (s *ObjectStorage) ObjectPackKept(h plumbing.Hash) (bool, error) {
+	return s.dir.ObjectPackKept(h)
 }
@@ -483,3 +483,24 @@ func BenchmarkGetObjectFromPackfile(b *testing.B) {
 		})
 	}
 }
+
+func (s *FsSuite) TestObjectPackInfo(c *C) {
+	fs := fixtures.Basic().One().DotGit()
+	sto := NewObjectStorage(dotgit.New(fs), cache.NewObjectLRUDefault())
+
+	packs, err := sto.ObjectPacks()
+	c.Assert(err, IsNil)
+	c.Assert(packs, HasLen, 1)
+
+	hs, err := sto.ObjectPackHashes(packs[0])
+	c.Assert(err, IsNil)
+	c.Assert(hs, HasLen, 31)
+
+	t, err := sto.ObjectPackTime(packs[0])
+	c.Assert(err, IsNil)
+	c.Assert(t.IsZero(), Equals, false)
+
+	kept, err := sto.ObjectPackKept(packs[0])
+	c.Assert(err, IsNil)
+	c.Assert(kept, Equals, false)
+}
@@ -0,0 +1,46 @@
+package filesystem
+
+import (
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/reflog"
+	"gopkg.in/src-d/go-git.v4/utils/ioutil"
+)
+
+// ReflogReferences returns the names of the references with a reflog.
+func (r *ReferenceStorage) ReflogReferences() ([]plumbing.ReferenceName, error) {
+	return r.dir.Reflogs()
+}
+
+// Reflog returns the entries of the reflog of the given reference, oldest
+// first, none if it has no reflog.
+func (r *ReferenceStorage) Reflog(n plumbing.ReferenceName) (entries []*reflog.Entry, err error) {
+	f, err := r.dir.Reflog(n)
+	if err != nil || f == nil {
+		return nil, err
+	}
+
+	defer ioutil.CheckClose(f, &err)
+	return reflog.NewDecoder(f).Decode()
+}
+
+// SetReflog replaces the entries of the existing reflog of the given
+// reference.
+func (r *ReferenceStorage) SetReflog(n plumbing.ReferenceName, entries []*reflog.Entry) error {
+	f, err := r.dir.NewReflog()
+	if err != nil {
+		return err
+	}
+
+	if err := reflog.NewEncoder(f).Encode(entries); err != nil {
+		_ = f.Close()
+		_ = r.dir.Fs().Remove(f.Name())
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		_ = r.dir.Fs().Remove(f.Name())
+		return err
+	}
+
+	return r.dir.SetReflog(f, n)
+}
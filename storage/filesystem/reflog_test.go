@@ -0,0 +1,42 @@
+package filesystem
+
+import (
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git-fixtures.v3"
+)
+
+type ReflogSuite struct {
+	fixtures.Suite
+}
+
+var _ = Suite(&ReflogSuite{})
+
+func (s *ReflogSuite) TestReflog(c *C) {
+	fs := fixtures.Basic().One().DotGit()
+	sto := NewStorage(fs, cache.NewObjectLRUDefault())
+
+	names, err := sto.ReflogReferences()
+	c.Assert(err, IsNil)
+	c.Assert(names, HasLen, 4)
+
+	entries, err := sto.Reflog(plumbing.HEAD)
+	c.Assert(err, IsNil)
+	c.Assert(len(entries) > 0, Equals, true)
+	c.Assert(entries[0].Old, Equals, plumbing.ZeroHash)
+
+	c.Assert(sto.SetReflog(plumbing.HEAD, entries[:1]), IsNil)
+
+	got, err := sto.Reflog(plumbing.HEAD)
+	c.Assert(err, IsNil)
+	c.Assert(got, HasLen, 1)
+	c.Assert(got[0].New, Equals, entries[0].New)
+	c.Assert(got[0].When.Equal(entries[0].When), Equals, true)
+	c.Assert(got[0].Message, Equals, entries[0].Message)
+
+	entries, err = sto.Reflog("refs/heads/foo")
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 0)
+}
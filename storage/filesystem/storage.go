@@ -2,6 +2,9 @@
 package filesystem
 
 import (
+	"os"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
 	"gopkg.in/src-d/go-git.v4/plumbing/cache"
 	"gopkg.in/src-d/go-git.v4/storage/filesystem/dotgit"
 
@@ -19,6 +22,7 @@ type Storage struct {
 	ReferenceStorage
 	IndexStorage
 	ShallowStorage
+	CommitGraphStorage
 	ConfigStorage
 	ModuleStorage
 }
@@ -53,12 +57,13 @@ func NewStorageWithOptions(fs billy.Filesystem, cache cache.Object, ops Options)
 		fs:  fs,
 		dir: dir,
 
-		ObjectStorage:    *NewObjectStorageWithOptions(dir, cache, ops),
-		ReferenceStorage: ReferenceStorage{dir: dir},
-		IndexStorage:     IndexStorage{dir: dir},
-		ShallowStorage:   ShallowStorage{dir: dir},
-		ConfigStorage:    ConfigStorage{dir: dir},
-		ModuleStorage:    ModuleStorage{dir: dir},
+		ObjectStorage:      *NewObjectStorageWithOptions(dir, cache, ops),
+		ReferenceStorage:   ReferenceStorage{dir: dir},
+		IndexStorage:       IndexStorage{dir: dir},
+		ShallowStorage:     ShallowStorage{dir: dir},
+		CommitGraphStorage: CommitGraphStorage{dir: dir},
+		ConfigStorage:      ConfigStorage{dir: dir},
+		ModuleStorage:      ModuleStorage{dir: dir},
 	}
 }
 
@@ -71,3 +76,42 @@ func (s *Storage) Filesystem() billy.Filesystem {
 func (s *Storage) Init() error {
 	return s.dir.Initialize()
 }
+
+// AddAlternate makes the objects of another repository available in this
+// one, adding the given path of its objects directory to
+// objects/info/alternates.
+func (s *Storage) AddAlternate(path string) error {
+	return s.dir.AddAlternate(path)
+}
+
+// RemoveAlternates removes the alternates of the repository, the objects
+// borrowed from them are not available anymore.
+func (s *Storage) RemoveAlternates() error {
+	return s.dir.RemoveAlternates()
+}
+
+// AlternateReferences returns the references of the repositories in
+// objects/info/alternates, the objects reachable from them are available in
+// this repository.
+func (s *Storage) AlternateReferences() ([]*plumbing.Reference, error) {
+	dirs, err := s.dir.Alternates()
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var refs []*plumbing.Reference
+	for _, dir := range dirs {
+		r, err := dir.Refs()
+		if err != nil {
+			return nil, err
+		}
+
+		refs = append(refs, r...)
+	}
+
+	return refs, nil
+}
@@ -35,6 +35,12 @@ func setUpTest(s *StorageSuite, c *C, storage *Storage) {
 	var _ storer.IndexStorer = storage
 	var _ storer.ReferenceStorer = storage
 	var _ storer.ShallowStorer = storage
+	var _ storer.CommitGraphStorer = storage
+	var _ storer.MultiPackIndexStorer = storage
+	var _ storer.PackBitmapStorer = storage
+	var _ storer.ObjectPackInfoStorer = storage
+	var _ storer.CruftPackStorer = storage
+	var _ storer.ReflogStorer = storage
 	var _ storer.DeltaObjectStorer = storage
 	var _ storer.PackfileWriter = storage
 
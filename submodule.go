@@ -123,7 +123,13 @@ func (s *Submodule) Repository() (*Repository, error) {
 	}
 
 	if exists {
-		return Open(storer, worktree)
+		r, err := Open(storer, worktree)
+		if err != nil {
+			return nil, err
+		}
+
+		r.loader = s.w.r.loader
+		return r, nil
 	}
 
 	r, err := Init(storer, worktree)
@@ -131,14 +137,55 @@ func (s *Submodule) Repository() (*Repository, error) {
 		return nil, err
 	}
 
+	r.loader = s.w.r.loader
+
+	url, err := s.remoteURL()
+	if err != nil {
+		return nil, err
+	}
+
 	_, err = r.CreateRemote(&config.RemoteConfig{
 		Name: DefaultRemoteName,
-		URLs: []string{s.c.URL},
+		URLs: []string{url},
 	})
 
 	return r, err
 }
 
+// remoteURL returns the URL of the submodule rewritten with the
+// url.<base>.insteadOf rules of the superproject config, since the local
+// config of the superproject isn't read by the submodule repository.
+func (s *Submodule) remoteURL() (string, error) {
+	cfg, err := s.w.r.ConfigScoped(config.SystemScope)
+	if err != nil {
+		return "", err
+	}
+
+	return cfg.RewriteURL(s.c.URL), nil
+}
+
+// updateRemoteURL points the default remote of the submodule repository to
+// the rewritten URL of the submodule, if it still has the URL not rewritten.
+func (s *Submodule) updateRemoteURL(r *Repository) error {
+	url, err := s.remoteURL()
+	if err != nil || url == s.c.URL {
+		return err
+	}
+
+	cfg, err := r.Storer.Config()
+	if err != nil {
+		return err
+	}
+
+	remote, ok := cfg.Remotes[DefaultRemoteName]
+	if !ok || len(remote.URLs) == 0 || remote.URLs[0] != s.c.URL {
+		return nil
+	}
+
+	remote.URLs[0] = url
+	return r.Storer.SetConfig(cfg)
+}
+
 // Update the registered submodule to match what the superproject expects, the
 // submodule should be initialized first calling the Init method or setting in
 // the options SubmoduleUpdateOptions.Init equals true
@@ -188,6 +235,10 @@ func (s *Submodule) update(ctx context.Context, o *SubmoduleUpdateOptions, force
 		return err
 	}
 
+	if err := s.updateRemoteURL(r); err != nil {
+		return err
+	}
+
 	if err := s.fetchAndCheckout(ctx, r, o, hash); err != nil {
 		return err
 	}
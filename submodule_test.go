@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"gopkg.in/src-d/go-git.v4/config"
 	"gopkg.in/src-d/go-git.v4/plumbing"
 
 	. "gopkg.in/check.v1"
@@ -92,6 +93,36 @@ func (s *SubmoduleSuite) TestUpdate(c *C) {
 	c.Assert(status.IsClean(), Equals, true)
 }
 
+func (s *SubmoduleSuite) TestUpdateWithInsteadOf(c *C) {
+	sm, err := s.Worktree.Submodule("basic")
+	c.Assert(err, IsNil)
+	c.Assert(sm.Init(), IsNil)
+
+	// the remote created before the rule is pointed to the rewritten URL
+	_, err = sm.Repository()
+	c.Assert(err, IsNil)
+
+	url := s.GetBasicLocalRepositoryURL()
+	cfg, err := s.Repository.Config()
+	c.Assert(err, IsNil)
+	cfg.URLs[url] = &config.URL{Name: url, InsteadOfs: []string{sm.Config().URL}}
+	c.Assert(s.Repository.Storer.SetConfig(cfg), IsNil)
+
+	err = sm.Update(&SubmoduleUpdateOptions{})
+	c.Assert(err, IsNil)
+
+	r, err := sm.Repository()
+	c.Assert(err, IsNil)
+
+	remote, err := r.Remote(DefaultRemoteName)
+	c.Assert(err, IsNil)
+	c.Assert(remote.Config().URLs, DeepEquals, []string{url})
+
+	ref, err := r.Reference(plumbing.HEAD, true)
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash().String(), Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+}
+
 func (s *SubmoduleSuite) TestRepositoryWithoutInit(c *C) {
 	sm, err := s.Worktree.Submodule("basic")
 	c.Assert(err, IsNil)
@@ -0,0 +1,273 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	graph "gopkg.in/src-d/go-git.v4/plumbing/object/commitgraph"
+)
+
+var (
+	// ErrBranchNoUpstream is returned when the branch has no upstream
+	// configured.
+	ErrBranchNoUpstream = errors.New("branch has no upstream")
+	// ErrUpstreamGone is returned when the remote-tracking reference of the
+	// upstream branch doesn't exist.
+	ErrUpstreamGone = errors.New("upstream branch is gone")
+	// ErrDetachedHead is returned when the operation needs a branch checked
+	// out, but HEAD is detached.
+	ErrDetachedHead = errors.New("HEAD is detached")
+	// ErrPushDefaultNothing is returned when pushing without refspecs and
+	// push.default is "nothing".
+	ErrPushDefaultNothing = errors.New("push.default is nothing, refspecs are required")
+	// ErrUpstreamNameMismatch is returned when pushing without refspecs,
+	// with push.default "simple", and the upstream branch has a different
+	// name than the current branch.
+	ErrUpstreamNameMismatch = errors.New("upstream branch name does not match the current branch")
+)
+
+// TrackingStatus is the state of a local branch compared with its upstream.
+type TrackingStatus struct {
+	// Branch is the reference of the local branch.
+	Branch plumbing.ReferenceName
+	// Upstream is the reference tracking the upstream branch, a
+	// remote-tracking reference or a local branch.
+	Upstream plumbing.ReferenceName
+	// Ahead is the number of commits in Branch not present in Upstream.
+	Ahead int
+	// Behind is the number of commits in Upstream not present in Branch.
+	Behind int
+}
+
+// BranchTrackingStatus returns how many commits the local branch with the
+// given name is ahead and behind its upstream, as configured in
+// branch.<name>.remote and branch.<name>.merge. ErrBranchNoUpstream is
+// returned if the branch has no upstream, and ErrUpstreamGone if the upstream
+// was not fetched or was deleted.
+func (r *Repository) BranchTrackingStatus(name string) (*TrackingStatus, error) {
+	cfg, err := r.Storer.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	b, ok := cfg.Branches[name]
+	if !ok {
+		return nil, ErrBranchNoUpstream
+	}
+
+	upstream, err := upstreamReference(cfg, b)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &TrackingStatus{
+		Branch:   plumbing.NewBranchReferenceName(name),
+		Upstream: upstream,
+	}
+
+	local, err := r.referenceCommit(status.Branch)
+	if err != nil {
+		return nil, err
+	}
+
+	remote, err := r.referenceCommit(upstream)
+	if err == plumbing.ErrReferenceNotFound {
+		return nil, ErrUpstreamGone
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	status.Ahead, status.Behind, err = r.aheadBehind(local, remote)
+	if err != nil {
+		return nil, err
+	}
+
+	return status, nil
+}
+
+// aheadBehind returns the result of local.AheadBehind(remote), walking the
+// commit-graph by generation if the repository has one.
+func (r *Repository) aheadBehind(local, remote *object.Commit) (ahead, behind int, err error) {
+	nodes, err := r.commitGraphNodeIndex()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if nodes == nil {
+		return local.AheadBehind(remote)
+	}
+
+	localNode, err := nodes.Get(local.Hash)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	remoteNode, err := nodes.Get(remote.Hash)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return graph.AheadBehind(localNode, remoteNode)
+}
+
+func (r *Repository) referenceCommit(name plumbing.ReferenceName) (*object.Commit, error) {
+	ref, err := r.Reference(name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.CommitObject(ref.Hash())
+}
+
+// upstreamReference returns the local reference tracking the upstream of the
+// branch, mapping branch.<name>.merge with the fetch refspecs of the remote.
+func upstreamReference(cfg *config.Config, b *config.Branch) (plumbing.ReferenceName, error) {
+	if b.Remote == "" || b.Merge == "" {
+		return "", ErrBranchNoUpstream
+	}
+
+	if b.Remote == "." {
+		return b.Merge, nil
+	}
+
+	remote, ok := cfg.Remotes[b.Remote]
+	if !ok {
+		return "", ErrRemoteNotFound
+	}
+
+	for _, rs := range remote.Fetch {
+		if rs.Match(b.Merge) {
+			return rs.Dst(b.Merge), nil
+		}
+	}
+
+	return "", ErrBranchNoUpstream
+}
+
+// pushDefaultRefSpecs returns the refspecs to push to the remote, as decided
+// by push.default, or nil if push.default is not set.
+func (r *Repository) pushDefaultRefSpecs(remoteName string) ([]config.RefSpec, error) {
+	cfg, err := r.ConfigScoped(config.SystemScope)
+	if err != nil {
+		return nil, err
+	}
+
+	switch cfg.Push.Default {
+	case "":
+		return nil, nil
+	case config.PushDefaultNothing:
+		return nil, ErrPushDefaultNothing
+	case config.PushDefaultMatching:
+		return []config.RefSpec{config.RefSpec(config.DefaultPushRefSpec)}, nil
+	case config.PushDefaultCurrent, config.PushDefaultUpstream, config.PushDefaultSimple:
+	default:
+		return nil, fmt.Errorf("unknown push.default mode %q", cfg.Push.Default)
+	}
+
+	head, err := r.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return nil, err
+	}
+
+	if head.Type() != plumbing.SymbolicReference || !head.Target().IsBranch() {
+		return nil, ErrDetachedHead
+	}
+
+	branch := head.Target()
+	current := []config.RefSpec{pushRefSpec(branch, branch)}
+	if cfg.Push.Default == config.PushDefaultCurrent {
+		return current, nil
+	}
+
+	b, ok := cfg.Branches[branch.Short()]
+	if !ok {
+		b = &config.Branch{Name: branch.Short()}
+	}
+
+	upstreamRemote := b.Remote
+	if upstreamRemote == "" {
+		upstreamRemote = DefaultRemoteName
+	}
+
+	if remoteName != upstreamRemote {
+		if cfg.Push.Default == config.PushDefaultSimple {
+			return current, nil
+		}
+
+		return nil, fmt.Errorf("remote %q is not the upstream of the current branch", remoteName)
+	}
+
+	if b.Merge == "" {
+		return nil, ErrBranchNoUpstream
+	}
+
+	if cfg.Push.Default == config.PushDefaultSimple && b.Merge != branch {
+		return nil, ErrUpstreamNameMismatch
+	}
+
+	return []config.RefSpec{pushRefSpec(branch, b.Merge)}, nil
+}
+
+func pushRefSpec(src, dst plumbing.ReferenceName) config.RefSpec {
+	return config.RefSpec(fmt.Sprintf("%s:%s", src, dst))
+}
+
+// setUpstream configures the local branches pushed with the refspecs to
+// track the remote branches they were pushed to.
+func (r *Repository) setUpstream(remoteName string, specs []config.RefSpec) error {
+	cfg, err := r.Storer.Config()
+	if err != nil {
+		return err
+	}
+
+	refs, err := r.Storer.IterReferences()
+	if err != nil {
+		return err
+	}
+
+	var branches []plumbing.ReferenceName
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Name().IsBranch() {
+			branches = append(branches, ref.Name())
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for _, rs := range specs {
+		if rs.IsDelete() {
+			continue
+		}
+
+		for _, name := range branches {
+			if !rs.Match(name) {
+				continue
+			}
+
+			dst := rs.Dst(name)
+			if !dst.IsBranch() {
+				continue
+			}
+
+			b, ok := cfg.Branches[name.Short()]
+			if !ok {
+				b = &config.Branch{Name: name.Short()}
+				cfg.Branches[b.Name] = b
+			}
+
+			b.Remote = remoteName
+			b.Merge = dst
+		}
+	}
+
+	return r.Storer.SetConfig(cfg)
+}
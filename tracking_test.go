@@ -0,0 +1,180 @@
+package git
+
+import (
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+)
+
+type TrackingSuite struct {
+	BaseSuite
+}
+
+var _ = Suite(&TrackingSuite{})
+
+func (s *TrackingSuite) clone(c *C) *Repository {
+	r, err := Clone(memory.NewStorage(), memfs.New(), &CloneOptions{
+		URL: s.GetBasicLocalRepositoryURL(),
+	})
+	c.Assert(err, IsNil)
+
+	return r
+}
+
+func (s *TrackingSuite) setConfig(c *C, r *Repository, f func(cfg *config.Config)) {
+	cfg, err := r.Config()
+	c.Assert(err, IsNil)
+	f(cfg)
+	c.Assert(r.Storer.SetConfig(cfg), IsNil)
+}
+
+func (s *TrackingSuite) TestBranchTrackingStatus(c *C) {
+	r := s.clone(c)
+
+	status, err := r.BranchTrackingStatus("master")
+	c.Assert(err, IsNil)
+	c.Assert(status, DeepEquals, &TrackingStatus{
+		Branch:   plumbing.Master,
+		Upstream: "refs/remotes/origin/master",
+	})
+
+	old, err := r.ResolveRevision("HEAD~2")
+	c.Assert(err, IsNil)
+	err = r.Storer.SetReference(plumbing.NewHashReference("refs/remotes/origin/master", *old))
+	c.Assert(err, IsNil)
+
+	status, err = r.BranchTrackingStatus("master")
+	c.Assert(err, IsNil)
+	c.Assert(status.Ahead, Equals, 2)
+	c.Assert(status.Behind, Equals, 0)
+
+	err = r.Storer.SetReference(plumbing.NewHashReference(plumbing.Master, *old))
+	c.Assert(err, IsNil)
+	err = r.Storer.SetReference(plumbing.NewHashReference("refs/remotes/origin/master",
+		plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881")))
+	c.Assert(err, IsNil)
+
+	status, err = r.BranchTrackingStatus("master")
+	c.Assert(err, IsNil)
+	c.Assert(status.Ahead, Equals, 0)
+	c.Assert(status.Behind, Equals, 2)
+}
+
+func (s *TrackingSuite) TestBranchTrackingStatusErrors(c *C) {
+	r := s.clone(c)
+
+	_, err := r.BranchTrackingStatus("branch")
+	c.Assert(err, Equals, ErrBranchNoUpstream)
+
+	err = r.Storer.SetReference(plumbing.NewHashReference("refs/heads/branch",
+		plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881")))
+	c.Assert(err, IsNil)
+
+	s.setConfig(c, r, func(cfg *config.Config) {
+		cfg.Branches["branch"] = &config.Branch{
+			Name:   "branch",
+			Remote: DefaultRemoteName,
+			Merge:  "refs/heads/missing",
+		}
+	})
+
+	_, err = r.BranchTrackingStatus("branch")
+	c.Assert(err, Equals, ErrUpstreamGone)
+
+	s.setConfig(c, r, func(cfg *config.Config) {
+		cfg.Branches["branch"].Remote = "."
+		cfg.Branches["branch"].Merge = plumbing.Master
+	})
+
+	status, err := r.BranchTrackingStatus("branch")
+	c.Assert(err, IsNil)
+	c.Assert(status.Upstream, Equals, plumbing.Master)
+	c.Assert(status.Ahead, Equals, 1)
+	c.Assert(status.Behind, Equals, 1)
+}
+
+func (s *TrackingSuite) TestPushSetUpstream(c *C) {
+	url := c.MkDir()
+	server, err := PlainInit(url, true)
+	c.Assert(err, IsNil)
+
+	r := s.clone(c)
+	_, err = r.CreateRemote(&config.RemoteConfig{Name: "server", URLs: []string{url}})
+	c.Assert(err, IsNil)
+
+	s.setConfig(c, r, func(cfg *config.Config) {
+		cfg.Push.Default = config.PushDefaultCurrent
+	})
+
+	err = r.Push(&PushOptions{RemoteName: "server", SetUpstream: true})
+	c.Assert(err, IsNil)
+
+	refs, err := server.References()
+	c.Assert(err, IsNil)
+	var names []plumbing.ReferenceName
+	refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference {
+			names = append(names, ref.Name())
+		}
+		return nil
+	})
+	c.Assert(names, DeepEquals, []plumbing.ReferenceName{plumbing.Master})
+
+	b, err := r.Branch("master")
+	c.Assert(err, IsNil)
+	c.Assert(b.Remote, Equals, "server")
+	c.Assert(b.Merge, Equals, plumbing.Master)
+
+	err = r.Push(&PushOptions{RemoteName: "server", SetUpstream: true})
+	c.Assert(err, Equals, NoErrAlreadyUpToDate)
+}
+
+func (s *TrackingSuite) TestPushDefault(c *C) {
+	url := c.MkDir()
+	server, err := PlainInit(url, true)
+	c.Assert(err, IsNil)
+
+	r := s.clone(c)
+	_, err = r.CreateRemote(&config.RemoteConfig{Name: "server", URLs: []string{url}})
+	c.Assert(err, IsNil)
+
+	s.setConfig(c, r, func(cfg *config.Config) {
+		cfg.Push.Default = config.PushDefaultNothing
+	})
+
+	err = r.Push(&PushOptions{RemoteName: "server"})
+	c.Assert(err, Equals, ErrPushDefaultNothing)
+
+	s.setConfig(c, r, func(cfg *config.Config) {
+		cfg.Push.Default = config.PushDefaultUpstream
+		cfg.Branches["master"].Remote = "server"
+		cfg.Branches["master"].Merge = "refs/heads/upstream"
+	})
+
+	err = r.Push(&PushOptions{RemoteName: DefaultRemoteName})
+	c.Assert(err, ErrorMatches, ".*not the upstream.*")
+
+	s.setConfig(c, r, func(cfg *config.Config) {
+		cfg.Push.Default = config.PushDefaultSimple
+	})
+
+	err = r.Push(&PushOptions{RemoteName: "server"})
+	c.Assert(err, Equals, ErrUpstreamNameMismatch)
+
+	s.setConfig(c, r, func(cfg *config.Config) {
+		cfg.Push.Default = config.PushDefaultUpstream
+	})
+
+	err = r.Push(&PushOptions{RemoteName: "server"})
+	c.Assert(err, IsNil)
+
+	ref, err := server.Reference("refs/heads/upstream", false)
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash().String(), Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+
+	_, err = server.Reference(plumbing.Master, false)
+	c.Assert(err, Equals, plumbing.ErrReferenceNotFound)
+}
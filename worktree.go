@@ -77,6 +77,7 @@ func (w *Worktree) PullContext(ctx context.Context, o *PullOptions) error {
 		Auth:       o.Auth,
 		Progress:   o.Progress,
 		Force:      o.Force,
+		Retry:      o.Retry,
 	})
 
 	updated := true
@@ -248,7 +248,7 @@ func (s *RepositorySuite) TestPullAdd(c *C) {
 	ExecuteOnPath(c, path,
 		"touch foo",
 		"git add foo",
-		"git commit -m foo foo",
+		"git -c user.name=foo -c user.email=foo@foo.com commit -m foo foo",
 	)
 
 	w, err := r.Worktree()